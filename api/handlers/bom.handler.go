@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"nexfi-backend/api/services"
+	"nexfi-backend/dto"
+	"nexfi-backend/utils"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BOMHandler handles bill of materials HTTP requests
+type BOMHandler struct {
+	service *services.BOMService
+}
+
+// NewBOMHandler creates a new BOMHandler
+func NewBOMHandler(db *gorm.DB) *BOMHandler {
+	return &BOMHandler{
+		service: services.NewBOMService(db),
+	}
+}
+
+// GetCircuitBOM godoc
+// @Summary Get circuit bill of materials
+// @Description Resolve every part of a circuit to the component catalog, grouped with quantities, prices (IDR) and stock
+// @Tags Circuits
+// @Produce json
+// @Produce text/csv
+// @Param id path string true "Circuit ID"
+// @Param format query string false "Response format (json, csv)" default(json)
+// @Security Bearer
+// @Success 200 {object} dto.BOMResponse "Bill of materials"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Circuit not found"
+// @Router /circuits/{id}/bom [get]
+func (h *BOMHandler) GetCircuitBOM(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bom, err := h.service.GetCircuitBOM(c.Param("id"), userID.(string))
+	if err != nil {
+		respondBOMError(c, err)
+		return
+	}
+
+	h.respond(c, bom)
+}
+
+// GetProjectBOM godoc
+// @Summary Get project bill of materials
+// @Description Resolve the project schema and declared components to the catalog, grouped with quantities, prices (IDR) and stock
+// @Tags Projects
+// @Produce json
+// @Produce text/csv
+// @Param id path string true "Project ID"
+// @Param format query string false "Response format (json, csv)" default(json)
+// @Security Bearer
+// @Success 200 {object} dto.BOMResponse "Bill of materials"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Router /projects/{id}/bom [get]
+func (h *BOMHandler) GetProjectBOM(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bom, err := h.service.GetProjectBOM(c.Param("id"), userID.(string))
+	if err != nil {
+		respondBOMError(c, err)
+		return
+	}
+
+	h.respond(c, bom)
+}
+
+// respond writes the BOM as JSON or as a CSV download
+func (h *BOMHandler) respond(c *gin.Context, bom *dto.BOMResponse) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    bom,
+		})
+	case "csv":
+		content, err := h.service.ToCSV(bom)
+		if err != nil {
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-bom.csv"`, safeFilename(bom.SourceName)))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", content)
+	default:
+		utils.RespondWithError(c, http.StatusBadRequest, "unsupported format")
+	}
+}
+
+func respondBOMError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "circuit not found", "project not found":
+		utils.RespondWithError(c, http.StatusNotFound, err.Error())
+	case "access denied":
+		utils.RespondWithError(c, http.StatusForbidden, err.Error())
+	case "invalid schema data":
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// safeFilename turns a display name into a download-safe file name
+func safeFilename(name string) string {
+	name = strings.Trim(unsafeFilenameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if name == "" {
+		return "download"
+	}
+	return name
+}
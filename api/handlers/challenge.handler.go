@@ -217,7 +217,7 @@ func (h *ChallengeHandler) UpdateProgress(c *gin.Context) {
 
 // SubmitChallenge godoc
 // @Summary Submit challenge completion
-// @Description Submit challenge for completion and earn XP rewards
+// @Description Submit challenge for completion and earn XP rewards. Logic exercises (validation criteria of type "logic") are auto-graded: submission_data holds the circuit as schema_data or a simulation_id, its test vectors are simulated, and a failing circuit gets a grade report instead of XP.
 // @Tags Challenges
 // @Accept json
 // @Produce json
@@ -250,9 +250,14 @@ func (h *ChallengeHandler) SubmitChallenge(c *gin.Context) {
 		return
 	}
 
+	message := "Challenge completed!"
+	if !result.Passed {
+		message = "Not passed yet: " + result.Grade.Feedback
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Challenge completed!",
+		"message": message,
 		"data":    result,
 	})
 }
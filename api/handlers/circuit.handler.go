@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"nexfi-backend/api/services"
 	"nexfi-backend/dto"
 	"nexfi-backend/utils"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -123,6 +126,9 @@ func (h *CircuitHandler) CreateCircuit(c *gin.Context) {
 
 	circuit, xpEarned, err := h.service.CreateCircuit(userID.(string), req)
 	if err != nil {
+		if respondSchemaError(c, err) {
+			return
+		}
 		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -165,6 +171,9 @@ func (h *CircuitHandler) UpdateCircuit(c *gin.Context) {
 
 	circuit, err := h.service.UpdateCircuit(circuitID, userID.(string), req)
 	if err != nil {
+		if respondSchemaError(c, err) {
+			return
+		}
 		if err.Error() == "circuit not found" {
 			utils.RespondWithError(c, http.StatusNotFound, err.Error())
 		} else if err.Error() == "access denied" {
@@ -217,13 +226,14 @@ func (h *CircuitHandler) DeleteCircuit(c *gin.Context) {
 
 // DuplicateCircuit godoc
 // @Summary Duplicate circuit
-// @Description Create a copy of an existing circuit
+// @Description Create a copy of an existing circuit. Copies of other users' public circuits are forks: they link back to the original and notify its author.
 // @Tags Circuits
 // @Param id path string true "Circuit ID to duplicate"
 // @Security Bearer
 // @Success 201 {object} map[string]interface{} "Circuit duplicated"
 // @Failure 404 {object} map[string]string "Circuit not found"
 // @Router /circuits/{id}/duplicate [post]
+// @Router /circuits/{id}/fork [post]
 func (h *CircuitHandler) DuplicateCircuit(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -247,14 +257,18 @@ func (h *CircuitHandler) DuplicateCircuit(c *gin.Context) {
 
 // UploadThumbnail godoc
 // @Summary Upload circuit thumbnail
-// @Description Upload a thumbnail image for a circuit
+// @Description Upload a thumbnail image for a circuit. Send an empty body to re-render it from the schema.
 // @Tags Circuits
 // @Accept json
 // @Produce json
 // @Param id path string true "Circuit ID"
-// @Param thumbnail body dto.CircuitThumbnailRequest true "Base64 image data"
+// @Param thumbnail body dto.CircuitThumbnailRequest false "Base64 PNG image data"
 // @Security Bearer
 // @Success 200 {object} dto.CircuitThumbnailResponse "Thumbnail uploaded"
+// @Failure 400 {object} map[string]string "Invalid request body or image data"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Circuit not found"
+// @Failure 413 {object} map[string]string "Image is too large"
 // @Router /circuits/{id}/thumbnail [post]
 func (h *CircuitHandler) UploadThumbnail(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -265,14 +279,26 @@ func (h *CircuitHandler) UploadThumbnail(c *gin.Context) {
 
 	circuitID := c.Param("id")
 	var req dto.CircuitThumbnailRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+	// An empty body re-renders the thumbnail from the schema
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	thumbnailURL, err := h.service.UploadThumbnail(circuitID, userID.(string), req.ImageData)
 	if err != nil {
-		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		switch err.Error() {
+		case "circuit not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "invalid image data", "invalid schema data":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		case "image is too large":
+			utils.RespondWithError(c, http.StatusRequestEntityTooLarge, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
@@ -284,6 +310,44 @@ func (h *CircuitHandler) UploadThumbnail(c *gin.Context) {
 	})
 }
 
+// GetPreview godoc
+// @Summary Render circuit preview
+// @Description Render the circuit schematic as an SVG or PNG image
+// @Tags Circuits
+// @Produce image/svg+xml,image/png
+// @Param id path string true "Circuit ID"
+// @Param format query string false "Image format: svg, png" default(svg)
+// @Security Bearer
+// @Success 200 {file} file "Rendered image"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Circuit not found"
+// @Router /circuits/{id}/preview [get]
+func (h *CircuitHandler) GetPreview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	circuitID := c.Param("id")
+	format := c.DefaultQuery("format", "svg")
+
+	content, contentType, err := h.service.RenderPreview(circuitID, userID.(string), format)
+	if err != nil {
+		switch err.Error() {
+		case "circuit not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, content)
+}
+
 // ListTemplates godoc
 // @Summary List circuit templates
 // @Description Get list of available circuit templates
@@ -354,11 +418,11 @@ func (h *CircuitHandler) UseTemplate(c *gin.Context) {
 
 // ExportCircuit godoc
 // @Summary Export circuit
-// @Description Export circuit in different formats (json, spice)
+// @Description Export circuit in different formats (json, spice, wokwi)
 // @Tags Circuits
 // @Produce json
 // @Param id path string true "Circuit ID"
-// @Param format query string false "Export format: json, spice" default(json)
+// @Param format query string false "Export format: json, spice, wokwi" default(json)
 // @Security Bearer
 // @Success 200 {object} dto.CircuitExportResponse "Export data"
 // @Router /circuits/{id}/export [get]
@@ -383,3 +447,359 @@ func (h *CircuitHandler) ExportCircuit(c *gin.Context) {
 		"data":    export,
 	})
 }
+
+// ImportWokwi godoc
+// @Summary Import Wokwi diagram
+// @Description Create a circuit from a Wokwi diagram.json. Unsupported parts are skipped and reported.
+// @Tags Circuits
+// @Accept json
+// @Produce json
+// @Param body body dto.ImportWokwiRequest true "Circuit name and diagram.json contents"
+// @Security Bearer
+// @Success 201 {object} dto.ImportCircuitResponse "Circuit imported"
+// @Failure 400 {object} map[string]string "Invalid diagram"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /circuits/import/wokwi [post]
+func (h *CircuitHandler) ImportWokwi(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.ImportWokwiRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, xpEarned, err := h.service.ImportWokwi(userID.(string), req)
+	if err != nil {
+		if respondSchemaError(c, err) {
+			return
+		}
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":   true,
+		"data":      result,
+		"message":   "Circuit imported",
+		"xp_earned": xpEarned,
+	})
+}
+
+// ExploreCircuits godoc
+// @Summary Explore public circuits
+// @Description Browse the community gallery of public circuits
+// @Tags Circuits
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param search query string false "Search by name or description"
+// @Param tag query string false "Filter by tag"
+// @Param author_id query string false "Filter by author"
+// @Param sort query string false "Sort order (trending, most_forked, most_starred, newest)" default(trending)
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "List of public circuits"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /circuits/explore [get]
+func (h *CircuitHandler) ExploreCircuits(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.CircuitExploreRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	circuits, pagination, err := h.service.ExploreCircuits(userID.(string), req)
+	if err != nil {
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    circuits,
+		"meta":    pagination,
+	})
+}
+
+// ListGalleryTags godoc
+// @Summary List gallery tags
+// @Description Get the most used tags of public circuits
+// @Tags Circuits
+// @Produce json
+// @Param limit query int false "Number of tags" default(30)
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "List of tags"
+// @Router /circuits/explore/tags [get]
+func (h *CircuitHandler) ListGalleryTags(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if limit < 1 || limit > 100 {
+		limit = 30
+	}
+
+	tags, err := h.service.ListGalleryTags(limit)
+	if err != nil {
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tags,
+	})
+}
+
+// ListForks godoc
+// @Summary List circuit forks
+// @Description Get public forks of a circuit
+// @Tags Circuits
+// @Produce json
+// @Param id path string true "Circuit ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "List of forks"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Circuit not found"
+// @Router /circuits/{id}/forks [get]
+func (h *CircuitHandler) ListForks(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	forks, pagination, err := h.service.ListForks(c.Param("id"), userID.(string), page, limit)
+	if err != nil {
+		respondCircuitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    forks,
+		"meta":    pagination,
+	})
+}
+
+// ToggleStar godoc
+// @Summary Toggle circuit star
+// @Description Star or unstar a circuit
+// @Tags Circuits
+// @Produce json
+// @Param id path string true "Circuit ID"
+// @Security Bearer
+// @Success 200 {object} dto.CircuitStarResponse "Star status"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Circuit not found"
+// @Router /circuits/{id}/star [post]
+func (h *CircuitHandler) ToggleStar(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	result, err := h.service.ToggleStar(c.Param("id"), userID.(string))
+	if err != nil {
+		respondCircuitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ListRevisions godoc
+// @Summary List circuit revisions
+// @Description Get the revision history of a circuit, newest first
+// @Tags Circuits
+// @Produce json
+// @Param id path string true "Circuit ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "List of revisions"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Circuit not found"
+// @Router /circuits/{id}/revisions [get]
+func (h *CircuitHandler) ListRevisions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.CircuitRevisionListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		req = dto.CircuitRevisionListRequest{Page: 1, Limit: 20}
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	revisions, pagination, err := h.service.ListRevisions(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondCircuitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    revisions,
+		"meta":    pagination,
+	})
+}
+
+// GetRevision godoc
+// @Summary Get circuit revision
+// @Description Get a single revision including its schema snapshot
+// @Tags Circuits
+// @Produce json
+// @Param id path string true "Circuit ID"
+// @Param revisionId path string true "Revision ID"
+// @Security Bearer
+// @Success 200 {object} dto.CircuitRevisionDetailResponse "Revision detail"
+// @Failure 404 {object} map[string]string "Revision not found"
+// @Router /circuits/{id}/revisions/{revisionId} [get]
+func (h *CircuitHandler) GetRevision(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	revision, err := h.service.GetRevision(c.Param("id"), c.Param("revisionId"), userID.(string))
+	if err != nil {
+		respondCircuitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    revision,
+	})
+}
+
+// DiffRevisions godoc
+// @Summary Diff circuit revisions
+// @Description Structural diff between two revisions: components added, removed or changed and wires rerouted
+// @Tags Circuits
+// @Produce json
+// @Param id path string true "Circuit ID"
+// @Param from query string true "Base revision ID"
+// @Param to query string false "Target revision ID (defaults to latest)"
+// @Security Bearer
+// @Success 200 {object} dto.CircuitRevisionDiffResponse "Revision diff"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 404 {object} map[string]string "Revision not found"
+// @Router /circuits/{id}/revisions/diff [get]
+func (h *CircuitHandler) DiffRevisions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.CircuitRevisionDiffRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	diff, err := h.service.DiffRevisions(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondCircuitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    diff,
+	})
+}
+
+// RestoreRevision godoc
+// @Summary Restore circuit revision
+// @Description Restore an old revision. The restore is saved as a new revision, so nothing is lost.
+// @Tags Circuits
+// @Accept json
+// @Produce json
+// @Param id path string true "Circuit ID"
+// @Param revisionId path string true "Revision ID to restore"
+// @Param body body dto.RestoreRevisionRequest false "Optional revision message"
+// @Security Bearer
+// @Success 201 {object} dto.CircuitRevisionResponse "New revision"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Revision not found"
+// @Router /circuits/{id}/revisions/{revisionId}/restore [post]
+func (h *CircuitHandler) RestoreRevision(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.RestoreRevisionRequest
+	c.ShouldBindJSON(&req) // Optional fields
+
+	revision, err := h.service.RestoreRevision(c.Param("id"), c.Param("revisionId"), userID.(string), req)
+	if err != nil {
+		respondCircuitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    revision,
+		"message": "Revision restored",
+	})
+}
+
+// respondCircuitError maps circuit service errors to HTTP status codes
+func respondCircuitError(c *gin.Context, err error) {
+	if respondSchemaError(c, err) {
+		return
+	}
+
+	switch err.Error() {
+	case "circuit not found", "revision not found":
+		utils.RespondWithError(c, http.StatusNotFound, err.Error())
+	case "access denied":
+		utils.RespondWithError(c, http.StatusForbidden, err.Error())
+	case "invalid schema data":
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"nexfi-backend/dto"
+	"nexfi-backend/pkg/simulator"
+	"nexfi-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListModels godoc
+// @Summary List simulation models
+// @Description List the component models the simulator runs with: the built-in models and those uploaded by admins
+// @Tags Components
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} dto.ComponentModelResponse "Model library"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /components/models [get]
+func (h *ComponentHandler) ListModels(c *gin.Context) {
+	models, err := h.service.ListModels()
+	if err != nil {
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    models,
+	})
+}
+
+// GetModel godoc
+// @Summary Get simulation model
+// @Description Get a component model of the model library by name
+// @Tags Components
+// @Produce json
+// @Param name path string true "Model name"
+// @Security Bearer
+// @Success 200 {object} dto.ComponentModelResponse "Model"
+// @Failure 404 {object} map[string]string "Model not found"
+// @Router /components/models/{name} [get]
+func (h *ComponentHandler) GetModel(c *gin.Context) {
+	model, err := h.service.GetModel(c.Param("name"))
+	if err != nil {
+		utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    model,
+	})
+}
+
+// UploadModel godoc
+// @Summary Upload simulation model
+// @Description Add a component model to the model library, or upload a new version of an uploaded model (admin only)
+// @Tags Components
+// @Accept json
+// @Produce json
+// @Param request body dto.ComponentModelRequest true "Model definition"
+// @Security Bearer
+// @Success 201 {object} dto.ComponentModelResponse "Uploaded model"
+// @Failure 400 {object} map[string]interface{} "Invalid model"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 409 {object} map[string]string "Name taken by a built-in model"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /components/models [post]
+func (h *ComponentHandler) UploadModel(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.ComponentModelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	model, err := h.service.UploadModel(userID.(string), req)
+	if err != nil {
+		var modelErr *simulator.ModelError
+		if errors.As(err, &modelErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   modelErr.Error(),
+				"details": modelErr.Errors,
+			})
+			return
+		}
+		switch err.Error() {
+		case "admin access required":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "model name is taken by a built-in model":
+			utils.RespondWithError(c, http.StatusConflict, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Model uploaded successfully",
+		"data":    model,
+	})
+}
+
+// DeleteModel godoc
+// @Summary Delete simulation model
+// @Description Remove an uploaded model from the model library; parts using it fall back to their type (admin only)
+// @Tags Components
+// @Param name path string true "Model name"
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Model deleted"
+// @Failure 400 {object} map[string]string "Built-in model"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 404 {object} map[string]string "Model not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /components/models/{name} [delete]
+func (h *ComponentHandler) DeleteModel(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.service.DeleteModel(userID.(string), c.Param("name")); err != nil {
+		switch err.Error() {
+		case "admin access required":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "model not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "built-in models cannot be deleted":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Model deleted successfully",
+	})
+}
+
+// AssignModel godoc
+// @Summary Assign simulation model
+// @Description Set the model the parts linked to a catalog component are simulated with; an empty model clears it (admin only)
+// @Tags Components
+// @Accept json
+// @Produce json
+// @Param id path string true "Component ID (UUID)"
+// @Param request body dto.AssignComponentModelRequest true "Model name"
+// @Security Bearer
+// @Success 200 {object} dto.ComponentResponse "Updated component"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 404 {object} map[string]string "Component or model not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /components/{id}/model [put]
+func (h *ComponentHandler) AssignModel(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.AssignComponentModelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	component, err := h.service.AssignModel(c.Param("id"), userID.(string), req)
+	if err != nil {
+		switch err.Error() {
+		case "admin access required":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "component not found", "model not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    component,
+	})
+}
@@ -520,6 +520,117 @@ func (h *LabHandler) GetCompilationStatus(c *gin.Context) {
 	})
 }
 
+// ============================================
+// Deployment to Hardware
+// ============================================
+
+// DeployToLab godoc
+// @Summary Deploy a simulation to a lab
+// @Description Promote a passing simulation run to real hardware. The circuit's boards and the code must target the lab's platform; the user joins the queue and the code is staged as the first compilation of their next session on the lab
+// @Tags Labs
+// @Accept json
+// @Produce json
+// @Param id path string true "Lab ID (UUID)"
+// @Param body body dto.DeployToLabRequest true "Deployment request"
+// @Security Bearer
+// @Success 201 {object} dto.DeploymentResponse "Deployment queued"
+// @Failure 400 {object} map[string]string "Invalid input, platform mismatch or run has not passed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Lab, simulation or run not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /labs/{id}/deploy [post]
+func (h *LabHandler) DeployToLab(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	labID := c.Param("id")
+
+	var req dto.DeployToLabRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, err := h.service.DeployToLab(labID, userID.(string), req)
+	if err != nil {
+		switch err.Error() {
+		case "lab not found", "simulation not found", "run not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "run has not passed", "run has no results", "run has no predictions", "invalid schema data",
+			"circuit has no microcontroller board", "circuit does not target the lab platform",
+			"no code to deploy", "code changed since the run", "code language is not supported by the lab platform",
+			"probe is not predicted by the run", "you already have an active lab session",
+			"lab is not accepting queue entries", "insufficient XP for bid amount":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// GetDeploymentComparison godoc
+// @Summary Compare a deployment with its simulation
+// @Description Compare the sensor readings recorded during a deployment's session with the predictions of the simulation run. A reading diverges when its mean falls outside the predicted range by more than the tolerance
+// @Tags Labs
+// @Produce json
+// @Param deploymentId path string true "Deployment ID (UUID)"
+// @Param abs_tol query number false "Absolute tolerance in volts (default 0.001)"
+// @Param current_tol query number false "Absolute tolerance in amperes (default 0.000001)"
+// @Param rel_tol query number false "Relative tolerance (default 0.05)"
+// @Security Bearer
+// @Success 200 {object} dto.DeploymentComparisonResponse "Deployment and comparison"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Deployment not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /labs/deployments/{deploymentId} [get]
+func (h *LabHandler) GetDeploymentComparison(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	deploymentID := c.Param("deploymentId")
+
+	var req dto.DeploymentComparisonRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, err := h.service.GetDeploymentComparison(deploymentID, userID.(string), req)
+	if err != nil {
+		switch err.Error() {
+		case "deployment not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
 // ============================================
 // Sensor/Actuator Control
 // ============================================
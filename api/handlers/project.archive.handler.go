@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"nexfi-backend/api/services"
+	"nexfi-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportProject godoc
+// @Summary Export project archive
+// @Description Download a project as a versioned .nexflux zip: a manifest with the project details, declared components and milestones, plus the schema, code, circuits and thumbnail
+// @Tags Projects
+// @Produce application/zip
+// @Param id path string true "Project ID (UUID)"
+// @Security Bearer
+// @Success 200 {file} file "Project archive"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects/{id}/export [get]
+func (h *ProjectHandler) ExportProject(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	archive, err := h.service.ExportProject(c.Param("id"), userID.(string))
+	if err != nil {
+		switch err.Error() {
+		case "project not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, safeFilename(archive.Name), services.ProjectArchiveExtension))
+	c.Data(http.StatusOK, "application/zip", archive.Data)
+}
+
+// ImportProject godoc
+// @Summary Import project archive
+// @Description Recreate the project of a .nexflux archive under the current user's account. The project starts private with no progress; components missing from the catalog and circuits that do not load are left out and listed in warnings.
+// @Tags Projects
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Project archive (.nexflux, max 20MB)"
+// @Security Bearer
+// @Success 201 {object} dto.ProjectImportResponse "Imported project"
+// @Failure 400 {object} map[string]interface{} "Invalid archive or schema"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 413 {object} map[string]string "Archive too large"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects/import [post]
+func (h *ProjectHandler) ImportProject(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "No file provided")
+		return
+	}
+	if file.Size > services.MaxProjectArchiveSize {
+		utils.RespondWithError(c, http.StatusRequestEntityTooLarge, "archive is too large")
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "invalid archive")
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, services.MaxProjectArchiveSize+1))
+	if err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "invalid archive")
+		return
+	}
+
+	imported, err := h.service.ImportProject(userID.(string), data)
+	if err != nil {
+		if respondSchemaError(c, err) {
+			return
+		}
+		switch err.Error() {
+		case "invalid archive", "unsupported archive version":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		case "archive is too large":
+			utils.RespondWithError(c, http.StatusRequestEntityTooLarge, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Project imported successfully",
+		"data":    imported,
+	})
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"net/http"
+	"nexfi-backend/api/services"
+	"nexfi-backend/dto"
+	"nexfi-backend/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ProjectCodeHandler handles the files and folders of a project's code
+type ProjectCodeHandler struct {
+	service *services.ProjectCodeService
+}
+
+// NewProjectCodeHandler creates a new ProjectCodeHandler
+func NewProjectCodeHandler(db *gorm.DB) *ProjectCodeHandler {
+	return &ProjectCodeHandler{
+		service: services.NewProjectCodeService(db),
+	}
+}
+
+// GetFile godoc
+// @Summary Get project code file
+// @Description Get a file of the project's code with the functions it defines
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param path path string true "File path, e.g. src/motor.cpp"
+// @Security Bearer
+// @Success 200 {object} dto.CodeFileResponse "File"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "File not found"
+// @Router /projects/{id}/code/files/{path} [get]
+func (h *ProjectCodeHandler) GetFile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	file, err := h.service.GetFile(c.Param("id"), userID.(string), codePathParam(c))
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    file,
+	})
+}
+
+// SaveFile godoc
+// @Summary Save project code file
+// @Description Create a file of the project's code, or replace its content. Folders in the path are created. The language defaults to the one of the file's extension.
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param path path string true "File path, e.g. src/motor.cpp"
+// @Param body body dto.SaveCodeFileRequest true "File content"
+// @Security Bearer
+// @Success 200 {object} dto.SaveCodeResponse "Code saved"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Failure 409 {object} map[string]string "A folder exists at the path, or the project is being edited in a live session"
+// @Router /projects/{id}/code/files/{path} [put]
+func (h *ProjectCodeHandler) SaveFile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.SaveCodeFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, err := h.service.SaveFile(c.Param("id"), userID.(string), codePathParam(c), req)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// UpdateFile godoc
+// @Summary Move or rename project code file
+// @Description Move or rename a file of the project's code, or change its language. A language that came from the old extension follows the new one.
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param path path string true "File path"
+// @Param body body dto.UpdateCodeFileRequest true "New path and/or language"
+// @Security Bearer
+// @Success 200 {object} dto.SaveCodeResponse "Code saved"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 404 {object} map[string]string "File not found"
+// @Failure 409 {object} map[string]string "Path already exists, or the project is being edited in a live session"
+// @Router /projects/{id}/code/files/{path} [patch]
+func (h *ProjectCodeHandler) UpdateFile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.UpdateCodeFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, err := h.service.UpdateFile(c.Param("id"), userID.(string), codePathParam(c), req)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// DeleteFile godoc
+// @Summary Delete project code file
+// @Description Delete a file of the project's code. The main file cannot be deleted; choose another main file first.
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param path path string true "File path"
+// @Security Bearer
+// @Success 200 {object} dto.SaveCodeResponse "Code saved"
+// @Failure 404 {object} map[string]string "File not found"
+// @Failure 409 {object} map[string]string "The main file cannot be removed, or the project is being edited in a live session"
+// @Router /projects/{id}/code/files/{path} [delete]
+func (h *ProjectCodeHandler) DeleteFile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	result, err := h.service.DeleteFile(c.Param("id"), userID.(string), codePathParam(c))
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+		"message": "File deleted",
+	})
+}
+
+// CreateFolder godoc
+// @Summary Create project code folder
+// @Description Create a folder, with its parents, in the project's code
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body dto.CodeFolderRequest true "Folder path"
+// @Security Bearer
+// @Success 201 {object} dto.SaveCodeResponse "Code saved"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 409 {object} map[string]string "A file exists at the path, or the project is being edited in a live session"
+// @Router /projects/{id}/code/folders [post]
+func (h *ProjectCodeHandler) CreateFolder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.CodeFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, err := h.service.CreateFolder(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    result,
+		"message": "Folder created",
+	})
+}
+
+// DeleteFolder godoc
+// @Summary Delete project code folder
+// @Description Delete a folder of the project's code with everything in it. A folder holding the main file cannot be deleted.
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param path path string true "Folder path"
+// @Security Bearer
+// @Success 200 {object} dto.SaveCodeResponse "Code saved"
+// @Failure 404 {object} map[string]string "Folder not found"
+// @Failure 409 {object} map[string]string "The main file cannot be removed, or the project is being edited in a live session"
+// @Router /projects/{id}/code/folders/{path} [delete]
+func (h *ProjectCodeHandler) DeleteFolder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	result, err := h.service.DeleteFolder(c.Param("id"), userID.(string), codePathParam(c))
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+		"message": "Folder deleted",
+	})
+}
+
+// SetMainFile godoc
+// @Summary Set project main file
+// @Description Choose the entry file of the project's code: the file simulations run and deployments build from
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body dto.SetMainFileRequest true "Main file path"
+// @Security Bearer
+// @Success 200 {object} dto.SaveCodeResponse "Code saved"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 404 {object} map[string]string "File not found"
+// @Failure 409 {object} map[string]string "Project is being edited in a live session"
+// @Router /projects/{id}/code/main [put]
+func (h *ProjectCodeHandler) SetMainFile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.SetMainFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, err := h.service.SetMainFile(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// AnalyzeCode godoc
+// @Summary Analyze project code
+// @Description Check the project's code before it is submitted to a lab: syntax errors, missing setup() or loop(), pins the target board does not have or that are never configured, blocking delays in interrupt handlers and MicroPython syntax errors. Files in the body are checked in place of the saved ones, so unsaved editor content can be checked. Diagnostics have 1-based lines and UTF-16 columns for the editor to underline.
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body dto.AnalyzeCodeRequest false "Unsaved files and target platform"
+// @Security Bearer
+// @Success 200 {object} dto.CodeAnalysisResponse "Diagnostics"
+// @Failure 400 {object} map[string]string "Invalid path or language"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Router /projects/{id}/code/analyze [post]
+func (h *ProjectCodeHandler) AnalyzeCode(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.AnalyzeCodeRequest
+	c.ShouldBindJSON(&req) // Optional: without files the saved code is checked
+
+	result, err := h.service.AnalyzeCode(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondCodeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// codePathParam returns the file or folder path of a wildcard route
+func codePathParam(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("path"), "/")
+}
+
+// respondCodeError maps project code errors to HTTP status codes
+func respondCodeError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "project not found", "file not found", "folder not found":
+		utils.RespondWithError(c, http.StatusNotFound, err.Error())
+	case "access denied":
+		utils.RespondWithError(c, http.StatusForbidden, err.Error())
+	case "path already exists", "the main file cannot be removed", "project is being edited in a live session":
+		utils.RespondWithError(c, http.StatusConflict, err.Error())
+	case "invalid path", "invalid language", "too many files", "file is too large",
+		"invalid code data", "files or content is required", "path or language is required":
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+	}
+}
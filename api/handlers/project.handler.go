@@ -159,7 +159,7 @@ func (h *ProjectHandler) CreateProject(c *gin.Context) {
 
 // UpdateProject godoc
 // @Summary Update project
-// @Description Update an existing project (owner only)
+// @Description Update an existing project. Editors may save schema_data and code_data; other fields are owner only.
 // @Tags Projects
 // @Accept json
 // @Produce json
@@ -170,6 +170,7 @@ func (h *ProjectHandler) CreateProject(c *gin.Context) {
 // @Failure 400 {object} map[string]string "Invalid input"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Access denied"
+// @Failure 409 {object} map[string]string "Schema or code is being edited in a live session"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /projects/{id} [put]
 func (h *ProjectHandler) UpdateProject(c *gin.Context) {
@@ -189,11 +190,21 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 
 	project, err := h.service.UpdateProject(projectID, userID.(string), req)
 	if err != nil {
-		if err.Error() == "access denied" {
-			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		if respondSchemaError(c, err) {
 			return
 		}
-		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		switch err.Error() {
+		case "project not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "invalid code data":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		case "project is being edited in a live session":
+			utils.RespondWithError(c, http.StatusConflict, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
@@ -247,6 +258,7 @@ func (h *ProjectHandler) DeleteProject(c *gin.Context) {
 // @Security Bearer
 // @Success 201 {object} dto.ProjectResponse "Duplicated project"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
 // @Failure 404 {object} map[string]string "Project not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /projects/{id}/duplicate [post]
@@ -261,7 +273,14 @@ func (h *ProjectHandler) DuplicateProject(c *gin.Context) {
 
 	project, err := h.service.DuplicateProject(projectID, userID.(string))
 	if err != nil {
-		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		switch err.Error() {
+		case "project not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
@@ -376,19 +395,19 @@ func (h *ProjectHandler) GetCollaborators(c *gin.Context) {
 
 // AddCollaborator godoc
 // @Summary Add collaborator to project
-// @Description Invite a user to collaborate on a project by email
+// @Description Invite a user to collaborate on a project by email (owner only). The invitation grants nothing until the user accepts it.
 // @Tags Projects
 // @Accept json
 // @Produce json
 // @Param id path string true "Project ID (UUID)"
 // @Param collaborator body dto.AddCollaboratorRequest true "Collaborator data"
 // @Security Bearer
-// @Success 201 {object} dto.CollaboratorResponse "Added collaborator"
+// @Success 201 {object} dto.CollaboratorResponse "Pending invitation"
 // @Failure 400 {object} map[string]string "Invalid input"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Access denied (owner only)"
 // @Failure 404 {object} map[string]string "Project or user not found"
-// @Failure 409 {object} map[string]string "User already a collaborator"
+// @Failure 409 {object} map[string]string "User already a collaborator or invited"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /projects/{id}/collaborators [post]
 func (h *ProjectHandler) AddCollaborator(c *gin.Context) {
@@ -417,6 +436,8 @@ func (h *ProjectHandler) AddCollaborator(c *gin.Context) {
 			utils.RespondWithError(c, http.StatusForbidden, "Only project owner can add collaborators")
 		case "already a collaborator":
 			utils.RespondWithError(c, http.StatusConflict, "User is already a collaborator")
+		case "already invited":
+			utils.RespondWithError(c, http.StatusConflict, "User is already invited")
 		case "cannot add yourself":
 			utils.RespondWithError(c, http.StatusBadRequest, "Cannot add yourself as a collaborator")
 		default:
@@ -427,14 +448,14 @@ func (h *ProjectHandler) AddCollaborator(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
-		"message": "Collaborator added successfully",
+		"message": "Invitation sent",
 		"data":    collaborator,
 	})
 }
 
 // RemoveCollaborator godoc
 // @Summary Remove collaborator from project
-// @Description Remove a collaborator from a project
+// @Description Remove a collaborator or cancel an invitation (owner only). Collaborators can remove themselves to leave the project.
 // @Tags Projects
 // @Param id path string true "Project ID (UUID)"
 // @Param userId path string true "User ID to remove (UUID)"
@@ -475,3 +496,157 @@ func (h *ProjectHandler) RemoveCollaborator(c *gin.Context) {
 		"message": "Collaborator removed successfully",
 	})
 }
+
+// UpdateCollaborator godoc
+// @Summary Change collaborator role
+// @Description Change the role of a collaborator or invitee (owner only). Editors can save the schema and code; viewers can only read.
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID (UUID)"
+// @Param userId path string true "Collaborator user ID (UUID)"
+// @Param body body dto.UpdateCollaboratorRequest true "New role"
+// @Security Bearer
+// @Success 200 {object} dto.CollaboratorResponse "Updated collaborator"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied (owner only)"
+// @Failure 404 {object} map[string]string "Project or collaborator not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects/{id}/collaborators/{userId} [put]
+func (h *ProjectHandler) UpdateCollaborator(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.UpdateCollaboratorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	collaborator, err := h.service.UpdateCollaboratorRole(c.Param("id"), userID.(string), c.Param("userId"), req)
+	if err != nil {
+		switch err.Error() {
+		case "project not found", "collaborator not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, "Only project owner can change roles")
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    collaborator,
+	})
+}
+
+// ListInvitations godoc
+// @Summary List project invitations
+// @Description Get the project invitations the current user has not accepted or declined yet
+// @Tags Projects
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} dto.ProjectInvitationResponse "Pending invitations"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects/invitations [get]
+func (h *ProjectHandler) ListInvitations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	invitations, err := h.service.ListInvitations(userID.(string))
+	if err != nil {
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    invitations,
+	})
+}
+
+// AcceptInvitation godoc
+// @Summary Accept project invitation
+// @Description Accept the current user's invitation to a project, granting the invited role. The owner is notified.
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID (UUID)"
+// @Security Bearer
+// @Success 200 {object} dto.CollaboratorResponse "Collaborator"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Project or invitation not found"
+// @Failure 409 {object} map[string]string "Invitation already accepted"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects/{id}/invitation/accept [post]
+func (h *ProjectHandler) AcceptInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	collaborator, err := h.service.AcceptInvitation(c.Param("id"), userID.(string))
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitation accepted",
+		"data":    collaborator,
+	})
+}
+
+// DeclineInvitation godoc
+// @Summary Decline project invitation
+// @Description Decline the current user's invitation to a project. The owner is notified and can invite the user again.
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID (UUID)"
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Project or invitation not found"
+// @Failure 409 {object} map[string]string "Invitation already accepted"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects/{id}/invitation/decline [post]
+func (h *ProjectHandler) DeclineInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.service.DeclineInvitation(c.Param("id"), userID.(string)); err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitation declined",
+	})
+}
+
+// respondInvitationError maps invitation answer errors to HTTP status codes
+func respondInvitationError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "project not found", "invitation not found":
+		utils.RespondWithError(c, http.StatusNotFound, err.Error())
+	case "invitation already accepted":
+		utils.RespondWithError(c, http.StatusConflict, err.Error())
+	default:
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+	}
+}
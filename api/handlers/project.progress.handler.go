@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"nexfi-backend/api/services"
 	"nexfi-backend/dto"
+	"nexfi-backend/models"
 	"nexfi-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -78,6 +79,7 @@ func (h *ProjectProgressHandler) GetProgress(c *gin.Context) {
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Access denied"
 // @Failure 404 {object} map[string]string "Project not found"
+// @Failure 409 {object} map[string]string "Project is being edited in a live session"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /projects/{id}/progress [put]
 func (h *ProjectProgressHandler) UpdateProgress(c *gin.Context) {
@@ -97,11 +99,18 @@ func (h *ProjectProgressHandler) UpdateProgress(c *gin.Context) {
 
 	result, err := h.service.UpdateProgress(projectID, userID.(string), req)
 	if err != nil {
+		if respondSchemaError(c, err) {
+			return
+		}
 		switch err.Error() {
 		case "project not found":
 			utils.RespondWithError(c, http.StatusNotFound, err.Error())
 		case "access denied":
 			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "invalid schema data", "invalid code data", "simulation already running":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		case "project is being edited in a live session":
+			utils.RespondWithError(c, http.StatusConflict, err.Error())
 		default:
 			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
 		}
@@ -128,6 +137,7 @@ func (h *ProjectProgressHandler) UpdateProgress(c *gin.Context) {
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Access denied"
 // @Failure 404 {object} map[string]string "Project not found"
+// @Failure 409 {object} map[string]string "Project is being edited in a live session"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /projects/{id}/schema [put]
 func (h *ProjectProgressHandler) SaveSchema(c *gin.Context) {
@@ -147,11 +157,16 @@ func (h *ProjectProgressHandler) SaveSchema(c *gin.Context) {
 
 	result, err := h.service.SaveSchema(projectID, userID.(string), req)
 	if err != nil {
+		if respondSchemaError(c, err) {
+			return
+		}
 		switch err.Error() {
 		case "project not found":
 			utils.RespondWithError(c, http.StatusNotFound, err.Error())
 		case "access denied":
 			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "project is being edited in a live session":
+			utils.RespondWithError(c, http.StatusConflict, err.Error())
 		default:
 			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
 		}
@@ -166,7 +181,7 @@ func (h *ProjectProgressHandler) SaveSchema(c *gin.Context) {
 
 // SaveCode godoc
 // @Summary Save project code
-// @Description Save code/firmware data for the project
+// @Description Save the project's code workspace: send files (with folders and the main file) to replace the whole workspace. The single-file form {content, language, filename} saves one file and keeps the others. Code progress counts the functions that do something and whether the sketch compiles, not the length of the code.
 // @Tags Projects
 // @Accept json
 // @Produce json
@@ -178,6 +193,7 @@ func (h *ProjectProgressHandler) SaveSchema(c *gin.Context) {
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Access denied"
 // @Failure 404 {object} map[string]string "Project not found"
+// @Failure 409 {object} map[string]string "Project is being edited in a live session"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /projects/{id}/code [put]
 func (h *ProjectProgressHandler) SaveCode(c *gin.Context) {
@@ -197,14 +213,7 @@ func (h *ProjectProgressHandler) SaveCode(c *gin.Context) {
 
 	result, err := h.service.SaveCode(projectID, userID.(string), req)
 	if err != nil {
-		switch err.Error() {
-		case "project not found":
-			utils.RespondWithError(c, http.StatusNotFound, err.Error())
-		case "access denied":
-			utils.RespondWithError(c, http.StatusForbidden, err.Error())
-		default:
-			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
-		}
+		respondCodeError(c, err)
 		return
 	}
 
@@ -216,7 +225,7 @@ func (h *ProjectProgressHandler) SaveCode(c *gin.Context) {
 
 // RunSimulation godoc
 // @Summary Run project simulation
-// @Description Execute simulation for the project circuit and code
+// @Description Run the project circuit as a run of the project's simulation (created on the first run). The DC operating point is solved, or the board runs the code over time when the circuit has one. The run only completes (and earns the success milestone) when the circuit converges, nothing is shorted or overloaded, and current flows. The run is queued for the simulation workers (202) and followed on the simulation's WebSocket; without a job queue it runs within the request (200).
 // @Tags Projects
 // @Accept json
 // @Produce json
@@ -224,6 +233,7 @@ func (h *ProjectProgressHandler) SaveCode(c *gin.Context) {
 // @Param body body dto.RunSimulationRequest true "Simulation parameters"
 // @Security Bearer
 // @Success 200 {object} dto.RunSimulationResponse "Simulation results"
+// @Success 202 {object} dto.RunSimulationResponse "Simulation queued"
 // @Failure 400 {object} map[string]string "Invalid input or missing schema/code"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Access denied"
@@ -255,7 +265,7 @@ func (h *ProjectProgressHandler) RunSimulation(c *gin.Context) {
 			utils.RespondWithError(c, http.StatusNotFound, err.Error())
 		case "access denied":
 			utils.RespondWithError(c, http.StatusForbidden, err.Error())
-		case "schema data required", "code data required":
+		case "schema data required", "code data required", "invalid schema data", "simulation already running":
 			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
 		default:
 			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
@@ -263,7 +273,11 @@ func (h *ProjectProgressHandler) RunSimulation(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	status := http.StatusOK
+	if result.Status == models.RunStatusQueued {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, gin.H{
 		"success": true,
 		"data":    result,
 	})
@@ -362,7 +376,7 @@ func (h *ProjectProgressHandler) GetSchemaData(c *gin.Context) {
 
 // GetCodeData godoc
 // @Summary Get project code data
-// @Description Get the code/firmware data for a project
+// @Description Get the project's code workspace: its files with their languages, its folders and the main file. Code saved in the old single-file format is returned as a workspace.
 // @Tags Projects
 // @Produce json
 // @Param id path string true "Project ID (UUID)"
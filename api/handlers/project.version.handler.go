@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"net/http"
+	"nexfi-backend/api/services"
+	"nexfi-backend/dto"
+	"nexfi-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ProjectVersionHandler handles project version history HTTP requests
+type ProjectVersionHandler struct {
+	service *services.ProjectVersionService
+}
+
+// NewProjectVersionHandler creates a new ProjectVersionHandler
+func NewProjectVersionHandler(db *gorm.DB) *ProjectVersionHandler {
+	return &ProjectVersionHandler{
+		service: services.NewProjectVersionService(db),
+	}
+}
+
+// ListVersions godoc
+// @Summary List project versions
+// @Description Get the version history of a project's schema and code, newest first. Saves within 10 minutes share a version; named checkpoints are kept forever.
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param checkpoints query bool false "Named checkpoints only"
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "List of versions"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Router /projects/{id}/versions [get]
+func (h *ProjectVersionHandler) ListVersions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.ProjectVersionListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		req = dto.ProjectVersionListRequest{Page: 1, Limit: 20}
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	versions, pagination, err := h.service.ListVersions(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    versions,
+		"meta":    pagination,
+	})
+}
+
+// GetVersion godoc
+// @Summary Get project version
+// @Description Get a single version including its schema and code
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param versionId path string true "Version ID"
+// @Security Bearer
+// @Success 200 {object} dto.ProjectVersionDetailResponse "Version detail"
+// @Failure 404 {object} map[string]string "Version not found"
+// @Router /projects/{id}/versions/{versionId} [get]
+func (h *ProjectVersionHandler) GetVersion(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	version, err := h.service.GetVersion(c.Param("id"), c.Param("versionId"), userID.(string))
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    version,
+	})
+}
+
+// CreateCheckpoint godoc
+// @Summary Create project checkpoint
+// @Description Name the project's current state, e.g. "working blink", so it can be found and restored later
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body dto.CreateCheckpointRequest true "Checkpoint name"
+// @Security Bearer
+// @Success 201 {object} dto.ProjectVersionResponse "Checkpoint"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Router /projects/{id}/versions [post]
+func (h *ProjectVersionHandler) CreateCheckpoint(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.CreateCheckpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	version, err := h.service.CreateCheckpoint(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    version,
+		"message": "Checkpoint created",
+	})
+}
+
+// UpdateVersion godoc
+// @Summary Name project version
+// @Description Name or rename a version, making it a checkpoint; an empty name makes it an automatic version again
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param versionId path string true "Version ID"
+// @Param body body dto.UpdateVersionRequest true "Version name"
+// @Security Bearer
+// @Success 200 {object} dto.ProjectVersionResponse "Updated version"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Version not found"
+// @Router /projects/{id}/versions/{versionId} [put]
+func (h *ProjectVersionHandler) UpdateVersion(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.UpdateVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	version, err := h.service.UpdateVersion(c.Param("id"), c.Param("versionId"), userID.(string), req)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    version,
+	})
+}
+
+// DiffVersions godoc
+// @Summary Diff project versions
+// @Description Compare two versions: a structural diff of the schema and a line diff of each changed code file
+// @Tags Projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param from query string true "Base version ID"
+// @Param to query string false "Target version ID (defaults to the current project)"
+// @Security Bearer
+// @Success 200 {object} dto.ProjectVersionDiffResponse "Version diff"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 404 {object} map[string]string "Version not found"
+// @Router /projects/{id}/versions/diff [get]
+func (h *ProjectVersionHandler) DiffVersions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.ProjectVersionDiffRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	diff, err := h.service.DiffVersions(c.Param("id"), userID.(string), req)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    diff,
+	})
+}
+
+// RestoreVersion godoc
+// @Summary Restore project version
+// @Description Restore the schema and code of an old version. The restore is saved as a new version, so nothing is lost.
+// @Tags Projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param versionId path string true "Version ID to restore"
+// @Param body body dto.RestoreVersionRequest false "Optional version message"
+// @Security Bearer
+// @Success 201 {object} dto.ProjectVersionResponse "New version"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Version not found"
+// @Failure 409 {object} map[string]string "Project is being edited in a live session"
+// @Router /projects/{id}/versions/{versionId}/restore [post]
+func (h *ProjectVersionHandler) RestoreVersion(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.RestoreVersionRequest
+	c.ShouldBindJSON(&req) // Optional fields
+
+	version, err := h.service.RestoreVersion(c.Param("id"), c.Param("versionId"), userID.(string), req)
+	if err != nil {
+		respondVersionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    version,
+		"message": "Version restored",
+	})
+}
+
+// respondVersionError maps project version service errors to HTTP status codes
+func respondVersionError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "project not found", "version not found":
+		utils.RespondWithError(c, http.StatusNotFound, err.Error())
+	case "access denied":
+		utils.RespondWithError(c, http.StatusForbidden, err.Error())
+	case "invalid schema data":
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+	case "project is being edited in a live session":
+		utils.RespondWithError(c, http.StatusConflict, err.Error())
+	default:
+		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+	}
+}
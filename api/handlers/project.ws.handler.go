@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"nexfi-backend/api/services"
+	"nexfi-backend/dto"
+	"nexfi-backend/pkg/schematic"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// projectWSReadLimit bounds a single message, e.g. a large paste
+const projectWSReadLimit = 1 << 20
+
+// ProjectWSHandler handles live collaborative editing of projects over WebSocket
+type ProjectWSHandler struct {
+	service *services.ProjectCollabService
+}
+
+// projectClient serializes writes to a connection; session events and
+// replies to the client's own messages come from different goroutines
+type projectClient struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// NewProjectWSHandler creates a new ProjectWSHandler
+func NewProjectWSHandler(db *gorm.DB) *ProjectWSHandler {
+	return &ProjectWSHandler{
+		service: services.NewProjectCollabService(db),
+	}
+}
+
+// HandleProjectWebSocket handles WebSocket connections for co-editing a project
+// @Summary WebSocket connection for collaborative project editing
+// @Description Join the live editing session of a project as its owner or an accepted collaborator. Code edits are ot.js text operations sent with the revision they were made at; schema edits are component-level patches. The session shares presence (cursor, selection, selected components) and saves to the project every 15 seconds and when the last participant leaves. Viewers receive everything but cannot edit. Pass the access token as `token`.
+// @Tags Projects WebSocket
+// @Param id path string true "Project ID (UUID)"
+// @Param token query string false "Access token"
+// @Router /ws/projects/{id} [get]
+func (h *ProjectWSHandler) HandleProjectWebSocket(c *gin.Context) {
+	projectID := c.Param("id")
+	userID := wsUserID(c)
+
+	// Upgrade HTTP connection to WebSocket
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(projectWSReadLimit)
+
+	client := &projectClient{conn: conn}
+	if userID == "" {
+		client.sendError("", "Authentication required", nil)
+		return
+	}
+
+	participant, err := h.service.Join(projectID, userID)
+	if err != nil {
+		client.sendError("", err.Error(), nil)
+		return
+	}
+	defer h.service.Leave(participant)
+
+	// Forward session events in the order the session applied them. The
+	// channel closes when the participant leaves or falls behind; closing
+	// the connection then ends the read loop below.
+	go func() {
+		for event := range participant.Events {
+			client.send(WSResponse{Event: event.Event, Data: event.Data})
+		}
+		conn.Close()
+	}()
+
+	log.Printf("📱 WebSocket client connected to project %s (user: %s)", projectID, userID)
+
+	// Handle incoming messages
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+
+		var msg WSMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Failed to parse WebSocket message: %v", err)
+			continue
+		}
+
+		switch msg.Event {
+		case "code":
+			var req dto.CollabCodeRequest
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				client.sendError(msg.Event, "Invalid code edit: "+err.Error(), nil)
+				continue
+			}
+			if err := h.service.ApplyCode(participant, req); err != nil {
+				client.sendError(msg.Event, err.Error(), err)
+			}
+		case "schema":
+			var req dto.CollabSchemaRequest
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				client.sendError(msg.Event, "Invalid schema patch: "+err.Error(), nil)
+				continue
+			}
+			if err := h.service.ApplySchema(participant, req); err != nil {
+				client.sendError(msg.Event, err.Error(), err)
+			}
+		case "presence":
+			var req dto.CollabPresence
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				client.sendError(msg.Event, "Invalid presence: "+err.Error(), nil)
+				continue
+			}
+			if err := h.service.UpdatePresence(participant, req); err != nil {
+				client.sendError(msg.Event, err.Error(), err)
+			}
+		case "resync":
+			if err := h.service.Resync(participant); err != nil {
+				client.sendError(msg.Event, err.Error(), err)
+			}
+		case "ping":
+			client.send(WSResponse{Event: "pong", Data: map[string]interface{}{"timestamp": time.Now()}})
+		default:
+			log.Printf("Unknown WebSocket event: %s", msg.Event)
+		}
+	}
+}
+
+// send sends a message to the client
+func (c *projectClient) send(msg WSResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal WebSocket message: %v", err)
+		return
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		log.Printf("Failed to send WebSocket message: %v", err)
+	}
+}
+
+// sendError tells the client a message failed. Edits that no longer match
+// the session are flagged resync: the client should discard its pending
+// edits and send "resync" to start over from the current state.
+func (c *projectClient) sendError(event, message string, err error) {
+	data := map[string]interface{}{
+		"message": message,
+	}
+	if event != "" {
+		data["event"] = event
+	}
+	if err != nil {
+		switch err.Error() {
+		case "edit does not match the document", "revision is out of range":
+			data["resync"] = true
+		}
+		if validationErr, ok := err.(*schematic.ValidationError); ok {
+			data["details"] = validationErr.Errors
+		}
+	}
+	c.send(WSResponse{Event: "error", Data: data})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"nexfi-backend/pkg/schematic"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SchemaHandler publishes the JSON Schemas of stored documents
+type SchemaHandler struct{}
+
+// NewSchemaHandler creates a new SchemaHandler
+func NewSchemaHandler() *SchemaHandler {
+	return &SchemaHandler{}
+}
+
+// GetCircuitSchema godoc
+// @Summary Get circuit JSON Schema
+// @Description JSON Schema of schema_data for circuits, simulations and projects. Writes are validated against it.
+// @Tags Schemas
+// @Produce json
+// @Param version path string false "Format version, e.g. v2 (defaults to the current version)"
+// @Success 200 {object} map[string]interface{} "JSON Schema document"
+// @Failure 404 {object} map[string]string "Unknown version"
+// @Router /schemas/circuit [get]
+// @Router /schemas/circuit/{version} [get]
+func (h *SchemaHandler) GetCircuitSchema(c *gin.Context) {
+	if version := c.Param("version"); version != "" && version != "v"+strconv.Itoa(schematic.CurrentVersion) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "only the current schema version is published", "current_version": schematic.CurrentVersion})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/schema+json", schematic.JSONSchema())
+}
+
+// respondSchemaError writes a 400 with the failing paths when err is a schema validation error
+func respondSchemaError(c *gin.Context, err error) bool {
+	var validationErr *schematic.ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":          validationErr.Error(),
+		"details":        validationErr.Errors,
+		"schema_version": schematic.CurrentVersion,
+	})
+	c.Abort()
+	return true
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"nexfi-backend/api/services"
 	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/simulator"
 	"nexfi-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -139,6 +144,8 @@ func (h *SimulationHandler) GetSimulation(c *gin.Context) {
 // @Success 201 {object} map[string]interface{} "Simulation created"
 // @Failure 400 {object} map[string]string "Invalid input"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "No edit access to the project"
+// @Failure 404 {object} map[string]string "Project not found"
 // @Router /simulations [post]
 func (h *SimulationHandler) CreateSimulation(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -155,7 +162,17 @@ func (h *SimulationHandler) CreateSimulation(c *gin.Context) {
 
 	simulation, err := h.service.CreateSimulation(userID.(string), req)
 	if err != nil {
-		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		if respondSchemaError(c, err) {
+			return
+		}
+		switch err.Error() {
+		case "project not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
@@ -196,6 +213,9 @@ func (h *SimulationHandler) UpdateSimulation(c *gin.Context) {
 
 	simulation, err := h.service.UpdateSimulation(simulationID, userID.(string), req)
 	if err != nil {
+		if respondSchemaError(c, err) {
+			return
+		}
 		if err.Error() == "simulation not found" {
 			utils.RespondWithError(c, http.StatusNotFound, err.Error())
 		} else if err.Error() == "access denied" {
@@ -248,15 +268,16 @@ func (h *SimulationHandler) DeleteSimulation(c *gin.Context) {
 
 // RunSimulation godoc
 // @Summary Run simulation
-// @Description Start a new simulation run
+// @Description Queue a new simulation run for the simulation workers (202, status "queued"); follow it in the run history. Without a job queue the run executes within the request and returns its results (200). A run solves the DC operating point; with "analysis": "transient" in the settings (the default for Power Electronics and Audio) the circuit is also simulated over time and the run completes with a downsampled waveform; with "analysis": "ac" it completes with a frequency sweep (Bode data) at the probes; with "analysis": "digital" (the default for Digital Logic) the gates are simulated event by event and the run completes with timing diagrams and a truth table. Circuits with errors (short circuits, overloaded parts, no convergence) get an "error" run instead.
 // @Tags Simulations
 // @Accept json
 // @Produce json
 // @Param id path string true "Simulation ID (UUID)"
 // @Param body body dto.RunSimulationRequestDTO false "Run parameters"
 // @Security Bearer
-// @Success 200 {object} dto.RunSimulationResponseDTO "Simulation started"
-// @Failure 400 {object} map[string]string "Already running"
+// @Success 200 {object} dto.RunSimulationResponseDTO "Run executed"
+// @Success 202 {object} dto.RunSimulationResponseDTO "Run queued"
+// @Failure 400 {object} map[string]string "Already running, invalid schema or invalid settings"
 // @Failure 404 {object} map[string]string "Simulation not found"
 // @Router /simulations/{id}/run [post]
 func (h *SimulationHandler) RunSimulation(c *gin.Context) {
@@ -272,9 +293,12 @@ func (h *SimulationHandler) RunSimulation(c *gin.Context) {
 
 	result, err := h.service.RunSimulation(simulationID, userID.(string), req)
 	if err != nil {
-		if err.Error() == "simulation not found" {
+		var settingsErr *simulator.SettingsError
+		if errors.As(err, &settingsErr) {
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		} else if err.Error() == "simulation not found" {
 			utils.RespondWithError(c, http.StatusNotFound, err.Error())
-		} else if err.Error() == "simulation already running" {
+		} else if err.Error() == "simulation already running" || err.Error() == "invalid schema data" {
 			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
 		} else {
 			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
@@ -282,10 +306,20 @@ func (h *SimulationHandler) RunSimulation(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	status, message := http.StatusOK, "Simulation completed"
+	switch result.Status {
+	case models.RunStatusQueued:
+		status, message = http.StatusAccepted, "Simulation queued"
+	case models.RunStatusError:
+		message = "Circuit check failed"
+	case models.RunStatusStopped:
+		message = "Simulation stopped"
+	}
+
+	c.JSON(status, gin.H{
 		"success": true,
 		"data":    result,
-		"message": "Simulation started",
+		"message": message,
 	})
 }
 
@@ -350,42 +384,314 @@ func (h *SimulationHandler) GetRuns(c *gin.Context) {
 	})
 }
 
-// SaveResult godoc
-// @Summary Save simulation result
-// @Description Save simulation result from frontend
+// CompareRuns godoc
+// @Summary Compare runs
+// @Description Align the results of two runs and report the delta of each operating point value, the maximum and RMS error of each waveform, AC trace and timing diagram, and which probes diverged. A probe diverges when its error exceeds abs_tol (current_tol for currents) plus rel_tol times its magnitude. Run A defaults to the golden run and run B to the latest run.
+// @Tags Simulations
+// @Produce json
+// @Param id path string true "Simulation ID (UUID)"
+// @Param a query string false "Run A ID (UUID), default the golden run"
+// @Param b query string false "Run B ID (UUID), default the latest run"
+// @Param abs_tol query number false "Absolute tolerance in volts" default(0.001)
+// @Param current_tol query number false "Absolute tolerance in amperes" default(0.000001)
+// @Param rel_tol query number false "Relative tolerance (0-1)" default(0.01)
+// @Param points query int false "Samples of the delta waveform (10-5000)" default(200)
+// @Security Bearer
+// @Success 200 {object} dto.CompareRunsResponse "Run comparison"
+// @Failure 400 {object} map[string]string "Invalid query, no golden run or run not finished"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Simulation or run not found"
+// @Router /simulations/{id}/runs/compare [get]
+func (h *SimulationHandler) CompareRuns(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.CompareRunsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	comparison, err := h.service.CompareRuns(c.Param("id"), userID.(string), req)
+	if err != nil {
+		switch err.Error() {
+		case "simulation not found", "run not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "no golden run", "run not finished", "run has no results":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    comparison,
+	})
+}
+
+// SetGoldenRun godoc
+// @Summary Pin golden run
+// @Description Pin a completed run as the golden run. Every later run is compared with it and warns with a regression issue when its results diverge.
 // @Tags Simulations
 // @Accept json
 // @Produce json
 // @Param id path string true "Simulation ID (UUID)"
-// @Param body body dto.SaveSimulationResultRequest true "Result data"
+// @Param request body dto.SetGoldenRunRequest true "Run to pin"
 // @Security Bearer
-// @Success 200 {object} dto.SaveSimulationResultResponse "Result saved"
-// @Failure 400 {object} map[string]string "Invalid input"
-// @Failure 404 {object} map[string]string "Simulation not found"
-// @Router /simulations/{id}/result [post]
-func (h *SimulationHandler) SaveResult(c *gin.Context) {
+// @Success 200 {object} map[string]interface{} "Golden run pinned"
+// @Failure 400 {object} map[string]string "Invalid request or run not completed"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Simulation or run not found"
+// @Router /simulations/{id}/golden [put]
+func (h *SimulationHandler) SetGoldenRun(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	simulationID := c.Param("id")
-	var req dto.SaveSimulationResultRequest
+	var req dto.SetGoldenRunRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.RespondWithError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	result, err := h.service.SaveResult(simulationID, userID.(string), req)
+	simulation, err := h.service.SetGoldenRun(c.Param("id"), userID.(string), req)
 	if err != nil {
-		utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		switch err.Error() {
+		case "simulation not found", "run not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		case "run not completed":
+			utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    result,
-		"message": "Simulation result saved",
+		"data":    simulation,
+		"message": "Golden run pinned",
+	})
+}
+
+// ClearGoldenRun godoc
+// @Summary Unpin golden run
+// @Description Unpin the golden run so later runs are no longer checked for regressions
+// @Tags Simulations
+// @Produce json
+// @Param id path string true "Simulation ID (UUID)"
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Golden run unpinned"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Simulation not found"
+// @Router /simulations/{id}/golden [delete]
+func (h *SimulationHandler) ClearGoldenRun(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	simulation, err := h.service.ClearGoldenRun(c.Param("id"), userID.(string))
+	if err != nil {
+		switch err.Error() {
+		case "simulation not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    simulation,
+		"message": "Golden run unpinned",
 	})
 }
+
+// GetRunVariants godoc
+// @Summary Get run variants
+// @Description Get the variants of a sweep or Monte Carlo run, each a child run with its parameters, measurements and full results
+// @Tags Simulations
+// @Produce json
+// @Param id path string true "Simulation ID (UUID)"
+// @Param runId path string true "Run ID (UUID)"
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Run variants"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Simulation or run not found"
+// @Router /simulations/{id}/runs/{runId}/variants [get]
+func (h *SimulationHandler) GetRunVariants(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	variants, err := h.service.GetRunVariants(c.Param("id"), c.Param("runId"), userID.(string))
+	if err != nil {
+		switch err.Error() {
+		case "simulation not found", "run not found":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    variants,
+	})
+}
+
+// GetRunWaveform godoc
+// @Summary Get run waveform
+// @Description Get the waveform of a transient run, optionally limited to some signals and a time window. Each of the requested points pairs the minimum and maximum of a time bucket, so short spikes and PWM edges stay visible.
+// @Tags Simulations
+// @Produce json
+// @Param id path string true "Simulation ID (UUID)"
+// @Param runId path string true "Run ID (UUID)"
+// @Param points query int false "Samples to return (10-5000)" default(500)
+// @Param from query number false "Window start in seconds"
+// @Param to query number false "Window end in seconds"
+// @Param signals query string false "Comma-separated signal names, e.g. V(N1),I(R1)"
+// @Security Bearer
+// @Success 200 {object} dto.RunWaveformResponse "Run waveform"
+// @Failure 400 {object} map[string]string "Invalid query"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Simulation, run or waveform not found"
+// @Router /simulations/{id}/runs/{runId}/waveform [get]
+func (h *SimulationHandler) GetRunWaveform(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req dto.RunWaveformRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	waveform, err := h.service.GetRunWaveform(c.Param("id"), c.Param("runId"), userID.(string), req)
+	if err != nil {
+		switch err.Error() {
+		case "simulation not found", "run not found", "run has no waveform":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    waveform,
+	})
+}
+
+// ExportRun godoc
+// @Summary Export run results
+// @Description Download the results of a run for spreadsheets and lab reports: CSV with an axis column (time, frequency or variant) and a column per probe, a Value Change Dump (.vcd) of a digital run's timing diagrams, or JSON with the same columns and rows. Only the part of the results the file holds is read, and rows are streamed as they are written.
+// @Tags Simulations
+// @Produce text/csv
+// @Produce octet-stream
+// @Produce json
+// @Param id path string true "Simulation ID (UUID)"
+// @Param runId path string true "Run ID (UUID)"
+// @Param format query string false "File format (csv, vcd, json)" default(csv)
+// @Param signals query string false "Comma-separated probe names, e.g. V(N1),I(R1); csv and json only"
+// @Security Bearer
+// @Success 200 {file} file "Exported results"
+// @Failure 400 {object} map[string]string "Invalid query"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Simulation, run or results not found"
+// @Router /simulations/{id}/runs/{runId}/export [get]
+func (h *SimulationHandler) ExportRun(c *gin.Context) {
+	var req dto.ExportRunRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.exportRun(c, req)
+}
+
+// GetRunVCD godoc
+// @Summary Export run timing diagram
+// @Description Download the timing diagrams of a digital run as a Value Change Dump (.vcd) file, viewable in GTKWave. Same as GET /simulations/{id}/runs/{runId}/export?format=vcd.
+// @Tags Simulations
+// @Produce octet-stream
+// @Param id path string true "Simulation ID (UUID)"
+// @Param runId path string true "Run ID (UUID)"
+// @Security Bearer
+// @Success 200 {file} file "VCD file"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Simulation, run or timing diagram not found"
+// @Router /simulations/{id}/runs/{runId}/vcd [get]
+func (h *SimulationHandler) GetRunVCD(c *gin.Context) {
+	h.exportRun(c, dto.ExportRunRequest{Format: "vcd"})
+}
+
+// exportRun streams an export of a run as a download
+func (h *SimulationHandler) exportRun(c *gin.Context, req dto.ExportRunRequest) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.RespondWithError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	export, err := h.service.ExportRun(c.Param("id"), c.Param("runId"), userID.(string), req)
+	if err != nil {
+		switch err.Error() {
+		case "simulation not found", "run not found", "run has no results", "run has no timing diagram":
+			utils.RespondWithError(c, http.StatusNotFound, err.Error())
+		case "access denied":
+			utils.RespondWithError(c, http.StatusForbidden, err.Error())
+		default:
+			utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, safeFilename(export.Name), export.Extension))
+	c.Header("Content-Type", export.ContentType)
+	c.Status(http.StatusOK)
+	if err := export.Write(c.Writer); err != nil {
+		// The headers are sent; the client sees a truncated file
+		log.Printf("Failed to export run %s: %v", c.Param("runId"), err)
+	}
+}
+
+// SaveResult godoc
+// @Summary Save simulation result (removed)
+// @Description Results are no longer accepted from clients; runs are computed by the backend. Start one with POST /simulations/{id}/run and read it from the run history.
+// @Tags Simulations
+// @Produce json
+// @Param id path string true "Simulation ID (UUID)"
+// @Security Bearer
+// @Failure 410 {object} map[string]string "Results are computed by the server"
+// @Deprecated
+// @Router /simulations/{id}/result [post]
+func (h *SimulationHandler) SaveResult(c *gin.Context) {
+	utils.RespondWithError(c, http.StatusGone, "simulation results are computed by the server; use POST /simulations/:id/run")
+}
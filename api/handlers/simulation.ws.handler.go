@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"nexfi-backend/api/services"
+	"nexfi-backend/pkg/redis"
+	"nexfi-backend/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// SimulationWSHandler streams the runs of simulations over WebSocket
+type SimulationWSHandler struct {
+	service   *services.SimulationService
+	clients   map[string]map[*simulationClient]bool // simulationID -> connections
+	clientsMu sync.RWMutex
+}
+
+// simulationClient is a connection with the last event it was sent. Events
+// are written under mu so replayed and live events keep their order.
+type simulationClient struct {
+	conn    *websocket.Conn
+	mu      sync.Mutex
+	lastSeq int64
+}
+
+// NewSimulationWSHandler creates a new SimulationWSHandler
+func NewSimulationWSHandler(db *gorm.DB) *SimulationWSHandler {
+	handler := &SimulationWSHandler{
+		service: services.NewSimulationService(db),
+		clients: make(map[string]map[*simulationClient]bool),
+	}
+
+	// Start background goroutine to listen for run events
+	go handler.startEventListener()
+
+	return handler
+}
+
+// HandleSimulationWebSocket handles WebSocket connections for a simulation
+// @Summary WebSocket connection for simulation runs
+// @Description Connect to WebSocket to follow the runs of a simulation: run state changes, percent complete, waveform chunks and warnings. Pass the access token as `token` since browsers cannot set headers on WebSocket requests, and the `seq` of the last event received as `after` to resume.
+// @Tags Simulations WebSocket
+// @Param id path string true "Simulation ID (UUID)"
+// @Param token query string false "Access token"
+// @Param after query int false "Replay the events after this sequence number"
+// @Router /ws/simulations/{id} [get]
+func (h *SimulationWSHandler) HandleSimulationWebSocket(c *gin.Context) {
+	simulationID := c.Param("id")
+	userID := wsUserID(c)
+
+	// Upgrade HTTP connection to WebSocket
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	client := &simulationClient{conn: conn}
+	if userID == "" {
+		client.sendError("Authentication required")
+		return
+	}
+
+	// Only followers with access are registered for live events
+	if err := h.service.CheckSimulationAccess(simulationID, userID); err != nil {
+		client.sendError(err.Error())
+		return
+	}
+
+	// Register before replaying so no event falls between the two
+	h.registerClient(simulationID, client)
+	defer h.unregisterClient(simulationID, client)
+
+	after, _ := strconv.ParseInt(c.Query("after"), 10, 64)
+	if err := h.replay(client, simulationID, userID, after); err != nil {
+		client.sendError(err.Error())
+		return
+	}
+
+	log.Printf("📱 WebSocket client connected to simulation %s (user: %s)", simulationID, userID)
+
+	// Handle incoming messages
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+
+		var msg WSMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Failed to parse WebSocket message: %v", err)
+			continue
+		}
+
+		switch msg.Event {
+		case "resume":
+			var req struct {
+				After int64 `json:"after"`
+			}
+			json.Unmarshal(msg.Data, &req)
+			if err := h.replay(client, simulationID, userID, req.After); err != nil {
+				client.sendError(err.Error())
+			}
+		case "ping":
+			client.send(WSResponse{Event: "pong", Data: map[string]interface{}{"timestamp": time.Now()}})
+		default:
+			log.Printf("Unknown WebSocket event: %s", msg.Event)
+		}
+	}
+}
+
+// wsUserID authenticates a WebSocket request by the token in the query or
+// the Authorization header; empty when there is no valid token
+func wsUserID(c *gin.Context) string {
+	token := c.Query("token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		return ""
+	}
+
+	claims, err := utils.VerifyJWT(token)
+	if err != nil {
+		return ""
+	}
+	if stored, err := redis.GetToken(claims.Subject); err != nil || stored != token {
+		return ""
+	}
+	return claims.Subject
+}
+
+// registerClient registers a WebSocket client
+func (h *SimulationWSHandler) registerClient(simulationID string, client *simulationClient) {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	if h.clients[simulationID] == nil {
+		h.clients[simulationID] = make(map[*simulationClient]bool)
+	}
+	h.clients[simulationID][client] = true
+}
+
+// unregisterClient unregisters a WebSocket client
+func (h *SimulationWSHandler) unregisterClient(simulationID string, client *simulationClient) {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	if h.clients[simulationID] != nil {
+		delete(h.clients[simulationID], client)
+		if len(h.clients[simulationID]) == 0 {
+			delete(h.clients, simulationID)
+		}
+	}
+}
+
+// replay sends the events of the latest run after a sequence number.
+// Live events wait meanwhile and are skipped if already replayed.
+func (h *SimulationWSHandler) replay(client *simulationClient, simulationID, userID string, after int64) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	events, after, err := h.service.GetSimulationEvents(simulationID, userID, after)
+	if err != nil {
+		return err
+	}
+	// The log may start over below what the client asked for
+	client.lastSeq = after
+	for _, event := range events {
+		client.write(event)
+	}
+	return nil
+}
+
+// BroadcastToSimulation sends an event to all clients following a simulation
+func (h *SimulationWSHandler) BroadcastToSimulation(simulationID string, event services.SimulationEvent) {
+	h.clientsMu.RLock()
+	defer h.clientsMu.RUnlock()
+
+	for client := range h.clients[simulationID] {
+		client.mu.Lock()
+		client.write(event)
+		client.mu.Unlock()
+	}
+}
+
+// write sends an event unless the client already has it; mu must be held
+func (c *simulationClient) write(event services.SimulationEvent) {
+	if event.Seq != 0 && event.Seq <= c.lastSeq {
+		return
+	}
+	if event.Seq != 0 {
+		c.lastSeq = event.Seq
+	}
+	c.writeMessage(WSResponse{Event: event.Event, Data: event.Data})
+}
+
+// send sends a message to the client
+func (c *simulationClient) send(msg WSResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeMessage(msg)
+}
+
+// sendError sends an error message to the client
+func (c *simulationClient) sendError(message string) {
+	c.send(WSResponse{
+		Event: "error",
+		Data: map[string]interface{}{
+			"message": message,
+		},
+	})
+}
+
+func (c *simulationClient) writeMessage(msg WSResponse) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal WebSocket message: %v", err)
+		return
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		log.Printf("Failed to send WebSocket message: %v", err)
+	}
+}
+
+// startEventListener forwards the run events workers publish to Redis
+func (h *SimulationWSHandler) startEventListener() {
+	if redis.RedisClient == nil {
+		log.Println("⚠️ Redis not connected, simulation WebSocket disabled")
+		return
+	}
+
+	pubsub := redis.PSubscribe(services.SimulationEventsPattern)
+	defer pubsub.Close()
+
+	log.Println("📡 Simulation WebSocket listener started")
+	for msg := range pubsub.Channel() {
+		var event services.SimulationEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Printf("Failed to parse simulation event: %v", err)
+			continue
+		}
+		h.BroadcastToSimulation(services.SimulationIDFromChannel(msg.Channel), event)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"nexfi-backend/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CircuitRepository handles circuit database operations
@@ -72,26 +73,54 @@ func (r *CircuitRepository) FindAll(filter CircuitFilter, page, limit int, sort,
 // FindByID finds circuit by ID
 func (r *CircuitRepository) FindByID(id string) (*models.Circuit, error) {
 	var circuit models.Circuit
-	err := r.DB.Preload("Project").Preload("User").First(&circuit, "id = ?", id).Error
+	err := r.DB.Preload("Project").Preload("User").Preload("ForkedFrom").Preload("ForkedFrom.User").First(&circuit, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &circuit, nil
 }
 
+// FindByProject finds the circuits of a project, oldest first
+func (r *CircuitRepository) FindByProject(projectID string) ([]models.Circuit, error) {
+	var circuits []models.Circuit
+	err := r.DB.Where("project_id = ?", projectID).Order("created_at ASC").Find(&circuits).Error
+	return circuits, err
+}
+
 // Create creates a new circuit
 func (r *CircuitRepository) Create(circuit *models.Circuit) error {
 	return r.DB.Create(circuit).Error
 }
 
+// circuitSeparateColumns are updated on their own: the counters by stars
+// and forks, the thumbnail by its render. Saving a circuit leaves them, so
+// one saved from an earlier read does not undo those updates.
+var circuitSeparateColumns = []string{"stars_count", "forks_count", "thumbnail_url", clause.Associations}
+
 // Update updates a circuit
 func (r *CircuitRepository) Update(circuit *models.Circuit) error {
-	return r.DB.Save(circuit).Error
+	return r.DB.Omit(circuitSeparateColumns...).Save(circuit).Error
 }
 
-// Delete deletes a circuit
+// UpdateThumbnail sets only the thumbnail URL
+func (r *CircuitRepository) UpdateThumbnail(id, thumbnailURL string) error {
+	return r.DB.Model(&models.Circuit{}).Where("id = ?", id).
+		Update("thumbnail_url", thumbnailURL).Error
+}
+
+// Delete deletes a circuit with its revisions and stars
 func (r *CircuitRepository) Delete(id string) error {
-	return r.DB.Delete(&models.Circuit{}, "id = ?", id).Error
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Delete revisions and stars first
+		if err := tx.Delete(&models.CircuitRevision{}, "circuit_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.CircuitStar{}, "circuit_id = ?", id).Error; err != nil {
+			return err
+		}
+		// Delete circuit
+		return tx.Delete(&models.Circuit{}, "id = ?", id).Error
+	})
 }
 
 // IsOwner checks if user is owner
@@ -144,3 +173,251 @@ func (r *CircuitRepository) IncrementTemplateUseCount(id string) error {
 	return r.DB.Model(&models.CircuitTemplate{}).Where("id = ?", id).
 		Update("use_count", gorm.Expr("use_count + 1")).Error
 }
+
+// CreateWithRevision creates a circuit with its first revision
+func (r *CircuitRepository) CreateWithRevision(circuit *models.Circuit, revision *models.CircuitRevision) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(circuit).Error; err != nil {
+			return err
+		}
+		revision.CircuitID = circuit.ID
+		return createRevision(tx, revision)
+	})
+}
+
+// UpdateWithRevision saves a circuit and the revision of its new schema
+// together
+func (r *CircuitRepository) UpdateWithRevision(circuit *models.Circuit, revision *models.CircuitRevision) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockCircuit(tx, circuit.ID); err != nil {
+			return err
+		}
+		if err := tx.Omit(circuitSeparateColumns...).Save(circuit).Error; err != nil {
+			return err
+		}
+		revision.CircuitID = circuit.ID
+		return createRevision(tx, revision)
+	})
+}
+
+// CreateRevision stores a new revision, numbering it after the latest one
+func (r *CircuitRepository) CreateRevision(revision *models.CircuitRevision) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockCircuit(tx, revision.CircuitID); err != nil {
+			return err
+		}
+		return createRevision(tx, revision)
+	})
+}
+
+// lockCircuit locks the row of a circuit so its revisions are numbered one
+// at a time
+func lockCircuit(tx *gorm.DB, circuitID string) error {
+	var circuit models.Circuit
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&circuit, "id = ?", circuitID).Error
+}
+
+// createRevision numbers a revision after the latest one and stores it; the
+// circuit must be locked
+func createRevision(tx *gorm.DB, revision *models.CircuitRevision) error {
+	var latest int
+	if err := tx.Model(&models.CircuitRevision{}).
+		Where("circuit_id = ?", revision.CircuitID).
+		Select("COALESCE(MAX(revision_number), 0)").
+		Scan(&latest).Error; err != nil {
+		return err
+	}
+	revision.RevisionNumber = latest + 1
+	return tx.Create(revision).Error
+}
+
+// CountRevisions counts revisions of a circuit
+func (r *CircuitRepository) CountRevisions(circuitID string) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.CircuitRevision{}).Where("circuit_id = ?", circuitID).Count(&count).Error
+	return count, err
+}
+
+// FindRevisions lists revisions of a circuit, newest first, without schema data
+func (r *CircuitRepository) FindRevisions(circuitID string, page, limit int) ([]models.CircuitRevision, int64, error) {
+	var revisions []models.CircuitRevision
+	var total int64
+
+	query := r.DB.Model(&models.CircuitRevision{}).Where("circuit_id = ?", circuitID)
+	query.Count(&total)
+
+	err := query.Scopes(Paginate(page, limit)).
+		Omit("schema_data").
+		Order("revision_number DESC").
+		Preload("User").
+		Find(&revisions).Error
+
+	return revisions, total, err
+}
+
+// FindRevisionByID finds a revision belonging to a circuit
+func (r *CircuitRepository) FindRevisionByID(circuitID, revisionID string) (*models.CircuitRevision, error) {
+	var revision models.CircuitRevision
+	err := r.DB.Preload("User").First(&revision, "id = ? AND circuit_id = ?", revisionID, circuitID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// FindLatestRevision finds the most recent revision of a circuit
+func (r *CircuitRepository) FindLatestRevision(circuitID string) (*models.CircuitRevision, error) {
+	var revision models.CircuitRevision
+	err := r.DB.Preload("User").Where("circuit_id = ?", circuitID).
+		Order("revision_number DESC").
+		First(&revision).Error
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// ExploreFilter defines filter options for the public gallery
+type ExploreFilter struct {
+	Search string
+	Tag    string
+	UserID string // author
+}
+
+// trendingWindow is how far back stars and forks count towards trending
+const trendingWindow = "7 days"
+
+// FindPublic finds public circuits for the gallery.
+// Supported sorts: trending, most_forked, most_starred, newest.
+func (r *CircuitRepository) FindPublic(filter ExploreFilter, sort string, page, limit int) ([]models.Circuit, int64, error) {
+	var circuits []models.Circuit
+	var total int64
+
+	query := r.DB.Model(&models.Circuit{}).Where("circuits.is_public = ?", true)
+
+	if filter.Search != "" {
+		query = query.Where("(circuits.name ILIKE ? OR circuits.description ILIKE ?)", "%"+filter.Search+"%", "%"+filter.Search+"%")
+	}
+
+	if filter.Tag != "" {
+		query = query.Where("? = ANY(circuits.tags)", filter.Tag)
+	}
+
+	if filter.UserID != "" {
+		query = query.Where("circuits.user_id = ?", filter.UserID)
+	}
+
+	query.Count(&total)
+
+	switch sort {
+	case "trending":
+		// Recent activity outweighs all-time popularity
+		query = query.Order(`(
+			(SELECT COUNT(*) FROM circuit_stars s WHERE s.circuit_id = circuits.id AND s.created_at > NOW() - INTERVAL '` + trendingWindow + `') * 2 +
+			(SELECT COUNT(*) FROM circuits f WHERE f.forked_from_id = circuits.id AND f.created_at > NOW() - INTERVAL '` + trendingWindow + `') * 3 +
+			circuits.stars_count + circuits.forks_count
+		) DESC`).Order("circuits.updated_at DESC")
+	case "most_forked":
+		query = query.Order("circuits.forks_count DESC").Order("circuits.stars_count DESC")
+	case "most_starred":
+		query = query.Order("circuits.stars_count DESC").Order("circuits.forks_count DESC")
+	default:
+		query = query.Order("circuits.created_at DESC")
+	}
+
+	err := query.Scopes(Paginate(page, limit)).
+		Preload("User").
+		Preload("ForkedFrom").
+		Preload("ForkedFrom.User").
+		Find(&circuits).Error
+
+	return circuits, total, err
+}
+
+// TagCount is a tag with the number of circuits using it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// FindPublicTags lists the tags used by public circuits with their usage count
+func (r *CircuitRepository) FindPublicTags(limit int) ([]TagCount, error) {
+	var tags []TagCount
+	err := r.DB.Raw(`
+		SELECT tag, COUNT(*) AS count
+		FROM circuits, UNNEST(tags) AS tag
+		WHERE is_public = true
+		GROUP BY tag
+		ORDER BY count DESC, tag ASC
+		LIMIT ?`, limit).Scan(&tags).Error
+	return tags, err
+}
+
+// ToggleStar stars or unstars a circuit and keeps the counter in sync.
+// The star is inserted unless one exists, so concurrent requests cannot
+// both add one; an existing star is removed instead.
+func (r *CircuitRepository) ToggleStar(circuitID, userID string) (bool, error) {
+	starred := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "circuit_id"}, {Name: "user_id"}},
+			DoNothing: true,
+		}).Create(&models.CircuitStar{CircuitID: circuitID, UserID: userID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			starred = true
+			return tx.Model(&models.Circuit{}).Where("id = ?", circuitID).
+				UpdateColumn("stars_count", gorm.Expr("stars_count + 1")).Error
+		}
+
+		result = tx.Where("circuit_id = ? AND user_id = ?", circuitID, userID).Delete(&models.CircuitStar{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Circuit{}).Where("id = ? AND stars_count > 0", circuitID).
+			UpdateColumn("stars_count", gorm.Expr("stars_count - 1")).Error
+	})
+	return starred, err
+}
+
+// FindStarredIDs returns which of the given circuits the user has starred
+func (r *CircuitRepository) FindStarredIDs(userID string, circuitIDs []string) map[string]bool {
+	starred := map[string]bool{}
+	if len(circuitIDs) == 0 {
+		return starred
+	}
+
+	var ids []string
+	r.DB.Model(&models.CircuitStar{}).
+		Where("user_id = ? AND circuit_id IN ?", userID, circuitIDs).
+		Pluck("circuit_id", &ids)
+
+	for _, id := range ids {
+		starred[id] = true
+	}
+	return starred
+}
+
+// IncrementForksCount increments the fork counter of a circuit
+func (r *CircuitRepository) IncrementForksCount(id string) error {
+	return r.DB.Model(&models.Circuit{}).Where("id = ?", id).
+		UpdateColumn("forks_count", gorm.Expr("forks_count + 1")).Error
+}
+
+// FindForks lists public forks of a circuit
+func (r *CircuitRepository) FindForks(circuitID string, page, limit int) ([]models.Circuit, int64, error) {
+	var circuits []models.Circuit
+	var total int64
+
+	query := r.DB.Model(&models.Circuit{}).Where("forked_from_id = ? AND is_public = ?", circuitID, true)
+	query.Count(&total)
+
+	err := query.Scopes(Paginate(page, limit)).
+		Order("created_at DESC").
+		Preload("User").
+		Find(&circuits).Error
+
+	return circuits, total, err
+}
@@ -80,6 +80,40 @@ func (r *ComponentRepository) FindByID(id string) (*models.Component, error) {
 	return &component, nil
 }
 
+// FindBySimulationModels finds active catalog components for the given simulation models
+func (r *ComponentRepository) FindBySimulationModels(simulationModels []string) ([]models.Component, error) {
+	var components []models.Component
+	if len(simulationModels) == 0 {
+		return components, nil
+	}
+	err := r.DB.Where("is_active = ? AND simulation_model IN ?", true, simulationModels).
+		Order("stock DESC").
+		Find(&components).Error
+	return components, err
+}
+
+// FindByIDs finds catalog components by their IDs
+func (r *ComponentRepository) FindByIDs(ids []string) ([]models.Component, error) {
+	var components []models.Component
+	if len(ids) == 0 {
+		return components, nil
+	}
+	err := r.DB.Where("id IN ?", ids).Find(&components).Error
+	return components, err
+}
+
+// FindByPartNumbers finds active catalog components by their part numbers
+func (r *ComponentRepository) FindByPartNumbers(partNumbers []string) ([]models.Component, error) {
+	var components []models.Component
+	if len(partNumbers) == 0 {
+		return components, nil
+	}
+	err := r.DB.Where("is_active = ? AND part_number IN ?", true, partNumbers).
+		Order("stock DESC").
+		Find(&components).Error
+	return components, err
+}
+
 // Search searches components by name
 func (r *ComponentRepository) Search(query string, categoryID string, limit int) ([]models.Component, error) {
 	var components []models.Component
@@ -176,3 +210,30 @@ func (r *ComponentRepository) GetUserRequests(userID string) ([]models.Component
 	err := r.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&requests).Error
 	return requests, err
 }
+
+// FindModels finds the active models of the model library
+func (r *ComponentRepository) FindModels() ([]models.ComponentModel, error) {
+	var componentModels []models.ComponentModel
+	err := r.DB.Where("is_active = ?", true).Order("name ASC").Find(&componentModels).Error
+	return componentModels, err
+}
+
+// FindModelByName finds a model by name, ignoring case
+func (r *ComponentRepository) FindModelByName(name string) (*models.ComponentModel, error) {
+	var componentModel models.ComponentModel
+	err := r.DB.Where("LOWER(name) = LOWER(?)", name).First(&componentModel).Error
+	if err != nil {
+		return nil, err
+	}
+	return &componentModel, nil
+}
+
+// SaveModel creates or updates a model
+func (r *ComponentRepository) SaveModel(componentModel *models.ComponentModel) error {
+	return r.DB.Save(componentModel).Error
+}
+
+// UpdateSimulationModel points a catalog component at a model
+func (r *ComponentRepository) UpdateSimulationModel(componentID, name string) error {
+	return r.DB.Model(&models.Component{}).Where("id = ?", componentID).Update("simulation_model", name).Error
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // LabRepository handles lab database operations
@@ -490,6 +491,79 @@ func (r *LabRepository) UpdateCompilationStatus(id string, status models.Compila
 	return r.DB.Model(&models.CodeCompilation{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// ============================================
+// Deployment Operations
+// ============================================
+
+// ReplaceQueuedDeployment cancels the deployments waiting for the user's
+// next session on the lab and queues this one instead. The lab row is
+// locked, so concurrent deployments leave a single one queued.
+func (r *LabRepository) ReplaceQueuedDeployment(deployment *models.LabDeployment) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var lab models.Lab
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&lab, "id = ?", deployment.LabID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.LabDeployment{}).
+			Where("lab_id = ? AND user_id = ? AND status = ?", deployment.LabID, deployment.UserID, models.DeploymentStatusQueued).
+			Update("status", models.DeploymentStatusCancelled).Error; err != nil {
+			return err
+		}
+		return tx.Create(deployment).Error
+	})
+}
+
+// FindDeploymentByID finds deployment by ID
+func (r *LabRepository) FindDeploymentByID(id string) (*models.LabDeployment, error) {
+	var deployment models.LabDeployment
+	err := r.DB.Preload("Lab").Preload("Session").First(&deployment, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// FindQueuedDeployment finds the latest deployment waiting for a user's next session on a lab
+func (r *LabRepository) FindQueuedDeployment(labID, userID string) (*models.LabDeployment, error) {
+	var deployment models.LabDeployment
+	err := r.DB.Where("lab_id = ? AND user_id = ? AND status = ?", labID, userID, models.DeploymentStatusQueued).
+		Order("created_at DESC").
+		First(&deployment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// FindDeploymentBySession finds the deployment staged on a session
+func (r *LabRepository) FindDeploymentBySession(sessionID string) (*models.LabDeployment, error) {
+	var deployment models.LabDeployment
+	err := r.DB.First(&deployment, "session_id = ?", sessionID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// UpdateDeployment updates a deployment
+func (r *LabRepository) UpdateDeployment(deployment *models.LabDeployment) error {
+	return r.DB.Save(deployment).Error
+}
+
+// CancelQueuedDeployments cancels the deployments waiting for a user's next session on a lab
+func (r *LabRepository) CancelQueuedDeployments(labID, userID string) error {
+	return r.DB.Model(&models.LabDeployment{}).
+		Where("lab_id = ? AND user_id = ? AND status = ?", labID, userID, models.DeploymentStatusQueued).
+		Update("status", models.DeploymentStatusCancelled).Error
+}
+
+// CompleteSessionDeployment marks the deployment staged on a session as completed
+func (r *LabRepository) CompleteSessionDeployment(sessionID string) error {
+	return r.DB.Model(&models.LabDeployment{}).
+		Where("session_id = ? AND status = ?", sessionID, models.DeploymentStatusStaged).
+		Update("status", models.DeploymentStatusCompleted).Error
+}
+
 // ============================================
 // Hardware Log Operations
 // ============================================
@@ -518,3 +592,13 @@ func (r *LabRepository) GetLabHardwareLogs(labID string, limit int) ([]models.La
 		Find(&logs).Error
 	return logs, err
 }
+
+// GetSessionHardwareLogsByType gets hardware logs of one event type for a session, oldest first
+func (r *LabRepository) GetSessionHardwareLogsByType(sessionID string, eventType models.LabEventType, limit int) ([]models.LabHardwareLog, error) {
+	var logs []models.LabHardwareLog
+	err := r.DB.Where("session_id = ? AND event_type = ?", sessionID, eventType).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
@@ -3,7 +3,9 @@ package repositories
 import (
 	"nexfi-backend/models"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ProjectRepository handles project database operations
@@ -117,11 +119,38 @@ func (r *ProjectRepository) Delete(id string) error {
 		if err := tx.Delete(&models.ProjectCollaborator{}, "project_id = ?", id).Error; err != nil {
 			return err
 		}
+		// Delete version history
+		if err := tx.Delete(&models.ProjectVersion{}, "project_id = ?", id).Error; err != nil {
+			return err
+		}
 		// Delete project
 		return tx.Delete(&models.Project{}, "id = ?", id).Error
 	})
 }
 
+// CreateWithComponents creates a project and its components in one transaction
+func (r *ProjectRepository) CreateWithComponents(project *models.Project, components []models.ProjectComponent) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(project).Error; err != nil {
+			return err
+		}
+		for i := range components {
+			components[i].ProjectID = project.ID
+			if err := tx.Create(&components[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindMilestones finds the milestones unlocked on a project, oldest first
+func (r *ProjectRepository) FindMilestones(projectID string) ([]models.ProjectMilestone, error) {
+	var milestones []models.ProjectMilestone
+	err := r.DB.Where("project_id = ?", projectID).Order("unlocked_at ASC").Find(&milestones).Error
+	return milestones, err
+}
+
 // ToggleFavorite toggles project favorite status
 func (r *ProjectRepository) ToggleFavorite(id string) (bool, error) {
 	var project models.Project
@@ -157,7 +186,6 @@ func (r *ProjectRepository) DuplicateProject(id, newUserID string) (*models.Proj
 		Tags:             original.Tags,
 		SchemaData:       original.SchemaData,
 		CodeData:         original.CodeData,
-		SimulationData:   original.SimulationData,
 	}
 
 	if err := r.DB.Create(&newProject).Error; err != nil {
@@ -212,6 +240,22 @@ func (r *ProjectRepository) FindCollaborator(projectID, userID string) (*models.
 	return &collab, nil
 }
 
+// UpdateCollaborator updates a collaborator's role or acceptance
+func (r *ProjectRepository) UpdateCollaborator(collab *models.ProjectCollaborator) error {
+	return r.DB.Omit("Project", "User").Save(collab).Error
+}
+
+// FindPendingInvitations finds the invitations a user has not answered yet
+func (r *ProjectRepository) FindPendingInvitations(userID string) ([]models.ProjectCollaborator, error) {
+	var invitations []models.ProjectCollaborator
+	err := r.DB.Where("user_id = ? AND accepted_at IS NULL", userID).
+		Preload("Project").
+		Preload("Project.User").
+		Order("invited_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
 // RemoveCollaborator removes a collaborator by ID
 func (r *ProjectRepository) RemoveCollaborator(collaboratorID string) error {
 	return r.DB.Delete(&models.ProjectCollaborator{}, "id = ?", collaboratorID).Error
@@ -226,21 +270,139 @@ func (r *ProjectRepository) IsOwner(projectID, userID string) (bool, error) {
 
 // HasAccess checks if user has access to project
 func (r *ProjectRepository) HasAccess(projectID, userID string) (bool, error) {
-	// Check if owner
+	role, err := r.FindRole(projectID, userID)
+	return role != "", err
+}
+
+// FindRole finds the user's role on a project: owner, the role of an accepted
+// collaborator, or empty when the user has none
+func (r *ProjectRepository) FindRole(projectID, userID string) (models.CollaboratorRole, error) {
 	isOwner, err := r.IsOwner(projectID, userID)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 	if isOwner {
-		return true, nil
+		return models.CollabRoleOwner, nil
 	}
 
-	// Check if collaborator
-	var count int64
+	var roles []models.CollaboratorRole
 	err = r.DB.Model(&models.ProjectCollaborator{}).
 		Where("project_id = ? AND user_id = ? AND accepted_at IS NOT NULL", projectID, userID).
-		Count(&count).Error
-	return count > 0, err
+		Limit(1).
+		Pluck("role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+// CreateVersion stores a new project version, numbering it after the latest one
+func (r *ProjectRepository) CreateVersion(version *models.ProjectVersion) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the project so versions are numbered one at a time
+		var project models.Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&project, "id = ?", version.ProjectID).Error; err != nil {
+			return err
+		}
+		return createVersion(tx, version)
+	})
+}
+
+// createVersion numbers a version after the latest one and stores it. The
+// caller holds the lock on the project row.
+func createVersion(tx *gorm.DB, version *models.ProjectVersion) error {
+	var latest int
+	if err := tx.Model(&models.ProjectVersion{}).
+		Where("project_id = ?", version.ProjectID).
+		Select("COALESCE(MAX(version_number), 0)").
+		Scan(&latest).Error; err != nil {
+		return err
+	}
+	version.VersionNumber = latest + 1
+	return tx.Create(version).Error
+}
+
+// RestoreContent replaces a project's schema and code under a lock on the
+// project row. before is given the project's current schema and code, and
+// the version it returns, if any, is stored first within the same
+// transaction, so no save lands between the two.
+func (r *ProjectRepository) RestoreContent(projectID string, schemaData, codeData datatypes.JSON, before func(current *models.Project) *models.ProjectVersion) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var project models.Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "schema_data", "code_data").
+			First(&project, "id = ?", projectID).Error; err != nil {
+			return err
+		}
+
+		if version := before(&project); version != nil {
+			if err := createVersion(tx, version); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&project).Updates(map[string]interface{}{
+			"schema_data": schemaData,
+			"code_data":   codeData,
+		}).Error
+	})
+}
+
+// UpdateVersion updates a project version
+func (r *ProjectRepository) UpdateVersion(version *models.ProjectVersion) error {
+	return r.DB.Omit("User").Save(version).Error
+}
+
+// FindVersions lists versions of a project, newest first, without their snapshots
+func (r *ProjectRepository) FindVersions(projectID string, checkpointsOnly bool, page, limit int) ([]models.ProjectVersion, int64, error) {
+	var versions []models.ProjectVersion
+	var total int64
+
+	query := r.DB.Model(&models.ProjectVersion{}).Where("project_id = ?", projectID)
+	if checkpointsOnly {
+		query = query.Where("name <> ''")
+	}
+	query.Count(&total)
+
+	err := query.Scopes(Paginate(page, limit)).
+		Omit("schema_data", "code_data").
+		Order("version_number DESC").
+		Preload("User").
+		Find(&versions).Error
+
+	return versions, total, err
+}
+
+// FindVersionByID finds a version belonging to a project
+func (r *ProjectRepository) FindVersionByID(projectID, versionID string) (*models.ProjectVersion, error) {
+	var version models.ProjectVersion
+	err := r.DB.Preload("User").First(&version, "id = ? AND project_id = ?", versionID, projectID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// FindLatestVersion finds the most recent version of a project
+func (r *ProjectRepository) FindLatestVersion(projectID string) (*models.ProjectVersion, error) {
+	var version models.ProjectVersion
+	err := r.DB.Preload("User").Where("project_id = ?", projectID).
+		Order("version_number DESC").
+		First(&version).Error
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// PruneVersions deletes the oldest automatic versions of a project beyond
+// the newest keep; checkpoints are kept
+func (r *ProjectRepository) PruneVersions(projectID string, keep int) error {
+	return r.DB.Exec(`DELETE FROM project_versions WHERE id IN (
+		SELECT id FROM project_versions
+		WHERE project_id = ? AND COALESCE(name, '') = ''
+		ORDER BY version_number DESC
+		OFFSET ?
+	)`, projectID, keep).Error
 }
 
 // GetTemplates gets template projects
@@ -1,9 +1,13 @@
 package repositories
 
 import (
+	"database/sql"
+	"errors"
 	"nexfi-backend/models"
+	"strings"
 	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -85,20 +89,72 @@ func (r *SimulationRepository) FindByID(id string) (*models.Simulation, error) {
 	return &simulation, nil
 }
 
+// FindByProject finds the simulation a project's runs use. Other
+// simulations linked to the project are not it.
+func (r *SimulationRepository) FindByProject(projectID, ownerID string) (*models.Simulation, error) {
+	var simulation models.Simulation
+	err := r.DB.Where("project_id = ? AND user_id = ? AND is_project_simulation = ?", projectID, ownerID, true).First(&simulation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &simulation, nil
+}
+
 // Create creates a new simulation
 func (r *SimulationRepository) Create(simulation *models.Simulation) error {
 	return r.DB.Create(simulation).Error
 }
 
-// Update updates a simulation
+// Update updates a simulation. The golden run is left alone: it is pinned
+// with SetGoldenRun, possibly while a run holds an older copy.
 func (r *SimulationRepository) Update(simulation *models.Simulation) error {
-	return r.DB.Save(simulation).Error
+	return r.DB.Omit("GoldenRunID").Save(simulation).Error
 }
 
-// Delete deletes a simulation
+// UpdateResult sets the status and error message of a simulation after a
+// run, and its last result unless lastResult is nil. Other columns are left
+// to the edits made while the run went on.
+func (r *SimulationRepository) UpdateResult(simulationID string, status models.SimulationStatusType, errorMessage string, lastResult datatypes.JSON) error {
+	updates := map[string]interface{}{"status": status, "error_message": errorMessage}
+	if lastResult != nil {
+		updates["last_result"] = lastResult
+	}
+	return r.DB.Model(&models.Simulation{}).Where("id = ?", simulationID).Updates(updates).Error
+}
+
+// UpdateStatus sets the status of a simulation, leaving its other columns
+func (r *SimulationRepository) UpdateStatus(simulationID string, status models.SimulationStatusType) error {
+	return r.DB.Model(&models.Simulation{}).Where("id = ?", simulationID).Update("status", status).Error
+}
+
+// UpdateProjectSchema stores the schema and settings a project run uses,
+// unless the simulation is running; false then
+func (r *SimulationRepository) UpdateProjectSchema(simulation *models.Simulation) (bool, error) {
+	result := r.DB.Model(&models.Simulation{}).
+		Where("id = ? AND status <> ?", simulation.ID, models.SimStatusRunning).
+		Updates(map[string]interface{}{
+			"schema_data":         simulation.SchemaData,
+			"simulation_settings": simulation.SimulationSettings,
+			"components_count":    simulation.ComponentsCount,
+			"wires_count":         simulation.WiresCount,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// SetGoldenRun pins the golden run of a simulation; nil unpins it
+func (r *SimulationRepository) SetGoldenRun(simulationID string, runID *string) error {
+	return r.DB.Model(&models.Simulation{}).
+		Where("id = ?", simulationID).
+		Update("golden_run_id", runID).Error
+}
+
+// Delete deletes a simulation with its runs and lab deployments
 func (r *SimulationRepository) Delete(id string) error {
 	return r.DB.Transaction(func(tx *gorm.DB) error {
-		// Delete runs first
+		// Delete lab deployments and runs first
+		if err := tx.Delete(&models.LabDeployment{}, "simulation_id = ?", id).Error; err != nil {
+			return err
+		}
 		if err := tx.Delete(&models.SimulationRun{}, "simulation_id = ?", id).Error; err != nil {
 			return err
 		}
@@ -114,16 +170,19 @@ func (r *SimulationRepository) IsOwner(simulationID, userID string) (bool, error
 	return count > 0, err
 }
 
-// GetStats gets simulation statistics for a user
+// GetStats gets simulation statistics for a user, over the simulations of
+// their circuits and projects and the top-level runs of those simulations
 func (r *SimulationRepository) GetStats(userID string) (*models.SimulationStats, error) {
 	stats := &models.SimulationStats{
 		ByType: make(map[string]int),
 	}
 
 	// Total simulations
-	var totalSim int64
+	var totalSim, projectSim int64
 	r.DB.Model(&models.Simulation{}).Where("user_id = ?", userID).Count(&totalSim)
+	r.DB.Model(&models.Simulation{}).Where("user_id = ? AND is_project_simulation = ?", userID, true).Count(&projectSim)
 	stats.TotalSimulations = int(totalSim)
+	stats.ProjectSimulations = int(projectSim)
 
 	// By status
 	var statusCounts []struct {
@@ -149,21 +208,46 @@ func (r *SimulationRepository) GetStats(userID string) (*models.SimulationStats,
 		}
 	}
 
-	// Total runtime
+	// Runs; the variants of a sweep belong to their parent run
+	runs := r.DB.Model(&models.SimulationRun{}).
+		Joins("JOIN simulations ON simulations.id = simulation_runs.simulation_id").
+		Where("simulations.user_id = ? AND simulation_runs.parent_run_id IS NULL", userID)
+
+	var runCounts []struct {
+		Status     string
+		Count      int
+		DurationMs int64
+	}
+	runs.Session(&gorm.Session{}).
+		Select("simulation_runs.status, count(*) as count, COALESCE(SUM(simulation_runs.duration_ms), 0) as duration_ms").
+		Group("simulation_runs.status").
+		Scan(&runCounts)
+
 	var totalMs int64
-	r.DB.Model(&models.Simulation{}).Where("user_id = ?", userID).Select("COALESCE(SUM(total_runtime_ms), 0)").Scan(&totalMs)
+	for _, rc := range runCounts {
+		stats.TotalRuns += rc.Count
+		totalMs += rc.DurationMs
+		switch rc.Status {
+		case models.RunStatusCompleted:
+			stats.CompletedRuns = rc.Count
+		case models.RunStatusError:
+			stats.FailedRuns = rc.Count
+		}
+	}
 	stats.TotalRuntimeHours = float64(totalMs) / 3600000.0
 
 	// Success rate
-	if stats.TotalSimulations > 0 {
-		stats.SuccessRate = float64(stats.Completed) / float64(stats.TotalSimulations) * 100
+	if finished := stats.CompletedRuns + stats.FailedRuns; finished > 0 {
+		stats.SuccessRate = float64(stats.CompletedRuns) / float64(finished) * 100
 	}
 
-	// Simulations this week
+	// Simulations and runs this week
 	weekAgo := time.Now().AddDate(0, 0, -7)
-	var weekCount int64
+	var weekCount, weekRuns int64
 	r.DB.Model(&models.Simulation{}).Where("user_id = ? AND created_at >= ?", userID, weekAgo).Count(&weekCount)
+	runs.Session(&gorm.Session{}).Where("simulation_runs.started_at >= ?", weekAgo).Count(&weekRuns)
 	stats.SimulationsThisWeek = int(weekCount)
+	stats.RunsThisWeek = int(weekRuns)
 
 	// By type
 	var typeCounts []struct {
@@ -192,6 +276,81 @@ func (r *SimulationRepository) CreateRun(run *models.SimulationRun) error {
 	return r.DB.Create(run).Error
 }
 
+// StartRun marks a simulation running and creates its run; false when the
+// simulation was already running. The status is only changed from another
+// one, so of two requests at once only one starts a run.
+func (r *SimulationRepository) StartRun(simulation *models.Simulation, run *models.SimulationRun) (bool, error) {
+	started := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Simulation{}).
+			Where("id = ? AND status <> ?", simulation.ID, models.SimStatusRunning).
+			Updates(map[string]interface{}{"status": models.SimStatusRunning, "error_message": "", "last_run_at": now})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		simulation.Status, simulation.ErrorMessage, simulation.LastRunAt = models.SimStatusRunning, "", &now
+		started = true
+		return nil
+	})
+	return started, err
+}
+
+// ResetStaleRuns ends the runs still running that a worker claimed before
+// the given time with the given errors, and moves the simulations left
+// running without a queued or running run to error. Queued runs are left
+// to ExpireRun. It returns how many runs and simulations it reset.
+func (r *SimulationRepository) ResetStaleRuns(before time.Time, runErrors datatypes.JSON, message string) (int64, int64, error) {
+	var runs, simulations int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.SimulationRun{}).
+			Where("status = ? AND started_at < ?", models.RunStatusRunning, before).
+			Updates(map[string]interface{}{"status": models.RunStatusError, "errors": runErrors, "completed_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		runs = result.RowsAffected
+
+		result = idleRunningSimulations(tx).
+			Updates(map[string]interface{}{"status": models.SimStatusError, "error_message": message})
+		simulations = result.RowsAffected
+		return result.Error
+	})
+	return runs, simulations, err
+}
+
+// ExpireRun ends a run still queued with the given errors, and moves its
+// simulation to error when it has no other queued or running run; false
+// when the run was already claimed or stopped
+func (r *SimulationRepository) ExpireRun(simulationID, runID string, runErrors datatypes.JSON, message string) (bool, error) {
+	expired := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.SimulationRun{}).
+			Where("id = ? AND status = ?", runID, models.RunStatusQueued).
+			Updates(map[string]interface{}{"status": models.RunStatusError, "errors": runErrors, "completed_at": time.Now()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		expired = true
+
+		return idleRunningSimulations(tx).Where("id = ?", simulationID).
+			Updates(map[string]interface{}{"status": models.SimStatusError, "error_message": message}).Error
+	})
+	return expired, err
+}
+
+// idleRunningSimulations scopes to the simulations running without a
+// queued or running run
+func idleRunningSimulations(tx *gorm.DB) *gorm.DB {
+	live := tx.Model(&models.SimulationRun{}).Select("1").
+		Where("simulation_runs.simulation_id = simulations.id AND simulation_runs.status IN ?", []string{models.RunStatusQueued, models.RunStatusRunning})
+	return tx.Model(&models.Simulation{}).
+		Where("status = ? AND NOT EXISTS (?)", models.SimStatusRunning, live)
+}
+
 // UpdateRun updates a simulation run
 func (r *SimulationRepository) UpdateRun(run *models.SimulationRun) error {
 	return r.DB.Save(run).Error
@@ -200,7 +359,7 @@ func (r *SimulationRepository) UpdateRun(run *models.SimulationRun) error {
 // GetRuns gets run history for a simulation
 func (r *SimulationRepository) GetRuns(simulationID string, limit int) ([]models.SimulationRun, error) {
 	var runs []models.SimulationRun
-	err := r.DB.Where("simulation_id = ?", simulationID).
+	err := r.DB.Where("simulation_id = ? AND parent_run_id IS NULL", simulationID).
 		Order("started_at DESC").
 		Limit(limit).
 		Find(&runs).Error
@@ -210,7 +369,7 @@ func (r *SimulationRepository) GetRuns(simulationID string, limit int) ([]models
 // GetLatestRun gets the latest run for a simulation
 func (r *SimulationRepository) GetLatestRun(simulationID string) (*models.SimulationRun, error) {
 	var run models.SimulationRun
-	err := r.DB.Where("simulation_id = ?", simulationID).
+	err := r.DB.Where("simulation_id = ? AND parent_run_id IS NULL", simulationID).
 		Order("started_at DESC").
 		First(&run).Error
 	if err != nil {
@@ -219,6 +378,124 @@ func (r *SimulationRepository) GetLatestRun(simulationID string) (*models.Simula
 	return &run, nil
 }
 
+// GetRunByID gets a run of a simulation
+func (r *SimulationRepository) GetRunByID(simulationID, runID string) (*models.SimulationRun, error) {
+	var run models.SimulationRun
+	err := r.DB.Where("id = ? AND simulation_id = ?", runID, simulationID).First(&run).Error
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// GetRunInfo gets a run of a simulation without its results
+func (r *SimulationRepository) GetRunInfo(simulationID, runID string) (*models.SimulationRun, error) {
+	var run models.SimulationRun
+	err := r.DB.Omit("result_data").Where("id = ? AND simulation_id = ?", runID, simulationID).First(&run).Error
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// GetRunResultPart reads one part of a run's results by its JSON path,
+// e.g. "transient", "waveform"; nil when the run has none
+func (r *SimulationRepository) GetRunResultPart(runID string, path ...string) ([]byte, error) {
+	var data []byte
+	err := r.DB.Raw("SELECT result_data #> ?::text[] FROM simulation_runs WHERE id = ?", "{"+strings.Join(path, ",")+"}", runID).
+		Row().Scan(&data)
+	return data, err
+}
+
+// GetRunWaveform reads the transient waveform of a run's results, keeping
+// only the signals named; empty keeps them all. nil when the run has none.
+func (r *SimulationRepository) GetRunWaveform(runID string, signals []string) ([]byte, error) {
+	if len(signals) == 0 {
+		return r.GetRunResultPart(runID, "transient", "waveform")
+	}
+	var data []byte
+	err := r.DB.Raw(`SELECT jsonb_set(w, '{signals}', COALESCE(
+			(SELECT jsonb_agg(s) FROM jsonb_array_elements(w->'signals') s WHERE s->>'name' IN ?), '[]'::jsonb))
+		FROM (SELECT result_data #> '{transient,waveform}' AS w FROM simulation_runs WHERE id = ?) run
+		WHERE jsonb_typeof(w) = 'object'`, signals, runID).
+		Row().Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// CreateVariantRuns stores the variants of a run
+func (r *SimulationRepository) CreateVariantRuns(runs []models.SimulationRun) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	return r.DB.CreateInBatches(runs, 50).Error
+}
+
+// GetVariantRuns gets the variants of a run in order
+func (r *SimulationRepository) GetVariantRuns(parentRunID string) ([]models.SimulationRun, error) {
+	var runs []models.SimulationRun
+	err := r.DB.Where("parent_run_id = ?", parentRunID).
+		Order("variant_index ASC").
+		Find(&runs).Error
+	return runs, err
+}
+
+// GetRunStatus gets the current status of a run
+func (r *SimulationRepository) GetRunStatus(runID string) (string, error) {
+	var run models.SimulationRun
+	err := r.DB.Select("status").Where("id = ?", runID).First(&run).Error
+	return run.Status, err
+}
+
+// ClaimRun moves a queued run to running, starting it now; false when it
+// was stopped or another worker took it
+func (r *SimulationRepository) ClaimRun(runID string) (bool, error) {
+	result := r.DB.Model(&models.SimulationRun{}).
+		Where("id = ? AND status = ?", runID, models.RunStatusQueued).
+		Updates(map[string]interface{}{"status": models.RunStatusRunning, "started_at": time.Now()})
+	return result.RowsAffected == 1, result.Error
+}
+
+// FinishRun stores a run's results. The status is only changed while the
+// run is still running, so a stop made meanwhile is kept; false then.
+func (r *SimulationRepository) FinishRun(run *models.SimulationRun) (bool, error) {
+	results := func() map[string]interface{} {
+		return map[string]interface{}{
+			"duration_ms": run.DurationMs,
+			"sketch_hash": run.SketchHash,
+			"result_data": run.ResultData,
+			"errors":      run.Errors,
+			"warnings":    run.Warnings,
+		}
+	}
+
+	finish := results()
+	finish["status"], finish["completed_at"] = run.Status, run.CompletedAt
+	result := r.DB.Model(&models.SimulationRun{}).
+		Where("id = ? AND status = ?", run.ID, models.RunStatusRunning).
+		Updates(finish)
+	if result.Error != nil || result.RowsAffected == 1 {
+		return result.RowsAffected == 1, result.Error
+	}
+	return false, r.DB.Model(&models.SimulationRun{}).Where("id = ?", run.ID).Updates(results()).Error
+}
+
+// StopRun stops a run that is queued or running; false when it had
+// already ended
+func (r *SimulationRepository) StopRun(run *models.SimulationRun) (bool, error) {
+	now := time.Now()
+	durationMs := int(now.Sub(run.StartedAt).Milliseconds())
+	result := r.DB.Model(&models.SimulationRun{}).
+		Where("id = ? AND status IN ?", run.ID, []string{models.RunStatusQueued, models.RunStatusRunning}).
+		Updates(map[string]interface{}{"status": models.RunStatusStopped, "completed_at": now, "duration_ms": durationMs})
+	if result.RowsAffected == 1 {
+		run.Status, run.CompletedAt, run.DurationMs = models.RunStatusStopped, &now, durationMs
+	}
+	return result.RowsAffected == 1, result.Error
+}
+
 // IncrementRunCount increments simulation run count
 func (r *SimulationRepository) IncrementRunCount(simulationID string, durationMs int) error {
 	now := time.Now()
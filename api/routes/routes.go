@@ -17,6 +17,8 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 	userHandler := handlers.NewUserHandler(nil)
 	projectHandler := handlers.NewProjectHandler(db)
 	projectProgressHandler := handlers.NewProjectProgressHandler(db) // Project progress & XP system
+	projectVersionHandler := handlers.NewProjectVersionHandler(db)   // Project version history
+	projectCodeHandler := handlers.NewProjectCodeHandler(db)         // Project code workspace
 	componentHandler := handlers.NewComponentHandler(db)
 	challengeHandler := handlers.NewChallengeHandler(db)
 	notificationHandler := handlers.NewNotificationHandler(db)
@@ -25,9 +27,13 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 	uploadHandler := handlers.NewUploadHandler()
 	labHandler := handlers.NewLabHandler(db)
 	labWSHandler := handlers.NewLabWSHandler(db)
+	simulationWSHandler := handlers.NewSimulationWSHandler(db)
+	projectWSHandler := handlers.NewProjectWSHandler(db)
 	circuitHandler := handlers.NewCircuitHandler(db)       // Circuit Simulator
 	simulationHandler := handlers.NewSimulationHandler(db) // Simulation Management
 	securityHandler := handlers.NewSecurityHandler(db)     // Security Settings
+	bomHandler := handlers.NewBOMHandler(db)               // Bill of Materials
+	schemaHandler := handlers.NewSchemaHandler()           // Published JSON Schemas
 
 	// Apply CORS middleware globally
 	router.Use(middleware.CORSMiddleware())
@@ -48,6 +54,8 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 	ws := router.Group("/ws")
 	{
 		ws.GET("/labs/:id", labWSHandler.HandleLabWebSocket)
+		ws.GET("/simulations/:id", simulationWSHandler.HandleSimulationWebSocket)
+		ws.GET("/projects/:id", projectWSHandler.HandleProjectWebSocket)
 	}
 
 	// Base API group
@@ -65,6 +73,13 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 			})
 		})
 
+		// Published JSON Schemas (Public)
+		schemas := apiV1.Group("/schemas")
+		{
+			schemas.GET("/circuit", schemaHandler.GetCircuitSchema)
+			schemas.GET("/circuit/:version", schemaHandler.GetCircuitSchema)
+		}
+
 		// ========================================
 		// AUTH ROUTES (Public)
 		// ========================================
@@ -186,15 +201,22 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 				projects.GET("", projectHandler.ListProjects)
 				projects.POST("", projectHandler.CreateProject)
 				projects.GET("/templates", projectHandler.GetTemplates)
+				projects.POST("/import", projectHandler.ImportProject)
+				projects.GET("/invitations", projectHandler.ListInvitations)
 				projects.GET("/:id", projectHandler.GetProject)
 				projects.PUT("/:id", projectHandler.UpdateProject)
 				projects.DELETE("/:id", projectHandler.DeleteProject)
 				projects.POST("/:id/duplicate", projectHandler.DuplicateProject)
+				projects.GET("/:id/export", projectHandler.ExportProject)
 				projects.PUT("/:id/favorite", projectHandler.ToggleFavorite)
 				projects.POST("/:id/favorite", projectHandler.ToggleFavorite) // Also support POST
 				projects.GET("/:id/collaborators", projectHandler.GetCollaborators)
 				projects.POST("/:id/collaborators", projectHandler.AddCollaborator)
+				projects.PUT("/:id/collaborators/:userId", projectHandler.UpdateCollaborator)
 				projects.DELETE("/:id/collaborators/:userId", projectHandler.RemoveCollaborator)
+				projects.POST("/:id/invitation/accept", projectHandler.AcceptInvitation)
+				projects.POST("/:id/invitation/decline", projectHandler.DeclineInvitation)
+				projects.GET("/:id/bom", bomHandler.GetProjectBOM)
 
 				// Project Progress & Studio endpoints
 				projects.GET("/:id/progress", projectProgressHandler.GetProgress)
@@ -205,6 +227,24 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 				projects.PUT("/:id/code", projectProgressHandler.SaveCode)
 				projects.POST("/:id/simulate", projectProgressHandler.RunSimulation)
 				projects.POST("/:id/complete", projectProgressHandler.CompleteProject)
+
+				// Project code workspace
+				projects.GET("/:id/code/files/*path", projectCodeHandler.GetFile)
+				projects.PUT("/:id/code/files/*path", projectCodeHandler.SaveFile)
+				projects.PATCH("/:id/code/files/*path", projectCodeHandler.UpdateFile)
+				projects.DELETE("/:id/code/files/*path", projectCodeHandler.DeleteFile)
+				projects.POST("/:id/code/folders", projectCodeHandler.CreateFolder)
+				projects.DELETE("/:id/code/folders/*path", projectCodeHandler.DeleteFolder)
+				projects.PUT("/:id/code/main", projectCodeHandler.SetMainFile)
+				projects.POST("/:id/code/analyze", projectCodeHandler.AnalyzeCode)
+
+				// Project version history
+				projects.GET("/:id/versions", projectVersionHandler.ListVersions)
+				projects.POST("/:id/versions", projectVersionHandler.CreateCheckpoint)
+				projects.GET("/:id/versions/diff", projectVersionHandler.DiffVersions)
+				projects.GET("/:id/versions/:versionId", projectVersionHandler.GetVersion)
+				projects.PUT("/:id/versions/:versionId", projectVersionHandler.UpdateVersion)
+				projects.POST("/:id/versions/:versionId/restore", projectVersionHandler.RestoreVersion)
 			}
 
 			// ======== COMPONENT ROUTES ========
@@ -215,8 +255,13 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 				components.GET("/favorites", componentHandler.GetFavorites)
 				components.GET("/requests", componentHandler.GetUserRequests)
 				components.POST("/request", componentHandler.CreateRequest)
+				components.GET("/models", componentHandler.ListModels)
+				components.POST("/models", componentHandler.UploadModel)
+				components.GET("/models/:name", componentHandler.GetModel)
+				components.DELETE("/models/:name", componentHandler.DeleteModel)
 				components.GET("/:id", componentHandler.GetComponent)
 				components.POST("/:id/favorite", componentHandler.ToggleFavorite)
+				components.PUT("/:id/model", componentHandler.AssignModel)
 			}
 
 			// ======== CHALLENGE ROUTES ========
@@ -277,6 +322,10 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 				labs.POST("/:id/code/submit", labHandler.SubmitCode)
 				labs.GET("/:id/code/status/:compilation_id", labHandler.GetCompilationStatus)
 
+				// Deployment to hardware
+				labs.POST("/:id/deploy", labHandler.DeployToLab)
+				labs.GET("/deployments/:deploymentId", labHandler.GetDeploymentComparison)
+
 				// Sensor/Actuator control
 				labs.GET("/:id/sensors", labHandler.GetSensors)
 				labs.POST("/:id/actuators/control", labHandler.ControlActuator)
@@ -290,12 +339,26 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 				circuits.POST("", circuitHandler.CreateCircuit)
 				circuits.GET("/templates", circuitHandler.ListTemplates)
 				circuits.POST("/templates/:id/use", circuitHandler.UseTemplate)
+				circuits.POST("/import/wokwi", circuitHandler.ImportWokwi)
+				circuits.GET("/explore", circuitHandler.ExploreCircuits)
+				circuits.GET("/explore/tags", circuitHandler.ListGalleryTags)
 				circuits.GET("/:id", circuitHandler.GetCircuit)
 				circuits.PUT("/:id", circuitHandler.UpdateCircuit)
 				circuits.DELETE("/:id", circuitHandler.DeleteCircuit)
 				circuits.POST("/:id/duplicate", circuitHandler.DuplicateCircuit)
+				circuits.POST("/:id/fork", circuitHandler.DuplicateCircuit)
+				circuits.GET("/:id/forks", circuitHandler.ListForks)
+				circuits.POST("/:id/star", circuitHandler.ToggleStar)
 				circuits.POST("/:id/thumbnail", circuitHandler.UploadThumbnail)
+				circuits.GET("/:id/preview", circuitHandler.GetPreview)
 				circuits.GET("/:id/export", circuitHandler.ExportCircuit)
+				circuits.GET("/:id/bom", bomHandler.GetCircuitBOM)
+
+				// Revision history
+				circuits.GET("/:id/revisions", circuitHandler.ListRevisions)
+				circuits.GET("/:id/revisions/diff", circuitHandler.DiffRevisions)
+				circuits.GET("/:id/revisions/:revisionId", circuitHandler.GetRevision)
+				circuits.POST("/:id/revisions/:revisionId/restore", circuitHandler.RestoreRevision)
 			}
 
 			// ======== SIMULATION ROUTES ========
@@ -310,6 +373,13 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 				simulations.POST("/:id/run", simulationHandler.RunSimulation)
 				simulations.POST("/:id/stop", simulationHandler.StopSimulation)
 				simulations.GET("/:id/runs", simulationHandler.GetRuns)
+				simulations.GET("/:id/runs/compare", simulationHandler.CompareRuns)
+				simulations.PUT("/:id/golden", simulationHandler.SetGoldenRun)
+				simulations.DELETE("/:id/golden", simulationHandler.ClearGoldenRun)
+				simulations.GET("/:id/runs/:runId/variants", simulationHandler.GetRunVariants)
+				simulations.GET("/:id/runs/:runId/waveform", simulationHandler.GetRunWaveform)
+				simulations.GET("/:id/runs/:runId/vcd", simulationHandler.GetRunVCD)
+				simulations.GET("/:id/runs/:runId/export", simulationHandler.ExportRun)
 				simulations.POST("/:id/result", simulationHandler.SaveResult)
 			}
 		}
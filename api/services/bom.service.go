@@ -0,0 +1,373 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"nexfi-backend/api/repositories"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/simulator"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BOMCurrency is the currency of catalog prices
+const BOMCurrency = "IDR"
+
+// virtualPartTypes are schema parts that are not bought (references, probes, labels)
+var virtualPartTypes = map[string]bool{
+	"ground":    true,
+	"gnd":       true,
+	"junction":  true,
+	"probe":     true,
+	"label":     true,
+	"net_label": true,
+}
+
+// bomValueProperties are the properties that distinguish otherwise identical parts, with their unit
+var bomValueProperties = []struct {
+	key  string
+	unit string
+}{
+	{"resistance", "Ω"},
+	{"capacitance", "F"},
+	{"inductance", "H"},
+	{"voltage", "V"},
+	{"color", ""},
+}
+
+// BOMService builds bills of materials from circuit and project schemas
+type BOMService struct {
+	circuitRepo   *repositories.CircuitRepository
+	projectRepo   *repositories.ProjectRepository
+	componentRepo *repositories.ComponentRepository
+}
+
+// NewBOMService creates a new BOMService
+func NewBOMService(db *gorm.DB) *BOMService {
+	return &BOMService{
+		circuitRepo:   repositories.NewCircuitRepository(db),
+		projectRepo:   repositories.NewProjectRepository(db),
+		componentRepo: repositories.NewComponentRepository(db),
+	}
+}
+
+// GetCircuitBOM builds the bill of materials of a circuit
+func (s *BOMService) GetCircuitBOM(circuitID, userID string) (*dto.BOMResponse, error) {
+	circuit, err := s.circuitRepo.FindByID(circuitID)
+	if err != nil {
+		return nil, errors.New("circuit not found")
+	}
+	if circuit.UserID != userID && !circuit.IsPublic {
+		return nil, errors.New("access denied")
+	}
+
+	schema, err := schematic.Parse(circuit.SchemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+
+	bom, err := s.build(schema.Components, nil)
+	if err != nil {
+		return nil, err
+	}
+	bom.SourceType = "circuit"
+	bom.SourceID = circuit.ID
+	bom.SourceName = circuit.Name
+
+	return bom, nil
+}
+
+// GetProjectBOM builds the bill of materials of a project from its schema and declared components
+func (s *BOMService) GetProjectBOM(projectID, userID string) (*dto.BOMResponse, error) {
+	project, err := s.projectRepo.FindByID(projectID)
+	if err != nil {
+		return nil, errors.New("project not found")
+	}
+
+	if err := checkProjectPermission(s.projectRepo, project, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
+	schema, err := schematic.Parse(project.SchemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+
+	bom, err := s.build(schema.Components, project.Components)
+	if err != nil {
+		return nil, err
+	}
+	bom.SourceType = "project"
+	bom.SourceID = project.ID
+	bom.SourceName = project.Name
+
+	return bom, nil
+}
+
+// build resolves schema parts against the catalog and groups them into BOM lines.
+// Parts resolve through properties.catalog_component_id first, then through the
+// catalog's simulation_model. Declared project components only add lines for
+// catalog parts the schema does not already use.
+func (s *BOMService) build(parts []schematic.Component, declared []models.ProjectComponent) (*dto.BOMResponse, error) {
+	catalog, err := s.loadCatalog(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := map[string]*dto.BOMItem{}
+	order := []string{}
+	usedCatalogIDs := map[string]bool{}
+
+	for _, part := range parts {
+		if virtualPartTypes[strings.ToLower(part.Type)] {
+			continue
+		}
+
+		value := bomValue(&part)
+		catalogComp := catalog.resolve(&part)
+
+		key := "type:" + part.Type + "|" + value
+		if catalogComp != nil {
+			key = "catalog:" + catalogComp.ID + "|" + value
+			usedCatalogIDs[catalogComp.ID] = true
+		}
+
+		line, exists := lines[key]
+		if !exists {
+			line = newBOMItem(part.Type, value, catalogComp)
+			lines[key] = line
+			order = append(order, key)
+		}
+
+		line.Quantity++
+		designator := part.Name
+		if designator == "" {
+			designator = part.ID
+		}
+		line.Designators = append(line.Designators, designator)
+	}
+
+	for _, pc := range declared {
+		if pc.Component == nil || usedCatalogIDs[pc.ComponentID] {
+			continue
+		}
+		key := "catalog:" + pc.ComponentID + "|"
+		line, exists := lines[key]
+		if !exists {
+			line = newBOMItem(pc.Component.SimulationModel, "", pc.Component)
+			lines[key] = line
+			order = append(order, key)
+		}
+		quantity := pc.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+		line.Quantity += quantity
+	}
+
+	bom := &dto.BOMResponse{
+		Items:       make([]dto.BOMItem, 0, len(order)),
+		Currency:    BOMCurrency,
+		GeneratedAt: time.Now(),
+	}
+
+	for _, key := range order {
+		line := lines[key]
+		sortDesignators(line.Designators)
+		line.Subtotal = line.UnitPrice * float64(line.Quantity)
+		line.StockStatus = stockStatus(line)
+
+		bom.TotalParts += line.Quantity
+		bom.TotalCost += line.Subtotal
+		switch line.StockStatus {
+		case dto.BOMOutOfStock:
+			bom.OutOfStockCount++
+		case dto.BOMLowStock:
+			bom.LowStockCount++
+		case dto.BOMNotInCatalog:
+			bom.UnresolvedCount++
+		}
+
+		bom.Items = append(bom.Items, *line)
+	}
+	bom.UniqueParts = len(bom.Items)
+
+	sort.SliceStable(bom.Items, func(i, j int) bool {
+		if bom.Items[i].Type != bom.Items[j].Type {
+			return bom.Items[i].Type < bom.Items[j].Type
+		}
+		return bom.Items[i].Value < bom.Items[j].Value
+	})
+
+	return bom, nil
+}
+
+// ToCSV renders a BOM as CSV, ending with a total row
+func (s *BOMService) ToCSV(bom *dto.BOMResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{
+		"Designators", "Quantity", "Name", "Value", "Part Number", "Manufacturer",
+		"Unit Price (" + bom.Currency + ")", "Subtotal (" + bom.Currency + ")", "Stock", "Stock Status", "Datasheet",
+	})
+
+	for _, item := range bom.Items {
+		w.Write([]string{
+			simulator.CSVText(strings.Join(item.Designators, " ")),
+			strconv.Itoa(item.Quantity),
+			simulator.CSVText(item.Name),
+			simulator.CSVText(item.Value),
+			simulator.CSVText(item.PartNumber),
+			simulator.CSVText(item.Manufacturer),
+			formatPrice(item.UnitPrice),
+			formatPrice(item.Subtotal),
+			strconv.Itoa(item.Stock),
+			string(item.StockStatus),
+			simulator.CSVText(item.DatasheetURL),
+		})
+	}
+
+	w.Write([]string{"", strconv.Itoa(bom.TotalParts), "Total", "", "", "", "", formatPrice(bom.TotalCost), "", "", ""})
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+// ============================================
+// Helper Functions
+// ============================================
+
+// bomCatalog indexes the catalog entries a schema can resolve to
+type bomCatalog struct {
+	byID         map[string]*models.Component
+	bySimulation map[string]*models.Component
+}
+
+func (s *BOMService) loadCatalog(parts []schematic.Component) (*bomCatalog, error) {
+	ids := []string{}
+	types := []string{}
+	for _, part := range parts {
+		if id, ok := part.Properties["catalog_component_id"].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+		types = append(types, partModel(part))
+	}
+
+	catalog := &bomCatalog{
+		byID:         map[string]*models.Component{},
+		bySimulation: map[string]*models.Component{},
+	}
+
+	linked, err := s.componentRepo.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range linked {
+		catalog.byID[linked[i].ID] = &linked[i]
+	}
+
+	// Ordered by stock, so the first entry per model is the one most likely available
+	bySimModel, err := s.componentRepo.FindBySimulationModels(types)
+	if err != nil {
+		return nil, err
+	}
+	for i := range bySimModel {
+		if _, exists := catalog.bySimulation[bySimModel[i].SimulationModel]; !exists {
+			catalog.bySimulation[bySimModel[i].SimulationModel] = &bySimModel[i]
+		}
+	}
+
+	return catalog, nil
+}
+
+func (c *bomCatalog) resolve(part *schematic.Component) *models.Component {
+	if id, ok := part.Properties["catalog_component_id"].(string); ok {
+		if comp, exists := c.byID[id]; exists {
+			return comp
+		}
+	}
+	return c.bySimulation[partModel(*part)]
+}
+
+func newBOMItem(partType, value string, comp *models.Component) *dto.BOMItem {
+	item := &dto.BOMItem{
+		Name:        partType,
+		Type:        partType,
+		Value:       value,
+		Designators: []string{},
+	}
+	if comp != nil {
+		id := comp.ID
+		item.ComponentID = &id
+		item.Name = comp.Name
+		item.PartNumber = comp.PartNumber
+		item.Manufacturer = comp.Manufacturer
+		item.DatasheetURL = comp.DatasheetURL
+		item.ImageURL = comp.ImageURL
+		item.UnitPrice = comp.Price
+		item.Stock = comp.Stock
+	}
+	return item
+}
+
+// bomValue returns the value that tells apart parts of the same type, e.g. "220Ω"
+func bomValue(part *schematic.Component) string {
+	for _, prop := range bomValueProperties {
+		raw, ok := part.Properties[prop.key]
+		if !ok {
+			continue
+		}
+		if prop.unit != "" {
+			if v, ok := part.Float(prop.key); ok {
+				return schematic.FormatValue(v, prop.unit)
+			}
+		}
+		return fmt.Sprint(raw)
+	}
+	return ""
+}
+
+func stockStatus(item *dto.BOMItem) dto.BOMStockStatus {
+	switch {
+	case item.ComponentID == nil:
+		return dto.BOMNotInCatalog
+	case item.Stock <= 0:
+		return dto.BOMOutOfStock
+	case item.Stock < item.Quantity:
+		return dto.BOMLowStock
+	}
+	return dto.BOMInStock
+}
+
+// sortDesignators orders designators naturally (R2 before R10)
+func sortDesignators(designators []string) {
+	split := func(s string) (string, int) {
+		i := len(s)
+		for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+			i--
+		}
+		n, _ := strconv.Atoi(s[i:])
+		return s[:i], n
+	}
+	sort.SliceStable(designators, func(i, j int) bool {
+		pi, ni := split(designators[i])
+		pj, nj := split(designators[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return ni < nj
+	})
+}
+
+func formatPrice(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
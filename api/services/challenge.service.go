@@ -1,10 +1,14 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"nexfi-backend/api/repositories"
 	"nexfi-backend/dto"
 	"nexfi-backend/models"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/simulator"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,6 +19,7 @@ type ChallengeService struct {
 	repo      *repositories.ChallengeRepository
 	userRepo  *repositories.UserRepository
 	gamifRepo *repositories.GamificationRepository
+	simRepo   *repositories.SimulationRepository
 }
 
 // NewChallengeService creates a new ChallengeService
@@ -23,6 +28,7 @@ func NewChallengeService(db *gorm.DB) *ChallengeService {
 		repo:      repositories.NewChallengeRepository(db),
 		userRepo:  repositories.NewUserRepository(db),
 		gamifRepo: repositories.NewGamificationRepository(db),
+		simRepo:   repositories.NewSimulationRepository(db),
 	}
 }
 
@@ -178,6 +184,23 @@ func (s *ChallengeService) SubmitChallenge(challengeID, userID string, req dto.S
 	progress.SubmissionData = req.SubmissionData
 	progress.Feedback = req.Notes
 
+	// Auto-graded challenges only complete once the submitted circuit passes
+	grade, err := s.gradeSubmission(challenge, userID, req.SubmissionData)
+	if err != nil {
+		return nil, err
+	}
+	if grade != nil && !grade.Passed {
+		progress.Feedback = grade.Feedback
+		if err := s.repo.UpdateProgress(progress); err != nil {
+			return nil, err
+		}
+		return &dto.SubmitChallengeResponse{
+			Passed:               false,
+			AchievementsUnlocked: []dto.AchievementResponse{},
+			Grade:                grade,
+		}, nil
+	}
+
 	// Calculate XP (could add bonus logic here)
 	baseXP := challenge.XPReward
 	bonusXP := 0
@@ -207,15 +230,100 @@ func (s *ChallengeService) SubmitChallenge(challengeID, userID string, req dto.S
 	// In a real implementation, we'd check achievement criteria here
 
 	return &dto.SubmitChallengeResponse{
+		Passed:               true,
 		XPEarned:             baseXP,
 		BonusXP:              bonusXP,
 		TotalXP:              totalXP,
 		NewLevel:             user.Level,
 		LevelUp:              levelUp,
 		AchievementsUnlocked: unlockedAchievements,
+		Grade:                grade,
 	}, nil
 }
 
+// logicCriteria is the validation criteria of a logic exercise: the
+// digital options of the "digital" simulation settings block, with
+// expected outputs in the vectors
+type logicCriteria struct {
+	Type string `json:"type"`
+}
+
+// logicSubmission names the circuit a submission is graded on
+type logicSubmission struct {
+	SchemaData   json.RawMessage `json:"schema_data"`
+	SimulationID string          `json:"simulation_id"`
+}
+
+// gradeSubmission simulates the submitted circuit against the challenge's
+// validation criteria. Challenges without auto-grading return nil.
+func (s *ChallengeService) gradeSubmission(challenge *models.Challenge, userID string, submission []byte) (*dto.ChallengeGrade, error) {
+	var criteria logicCriteria
+	if json.Unmarshal(challenge.ValidationCriteria, &criteria) != nil || criteria.Type != "logic" {
+		return nil, nil
+	}
+
+	settingsJSON, _ := json.Marshal(map[string]json.RawMessage{"digital": json.RawMessage(challenge.ValidationCriteria)})
+	settings, err := simulator.ParseSettings(settingsJSON)
+	if err != nil {
+		return nil, errors.New("challenge has invalid validation criteria")
+	}
+
+	var sub logicSubmission
+	if err := json.Unmarshal(submission, &sub); err != nil {
+		return nil, errors.New("submission must contain schema_data or simulation_id")
+	}
+	schemaData := []byte(sub.SchemaData)
+	switch {
+	case sub.SimulationID != "":
+		simulation, err := s.simRepo.FindByID(sub.SimulationID)
+		if err != nil || simulation.UserID != userID {
+			return nil, errors.New("simulation not found")
+		}
+		schemaData = simulation.SchemaData
+	case len(schemaData) == 0:
+		return nil, errors.New("submission must contain schema_data or simulation_id")
+	}
+
+	schema, err := schematic.Parse(schemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+
+	result := simulator.AnalyzeDigital(schema, settings.Digital)
+	grade := &dto.ChallengeGrade{
+		Passed:     result.Works() && result.TruthTable != nil && result.TruthTable.Verified != nil,
+		TruthTable: result.TruthTable,
+		Errors:     result.Errors,
+		Warnings:   result.Warnings,
+	}
+	if table := result.TruthTable; table != nil && len(table.Rows) > 0 {
+		grade.Score = table.Passed * 100 / len(table.Rows)
+	}
+	grade.Feedback = gradeFeedback(grade)
+	return grade, nil
+}
+
+// gradeFeedback explains a grade in one sentence
+func gradeFeedback(grade *dto.ChallengeGrade) string {
+	if grade.Passed {
+		return "All test vectors passed"
+	}
+	if len(grade.Errors) > 0 {
+		return grade.Errors[0].Message
+	}
+	table := grade.TruthTable
+	if table == nil || table.Verified == nil {
+		return "The circuit could not be checked against the expected outputs"
+	}
+	for _, row := range table.Rows {
+		if row.Pass != nil && !*row.Pass {
+			return fmt.Sprintf("%d of %d test vectors failed; inputs %s gave %s, expected %s",
+				table.Failed, len(table.Rows), row.Inputs, row.Outputs, row.Expected)
+		}
+	}
+	return "Not every test vector was applied"
+}
+
 // GetUserProgress gets user's challenge progress list
 func (s *ChallengeService) GetUserProgress(userID, status string, page, limit int) ([]dto.ChallengeProgressResponse, dto.PaginationResponse, error) {
 	progresses, total, err := s.repo.GetUserProgressList(userID, status, page, limit)
@@ -1,34 +1,42 @@
 package services
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"nexfi-backend/api/repositories"
 	"nexfi-backend/dto"
 	"nexfi-backend/models"
+	"nexfi-backend/pkg/rabbitmq"
+	"nexfi-backend/pkg/schematic"
 	"nexfi-backend/pkg/storage"
-	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/lib/pq"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 // CircuitService handles circuit business logic
 type CircuitService struct {
-	repo     *repositories.CircuitRepository
-	userRepo *repositories.UserRepository
-	db       *gorm.DB
+	repo          *repositories.CircuitRepository
+	userRepo      *repositories.UserRepository
+	componentRepo *repositories.ComponentRepository
+	db            *gorm.DB
 }
 
 // NewCircuitService creates a new CircuitService
 func NewCircuitService(db *gorm.DB) *CircuitService {
 	return &CircuitService{
-		repo:     repositories.NewCircuitRepository(db),
-		userRepo: repositories.NewUserRepository(db),
-		db:       db,
+		repo:          repositories.NewCircuitRepository(db),
+		userRepo:      repositories.NewUserRepository(db),
+		componentRepo: repositories.NewComponentRepository(db),
+		db:            db,
 	}
 }
 
@@ -70,11 +78,22 @@ func (s *CircuitService) GetCircuit(circuitID, userID string) (*dto.CircuitDetai
 		return nil, errors.New("access denied")
 	}
 
-	return s.toCircuitDetailResponse(circuit), nil
+	circuit.SchemaData = upgradeSchemaData(circuit.SchemaData)
+
+	resp := s.toCircuitDetailResponse(circuit)
+	resp.IsStarred = s.repo.FindStarredIDs(userID, []string{circuit.ID})[circuit.ID]
+
+	return resp, nil
 }
 
 // CreateCircuit creates a new circuit
 func (s *CircuitService) CreateCircuit(userID string, req dto.CreateCircuitRequest) (*dto.CircuitResponse, int, error) {
+	schemaData, err := normalizeSchemaData(req.SchemaData)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.SchemaData = schemaData
+
 	// Parse schema to count components and wires
 	componentsCount, wiresCount := s.countSchemaElements(req.SchemaData)
 
@@ -86,11 +105,13 @@ func (s *CircuitService) CreateCircuit(userID string, req dto.CreateCircuitReque
 		SchemaData:      req.SchemaData,
 		ComponentsCount: componentsCount,
 		WiresCount:      wiresCount,
+		Tags:            normalizeTags(req.Tags),
 	}
 
-	if err := s.repo.Create(circuit); err != nil {
+	if err := s.repo.CreateWithRevision(circuit, newRevision(circuit, userID, "Initial version", nil)); err != nil {
 		return nil, 0, err
 	}
+	s.queueThumbnail(circuit.ID)
 
 	// Award XP for first circuit
 	xpEarned := 10 // Base XP for creating circuit
@@ -110,24 +131,59 @@ func (s *CircuitService) UpdateCircuit(circuitID, userID string, req dto.UpdateC
 		return nil, errors.New("access denied")
 	}
 
+	if req.SchemaData != nil {
+		schemaData, err := normalizeSchemaData(req.SchemaData)
+		if err != nil {
+			return nil, err
+		}
+		req.SchemaData = schemaData
+	}
+
 	if req.Name != "" {
 		circuit.Name = req.Name
 	}
 	if req.Description != "" {
 		circuit.Description = req.Description
 	}
+	schemaChanged := false
 	if req.SchemaData != nil {
+		schemaChanged = circuit.ThumbnailURL == "" || !bytes.Equal(withoutSaveTime(circuit.SchemaData), withoutSaveTime(req.SchemaData))
+
+		// Circuits created before revision history existed get their current state preserved first
+		if err := s.ensureBaselineRevision(circuit); err != nil {
+			return nil, err
+		}
+
 		circuit.SchemaData = req.SchemaData
 		circuit.ComponentsCount, circuit.WiresCount = s.countSchemaElements(req.SchemaData)
 	}
 	if req.IsPublic != nil {
 		circuit.IsPublic = *req.IsPublic
 	}
+	if req.Tags != nil {
+		circuit.Tags = normalizeTags(req.Tags)
+	}
 
-	if err := s.repo.Update(circuit); err != nil {
+	if req.SchemaData == nil {
+		if err := s.repo.Update(circuit); err != nil {
+			return nil, err
+		}
+		return s.toCircuitResponsePtr(circuit), nil
+	}
+
+	message := req.Message
+	if message == "" {
+		message = "Saved"
+	}
+	if err := s.repo.UpdateWithRevision(circuit, newRevision(circuit, userID, message, nil)); err != nil {
 		return nil, err
 	}
 
+	// Keep the preview in sync with the schema
+	if schemaChanged {
+		s.queueThumbnail(circuit.ID)
+	}
+
 	return s.toCircuitResponsePtr(circuit), nil
 }
 
@@ -144,7 +200,8 @@ func (s *CircuitService) DeleteCircuit(circuitID, userID string) error {
 	return s.repo.Delete(circuitID)
 }
 
-// DuplicateCircuit duplicates a circuit
+// DuplicateCircuit duplicates a circuit; a copy of another user's circuit
+// is a fork and keeps a link to the original
 func (s *CircuitService) DuplicateCircuit(circuitID, userID string) (*dto.CircuitResponse, error) {
 	original, err := s.repo.FindByID(circuitID)
 	if err != nil {
@@ -165,16 +222,32 @@ func (s *CircuitService) DuplicateCircuit(circuitID, userID string) (*dto.Circui
 		ComponentsCount: original.ComponentsCount,
 		WiresCount:      original.WiresCount,
 		IsPublic:        false,
+		Tags:            original.Tags,
+	}
+
+	// Copying your own circuit is not a fork; a fork links to the original,
+	// whose project belongs to its author
+	fork := original.UserID != userID
+	if fork {
+		newCircuit.ForkedFromID = &original.ID
+		newCircuit.ProjectID = nil
 	}
 
-	if err := s.repo.Create(newCircuit); err != nil {
+	if err := s.repo.CreateWithRevision(newCircuit, newRevision(newCircuit, userID, "Duplicated from "+original.Name, nil)); err != nil {
 		return nil, err
 	}
+	s.queueThumbnail(newCircuit.ID)
+
+	if fork {
+		newCircuit.ForkedFrom = original
+		s.repo.IncrementForksCount(original.ID)
+		s.notifyFork(original, newCircuit, userID)
+	}
 
 	return s.toCircuitResponsePtr(newCircuit), nil
 }
 
-// UploadThumbnail uploads circuit thumbnail
+// UploadThumbnail stores a client-supplied thumbnail, or re-renders it server-side when no image is given
 func (s *CircuitService) UploadThumbnail(circuitID, userID string, base64Data string) (string, error) {
 	circuit, err := s.repo.FindByID(circuitID)
 	if err != nil {
@@ -185,41 +258,65 @@ func (s *CircuitService) UploadThumbnail(circuitID, userID string, base64Data st
 		return "", errors.New("access denied")
 	}
 
+	if base64Data == "" {
+		if err := s.refreshThumbnail(circuit); err != nil {
+			return "", err
+		}
+		return circuit.ThumbnailURL, nil
+	}
+
 	// Decode base64 image
 	imageData, err := base64.StdEncoding.DecodeString(base64Data)
 	if err != nil {
 		return "", errors.New("invalid image data")
 	}
-
-	// Save to storage
-	filename := fmt.Sprintf("circuit_%s_thumb.png", circuitID)
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir == "" {
-		uploadDir = "uploads"
+	// Stored as the PNG beside the rendered SVG, so only a PNG will do
+	contentType, err := storage.DetectImageType(imageData)
+	switch {
+	case errors.Is(err, storage.ErrFileTooLarge), errors.Is(err, storage.ErrImageTooLarge):
+		return "", errors.New("image is too large")
+	case err != nil || contentType != "image/png":
+		return "", errors.New("invalid image data")
 	}
-	filepath := fmt.Sprintf("%s/circuits/%s", uploadDir, filename)
 
-	if err := os.MkdirAll(fmt.Sprintf("%s/circuits", uploadDir), 0755); err != nil {
+	thumbnailURL, err := storage.UploadBytes(storage.BucketThumbnails, thumbnailObjectName(circuitID, "png"), imageData, "image/png")
+	if err != nil {
 		return "", err
 	}
+	thumbnailURL = versionedURL(thumbnailURL)
 
-	if err := os.WriteFile(filepath, imageData, 0644); err != nil {
+	if err := s.repo.UpdateThumbnail(circuitID, thumbnailURL); err != nil {
 		return "", err
 	}
 
-	// Update circuit
-	baseURL := os.Getenv("APP_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:8005"
+	return thumbnailURL, nil
+}
+
+// RenderPreview renders the circuit schematic on demand (svg or png)
+func (s *CircuitService) RenderPreview(circuitID, userID, format string) ([]byte, string, error) {
+	circuit, err := s.repo.FindByID(circuitID)
+	if err != nil {
+		return nil, "", errors.New("circuit not found")
 	}
-	thumbnailURL := fmt.Sprintf("%s/%s", baseURL, filepath)
-	circuit.ThumbnailURL = thumbnailURL
 
-	if err := s.repo.Update(circuit); err != nil {
-		return "", err
+	if circuit.UserID != userID && !circuit.IsPublic {
+		return nil, "", errors.New("access denied")
 	}
 
-	return thumbnailURL, nil
+	schema, err := schematic.Parse(circuit.SchemaData)
+	if err != nil {
+		return nil, "", errors.New("invalid schema data")
+	}
+
+	switch format {
+	case "svg":
+		return schematic.RenderSVG(schema, schematic.DefaultRenderOptions()), "image/svg+xml", nil
+	case "png":
+		content, err := schematic.RenderPNG(schema, schematic.DefaultRenderOptions())
+		return content, "image/png", err
+	default:
+		return nil, "", errors.New("unsupported format")
+	}
 }
 
 // ListTemplates lists circuit templates
@@ -271,15 +368,16 @@ func (s *CircuitService) UseTemplate(templateID, userID string, req dto.UseTempl
 		ProjectID:       req.ProjectID,
 		Name:            name,
 		Description:     template.Description,
-		SchemaData:      template.SchemaData,
+		SchemaData:      upgradeSchemaData(template.SchemaData),
 		ComponentsCount: 0, // Will be calculated
 		WiresCount:      0,
 	}
 	circuit.ComponentsCount, circuit.WiresCount = s.countSchemaElements(template.SchemaData)
 
-	if err := s.repo.Create(circuit); err != nil {
+	if err := s.repo.CreateWithRevision(circuit, newRevision(circuit, userID, "Created from template "+template.Name, nil)); err != nil {
 		return nil, 0, err
 	}
+	s.queueThumbnail(circuit.ID)
 
 	// Increment template use count
 	s.repo.IncrementTemplateUseCount(templateID)
@@ -321,21 +419,521 @@ func (s *CircuitService) ExportCircuit(circuitID, userID, format string) (*dto.C
 			Content:  spiceContent,
 		}, nil
 
+	case "wokwi":
+		schema, err := schematic.Parse(circuit.SchemaData)
+		if err != nil {
+			return nil, errors.New("invalid schema data")
+		}
+		author := ""
+		if circuit.User != nil {
+			author = circuit.User.Username
+		}
+		content, report, err := schematic.ToWokwi(schema, author)
+		if err != nil {
+			return nil, err
+		}
+		return &dto.CircuitExportResponse{
+			Format:       "wokwi",
+			Filename:     "diagram.json",
+			Content:      string(content),
+			UnknownParts: toUnknownPartDTOs(report.UnknownParts),
+		}, nil
+
 	default:
 		return nil, errors.New("unsupported format")
 	}
 }
 
+// ImportWokwi creates a circuit from a Wokwi diagram.json
+func (s *CircuitService) ImportWokwi(userID string, req dto.ImportWokwiRequest) (*dto.ImportCircuitResponse, int, error) {
+	schema, report, err := schematic.FromWokwi(req.Diagram)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(schema.Components) == 0 {
+		return nil, 0, errors.New("diagram has no supported parts")
+	}
+
+	s.linkCatalogComponents(schema)
+
+	schemaJSON, err := schema.Marshal()
+	if err != nil {
+		return nil, 0, err
+	}
+	// Validated like any other write, so the import stores what an editor could have saved
+	schemaData, err := normalizeSchemaData(datatypes.JSON(schemaJSON))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	circuit := &models.Circuit{
+		UserID:          userID,
+		ProjectID:       req.ProjectID,
+		Name:            req.Name,
+		Description:     req.Description,
+		SchemaData:      schemaData,
+		ComponentsCount: len(schema.Components),
+		WiresCount:      len(schema.Wires),
+	}
+
+	if err := s.repo.CreateWithRevision(circuit, newRevision(circuit, userID, "Imported from Wokwi", nil)); err != nil {
+		return nil, 0, err
+	}
+	s.queueThumbnail(circuit.ID)
+
+	xpEarned := 10 // Same as creating a circuit from scratch
+	s.awardXP(userID, xpEarned, circuit.ID, "circuit_import")
+
+	return &dto.ImportCircuitResponse{
+		Circuit:            s.toCircuitResponsePtr(circuit),
+		UnknownParts:       toUnknownPartDTOs(report.UnknownParts),
+		SkippedConnections: report.SkippedConnections,
+	}, xpEarned, nil
+}
+
+// ============================================
+// Revision History
+// ============================================
+
+// ListRevisions lists a circuit's revisions, newest first
+func (s *CircuitService) ListRevisions(circuitID, userID string, req dto.CircuitRevisionListRequest) ([]dto.CircuitRevisionResponse, dto.PaginationResponse, error) {
+	if _, err := s.findReadableCircuit(circuitID, userID); err != nil {
+		return nil, dto.PaginationResponse{}, err
+	}
+
+	revisions, total, err := s.repo.FindRevisions(circuitID, req.Page, req.Limit)
+	if err != nil {
+		return nil, dto.PaginationResponse{}, err
+	}
+
+	responses := make([]dto.CircuitRevisionResponse, len(revisions))
+	for i := range revisions {
+		responses[i] = s.toRevisionResponse(&revisions[i])
+	}
+
+	return responses, dto.PaginationResponse{
+		Page:       req.Page,
+		Limit:      req.Limit,
+		Total:      int(total),
+		TotalPages: (int(total) + req.Limit - 1) / req.Limit,
+	}, nil
+}
+
+// GetRevision gets a single revision including its schema
+func (s *CircuitService) GetRevision(circuitID, revisionID, userID string) (*dto.CircuitRevisionDetailResponse, error) {
+	if _, err := s.findReadableCircuit(circuitID, userID); err != nil {
+		return nil, err
+	}
+
+	revision, err := s.repo.FindRevisionByID(circuitID, revisionID)
+	if err != nil {
+		return nil, errors.New("revision not found")
+	}
+
+	return &dto.CircuitRevisionDetailResponse{
+		CircuitRevisionResponse: s.toRevisionResponse(revision),
+		SchemaData:              upgradeSchemaData(revision.SchemaData),
+	}, nil
+}
+
+// DiffRevisions returns a structural diff between two revisions
+func (s *CircuitService) DiffRevisions(circuitID, userID string, req dto.CircuitRevisionDiffRequest) (*dto.CircuitRevisionDiffResponse, error) {
+	if _, err := s.findReadableCircuit(circuitID, userID); err != nil {
+		return nil, err
+	}
+
+	from, err := s.repo.FindRevisionByID(circuitID, req.From)
+	if err != nil {
+		return nil, errors.New("revision not found")
+	}
+
+	var to *models.CircuitRevision
+	if req.To != "" {
+		to, err = s.repo.FindRevisionByID(circuitID, req.To)
+	} else {
+		to, err = s.repo.FindLatestRevision(circuitID)
+	}
+	if err != nil {
+		return nil, errors.New("revision not found")
+	}
+
+	fromSchema, err := schematic.Parse(from.SchemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+	toSchema, err := schematic.Parse(to.SchemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+
+	fromResp := s.toRevisionResponse(from)
+	toResp := s.toRevisionResponse(to)
+	return &dto.CircuitRevisionDiffResponse{
+		From: &fromResp,
+		To:   &toResp,
+		Diff: schematic.Diff(fromSchema, toSchema),
+	}, nil
+}
+
+// RestoreRevision makes an old revision current again by saving it as a new revision
+func (s *CircuitService) RestoreRevision(circuitID, revisionID, userID string, req dto.RestoreRevisionRequest) (*dto.CircuitRevisionResponse, error) {
+	circuit, err := s.repo.FindByID(circuitID)
+	if err != nil {
+		return nil, errors.New("circuit not found")
+	}
+
+	if circuit.UserID != userID {
+		return nil, errors.New("access denied")
+	}
+
+	revision, err := s.repo.FindRevisionByID(circuitID, revisionID)
+	if err != nil {
+		return nil, errors.New("revision not found")
+	}
+
+	schemaData := upgradeSchemaData(revision.SchemaData)
+	schemaChanged := !bytes.Equal(withoutSaveTime(circuit.SchemaData), withoutSaveTime(schemaData))
+	circuit.SchemaData = schemaData
+	circuit.ComponentsCount = revision.ComponentsCount
+	circuit.WiresCount = revision.WiresCount
+
+	message := req.Message
+	if message == "" {
+		message = fmt.Sprintf("Restored revision %d", revision.RevisionNumber)
+	}
+	restored := newRevision(circuit, userID, message, &revision.ID)
+	if err := s.repo.UpdateWithRevision(circuit, restored); err != nil {
+		return nil, err
+	}
+	if schemaChanged {
+		s.queueThumbnail(circuit.ID)
+	}
+
+	resp := s.toRevisionResponse(restored)
+	return &resp, nil
+}
+
+// ============================================
+// Public Gallery
+// ============================================
+
+// ExploreCircuits lists public circuits for the community gallery
+func (s *CircuitService) ExploreCircuits(userID string, req dto.CircuitExploreRequest) ([]dto.CircuitResponse, dto.PaginationResponse, error) {
+	filter := repositories.ExploreFilter{
+		Search: req.Search,
+		Tag:    strings.ToLower(strings.TrimSpace(req.Tag)),
+		UserID: req.AuthorID,
+	}
+
+	circuits, total, err := s.repo.FindPublic(filter, req.Sort, req.Page, req.Limit)
+	if err != nil {
+		return nil, dto.PaginationResponse{}, err
+	}
+
+	return s.toGalleryResponses(userID, circuits), dto.PaginationResponse{
+		Page:       req.Page,
+		Limit:      req.Limit,
+		Total:      int(total),
+		TotalPages: (int(total) + req.Limit - 1) / req.Limit,
+	}, nil
+}
+
+// ListGalleryTags lists the most used tags of public circuits
+func (s *CircuitService) ListGalleryTags(limit int) ([]repositories.TagCount, error) {
+	return s.repo.FindPublicTags(limit)
+}
+
+// ListForks lists public forks of a circuit
+func (s *CircuitService) ListForks(circuitID, userID string, page, limit int) ([]dto.CircuitResponse, dto.PaginationResponse, error) {
+	if _, err := s.findReadableCircuit(circuitID, userID); err != nil {
+		return nil, dto.PaginationResponse{}, err
+	}
+
+	circuits, total, err := s.repo.FindForks(circuitID, page, limit)
+	if err != nil {
+		return nil, dto.PaginationResponse{}, err
+	}
+
+	return s.toGalleryResponses(userID, circuits), dto.PaginationResponse{
+		Page:       page,
+		Limit:      limit,
+		Total:      int(total),
+		TotalPages: (int(total) + limit - 1) / limit,
+	}, nil
+}
+
+// ToggleStar stars or unstars a circuit
+func (s *CircuitService) ToggleStar(circuitID, userID string) (*dto.CircuitStarResponse, error) {
+	if _, err := s.findReadableCircuit(circuitID, userID); err != nil {
+		return nil, err
+	}
+
+	starred, err := s.repo.ToggleStar(circuitID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	circuit, err := s.repo.FindByID(circuitID)
+	if err != nil {
+		return nil, errors.New("circuit not found")
+	}
+
+	return &dto.CircuitStarResponse{
+		IsStarred:  starred,
+		StarsCount: circuit.StarsCount,
+	}, nil
+}
+
+// notifyFork tells the author that their circuit was forked
+func (s *CircuitService) notifyFork(original, fork *models.Circuit, forkerID string) {
+	forkerName := "Someone"
+	if forker, err := s.userRepo.FindByID(forkerID); err == nil {
+		forkerName = forker.Name
+	}
+
+	job := rabbitmq.NotificationJob{
+		UserID:  original.UserID,
+		Type:    string(models.NotifSocial),
+		Title:   "Your circuit was forked",
+		Message: fmt.Sprintf("%s forked your circuit \"%s\".", forkerName, original.Name),
+		Data: map[string]interface{}{
+			"circuit_id": original.ID,
+			"fork_id":    fork.ID,
+			"user_id":    forkerID,
+		},
+	}
+
+	if err := rabbitmq.PublishNotification(job); err != nil {
+		// Queue unavailable, store the notification directly
+		data, _ := json.Marshal(job.Data)
+		s.db.Create(&models.Notification{
+			UserID:  job.UserID,
+			Type:    models.NotifSocial,
+			Title:   job.Title,
+			Message: job.Message,
+			Data:    data,
+		})
+	}
+}
+
 // ============================================
 // Helper Functions
 // ============================================
 
+// toGalleryResponses converts circuits and marks the ones the user has starred
+func (s *CircuitService) toGalleryResponses(userID string, circuits []models.Circuit) []dto.CircuitResponse {
+	ids := make([]string, len(circuits))
+	for i, c := range circuits {
+		ids[i] = c.ID
+	}
+	starred := s.repo.FindStarredIDs(userID, ids)
+
+	responses := make([]dto.CircuitResponse, len(circuits))
+	for i, c := range circuits {
+		responses[i] = s.toCircuitResponse(&c)
+		responses[i].IsStarred = starred[c.ID]
+	}
+	return responses
+}
+
+// normalizeTags lowercases, trims and de-duplicates tags
+func normalizeTags(tags []string) pq.StringArray {
+	result := pq.StringArray{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// findReadableCircuit loads a circuit the user owns or that is public
+func (s *CircuitService) findReadableCircuit(circuitID, userID string) (*models.Circuit, error) {
+	circuit, err := s.repo.FindByID(circuitID)
+	if err != nil {
+		return nil, errors.New("circuit not found")
+	}
+	if circuit.UserID != userID && !circuit.IsPublic {
+		return nil, errors.New("access denied")
+	}
+	return circuit, nil
+}
+
+// newRevision snapshots the circuit's current schema as a revision; the
+// repository numbers it when it is stored
+func newRevision(circuit *models.Circuit, userID, message string, restoredFromID *string) *models.CircuitRevision {
+	return &models.CircuitRevision{
+		CircuitID:       circuit.ID,
+		UserID:          userID,
+		Message:         message,
+		SchemaData:      circuit.SchemaData,
+		ComponentsCount: circuit.ComponentsCount,
+		WiresCount:      circuit.WiresCount,
+		RestoredFromID:  restoredFromID,
+	}
+}
+
+// ensureBaselineRevision snapshots the stored state of a circuit that has no history yet
+func (s *CircuitService) ensureBaselineRevision(circuit *models.Circuit) error {
+	count, err := s.repo.CountRevisions(circuit.ID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return s.repo.CreateRevision(newRevision(circuit, circuit.UserID, "Initial version", nil))
+}
+
+func (s *CircuitService) toRevisionResponse(r *models.CircuitRevision) dto.CircuitRevisionResponse {
+	resp := dto.CircuitRevisionResponse{
+		ID:              r.ID,
+		RevisionNumber:  r.RevisionNumber,
+		Message:         r.Message,
+		AuthorID:        r.UserID,
+		ComponentsCount: r.ComponentsCount,
+		WiresCount:      r.WiresCount,
+		RestoredFromID:  r.RestoredFromID,
+		CreatedAt:       r.CreatedAt,
+	}
+	if r.User != nil {
+		resp.AuthorName = r.User.Name
+	}
+	return resp
+}
+
+// linkCatalogComponents tags schema parts with the catalog component that
+// shares their simulation model: the model a part names, else its type
+func (s *CircuitService) linkCatalogComponents(schema *schematic.Schema) {
+	types := []string{}
+	for _, comp := range schema.Components {
+		types = append(types, partModel(comp))
+	}
+
+	catalog, err := s.componentRepo.FindBySimulationModels(types)
+	if err != nil {
+		return
+	}
+
+	bySimModel := map[string]string{}
+	for _, c := range catalog {
+		if _, exists := bySimModel[c.SimulationModel]; !exists {
+			bySimModel[c.SimulationModel] = c.ID
+		}
+	}
+
+	for i := range schema.Components {
+		if componentID, ok := bySimModel[partModel(schema.Components[i])]; ok {
+			if schema.Components[i].Properties == nil {
+				schema.Components[i].Properties = map[string]interface{}{}
+			}
+			schema.Components[i].Properties["catalog_component_id"] = componentID
+		}
+	}
+}
+
+// partModel is the simulation model a part names, else its type
+func partModel(comp schematic.Component) string {
+	if model, ok := comp.Properties["model"].(string); ok && model != "" {
+		return model
+	}
+	return comp.Type
+}
+
+// thumbnailJobs are the circuits whose thumbnail is being rendered, with
+// whether the circuit was saved again meanwhile and needs another render
+var thumbnailJobs = struct {
+	sync.Mutex
+	again map[string]bool
+}{again: map[string]bool{}}
+
+// queueThumbnail renders a circuit's thumbnail in the background, so saves
+// do not wait for the renderer and storage. Renders of a circuit run one at
+// a time from its stored schema, so an older render never wins.
+func (s *CircuitService) queueThumbnail(circuitID string) {
+	thumbnailJobs.Lock()
+	defer thumbnailJobs.Unlock()
+	if _, running := thumbnailJobs.again[circuitID]; running {
+		thumbnailJobs.again[circuitID] = true
+		return
+	}
+	thumbnailJobs.again[circuitID] = false
+	go s.renderThumbnail(circuitID)
+}
+
+// renderThumbnail runs the thumbnail job of a circuit
+func (s *CircuitService) renderThumbnail(circuitID string) {
+	for {
+		if circuit, err := s.repo.FindByID(circuitID); err == nil {
+			s.refreshThumbnail(circuit)
+		}
+
+		thumbnailJobs.Lock()
+		if !thumbnailJobs.again[circuitID] {
+			delete(thumbnailJobs.again, circuitID)
+			thumbnailJobs.Unlock()
+			return
+		}
+		thumbnailJobs.again[circuitID] = false
+		thumbnailJobs.Unlock()
+	}
+}
+
+// refreshThumbnail renders the schema to SVG and PNG, stores both and points ThumbnailURL at the PNG
+func (s *CircuitService) refreshThumbnail(circuit *models.Circuit) error {
+	schema, err := schematic.Parse(circuit.SchemaData)
+	if err != nil {
+		log.Printf("Warning: circuit %s has invalid schema, thumbnail not rendered: %v", circuit.ID, err)
+		return errors.New("invalid schema data")
+	}
+
+	opts := schematic.DefaultRenderOptions()
+	pngData, err := schematic.RenderPNG(schema, opts)
+	if err != nil {
+		log.Printf("Warning: failed to render thumbnail for circuit %s: %v", circuit.ID, err)
+		return err
+	}
+
+	if _, err := storage.UploadBytes(storage.BucketThumbnails, thumbnailObjectName(circuit.ID, "svg"), schematic.RenderSVG(schema, opts), "image/svg+xml"); err != nil {
+		log.Printf("Warning: failed to store SVG preview for circuit %s: %v", circuit.ID, err)
+	}
+
+	thumbnailURL, err := storage.UploadBytes(storage.BucketThumbnails, thumbnailObjectName(circuit.ID, "png"), pngData, "image/png")
+	if err != nil {
+		log.Printf("Warning: failed to store thumbnail for circuit %s: %v", circuit.ID, err)
+		return err
+	}
+
+	circuit.ThumbnailURL = versionedURL(thumbnailURL)
+	return s.repo.UpdateThumbnail(circuit.ID, circuit.ThumbnailURL)
+}
+
+func thumbnailObjectName(circuitID, ext string) string {
+	return fmt.Sprintf("circuits/%s.%s", circuitID, ext)
+}
+
+// versionedURL busts caches since regenerated thumbnails keep the same object name
+func versionedURL(url string) string {
+	return fmt.Sprintf("%s?v=%d", url, time.Now().Unix())
+}
+
+func toUnknownPartDTOs(parts []schematic.UnknownPart) []dto.CircuitUnknownPart {
+	result := make([]dto.CircuitUnknownPart, len(parts))
+	for i, p := range parts {
+		result[i] = dto.CircuitUnknownPart{ID: p.ID, Type: p.Type}
+	}
+	return result
+}
+
 func (s *CircuitService) countSchemaElements(schemaData datatypes.JSON) (components, wires int) {
-	var schema struct {
-		Components []interface{} `json:"components"`
-		Wires      []interface{} `json:"wires"`
+	schema, err := schematic.Parse(schemaData)
+	if err != nil {
+		return 0, 0
 	}
-	json.Unmarshal(schemaData, &schema)
 	return len(schema.Components), len(schema.Wires)
 }
 
@@ -350,14 +948,38 @@ func (s *CircuitService) toCircuitResponse(c *models.Circuit) dto.CircuitRespons
 		ProjectID:       c.ProjectID,
 		IsTemplate:      c.IsTemplate,
 		IsPublic:        c.IsPublic,
+		Tags:            c.Tags,
+		StarsCount:      c.StarsCount,
+		ForksCount:      c.ForksCount,
+		AuthorID:        c.UserID,
 		CreatedAt:       c.CreatedAt,
 		UpdatedAt:       c.UpdatedAt,
 	}
 
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+
 	if c.Project != nil {
 		resp.ProjectName = c.Project.Name
 	}
 
+	if c.User != nil {
+		resp.AuthorName = c.User.Name
+	}
+
+	if c.ForkedFromID != nil {
+		resp.ForkedFrom = &dto.CircuitSource{ID: *c.ForkedFromID}
+		// Only reveal details of originals that are still visible to the fork's owner
+		if src := c.ForkedFrom; src != nil && (src.IsPublic || src.UserID == c.UserID) {
+			resp.ForkedFrom.Name = src.Name
+			resp.ForkedFrom.AuthorID = src.UserID
+			if src.User != nil {
+				resp.ForkedFrom.AuthorName = src.User.Name
+			}
+		}
+	}
+
 	return resp
 }
 
@@ -436,6 +1058,3 @@ func (s *CircuitService) convertToSPICE(circuit *models.Circuit) string {
 
 	return sb.String()
 }
-
-// Placeholder for storage usage
-var _ = storage.BucketAvatars
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"nexfi-backend/api/repositories"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/simulator"
+	"sort"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ============================================
+// Model Library
+// ============================================
+
+// loadModelLibrary builds the model library the simulator runs with: the
+// built-in models and the active uploaded ones
+func loadModelLibrary(repo *repositories.ComponentRepository) simulator.Library {
+	library := simulator.NewLibrary(simulator.BuiltinModels()...)
+	uploaded, err := repo.FindModels()
+	if err != nil {
+		log.Printf("Failed to load the model library: %v", err)
+		return library
+	}
+	for _, record := range uploaded {
+		if m, ok := decodeModel(&record); ok {
+			if _, builtin := library.Lookup(m.Name); !builtin {
+				library[strings.ToLower(m.Name)] = m
+			}
+		}
+	}
+	return library
+}
+
+// applyModels sets up the parts of a schema with their models. A part
+// linked to a catalog component is simulated with the component's model
+// unless it names a model itself.
+func applyModels(repo *repositories.ComponentRepository, schema *schematic.Schema) []simulator.Issue {
+	library := loadModelLibrary(repo)
+
+	ids := []string{}
+	for _, comp := range schema.Components {
+		if id, ok := comp.Properties["catalog_component_id"].(string); ok && id != "" && comp.Properties["model"] == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		catalog, err := repo.FindByIDs(ids)
+		if err != nil {
+			log.Printf("Failed to load the catalog components of a schema: %v", err)
+		}
+		modelOf := map[string]string{}
+		for _, c := range catalog {
+			// Older components name a part type rather than a model
+			if _, ok := library.Lookup(c.SimulationModel); ok {
+				modelOf[c.ID] = c.SimulationModel
+			}
+		}
+		for i := range schema.Components {
+			comp := &schema.Components[i]
+			id, _ := comp.Properties["catalog_component_id"].(string)
+			if name, ok := modelOf[id]; ok && comp.Properties["model"] == nil {
+				comp.Properties["model"] = name
+			}
+		}
+	}
+
+	return simulator.ApplyModels(schema, library)
+}
+
+// decodeModel reads the definition of an uploaded model
+func decodeModel(record *models.ComponentModel) (*simulator.DeviceModel, bool) {
+	var m simulator.DeviceModel
+	if err := json.Unmarshal(record.Definition, &m); err != nil {
+		log.Printf("Model %s has an invalid definition: %v", record.Name, err)
+		return nil, false
+	}
+	m.Name, m.Device, m.Description = record.Name, record.Device, record.Description
+	return &m, true
+}
+
+// isBuiltinModel reports whether a name is taken by a built-in model
+func isBuiltinModel(name string) bool {
+	_, ok := simulator.NewLibrary(simulator.BuiltinModels()...).Lookup(name)
+	return ok
+}
+
+// ListModels lists the models of the model library, built-in ones first
+func (s *ComponentService) ListModels() ([]dto.ComponentModelResponse, error) {
+	responses := []dto.ComponentModelResponse{}
+	for _, m := range simulator.BuiltinModels() {
+		responses = append(responses, *s.toModelResponse(m, nil))
+	}
+	sort.Slice(responses, func(i, j int) bool { return responses[i].Name < responses[j].Name })
+
+	uploaded, err := s.repo.FindModels()
+	if err != nil {
+		return nil, err
+	}
+	for i := range uploaded {
+		if m, ok := decodeModel(&uploaded[i]); ok && !isBuiltinModel(m.Name) {
+			responses = append(responses, *s.toModelResponse(m, &uploaded[i]))
+		}
+	}
+	return responses, nil
+}
+
+// GetModel gets a model of the model library by name
+func (s *ComponentService) GetModel(name string) (*dto.ComponentModelResponse, error) {
+	for _, m := range simulator.BuiltinModels() {
+		if strings.EqualFold(m.Name, name) {
+			return s.toModelResponse(m, nil), nil
+		}
+	}
+
+	record, err := s.repo.FindModelByName(name)
+	if err != nil || !record.IsActive {
+		return nil, errors.New("model not found")
+	}
+	m, ok := decodeModel(record)
+	if !ok {
+		return nil, errors.New("model not found")
+	}
+	return s.toModelResponse(m, record), nil
+}
+
+// UploadModel adds a model to the model library, or replaces the uploaded
+// model of the same name with a new version. Only admins upload models.
+func (s *ComponentService) UploadModel(userID string, req dto.ComponentModelRequest) (*dto.ComponentModelResponse, error) {
+	if err := s.requireAdmin(userID); err != nil {
+		return nil, err
+	}
+
+	m := &simulator.DeviceModel{
+		Name:        strings.TrimSpace(req.Name),
+		Device:      req.Device,
+		Description: req.Description,
+		Params:      req.Params,
+		Pins:        req.Pins,
+		Defaults:    req.Defaults,
+		Behavior:    req.Behavior,
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if isBuiltinModel(m.Name) {
+		return nil, errors.New("model name is taken by a built-in model")
+	}
+
+	definition, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.repo.FindModelByName(m.Name)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		record = &models.ComponentModel{Name: m.Name, Version: 0}
+	}
+	record.Device = m.Device
+	record.Description = m.Description
+	record.Definition = datatypes.JSON(definition)
+	record.Version++
+	record.IsActive = true
+	record.UploadedBy = &userID
+	if err := s.repo.SaveModel(record); err != nil {
+		return nil, err
+	}
+
+	return s.toModelResponse(m, record), nil
+}
+
+// DeleteModel removes an uploaded model from the model library. Parts
+// that use it are simulated by their type again, with a warning.
+func (s *ComponentService) DeleteModel(userID, name string) error {
+	if err := s.requireAdmin(userID); err != nil {
+		return err
+	}
+	if isBuiltinModel(name) {
+		return errors.New("built-in models cannot be deleted")
+	}
+
+	record, err := s.repo.FindModelByName(name)
+	if err != nil || !record.IsActive {
+		return errors.New("model not found")
+	}
+	record.IsActive = false
+	return s.repo.SaveModel(record)
+}
+
+// AssignModel points a catalog component at a model of the model library,
+// which the parts linked to the component are then simulated with
+func (s *ComponentService) AssignModel(componentID, userID string, req dto.AssignComponentModelRequest) (*dto.ComponentResponse, error) {
+	if err := s.requireAdmin(userID); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindByID(componentID); err != nil {
+		return nil, errors.New("component not found")
+	}
+
+	name := strings.TrimSpace(req.Model)
+	if name != "" {
+		m, err := s.GetModel(name)
+		if err != nil {
+			return nil, err
+		}
+		name = m.Name
+	}
+	if err := s.repo.UpdateSimulationModel(componentID, name); err != nil {
+		return nil, err
+	}
+	return s.GetComponent(componentID, userID)
+}
+
+// requireAdmin checks that a user is an admin
+func (s *ComponentService) requireAdmin(userID string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user.Role != models.RoleAdmin {
+		return errors.New("admin access required")
+	}
+	return nil
+}
+
+// toModelResponse converts a model to ComponentModelResponse DTO; record
+// is nil for built-in models
+func (s *ComponentService) toModelResponse(m *simulator.DeviceModel, record *models.ComponentModel) *dto.ComponentModelResponse {
+	response := &dto.ComponentModelResponse{DeviceModel: *m, Builtin: record == nil}
+	if record != nil {
+		response.Version = record.Version
+		response.UpdatedAt = &record.UpdatedAt
+	}
+	return response
+}
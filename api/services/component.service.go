@@ -11,13 +11,15 @@ import (
 
 // ComponentService handles component business logic
 type ComponentService struct {
-	repo *repositories.ComponentRepository
+	repo     *repositories.ComponentRepository
+	userRepo *repositories.UserRepository
 }
 
 // NewComponentService creates a new ComponentService
 func NewComponentService(db *gorm.DB) *ComponentService {
 	return &ComponentService{
-		repo: repositories.NewComponentRepository(db),
+		repo:     repositories.NewComponentRepository(db),
+		userRepo: repositories.NewUserRepository(db),
 	}
 }
 
@@ -61,6 +63,9 @@ func (s *ComponentService) GetComponent(id, userID string) (*dto.ComponentRespon
 	}
 
 	response := s.toComponentResponse(component, userID)
+	if component.SimulationModel != "" {
+		response.Model, _ = s.GetModel(component.SimulationModel)
+	}
 	return &response, nil
 }
 
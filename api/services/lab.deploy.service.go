@@ -0,0 +1,295 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/simulator"
+	"strings"
+	"time"
+)
+
+// ============================================
+// Deployment to Hardware
+// ============================================
+
+// maxDeploymentReadings caps the sensor readings a comparison reads
+const maxDeploymentReadings = 10000
+
+// platformLanguages are the code languages the hardware of each platform
+// is programmed in
+var platformLanguages = map[models.LabPlatform][]string{
+	models.PlatformArduinoUno:  {"arduino", "c", "cpp"},
+	models.PlatformArduinoMega: {"arduino", "c", "cpp"},
+	models.PlatformESP32:       {"arduino", "c", "cpp", "micropython"},
+	models.PlatformESP8266:     {"arduino", "c", "cpp", "micropython"},
+	models.PlatformRaspberryPi: {"micropython", "c", "cpp"},
+	models.PlatformSTM32:       {"arduino", "c", "cpp"},
+}
+
+// DeployToLab promotes a passing run of a simulation to a lab. The boards
+// of the circuit and the language of the code must target the lab's
+// platform; the user then joins the queue and the code is staged as the
+// first compilation of their next session on the lab.
+func (s *LabService) DeployToLab(labID, userID string, req dto.DeployToLabRequest) (*dto.DeploymentResponse, error) {
+	lab, err := s.repo.FindByIDSimple(labID)
+	if err != nil {
+		return nil, errors.New("lab not found")
+	}
+
+	simulation, err := s.simRepo.FindByID(req.SimulationID)
+	if err != nil {
+		return nil, errors.New("simulation not found")
+	}
+
+	if simulation.UserID != userID {
+		return nil, errors.New("access denied")
+	}
+
+	run, err := s.deploymentRun(simulation, req.RunID)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := schematic.Parse(simulation.SchemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+	boards := simulator.Boards(schema)
+	if len(boards) == 0 {
+		return nil, errors.New("circuit has no microcontroller board")
+	}
+	for _, board := range boards {
+		if models.LabPlatform(board.Type) != lab.Platform {
+			return nil, errors.New("circuit does not target the lab platform")
+		}
+	}
+
+	code, language, filename := deploymentCode(boards)
+	if strings.TrimSpace(code) == "" {
+		return nil, errors.New("no code to deploy")
+	}
+	if run.SketchHash != sketchHash(boards) {
+		return nil, errors.New("code changed since the run")
+	}
+	if !supportsLanguage(lab.Platform, language) {
+		return nil, errors.New("code language is not supported by the lab platform")
+	}
+
+	var results simulator.Results
+	if json.Unmarshal(run.ResultData, &results) != nil {
+		return nil, errors.New("run has no results")
+	}
+	predictions := results.Predictions()
+	if len(predictions) == 0 {
+		return nil, errors.New("run has no predictions")
+	}
+	predicted := map[string]bool{}
+	for _, p := range predictions {
+		predicted[p.Probe] = true
+	}
+	for _, probe := range req.Probes {
+		if !predicted[probe] {
+			return nil, errors.New("probe is not predicted by the run")
+		}
+	}
+
+	// Join the queue; a user already waiting keeps their place
+	queue, err := s.JoinQueue(labID, userID, dto.JoinQueueRequest{BidAmount: req.BidAmount})
+	if err != nil {
+		if err.Error() != "already in queue for this lab" {
+			return nil, err
+		}
+		status, err := s.GetQueueStatus(labID, userID)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := s.repo.GetQueueEntry(labID, userID)
+		if err != nil {
+			return nil, err
+		}
+		queue = &dto.JoinQueueResponse{
+			QueueID:       entry.ID,
+			Position:      status.Position,
+			EstimatedWait: status.EstimatedWait,
+			ExpiresAt:     status.ExpiresAt,
+		}
+	}
+
+	predictionsJSON, _ := json.Marshal(predictions)
+	if req.Probes == nil {
+		req.Probes = map[string]string{}
+	}
+	probesJSON, _ := json.Marshal(req.Probes)
+	deployment := &models.LabDeployment{
+		LabID:        labID,
+		UserID:       userID,
+		SimulationID: simulation.ID,
+		RunID:        run.ID,
+		ProjectID:    simulation.ProjectID,
+		Status:       models.DeploymentStatusQueued,
+		Code:         code,
+		Language:     language,
+		Filename:     filename,
+		Predictions:  predictionsJSON,
+		Probes:       probesJSON,
+	}
+
+	// The latest deployment replaces the ones still waiting
+	if err := s.repo.ReplaceQueuedDeployment(deployment); err != nil {
+		return nil, err
+	}
+
+	response := toDeploymentResponse(deployment, lab)
+	response.Queue = queue
+	return &response, nil
+}
+
+// deploymentRun picks the run to deploy: the requested one, else the
+// golden run, else the latest run. Only a completed run has passed.
+func (s *LabService) deploymentRun(simulation *models.Simulation, runID string) (*models.SimulationRun, error) {
+	if runID == "" && simulation.GoldenRunID != nil {
+		runID = *simulation.GoldenRunID
+	}
+
+	var run *models.SimulationRun
+	var err error
+	if runID == "" {
+		run, err = s.simRepo.GetLatestRun(simulation.ID)
+	} else {
+		run, err = s.simRepo.GetRunByID(simulation.ID, runID)
+	}
+	if err != nil {
+		return nil, errors.New("run not found")
+	}
+
+	if run.Status != models.RunStatusCompleted {
+		return nil, errors.New("run has not passed")
+	}
+	return run, nil
+}
+
+// deploymentCode picks the code to deploy: the sketch the boards of the
+// simulation run. A project's code is attached to its boards by its runs,
+// so only code a run has checked is deployed.
+func deploymentCode(boards []simulator.Board) (code, language, filename string) {
+	for _, board := range boards {
+		if board.Sketch != "" {
+			return board.Sketch, "arduino", "sketch.ino"
+		}
+	}
+	return "", "", ""
+}
+
+// supportsLanguage reports whether the hardware of a platform is
+// programmed in a language
+func supportsLanguage(platform models.LabPlatform, language string) bool {
+	for _, l := range platformLanguages[platform] {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// stageDeployment submits the code of the deployment waiting for a
+// session as its first compilation. It returns nil when none is waiting.
+func (s *LabService) stageDeployment(session *models.LabSession) (*models.LabDeployment, *models.CodeCompilation) {
+	deployment, err := s.repo.FindQueuedDeployment(session.LabID, session.UserID)
+	if err != nil {
+		return nil, nil
+	}
+
+	session.ProjectID = deployment.ProjectID
+	compilation, err := s.submitCompilation(session, deployment.Code, deployment.Language, deployment.Filename)
+	if err != nil {
+		log.Printf("Failed to stage deployment %s: %v", deployment.ID, err)
+		return nil, nil
+	}
+
+	now := time.Now()
+	deployment.Status = models.DeploymentStatusStaged
+	deployment.SessionID = &session.ID
+	deployment.CompilationID = &compilation.ID
+	deployment.StagedAt = &now
+	s.repo.UpdateDeployment(deployment)
+
+	s.logHardwareEvent(session.LabID, &session.ID, models.EventTypeCodeUpload, map[string]interface{}{
+		"deployment_id":  deployment.ID,
+		"compilation_id": compilation.ID,
+		"simulation_id":  deployment.SimulationID,
+		"run_id":         deployment.RunID,
+	})
+
+	return deployment, compilation
+}
+
+// GetDeploymentComparison compares the sensor readings recorded during a
+// deployment's session with the predictions of its run
+func (s *LabService) GetDeploymentComparison(deploymentID, userID string, req dto.DeploymentComparisonRequest) (*dto.DeploymentComparisonResponse, error) {
+	deployment, err := s.repo.FindDeploymentByID(deploymentID)
+	if err != nil {
+		return nil, errors.New("deployment not found")
+	}
+
+	if deployment.UserID != userID {
+		return nil, errors.New("access denied")
+	}
+
+	samples := []map[string]interface{}{}
+	if deployment.SessionID != nil {
+		logs, err := s.repo.GetSessionHardwareLogsByType(*deployment.SessionID, models.EventTypeSensorRead, maxDeploymentReadings)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range logs {
+			var sample map[string]interface{}
+			if json.Unmarshal(entry.EventData, &sample) == nil {
+				samples = append(samples, sample)
+			}
+		}
+	}
+
+	response := toDeploymentResponse(deployment, deployment.Lab)
+	readings := simulator.AggregateReadings(samples)
+	comparison := simulator.CompareReadings(response.Predictions, readings, response.Probes, simulator.CompareOptions{
+		AbsTol:     req.AbsTol,
+		CurrentTol: req.CurrentTol,
+		RelTol:     req.RelTol,
+	})
+
+	return &dto.DeploymentComparisonResponse{
+		Deployment: response,
+		Readings:   readings,
+		Comparison: comparison,
+	}, nil
+}
+
+// toDeploymentResponse converts LabDeployment model to DeploymentResponse DTO
+func toDeploymentResponse(deployment *models.LabDeployment, lab *models.Lab) dto.DeploymentResponse {
+	response := dto.DeploymentResponse{
+		ID:            deployment.ID,
+		LabID:         deployment.LabID,
+		SimulationID:  deployment.SimulationID,
+		RunID:         deployment.RunID,
+		ProjectID:     deployment.ProjectID,
+		SessionID:     deployment.SessionID,
+		CompilationID: deployment.CompilationID,
+		Status:        string(deployment.Status),
+		Language:      deployment.Language,
+		Filename:      deployment.Filename,
+		Predictions:   []simulator.Prediction{},
+		Probes:        map[string]string{},
+		StagedAt:      deployment.StagedAt,
+		CreatedAt:     deployment.CreatedAt,
+	}
+	if lab != nil {
+		response.Platform = string(lab.Platform)
+	}
+	json.Unmarshal(deployment.Predictions, &response.Predictions)
+	json.Unmarshal(deployment.Probes, &response.Probes)
+	return response
+}
@@ -23,6 +23,7 @@ type LabService struct {
 	repo     *repositories.LabRepository
 	userRepo *repositories.UserRepository
 	gamRepo  *repositories.GamificationRepository
+	simRepo  *repositories.SimulationRepository
 }
 
 // NewLabService creates a new LabService
@@ -31,6 +32,7 @@ func NewLabService(db *gorm.DB) *LabService {
 		repo:     repositories.NewLabRepository(db),
 		userRepo: repositories.NewUserRepository(db),
 		gamRepo:  repositories.NewGamificationRepository(db),
+		simRepo:  repositories.NewSimulationRepository(db),
 	}
 }
 
@@ -160,6 +162,9 @@ func (s *LabService) LeaveQueue(labID, userID string) error {
 	if err != nil {
 		return errors.New("not in queue or error leaving queue")
 	}
+
+	// A deployment waiting for the session is dropped with the queue entry
+	s.repo.CancelQueuedDeployments(labID, userID)
 	return nil
 }
 
@@ -285,7 +290,7 @@ func (s *LabService) StartSession(labID, userID string) (*dto.StartSessionRespon
 		"session_id": sessionID,
 	})
 
-	return &dto.StartSessionResponse{
+	response := &dto.StartSessionResponse{
 		SessionID:    sessionID,
 		LivekitToken: livekitInfo.Token,
 		LivekitURL:   livekitInfo.LivekitURL,
@@ -296,7 +301,15 @@ func (s *LabService) StartSession(labID, userID string) (*dto.StartSessionRespon
 			SerialPort: "/dev/ttyUSB0",
 			BaudRate:   9600,
 		},
-	}, nil
+	}
+
+	// Stage the code of a deployment waiting for this session
+	if deployment, compilation := s.stageDeployment(session); deployment != nil {
+		response.DeploymentID = deployment.ID
+		response.CompilationID = compilation.ID
+	}
+
+	return response, nil
 }
 
 // EndSession ends a lab session
@@ -323,6 +336,9 @@ func (s *LabService) EndSession(labID, userID string, req dto.EndSessionRequest)
 	// Clear lab current user
 	s.repo.ClearCurrentUser(labID)
 
+	// Stop recording readings for a deployment staged on the session
+	s.repo.CompleteSessionDeployment(session.ID)
+
 	// End LiveKit session
 	lab, _ := s.repo.FindByIDSimple(labID)
 	if lab != nil {
@@ -496,14 +512,28 @@ func (s *LabService) SubmitCode(labID, userID string, req dto.SubmitCodeRequest)
 		return nil, errors.New("session is not active")
 	}
 
+	compilation, err := s.submitCompilation(session, req.Code, req.Language, req.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.SubmitCodeResponse{
+		CompilationID: compilation.ID,
+		Status:        "pending",
+	}, nil
+}
+
+// submitCompilation records code for a session and sends it to be compiled
+// and uploaded to the lab hardware
+func (s *LabService) submitCompilation(session *models.LabSession, code, language, filename string) (*models.CodeCompilation, error) {
 	// Create compilation record
 	compilation := &models.CodeCompilation{
-		SessionID: req.SessionID,
-		LabID:     labID,
-		UserID:    userID,
-		Code:      req.Code,
-		Language:  req.Language,
-		Filename:  req.Filename,
+		SessionID: session.ID,
+		LabID:     session.LabID,
+		UserID:    session.UserID,
+		Code:      code,
+		Language:  language,
+		Filename:  filename,
 		Status:    models.CompilationStatusPending,
 	}
 
@@ -512,36 +542,33 @@ func (s *LabService) SubmitCode(labID, userID string, req dto.SubmitCodeRequest)
 	}
 
 	// Update session with code
-	session.CodeSubmitted = req.Code
+	session.CodeSubmitted = code
 	session.CompilationStatus = models.CompilationStatusPending
 	s.repo.UpdateSession(session)
 
 	// Publish compilation job to RabbitMQ
 	rabbitmq.PublishCodeCompilation(rabbitmq.CodeCompilationJob{
 		CompilationID: compilation.ID,
-		LabID:         labID,
-		SessionID:     req.SessionID,
-		UserID:        userID,
-		Code:          req.Code,
-		Language:      req.Language,
-		Filename:      req.Filename,
+		LabID:         session.LabID,
+		SessionID:     session.ID,
+		UserID:        session.UserID,
+		Code:          code,
+		Language:      language,
+		Filename:      filename,
 	})
 
 	// Also send via MQTT for immediate processing by lab agent
-	mqtt.PublishCodeUpload(labID, mqtt.CodeUploadCommand{
-		LabID:         labID,
-		SessionID:     req.SessionID,
+	mqtt.PublishCodeUpload(session.LabID, mqtt.CodeUploadCommand{
+		LabID:         session.LabID,
+		SessionID:     session.ID,
 		CompilationID: compilation.ID,
-		Code:          req.Code,
-		Language:      req.Language,
-		Filename:      req.Filename,
+		Code:          code,
+		Language:      language,
+		Filename:      filename,
 		Timestamp:     time.Now(),
 	})
 
-	return &dto.SubmitCodeResponse{
-		CompilationID: compilation.ID,
-		Status:        "pending",
-	}, nil
+	return compilation, nil
 }
 
 // GetCompilationStatus gets compilation status
@@ -0,0 +1,487 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/storage"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ============================================
+// Project Archives (.nexflux)
+// ============================================
+
+const (
+	// ProjectArchiveVersion is the archive layout this backend writes; it
+	// reads archives up to this version
+	ProjectArchiveVersion = 1
+	// ProjectArchiveExtension is the file extension of project archives
+	ProjectArchiveExtension = "nexflux"
+	// MaxProjectArchiveSize caps an uploaded archive
+	MaxProjectArchiveSize = 20 * 1024 * 1024
+
+	projectArchiveFormat = "nexflux"
+	archiveManifestFile  = "manifest.json"
+	archiveSchemaFile    = "schema.json"
+	archiveCodeFile      = "code.json"
+	maxArchiveEntrySize  = 10 * 1024 * 1024 // uncompressed
+	maxArchiveCircuits   = 50
+)
+
+// ProjectArchive is a project packed as a .nexflux zip
+type ProjectArchive struct {
+	Name string // project name, for the file name
+	Data []byte
+}
+
+// archiveManifest describes the content of an archive. Files are named
+// relative to the archive root; a missing file is an empty document.
+type archiveManifest struct {
+	Format     string             `json:"format"`
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Project    archiveProject     `json:"project"`
+	Schema     string             `json:"schema,omitempty"`
+	Code       string             `json:"code,omitempty"`
+	Thumbnail  string             `json:"thumbnail,omitempty"`
+	Components []archiveComponent `json:"components"`
+	Circuits   []archiveCircuit   `json:"circuits"`
+	Milestones []archiveMilestone `json:"milestones"`
+}
+
+type archiveProject struct {
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	Difficulty       string   `json:"difficulty"`
+	HardwarePlatform string   `json:"hardware_platform"`
+	Tags             []string `json:"tags"`
+}
+
+// archiveComponent is a catalog component the project declares. The part
+// number finds it again in another catalog.
+type archiveComponent struct {
+	ComponentID string          `json:"component_id"`
+	Name        string          `json:"name"`
+	PartNumber  string          `json:"part_number,omitempty"`
+	Quantity    int             `json:"quantity"`
+	PositionX   float64         `json:"position_x"`
+	PositionY   float64         `json:"position_y"`
+	Rotation    float64         `json:"rotation"`
+	Config      json.RawMessage `json:"config,omitempty"`
+}
+
+type archiveCircuit struct {
+	File        string   `json:"file"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+// archiveMilestone records progress for backups; imports start afresh
+type archiveMilestone struct {
+	Type       string    `json:"type"`
+	XPEarned   int       `json:"xp_earned"`
+	UnlockedAt time.Time `json:"unlocked_at"`
+}
+
+// ExportProject packs a project into a .nexflux archive: its schema, code,
+// thumbnail, declared components, circuits and milestones
+func (s *ProjectService) ExportProject(projectID, userID string) (*ProjectArchive, error) {
+	project, err := s.repo.FindByID(projectID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("project not found")
+		}
+		return nil, err
+	}
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
+	circuits, err := s.circuits.repo.FindByProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	milestones, err := s.repo.FindMilestones(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := archiveManifest{
+		Format:     projectArchiveFormat,
+		Version:    ProjectArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Project: archiveProject{
+			Name:             project.Name,
+			Description:      project.Description,
+			Difficulty:       string(project.Difficulty),
+			HardwarePlatform: project.HardwarePlatform,
+			Tags:             project.Tags,
+		},
+		Components: []archiveComponent{},
+		Circuits:   []archiveCircuit{},
+		Milestones: []archiveMilestone{},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	if !isEmptySchema(project.SchemaData) {
+		manifest.Schema = archiveSchemaFile
+		if err := write(archiveSchemaFile, upgradeSchemaData(project.SchemaData)); err != nil {
+			return nil, err
+		}
+	}
+	if len(project.CodeData) > 0 && string(project.CodeData) != "null" {
+		manifest.Code = archiveCodeFile
+		if err := write(archiveCodeFile, project.CodeData); err != nil {
+			return nil, err
+		}
+	}
+	if data, contentType, err := storage.ReadFile(storage.BucketThumbnails, project.ThumbnailURL); err == nil {
+		if ext, ok := storage.AllowedImageTypes[contentType]; ok {
+			manifest.Thumbnail = "thumbnail" + ext
+			if err := write(manifest.Thumbnail, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, pc := range project.Components {
+		component := archiveComponent{
+			ComponentID: pc.ComponentID,
+			Quantity:    pc.Quantity,
+			PositionX:   pc.PositionX,
+			PositionY:   pc.PositionY,
+			Rotation:    pc.Rotation,
+			Config:      json.RawMessage(pc.ConfigData),
+		}
+		if len(pc.ConfigData) == 0 {
+			component.Config = nil
+		}
+		if pc.Component != nil {
+			component.Name = pc.Component.Name
+			component.PartNumber = pc.Component.PartNumber
+		}
+		manifest.Components = append(manifest.Components, component)
+	}
+
+	for i, circuit := range circuits {
+		file := fmt.Sprintf("circuits/%02d.json", i+1)
+		if err := write(file, upgradeSchemaData(circuit.SchemaData)); err != nil {
+			return nil, err
+		}
+		manifest.Circuits = append(manifest.Circuits, archiveCircuit{
+			File:        file,
+			Name:        circuit.Name,
+			Description: circuit.Description,
+			Tags:        circuit.Tags,
+		})
+	}
+
+	for _, m := range milestones {
+		manifest.Milestones = append(manifest.Milestones, archiveMilestone{
+			Type:       string(m.MilestoneType),
+			XPEarned:   m.XPEarned,
+			UnlockedAt: m.UnlockedAt,
+		})
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := write(archiveManifestFile, manifestJSON); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &ProjectArchive{Name: project.Name, Data: buf.Bytes()}, nil
+}
+
+// ImportProject recreates the project of a .nexflux archive under a user's
+// account. The project starts private with no progress; components missing
+// from the catalog and circuits that do not load are left out with a warning.
+func (s *ProjectService) ImportProject(userID string, data []byte) (*dto.ProjectImportResponse, error) {
+	if len(data) > MaxProjectArchiveSize {
+		return nil, errors.New("archive is too large")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("invalid archive")
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[path.Clean(f.Name)] = f
+	}
+
+	manifestJSON, err := readArchiveFile(files, archiveManifestFile)
+	if err != nil || manifestJSON == nil {
+		return nil, errors.New("invalid archive")
+	}
+	var manifest archiveManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil || manifest.Format != projectArchiveFormat {
+		return nil, errors.New("invalid archive")
+	}
+	if manifest.Version < 1 || manifest.Version > ProjectArchiveVersion {
+		return nil, errors.New("unsupported archive version")
+	}
+	name := []rune(strings.TrimSpace(manifest.Project.Name))
+	if len(name) == 0 {
+		return nil, errors.New("invalid archive")
+	}
+	if len(name) > 200 {
+		name = name[:200]
+	}
+
+	warnings := []string{}
+	project := &models.Project{
+		UserID:           userID,
+		Name:             string(name),
+		Description:      manifest.Project.Description,
+		Difficulty:       models.Difficulty(manifest.Project.Difficulty),
+		HardwarePlatform: manifest.Project.HardwarePlatform,
+		Tags:             manifest.Project.Tags,
+		XPReward:         100, // Default XP reward
+	}
+	switch project.Difficulty {
+	case models.DifficultyBeginner, models.DifficultyIntermediate, models.DifficultyAdvanced:
+	default:
+		project.Difficulty = models.DifficultyBeginner
+	}
+	if len(project.HardwarePlatform) > 50 {
+		project.HardwarePlatform = ""
+	}
+
+	schemaJSON, err := readArchiveFile(files, manifest.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if schemaJSON != nil {
+		if project.SchemaData, err = normalizeSchemaData(datatypes.JSON(schemaJSON)); err != nil {
+			return nil, err
+		}
+	}
+	codeJSON, err := readArchiveFile(files, manifest.Code)
+	if err != nil {
+		return nil, err
+	}
+	if codeJSON != nil {
+		if project.CodeData, err = normalizeCodeData(datatypes.JSON(codeJSON)); err != nil {
+			return nil, errors.New("invalid archive")
+		}
+	}
+
+	components := s.importComponents(manifest.Components, &warnings)
+	if err := s.repo.CreateWithComponents(project, components); err != nil {
+		return nil, err
+	}
+	s.versions.RecordInitial(project, userID, "Imported")
+
+	if len(manifest.Circuits) > maxArchiveCircuits {
+		warnings = append(warnings, fmt.Sprintf("Only the first %d circuits were imported", maxArchiveCircuits))
+		manifest.Circuits = manifest.Circuits[:maxArchiveCircuits]
+	}
+	for _, c := range manifest.Circuits {
+		if err := s.importCircuit(project, userID, files, c); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Circuit %q was not imported: %v", c.Name, err))
+		}
+	}
+
+	if manifest.Thumbnail != "" {
+		if err := s.importThumbnail(project, files, manifest.Thumbnail); err != nil {
+			warnings = append(warnings, "The thumbnail was not imported: "+err.Error())
+		}
+	}
+
+	project.Components = components
+	return &dto.ProjectImportResponse{
+		Project:  s.toProjectResponse(project),
+		Warnings: warnings,
+	}, nil
+}
+
+// importComponents matches the declared components of an archive to the
+// catalog, by ID and then by part number
+func (s *ProjectService) importComponents(declared []archiveComponent, warnings *[]string) []models.ProjectComponent {
+	ids, partNumbers := []string{}, []string{}
+	for _, c := range declared {
+		if c.ComponentID != "" {
+			ids = append(ids, c.ComponentID)
+		}
+		if c.PartNumber != "" {
+			partNumbers = append(partNumbers, c.PartNumber)
+		}
+	}
+
+	byID := map[string]bool{}
+	if found, err := s.componentRepo.FindByIDs(ids); err == nil {
+		for _, c := range found {
+			if c.IsActive {
+				byID[c.ID] = true
+			}
+		}
+	}
+	byPartNumber := map[string]string{}
+	if found, err := s.componentRepo.FindByPartNumbers(partNumbers); err == nil {
+		for _, c := range found {
+			// Ordered by stock, so the first is the one most likely available
+			if _, exists := byPartNumber[c.PartNumber]; !exists {
+				byPartNumber[c.PartNumber] = c.ID
+			}
+		}
+	}
+
+	components := []models.ProjectComponent{}
+	for _, c := range declared {
+		componentID := ""
+		if byID[c.ComponentID] {
+			componentID = c.ComponentID
+		} else if id, ok := byPartNumber[c.PartNumber]; ok && c.PartNumber != "" {
+			componentID = id
+		}
+		if componentID == "" {
+			label := c.Name
+			if label == "" {
+				label = c.ComponentID
+			}
+			*warnings = append(*warnings, fmt.Sprintf("Component %q is not in the catalog and was left out", label))
+			continue
+		}
+
+		quantity := c.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+		var config datatypes.JSON
+		if len(c.Config) > 0 {
+			config = datatypes.JSON(c.Config)
+		}
+		components = append(components, models.ProjectComponent{
+			ComponentID: componentID,
+			Quantity:    quantity,
+			PositionX:   c.PositionX,
+			PositionY:   c.PositionY,
+			Rotation:    c.Rotation,
+			ConfigData:  config,
+		})
+	}
+	return components
+}
+
+// importCircuit creates a circuit of an archive on the imported project.
+// Imported circuits earn no XP.
+func (s *ProjectService) importCircuit(project *models.Project, userID string, files map[string]*zip.File, c archiveCircuit) error {
+	data, err := readArchiveFile(files, c.File)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return errors.New("its schema is missing")
+	}
+	schemaData, err := normalizeSchemaData(datatypes.JSON(data))
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(c.Name)
+	if name == "" || len(name) > 255 {
+		name = project.Name
+	}
+	projectID := project.ID
+	componentsCount, wiresCount := s.circuits.countSchemaElements(schemaData)
+	circuit := &models.Circuit{
+		UserID:          userID,
+		ProjectID:       &projectID,
+		Name:            name,
+		Description:     c.Description,
+		SchemaData:      schemaData,
+		ComponentsCount: componentsCount,
+		WiresCount:      wiresCount,
+		Tags:            normalizeTags(c.Tags),
+	}
+	if err := s.circuits.repo.CreateWithRevision(circuit, newRevision(circuit, userID, "Imported", nil)); err != nil {
+		return err
+	}
+	s.circuits.queueThumbnail(circuit.ID)
+	return nil
+}
+
+// importThumbnail stores the thumbnail of an archive as the project's
+func (s *ProjectService) importThumbnail(project *models.Project, files map[string]*zip.File, name string) error {
+	data, err := readArchiveFile(files, name)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return errors.New("file is missing")
+	}
+
+	// The name of the file says nothing of what it holds; the type is what
+	// the content decodes as, so a script can't pass for a thumbnail
+	contentType, err := storage.DetectImageType(data)
+	if err != nil {
+		return err
+	}
+	ext := storage.AllowedImageTypes[contentType]
+
+	thumbnailURL, err := storage.UploadBytes(storage.BucketThumbnails, fmt.Sprintf("projects/%s%s", project.ID, ext), data, contentType)
+	if err != nil {
+		return err
+	}
+	project.ThumbnailURL = thumbnailURL
+	return s.repo.Update(project)
+}
+
+// readArchiveFile reads a file of an archive; nil when the name is empty
+// or the archive does not have it
+func readArchiveFile(files map[string]*zip.File, name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+	f, ok := files[path.Clean(name)]
+	if !ok {
+		return nil, nil
+	}
+	if f.UncompressedSize64 > maxArchiveEntrySize {
+		return nil, errors.New("archive is too large")
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, errors.New("invalid archive")
+	}
+	defer rc.Close()
+	// The header's size is not trusted; stop reading past the limit
+	data, err := io.ReadAll(io.LimitReader(rc, maxArchiveEntrySize+1))
+	if err != nil {
+		log.Printf("Failed to read archive file %s: %v", name, err)
+		return nil, errors.New("invalid archive")
+	}
+	if len(data) > maxArchiveEntrySize {
+		return nil, errors.New("archive is too large")
+	}
+	return data, nil
+}
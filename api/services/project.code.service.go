@@ -0,0 +1,283 @@
+package services
+
+import (
+	"errors"
+	"nexfi-backend/api/repositories"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/lint"
+	"nexfi-backend/pkg/sketch"
+	"nexfi-backend/pkg/workspace"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ============================================
+// Project Code Workspace
+// ============================================
+
+// ProjectCodeService handles the files and folders of a project's code.
+// Saves go through ProjectProgressService, so progress, milestones and
+// version history follow as for a save of the whole workspace.
+type ProjectCodeService struct {
+	repo     *repositories.ProjectRepository
+	progress *ProjectProgressService
+}
+
+// NewProjectCodeService creates a new ProjectCodeService
+func NewProjectCodeService(db *gorm.DB) *ProjectCodeService {
+	return &ProjectCodeService{
+		repo:     repositories.NewProjectRepository(db),
+		progress: NewProjectProgressService(db),
+	}
+}
+
+// GetFile returns a file of the project's code with the functions it defines
+func (s *ProjectCodeService) GetFile(projectID, userID, filePath string) (*dto.CodeFileResponse, error) {
+	project, err := s.repo.FindByID(projectID)
+	if err != nil {
+		return nil, errors.New("project not found")
+	}
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
+	ws, err := workspace.Parse(project.CodeData)
+	if err != nil {
+		return nil, err
+	}
+	filePath, err = workspace.CleanPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	f := ws.File(filePath)
+	if f == nil {
+		return nil, workspace.ErrFileNotFound
+	}
+	return toCodeFileResponse(f), nil
+}
+
+// SaveFile creates a file or replaces its content
+func (s *ProjectCodeService) SaveFile(projectID, userID, filePath string, req dto.SaveCodeFileRequest) (*dto.SaveCodeResponse, error) {
+	var saved *workspace.File
+	resp, err := s.progress.updateCode(projectID, userID, func(ws *workspace.Workspace) error {
+		f, err := ws.Put(filePath, req.Language, *req.Content)
+		if f != nil {
+			saved = f
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.File = toCodeFileResponse(saved)
+	return resp, nil
+}
+
+// UpdateFile renames or moves a file, or changes its language
+func (s *ProjectCodeService) UpdateFile(projectID, userID, filePath string, req dto.UpdateCodeFileRequest) (*dto.SaveCodeResponse, error) {
+	if req.Path == "" && req.Language == "" {
+		return nil, errors.New("path or language is required")
+	}
+
+	var updated workspace.File
+	resp, err := s.progress.updateCode(projectID, userID, func(ws *workspace.Workspace) error {
+		if req.Language != "" {
+			if err := ws.SetLanguage(filePath, req.Language); err != nil {
+				return err
+			}
+		}
+		if req.Path != "" {
+			if err := ws.Move(filePath, req.Path); err != nil {
+				return err
+			}
+			filePath = req.Path
+		}
+		filePath, _ = workspace.CleanPath(filePath)
+		updated = *ws.File(filePath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.File = toCodeFileResponse(&updated)
+	return resp, nil
+}
+
+// DeleteFile deletes a file; the main file cannot be deleted
+func (s *ProjectCodeService) DeleteFile(projectID, userID, filePath string) (*dto.SaveCodeResponse, error) {
+	return s.progress.updateCode(projectID, userID, func(ws *workspace.Workspace) error {
+		return ws.Remove(filePath)
+	})
+}
+
+// CreateFolder creates a folder
+func (s *ProjectCodeService) CreateFolder(projectID, userID string, req dto.CodeFolderRequest) (*dto.SaveCodeResponse, error) {
+	return s.progress.updateCode(projectID, userID, func(ws *workspace.Workspace) error {
+		return ws.AddFolder(req.Path)
+	})
+}
+
+// DeleteFolder deletes a folder with the files in it
+func (s *ProjectCodeService) DeleteFolder(projectID, userID, folder string) (*dto.SaveCodeResponse, error) {
+	return s.progress.updateCode(projectID, userID, func(ws *workspace.Workspace) error {
+		_, err := ws.RemoveFolder(folder)
+		return err
+	})
+}
+
+// SetMainFile chooses the file builds and simulations start from
+func (s *ProjectCodeService) SetMainFile(projectID, userID string, req dto.SetMainFileRequest) (*dto.SaveCodeResponse, error) {
+	return s.progress.updateCode(projectID, userID, func(ws *workspace.Workspace) error {
+		return ws.SetMain(req.Path)
+	})
+}
+
+// AnalyzeCode checks the project's code for errors before it is submitted:
+// syntax, missing setup() and loop(), pins the board does not have or that
+// are never configured, and blocking calls in interrupt handlers
+func (s *ProjectCodeService) AnalyzeCode(projectID, userID string, req dto.AnalyzeCodeRequest) (*dto.CodeAnalysisResponse, error) {
+	project, err := s.repo.FindByID(projectID)
+	if err != nil {
+		return nil, errors.New("project not found")
+	}
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
+	ws, err := workspace.Parse(project.CodeData)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range req.Files {
+		if _, err := ws.Put(f.Path, f.Language, f.Content); err != nil {
+			return nil, err
+		}
+	}
+	if req.Main != "" {
+		if err := ws.SetMain(req.Main); err != nil {
+			return nil, err
+		}
+	}
+
+	platform := req.Platform
+	if platform == "" {
+		platform = project.HardwarePlatform
+	}
+	platform = lint.PlatformKey(platform)
+	resp := &dto.CodeAnalysisResponse{
+		Platform:     platform,
+		BoardChecked: lint.BoardFor(platform) != nil,
+		Diagnostics: lint.Check(ws, lint.Options{
+			Platform:  platform,
+			Languages: platformLanguages[models.LabPlatform(platform)],
+		}),
+	}
+	for _, d := range resp.Diagnostics {
+		switch d.Severity {
+		case lint.SeverityError:
+			resp.Errors++
+		case lint.SeverityWarning:
+			resp.Warnings++
+		default:
+			resp.Infos++
+		}
+	}
+	resp.Ready = resp.Errors == 0
+	return resp, nil
+}
+
+// checkCode measures a workspace for progress: the functions that do
+// something in all files, and whether the sketch compiles when the main
+// file is in a language the simulator runs
+func checkCode(ws *workspace.Workspace) *dto.CodeCheckResponse {
+	check := &dto.CodeCheckResponse{Files: len(ws.Files)}
+	for i := range ws.Files {
+		for _, fn := range ws.Files[i].Functions() {
+			if !fn.Empty {
+				check.Functions++
+			}
+		}
+	}
+
+	if src := ws.Sketch(); src != nil {
+		_, err := sketch.Compile(src.Text)
+		compiles := err == nil
+		check.Compiles = &compiles
+		if err != nil {
+			issue := &dto.CodeIssue{Message: err.Error()}
+			if sketchErr, ok := err.(*sketch.Error); ok {
+				issue.Message = sketchErr.Message
+				if sketchErr.Line > 0 {
+					issue.File, issue.Line = src.Locate(sketchErr.Line)
+				}
+			}
+			if issue.File == "" {
+				issue.File = ws.Main
+			}
+			check.CompileError = issue
+		}
+	}
+
+	check.Percentage = models.GetCodeCompletionPercentage(models.CodeSignals{
+		Functions: check.Functions,
+		Compiles:  check.Compiles,
+	})
+	return check
+}
+
+// codeDataCheck measures stored code data
+func codeDataCheck(data datatypes.JSON) *dto.CodeCheckResponse {
+	ws, err := workspace.Parse(data)
+	if err != nil {
+		return &dto.CodeCheckResponse{}
+	}
+	return checkCode(ws)
+}
+
+// normalizeCodeData upgrades code data received from a client to the
+// workspace format
+func normalizeCodeData(data datatypes.JSON) (datatypes.JSON, error) {
+	if isEmptySchema(data) {
+		return data, nil
+	}
+	ws, err := workspace.Parse(data)
+	if err != nil {
+		return nil, errors.New("invalid code data")
+	}
+	normalized, err := ws.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// upgradeCodeData upgrades stored code data in memory for a response;
+// it is stored in the new format on the next save
+func upgradeCodeData(data datatypes.JSON) datatypes.JSON {
+	if isEmptySchema(data) {
+		return data
+	}
+	upgraded, err := normalizeCodeData(data)
+	if err != nil {
+		return data
+	}
+	return upgraded
+}
+
+// codeWorkspace reads the code of a project; unreadable code is empty
+func codeWorkspace(data datatypes.JSON) *workspace.Workspace {
+	ws, err := workspace.Parse(data)
+	if err != nil {
+		return workspace.New()
+	}
+	return ws
+}
+
+func toCodeFileResponse(f *workspace.File) *dto.CodeFileResponse {
+	if f == nil {
+		return nil
+	}
+	return &dto.CodeFileResponse{File: *f, Functions: f.Functions()}
+}
@@ -0,0 +1,728 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nexfi-backend/api/repositories"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/ot"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/workspace"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ============================================
+// Collaborative Editing
+// ============================================
+
+const (
+	collabPersistInterval = 15 * time.Second
+	collabHistoryLimit    = 1000 // operations kept to transform late edits against
+	collabEventBuffer     = 256  // events queued per participant before it is dropped
+	collabMaxParticipants = 30
+	collabSaveRetries     = 20 // failed saves of a session nobody is in before its edits are given up
+)
+
+// liveSessions holds the IDs of projects with a running session. REST
+// saves of the schema and code are refused meanwhile, since the session's
+// next save would overwrite them.
+var liveSessions sync.Map
+
+// checkNoLiveSession refuses a schema or code write while a session edits
+// the project
+func checkNoLiveSession(projectID string) error {
+	if _, ok := liveSessions.Load(projectID); ok {
+		return errors.New("project is being edited in a live session")
+	}
+	return nil
+}
+
+// collabColors are handed out to participants in join order
+var collabColors = []string{"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#9a6324"}
+
+// CollabEvent is an event sent to a participant
+type CollabEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// CollabParticipant is one connection to a project's editing session. Its
+// events arrive on Events in the order the server applied them; the channel
+// is closed when the participant leaves or falls too far behind.
+type CollabParticipant struct {
+	ClientID  string
+	UserID    string
+	ProjectID string
+	Role      models.CollaboratorRole
+	Events    chan CollabEvent
+
+	info     dto.CollabParticipantResponse
+	presence *dto.CollabPresence
+	closed   bool
+}
+
+// collabSession is the live state of a project being edited. The server
+// orders every edit: code edits made at an older revision are transformed
+// against the edits of the same file applied since, schema patches apply in
+// arrival order.
+type collabSession struct {
+	projectID    string
+	mu           sync.Mutex
+	participants map[string]*CollabParticipant
+	colors       int
+
+	revision     int
+	history      []collabEdit // edit of each revision after historyStart
+	historyStart int
+
+	files        map[string]*collabFile
+	main         string
+	folders      []string
+	schema       schematic.Document
+	schemaDirty  bool
+	codeEditor   string // user of the last unsaved edit
+	schemaEditor string
+
+	persistMu sync.Mutex // orders saves so an older state never overwrites a newer one
+	done      chan struct{}
+}
+
+// collabEdit is an applied edit; op is nil for schema patches
+type collabEdit struct {
+	file string
+	op   *ot.TextOperation
+}
+
+// collabFile is a code file being edited
+type collabFile struct {
+	text     ot.Text
+	language string
+	dirty    bool
+}
+
+// ProjectCollabService runs the live editing sessions of projects. Sessions
+// are kept in memory: all connections to a project must reach the same API
+// instance.
+type ProjectCollabService struct {
+	repo     *repositories.ProjectRepository
+	userRepo *repositories.UserRepository
+	progress *ProjectProgressService
+	sessions map[string]*collabSession
+	mu       sync.Mutex
+}
+
+// NewProjectCollabService creates a new ProjectCollabService
+func NewProjectCollabService(db *gorm.DB) *ProjectCollabService {
+	return &ProjectCollabService{
+		repo:     repositories.NewProjectRepository(db),
+		userRepo: repositories.NewUserRepository(db),
+		progress: NewProjectProgressService(db),
+		sessions: make(map[string]*collabSession),
+	}
+}
+
+// Join adds a connection to the project's session, starting the session
+// when it is the first. The owner and accepted collaborators can join;
+// viewers follow along but cannot edit.
+func (s *ProjectCollabService) Join(projectID, userID string) (*CollabParticipant, error) {
+	if _, err := s.repo.FindByIDSimple(projectID); err != nil {
+		return nil, errors.New("project not found")
+	}
+	role, err := s.repo.FindRole(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, errors.New("access denied")
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := s.sessions[projectID]
+	if session == nil {
+		if session, err = s.startSession(projectID); err != nil {
+			return nil, err
+		}
+		s.sessions[projectID] = session
+		liveSessions.Store(projectID, true)
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if len(session.participants) >= collabMaxParticipants {
+		return nil, errors.New("session is full")
+	}
+
+	p := &CollabParticipant{
+		ClientID:  generateUUID(),
+		UserID:    userID,
+		ProjectID: projectID,
+		Role:      role,
+		Events:    make(chan CollabEvent, collabEventBuffer),
+	}
+	p.info = dto.CollabParticipantResponse{
+		ClientID:  p.ClientID,
+		UserID:    userID,
+		Name:      user.Name,
+		Username:  user.Username,
+		AvatarURL: user.AvatarURL,
+		Role:      string(role),
+		Color:     collabColors[session.colors%len(collabColors)],
+	}
+	session.colors++
+
+	session.broadcast(p, "joined", p.info)
+	session.participants[p.ClientID] = p
+	session.send(p, "init", session.initState(p))
+	return p, nil
+}
+
+// Leave removes a connection from its session. The last one to leave saves
+// the session and ends it; when the save fails, the session stays until a
+// periodic save succeeds.
+func (s *ProjectCollabService) Leave(p *CollabParticipant) {
+	session := s.session(p.ProjectID)
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	session.drop(p)
+	empty := len(session.participants) == 0
+	session.mu.Unlock()
+	if !empty {
+		return
+	}
+
+	s.persist(session)
+	s.endIfIdle(session, false)
+}
+
+// endIfIdle ends a session nobody is in. A session with unsaved edits is
+// kept unless force is set.
+func (s *ProjectCollabService) endIfIdle(session *collabSession, force bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	// Someone may have joined while saving
+	if len(session.participants) > 0 || s.sessions[session.projectID] != session {
+		return false
+	}
+	if session.unsaved() && !force {
+		return false
+	}
+	delete(s.sessions, session.projectID)
+	liveSessions.Delete(session.projectID)
+	close(session.done)
+	return true
+}
+
+// ApplyCode applies a code edit the participant made to a file at a
+// revision. The edit is transformed against the edits of the file applied
+// since, acknowledged to the sender and broadcast to everyone else. An edit
+// of a file the session does not know creates it when it starts from an
+// empty file.
+func (s *ProjectCollabService) ApplyCode(p *CollabParticipant, req dto.CollabCodeRequest) error {
+	if err := s.checkEdit(p); err != nil {
+		return err
+	}
+	if req.Ops == nil {
+		return errors.New("ops is required")
+	}
+	session, err := s.lockSession(p)
+	if err != nil {
+		return err
+	}
+	defer session.mu.Unlock()
+
+	filePath := req.File
+	if filePath == "" {
+		filePath = session.main
+	}
+	if filePath, err = workspace.CleanPath(filePath); err != nil {
+		return err
+	}
+	concurrent, err := session.since(req.Revision)
+	if err != nil {
+		return err
+	}
+	file, err := s.openFile(session, filePath, req.Ops)
+	if err != nil {
+		return err
+	}
+
+	op := req.Ops
+	for _, other := range concurrent {
+		if other.file != filePath || other.op == nil {
+			continue
+		}
+		if op, _, err = ot.Transform(op, other.op); err != nil {
+			return errors.New("edit does not match the document")
+		}
+	}
+	text, err := op.Apply(file.text)
+	if err != nil {
+		return errors.New("edit does not match the document")
+	}
+	if len(text) > workspace.MaxFileSize {
+		return workspace.ErrFileTooLarge
+	}
+
+	file.text = text
+	file.dirty = true
+	session.files[filePath] = file
+	session.codeEditor = p.UserID
+	session.record(collabEdit{file: filePath, op: op})
+	for _, other := range session.participants {
+		session.transformPresence(other.presence, filePath, op)
+	}
+
+	session.send(p, "ack", dto.CollabAckEvent{Revision: session.revision})
+	session.broadcast(p, "code", dto.CollabCodeEvent{
+		ClientID: p.ClientID,
+		UserID:   p.UserID,
+		Revision: session.revision,
+		File:     filePath,
+		Ops:      op,
+	})
+	return nil
+}
+
+// checkEdit reads the participant's role again before an edit, so a
+// collaborator who was removed or made a viewer since joining cannot keep
+// editing. A participant who lost access to the project is disconnected.
+func (s *ProjectCollabService) checkEdit(p *CollabParticipant) error {
+	role, err := s.repo.FindRole(p.ProjectID, p.UserID)
+	if err != nil {
+		return err
+	}
+	session, err := s.lockSession(p)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		session.drop(p)
+	} else {
+		p.Role = role
+		p.info.Role = string(role)
+	}
+	session.mu.Unlock()
+
+	if !role.Can(models.ProjectPermEdit) {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+// openFile returns a file of the session. A file the session does not know
+// may have been created since the session started; an edit starting from an
+// empty file creates it. mu must be held.
+func (s *ProjectCollabService) openFile(session *collabSession, filePath string, op *ot.TextOperation) (*collabFile, error) {
+	if file := session.files[filePath]; file != nil {
+		return file, nil
+	}
+	if project, err := s.repo.FindByIDSimple(session.projectID); err == nil {
+		if f := codeWorkspace(project.CodeData).File(filePath); f != nil {
+			return &collabFile{text: ot.NewText(f.Content), language: f.Language}, nil
+		}
+	}
+	if op.BaseLength != 0 {
+		return nil, workspace.ErrFileNotFound
+	}
+	if len(session.files) >= workspace.MaxFiles {
+		return nil, workspace.ErrTooManyFiles
+	}
+	return &collabFile{language: workspace.LanguageFor(filePath)}, nil
+}
+
+// ApplySchema applies a batch of schema changes in arrival order.
+// Operations that conflict with earlier changes, such as editing a component
+// someone else removed, are skipped and reported back to the sender.
+func (s *ProjectCollabService) ApplySchema(p *CollabParticipant, req dto.CollabSchemaRequest) error {
+	if err := s.checkEdit(p); err != nil {
+		return err
+	}
+	session, err := s.lockSession(p)
+	if err != nil {
+		return err
+	}
+	defer session.mu.Unlock()
+
+	schema, applied, rejected, err := session.schema.Patch(req.Ops)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		session.schema = schema
+		session.schemaDirty = true
+		session.schemaEditor = p.UserID
+		session.record(collabEdit{})
+	}
+
+	session.send(p, "ack", dto.CollabAckEvent{Revision: session.revision, Applied: applied, Rejected: rejected})
+	if len(applied) > 0 {
+		session.broadcast(p, "schema", dto.CollabSchemaEvent{
+			ClientID: p.ClientID,
+			UserID:   p.UserID,
+			Revision: session.revision,
+			Ops:      applied,
+		})
+	}
+	return nil
+}
+
+// UpdatePresence stores where the participant is working and shares it.
+// Code offsets made at an older revision are moved past the edits since.
+func (s *ProjectCollabService) UpdatePresence(p *CollabParticipant, presence dto.CollabPresence) error {
+	session, err := s.lockSession(p)
+	if err != nil {
+		return err
+	}
+	defer session.mu.Unlock()
+
+	if presence.File != "" {
+		presence.File, _ = workspace.CleanPath(presence.File)
+	}
+	if concurrent, err := session.since(presence.Revision); err == nil {
+		for _, edit := range concurrent {
+			session.transformPresence(&presence, edit.file, edit.op)
+		}
+	}
+	presence.Revision = session.revision
+	p.presence = &presence
+
+	session.broadcast(p, "presence", dto.CollabParticipantResponse{
+		ClientID: p.ClientID,
+		UserID:   p.UserID,
+		Presence: copyPresence(p.presence),
+	})
+	return nil
+}
+
+// Resync sends the participant the current state again, e.g. after an edit
+// it sent could not be applied
+func (s *ProjectCollabService) Resync(p *CollabParticipant) error {
+	session, err := s.lockSession(p)
+	if err != nil {
+		return err
+	}
+	defer session.mu.Unlock()
+	session.send(p, "init", session.initState(p))
+	return nil
+}
+
+// lockSession returns the participant's session locked, unless the
+// participant has left it
+func (s *ProjectCollabService) lockSession(p *CollabParticipant) (*collabSession, error) {
+	session := s.session(p.ProjectID)
+	if session == nil {
+		return nil, errors.New("session ended")
+	}
+	session.mu.Lock()
+	if p.closed {
+		session.mu.Unlock()
+		return nil, errors.New("session ended")
+	}
+	return session, nil
+}
+
+// session returns the running session of a project
+func (s *ProjectCollabService) session(projectID string) *collabSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[projectID]
+}
+
+// startSession loads the project's schema and code and starts saving the
+// session periodically
+func (s *ProjectCollabService) startSession(projectID string) (*collabSession, error) {
+	project, err := s.repo.FindByIDSimple(projectID)
+	if err != nil {
+		return nil, errors.New("project not found")
+	}
+
+	schema, err := schematic.ParseDocument(project.SchemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+	ws, err := workspace.Parse(project.CodeData)
+	if err != nil {
+		return nil, errors.New("invalid code data")
+	}
+
+	session := &collabSession{
+		projectID:    projectID,
+		participants: make(map[string]*CollabParticipant),
+		files:        make(map[string]*collabFile, len(ws.Files)),
+		main:         ws.Main,
+		folders:      ws.Folders,
+		schema:       schema,
+		done:         make(chan struct{}),
+	}
+	if session.main == "" {
+		session.main = workspace.DefaultPath("arduino")
+	}
+	for _, f := range ws.Files {
+		session.files[f.Path] = &collabFile{text: ot.NewText(f.Content), language: f.Language}
+	}
+	go s.persistLoop(session)
+	return session, nil
+}
+
+// persistLoop saves the session until it ends. A session whose last
+// participant left before its edits could be saved ends once they are, or
+// after collabSaveRetries failed saves.
+func (s *ProjectCollabService) persistLoop(session *collabSession) {
+	ticker := time.NewTicker(collabPersistInterval)
+	defer ticker.Stop()
+
+	idleFailures := 0
+	for {
+		select {
+		case <-ticker.C:
+			if s.persist(session) {
+				s.endIfIdle(session, false)
+				continue
+			}
+			session.mu.Lock()
+			idle := len(session.participants) == 0
+			session.mu.Unlock()
+			if !idle {
+				idleFailures = 0
+				continue
+			}
+			if idleFailures++; idleFailures >= collabSaveRetries && s.endIfIdle(session, true) {
+				log.Printf("Warning: gave up saving collaboration session %s after %d failed saves", session.projectID, idleFailures)
+			}
+		case <-session.done:
+			return
+		}
+	}
+}
+
+// persist saves unsaved edits to the project through ProjectProgressService,
+// so progress, milestones and version history follow as for any other save.
+// Only the files edited in the session are written; files added, moved or
+// deleted through the API meanwhile are kept. Each part is saved as the
+// user who edited it last. A part that fails to save stays unsaved and the
+// participants are told; persist reports whether everything was saved.
+func (s *ProjectCollabService) persist(session *collabSession) bool {
+	session.persistMu.Lock()
+	defer session.persistMu.Unlock()
+
+	session.mu.Lock()
+	dirtyFiles := []workspace.File{}
+	for filePath, file := range session.files {
+		if file.dirty {
+			dirtyFiles = append(dirtyFiles, workspace.File{Path: filePath, Language: file.language, Content: file.text.String()})
+			file.dirty = false // edits from now on mark it again
+		}
+	}
+	codeDirty, schemaDirty := len(dirtyFiles) > 0, session.schemaDirty
+	if !codeDirty && !schemaDirty {
+		session.mu.Unlock()
+		return true
+	}
+	revision := session.revision
+	schemaReq := dto.SaveSchemaRequest{
+		Components:     marshalJSON(session.schema.Components()),
+		Connections:    marshalJSON(session.schema.Wires()),
+		CanvasSettings: marshalJSON(session.schema["canvas_settings"]),
+	}
+	codeEditor, schemaEditor := session.codeEditor, session.schemaEditor
+	session.schemaDirty = false
+	session.mu.Unlock()
+
+	progress := -1
+	failed := []string{}
+	var saveErr error
+	if schemaDirty {
+		resp, err := s.progress.saveSchema(session.projectID, schemaEditor, schemaReq)
+		if err != nil {
+			log.Printf("Warning: failed to save schema of collaboration session %s: %v", session.projectID, err)
+			failed, saveErr = append(failed, "schema"), err
+		} else {
+			progress = resp.Progress
+		}
+	}
+	if codeDirty {
+		resp, err := s.progress.writeCode(session.projectID, codeEditor, func(ws *workspace.Workspace) error {
+			for _, f := range dirtyFiles {
+				if _, err := ws.Put(f.Path, f.Language, f.Content); err != nil {
+					return fmt.Errorf("%s: %w", f.Path, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: failed to save code of collaboration session %s: %v", session.projectID, err)
+			failed, saveErr = append(failed, "code"), err
+		} else {
+			progress = resp.Progress
+		}
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if saveErr != nil {
+		for _, part := range failed {
+			switch part {
+			case "schema":
+				session.schemaDirty = true
+			case "code":
+				for _, f := range dirtyFiles {
+					if file := session.files[f.Path]; file != nil {
+						file.dirty = true
+					}
+				}
+			}
+		}
+		session.broadcast(nil, "save_failed", dto.CollabSaveFailedEvent{Revision: revision, Parts: failed, Message: saveErr.Error()})
+		return false
+	}
+	session.broadcast(nil, "saved", dto.CollabSavedEvent{Revision: revision, Progress: progress, SavedAt: time.Now()})
+	return true
+}
+
+// unsaved reports whether the session has edits not saved yet; mu must be
+// held
+func (session *collabSession) unsaved() bool {
+	if session.schemaDirty {
+		return true
+	}
+	for _, file := range session.files {
+		if file.dirty {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds an applied edit to the history
+func (session *collabSession) record(edit collabEdit) {
+	session.revision++
+	session.history = append(session.history, edit)
+	if len(session.history) > collabHistoryLimit {
+		drop := len(session.history) - collabHistoryLimit
+		session.history = append([]collabEdit(nil), session.history[drop:]...)
+		session.historyStart += drop
+	}
+}
+
+// since returns the edits applied after a revision
+func (session *collabSession) since(revision int) ([]collabEdit, error) {
+	if revision < session.historyStart || revision > session.revision {
+		return nil, errors.New("revision is out of range")
+	}
+	return session.history[revision-session.historyStart:], nil
+}
+
+// initState is the state a participant starts from
+func (session *collabSession) initState(p *CollabParticipant) dto.CollabInitResponse {
+	participants := make([]dto.CollabParticipantResponse, 0, len(session.participants))
+	for _, other := range session.participants {
+		info := other.info
+		info.Presence = copyPresence(other.presence)
+		participants = append(participants, info)
+	}
+	code := workspace.New()
+	code.Main = session.main
+	code.Folders = append(code.Folders, session.folders...)
+	for filePath, file := range session.files {
+		code.Files = append(code.Files, workspace.File{Path: filePath, Language: file.language, Content: file.text.String()})
+	}
+	sort.Slice(code.Files, func(i, j int) bool { return code.Files[i].Path < code.Files[j].Path })
+
+	return dto.CollabInitResponse{
+		ClientID:     p.ClientID,
+		Role:         string(p.Role),
+		Revision:     session.revision,
+		Code:         code,
+		Schema:       session.schema.Clone(),
+		Participants: participants,
+	}
+}
+
+// send queues an event for a participant; mu must be held. A participant
+// whose queue is full is dropped rather than holding up the session.
+func (session *collabSession) send(p *CollabParticipant, event string, data interface{}) {
+	if p.closed {
+		return
+	}
+	select {
+	case p.Events <- CollabEvent{Event: event, Data: data}:
+	default:
+		log.Printf("Collaboration client %s fell behind on project %s, disconnecting", p.ClientID, session.projectID)
+		session.drop(p)
+	}
+}
+
+// broadcast queues an event for every participant except one; mu must be held
+func (session *collabSession) broadcast(except *CollabParticipant, event string, data interface{}) {
+	for _, p := range session.participants {
+		if p != except {
+			session.send(p, event, data)
+		}
+	}
+}
+
+// drop removes a participant and tells the others; mu must be held
+func (session *collabSession) drop(p *CollabParticipant) {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.Events)
+	delete(session.participants, p.ClientID)
+	session.broadcast(nil, "left", dto.CollabParticipantResponse{ClientID: p.ClientID, UserID: p.UserID})
+}
+
+// transformPresence moves a presence's code offsets past an edit of a file
+func (session *collabSession) transformPresence(presence *dto.CollabPresence, filePath string, op *ot.TextOperation) {
+	if presence == nil || op == nil {
+		return
+	}
+	if file := presence.File; file != filePath && (file != "" || filePath != session.main) {
+		return
+	}
+	if presence.Cursor != nil {
+		cursor := op.TransformIndex(*presence.Cursor)
+		presence.Cursor = &cursor
+	}
+	if presence.Selection != nil {
+		presence.Selection = &dto.CollabSelection{
+			Anchor: op.TransformIndex(presence.Selection.Anchor),
+			Head:   op.TransformIndex(presence.Selection.Head),
+		}
+	}
+}
+
+// copyPresence copies a presence for an event, since later edits move the
+// stored offsets
+func copyPresence(presence *dto.CollabPresence) *dto.CollabPresence {
+	if presence == nil {
+		return nil
+	}
+	copied := *presence
+	return &copied
+}
+
+func marshalJSON(v interface{}) datatypes.JSON {
+	data, _ := json.Marshal(v)
+	return data
+}
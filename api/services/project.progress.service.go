@@ -6,10 +6,13 @@ import (
 	"nexfi-backend/api/repositories"
 	"nexfi-backend/dto"
 	"nexfi-backend/models"
+	"nexfi-backend/pkg/simulator"
+	"nexfi-backend/pkg/workspace"
 	"time"
 
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ProjectProgressService handles project progress business logic
@@ -17,6 +20,8 @@ type ProjectProgressService struct {
 	repo       *repositories.ProjectRepository
 	userRepo   *repositories.UserRepository
 	gamRepo    *repositories.GamificationRepository
+	simRepo    *repositories.SimulationRepository
+	versions   *ProjectVersionService
 	progressDB *gorm.DB
 }
 
@@ -26,6 +31,8 @@ func NewProjectProgressService(db *gorm.DB) *ProjectProgressService {
 		repo:       repositories.NewProjectRepository(db),
 		userRepo:   repositories.NewUserRepository(db),
 		gamRepo:    repositories.NewGamificationRepository(db),
+		simRepo:    repositories.NewSimulationRepository(db),
+		versions:   NewProjectVersionService(db),
 		progressDB: db,
 	}
 }
@@ -38,8 +45,8 @@ func (s *ProjectProgressService) GetProgress(projectID, userID string) (*dto.Get
 		return nil, errors.New("project not found")
 	}
 
-	if !s.hasAccess(project, userID) {
-		return nil, errors.New("access denied")
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
+		return nil, err
 	}
 
 	// Get progress breakdown
@@ -71,8 +78,29 @@ func (s *ProjectProgressService) UpdateProgress(projectID, userID string, req dt
 		return nil, errors.New("project not found")
 	}
 
-	if !s.hasAccess(project, userID) {
-		return nil, errors.New("access denied")
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
+	}
+
+	if req.Component == "schema" || req.Component == "code" {
+		if err := checkNoLiveSession(projectID); err != nil {
+			return nil, err
+		}
+	}
+
+	switch req.Component {
+	case "schema":
+		normalized, err := normalizeSchemaData(req.Data)
+		if err != nil {
+			return nil, err
+		}
+		req.Data = normalized
+	case "code":
+		normalized, err := normalizeCodeData(req.Data)
+		if err != nil {
+			return nil, err
+		}
+		req.Data = normalized
 	}
 
 	oldProgress := project.Progress
@@ -90,9 +118,15 @@ func (s *ProjectProgressService) UpdateProgress(projectID, userID string, req dt
 		xpEarned = xp
 		milestonesUnlocked = milestones
 	case "simulation":
-		xp, milestones := s.updateSimulationProgress(project, userID, req.Data, req.Action == "run")
-		xpEarned = xp
-		milestonesUnlocked = milestones
+		// Simulation progress comes from the runs of the project's simulation
+		if req.Action == "run" {
+			projectRun, err := NewSimulationService(s.progressDB).RunProject(project, userID, 0)
+			if err != nil {
+				return nil, err
+			}
+			xpEarned = projectRun.Response.XPEarned
+			milestonesUnlocked = append(milestonesUnlocked, projectRun.Response.Milestones...)
+		}
 	case "verification":
 		xp, milestones := s.updateVerificationProgress(project, userID)
 		xpEarned = xp
@@ -106,9 +140,12 @@ func (s *ProjectProgressService) UpdateProgress(projectID, userID string, req dt
 
 	// Update project
 	s.progressDB.Save(project)
+	if req.Component == "schema" || req.Component == "code" {
+		s.versions.RecordSave(project, userID)
+	}
 
-	// Award XP to user
-	if xpEarned > 0 {
+	// Award XP to user; the runs of the simulation award their own
+	if xpEarned > 0 && req.Component != "simulation" {
 		s.awardXP(userID, xpEarned, projectID, "project_progress")
 	}
 
@@ -121,20 +158,26 @@ func (s *ProjectProgressService) UpdateProgress(projectID, userID string, req dt
 	}, nil
 }
 
-// SaveSchema saves circuit schema data
+// SaveSchema saves circuit schema data. It is refused while a live editing
+// session has the project open; changes then go through the session.
 func (s *ProjectProgressService) SaveSchema(projectID, userID string, req dto.SaveSchemaRequest) (*dto.SaveSchemaResponse, error) {
+	if err := checkNoLiveSession(projectID); err != nil {
+		return nil, err
+	}
+	return s.saveSchema(projectID, userID, req)
+}
+
+// saveSchema saves circuit schema data, also for live editing sessions
+func (s *ProjectProgressService) saveSchema(projectID, userID string, req dto.SaveSchemaRequest) (*dto.SaveSchemaResponse, error) {
 	project, err := s.repo.FindByID(projectID)
 	if err != nil {
 		return nil, errors.New("project not found")
 	}
 
-	if !s.hasAccess(project, userID) {
-		return nil, errors.New("access denied")
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
 	}
 
-	oldProgress := project.Progress
-	isFirstSave := len(project.SchemaData) == 0 || string(project.SchemaData) == "{}" || string(project.SchemaData) == "null"
-
 	// Build schema data
 	schemaData := map[string]interface{}{
 		"components":      req.Components,
@@ -143,27 +186,44 @@ func (s *ProjectProgressService) SaveSchema(projectID, userID string, req dto.Sa
 		"last_saved":      time.Now().Format(time.RFC3339),
 	}
 	schemaJSON, _ := json.Marshal(schemaData)
-	project.SchemaData = datatypes.JSON(schemaJSON)
+	normalized, err := normalizeSchemaData(schemaJSON)
+	if err != nil {
+		return nil, err
+	}
 
-	// Calculate XP
-	xpEarned := 0
-	if isFirstSave {
-		if !s.hasMilestone(projectID, models.MilestoneFirstSchemaSave) {
-			xpEarned = models.XPFirstSchemaSave
-			s.createMilestone(projectID, userID, models.MilestoneFirstSchemaSave, xpEarned)
+	// The project row stays locked while the schema is saved, so the
+	// progress is computed from the code stored at that moment
+	oldProgress := project.Progress
+	isFirstSave := false
+	err = s.progressDB.Transaction(func(tx *gorm.DB) error {
+		var stored models.Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "schema_data", "code_data").First(&stored, "id = ?", projectID).Error; err != nil {
+			return errors.New("project not found")
 		}
+		isFirstSave = len(stored.SchemaData) == 0 || string(stored.SchemaData) == "{}" || string(stored.SchemaData) == "null"
+		project.SchemaData = normalized
+		project.CodeData = stored.CodeData
+
+		// Recalculate progress
+		breakdown := s.calculateBreakdown(project)
+		project.Progress = s.calculateTotalProgress(breakdown)
+
+		return tx.Model(project).Updates(map[string]interface{}{
+			"schema_data": project.SchemaData,
+			"progress":    project.Progress,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	// Recalculate progress
-	breakdown := s.calculateBreakdown(project)
-	newProgress := s.calculateTotalProgress(breakdown)
-	project.Progress = newProgress
-
-	// Save project
-	s.progressDB.Save(project)
+	newProgress := project.Progress
+	s.versions.RecordSave(project, userID)
 
 	// Award XP
-	if xpEarned > 0 {
+	xpEarned := 0
+	if isFirstSave && !s.hasMilestone(projectID, models.MilestoneFirstSchemaSave) {
+		xpEarned = models.XPFirstSchemaSave
+		s.createMilestone(projectID, userID, models.MilestoneFirstSchemaSave, xpEarned)
 		s.awardXP(userID, xpEarned, projectID, "first_schema_save")
 	}
 
@@ -176,71 +236,148 @@ func (s *ProjectProgressService) SaveSchema(projectID, userID string, req dto.Sa
 	}, nil
 }
 
-// SaveCode saves code data
+// SaveCode saves code data: a whole workspace, or one file in the
+// single-file form of older clients
 func (s *ProjectProgressService) SaveCode(projectID, userID string, req dto.SaveCodeRequest) (*dto.SaveCodeResponse, error) {
+	if req.Files == nil && req.Content == nil {
+		return nil, errors.New("files or content is required")
+	}
+
+	return s.updateCode(projectID, userID, func(ws *workspace.Workspace) error {
+		if req.Files == nil {
+			target := req.Filename
+			if target == "" {
+				target = ws.Main
+			}
+			if target == "" {
+				target = workspace.DefaultPath(req.Language)
+			}
+			// A single-file workspace is renamed along, as the file was before
+			if len(ws.Files) == 1 && req.Filename != "" && ws.File(target) == nil {
+				if err := ws.Move(ws.Files[0].Path, target); err != nil {
+					return err
+				}
+			}
+			_, err := ws.Put(target, req.Language, *req.Content)
+			return err
+		}
+
+		next := workspace.New()
+		for _, folder := range req.Folders {
+			if err := next.AddFolder(folder); err != nil {
+				return err
+			}
+		}
+		for _, f := range req.Files {
+			if _, err := next.Put(f.Path, f.Language, f.Content); err != nil {
+				return err
+			}
+		}
+		if req.Main != "" {
+			if err := next.SetMain(req.Main); err != nil {
+				return err
+			}
+		}
+		*ws = *next
+		return nil
+	})
+}
+
+// updateCode applies a change to a project's code workspace and saves it.
+// It is refused while a live editing session has the project open.
+func (s *ProjectProgressService) updateCode(projectID, userID string, change func(ws *workspace.Workspace) error) (*dto.SaveCodeResponse, error) {
+	if err := checkNoLiveSession(projectID); err != nil {
+		return nil, err
+	}
+	return s.writeCode(projectID, userID, change)
+}
+
+// writeCode applies a change to a project's code workspace and saves it,
+// also for live editing sessions. The project row stays locked while the
+// change is made, so concurrent saves of different files do not overwrite
+// each other.
+func (s *ProjectProgressService) writeCode(projectID, userID string, change func(ws *workspace.Workspace) error) (*dto.SaveCodeResponse, error) {
 	project, err := s.repo.FindByID(projectID)
 	if err != nil {
 		return nil, errors.New("project not found")
 	}
 
-	if !s.hasAccess(project, userID) {
-		return nil, errors.New("access denied")
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
 	}
 
 	oldProgress := project.Progress
-	isFirstSave := len(project.CodeData) == 0 || string(project.CodeData) == "{}" || string(project.CodeData) == "null"
-
-	// Build code data
-	codeData := map[string]interface{}{
-		"content":    req.Content,
-		"language":   req.Language,
-		"filename":   req.Filename,
-		"last_saved": time.Now().Format(time.RFC3339),
-	}
-	codeJSON, _ := json.Marshal(codeData)
-	project.CodeData = datatypes.JSON(codeJSON)
+	isFirstSave := false
+	var ws *workspace.Workspace
+	err = s.progressDB.Transaction(func(tx *gorm.DB) error {
+		var stored models.Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "code_data").First(&stored, "id = ?", projectID).Error; err != nil {
+			return errors.New("project not found")
+		}
+		if ws, err = workspace.Parse(stored.CodeData); err != nil {
+			return err
+		}
+		isFirstSave = ws.IsEmpty()
+		if err := change(ws); err != nil {
+			return err
+		}
 
-	// Calculate XP
-	xpEarned := 0
-	if isFirstSave && len(req.Content) >= 100 {
-		if !s.hasMilestone(projectID, models.MilestoneFirstCodeSave) {
-			xpEarned = models.XPFirstCodeSave
-			s.createMilestone(projectID, userID, models.MilestoneFirstCodeSave, xpEarned)
+		ws.LastSaved = time.Now().Format(time.RFC3339)
+		codeJSON, err := ws.Marshal()
+		if err != nil {
+			return err
 		}
-	}
+		project.CodeData = datatypes.JSON(codeJSON)
 
-	// Recalculate progress
-	breakdown := s.calculateBreakdown(project)
-	newProgress := s.calculateTotalProgress(breakdown)
-	project.Progress = newProgress
+		// Recalculate progress
+		breakdown := s.calculateBreakdown(project)
+		project.Progress = s.calculateTotalProgress(breakdown)
 
-	// Save project
-	s.progressDB.Save(project)
+		return tx.Model(project).Updates(map[string]interface{}{
+			"code_data": project.CodeData,
+			"progress":  project.Progress,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.versions.RecordSave(project, userID)
 
-	// Award XP
-	if xpEarned > 0 {
+	// The first code that does something earns XP, not an empty template
+	check := checkCode(ws)
+	xpEarned := 0
+	if check.Functions > 0 && !s.hasMilestone(projectID, models.MilestoneFirstCodeSave) {
+		xpEarned = models.XPFirstCodeSave
+		s.createMilestone(projectID, userID, models.MilestoneFirstCodeSave, xpEarned)
 		s.awardXP(userID, xpEarned, projectID, "first_code_save")
 	}
 
+	charCount := 0
+	for _, f := range ws.Files {
+		charCount += len(f.Content)
+	}
+
 	return &dto.SaveCodeResponse{
 		Success:        true,
-		Progress:       newProgress,
-		ProgressChange: newProgress - oldProgress,
+		Progress:       project.Progress,
+		ProgressChange: project.Progress - oldProgress,
 		XPEarned:       xpEarned,
 		IsFirstSave:    isFirstSave,
-		CharCount:      len(req.Content),
+		CharCount:      charCount,
+		Code:           check,
 	}, nil
 }
 
-// RunSimulation runs simulation and returns results
+// RunSimulation queues a run of the project's simulation, or runs it and
+// returns its results when there is no job queue
 func (s *ProjectProgressService) RunSimulation(projectID, userID string, req dto.RunSimulationRequest) (*dto.RunSimulationResponse, error) {
 	project, err := s.repo.FindByID(projectID)
 	if err != nil {
 		return nil, errors.New("project not found")
 	}
 
-	if !s.hasAccess(project, userID) {
-		return nil, errors.New("access denied")
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
 	}
 
 	// Check if schema and code exist
@@ -253,74 +390,44 @@ func (s *ProjectProgressService) RunSimulation(projectID, userID string, req dto
 
 	oldProgress := project.Progress
 
-	// Simulate the circuit (for now, always success - in production, actual simulation logic)
-	simulationSuccess := true // TODO: Implement actual simulation engine
-
-	xpEarned := 0
-	milestonesUnlocked := []string{}
-
-	// First simulation milestone
-	if !s.hasMilestone(projectID, models.MilestoneFirstSimulation) {
-		xpEarned += models.XPFirstSimulationRun
-		milestonesUnlocked = append(milestonesUnlocked, string(models.MilestoneFirstSimulation))
-		s.createMilestone(projectID, userID, models.MilestoneFirstSimulation, models.XPFirstSimulationRun)
-	}
-
-	// Simulation success milestone
-	if simulationSuccess {
-		if !s.hasMilestone(projectID, models.MilestoneSimulationSuccess) {
-			xpEarned += models.XPSimulationSuccess
-			milestonesUnlocked = append(milestonesUnlocked, string(models.MilestoneSimulationSuccess))
-			s.createMilestone(projectID, userID, models.MilestoneSimulationSuccess, models.XPSimulationSuccess)
+	// Run the circuit on the project's simulation; it only counts as a
+	// success when it actually works. The run awards the XP and milestones.
+	projectRun, err := NewSimulationService(s.progressDB).RunProject(project, userID, req.DurationMs)
+	if err != nil {
+		return nil, err
+	}
+	run := projectRun.Response
+
+	// A queued run has no output yet; it is followed on the simulation's
+	// WebSocket or in its run history
+	var outputJSON []byte
+	if run.Status != models.RunStatusQueued {
+		output := simulator.Results{Analysis: run.Analysis, OperatingPoint: run.OperatingPoint, Transient: run.Transient}
+		if run.Transient != nil {
+			view := *run.Transient
+			view.Waveform = run.Transient.Waveform.Downsample(defaultWaveformPoints)
+			output.Transient = &view
 		}
+		outputJSON, _ = json.Marshal(output)
 	}
+	warnings := append(issueMessages(projectRun.Run.Warnings), projectRun.Notes...)
 
-	// Update simulation data
-	simData := map[string]interface{}{
-		"last_run_at":      time.Now().Format(time.RFC3339),
-		"last_run_success": simulationSuccess,
-		"duration_ms":      req.DurationMs,
-	}
-	simJSON, _ := json.Marshal(simData)
-	project.SimulationData = datatypes.JSON(simJSON)
-
-	// Recalculate progress
-	breakdown := s.calculateBreakdown(project)
-	newProgress := s.calculateTotalProgress(breakdown)
-	project.Progress = newProgress
-
-	// Save project
-	s.progressDB.Save(project)
-
-	// Award XP
-	if xpEarned > 0 {
-		s.awardXP(userID, xpEarned, projectID, "simulation_run")
-	}
-
-	// Create simulation record
-	simResult := &models.ProjectSimulationResult{
-		ProjectID:  projectID,
-		UserID:     userID,
-		Status:     models.SimulationStatusSuccess,
-		DurationMs: req.DurationMs,
-		XPEarned:   xpEarned,
-	}
-	s.progressDB.Create(simResult)
-
-	status := "success"
-	if !simulationSuccess {
-		status = "failed"
+	newProgress, err := s.RefreshProgress(projectID)
+	if err != nil {
+		newProgress = oldProgress
 	}
 
 	return &dto.RunSimulationResponse{
-		SimulationID: simResult.ID,
-		Status:       status,
+		SimulationID: projectRun.Simulation.ID,
+		RunID:        run.RunID,
+		Status:       run.Status,
 		Results: &dto.SimulationResults{
-			OutputData: datatypes.JSON(`{}`),
-			Errors:     []string{},
-			Warnings:   []string{},
+			OutputData: datatypes.JSON(outputJSON),
+			Errors:     issueMessages(projectRun.Run.Errors),
+			Warnings:   warnings,
 		},
-		XPEarned: xpEarned,
+		XPEarned:           run.XPEarned,
+		MilestonesUnlocked: run.Milestones,
 		ProgressUpdate: &dto.ProgressUpdateInfo{
 			Old: oldProgress,
 			New: newProgress,
@@ -328,6 +435,21 @@ func (s *ProjectProgressService) RunSimulation(projectID, userID string, req dto
 	}, nil
 }
 
+// RefreshProgress recalculates and stores the progress of a project, e.g.
+// after a run of its simulation
+func (s *ProjectProgressService) RefreshProgress(projectID string) (int, error) {
+	project, err := s.repo.FindByIDSimple(projectID)
+	if err != nil {
+		return 0, errors.New("project not found")
+	}
+
+	progress := s.calculateTotalProgress(s.calculateBreakdown(project))
+	if err := s.progressDB.Model(&models.Project{}).Where("id = ?", projectID).Update("progress", progress).Error; err != nil {
+		return 0, err
+	}
+	return progress, nil
+}
+
 // CompleteProject marks project as complete
 func (s *ProjectProgressService) CompleteProject(projectID, userID string) (*dto.CompleteProjectResponse, error) {
 	project, err := s.repo.FindByID(projectID)
@@ -402,11 +524,11 @@ func (s *ProjectProgressService) GetSchemaData(projectID, userID string) (dataty
 		return nil, errors.New("project not found")
 	}
 
-	if !s.hasAccess(project, userID) {
-		return nil, errors.New("access denied")
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
+		return nil, err
 	}
 
-	return project.SchemaData, nil
+	return upgradeSchemaData(project.SchemaData), nil
 }
 
 // GetCodeData returns code data for a project
@@ -416,31 +538,17 @@ func (s *ProjectProgressService) GetCodeData(projectID, userID string) (datatype
 		return nil, errors.New("project not found")
 	}
 
-	if !s.hasAccess(project, userID) {
-		return nil, errors.New("access denied")
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
+		return nil, err
 	}
 
-	return project.CodeData, nil
+	return upgradeCodeData(project.CodeData), nil
 }
 
 // ============================================
 // Helper Functions
 // ============================================
 
-func (s *ProjectProgressService) hasAccess(project *models.Project, userID string) bool {
-	if project.UserID == userID {
-		return true
-	}
-	// Check collaborators
-	for _, c := range project.Collaborators {
-		if c.UserID == userID {
-			return true
-		}
-	}
-	// Public projects are accessible too
-	return project.IsPublic
-}
-
 func (s *ProjectProgressService) calculateBreakdown(project *models.Project) *dto.ProgressBreakdown {
 	breakdown := &dto.ProgressBreakdown{
 		Schema:       &dto.ComponentProgress{Weight: models.ProgressWeightSchema},
@@ -460,28 +568,19 @@ func (s *ProjectProgressService) calculateBreakdown(project *models.Project) *dt
 		}
 	}
 
-	// Code check
-	if len(project.CodeData) > 0 && string(project.CodeData) != "{}" && string(project.CodeData) != "null" {
-		var codeData map[string]interface{}
-		json.Unmarshal(project.CodeData, &codeData)
-		if content, ok := codeData["content"].(string); ok {
-			charCount := len(content)
-			pct := models.GetCodeCompletionPercentage(charCount)
-			breakdown.Code.Percentage = pct
-			breakdown.Code.Earned = models.ProgressWeightCode * pct / 100
-			breakdown.Code.Complete = pct >= 100
-		}
+	// Code check: functions that do something and a sketch that compiles
+	if ws, err := workspace.Parse(project.CodeData); err == nil && !ws.IsEmpty() {
+		pct := checkCode(ws).Percentage
+		breakdown.Code.Percentage = pct
+		breakdown.Code.Earned = models.ProgressWeightCode * pct / 100
+		breakdown.Code.Complete = pct >= 100
 	}
 
-	// Simulation check
-	if len(project.SimulationData) > 0 && string(project.SimulationData) != "{}" && string(project.SimulationData) != "null" {
-		var simData map[string]interface{}
-		json.Unmarshal(project.SimulationData, &simData)
-		if success, ok := simData["last_run_success"].(bool); ok && success {
-			breakdown.Simulation.Complete = true
-			breakdown.Simulation.Earned = models.ProgressWeightSimulation
-			breakdown.Simulation.Percentage = 100
-		}
+	// Simulation check: the last run of the project's simulation completed
+	if simulation, err := s.simRepo.FindByProject(project.ID, project.UserID); err == nil && simulation.Status == models.SimStatusCompleted {
+		breakdown.Simulation.Complete = true
+		breakdown.Simulation.Earned = models.ProgressWeightSimulation
+		breakdown.Simulation.Percentage = 100
 	}
 
 	// Verification - based on completion
@@ -553,21 +652,31 @@ func (s *ProjectProgressService) getNextAction(breakdown *dto.ProgressBreakdown)
 }
 
 func (s *ProjectProgressService) hasMilestone(projectID string, milestoneType models.MilestoneType) bool {
+	return hasProjectMilestone(s.progressDB, projectID, milestoneType)
+}
+
+func (s *ProjectProgressService) createMilestone(projectID, userID string, milestoneType models.MilestoneType, xpEarned int) {
+	createProjectMilestone(s.progressDB, projectID, userID, milestoneType, xpEarned)
+}
+
+// hasProjectMilestone reports whether a project unlocked a milestone. The
+// simulation runs of a project unlock its simulation milestones too.
+func hasProjectMilestone(db *gorm.DB, projectID string, milestoneType models.MilestoneType) bool {
 	var count int64
-	s.progressDB.Model(&models.ProjectMilestone{}).
+	db.Model(&models.ProjectMilestone{}).
 		Where("project_id = ? AND milestone_type = ?", projectID, milestoneType).
 		Count(&count)
 	return count > 0
 }
 
-func (s *ProjectProgressService) createMilestone(projectID, userID string, milestoneType models.MilestoneType, xpEarned int) {
+func createProjectMilestone(db *gorm.DB, projectID, userID string, milestoneType models.MilestoneType, xpEarned int) {
 	milestone := &models.ProjectMilestone{
 		ProjectID:     projectID,
 		UserID:        userID,
 		MilestoneType: milestoneType,
 		XPEarned:      xpEarned,
 	}
-	s.progressDB.Create(milestone)
+	db.Create(milestone)
 }
 
 func (s *ProjectProgressService) awardXP(userID string, xpAmount int, sourceID, description string) {
@@ -651,7 +760,7 @@ func (s *ProjectProgressService) updateCodeProgress(project *models.Project, use
 	milestones := []string{}
 
 	isFirstSave := !s.hasMilestone(project.ID, models.MilestoneFirstCodeSave)
-	if isFirstSave {
+	if isFirstSave && codeDataCheck(data).Functions > 0 {
 		xpEarned = models.XPFirstCodeSave
 		milestones = append(milestones, string(models.MilestoneFirstCodeSave))
 		s.createMilestone(project.ID, userID, models.MilestoneFirstCodeSave, xpEarned)
@@ -660,23 +769,6 @@ func (s *ProjectProgressService) updateCodeProgress(project *models.Project, use
 	return xpEarned, milestones
 }
 
-func (s *ProjectProgressService) updateSimulationProgress(project *models.Project, userID string, data datatypes.JSON, isRun bool) (int, []string) {
-	project.SimulationData = data
-
-	xpEarned := 0
-	milestones := []string{}
-
-	if isRun {
-		if !s.hasMilestone(project.ID, models.MilestoneFirstSimulation) {
-			xpEarned += models.XPFirstSimulationRun
-			milestones = append(milestones, string(models.MilestoneFirstSimulation))
-			s.createMilestone(project.ID, userID, models.MilestoneFirstSimulation, models.XPFirstSimulationRun)
-		}
-	}
-
-	return xpEarned, milestones
-}
-
 func (s *ProjectProgressService) updateVerificationProgress(project *models.Project, userID string) (int, []string) {
 	xpEarned := 0
 	milestones := []string{}
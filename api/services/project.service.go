@@ -1,25 +1,40 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"nexfi-backend/api/repositories"
 	"nexfi-backend/dto"
 	"nexfi-backend/models"
+	"nexfi-backend/pkg/rabbitmq"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 // ProjectService handles project business logic
 type ProjectService struct {
-	repo     *repositories.ProjectRepository
-	userRepo *repositories.UserRepository
+	db            *gorm.DB
+	repo          *repositories.ProjectRepository
+	userRepo      *repositories.UserRepository
+	simRepo       *repositories.SimulationRepository
+	componentRepo *repositories.ComponentRepository
+	circuits      *CircuitService
+	versions      *ProjectVersionService
 }
 
 // NewProjectService creates a new ProjectService
 func NewProjectService(db *gorm.DB) *ProjectService {
 	return &ProjectService{
-		repo:     repositories.NewProjectRepository(db),
-		userRepo: repositories.NewUserRepository(db),
+		db:            db,
+		repo:          repositories.NewProjectRepository(db),
+		userRepo:      repositories.NewUserRepository(db),
+		simRepo:       repositories.NewSimulationRepository(db),
+		componentRepo: repositories.NewComponentRepository(db),
+		circuits:      NewCircuitService(db),
+		versions:      NewProjectVersionService(db),
 	}
 }
 
@@ -63,14 +78,9 @@ func (s *ProjectService) GetProject(projectID, userID string) (*dto.ProjectDetai
 		return nil, err
 	}
 
-	// Check access
-	hasAccess, err := s.repo.HasAccess(projectID, userID)
-	if err != nil {
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
 		return nil, err
 	}
-	if !hasAccess && !project.IsPublic {
-		return nil, errors.New("access denied")
-	}
 
 	return s.toProjectDetailResponse(project), nil
 }
@@ -108,9 +118,14 @@ func (s *ProjectService) UpdateProject(projectID, userID string, req dto.Project
 		return nil, errors.New("project not found")
 	}
 
-	// Check ownership
-	if project.UserID != userID {
-		return nil, errors.New("access denied")
+	// Editors may save the schema and code; everything else is the owner's
+	perm := models.ProjectPermEdit
+	if req.Name != "" || req.Description != "" || req.ThumbnailURL != "" || req.Difficulty != "" ||
+		req.Progress != nil || req.HardwarePlatform != "" || req.Tags != nil || req.IsPublic != nil || req.IsFavorite != nil {
+		perm = models.ProjectPermManage
+	}
+	if err := checkProjectPermission(s.repo, project, userID, perm); err != nil {
+		return nil, err
 	}
 
 	// Update fields
@@ -141,19 +156,32 @@ func (s *ProjectService) UpdateProject(projectID, userID string, req dto.Project
 	if req.IsFavorite != nil {
 		project.IsFavorite = *req.IsFavorite
 	}
+	if req.SchemaData != nil || req.CodeData != nil {
+		if err := checkNoLiveSession(projectID); err != nil {
+			return nil, err
+		}
+	}
 	if req.SchemaData != nil {
-		project.SchemaData = req.SchemaData
+		schemaData, err := normalizeSchemaData(req.SchemaData)
+		if err != nil {
+			return nil, err
+		}
+		project.SchemaData = schemaData
 	}
 	if req.CodeData != nil {
-		project.CodeData = req.CodeData
-	}
-	if req.SimulationData != nil {
-		project.SimulationData = req.SimulationData
+		codeData, err := normalizeCodeData(req.CodeData)
+		if err != nil {
+			return nil, err
+		}
+		project.CodeData = codeData
 	}
 
 	if err := s.repo.Update(project); err != nil {
 		return nil, err
 	}
+	if req.SchemaData != nil || req.CodeData != nil {
+		s.versions.RecordSave(project, userID)
+	}
 
 	response := s.toProjectResponse(project)
 	return &response, nil
@@ -175,10 +203,19 @@ func (s *ProjectService) DeleteProject(projectID, userID string) error {
 
 // DuplicateProject duplicates a project
 func (s *ProjectService) DuplicateProject(projectID, userID string) (*dto.ProjectResponse, error) {
+	original, err := s.repo.FindByIDSimple(projectID)
+	if err != nil {
+		return nil, errors.New("project not found")
+	}
+	if err := checkProjectPermission(s.repo, original, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
 	project, err := s.repo.DuplicateProject(projectID, userID)
 	if err != nil {
 		return nil, err
 	}
+	s.versions.RecordInitial(project, userID, "Duplicated from "+strings.TrimSuffix(project.Name, " (Copy)"))
 
 	response := s.toProjectResponse(project)
 	return &response, nil
@@ -230,38 +267,20 @@ func (s *ProjectService) GetCollaborators(projectID, userID string) ([]dto.Colla
 		return nil, err
 	}
 
-	// Check access
-	hasAccess, err := s.repo.HasAccess(projectID, userID)
-	if err != nil {
+	if err := checkProjectPermission(s.repo, project, userID, models.ProjectPermView); err != nil {
 		return nil, err
 	}
-	if !hasAccess && !project.IsPublic {
-		return nil, errors.New("access denied")
-	}
 
 	collaborators := make([]dto.CollaboratorResponse, len(project.Collaborators))
-	for i, c := range project.Collaborators {
-		collaborators[i] = dto.CollaboratorResponse{
-			ID:         c.ID,
-			UserID:     c.UserID,
-			Role:       string(c.Role),
-			InvitedAt:  c.InvitedAt,
-			AcceptedAt: c.AcceptedAt,
-		}
-		if c.User != nil {
-			collaborators[i].User = &dto.UserResponse{
-				ID:        c.User.ID,
-				Name:      c.User.Name,
-				Username:  c.User.Username,
-				AvatarURL: c.User.AvatarURL,
-			}
-		}
+	for i := range project.Collaborators {
+		collaborators[i] = toCollaboratorResponse(&project.Collaborators[i])
 	}
 
 	return collaborators, nil
 }
 
-// AddCollaborator adds a collaborator to a project
+// AddCollaborator invites a user to a project. The invitation grants nothing
+// until the user accepts it.
 func (s *ProjectService) AddCollaborator(projectID, ownerID string, req dto.AddCollaboratorRequest) (*dto.CollaboratorResponse, error) {
 	// Get project and verify ownership
 	project, err := s.repo.FindByIDSimple(projectID)
@@ -287,38 +306,60 @@ func (s *ProjectService) AddCollaborator(projectID, ownerID string, req dto.AddC
 	// Check if already a collaborator
 	existing, _ := s.repo.FindCollaborator(projectID, invitedUser.ID)
 	if existing != nil {
+		if existing.IsPending() {
+			return nil, errors.New("already invited")
+		}
 		return nil, errors.New("already a collaborator")
 	}
 
-	// Create collaborator
+	// Create the invitation
 	collaborator, err := s.repo.AddCollaborator(projectID, invitedUser.ID, req.Role)
 	if err != nil {
 		return nil, err
 	}
+	collaborator.User = invitedUser
 
-	return &dto.CollaboratorResponse{
-		ID:        collaborator.ID,
-		UserID:    collaborator.UserID,
-		Role:      string(collaborator.Role),
-		InvitedAt: collaborator.InvitedAt,
-		User: &dto.UserResponse{
-			ID:        invitedUser.ID,
-			Name:      invitedUser.Name,
-			Username:  invitedUser.Username,
-			AvatarURL: invitedUser.AvatarURL,
-		},
-	}, nil
+	s.notifyInvitation(project, collaborator, "invited")
+
+	response := toCollaboratorResponse(collaborator)
+	return &response, nil
 }
 
-// RemoveCollaborator removes a collaborator from a project
-func (s *ProjectService) RemoveCollaborator(projectID, ownerID, collaboratorUserID string) error {
-	// Get project and verify ownership
+// UpdateCollaboratorRole changes the role of a collaborator or invitee
+func (s *ProjectService) UpdateCollaboratorRole(projectID, ownerID, collaboratorUserID string, req dto.UpdateCollaboratorRequest) (*dto.CollaboratorResponse, error) {
 	project, err := s.repo.FindByIDSimple(projectID)
 	if err != nil {
-		return errors.New("project not found")
+		return nil, errors.New("project not found")
 	}
 
 	if project.UserID != ownerID {
+		return nil, errors.New("access denied")
+	}
+
+	collaborator, err := s.repo.FindCollaborator(projectID, collaboratorUserID)
+	if err != nil || collaborator == nil {
+		return nil, errors.New("collaborator not found")
+	}
+
+	collaborator.Role = models.CollaboratorRole(req.Role)
+	if err := s.repo.UpdateCollaborator(collaborator); err != nil {
+		return nil, err
+	}
+	collaborator.User, _ = s.userRepo.FindByID(collaboratorUserID)
+
+	response := toCollaboratorResponse(collaborator)
+	return &response, nil
+}
+
+// RemoveCollaborator removes a collaborator from a project. The owner can
+// remove anyone; collaborators can remove themselves to leave the project.
+func (s *ProjectService) RemoveCollaborator(projectID, userID, collaboratorUserID string) error {
+	project, err := s.repo.FindByIDSimple(projectID)
+	if err != nil {
+		return errors.New("project not found")
+	}
+
+	if project.UserID != userID && collaboratorUserID != userID {
 		return errors.New("access denied")
 	}
 
@@ -331,8 +372,172 @@ func (s *ProjectService) RemoveCollaborator(projectID, ownerID, collaboratorUser
 	return s.repo.RemoveCollaborator(collaborator.ID)
 }
 
+// ListInvitations lists the project invitations a user has not answered yet
+func (s *ProjectService) ListInvitations(userID string) ([]dto.ProjectInvitationResponse, error) {
+	invitations, err := s.repo.FindPendingInvitations(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]dto.ProjectInvitationResponse, 0, len(invitations))
+	for _, inv := range invitations {
+		if inv.Project == nil {
+			continue
+		}
+		project := s.toProjectResponse(inv.Project)
+		responses = append(responses, dto.ProjectInvitationResponse{
+			ID:        inv.ID,
+			Role:      string(inv.Role),
+			InvitedAt: inv.InvitedAt,
+			Project:   &project,
+		})
+	}
+	return responses, nil
+}
+
+// AcceptInvitation accepts the user's invitation to a project, granting the
+// invited role
+func (s *ProjectService) AcceptInvitation(projectID, userID string) (*dto.CollaboratorResponse, error) {
+	project, collaborator, err := s.findInvitation(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	collaborator.AcceptedAt = &now
+	if err := s.repo.UpdateCollaborator(collaborator); err != nil {
+		return nil, err
+	}
+	collaborator.User, _ = s.userRepo.FindByID(userID)
+
+	s.notifyInvitation(project, collaborator, "accepted")
+
+	response := toCollaboratorResponse(collaborator)
+	return &response, nil
+}
+
+// DeclineInvitation declines the user's invitation to a project. The owner
+// can invite the user again later.
+func (s *ProjectService) DeclineInvitation(projectID, userID string) error {
+	project, collaborator, err := s.findInvitation(projectID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.RemoveCollaborator(collaborator.ID); err != nil {
+		return err
+	}
+
+	s.notifyInvitation(project, collaborator, "declined")
+	return nil
+}
+
+// findInvitation finds a user's pending invitation to a project
+func (s *ProjectService) findInvitation(projectID, userID string) (*models.Project, *models.ProjectCollaborator, error) {
+	project, err := s.repo.FindByIDSimple(projectID)
+	if err != nil {
+		return nil, nil, errors.New("project not found")
+	}
+
+	collaborator, err := s.repo.FindCollaborator(projectID, userID)
+	if err != nil || collaborator == nil {
+		return nil, nil, errors.New("invitation not found")
+	}
+	if !collaborator.IsPending() {
+		return nil, nil, errors.New("invitation already accepted")
+	}
+	return project, collaborator, nil
+}
+
+// notifyInvitation tells the invitee about an invitation, or the owner about
+// its answer. Events are invited, accepted and declined.
+func (s *ProjectService) notifyInvitation(project *models.Project, collaborator *models.ProjectCollaborator, event string) {
+	recipientID, actorID := project.UserID, collaborator.UserID
+	if event == "invited" {
+		recipientID, actorID = collaborator.UserID, project.UserID
+	}
+	actorName := "Someone"
+	if actor, err := s.userRepo.FindByID(actorID); err == nil {
+		actorName = actor.Name
+	}
+
+	var title, message string
+	switch event {
+	case "invited":
+		title = "Project invitation"
+		message = fmt.Sprintf("%s invited you to collaborate on \"%s\" as %s.", actorName, project.Name, collaborator.Role)
+	case "accepted":
+		title = "Invitation accepted"
+		message = fmt.Sprintf("%s accepted your invitation to \"%s\".", actorName, project.Name)
+	default:
+		title = "Invitation declined"
+		message = fmt.Sprintf("%s declined your invitation to \"%s\".", actorName, project.Name)
+	}
+
+	job := rabbitmq.NotificationJob{
+		UserID:  recipientID,
+		Type:    string(models.NotifProject),
+		Title:   title,
+		Message: message,
+		Data: map[string]interface{}{
+			"project_id": project.ID,
+			"user_id":    actorID,
+			"role":       string(collaborator.Role),
+			"event":      "invitation_" + event,
+		},
+	}
+
+	if err := rabbitmq.PublishNotification(job); err != nil {
+		// Queue unavailable, store the notification directly
+		data, _ := json.Marshal(job.Data)
+		s.db.Create(&models.Notification{
+			UserID:  job.UserID,
+			Type:    models.NotifProject,
+			Title:   job.Title,
+			Message: job.Message,
+			Data:    data,
+		})
+	}
+}
+
 // Helper functions
 
+// checkProjectPermission returns "access denied" unless the user's role on
+// the project allows the action. Anyone may view a public project; pending
+// invitations grant nothing.
+func checkProjectPermission(repo *repositories.ProjectRepository, project *models.Project, userID string, perm models.ProjectPermission) error {
+	if perm == models.ProjectPermView && project.IsPublic {
+		return nil
+	}
+	role, err := repo.FindRole(project.ID, userID)
+	if err != nil {
+		return err
+	}
+	if !role.Can(perm) {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+func toCollaboratorResponse(c *models.ProjectCollaborator) dto.CollaboratorResponse {
+	response := dto.CollaboratorResponse{
+		ID:         c.ID,
+		UserID:     c.UserID,
+		Role:       string(c.Role),
+		InvitedAt:  c.InvitedAt,
+		AcceptedAt: c.AcceptedAt,
+	}
+	if c.User != nil {
+		response.User = &dto.UserResponse{
+			ID:        c.User.ID,
+			Name:      c.User.Name,
+			Username:  c.User.Username,
+			AvatarURL: c.User.AvatarURL,
+		}
+	}
+	return response
+}
+
 func (s *ProjectService) toProjectResponse(p *models.Project) dto.ProjectResponse {
 	response := dto.ProjectResponse{
 		ID:                 p.ID,
@@ -406,12 +611,20 @@ func (s *ProjectService) toProjectDetailResponse(p *models.Project) *dto.Project
 		}
 	}
 
-	return &dto.ProjectDetailResponse{
+	response := &dto.ProjectDetailResponse{
 		ProjectResponse: base,
 		SchemaData:      p.SchemaData,
-		CodeData:        p.CodeData,
-		SimulationData:  p.SimulationData,
+		CodeData:        upgradeCodeData(p.CodeData),
 		Components:      components,
 		Collaborators:   collaborators,
 	}
+	if simulation, err := s.simRepo.FindByProject(p.ID, p.UserID); err == nil {
+		response.Simulation = &dto.ProjectSimulationInfo{
+			ID:        simulation.ID,
+			Status:    string(simulation.Status),
+			RunCount:  simulation.RunCount,
+			LastRunAt: simulation.LastRunAt,
+		}
+	}
+	return response
 }
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nexfi-backend/api/repositories"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/textdiff"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ============================================
+// Project Version History
+// ============================================
+
+const (
+	// versionCoalesceWindow is how long saves keep updating the latest
+	// automatic version instead of starting a new one
+	versionCoalesceWindow = 10 * time.Minute
+	// maxAutoVersions automatic versions are kept per project; checkpoints
+	// are kept regardless
+	maxAutoVersions = 100
+	// codeDiffContext unchanged lines surround each change of a code diff
+	codeDiffContext = 3
+)
+
+// ProjectVersionService handles the version history of projects
+type ProjectVersionService struct {
+	repo *repositories.ProjectRepository
+	db   *gorm.DB
+}
+
+// NewProjectVersionService creates a new ProjectVersionService
+func NewProjectVersionService(db *gorm.DB) *ProjectVersionService {
+	return &ProjectVersionService{
+		repo: repositories.NewProjectRepository(db),
+		db:   db,
+	}
+}
+
+// RecordSave snapshots a project after its schema or code was saved. Saves
+// by the same user within the coalesce window of the latest automatic
+// version's creation update it; other saves start a new version. The window
+// does not slide with each save, so autosaves still add a version every
+// window.
+func (s *ProjectVersionService) RecordSave(project *models.Project, userID string) {
+	latest, err := s.repo.FindLatestVersion(project.ID)
+	if err == nil && !latest.IsCheckpoint() && latest.RestoredFromID == nil &&
+		latest.UserID == userID && time.Since(latest.CreatedAt) < versionCoalesceWindow {
+		if sameContent(latest, project) {
+			return
+		}
+		snapshot(latest, project)
+		latest.SaveCount++
+		if err := s.repo.UpdateVersion(latest); err != nil {
+			log.Printf("Warning: failed to update version %s of project %s: %v", latest.ID, project.ID, err)
+		}
+		return
+	}
+	if err == nil && sameContent(latest, project) {
+		return
+	}
+
+	s.recordVersion(project, userID, "", "Saved", nil)
+}
+
+// RecordInitial snapshots a project created with content, e.g. by import or
+// duplication, so its first save does not lose the original
+func (s *ProjectVersionService) RecordInitial(project *models.Project, userID, message string) {
+	if isEmptySchema(project.SchemaData) && isEmptySchema(project.CodeData) {
+		return
+	}
+	s.recordVersion(project, userID, "", message, nil)
+}
+
+// ListVersions lists a project's versions, newest first
+func (s *ProjectVersionService) ListVersions(projectID, userID string, req dto.ProjectVersionListRequest) ([]dto.ProjectVersionResponse, dto.PaginationResponse, error) {
+	if _, err := s.findProject(projectID, userID, models.ProjectPermView); err != nil {
+		return nil, dto.PaginationResponse{}, err
+	}
+
+	versions, total, err := s.repo.FindVersions(projectID, req.Checkpoints, req.Page, req.Limit)
+	if err != nil {
+		return nil, dto.PaginationResponse{}, err
+	}
+
+	responses := make([]dto.ProjectVersionResponse, len(versions))
+	for i := range versions {
+		responses[i] = s.toVersionResponse(&versions[i])
+	}
+
+	return responses, dto.PaginationResponse{
+		Page:       req.Page,
+		Limit:      req.Limit,
+		Total:      int(total),
+		TotalPages: (int(total) + req.Limit - 1) / req.Limit,
+	}, nil
+}
+
+// GetVersion gets a single version including its schema and code
+func (s *ProjectVersionService) GetVersion(projectID, versionID, userID string) (*dto.ProjectVersionDetailResponse, error) {
+	if _, err := s.findProject(projectID, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
+	version, err := s.repo.FindVersionByID(projectID, versionID)
+	if err != nil {
+		return nil, errors.New("version not found")
+	}
+
+	return &dto.ProjectVersionDetailResponse{
+		ProjectVersionResponse: s.toVersionResponse(version),
+		SchemaData:             upgradeSchemaData(version.SchemaData),
+		CodeData:               version.CodeData,
+	}, nil
+}
+
+// CreateCheckpoint names the project's current state. When the latest
+// automatic version already holds it, that version is named; otherwise a
+// new version is recorded.
+func (s *ProjectVersionService) CreateCheckpoint(projectID, userID string, req dto.CreateCheckpointRequest) (*dto.ProjectVersionResponse, error) {
+	project, err := s.findProject(projectID, userID, models.ProjectPermEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	latest, err := s.repo.FindLatestVersion(projectID)
+	if err == nil && !latest.IsCheckpoint() && sameContent(latest, project) {
+		latest.Name = name
+		if req.Message != "" {
+			latest.Message = req.Message
+		}
+		if err := s.repo.UpdateVersion(latest); err != nil {
+			return nil, err
+		}
+		resp := s.toVersionResponse(latest)
+		return &resp, nil
+	}
+
+	message := req.Message
+	if message == "" {
+		message = "Checkpoint"
+	}
+	version, err := s.recordVersion(project, userID, name, message, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp := s.toVersionResponse(version)
+	return &resp, nil
+}
+
+// UpdateVersion names or renames a version; an empty name makes it an
+// automatic version again
+func (s *ProjectVersionService) UpdateVersion(projectID, versionID, userID string, req dto.UpdateVersionRequest) (*dto.ProjectVersionResponse, error) {
+	if _, err := s.findProject(projectID, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
+	}
+
+	version, err := s.repo.FindVersionByID(projectID, versionID)
+	if err != nil {
+		return nil, errors.New("version not found")
+	}
+	version.Name = strings.TrimSpace(req.Name)
+	if req.Message != nil {
+		version.Message = *req.Message
+	}
+	if err := s.repo.UpdateVersion(version); err != nil {
+		return nil, err
+	}
+
+	resp := s.toVersionResponse(version)
+	return &resp, nil
+}
+
+// DiffVersions compares two versions: the schema structurally and the code
+// line by line. Without a target version, the project's current state is
+// the target.
+func (s *ProjectVersionService) DiffVersions(projectID, userID string, req dto.ProjectVersionDiffRequest) (*dto.ProjectVersionDiffResponse, error) {
+	project, err := s.findProject(projectID, userID, models.ProjectPermView)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := s.repo.FindVersionByID(projectID, req.From)
+	if err != nil {
+		return nil, errors.New("version not found")
+	}
+	toSchema, toCode := project.SchemaData, project.CodeData
+	var toResp *dto.ProjectVersionResponse
+	if req.To != "" {
+		to, err := s.repo.FindVersionByID(projectID, req.To)
+		if err != nil {
+			return nil, errors.New("version not found")
+		}
+		toSchema, toCode = to.SchemaData, to.CodeData
+		resp := s.toVersionResponse(to)
+		toResp = &resp
+	}
+
+	fromParsed, err := schematic.Parse(upgradeSchemaData(from.SchemaData))
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+	toParsed, err := schematic.Parse(upgradeSchemaData(toSchema))
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+
+	fromResp := s.toVersionResponse(from)
+	return &dto.ProjectVersionDiffResponse{
+		From:   &fromResp,
+		To:     toResp,
+		Schema: schematic.Diff(fromParsed, toParsed),
+		Code:   diffCode(from.CodeData, toCode),
+	}, nil
+}
+
+// RestoreVersion makes an old version current again by saving it as a new
+// version, so the state it replaces stays in the history
+func (s *ProjectVersionService) RestoreVersion(projectID, versionID, userID string, req dto.RestoreVersionRequest) (*dto.ProjectVersionResponse, error) {
+	project, err := s.findProject(projectID, userID, models.ProjectPermEdit)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNoLiveSession(projectID); err != nil {
+		return nil, err
+	}
+
+	version, err := s.repo.FindVersionByID(projectID, versionID)
+	if err != nil {
+		return nil, errors.New("version not found")
+	}
+
+	schemaData := upgradeSchemaData(version.SchemaData)
+	err = s.repo.RestoreContent(projectID, schemaData, version.CodeData, func(current *models.Project) *models.ProjectVersion {
+		// The state being replaced is kept when no version holds it yet
+		if latest, err := s.repo.FindLatestVersion(projectID); err == nil && sameContent(latest, current) {
+			return nil
+		}
+		before := &models.ProjectVersion{
+			ProjectID: projectID,
+			UserID:    userID,
+			Message:   fmt.Sprintf("Before restoring version %d", version.VersionNumber),
+			SaveCount: 1,
+		}
+		snapshot(before, current)
+		return before
+	})
+	if err != nil {
+		return nil, err
+	}
+	project.SchemaData = schemaData
+	project.CodeData = version.CodeData
+	if _, err := NewProjectProgressService(s.db).RefreshProgress(projectID); err != nil {
+		log.Printf("Warning: failed to refresh progress of project %s: %v", projectID, err)
+	}
+
+	message := req.Message
+	if message == "" {
+		message = fmt.Sprintf("Restored version %d", version.VersionNumber)
+		if version.IsCheckpoint() {
+			message = fmt.Sprintf("Restored %q", version.Name)
+		}
+	}
+	restored, err := s.recordVersion(project, userID, "", message, &version.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := s.toVersionResponse(restored)
+	return &resp, nil
+}
+
+// findProject finds a project the user's role allows the action on
+func (s *ProjectVersionService) findProject(projectID, userID string, perm models.ProjectPermission) (*models.Project, error) {
+	project, err := s.repo.FindByIDSimple(projectID)
+	if err != nil {
+		return nil, errors.New("project not found")
+	}
+	if err := checkProjectPermission(s.repo, project, userID, perm); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// recordVersion snapshots the project's current state as a new version
+func (s *ProjectVersionService) recordVersion(project *models.Project, userID, name, message string, restoredFromID *string) (*models.ProjectVersion, error) {
+	version := &models.ProjectVersion{
+		ProjectID:      project.ID,
+		UserID:         userID,
+		Name:           name,
+		Message:        message,
+		SaveCount:      1,
+		RestoredFromID: restoredFromID,
+	}
+	snapshot(version, project)
+	if err := s.repo.CreateVersion(version); err != nil {
+		log.Printf("Warning: failed to record version for project %s: %v", project.ID, err)
+		return nil, err
+	}
+	if err := s.repo.PruneVersions(project.ID, maxAutoVersions); err != nil {
+		log.Printf("Warning: failed to prune versions of project %s: %v", project.ID, err)
+	}
+	return version, nil
+}
+
+// snapshot copies a project's schema and code into a version
+func snapshot(version *models.ProjectVersion, project *models.Project) {
+	version.SchemaData = project.SchemaData
+	version.CodeData = project.CodeData
+	version.ComponentsCount, version.WiresCount = 0, 0
+	if schema, err := schematic.Parse(project.SchemaData); err == nil {
+		version.ComponentsCount, version.WiresCount = len(schema.Components), len(schema.Wires)
+	}
+}
+
+// sameContent reports whether a version holds a project's schema and code.
+// The time of the save stored with them does not count.
+func sameContent(version *models.ProjectVersion, project *models.Project) bool {
+	return bytes.Equal(withoutSaveTime(version.SchemaData), withoutSaveTime(project.SchemaData)) &&
+		bytes.Equal(withoutSaveTime(version.CodeData), withoutSaveTime(project.CodeData))
+}
+
+// withoutSaveTime re-encodes schema or code data without its last_saved field
+func withoutSaveTime(data datatypes.JSON) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return data
+	}
+	delete(fields, "last_saved")
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return data
+	}
+	return stripped
+}
+
+// codeFiles reads the files of a project's code, by path
+func codeFiles(data datatypes.JSON) map[string]string {
+	files := map[string]string{}
+	for _, f := range codeWorkspace(data).Files {
+		files[f.Path] = f.Content
+	}
+	return files
+}
+
+// diffCode diffs the code of two versions file by file; files are matched
+// by name and unchanged files are left out
+func diffCode(from, to datatypes.JSON) []dto.CodeFileDiff {
+	fromFiles, toFiles := codeFiles(from), codeFiles(to)
+	names := []string{}
+	for name := range fromFiles {
+		names = append(names, name)
+	}
+	for name := range toFiles {
+		if _, ok := fromFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := []dto.CodeFileDiff{}
+	for _, name := range names {
+		oldText, inFrom := fromFiles[name]
+		newText, inTo := toFiles[name]
+		diff := textdiff.Lines(oldText, newText, codeDiffContext)
+		if diff.IsEmpty() && inFrom && inTo {
+			continue
+		}
+
+		status := "modified"
+		fromName, toName := "a/"+name, "b/"+name
+		switch {
+		case !inFrom:
+			status, fromName = "added", "/dev/null"
+		case !inTo:
+			status, toName = "removed", "/dev/null"
+		}
+		diffs = append(diffs, dto.CodeFileDiff{
+			File:    name,
+			Status:  status,
+			Diff:    diff,
+			Unified: diff.Unified(fromName, toName),
+		})
+	}
+	return diffs
+}
+
+func (s *ProjectVersionService) toVersionResponse(v *models.ProjectVersion) dto.ProjectVersionResponse {
+	resp := dto.ProjectVersionResponse{
+		ID:              v.ID,
+		VersionNumber:   v.VersionNumber,
+		Name:            v.Name,
+		Message:         v.Message,
+		IsCheckpoint:    v.IsCheckpoint(),
+		AuthorID:        v.UserID,
+		ComponentsCount: v.ComponentsCount,
+		WiresCount:      v.WiresCount,
+		SaveCount:       v.SaveCount,
+		RestoredFromID:  v.RestoredFromID,
+		CreatedAt:       v.CreatedAt,
+		UpdatedAt:       v.UpdatedAt,
+	}
+	if v.User != nil {
+		resp.AuthorName = v.User.Name
+	}
+	return resp
+}
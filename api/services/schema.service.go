@@ -0,0 +1,103 @@
+package services
+
+import (
+	"log"
+	"nexfi-backend/pkg/schematic"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// schemaTables are the tables storing schematic documents in schema_data.
+// Circuit revisions are history and stay as they were saved; they are
+// upgraded in memory when read.
+var schemaTables = []string{"circuits", "circuit_templates", "simulations", "projects"}
+
+// SchemaService keeps stored schema documents on the current format version
+type SchemaService struct {
+	db *gorm.DB
+}
+
+// NewSchemaService creates a new SchemaService
+func NewSchemaService(db *gorm.DB) *SchemaService {
+	return &SchemaService{db: db}
+}
+
+// MigrateAll upgrades every stored document older than the current version,
+// batchSize rows at a time. It returns the number of upgraded rows per table.
+func (s *SchemaService) MigrateAll(batchSize int) (map[string]int, error) {
+	upgraded := map[string]int{}
+
+	for _, table := range schemaTables {
+		var rows []struct {
+			ID         string
+			SchemaData datatypes.JSON
+		}
+
+		// Unversioned (v1) documents have no version key; a version that is
+		// not a number is left for Upgrade to report when the row is read
+		err := s.db.Table(table).
+			Select("id, schema_data").
+			Where("schema_data IS NOT NULL AND schema_data::text NOT IN ('{}', 'null')").
+			Where(`CASE
+				WHEN schema_data->'version' IS NULL THEN true
+				WHEN jsonb_typeof(schema_data->'version') = 'number' THEN (schema_data->>'version')::numeric < ?
+				ELSE false
+			END`, schematic.CurrentVersion).
+			FindInBatches(&rows, batchSize, func(tx *gorm.DB, batch int) error {
+				for _, row := range rows {
+					data, _, changed, err := schematic.Upgrade(row.SchemaData)
+					if err != nil {
+						log.Printf("Warning: cannot upgrade %s %s: %v", table, row.ID, err)
+						continue
+					}
+					if !changed {
+						continue
+					}
+					if err := s.db.Table(table).Where("id = ?", row.ID).
+						UpdateColumn("schema_data", datatypes.JSON(data)).Error; err != nil {
+						return err
+					}
+					upgraded[table]++
+				}
+				return nil
+			}).Error
+		if err != nil {
+			return upgraded, err
+		}
+	}
+
+	return upgraded, nil
+}
+
+// normalizeSchemaData upgrades and validates schema data received from a client.
+// Validation failures are returned as *schematic.ValidationError.
+func normalizeSchemaData(data datatypes.JSON) (datatypes.JSON, error) {
+	if isEmptySchema(data) {
+		return data, nil
+	}
+
+	normalized, err := schematic.Normalize(data)
+	if err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// isEmptySchema reports documents that were never edited; they stay untouched
+func isEmptySchema(data datatypes.JSON) bool {
+	return len(data) == 0 || string(data) == "{}" || string(data) == "null"
+}
+
+// upgradeSchemaData upgrades a stored document in memory, as it is read or
+// before copying it. Stored documents are left to cmd/migrate-schemas.
+func upgradeSchemaData(data datatypes.JSON) datatypes.JSON {
+	if isEmptySchema(data) {
+		return data
+	}
+	upgraded, _, _, err := schematic.Upgrade(data)
+	if err != nil {
+		return data
+	}
+	return upgraded
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/simulator"
+	"strings"
+)
+
+// ============================================
+// Run Comparison
+// ============================================
+
+// CompareRuns compares the results of two runs of a simulation. Run A
+// defaults to the golden run and run B to the latest run.
+func (s *SimulationService) CompareRuns(simulationID, userID string, req dto.CompareRunsRequest) (*dto.CompareRunsResponse, error) {
+	simulation, err := s.repo.FindByID(simulationID)
+	if err != nil {
+		return nil, errors.New("simulation not found")
+	}
+
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
+	if req.A == "" {
+		if simulation.GoldenRunID == nil {
+			return nil, errors.New("no golden run")
+		}
+		req.A = *simulation.GoldenRunID
+	}
+	runA, err := s.repo.GetRunByID(simulationID, req.A)
+	if err != nil {
+		return nil, errors.New("run not found")
+	}
+
+	var runB *models.SimulationRun
+	if req.B == "" {
+		runB, err = s.repo.GetLatestRun(simulationID)
+	} else {
+		runB, err = s.repo.GetRunByID(simulationID, req.B)
+	}
+	if err != nil {
+		return nil, errors.New("run not found")
+	}
+
+	if !runFinished(runA) || !runFinished(runB) {
+		return nil, errors.New("run not finished")
+	}
+
+	var resultA, resultB simulator.Results
+	if json.Unmarshal(runA.ResultData, &resultA) != nil || json.Unmarshal(runB.ResultData, &resultB) != nil {
+		return nil, errors.New("run has no results")
+	}
+
+	comparison := simulator.Compare(&resultA, &resultB, simulator.CompareOptions{
+		AbsTol:     req.AbsTol,
+		CurrentTol: req.CurrentTol,
+		RelTol:     req.RelTol,
+		Points:     req.Points,
+	})
+	return &dto.CompareRunsResponse{
+		RunA:       toRunResponse(runA),
+		RunB:       toRunResponse(runB),
+		Golden:     simulation.GoldenRunID != nil && *simulation.GoldenRunID == runA.ID,
+		Comparison: comparison,
+	}, nil
+}
+
+// SetGoldenRun pins a completed run as the golden run of a simulation
+func (s *SimulationService) SetGoldenRun(simulationID, userID string, req dto.SetGoldenRunRequest) (*dto.SimulationResponse, error) {
+	simulation, err := s.repo.FindByID(simulationID)
+	if err != nil {
+		return nil, errors.New("simulation not found")
+	}
+
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
+	}
+
+	run, err := s.repo.GetRunByID(simulationID, req.RunID)
+	if err != nil {
+		return nil, errors.New("run not found")
+	}
+	if run.Status != models.RunStatusCompleted {
+		return nil, errors.New("run not completed")
+	}
+
+	if err := s.repo.SetGoldenRun(simulationID, &run.ID); err != nil {
+		return nil, err
+	}
+	simulation.GoldenRunID = &run.ID
+	return s.toSimulationResponsePtr(simulation), nil
+}
+
+// ClearGoldenRun unpins the golden run of a simulation
+func (s *SimulationService) ClearGoldenRun(simulationID, userID string) (*dto.SimulationResponse, error) {
+	simulation, err := s.repo.FindByID(simulationID)
+	if err != nil {
+		return nil, errors.New("simulation not found")
+	}
+
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetGoldenRun(simulationID, nil); err != nil {
+		return nil, err
+	}
+	simulation.GoldenRunID = nil
+	return s.toSimulationResponsePtr(simulation), nil
+}
+
+// checkRegression compares a run that worked with the golden run, if one
+// is pinned, and warns when its results diverge
+func (s *SimulationService) checkRegression(simulation *models.Simulation, runID string, out *runOutcome) {
+	if simulation.GoldenRunID == nil || *simulation.GoldenRunID == runID || len(out.errors) > 0 {
+		return
+	}
+	golden, err := s.repo.GetRunByID(simulation.ID, *simulation.GoldenRunID)
+	if err != nil {
+		return
+	}
+
+	var goldenResult, result simulator.Results
+	resultJSON, _ := json.Marshal(out.result)
+	if json.Unmarshal(golden.ResultData, &goldenResult) != nil || json.Unmarshal(resultJSON, &result) != nil {
+		log.Printf("Failed to compare run %s with the golden run", runID)
+		return
+	}
+
+	comparison := simulator.Compare(&goldenResult, &result, simulator.CompareOptions{})
+	regression := &dto.RunRegression{
+		GoldenRunID:    golden.ID,
+		Diverged:       comparison.Diverged,
+		DivergedProbes: comparison.DivergedProbes,
+		WorstProbe:     comparison.WorstProbe,
+		MaxError:       comparison.MaxError,
+	}
+	out.response.Regression = regression
+	out.result["regression"] = regression
+	if comparison.Diverged {
+		out.warnings = append(out.warnings, simulator.Issue{
+			Code:    simulator.IssueRegression,
+			Message: fmt.Sprintf("The results diverge from the golden run at %s", strings.Join(comparison.DivergedProbes, ", ")),
+		})
+	}
+}
+
+// runFinished reports whether a run is done and has its results
+func runFinished(run *models.SimulationRun) bool {
+	return run.Status != models.RunStatusQueued && run.Status != models.RunStatusRunning
+}
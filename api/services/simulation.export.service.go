@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/simulator"
+)
+
+// ============================================
+// Run Export
+// ============================================
+
+// RunExport is a run's results in a download format. Only the part of the
+// stored results the format lays out is read; Write streams it row by row.
+type RunExport struct {
+	Name        string // simulation name, for the file name
+	Extension   string
+	ContentType string
+	Write       func(w io.Writer) error
+}
+
+// runExportMeta heads a JSON export
+type runExportMeta struct {
+	RunID        string          `json:"run_id"`
+	SimulationID string          `json:"simulation_id"`
+	Simulation   string          `json:"simulation"`
+	Analysis     string          `json:"analysis"`
+	Status       string          `json:"status"`
+	StartedAt    time.Time       `json:"started_at"`
+	CompletedAt  *time.Time      `json:"completed_at"`
+	DurationMs   int             `json:"duration_ms"`
+	Errors       json.RawMessage `json:"errors"`
+	Warnings     json.RawMessage `json:"warnings"`
+}
+
+// ExportRun prepares a run's results as CSV (an axis column such as time,
+// then a column per probe), as a VCD of its timing diagrams, or as JSON
+// with the same columns and rows
+func (s *SimulationService) ExportRun(simulationID, runID, userID string, req dto.ExportRunRequest) (*RunExport, error) {
+	simulation, err := s.repo.FindByID(simulationID)
+	if err != nil {
+		return nil, errors.New("simulation not found")
+	}
+
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermView); err != nil {
+		return nil, err
+	}
+
+	run, err := s.repo.GetRunInfo(simulationID, runID)
+	if err != nil {
+		return nil, errors.New("run not found")
+	}
+
+	var signals []string
+	for _, name := range strings.Split(req.Signals, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			signals = append(signals, name)
+		}
+	}
+
+	if req.Format == "vcd" {
+		var digital *simulator.DigitalResult
+		if err := s.readResultPart(run.ID, &digital, "digital"); err != nil {
+			return nil, err
+		}
+		if digital == nil {
+			return nil, errors.New("run has no timing diagram")
+		}
+		return &RunExport{
+			Name:        simulation.Name,
+			Extension:   "vcd",
+			ContentType: "application/octet-stream",
+			Write:       digital.WriteVCD,
+		}, nil
+	}
+
+	result, err := s.readExportResults(run.ID, signals)
+	if err != nil {
+		return nil, err
+	}
+	table, ok := result.Table(signals)
+	if !ok {
+		return nil, errors.New("run has no results")
+	}
+
+	if req.Format == "json" {
+		meta := runExportMeta{
+			RunID:        run.ID,
+			SimulationID: simulation.ID,
+			Simulation:   simulation.Name,
+			Analysis:     result.Analysis,
+			Status:       run.Status,
+			StartedAt:    run.StartedAt,
+			CompletedAt:  run.CompletedAt,
+			DurationMs:   run.DurationMs,
+			Errors:       rawOrEmpty(run.Errors),
+			Warnings:     rawOrEmpty(run.Warnings),
+		}
+		return &RunExport{
+			Name:        simulation.Name,
+			Extension:   "json",
+			ContentType: "application/json; charset=utf-8",
+			Write:       func(w io.Writer) error { return table.WriteJSON(w, meta) },
+		}, nil
+	}
+	return &RunExport{
+		Name:        simulation.Name,
+		Extension:   "csv",
+		ContentType: "text/csv; charset=utf-8",
+		Write:       table.WriteCSV,
+	}, nil
+}
+
+// readExportResults reads the part of a run's results an export lays out,
+// in the order Results.Table picks them, leaving the rest of the stored
+// results in the database. A transient waveform is read with only the
+// signals asked for.
+func (s *SimulationService) readExportResults(runID string, signals []string) (*simulator.Results, error) {
+	result := &simulator.Results{}
+	if err := s.readResultPart(runID, &result.Analysis, "analysis"); err != nil {
+		return nil, err
+	}
+
+	if err := s.readResultPart(runID, &result.Variation, "variation"); err != nil || result.Variation != nil {
+		return result, err
+	}
+
+	data, err := s.repo.GetRunWaveform(runID, signals)
+	if err != nil {
+		return nil, err
+	}
+	var waveform *simulator.Waveform
+	if len(data) > 0 && json.Unmarshal(data, &waveform) != nil {
+		return nil, errors.New("run has no results")
+	}
+	if waveform != nil {
+		result.Transient = &simulator.TransientResult{Waveform: waveform}
+		return result, nil
+	}
+
+	if err := s.readResultPart(runID, &result.AC, "ac"); err != nil || result.AC != nil {
+		return result, err
+	}
+	if err := s.readResultPart(runID, &result.Digital, "digital"); err != nil || result.Digital != nil {
+		return result, err
+	}
+	return result, s.readResultPart(runID, &result.OperatingPoint, "operating_point")
+}
+
+// readResultPart decodes a part of a run's results into v, leaving it
+// untouched when the run has none
+func (s *SimulationService) readResultPart(runID string, v interface{}, path ...string) error {
+	data, err := s.repo.GetRunResultPart(runID, path...)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	if json.Unmarshal(data, v) != nil {
+		return errors.New("run has no results")
+	}
+	return nil
+}
+
+// rawOrEmpty is a stored JSON list, or an empty one when there is none
+func rawOrEmpty(data []byte) json.RawMessage {
+	if len(data) == 0 || string(data) == "null" {
+		return json.RawMessage("[]")
+	}
+	return json.RawMessage(data)
+}
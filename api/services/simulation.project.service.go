@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"nexfi-backend/dto"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/rabbitmq"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/simulator"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ============================================
+// Project Simulations
+// ============================================
+
+// ProjectRun is a run of a project's simulation
+type ProjectRun struct {
+	Simulation *models.Simulation
+	Run        *models.SimulationRun
+	Response   *dto.RunSimulationResponseDTO
+	Notes      []string // why the project's code did not run
+}
+
+// RunProject runs the circuit of a project on the simulation of the
+// project, creating it on the first run. When the schema has a board and
+// the main file is an Arduino sketch, the board runs the sketch built from
+// the workspace for durationMs;
+// otherwise the circuit's DC operating point is solved. The run is queued
+// for the simulation workers; without a job queue it executes within the
+// request.
+func (s *SimulationService) RunProject(project *models.Project, userID string, durationMs int) (*ProjectRun, error) {
+	schema, err := schematic.Parse(project.SchemaData)
+	if err != nil {
+		return nil, errors.New("invalid schema data")
+	}
+
+	notes := []string{}
+	boards := 0
+	if src := codeWorkspace(project.CodeData).Sketch(); src != nil {
+		boards = simulator.AttachSketch(schema, src.Text)
+		if boards == 0 {
+			notes = append(notes, "The code was not run: the circuit has no microcontroller board")
+		}
+	} else {
+		notes = append(notes, "The code was not run: the simulator runs Arduino sketches only")
+	}
+
+	settings := map[string]interface{}{"analysis": simulator.AnalysisDC}
+	if boards > 0 {
+		transient := map[string]interface{}{}
+		if durationMs > 0 {
+			transient["stopTime"] = float64(durationMs) / 1000
+		}
+		settings = map[string]interface{}{"analysis": simulator.AnalysisTransient, "transient": transient}
+	}
+	schemaJSON, _ := json.Marshal(schema)
+	settingsJSON, _ := json.Marshal(settings)
+
+	simulation, err := s.projectSimulation(project)
+	if err != nil {
+		return nil, err
+	}
+
+	// The schema is stored first, so a failed write leaves no run behind
+	simulation.SchemaData = datatypes.JSON(schemaJSON)
+	simulation.SimulationSettings = datatypes.JSON(settingsJSON)
+	simulation.ComponentsCount = len(schema.Components)
+	simulation.WiresCount = len(schema.Wires)
+	stored, err := s.repo.UpdateProjectSchema(simulation)
+	if err != nil {
+		return nil, err
+	}
+	if !stored {
+		return nil, errors.New("simulation already running")
+	}
+
+	run := &models.SimulationRun{
+		SimulationID: simulation.ID,
+		UserID:       userID,
+		Status:       models.RunStatusQueued,
+	}
+	started, err := s.repo.StartRun(simulation, run)
+	if err != nil {
+		return nil, err
+	}
+	if !started {
+		return nil, errors.New("simulation already running")
+	}
+
+	response, err := s.dispatchRun(rabbitmq.SimulationRunJob{
+		RunID:        run.ID,
+		SimulationID: simulation.ID,
+		UserID:       userID,
+		Settings:     json.RawMessage(settingsJSON),
+	}, run, settings["analysis"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if finished, err := s.repo.GetRunByID(simulation.ID, run.ID); err == nil {
+		run = finished
+	}
+	return &ProjectRun{Simulation: simulation, Run: run, Response: response, Notes: notes}, nil
+}
+
+// projectSimulation finds the simulation of a project, or creates it for
+// the project's owner. Creating it earns no XP; its runs do.
+func (s *SimulationService) projectSimulation(project *models.Project) (*models.Simulation, error) {
+	simulation, err := s.repo.FindByProject(project.ID, project.UserID)
+	if err == nil {
+		return simulation, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	projectID := project.ID
+	simulation = &models.Simulation{
+		UserID:              project.UserID,
+		ProjectID:           &projectID,
+		IsProjectSimulation: true,
+		Name:                project.Name,
+		Type:                models.SimTypeBasicElectronics,
+		Status:              models.SimStatusDraft,
+	}
+	if err := s.repo.Create(simulation); err != nil {
+		// Another run created it meanwhile; the index allows only one
+		if existing, findErr := s.repo.FindByProject(project.ID, project.UserID); findErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return simulation, nil
+}
+
+// issueMessages lists the messages of the issues a run recorded
+func issueMessages(data datatypes.JSON) []string {
+	var issues []simulator.Issue
+	json.Unmarshal(data, &issues)
+	messages := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		messages = append(messages, issue.Message)
+	}
+	return messages
+}
@@ -1,11 +1,22 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"nexfi-backend/api/repositories"
 	"nexfi-backend/dto"
 	"nexfi-backend/models"
+	"nexfi-backend/pkg/rabbitmq"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/simulator"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/datatypes"
@@ -14,17 +25,19 @@ import (
 
 // SimulationService handles simulation business logic
 type SimulationService struct {
-	repo     *repositories.SimulationRepository
-	userRepo *repositories.UserRepository
-	db       *gorm.DB
+	repo        *repositories.SimulationRepository
+	userRepo    *repositories.UserRepository
+	projectRepo *repositories.ProjectRepository
+	db          *gorm.DB
 }
 
 // NewSimulationService creates a new SimulationService
 func NewSimulationService(db *gorm.DB) *SimulationService {
 	return &SimulationService{
-		repo:     repositories.NewSimulationRepository(db),
-		userRepo: repositories.NewUserRepository(db),
-		db:       db,
+		repo:        repositories.NewSimulationRepository(db),
+		userRepo:    repositories.NewUserRepository(db),
+		projectRepo: repositories.NewProjectRepository(db),
+		db:          db,
 	}
 }
 
@@ -65,13 +78,18 @@ func (s *SimulationService) GetStats(userID string) (*dto.SimulationStatsRespons
 
 	return &dto.SimulationStatsResponse{
 		TotalSimulations:    stats.TotalSimulations,
+		ProjectSimulations:  stats.ProjectSimulations,
 		RunningNow:          stats.RunningNow,
 		Completed:           stats.Completed,
 		Paused:              stats.Paused,
 		Error:               stats.Error,
+		TotalRuns:           stats.TotalRuns,
+		CompletedRuns:       stats.CompletedRuns,
+		FailedRuns:          stats.FailedRuns,
 		TotalRuntimeHours:   stats.TotalRuntimeHours,
 		SuccessRate:         stats.SuccessRate,
 		SimulationsThisWeek: stats.SimulationsThisWeek,
+		RunsThisWeek:        stats.RunsThisWeek,
 		ByType:              stats.ByType,
 	}, nil
 }
@@ -83,16 +101,35 @@ func (s *SimulationService) GetSimulation(simulationID, userID string) (*dto.Sim
 		return nil, errors.New("simulation not found")
 	}
 
-	// Check access (only owner can view non-public simulations)
-	if simulation.UserID != userID {
-		return nil, errors.New("access denied")
+	// The owner, and collaborators of the simulation's project, can view it
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermView); err != nil {
+		return nil, err
 	}
 
+	simulation.SchemaData = upgradeSchemaData(simulation.SchemaData)
+
 	return s.toSimulationDetailResponse(simulation), nil
 }
 
 // CreateSimulation creates a new simulation
 func (s *SimulationService) CreateSimulation(userID string, req dto.CreateSimulationRequest) (*dto.SimulationResponse, error) {
+	schemaData, err := normalizeSchemaData(req.SchemaData)
+	if err != nil {
+		return nil, err
+	}
+	req.SchemaData = schemaData
+
+	// Only editors of a project may link their simulations to it
+	if req.ProjectID != nil {
+		project, err := s.projectRepo.FindByIDSimple(*req.ProjectID)
+		if err != nil {
+			return nil, errors.New("project not found")
+		}
+		if err := checkProjectPermission(s.projectRepo, project, userID, models.ProjectPermEdit); err != nil {
+			return nil, err
+		}
+	}
+
 	// Parse schema to count components and wires
 	componentsCount, wiresCount := s.countSchemaElements(req.SchemaData)
 
@@ -145,7 +182,11 @@ func (s *SimulationService) UpdateSimulation(simulationID, userID string, req dt
 		simulation.Type = models.SimulationType(req.Type)
 	}
 	if req.SchemaData != nil {
-		simulation.SchemaData = req.SchemaData
+		schemaData, err := normalizeSchemaData(req.SchemaData)
+		if err != nil {
+			return nil, err
+		}
+		simulation.SchemaData = schemaData
 		simulation.ComponentsCount, simulation.WiresCount = s.countSchemaElements(req.SchemaData)
 	}
 	if req.SimulationSettings != nil {
@@ -172,73 +213,445 @@ func (s *SimulationService) DeleteSimulation(simulationID, userID string) error
 	return s.repo.Delete(simulationID)
 }
 
-// RunSimulation starts a simulation
+// RunSimulation queues a new run of a simulation for the simulation
+// workers. Without a job queue the run executes within the request.
 func (s *SimulationService) RunSimulation(simulationID, userID string, req dto.RunSimulationRequestDTO) (*dto.RunSimulationResponseDTO, error) {
 	simulation, err := s.repo.FindByID(simulationID)
 	if err != nil {
 		return nil, errors.New("simulation not found")
 	}
 
-	if simulation.UserID != userID {
-		return nil, errors.New("access denied")
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
 	}
 
-	// Check if already running
-	if simulation.Status == models.SimStatusRunning {
-		return nil, errors.New("simulation already running")
+	// Reject what the worker could not run before queueing it
+	if _, err := schematic.Parse(simulation.SchemaData); err != nil {
+		return nil, errors.New("invalid schema data")
 	}
-
-	// Update status to running
-	simulation.Status = models.SimStatusRunning
-	if err := s.repo.Update(simulation); err != nil {
+	settingsJSON := mergeSettings(simulation.SimulationSettings, req.SettingsOverride)
+	settings, err := simulator.ParseSettings(settingsJSON)
+	if err != nil {
 		return nil, err
 	}
 
-	// Create run record
 	run := &models.SimulationRun{
 		SimulationID: simulationID,
 		UserID:       userID,
-		Status:       "running",
+		Status:       models.RunStatusQueued,
+	}
+	started, err := s.repo.StartRun(simulation, run)
+	if err != nil {
+		return nil, err
+	}
+	if !started {
+		return nil, errors.New("simulation already running")
+	}
+	job := rabbitmq.SimulationRunJob{
+		RunID:        run.ID,
+		SimulationID: simulationID,
+		UserID:       userID,
+		Settings:     json.RawMessage(settingsJSON),
+	}
+	response, err := s.dispatchRun(job, run, runAnalysis(settings, simulation.Type))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Transient != nil {
+		points := req.Points
+		if points == 0 {
+			points = defaultWaveformPoints
+		}
+		view := *response.Transient
+		view.Waveform = response.Transient.Waveform.Downsample(points)
+		response.Transient = &view
+	}
+	return response, nil
+}
+
+// dispatchRun publishes a started run for the simulation workers and
+// returns it queued. Without a job queue the run executes within the
+// request, under the same limits as a worker.
+func (s *SimulationService) dispatchRun(job rabbitmq.SimulationRunJob, run *models.SimulationRun, analysis string) (*dto.RunSimulationResponseDTO, error) {
+	stream := newRunStream(job.SimulationID, run.ID)
+	stream.reset()
+	stream.state(run, analysis, nil)
+
+	if rabbitmq.IsConnected() && rabbitmq.PublishSimulationRun(job) == nil {
+		return &dto.RunSimulationResponseDTO{
+			RunID:     run.ID,
+			Status:    models.RunStatusQueued,
+			Analysis:  analysis,
+			StartedAt: run.StartedAt,
+		}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SimulationTimeLimit())
+	defer cancel()
+	response, err := s.ExecuteRun(ctx, job)
+	if err != nil {
+		return nil, err
 	}
+	if response == nil {
+		// Stopped before it started
+		return &dto.RunSimulationResponseDTO{RunID: run.ID, Status: models.RunStatusStopped, StartedAt: run.StartedAt}, nil
+	}
+	return response, nil
+}
 
-	if err := s.repo.CreateRun(run); err != nil {
+// ExecuteRun runs a queued run with the backend engine and records its
+// results on the run and the simulation. It returns nil when the run was
+// stopped or taken by another worker before it started. Cancelling ctx, or
+// stopping the run, ends the analysis early.
+func (s *SimulationService) ExecuteRun(ctx context.Context, job rabbitmq.SimulationRunJob) (*dto.RunSimulationResponseDTO, error) {
+	claimed, err := s.repo.ClaimRun(job.RunID)
+	if err != nil || !claimed {
 		return nil, err
 	}
+	run, err := s.repo.GetRunByID(job.SimulationID, job.RunID)
+	if err != nil {
+		return nil, errors.New("run not found")
+	}
 
-	return &dto.RunSimulationResponseDTO{
-		RunID:     run.ID,
-		Status:    "running",
-		StartedAt: run.StartedAt,
-	}, nil
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	activeRuns.Store(run.ID, cancel)
+	defer activeRuns.Delete(run.ID)
+	go s.watchStop(ctx, cancel, run.ID)
+
+	stream := newRunStream(job.SimulationID, run.ID)
+	stream.state(run, "", nil)
+
+	startedAt := time.Now()
+	simulation, err := s.repo.FindByID(job.SimulationID)
+	var out *runOutcome
+	if err != nil {
+		out = failedOutcome("The simulation no longer exists")
+	} else {
+		out = execute(ctx, simulation, job.Settings, repositories.NewComponentRepository(s.db), stream.progress)
+		if ctx.Err() == nil {
+			// A stopped run's partial results say nothing of regressions
+			s.checkRegression(simulation, run.ID, out)
+		}
+	}
+
+	resultJSON, _ := json.Marshal(out.result)
+	errorsJSON, _ := json.Marshal(out.errors)
+	warningsJSON, _ := json.Marshal(out.warnings)
+	now := time.Now()
+	run.Status = models.RunStatusCompleted
+	if len(out.errors) > 0 {
+		run.Status = models.RunStatusError
+	}
+	run.ResultData = datatypes.JSON(resultJSON)
+	run.Errors = datatypes.JSON(errorsJSON)
+	run.Warnings = datatypes.JSON(warningsJSON)
+	run.CompletedAt = &now
+	run.DurationMs = int(now.Sub(startedAt).Milliseconds())
+	run.SketchHash = out.sketchHash
+
+	finished, err := s.repo.FinishRun(run)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveVariants(run, out); err != nil {
+		log.Printf("Failed to save the variants of run %s: %v", run.ID, err)
+	}
+	if !finished {
+		// Stopped meanwhile: the results so far are kept, the stop stands
+		run.Status = models.RunStatusStopped
+	} else {
+		stream.state(run, out.response.Analysis, out.errors)
+	}
+	if finished && simulation != nil {
+		simulation.LastResult = run.ResultData
+		simulation.Status = models.SimStatusCompleted
+		simulation.ErrorMessage = ""
+		if run.Status == models.RunStatusError {
+			simulation.Status = models.SimStatusError
+			simulation.ErrorMessage = out.errors[0].Message
+		}
+		if err := s.repo.UpdateResult(simulation.ID, simulation.Status, simulation.ErrorMessage, simulation.LastResult); err != nil {
+			return nil, err
+		}
+		if run.Status == models.RunStatusCompleted {
+			s.repo.IncrementRunCount(simulation.ID, run.DurationMs)
+		}
+		out.response.XPEarned, out.response.Milestones = s.rewardRun(run, simulation)
+		if simulation.ProjectID != nil {
+			NewProjectProgressService(s.db).RefreshProgress(*simulation.ProjectID)
+		}
+	}
+
+	out.response.RunID = run.ID
+	out.response.Status = run.Status
+	out.response.StartedAt = run.StartedAt
+	return &out.response, nil
 }
 
-// StopSimulation stops a running simulation
+// staleRunGrace is how much longer than the time limit a run may be running
+// before it is taken for abandoned
+const staleRunGrace = time.Minute
+
+// ResetStaleRuns ends the runs whose worker went away mid-run. No run lasts
+// longer than the time limit, so one claimed longer ago and still running
+// is abandoned; a simulation left running without a run can be run again.
+// Queued runs wait for a worker, or for their job to expire (see ExpireRun).
+func (s *SimulationService) ResetStaleRuns() error {
+	message := "The run was interrupted"
+	errorsJSON, _ := json.Marshal([]simulator.Issue{{Code: issueRunFailed, Message: message}})
+	runs, simulations, err := s.repo.ResetStaleRuns(time.Now().Add(-SimulationTimeLimit()-staleRunGrace), datatypes.JSON(errorsJSON), message)
+	if err != nil {
+		return err
+	}
+	if runs > 0 || simulations > 0 {
+		log.Printf("Reset %d stale simulation runs and %d simulations", runs, simulations)
+	}
+	return nil
+}
+
+// ExpireRun ends a run whose job no worker took within the queue TTL
+func (s *SimulationService) ExpireRun(job rabbitmq.SimulationRunJob) error {
+	message := "The run waited too long for a simulation worker"
+	issues := []simulator.Issue{{Code: issueRunFailed, Message: message}}
+	errorsJSON, _ := json.Marshal(issues)
+	expired, err := s.repo.ExpireRun(job.SimulationID, job.RunID, datatypes.JSON(errorsJSON), message)
+	if err != nil || !expired {
+		return err
+	}
+	if run, err := s.repo.GetRunByID(job.SimulationID, job.RunID); err == nil {
+		newRunStream(job.SimulationID, run.ID).state(run, "", issues)
+	}
+	return nil
+}
+
+// FailRun ends a running run that broke off with an error
+func (s *SimulationService) FailRun(job rabbitmq.SimulationRunJob, message string) error {
+	run, err := s.repo.GetRunByID(job.SimulationID, job.RunID)
+	if err != nil {
+		return errors.New("run not found")
+	}
+
+	errorsJSON, _ := json.Marshal([]simulator.Issue{{Code: issueRunFailed, Message: message}})
+	now := time.Now()
+	run.Status = models.RunStatusError
+	run.Errors = datatypes.JSON(errorsJSON)
+	run.CompletedAt = &now
+	run.DurationMs = int(now.Sub(run.StartedAt).Milliseconds())
+	if finished, err := s.repo.FinishRun(run); err != nil || !finished {
+		return err
+	}
+	newRunStream(job.SimulationID, run.ID).state(run, "", []simulator.Issue{{Code: issueRunFailed, Message: message}})
+
+	return s.repo.UpdateResult(job.SimulationID, models.SimStatusError, message, nil)
+}
+
+// runOutcome is what the engine produced for a run
+type runOutcome struct {
+	response dto.RunSimulationResponseDTO
+	result   map[string]interface{}
+	errors   []simulator.Issue
+	warnings []simulator.Issue
+	variants []*simulator.Variant // of a sweep or Monte Carlo run
+
+	sketchHash string // of the sketches the boards ran
+}
+
+// sketchHash fingerprints the sketches of a circuit's boards, so a lab is
+// only sent the code a passing run checked
+func sketchHash(boards []simulator.Board) string {
+	h := sha256.New()
+	for _, board := range boards {
+		fmt.Fprintf(h, "%s\x00%s\x00", board.ComponentID, board.Sketch)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func failedOutcome(message string) *runOutcome {
+	issue := simulator.Issue{Code: issueRunFailed, Message: message}
+	return &runOutcome{
+		result:   map[string]interface{}{},
+		errors:   []simulator.Issue{issue},
+		warnings: []simulator.Issue{},
+	}
+}
+
+// execute runs the analysis the settings ask for. Digital runs are
+// simulated event by event; sweeps and Monte Carlo runs simulate every
+// variant; the others first solve the operating point, and a circuit that
+// shorts, burns a part or does not converge goes no further. The engine
+// reports its progress to report while it runs.
+func execute(ctx context.Context, simulation *models.Simulation, settingsJSON []byte, components *repositories.ComponentRepository, report simulator.ProgressFunc) *runOutcome {
+	schema, err := schematic.Parse(simulation.SchemaData)
+	if err != nil {
+		return failedOutcome("The schema data is invalid")
+	}
+	settings, err := simulator.ParseSettings(settingsJSON)
+	if err != nil {
+		return failedOutcome(err.Error())
+	}
+	modelIssues := applyModels(components, schema)
+
+	analysis := runAnalysis(settings, simulation.Type)
+	out := &runOutcome{
+		response:   dto.RunSimulationResponseDTO{Analysis: analysis},
+		result:     map[string]interface{}{"analysis": analysis},
+		sketchHash: sketchHash(simulator.Boards(schema)),
+	}
+	// Parts whose model is missing are simulated by their type
+	defer func() { out.warnings = mergeIssues(modelIssues, out.warnings) }()
+
+	if analysis == simulator.AnalysisDigital {
+		digital := simulator.BuildLogic(schema).WithContext(ctx).WithProgress(report).Simulate(settings.Digital)
+		out.response.Digital = digital
+		out.result["digital"] = digital
+		out.errors, out.warnings = digital.Errors, digital.Warnings
+		return out
+	}
+
+	if settings.Variation != nil {
+		// Each run's variants share the CPUs left to it by the other workers
+		settings.Variation.Workers = max(1, runtime.NumCPU()/SimulationWorkers())
+		variation := simulator.Vary(ctx, schema, analysis, settings, report)
+		out.response.Variation = variation
+		out.result["variation"] = variation
+		out.errors, out.warnings = variation.Errors, variation.Warnings
+		out.variants = variation.Variants
+		return out
+	}
+
+	circuit := simulator.Build(schema).WithContext(ctx).WithProgress(report)
+	op := circuit.OperatingPoint()
+	out.response.OperatingPoint = op
+	out.result["operating_point"] = op
+	out.errors, out.warnings = op.Errors, op.Warnings
+
+	switch {
+	case len(op.Errors) > 0:
+	case analysis == simulator.AnalysisTransient:
+		transient := circuit.Transient(settings.Transient)
+		out.response.Transient = transient
+		out.result["transient"] = transient
+		out.errors = mergeIssues(out.errors, transient.Errors)
+		out.warnings = mergeIssues(out.warnings, transient.Warnings)
+	case analysis == simulator.AnalysisAC:
+		ac := circuit.AC(settings.AC)
+		out.response.AC = ac
+		out.result["ac"] = ac
+		out.errors = mergeIssues(out.errors, ac.Errors)
+		out.warnings = mergeIssues(out.warnings, ac.Warnings)
+	}
+	return out
+}
+
+// activeRuns holds the cancel functions of the runs executing in this
+// process, by run ID
+var activeRuns sync.Map
+
+// watchStop cancels a run once it is stopped; polling the run's status
+// also reaches workers in other processes
+func (s *SimulationService) watchStop(ctx context.Context, cancel context.CancelFunc, runID string) {
+	ticker := time.NewTicker(stopPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if status, err := s.repo.GetRunStatus(runID); err == nil && status == models.RunStatusStopped {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// rewardRun awards the XP of a finished run and returns it with the
+// milestones it unlocked. A completed run earns XP once per simulation and
+// day so re-running a circuit does not farm XP. The runs of a project's
+// simulation also unlock the project's milestones: its first run, and its
+// first run that completes.
+func (s *SimulationService) rewardRun(run *models.SimulationRun, simulation *models.Simulation) (int, []string) {
+	xpEarned := 0
+	milestones := []string{}
+
+	if run.Status == models.RunStatusCompleted {
+		var rewarded int64
+		s.db.Model(&models.UserXPTransaction{}).
+			Where("user_id = ? AND source_id = ? AND description = ? AND created_at >= ?",
+				run.UserID, simulation.ID, "simulation_complete", time.Now().Truncate(24*time.Hour)).
+			Count(&rewarded)
+		if rewarded == 0 {
+			s.awardXP(run.UserID, simulationRunXP, simulation.ID, "simulation_complete")
+			xpEarned += simulationRunXP
+		}
+	}
+
+	if simulation.ProjectID == nil {
+		return xpEarned, milestones
+	}
+	projectID := *simulation.ProjectID
+	unlock := func(milestoneType models.MilestoneType, xp int) {
+		if hasProjectMilestone(s.db, projectID, milestoneType) {
+			return
+		}
+		createProjectMilestone(s.db, projectID, run.UserID, milestoneType, xp)
+		s.awardXP(run.UserID, xp, projectID, "simulation_run")
+		xpEarned += xp
+		milestones = append(milestones, string(milestoneType))
+	}
+	unlock(models.MilestoneFirstSimulation, models.XPFirstSimulationRun)
+	if run.Status == models.RunStatusCompleted {
+		unlock(models.MilestoneSimulationSuccess, models.XPSimulationSuccess)
+	}
+	return xpEarned, milestones
+}
+
+// SimulationTimeLimit is the time a run may take (SIMULATION_TIME_LIMIT,
+// e.g. "30s")
+func SimulationTimeLimit() time.Duration {
+	return getEnvDuration("SIMULATION_TIME_LIMIT", 30*time.Second)
+}
+
+// SimulationWorkers is how many runs a process executes at once
+// (SIMULATION_WORKERS), by default half the CPUs
+func SimulationWorkers() int {
+	if n := getEnvInt("SIMULATION_WORKERS", 0); n > 0 {
+		return n
+	}
+	return max(1, runtime.NumCPU()/2)
+}
+
+// StopSimulation stops the simulation and cancels its queued or running run
 func (s *SimulationService) StopSimulation(simulationID, userID string) (*dto.StopSimulationResponse, error) {
 	simulation, err := s.repo.FindByID(simulationID)
 	if err != nil {
 		return nil, errors.New("simulation not found")
 	}
 
-	if simulation.UserID != userID {
-		return nil, errors.New("access denied")
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermEdit); err != nil {
+		return nil, err
 	}
 
-	// Update status
-	simulation.Status = models.SimStatusPaused
-	if err := s.repo.Update(simulation); err != nil {
+	// Only the status is written, so a run finishing meanwhile keeps its
+	// result and error message
+	if err := s.repo.UpdateStatus(simulationID, models.SimStatusPaused); err != nil {
 		return nil, err
 	}
 
-	// Get latest run
+	// Cancel the latest run if it has not ended; a worker in this process
+	// stops at once, others on their next status check
 	run, err := s.repo.GetLatestRun(simulationID)
 	durationMs := 0
 	if err == nil && run != nil {
-		now := time.Now()
-		run.Status = "stopped"
-		run.CompletedAt = &now
-		run.DurationMs = int(time.Since(run.StartedAt).Milliseconds())
+		if stopped, _ := s.repo.StopRun(run); stopped {
+			newRunStream(simulationID, run.ID).state(run, "", nil)
+			if cancel, ok := activeRuns.Load(run.ID); ok {
+				cancel.(context.CancelFunc)()
+			}
+		}
 		durationMs = run.DurationMs
-		s.repo.UpdateRun(run)
 	}
 
 	return &dto.StopSimulationResponse{
@@ -254,8 +667,8 @@ func (s *SimulationService) GetRuns(simulationID, userID string) ([]dto.Simulati
 		return nil, errors.New("simulation not found")
 	}
 
-	if simulation.UserID != userID {
-		return nil, errors.New("access denied")
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermView); err != nil {
+		return nil, err
 	}
 
 	runs, err := s.repo.GetRuns(simulationID, 50)
@@ -265,79 +678,126 @@ func (s *SimulationService) GetRuns(simulationID, userID string) ([]dto.Simulati
 
 	responses := make([]dto.SimulationRunResponse, len(runs))
 	for i, run := range runs {
-		responses[i] = dto.SimulationRunResponse{
-			ID:          run.ID,
-			Status:      run.Status,
-			DurationMs:  run.DurationMs,
-			ResultData:  run.ResultData,
-			Errors:      run.Errors,
-			Warnings:    run.Warnings,
-			StartedAt:   run.StartedAt,
-			CompletedAt: run.CompletedAt,
-		}
+		responses[i] = toRunResponse(&run)
 	}
 
 	return responses, nil
 }
 
-// SaveResult saves simulation result from frontend
-func (s *SimulationService) SaveResult(simulationID, userID string, req dto.SaveSimulationResultRequest) (*dto.SaveSimulationResultResponse, error) {
+// GetRunVariants gets the variants of a sweep or Monte Carlo run
+func (s *SimulationService) GetRunVariants(simulationID, runID, userID string) ([]dto.SimulationRunResponse, error) {
 	simulation, err := s.repo.FindByID(simulationID)
 	if err != nil {
 		return nil, errors.New("simulation not found")
 	}
 
-	if simulation.UserID != userID {
-		return nil, errors.New("access denied")
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermView); err != nil {
+		return nil, err
 	}
 
-	// Determine status from result
-	var resultData struct {
-		Success bool `json:"success"`
+	if _, err := s.repo.GetRunByID(simulationID, runID); err != nil {
+		return nil, errors.New("run not found")
 	}
-	json.Unmarshal(req.ResultData, &resultData)
 
-	status := models.SimStatusCompleted
-	if !resultData.Success {
-		status = models.SimStatusError
+	runs, err := s.repo.GetVariantRuns(runID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Update simulation
-	simulation.Status = status
-	simulation.LastResult = req.ResultData
-	now := time.Now()
-	simulation.LastRunAt = &now
+	responses := make([]dto.SimulationRunResponse, len(runs))
+	for i, run := range runs {
+		responses[i] = toRunResponse(&run)
+	}
 
-	if err := s.repo.Update(simulation); err != nil {
+	return responses, nil
+}
+
+// saveVariants stores each variant of a sweep or Monte Carlo run as a
+// child of the run, with its full results
+func (s *SimulationService) saveVariants(parent *models.SimulationRun, out *runOutcome) error {
+	runs := make([]models.SimulationRun, 0, len(out.variants))
+	for _, v := range out.variants {
+		result := map[string]interface{}{
+			"analysis":        out.response.Analysis,
+			"variant":         v,
+			"operating_point": v.OperatingPoint,
+		}
+		if v.Transient != nil {
+			transient := *v.Transient
+			transient.Waveform = v.Transient.Waveform.Downsample(variantWaveformPoints)
+			result["transient"] = &transient
+		}
+		resultJSON, _ := json.Marshal(result)
+		errs, warnings := v.Errors, v.Warnings
+		if errs == nil {
+			errs = []simulator.Issue{}
+		}
+		if warnings == nil {
+			warnings = []simulator.Issue{}
+		}
+		errorsJSON, _ := json.Marshal(errs)
+		warningsJSON, _ := json.Marshal(warnings)
+
+		status := models.RunStatusCompleted
+		if !v.Passed {
+			status = models.RunStatusError
+		}
+		parentID := parent.ID
+		runs = append(runs, models.SimulationRun{
+			SimulationID: parent.SimulationID,
+			UserID:       parent.UserID,
+			Status:       status,
+			DurationMs:   v.DurationMs,
+			ResultData:   datatypes.JSON(resultJSON),
+			Errors:       datatypes.JSON(errorsJSON),
+			Warnings:     datatypes.JSON(warningsJSON),
+			StartedAt:    parent.StartedAt,
+			CompletedAt:  parent.CompletedAt,
+			ParentRunID:  &parentID,
+			VariantIndex: v.Index,
+		})
+	}
+	return s.repo.CreateVariantRuns(runs)
+}
+
+// GetRunWaveform gets the waveform of a transient run
+func (s *SimulationService) GetRunWaveform(simulationID, runID, userID string, req dto.RunWaveformRequest) (*dto.RunWaveformResponse, error) {
+	simulation, err := s.repo.FindByID(simulationID)
+	if err != nil {
+		return nil, errors.New("simulation not found")
+	}
+
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermView); err != nil {
 		return nil, err
 	}
 
-	// Update run counts
-	s.repo.IncrementRunCount(simulationID, req.DurationMs)
+	run, err := s.repo.GetRunByID(simulationID, runID)
+	if err != nil {
+		return nil, errors.New("run not found")
+	}
 
-	// Create run record
-	run := &models.SimulationRun{
-		SimulationID: simulationID,
-		UserID:       userID,
-		Status:       "completed",
-		DurationMs:   req.DurationMs,
-		ResultData:   req.ResultData,
-		Errors:       req.Errors,
-		Warnings:     req.Warnings,
-		CompletedAt:  &now,
+	var result struct {
+		Transient *simulator.TransientResult `json:"transient"`
+	}
+	if err := json.Unmarshal(run.ResultData, &result); err != nil || result.Transient == nil || result.Transient.Waveform == nil {
+		return nil, errors.New("run has no waveform")
 	}
-	s.repo.CreateRun(run)
 
-	// Award XP
-	xpEarned := 5 // Simulation complete XP
-	if resultData.Success {
-		xpEarned = 10
+	var signals []string
+	for _, name := range strings.Split(req.Signals, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			signals = append(signals, name)
+		}
 	}
-	s.awardXP(userID, xpEarned, simulationID, "simulation_complete")
 
-	return &dto.SaveSimulationResultResponse{
+	waveform := result.Transient.Waveform.Select(signals).Window(req.From, req.To).Downsample(req.Points)
+	return &dto.RunWaveformResponse{
 		RunID:    run.ID,
-		XPEarned: xpEarned,
+		Method:   result.Transient.Method,
+		Step:     result.Transient.Step,
+		StopTime: result.Transient.StopTime,
+		Points:   len(waveform.Time),
+		Waveform: waveform,
 	}, nil
 }
 
@@ -345,12 +805,141 @@ func (s *SimulationService) SaveResult(simulationID, userID string, req dto.Save
 // Helper Functions
 // ============================================
 
+const (
+	defaultWaveformPoints = 500
+	historyWaveformPoints = 200
+	variantWaveformPoints = 500
+	stopPollInterval      = 500 * time.Millisecond
+	simulationRunXP       = 10
+	issueRunFailed        = simulator.IssueRunFailed
+)
+
+// checkSimulationAccess returns "access denied" unless the user owns the
+// simulation or, for a simulation linked to a project, has perm on the
+// project: view to read it and its runs, edit to run or stop it
+func (s *SimulationService) checkSimulationAccess(simulation *models.Simulation, userID string, perm models.ProjectPermission) error {
+	if simulation.UserID == userID {
+		return nil
+	}
+	if simulation.ProjectID == nil {
+		return errors.New("access denied")
+	}
+	project, err := s.projectRepo.FindByIDSimple(*simulation.ProjectID)
+	if err != nil {
+		return errors.New("access denied")
+	}
+	return checkProjectPermission(s.projectRepo, project, userID, perm)
+}
+
+// defaultAnalysis picks the analysis for simulations whose settings name
+// none. Power and audio circuits are about how signals change over time;
+// logic circuits about levels and edges.
+func defaultAnalysis(simType models.SimulationType) string {
+	switch simType {
+	case models.SimTypePowerElectronics, models.SimTypeAudio:
+		return simulator.AnalysisTransient
+	case models.SimTypeDigitalLogic:
+		return simulator.AnalysisDigital
+	}
+	return simulator.AnalysisDC
+}
+
+// runAnalysis is the analysis the settings ask for, or the default of the
+// simulation type
+func runAnalysis(settings *simulator.Settings, simType models.SimulationType) string {
+	if settings.Analysis != "" {
+		return settings.Analysis
+	}
+	return defaultAnalysis(simType)
+}
+
+// mergeSettings applies a run's settings override on top of the stored
+// settings. Nested objects such as "transient" are merged key by key.
+func mergeSettings(base, override datatypes.JSON) []byte {
+	if len(override) == 0 {
+		return base
+	}
+	merged := map[string]interface{}{}
+	json.Unmarshal(base, &merged)
+
+	var changes map[string]interface{}
+	if err := json.Unmarshal(override, &changes); err != nil {
+		return override
+	}
+	for key, value := range changes {
+		nested, isObject := value.(map[string]interface{})
+		current, hasObject := merged[key].(map[string]interface{})
+		if isObject && hasObject {
+			for k, v := range nested {
+				current[k] = v
+			}
+			continue
+		}
+		merged[key] = value
+	}
+
+	data, _ := json.Marshal(merged)
+	return data
+}
+
+// mergeIssues appends the issues of b that a does not already report
+func mergeIssues(a, b []simulator.Issue) []simulator.Issue {
+	seen := map[simulator.Issue]bool{}
+	for _, issue := range a {
+		seen[issue] = true
+	}
+	merged := append([]simulator.Issue{}, a...)
+	for _, issue := range b {
+		if !seen[issue] {
+			merged = append(merged, issue)
+		}
+	}
+	return merged
+}
+
+// compactResult downsamples a stored transient waveform so run listings
+// stay small; the full waveform is served by GetRunWaveform
+func compactResult(data datatypes.JSON, points int) datatypes.JSON {
+	var result map[string]json.RawMessage
+	if json.Unmarshal(data, &result) != nil || result["transient"] == nil {
+		return data
+	}
+	var transient simulator.TransientResult
+	if json.Unmarshal(result["transient"], &transient) != nil || transient.Waveform == nil {
+		return data
+	}
+
+	transient.Waveform = transient.Waveform.Downsample(points)
+	compact, _ := json.Marshal(transient)
+	result["transient"] = compact
+	out, _ := json.Marshal(result)
+	return datatypes.JSON(out)
+}
+
+func toRunResponse(run *models.SimulationRun) dto.SimulationRunResponse {
+	response := dto.SimulationRunResponse{
+		ID:          run.ID,
+		Status:      run.Status,
+		DurationMs:  run.DurationMs,
+		ResultData:  compactResult(run.ResultData, historyWaveformPoints),
+		Errors:      run.Errors,
+		Warnings:    run.Warnings,
+		StartedAt:   run.StartedAt,
+		CompletedAt: run.CompletedAt,
+		ParentRunID: run.ParentRunID,
+	}
+	if run.ParentRunID != nil {
+		index := run.VariantIndex
+		response.VariantIndex = &index
+	}
+	return response
+}
+
 func (s *SimulationService) countSchemaElements(schemaData datatypes.JSON) (components, wires int) {
-	var schema struct {
-		Components []interface{} `json:"components"`
-		Wires      []interface{} `json:"wires"`
+	schema, err := schematic.Parse(schemaData)
+	if err != nil {
+		return 0, 0
 	}
-	json.Unmarshal(schemaData, &schema)
 	return len(schema.Components), len(schema.Wires)
 }
 
@@ -367,6 +956,7 @@ func (s *SimulationService) toSimulationResponse(sim *models.Simulation) dto.Sim
 		RunCount:        sim.RunCount,
 		TotalRuntimeMs:  sim.TotalRuntimeMs,
 		LastRunAt:       sim.LastRunAt,
+		GoldenRunID:     sim.GoldenRunID,
 		ProjectID:       sim.ProjectID,
 		CreatedAt:       sim.CreatedAt,
 		UpdatedAt:       sim.UpdatedAt,
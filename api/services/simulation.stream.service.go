@@ -0,0 +1,199 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"nexfi-backend/models"
+	"nexfi-backend/pkg/redis"
+	"nexfi-backend/pkg/simulator"
+	"strings"
+	"time"
+)
+
+// ============================================
+// Run Event Stream
+// ============================================
+
+// A run publishes what it is doing to its simulation's event stream. Each
+// event is appended to a log in Redis, which holds the latest run only, and
+// published on a channel of the same name for the live sockets. Events are
+// numbered across runs so a client that reconnects asks for those after the
+// last one it saw.
+
+// SimulationEvent is one event of a simulation's stream, in the shape of
+// the WebSocket envelope
+type SimulationEvent struct {
+	Seq   int64                  `json:"seq"`
+	Event string                 `json:"event"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// Simulation stream events
+const (
+	EventRunState      = "run_state"
+	EventRunProgress   = "run_progress"
+	EventWaveformChunk = "waveform_chunk"
+	EventRunWarning    = "run_warning"
+)
+
+// simulationEventTTL is how long the event log of a run is kept for
+// reconnecting clients
+const simulationEventTTL = time.Hour
+
+// simulationEventLimit is how many of the latest events the log keeps. A
+// client further behind gets those and reads the rest of the waveform from
+// the run.
+const simulationEventLimit = 1000
+
+// SimulationEventsPattern matches the channels of all simulations
+var SimulationEventsPattern = redis.BuildKey("simulation", "*", "events")
+
+func simulationEventsKey(simulationID string) string {
+	return redis.BuildKey("simulation", simulationID, "events")
+}
+
+// SimulationIDFromChannel returns the simulation whose events a channel carries
+func SimulationIDFromChannel(channel string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(channel, "simulation:"), ":events")
+}
+
+// runStream publishes the events of one run
+type runStream struct {
+	simulationID string
+	runID        string
+}
+
+func newRunStream(simulationID, runID string) *runStream {
+	return &runStream{simulationID: simulationID, runID: runID}
+}
+
+// reset drops the events of earlier runs
+func (r *runStream) reset() {
+	if redis.RedisClient == nil {
+		return
+	}
+	redis.Delete(simulationEventsKey(r.simulationID))
+}
+
+// publish numbers, logs and broadcasts an event. The stream is best
+// effort: a run never fails because its events could not be sent.
+func (r *runStream) publish(event string, data map[string]interface{}) {
+	if redis.RedisClient == nil {
+		return
+	}
+	key := simulationEventsKey(r.simulationID)
+	seqKey := redis.BuildKey("simulation", r.simulationID, "seq")
+	seq, err := redis.Increment(seqKey)
+	if err != nil {
+		log.Printf("Failed to publish simulation event: %v", err)
+		return
+	}
+	redis.Expire(seqKey, simulationEventTTL)
+
+	data["seq"] = seq
+	data["run_id"] = r.runID
+	payload, err := json.Marshal(SimulationEvent{Seq: seq, Event: event, Data: data})
+	if err != nil {
+		return
+	}
+	if err := redis.RPush(key, payload); err == nil {
+		redis.LTrim(key, -simulationEventLimit, -1)
+		redis.Expire(key, simulationEventTTL)
+	}
+	redis.Publish(key, payload)
+}
+
+// state publishes the status of the run
+func (r *runStream) state(run *models.SimulationRun, analysis string, errs []simulator.Issue) {
+	data := map[string]interface{}{
+		"status":     run.Status,
+		"started_at": run.StartedAt,
+	}
+	if analysis != "" {
+		data["analysis"] = analysis
+	}
+	if run.CompletedAt != nil {
+		data["completed_at"] = run.CompletedAt
+		data["duration_ms"] = run.DurationMs
+	}
+	if len(errs) > 0 {
+		data["errors"] = errs
+	}
+	r.publish(EventRunState, data)
+}
+
+// progress publishes a progress report of the simulator
+func (r *runStream) progress(p simulator.Progress) {
+	r.publish(EventRunProgress, map[string]interface{}{"percent": p.Percent, "time": p.Time})
+	if p.Chunk != nil {
+		r.publish(EventWaveformChunk, map[string]interface{}{"time": p.Chunk.Time, "signals": p.Chunk.Signals})
+	}
+	if len(p.Warnings) > 0 {
+		r.publish(EventRunWarning, map[string]interface{}{"warnings": p.Warnings})
+	}
+}
+
+// CheckSimulationAccess checks that a user may follow the events of a
+// simulation
+func (s *SimulationService) CheckSimulationAccess(simulationID, userID string) error {
+	simulation, err := s.repo.FindByID(simulationID)
+	if err != nil {
+		return errors.New("simulation not found")
+	}
+	if err := s.checkSimulationAccess(simulation, userID, models.ProjectPermView); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSimulationEvents returns the events of a simulation's latest run
+// after the given sequence number, and the sequence number it replayed
+// from: 0 when the one given is newer than the log, as once the counter
+// has expired. Without logged events, as once the log has expired, the
+// state of the latest run is returned instead, from 0.
+func (s *SimulationService) GetSimulationEvents(simulationID, userID string, after int64) ([]SimulationEvent, int64, error) {
+	if err := s.CheckSimulationAccess(simulationID, userID); err != nil {
+		return nil, 0, err
+	}
+
+	events := []SimulationEvent{}
+	if redis.RedisClient != nil {
+		entries, _ := redis.LRange(simulationEventsKey(simulationID), 0, -1)
+		logged := make([]SimulationEvent, 0, len(entries))
+		for _, entry := range entries {
+			var event SimulationEvent
+			if json.Unmarshal([]byte(entry), &event) == nil {
+				logged = append(logged, event)
+			}
+		}
+		if n := len(logged); n > 0 {
+			if after > logged[n-1].Seq {
+				// Numbered before the counter expired: replay all
+				after = 0
+			}
+			for _, event := range logged {
+				if event.Seq > after {
+					events = append(events, event)
+				}
+			}
+			return events, after, nil
+		}
+	}
+
+	run, err := s.repo.GetLatestRun(simulationID)
+	if err != nil || run == nil {
+		return events, 0, nil
+	}
+	data := map[string]interface{}{
+		"seq":        0,
+		"run_id":     run.ID,
+		"status":     run.Status,
+		"started_at": run.StartedAt,
+	}
+	if run.CompletedAt != nil {
+		data["completed_at"] = run.CompletedAt
+		data["duration_ms"] = run.DurationMs
+	}
+	return append(events, SimulationEvent{Event: EventRunState, Data: data}), 0, nil
+}
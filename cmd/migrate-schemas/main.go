@@ -0,0 +1,42 @@
+// Command migrate-schemas upgrades every stored schema_data document
+// (circuits, templates, simulations, projects) to the current format
+// version; circuit revisions are history and are left as saved. Reads
+// upgrade documents in memory without storing them, so running it is
+// optional; it is safe to run repeatedly.
+//
+//	go run ./cmd/migrate-schemas -batch 500
+package main
+
+import (
+	"flag"
+	"log"
+
+	"nexfi-backend/api/services"
+	"nexfi-backend/database"
+	"nexfi-backend/pkg/schematic"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 500, "rows per batch")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	database.InitDB()
+
+	log.Printf("🔄 Upgrading schema documents to version %d...", schematic.CurrentVersion)
+
+	upgraded, err := services.NewSchemaService(database.DB).MigrateAll(*batchSize)
+	for table, count := range upgraded {
+		log.Printf("   %s: %d upgraded", table, count)
+	}
+	if err != nil {
+		log.Fatalf("❌ Schema migration failed: %v", err)
+	}
+
+	log.Println("✅ Schema documents are up to date")
+}
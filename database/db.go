@@ -91,6 +91,7 @@ func RunMigrations() {
 			Models: []interface{}{
 				&models.ComponentCategory{},
 				&models.Component{},
+				&models.ComponentModel{},
 				&models.ComponentRequest{},
 				&models.UserFavoriteComponent{},
 			},
@@ -150,6 +151,7 @@ func RunMigrations() {
 				&models.LabQueue{},
 				&models.LabHardwareLog{},
 				&models.CodeCompilation{},
+				&models.LabDeployment{},
 			},
 		},
 		{
@@ -157,8 +159,8 @@ func RunMigrations() {
 			Models: []interface{}{
 				&models.ProjectProgress{},
 				&models.ProjectMilestone{},
+				&models.ProjectVersion{},
 				&models.UserXPTransaction{},
-				&models.ProjectSimulationResult{},
 			},
 		},
 		{
@@ -166,6 +168,8 @@ func RunMigrations() {
 			Models: []interface{}{
 				&models.Circuit{},
 				&models.CircuitTemplate{},
+				&models.CircuitRevision{},
+				&models.CircuitStar{},
 			},
 		},
 		{
@@ -196,6 +200,9 @@ func RunMigrations() {
 	// Create indexes after migration
 	createIndexes()
 
+	// Backfill data the new columns need
+	runDataMigrations()
+
 	log.Println("✅ Database migrations completed")
 }
 
@@ -217,6 +224,8 @@ func createIndexes() {
 		// Component indexes
 		"CREATE INDEX IF NOT EXISTS idx_components_category ON components(category_id)",
 		"CREATE INDEX IF NOT EXISTS idx_components_is_active ON components(is_active)",
+		"CREATE INDEX IF NOT EXISTS idx_components_simulation_model ON components(simulation_model)",
+		"CREATE INDEX IF NOT EXISTS idx_component_models_is_active ON component_models(is_active)",
 
 		// Challenge indexes
 		"CREATE INDEX IF NOT EXISTS idx_challenges_type ON challenges(type)",
@@ -261,6 +270,24 @@ func createIndexes() {
 		"CREATE INDEX IF NOT EXISTS idx_lab_hardware_logs_session ON lab_hardware_logs(session_id)",
 		"CREATE INDEX IF NOT EXISTS idx_lab_hardware_logs_type ON lab_hardware_logs(event_type)",
 
+		// Simulation indexes
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_simulations_project_simulation ON simulations(project_id) WHERE is_project_simulation = true",
+
+		// Lab deployment indexes
+		"CREATE INDEX IF NOT EXISTS idx_lab_deployments_queued ON lab_deployments(lab_id, user_id) WHERE status = 'queued'",
+
+		// Circuit revision indexes
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_circuit_revisions_number ON circuit_revisions(circuit_id, revision_number)",
+
+		// Project version indexes
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_project_versions_number ON project_versions(project_id, version_number)",
+
+		// Circuit gallery indexes
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_circuit_stars_unique ON circuit_stars(circuit_id, user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_circuit_stars_created ON circuit_stars(created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_circuits_public ON circuits(is_public) WHERE is_public = true",
+		"CREATE INDEX IF NOT EXISTS idx_circuits_tags ON circuits USING GIN(tags)",
+
 		// Code compilation indexes
 		"CREATE INDEX IF NOT EXISTS idx_code_compilations_session ON code_compilations(session_id)",
 		"CREATE INDEX IF NOT EXISTS idx_code_compilations_status ON code_compilations(status)",
@@ -273,6 +300,39 @@ func createIndexes() {
 	}
 }
 
+// dataMigrations are one-off data changes. Each runs once, recorded by
+// name in data_migrations, so later rows are left as they are written.
+var dataMigrations = []struct {
+	Name string
+	SQL  string
+}{
+	// Collaborators added before invitations had to be accepted keep their access
+	{"project_collaborators_accepted_at", "UPDATE project_collaborators SET accepted_at = invited_at WHERE accepted_at IS NULL"},
+	// Copies of one's own circuit were linked as forks
+	{"circuits_own_copies_not_forks", "UPDATE circuits SET forked_from_id = NULL FROM circuits AS original WHERE circuits.forked_from_id = original.id AND circuits.user_id = original.user_id"},
+}
+
+// runDataMigrations runs the data migrations not run yet
+func runDataMigrations() {
+	if err := DB.Exec("CREATE TABLE IF NOT EXISTS data_migrations (name VARCHAR(255) PRIMARY KEY, ran_at TIMESTAMPTZ NOT NULL DEFAULT NOW())").Error; err != nil {
+		panic(fmt.Sprintf("Failed to create data_migrations: %v", err))
+	}
+
+	for _, migration := range dataMigrations {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Exec("INSERT INTO data_migrations (name) VALUES (?) ON CONFLICT DO NOTHING", migration.Name)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			log.Printf("  → Running data migration %s...", migration.Name)
+			return tx.Exec(migration.SQL).Error
+		})
+		if err != nil {
+			panic(fmt.Sprintf("Failed to run data migration %s: %v", migration.Name, err))
+		}
+	}
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return DB
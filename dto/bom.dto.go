@@ -0,0 +1,51 @@
+package dto
+
+import "time"
+
+// ============================================
+// Bill of Materials DTOs
+// ============================================
+
+// BOMStockStatus describes catalog availability of a BOM line
+type BOMStockStatus string
+
+const (
+	BOMInStock      BOMStockStatus = "in_stock"
+	BOMLowStock     BOMStockStatus = "low_stock" // some stock, but fewer than needed
+	BOMOutOfStock   BOMStockStatus = "out_of_stock"
+	BOMNotInCatalog BOMStockStatus = "not_in_catalog"
+)
+
+// BOMItem is one line of the bill of materials
+type BOMItem struct {
+	ComponentID  *string        `json:"component_id"`
+	Name         string         `json:"name"`
+	Type         string         `json:"type"`
+	Value        string         `json:"value,omitempty"`
+	PartNumber   string         `json:"part_number,omitempty"`
+	Manufacturer string         `json:"manufacturer,omitempty"`
+	DatasheetURL string         `json:"datasheet_url,omitempty"`
+	ImageURL     string         `json:"image_url,omitempty"`
+	Designators  []string       `json:"designators"`
+	Quantity     int            `json:"quantity"`
+	UnitPrice    float64        `json:"unit_price"`
+	Subtotal     float64        `json:"subtotal"`
+	Stock        int            `json:"stock"`
+	StockStatus  BOMStockStatus `json:"stock_status"`
+}
+
+// BOMResponse is the bill of materials of a circuit or project
+type BOMResponse struct {
+	SourceType      string    `json:"source_type"` // circuit, project
+	SourceID        string    `json:"source_id"`
+	SourceName      string    `json:"source_name"`
+	Items           []BOMItem `json:"items"`
+	TotalParts      int       `json:"total_parts"`
+	UniqueParts     int       `json:"unique_parts"`
+	TotalCost       float64   `json:"total_cost"`
+	Currency        string    `json:"currency"`
+	OutOfStockCount int       `json:"out_of_stock_count"`
+	LowStockCount   int       `json:"low_stock_count"` // in stock, but fewer than needed
+	UnresolvedCount int       `json:"unresolved_count"`
+	GeneratedAt     time.Time `json:"generated_at"`
+}
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"nexfi-backend/pkg/simulator"
 	"time"
 
 	"gorm.io/datatypes"
@@ -100,12 +101,25 @@ type SubmitChallengeRequest struct {
 	Notes          string         `json:"notes"`
 }
 
-// SubmitChallengeResponse for challenge submission result
+// SubmitChallengeResponse for challenge submission result. Auto-graded
+// challenges that fail are not completed and earn no XP.
 type SubmitChallengeResponse struct {
+	Passed               bool                  `json:"passed"`
 	XPEarned             int                   `json:"xp_earned"`
 	BonusXP              int                   `json:"bonus_xp"`
 	TotalXP              int                   `json:"total_xp"`
 	NewLevel             int                   `json:"new_level"`
 	LevelUp              bool                  `json:"level_up"`
 	AchievementsUnlocked []AchievementResponse `json:"achievements_unlocked"`
+	Grade                *ChallengeGrade       `json:"grade,omitempty"`
+}
+
+// ChallengeGrade is the auto-grading report of a submission
+type ChallengeGrade struct {
+	Passed     bool                  `json:"passed"`
+	Score      int                   `json:"score"` // percent of test vectors passed
+	Feedback   string                `json:"feedback"`
+	TruthTable *simulator.TruthTable `json:"truth_table,omitempty"`
+	Errors     []simulator.Issue     `json:"errors"`
+	Warnings   []simulator.Issue     `json:"warnings"`
 }
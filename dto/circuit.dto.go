@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"nexfi-backend/pkg/schematic"
 	"time"
 
 	"gorm.io/datatypes"
@@ -33,10 +34,25 @@ type CircuitResponse struct {
 	ProjectName     string         `json:"project_name,omitempty"`
 	IsTemplate      bool           `json:"is_template"`
 	IsPublic        bool           `json:"is_public"`
+	Tags            []string       `json:"tags"`
+	StarsCount      int            `json:"stars_count"`
+	ForksCount      int            `json:"forks_count"`
+	IsStarred       bool           `json:"is_starred"`
+	AuthorID        string         `json:"author_id"`
+	AuthorName      string         `json:"author_name,omitempty"`
+	ForkedFrom      *CircuitSource `json:"forked_from,omitempty"`
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 }
 
+// CircuitSource identifies the circuit a fork was made from
+type CircuitSource struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	AuthorID   string `json:"author_id,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+}
+
 // CircuitDetailResponse includes full schema data
 type CircuitDetailResponse struct {
 	CircuitResponse
@@ -49,6 +65,7 @@ type CreateCircuitRequest struct {
 	Description string         `json:"description"`
 	ProjectID   *string        `json:"project_id"`
 	SchemaData  datatypes.JSON `json:"schema_data" binding:"required"`
+	Tags        []string       `json:"tags" binding:"omitempty,max=10,dive,max=50"`
 }
 
 // UpdateCircuitRequest for updating circuit
@@ -57,11 +74,29 @@ type UpdateCircuitRequest struct {
 	Description string         `json:"description"`
 	SchemaData  datatypes.JSON `json:"schema_data"`
 	IsPublic    *bool          `json:"is_public"`
+	Tags        []string       `json:"tags" binding:"omitempty,max=10,dive,max=50"`
+	Message     string         `json:"message" binding:"omitempty,max=500"` // revision message
+}
+
+// CircuitExploreRequest for browsing public circuits
+type CircuitExploreRequest struct {
+	Page     int    `form:"page,default=1"`
+	Limit    int    `form:"limit,default=20"`
+	Search   string `form:"search"`
+	Tag      string `form:"tag"`
+	AuthorID string `form:"author_id"`
+	Sort     string `form:"sort,default=trending" binding:"omitempty,oneof=trending most_forked most_starred newest"`
+}
+
+// CircuitStarResponse for star toggle response
+type CircuitStarResponse struct {
+	IsStarred  bool `json:"is_starred"`
+	StarsCount int  `json:"stars_count"`
 }
 
 // CircuitThumbnailRequest for uploading thumbnail
 type CircuitThumbnailRequest struct {
-	ImageData string `json:"image_data" binding:"required"` // base64 encoded
+	ImageData string `json:"image_data"` // base64 encoded PNG; empty re-renders server-side
 }
 
 // CircuitThumbnailResponse for thumbnail upload response
@@ -71,9 +106,78 @@ type CircuitThumbnailResponse struct {
 
 // CircuitExportResponse for export response
 type CircuitExportResponse struct {
-	Format   string `json:"format"`
-	Filename string `json:"filename"`
-	Content  string `json:"content"`
+	Format       string               `json:"format"`
+	Filename     string               `json:"filename"`
+	Content      string               `json:"content"`
+	UnknownParts []CircuitUnknownPart `json:"unknown_parts,omitempty"`
+}
+
+// ImportWokwiRequest for importing a Wokwi diagram.json
+type ImportWokwiRequest struct {
+	Name        string         `json:"name" binding:"required,max=255"`
+	Description string         `json:"description"`
+	ProjectID   *string        `json:"project_id"`
+	Diagram     datatypes.JSON `json:"diagram" binding:"required"` // contents of diagram.json
+}
+
+// CircuitUnknownPart reports a part that has no equivalent on the other side
+type CircuitUnknownPart struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// ImportCircuitResponse for import response
+type ImportCircuitResponse struct {
+	Circuit            *CircuitResponse     `json:"circuit"`
+	UnknownParts       []CircuitUnknownPart `json:"unknown_parts"`
+	SkippedConnections []string             `json:"skipped_connections"`
+}
+
+// ============================================
+// Circuit Revision DTOs
+// ============================================
+
+// CircuitRevisionListRequest for listing revisions
+type CircuitRevisionListRequest struct {
+	Page  int `form:"page,default=1"`
+	Limit int `form:"limit,default=20"`
+}
+
+// CircuitRevisionResponse for revision list
+type CircuitRevisionResponse struct {
+	ID              string    `json:"id"`
+	RevisionNumber  int       `json:"revision_number"`
+	Message         string    `json:"message"`
+	AuthorID        string    `json:"author_id"`
+	AuthorName      string    `json:"author_name,omitempty"`
+	ComponentsCount int       `json:"components_count"`
+	WiresCount      int       `json:"wires_count"`
+	RestoredFromID  *string   `json:"restored_from_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CircuitRevisionDetailResponse includes the snapshot
+type CircuitRevisionDetailResponse struct {
+	CircuitRevisionResponse
+	SchemaData datatypes.JSON `json:"schema_data"`
+}
+
+// CircuitRevisionDiffRequest for comparing two revisions
+type CircuitRevisionDiffRequest struct {
+	From string `form:"from" binding:"required"`
+	To   string `form:"to"` // defaults to the latest revision
+}
+
+// CircuitRevisionDiffResponse for revision diff
+type CircuitRevisionDiffResponse struct {
+	From *CircuitRevisionResponse `json:"from"`
+	To   *CircuitRevisionResponse `json:"to"`
+	Diff *schematic.SchemaDiff    `json:"diff"`
+}
+
+// RestoreRevisionRequest for restoring a revision
+type RestoreRevisionRequest struct {
+	Message string `json:"message" binding:"omitempty,max=500"`
 }
 
 // ============================================
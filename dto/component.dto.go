@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"nexfi-backend/pkg/simulator"
 	"time"
 
 	"gorm.io/datatypes"
@@ -39,23 +40,24 @@ type ComponentListRequest struct {
 
 // ComponentResponse for single component
 type ComponentResponse struct {
-	ID              string            `json:"id"`
-	CategoryID      string            `json:"category_id"`
-	Name            string            `json:"name"`
-	Description     string            `json:"description"`
-	Manufacturer    string            `json:"manufacturer"`
-	PartNumber      string            `json:"part_number"`
-	Specs           datatypes.JSON    `json:"specs"`
-	Price           float64           `json:"price"`
-	Stock           int               `json:"stock"`
-	Rating          float64           `json:"rating"`
-	RatingCount     int               `json:"rating_count"`
-	ImageURL        string            `json:"image_url"`
-	DatasheetURL    string            `json:"datasheet_url"`
-	SimulationModel string            `json:"simulation_model"`
-	IsActive        bool              `json:"is_active"`
-	IsFavorite      bool              `json:"is_favorite,omitempty"`
-	Category        *CategoryResponse `json:"category,omitempty"`
+	ID              string                  `json:"id"`
+	CategoryID      string                  `json:"category_id"`
+	Name            string                  `json:"name"`
+	Description     string                  `json:"description"`
+	Manufacturer    string                  `json:"manufacturer"`
+	PartNumber      string                  `json:"part_number"`
+	Specs           datatypes.JSON          `json:"specs"`
+	Price           float64                 `json:"price"`
+	Stock           int                     `json:"stock"`
+	Rating          float64                 `json:"rating"`
+	RatingCount     int                     `json:"rating_count"`
+	ImageURL        string                  `json:"image_url"`
+	DatasheetURL    string                  `json:"datasheet_url"`
+	SimulationModel string                  `json:"simulation_model"`
+	IsActive        bool                    `json:"is_active"`
+	IsFavorite      bool                    `json:"is_favorite,omitempty"`
+	Category        *CategoryResponse       `json:"category,omitempty"`
+	Model           *ComponentModelResponse `json:"model,omitempty"` // the model simulation_model names
 }
 
 // ComponentSearchRequest for searching components
@@ -102,3 +104,31 @@ type ComponentRequestResponse struct {
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
+
+// ============================================
+// Component Model DTOs
+// ============================================
+
+// ComponentModelRequest uploads a model to the model library
+type ComponentModelRequest struct {
+	Name        string                 `json:"name" binding:"required,max=100"`
+	Device      string                 `json:"device" binding:"required"`
+	Description string                 `json:"description"`
+	Params      map[string]float64     `json:"params"`
+	Pins        map[string]string      `json:"pins"`
+	Defaults    map[string]interface{} `json:"defaults"`
+	Behavior    *simulator.Behavior    `json:"behavior"`
+}
+
+// ComponentModelResponse for a model of the model library
+type ComponentModelResponse struct {
+	simulator.DeviceModel
+	Builtin   bool       `json:"builtin"`
+	Version   int        `json:"version,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// AssignComponentModelRequest points a catalog component at a model
+type AssignComponentModelRequest struct {
+	Model string `json:"model"` // empty to clear it
+}
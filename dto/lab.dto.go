@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"nexfi-backend/pkg/simulator"
 	"time"
 
 	"gorm.io/datatypes"
@@ -121,6 +122,8 @@ type StartSessionResponse struct {
 	RoomName       string          `json:"room_name"`
 	ExpiresAt      time.Time       `json:"expires_at"`
 	HardwareConfig *HardwareConfig `json:"hardware_config"`
+	DeploymentID   string          `json:"deployment_id,omitempty"`  // Deployment staged on the session
+	CompilationID  string          `json:"compilation_id,omitempty"` // Compilation of the staged code
 }
 
 // HardwareConfig for hardware configuration
@@ -196,6 +199,52 @@ type CompilationStatusResponse struct {
 	UploadedAt *time.Time `json:"uploaded_at,omitempty"`
 }
 
+// ============================================
+// Lab Deployment DTOs
+// ============================================
+
+// DeployToLabRequest for promoting a simulation to a lab
+type DeployToLabRequest struct {
+	SimulationID string            `json:"simulation_id" binding:"required,uuid"`
+	RunID        string            `json:"run_id" binding:"omitempty,uuid"` // Optional - defaults to the golden run, else the latest run
+	Probes       map[string]string `json:"probes"`                          // Sensor -> simulation probe it measures, e.g. {"LDR.voltage": "V(N2)"}
+	BidAmount    int               `json:"bid_amount"`                      // XP to bid for priority (optional)
+}
+
+// DeploymentComparisonRequest for comparing a deployment's readings with its predictions
+type DeploymentComparisonRequest struct {
+	AbsTol     float64 `form:"abs_tol" binding:"omitempty,gt=0"`
+	CurrentTol float64 `form:"current_tol" binding:"omitempty,gt=0"`
+	RelTol     float64 `form:"rel_tol" binding:"omitempty,gt=0"`
+}
+
+// DeploymentResponse for a lab deployment
+type DeploymentResponse struct {
+	ID            string                 `json:"id"`
+	LabID         string                 `json:"lab_id"`
+	SimulationID  string                 `json:"simulation_id"`
+	RunID         string                 `json:"run_id"`
+	ProjectID     *string                `json:"project_id"`
+	SessionID     *string                `json:"session_id"`
+	CompilationID *string                `json:"compilation_id"`
+	Status        string                 `json:"status"`
+	Platform      string                 `json:"platform"`
+	Language      string                 `json:"language"`
+	Filename      string                 `json:"filename"`
+	Predictions   []simulator.Prediction `json:"predictions"`
+	Probes        map[string]string      `json:"probes"`
+	Queue         *JoinQueueResponse     `json:"queue,omitempty"`
+	StagedAt      *time.Time             `json:"staged_at"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+// DeploymentComparisonResponse compares the sensor readings of a deployment's session with its predictions
+type DeploymentComparisonResponse struct {
+	Deployment DeploymentResponse            `json:"deployment"`
+	Readings   []simulator.Reading           `json:"readings"`
+	Comparison *simulator.HardwareComparison `json:"comparison"`
+}
+
 // ============================================
 // Sensor/Actuator DTOs
 // ============================================
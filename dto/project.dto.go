@@ -1,6 +1,11 @@
 package dto
 
 import (
+	"nexfi-backend/pkg/lint"
+	"nexfi-backend/pkg/ot"
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/textdiff"
+	"nexfi-backend/pkg/workspace"
 	"time"
 
 	"gorm.io/datatypes"
@@ -48,11 +53,19 @@ type ProjectResponse struct {
 // ProjectDetailResponse includes schema/code data
 type ProjectDetailResponse struct {
 	ProjectResponse
-	SchemaData     datatypes.JSON             `json:"schema_data"`
-	CodeData       datatypes.JSON             `json:"code_data"`
-	SimulationData datatypes.JSON             `json:"simulation_data"`
-	Components     []ProjectComponentResponse `json:"components"`
-	Collaborators  []CollaboratorResponse     `json:"collaborators"`
+	SchemaData    datatypes.JSON             `json:"schema_data"`
+	CodeData      datatypes.JSON             `json:"code_data"`
+	Simulation    *ProjectSimulationInfo     `json:"simulation"` // nil until the project's first run
+	Components    []ProjectComponentResponse `json:"components"`
+	Collaborators []CollaboratorResponse     `json:"collaborators"`
+}
+
+// ProjectSimulationInfo sums up the simulation a project runs on
+type ProjectSimulationInfo struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	RunCount  int        `json:"run_count"`
+	LastRunAt *time.Time `json:"last_run_at"`
 }
 
 // ProjectCreateRequest for creating new project
@@ -79,7 +92,12 @@ type ProjectUpdateRequest struct {
 	IsFavorite       *bool          `json:"is_favorite"`
 	SchemaData       datatypes.JSON `json:"schema_data"`
 	CodeData         datatypes.JSON `json:"code_data"`
-	SimulationData   datatypes.JSON `json:"simulation_data"`
+}
+
+// ProjectImportResponse is the project recreated from a .nexflux archive
+type ProjectImportResponse struct {
+	Project  ProjectResponse `json:"project"`
+	Warnings []string        `json:"warnings"` // what was left out
 }
 
 // ============================================
@@ -102,6 +120,19 @@ type AddCollaboratorRequest struct {
 	Role  string `json:"role" binding:"required,oneof=editor viewer"`
 }
 
+// UpdateCollaboratorRequest for changing a collaborator's role
+type UpdateCollaboratorRequest struct {
+	Role string `json:"role" binding:"required,oneof=editor viewer"`
+}
+
+// ProjectInvitationResponse for an invitation waiting for an answer
+type ProjectInvitationResponse struct {
+	ID        string           `json:"id"`
+	Role      string           `json:"role"`
+	InvitedAt time.Time        `json:"invited_at"`
+	Project   *ProjectResponse `json:"project"`
+}
+
 // ============================================
 // Project Component DTOs
 // ============================================
@@ -205,21 +236,100 @@ type SaveSchemaResponse struct {
 // Code Save DTOs
 // ============================================
 
-// SaveCodeRequest for saving code data
+// SaveCodeRequest for saving code data. Files replaces the whole workspace;
+// the single-file form of older clients saves Content to Filename, or to
+// the main file, and keeps the other files.
 type SaveCodeRequest struct {
-	Content  string `json:"content" binding:"required"`
-	Language string `json:"language" binding:"required,oneof=arduino micropython c cpp python"`
-	Filename string `json:"filename"`
+	Files   []CodeFileRequest `json:"files" binding:"omitempty,max=100,dive"`
+	Folders []string          `json:"folders" binding:"omitempty,max=100"`
+	Main    string            `json:"main"`
+
+	Content  *string `json:"content"`
+	Language string  `json:"language" binding:"omitempty,oneof=arduino micropython c cpp python text"`
+	Filename string  `json:"filename"`
+}
+
+// CodeFileRequest is a file of a saved workspace
+type CodeFileRequest struct {
+	Path     string `json:"path" binding:"required"`
+	Language string `json:"language" binding:"omitempty,oneof=arduino micropython c cpp python text"`
+	Content  string `json:"content"`
+}
+
+// SaveCodeFileRequest for creating or replacing one file
+type SaveCodeFileRequest struct {
+	Content  *string `json:"content" binding:"required"`
+	Language string  `json:"language" binding:"omitempty,oneof=arduino micropython c cpp python text"` // defaults to the extension's
+}
+
+// UpdateCodeFileRequest for renaming or moving a file or changing its language
+type UpdateCodeFileRequest struct {
+	Path     string `json:"path"`
+	Language string `json:"language" binding:"omitempty,oneof=arduino micropython c cpp python text"`
+}
+
+// CodeFolderRequest for creating a folder
+type CodeFolderRequest struct {
+	Path string `json:"path" binding:"required"`
+}
+
+// SetMainFileRequest for choosing the entry file
+type SetMainFileRequest struct {
+	Path string `json:"path" binding:"required"`
+}
+
+// CodeIssue is a problem found in a file
+type CodeIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// CodeCheckResponse is what code progress was measured from
+type CodeCheckResponse struct {
+	Files        int        `json:"files"`
+	Functions    int        `json:"functions"` // functions whose body does something
+	Compiles     *bool      `json:"compiles"`  // null when the language cannot be compiled on the server
+	CompileError *CodeIssue `json:"compile_error,omitempty"`
+	Percentage   int        `json:"percentage"`
+}
+
+// CodeFileResponse is a file with the functions it defines
+type CodeFileResponse struct {
+	workspace.File
+	Functions []workspace.Function `json:"functions"`
+}
+
+// AnalyzeCodeRequest for checking code before it is submitted. Without
+// files the saved code is checked; files replace saved files of the same
+// path, so the editor can check code it has not saved yet.
+type AnalyzeCodeRequest struct {
+	Files    []CodeFileRequest `json:"files" binding:"omitempty,max=100,dive"`
+	Main     string            `json:"main"`
+	Platform string            `json:"platform"` // defaults to the project's hardware platform
+}
+
+// CodeAnalysisResponse lists the findings of a code check
+type CodeAnalysisResponse struct {
+	Platform     string            `json:"platform"`
+	BoardChecked bool              `json:"board_checked"` // pins were checked against the platform's board
+	Errors       int               `json:"errors"`
+	Warnings     int               `json:"warnings"`
+	Infos        int               `json:"infos"`
+	Ready        bool              `json:"ready"` // no errors, so the code can be submitted
+	Diagnostics  []lint.Diagnostic `json:"diagnostics"`
 }
 
 // SaveCodeResponse for code save response
 type SaveCodeResponse struct {
-	Success        bool `json:"success"`
-	Progress       int  `json:"progress"`
-	ProgressChange int  `json:"progress_change"`
-	XPEarned       int  `json:"xp_earned"`
-	IsFirstSave    bool `json:"is_first_save"`
-	CharCount      int  `json:"char_count"`
+	Success        bool               `json:"success"`
+	Progress       int                `json:"progress"`
+	ProgressChange int                `json:"progress_change"`
+	XPEarned       int                `json:"xp_earned"`
+	IsFirstSave    bool               `json:"is_first_save"`
+	CharCount      int                `json:"char_count"` // of all files
+	Code           *CodeCheckResponse `json:"code"`
+	File           *CodeFileResponse  `json:"file,omitempty"` // the file saved, for single-file saves
 }
 
 // ============================================
@@ -234,11 +344,13 @@ type RunSimulationRequest struct {
 
 // RunSimulationResponse for simulation response
 type RunSimulationResponse struct {
-	SimulationID   string              `json:"simulation_id"`
-	Status         string              `json:"status"` // success, failed, timeout
-	Results        *SimulationResults  `json:"results"`
-	XPEarned       int                 `json:"xp_earned"`
-	ProgressUpdate *ProgressUpdateInfo `json:"progress_update"`
+	SimulationID       string              `json:"simulation_id"` // the project's simulation
+	RunID              string              `json:"run_id"`
+	Status             string              `json:"status"` // queued, completed, error, stopped
+	Results            *SimulationResults  `json:"results"`
+	XPEarned           int                 `json:"xp_earned"`
+	MilestonesUnlocked []string            `json:"milestones_unlocked"`
+	ProgressUpdate     *ProgressUpdateInfo `json:"progress_update"`
 }
 
 // SimulationResults contains simulation output
@@ -254,6 +366,80 @@ type ProgressUpdateInfo struct {
 	New int `json:"new"`
 }
 
+// ============================================
+// Project Version DTOs
+// ============================================
+
+// ProjectVersionListRequest for listing versions
+type ProjectVersionListRequest struct {
+	Page        int  `form:"page,default=1"`
+	Limit       int  `form:"limit,default=20"`
+	Checkpoints bool `form:"checkpoints"` // named versions only
+}
+
+// ProjectVersionResponse for version list
+type ProjectVersionResponse struct {
+	ID              string    `json:"id"`
+	VersionNumber   int       `json:"version_number"`
+	Name            string    `json:"name,omitempty"`
+	Message         string    `json:"message"`
+	IsCheckpoint    bool      `json:"is_checkpoint"`
+	AuthorID        string    `json:"author_id"`
+	AuthorName      string    `json:"author_name,omitempty"`
+	ComponentsCount int       `json:"components_count"`
+	WiresCount      int       `json:"wires_count"`
+	SaveCount       int       `json:"save_count"`
+	RestoredFromID  *string   `json:"restored_from_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ProjectVersionDetailResponse includes the snapshot
+type ProjectVersionDetailResponse struct {
+	ProjectVersionResponse
+	SchemaData datatypes.JSON `json:"schema_data"`
+	CodeData   datatypes.JSON `json:"code_data"`
+}
+
+// CreateCheckpointRequest names the project's current state
+type CreateCheckpointRequest struct {
+	Name    string `json:"name" binding:"required,max=100"`
+	Message string `json:"message" binding:"omitempty,max=500"`
+}
+
+// UpdateVersionRequest names or renames a version
+type UpdateVersionRequest struct {
+	Name    string  `json:"name" binding:"max=100"` // empty to unname it
+	Message *string `json:"message" binding:"omitempty,max=500"`
+}
+
+// ProjectVersionDiffRequest for comparing two versions
+type ProjectVersionDiffRequest struct {
+	From string `form:"from" binding:"required"`
+	To   string `form:"to"` // defaults to the project's current state
+}
+
+// ProjectVersionDiffResponse for version diff
+type ProjectVersionDiffResponse struct {
+	From   *ProjectVersionResponse `json:"from"`
+	To     *ProjectVersionResponse `json:"to"` // null for the current state
+	Schema *schematic.SchemaDiff   `json:"schema"`
+	Code   []CodeFileDiff          `json:"code"` // changed files only
+}
+
+// CodeFileDiff is the line diff of a code file
+type CodeFileDiff struct {
+	File   string `json:"file"`
+	Status string `json:"status"` // added, removed, modified
+	*textdiff.Diff
+	Unified string `json:"unified"`
+}
+
+// RestoreVersionRequest for restoring a version
+type RestoreVersionRequest struct {
+	Message string `json:"message" binding:"omitempty,max=500"`
+}
+
 // ============================================
 // Complete Project DTOs
 // ============================================
@@ -273,3 +459,95 @@ type LevelUpInfo struct {
 	NewLevel int `json:"new_level"`
 	XPToNext int `json:"xp_to_next"`
 }
+
+// ============================================
+// Collaborative Editing DTOs
+// ============================================
+
+// CollabSelection is a text selection; anchor and head are offsets in the code
+type CollabSelection struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// CollabPresence is where a participant is working
+type CollabPresence struct {
+	Revision   int              `json:"revision,omitempty"` // revision the offsets refer to
+	File       string           `json:"file,omitempty"`     // file the cursor is in; defaults to the main file
+	Cursor     *int             `json:"cursor"`
+	Selection  *CollabSelection `json:"selection"`
+	Components []string         `json:"components"` // selected on the canvas
+}
+
+// CollabParticipantResponse for a participant of a session
+type CollabParticipantResponse struct {
+	ClientID  string          `json:"client_id"`
+	UserID    string          `json:"user_id"`
+	Name      string          `json:"name"`
+	Username  string          `json:"username"`
+	AvatarURL string          `json:"avatar_url"`
+	Role      string          `json:"role"`
+	Color     string          `json:"color"`
+	Presence  *CollabPresence `json:"presence,omitempty"`
+}
+
+// CollabInitResponse is the state a participant starts from
+type CollabInitResponse struct {
+	ClientID     string                      `json:"client_id"`
+	Role         string                      `json:"role"`
+	Revision     int                         `json:"revision"`
+	Code         *workspace.Workspace        `json:"code"`
+	Schema       map[string]interface{}      `json:"schema"`
+	Participants []CollabParticipantResponse `json:"participants"`
+}
+
+// CollabCodeRequest is a code edit of a file made at a revision
+type CollabCodeRequest struct {
+	Revision int               `json:"revision"`
+	File     string            `json:"file"` // defaults to the main file
+	Ops      *ot.TextOperation `json:"ops"`
+}
+
+// CollabSchemaRequest is a batch of schema changes
+type CollabSchemaRequest struct {
+	Ops []schematic.PatchOp `json:"ops"`
+}
+
+// CollabCodeEvent is a code edit broadcast to the other participants
+type CollabCodeEvent struct {
+	ClientID string            `json:"client_id"`
+	UserID   string            `json:"user_id"`
+	Revision int               `json:"revision"`
+	File     string            `json:"file"`
+	Ops      *ot.TextOperation `json:"ops"`
+}
+
+// CollabSchemaEvent is a schema change broadcast to the other participants
+type CollabSchemaEvent struct {
+	ClientID string              `json:"client_id"`
+	UserID   string              `json:"user_id"`
+	Revision int                 `json:"revision"`
+	Ops      []schematic.PatchOp `json:"ops"`
+}
+
+// CollabAckEvent confirms an edit to its sender
+type CollabAckEvent struct {
+	Revision int                        `json:"revision"`
+	Applied  []schematic.PatchOp        `json:"applied,omitempty"`  // schema operations that took effect
+	Rejected []schematic.PatchRejection `json:"rejected,omitempty"` // schema operations that conflicted
+}
+
+// CollabSavedEvent tells participants the session was saved to the project
+type CollabSavedEvent struct {
+	Revision int       `json:"revision"`
+	Progress int       `json:"progress"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// CollabSaveFailedEvent tells participants a save of the session failed;
+// the edits stay unsaved and are saved again with the next save
+type CollabSaveFailedEvent struct {
+	Revision int      `json:"revision"`
+	Parts    []string `json:"parts"` // "schema", "code"
+	Message  string   `json:"message"`
+}
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"nexfi-backend/pkg/simulator"
 	"time"
 
 	"gorm.io/datatypes"
@@ -35,6 +36,7 @@ type SimulationResponse struct {
 	RunCount        int        `json:"run_count"`
 	TotalRuntimeMs  int64      `json:"total_runtime_ms"`
 	LastRunAt       *time.Time `json:"last_run_at"`
+	GoldenRunID     *string    `json:"golden_run_id"`
 	ProjectID       *string    `json:"project_id"`
 	ProjectName     string     `json:"project_name,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
@@ -72,13 +74,18 @@ type UpdateSimulationRequest struct {
 // SimulationStatsResponse for stats endpoint
 type SimulationStatsResponse struct {
 	TotalSimulations    int            `json:"total_simulations"`
+	ProjectSimulations  int            `json:"project_simulations"`
 	RunningNow          int            `json:"running_now"`
 	Completed           int            `json:"completed"`
 	Paused              int            `json:"paused"`
 	Error               int            `json:"error"`
+	TotalRuns           int            `json:"total_runs"`
+	CompletedRuns       int            `json:"completed_runs"`
+	FailedRuns          int            `json:"failed_runs"`
 	TotalRuntimeHours   float64        `json:"total_runtime_hours"`
-	SuccessRate         float64        `json:"success_rate"`
+	SuccessRate         float64        `json:"success_rate"` // completed runs over finished runs, in percent
 	SimulationsThisWeek int            `json:"simulations_this_week"`
+	RunsThisWeek        int            `json:"runs_this_week"`
 	ByType              map[string]int `json:"by_type"`
 }
 
@@ -90,13 +97,56 @@ type SimulationStatsResponse struct {
 type RunSimulationRequestDTO struct {
 	DurationMs       int            `json:"duration_ms" binding:"omitempty,min=100,max=300000"`
 	SettingsOverride datatypes.JSON `json:"settings_override"`
+	Points           int            `json:"points" binding:"omitempty,min=10,max=5000"` // waveform samples returned, default 500
 }
 
 // RunSimulationResponseDTO for run response
 type RunSimulationResponseDTO struct {
-	RunID     string    `json:"run_id"`
-	Status    string    `json:"status"`
-	StartedAt time.Time `json:"started_at"`
+	RunID          string                     `json:"run_id"`
+	Status         string                     `json:"status"`   // queued, completed, error, stopped
+	Analysis       string                     `json:"analysis"` // dc, transient, ac, digital
+	StartedAt      time.Time                  `json:"started_at"`
+	OperatingPoint *simulator.OperatingPoint  `json:"operating_point,omitempty"`
+	Transient      *simulator.TransientResult `json:"transient,omitempty"`
+	AC             *simulator.ACResult        `json:"ac,omitempty"`
+	Digital        *simulator.DigitalResult   `json:"digital,omitempty"`
+	Variation      *simulator.VariationResult `json:"variation,omitempty"`
+	Regression     *RunRegression             `json:"regression,omitempty"`
+	XPEarned       int                        `json:"xp_earned,omitempty"`
+	Milestones     []string                   `json:"milestones_unlocked,omitempty"` // of the simulation's project
+}
+
+// RunRegression is how a run compares with the golden run
+type RunRegression struct {
+	GoldenRunID    string   `json:"golden_run_id"`
+	Diverged       bool     `json:"diverged"`
+	DivergedProbes []string `json:"diverged_probes"`
+	WorstProbe     string   `json:"worst_probe,omitempty"`
+	MaxError       float64  `json:"max_error"`
+}
+
+// RunWaveformRequest for reading a run's waveform
+type RunWaveformRequest struct {
+	Points  int     `form:"points,default=500" binding:"min=10,max=5000"`
+	From    float64 `form:"from"`    // seconds
+	To      float64 `form:"to"`      // seconds, 0 = end of run
+	Signals string  `form:"signals"` // comma-separated signal names, e.g. V(N1),I(R1)
+}
+
+// ExportRunRequest for downloading a run's results
+type ExportRunRequest struct {
+	Format  string `form:"format,default=csv" binding:"oneof=csv vcd json"`
+	Signals string `form:"signals"` // comma-separated probe names, e.g. V(N1),I(R1)
+}
+
+// RunWaveformResponse for a run's waveform
+type RunWaveformResponse struct {
+	RunID    string              `json:"run_id"`
+	Method   string              `json:"method"`
+	Step     float64             `json:"step"`
+	StopTime float64             `json:"stop_time"`
+	Points   int                 `json:"points"`
+	Waveform *simulator.Waveform `json:"waveform"`
 }
 
 // StopSimulationResponse for stop response
@@ -107,26 +157,38 @@ type StopSimulationResponse struct {
 
 // SimulationRunResponse for run history
 type SimulationRunResponse struct {
-	ID          string         `json:"id"`
-	Status      string         `json:"status"`
-	DurationMs  int            `json:"duration_ms"`
-	ResultData  datatypes.JSON `json:"result_data"`
-	Errors      datatypes.JSON `json:"errors"`
-	Warnings    datatypes.JSON `json:"warnings"`
-	StartedAt   time.Time      `json:"started_at"`
-	CompletedAt *time.Time     `json:"completed_at"`
-}
-
-// SaveSimulationResultRequest for saving simulation result
-type SaveSimulationResultRequest struct {
-	DurationMs int            `json:"duration_ms" binding:"required"`
-	ResultData datatypes.JSON `json:"result_data" binding:"required"`
-	Errors     datatypes.JSON `json:"errors"`
-	Warnings   datatypes.JSON `json:"warnings"`
-}
-
-// SaveSimulationResultResponse for save result response
-type SaveSimulationResultResponse struct {
-	RunID    string `json:"run_id"`
-	XPEarned int    `json:"xp_earned"`
+	ID           string         `json:"id"`
+	Status       string         `json:"status"`
+	DurationMs   int            `json:"duration_ms"`
+	ResultData   datatypes.JSON `json:"result_data"`
+	Errors       datatypes.JSON `json:"errors"`
+	Warnings     datatypes.JSON `json:"warnings"`
+	StartedAt    time.Time      `json:"started_at"`
+	CompletedAt  *time.Time     `json:"completed_at"`
+	ParentRunID  *string        `json:"parent_run_id,omitempty"`
+	VariantIndex *int           `json:"variant_index,omitempty"`
+}
+
+// CompareRunsRequest for comparing two runs. A defaults to the golden run
+// and B to the latest run.
+type CompareRunsRequest struct {
+	A          string  `form:"a"`
+	B          string  `form:"b"`
+	AbsTol     float64 `form:"abs_tol" binding:"min=0"`     // V
+	CurrentTol float64 `form:"current_tol" binding:"min=0"` // A
+	RelTol     float64 `form:"rel_tol" binding:"min=0,max=1"`
+	Points     int     `form:"points,default=200" binding:"min=10,max=5000"`
+}
+
+// CompareRunsResponse for a run comparison
+type CompareRunsResponse struct {
+	RunA       SimulationRunResponse `json:"run_a"`
+	RunB       SimulationRunResponse `json:"run_b"`
+	Golden     bool                  `json:"golden"` // run A is the golden run
+	Comparison *simulator.Comparison `json:"comparison"`
+}
+
+// SetGoldenRunRequest for pinning the golden run
+type SetGoldenRunRequest struct {
+	RunID string `json:"run_id" binding:"required,uuid"`
 }
@@ -99,6 +99,10 @@ func main() {
 	labWorker := workers.NewLabWorker(database.DB)
 	labWorker.Start()
 
+	// Start simulation workers (runs the simulation engine for queued runs)
+	simulationWorker := workers.NewSimulationWorker(database.DB)
+	simulationWorker.Start()
+
 	// Set Gin mode based on environment
 	if os.Getenv("GO_ENV") == "production" {
 		gin.SetMode(gin.ReleaseMode)
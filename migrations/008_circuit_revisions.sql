@@ -0,0 +1,36 @@
+-- Migration: Circuit Revision History
+-- Description: Immutable schema snapshots created on every circuit save
+-- Date: 2026-10-18
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- ==================================================
+-- Table: circuit_revisions
+-- ==================================================
+CREATE TABLE IF NOT EXISTS circuit_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    circuit_id UUID NOT NULL REFERENCES circuits(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    revision_number INTEGER NOT NULL,
+    message VARCHAR(500),
+
+    -- Snapshot
+    schema_data JSONB NOT NULL,
+    components_count INTEGER DEFAULT 0,
+    wires_count INTEGER DEFAULT 0,
+
+    -- Set when the revision was produced by restoring an older one
+    restored_from_id UUID REFERENCES circuit_revisions(id) ON DELETE SET NULL,
+
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_circuit_revisions_circuit_id ON circuit_revisions(circuit_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_circuit_revisions_number ON circuit_revisions(circuit_id, revision_number);
+
+-- Seed revision 1 for existing circuits so their current state is preserved
+INSERT INTO circuit_revisions (circuit_id, user_id, revision_number, message, schema_data, components_count, wires_count, created_at)
+SELECT c.id, c.user_id, 1, 'Initial version', c.schema_data, c.components_count, c.wires_count, c.updated_at
+FROM circuits c
+WHERE NOT EXISTS (SELECT 1 FROM circuit_revisions r WHERE r.circuit_id = c.id);
@@ -0,0 +1,31 @@
+-- Migration: Public Circuit Gallery
+-- Description: Tags, fork lineage and stars for public circuits
+-- Date: 2026-10-18
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- ==================================================
+-- Table: circuits (gallery columns)
+-- ==================================================
+ALTER TABLE circuits ADD COLUMN IF NOT EXISTS tags TEXT[];
+ALTER TABLE circuits ADD COLUMN IF NOT EXISTS forked_from_id UUID REFERENCES circuits(id) ON DELETE SET NULL;
+ALTER TABLE circuits ADD COLUMN IF NOT EXISTS stars_count INTEGER DEFAULT 0;
+ALTER TABLE circuits ADD COLUMN IF NOT EXISTS forks_count INTEGER DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_circuits_forked_from_id ON circuits(forked_from_id);
+CREATE INDEX IF NOT EXISTS idx_circuits_public ON circuits(is_public) WHERE is_public = true;
+CREATE INDEX IF NOT EXISTS idx_circuits_tags ON circuits USING GIN(tags);
+
+-- ==================================================
+-- Table: circuit_stars
+-- ==================================================
+CREATE TABLE IF NOT EXISTS circuit_stars (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    circuit_id UUID NOT NULL REFERENCES circuits(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_circuit_stars_unique ON circuit_stars(circuit_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_circuit_stars_user_id ON circuit_stars(user_id);
+CREATE INDEX IF NOT EXISTS idx_circuit_stars_created ON circuit_stars(created_at);
@@ -0,0 +1,11 @@
+-- Migration: Simulation Run Variants
+-- Description: Parameter sweep and Monte Carlo variants stored as child runs
+-- Date: 2026-10-18
+
+-- ==================================================
+-- Table: simulation_runs (variant columns)
+-- ==================================================
+ALTER TABLE simulation_runs ADD COLUMN IF NOT EXISTS parent_run_id UUID REFERENCES simulation_runs(id) ON DELETE CASCADE;
+ALTER TABLE simulation_runs ADD COLUMN IF NOT EXISTS variant_index INTEGER DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_simulation_runs_parent_run_id ON simulation_runs(parent_run_id);
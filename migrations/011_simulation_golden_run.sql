@@ -0,0 +1,8 @@
+-- Migration: Simulation Golden Run
+-- Description: Pinned golden run that later runs of a simulation are compared against
+-- Date: 2026-10-18
+
+-- ==================================================
+-- Table: simulations (golden run column)
+-- ==================================================
+ALTER TABLE simulations ADD COLUMN IF NOT EXISTS golden_run_id UUID REFERENCES simulation_runs(id) ON DELETE SET NULL;
@@ -0,0 +1,42 @@
+-- Migration: Lab Deployments
+-- Description: Passing simulation runs promoted to a lab, staged as the first compilation of a session
+-- Date: 2026-10-18
+
+-- ==================================================
+-- Table: lab_deployments
+-- Simulation code deployed to real hardware, compared with the run's predictions
+-- ==================================================
+CREATE TABLE IF NOT EXISTS lab_deployments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    lab_id UUID NOT NULL REFERENCES labs(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    simulation_id UUID NOT NULL REFERENCES simulations(id) ON DELETE CASCADE,
+    run_id UUID NOT NULL REFERENCES simulation_runs(id) ON DELETE CASCADE,
+    project_id UUID REFERENCES projects(id) ON DELETE SET NULL,
+    session_id UUID REFERENCES lab_sessions(id) ON DELETE SET NULL,
+    compilation_id UUID REFERENCES code_compilations(id) ON DELETE SET NULL,
+
+    -- Status
+    status VARCHAR(20) DEFAULT 'queued',  -- queued, staged, completed, cancelled
+
+    -- Code staged on the lab
+    code TEXT NOT NULL,
+    language VARCHAR(20) NOT NULL,
+    filename VARCHAR(255),
+
+    -- Simulation data (JSON)
+    predictions JSONB,  -- What the run predicts per probe
+    probes JSONB,       -- Sensor -> probe it measures
+
+    -- Timestamps
+    staged_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_lab_deployments_lab_id ON lab_deployments(lab_id);
+CREATE INDEX IF NOT EXISTS idx_lab_deployments_user_id ON lab_deployments(user_id);
+CREATE INDEX IF NOT EXISTS idx_lab_deployments_simulation_id ON lab_deployments(simulation_id);
+CREATE INDEX IF NOT EXISTS idx_lab_deployments_session_id ON lab_deployments(session_id);
+CREATE INDEX IF NOT EXISTS idx_lab_deployments_queued ON lab_deployments(lab_id, user_id) WHERE status = 'queued';
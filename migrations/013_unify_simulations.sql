@@ -0,0 +1,91 @@
+-- Migration: Unify Simulations
+-- Description: Project simulations become runs of a simulation linked to the project; project_simulation_results and projects.simulation_data are dropped
+-- Date: 2026-10-18
+
+-- ==================================================
+-- Table: simulations
+-- One simulation per project that has run, unless one is linked already
+-- ==================================================
+INSERT INTO simulations (user_id, project_id, name, type, schema_data, simulation_settings, status, created_at, updated_at)
+SELECT p.user_id, p.id, p.name, 'Basic Electronics', COALESCE(p.schema_data, '{}'), '{"analysis": "dc"}', 'draft', NOW(), NOW()
+FROM projects p
+WHERE NOT EXISTS (SELECT 1 FROM simulations s WHERE s.project_id = p.id)
+  AND (
+    EXISTS (SELECT 1 FROM project_simulation_results r WHERE r.project_id = p.id)
+    OR COALESCE(p.simulation_data, '{}') <> '{}'
+  );
+
+-- ==================================================
+-- Table: simulation_runs
+-- Project simulation results, as runs of the project's first simulation
+-- ==================================================
+INSERT INTO simulation_runs (id, simulation_id, user_id, status, duration_ms, result_data, errors, warnings, started_at, completed_at)
+SELECT
+    r.id,
+    s.id,
+    r.user_id,
+    CASE WHEN r.status = 'success' THEN 'completed' ELSE 'error' END,
+    COALESCE(r.duration_ms, 0),
+    jsonb_strip_nulls(jsonb_build_object(
+        'analysis', CASE WHEN r.results ? 'transient' THEN 'transient' ELSE 'dc' END,
+        'operating_point', COALESCE(r.results, '{}') - 'transient',
+        'transient', r.results -> 'transient'
+    )),
+    CASE WHEN jsonb_typeof(r.errors) = 'array' THEN (
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('code', 'run_failed', 'message', e)), '[]')
+        FROM jsonb_array_elements_text(r.errors) e
+    ) ELSE '[]' END,
+    CASE WHEN jsonb_typeof(r.warnings) = 'array' THEN (
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('code', 'run_warning', 'message', w)), '[]')
+        FROM jsonb_array_elements_text(r.warnings) w
+    ) ELSE '[]' END,
+    r.created_at,
+    r.created_at
+FROM project_simulation_results r
+JOIN (
+    SELECT DISTINCT ON (project_id) id, project_id
+    FROM simulations
+    WHERE project_id IS NOT NULL
+    ORDER BY project_id, created_at ASC
+) s ON s.project_id = r.project_id
+WHERE r.status <> 'running'
+ON CONFLICT (id) DO NOTHING;
+
+-- Run totals and the last result of the project simulations
+UPDATE simulations s SET
+    run_count = totals.run_count,
+    total_runtime_ms = totals.total_runtime_ms,
+    last_run_at = totals.last_run_at,
+    status = CASE latest.status WHEN 'completed' THEN 'completed' ELSE 'error' END,
+    last_result = latest.result_data
+FROM (
+    SELECT simulation_id,
+           COUNT(*) FILTER (WHERE status = 'completed') AS run_count,
+           COALESCE(SUM(duration_ms) FILTER (WHERE status = 'completed'), 0) AS total_runtime_ms,
+           MAX(started_at) AS last_run_at
+    FROM simulation_runs
+    WHERE parent_run_id IS NULL
+    GROUP BY simulation_id
+) totals
+JOIN (
+    SELECT DISTINCT ON (simulation_id) simulation_id, status, result_data
+    FROM simulation_runs
+    WHERE parent_run_id IS NULL
+    ORDER BY simulation_id, started_at DESC
+) latest ON latest.simulation_id = totals.simulation_id
+WHERE s.id = totals.simulation_id
+  AND s.project_id IS NOT NULL
+  AND s.status <> 'running';
+
+-- Projects whose last run succeeded before results were recorded
+UPDATE simulations s SET status = 'completed'
+FROM projects p
+WHERE s.project_id = p.id
+  AND s.status = 'draft'
+  AND (p.simulation_data ->> 'last_run_success')::boolean IS TRUE;
+
+-- ==================================================
+-- Legacy project simulation storage
+-- ==================================================
+DROP TABLE IF EXISTS project_simulation_results;
+ALTER TABLE projects DROP COLUMN IF EXISTS simulation_data;
@@ -0,0 +1,23 @@
+-- Migration: Component Models
+-- Description: Model library of simulation models; catalog components reference a model by name in simulation_model
+-- Date: 2026-10-18
+
+-- ==================================================
+-- Table: component_models
+-- Simulation models uploaded by admins. Built-in models live in the simulator.
+-- ==================================================
+CREATE TABLE IF NOT EXISTS component_models (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    device VARCHAR(50) NOT NULL,    -- engine device: diode, npn, sensor, ...
+    description TEXT,
+    definition JSONB NOT NULL,      -- params, pins, defaults and behavior
+    version INTEGER DEFAULT 1,
+    is_active BOOLEAN DEFAULT true,
+    uploaded_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_component_models_is_active ON component_models(is_active);
+CREATE INDEX IF NOT EXISTS idx_components_simulation_model ON components(simulation_model);
@@ -0,0 +1,44 @@
+-- Migration: Project Versions
+-- Description: Version history of project schema and code, with automatic versions coalesced per save window and named checkpoints
+-- Date: 2026-10-18
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- ==================================================
+-- Table: project_versions
+-- ==================================================
+CREATE TABLE IF NOT EXISTS project_versions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    version_number INTEGER NOT NULL,
+    name VARCHAR(100),              -- set on named checkpoints
+    message VARCHAR(500),
+
+    -- Snapshot
+    schema_data JSONB,
+    code_data JSONB,
+    components_count INTEGER DEFAULT 0,
+    wires_count INTEGER DEFAULT 0,
+    save_count INTEGER DEFAULT 1,   -- saves coalesced into an automatic version
+
+    -- Set when the version was produced by restoring an older one
+    restored_from_id UUID REFERENCES project_versions(id) ON DELETE SET NULL,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_versions_project_id ON project_versions(project_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_project_versions_number ON project_versions(project_id, version_number);
+
+-- Seed version 1 for existing projects so their current state is preserved
+INSERT INTO project_versions (project_id, user_id, version_number, message, schema_data, code_data, components_count, wires_count, created_at, updated_at)
+SELECT p.id, p.user_id, 1, 'Initial version', p.schema_data, p.code_data,
+       CASE WHEN jsonb_typeof(p.schema_data -> 'components') = 'array' THEN jsonb_array_length(p.schema_data -> 'components') ELSE 0 END,
+       CASE WHEN jsonb_typeof(p.schema_data -> 'wires') = 'array' THEN jsonb_array_length(p.schema_data -> 'wires') ELSE 0 END,
+       p.updated_at, p.updated_at
+FROM projects p
+WHERE (COALESCE(p.schema_data, '{}') <> '{}' OR COALESCE(p.code_data, '{}') <> '{}')
+  AND NOT EXISTS (SELECT 1 FROM project_versions v WHERE v.project_id = p.id);
@@ -0,0 +1,8 @@
+-- Migration: Simulation Run Sketch Hash
+-- Description: Fingerprint of the sketches a run simulated, so only checked code is deployed to a lab
+-- Date: 2026-10-18
+
+-- ==================================================
+-- Table: simulation_runs (sketch hash column)
+-- ==================================================
+ALTER TABLE simulation_runs ADD COLUMN IF NOT EXISTS sketch_hash VARCHAR(64);
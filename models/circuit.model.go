@@ -24,18 +24,61 @@ type Circuit struct {
 	WiresCount      int            `gorm:"default:0" json:"wires_count"`
 	IsTemplate      bool           `gorm:"default:false" json:"is_template"`
 	IsPublic        bool           `gorm:"default:false" json:"is_public"`
+	Tags            pq.StringArray `gorm:"type:text[]" json:"tags"`
+	ForkedFromID    *string        `gorm:"type:uuid;index" json:"forked_from_id"`
+	StarsCount      int            `gorm:"default:0" json:"stars_count"`
+	ForksCount      int            `gorm:"default:0" json:"forks_count"`
 	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
-	User    *User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Project *Project `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+	User       *User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Project    *Project `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+	ForkedFrom *Circuit `gorm:"foreignKey:ForkedFromID;constraint:OnDelete:SET NULL" json:"forked_from,omitempty"`
 }
 
 func (Circuit) TableName() string {
 	return "circuits"
 }
 
+// CircuitStar records a user starring a public circuit
+type CircuitStar struct {
+	ID        string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	CircuitID string    `gorm:"type:uuid;index;not null" json:"circuit_id"`
+	UserID    string    `gorm:"type:uuid;index;not null" json:"user_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relations
+	Circuit *Circuit `gorm:"foreignKey:CircuitID" json:"-"`
+	User    *User    `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (CircuitStar) TableName() string {
+	return "circuit_stars"
+}
+
+// CircuitRevision is an immutable snapshot of a circuit's schema, created on every save
+type CircuitRevision struct {
+	ID              string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	CircuitID       string         `gorm:"type:uuid;index;not null" json:"circuit_id"`
+	UserID          string         `gorm:"type:uuid;index;not null" json:"user_id"`
+	RevisionNumber  int            `gorm:"not null" json:"revision_number"`
+	Message         string         `gorm:"size:500" json:"message"`
+	SchemaData      datatypes.JSON `gorm:"type:jsonb;not null" json:"schema_data"`
+	ComponentsCount int            `gorm:"default:0" json:"components_count"`
+	WiresCount      int            `gorm:"default:0" json:"wires_count"`
+	RestoredFromID  *string        `gorm:"type:uuid" json:"restored_from_id"`
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relations
+	Circuit *Circuit `gorm:"foreignKey:CircuitID" json:"-"`
+	User    *User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (CircuitRevision) TableName() string {
+	return "circuit_revisions"
+}
+
 // CircuitTemplate represents pre-built circuit templates for learning
 type CircuitTemplate struct {
 	ID                   string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
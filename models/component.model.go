@@ -41,7 +41,7 @@ type Component struct {
 	RatingCount     int            `gorm:"default:0" json:"rating_count"`
 	ImageURL        string         `gorm:"size:500" json:"image_url"`
 	DatasheetURL    string         `gorm:"size:500" json:"datasheet_url"`
-	SimulationModel string         `gorm:"size:100" json:"simulation_model"`
+	SimulationModel string         `gorm:"size:100" json:"simulation_model"` // name of its model in the model library
 	IsActive        bool           `gorm:"default:true" json:"is_active"`
 	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
@@ -54,6 +54,26 @@ func (Component) TableName() string {
 	return "components"
 }
 
+// ComponentModel is a simulation model uploaded to the model library.
+// Definition holds the model as the simulator reads it; the library also
+// has built-in models, which uploads cannot replace.
+type ComponentModel struct {
+	ID          string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	Name        string         `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Device      string         `gorm:"size:50;not null" json:"device"`
+	Description string         `gorm:"type:text" json:"description"`
+	Definition  datatypes.JSON `gorm:"type:jsonb;not null" json:"definition"`
+	Version     int            `gorm:"default:1" json:"version"`
+	IsActive    bool           `gorm:"default:true" json:"is_active"`
+	UploadedBy  *string        `gorm:"type:uuid" json:"uploaded_by"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (ComponentModel) TableName() string {
+	return "component_models"
+}
+
 // RequestPriority represents component request priority
 type RequestPriority string
 
@@ -61,6 +61,16 @@ const (
 	CompilationStatusFailed    CompilationStatus = "failed"
 )
 
+// DeploymentStatus represents lab deployment status types
+type DeploymentStatus string
+
+const (
+	DeploymentStatusQueued    DeploymentStatus = "queued"
+	DeploymentStatusStaged    DeploymentStatus = "staged"
+	DeploymentStatusCompleted DeploymentStatus = "completed"
+	DeploymentStatusCancelled DeploymentStatus = "cancelled"
+)
+
 // LabEventType represents hardware log event types
 type LabEventType string
 
@@ -221,6 +231,39 @@ func (CodeCompilation) TableName() string {
 	return "code_compilations"
 }
 
+// LabDeployment is a passing simulation run promoted to a lab: its code
+// is staged as the first compilation of the user's next session there, and
+// the session's sensor readings are compared with the run's predictions
+type LabDeployment struct {
+	ID            string           `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	LabID         string           `gorm:"type:uuid;index;not null" json:"lab_id"`
+	UserID        string           `gorm:"type:uuid;index;not null" json:"user_id"`
+	SimulationID  string           `gorm:"type:uuid;index;not null" json:"simulation_id"`
+	RunID         string           `gorm:"type:uuid;not null" json:"run_id"`
+	ProjectID     *string          `gorm:"type:uuid" json:"project_id"`
+	SessionID     *string          `gorm:"type:uuid;index" json:"session_id"`
+	CompilationID *string          `gorm:"type:uuid" json:"compilation_id"`
+	Status        DeploymentStatus `gorm:"type:varchar(20);default:'queued'" json:"status"`
+	Code          string           `gorm:"type:text;not null" json:"code"`
+	Language      string           `gorm:"size:20;not null" json:"language"`
+	Filename      string           `gorm:"size:255" json:"filename"`
+	Predictions   datatypes.JSON   `gorm:"type:jsonb" json:"predictions"` // what the run predicts per probe
+	Probes        datatypes.JSON   `gorm:"type:jsonb" json:"probes"`      // sensor -> probe it measures
+	StagedAt      *time.Time       `json:"staged_at"`
+	CreatedAt     time.Time        `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time        `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relations
+	Lab        *Lab        `gorm:"foreignKey:LabID" json:"lab,omitempty"`
+	User       *User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Simulation *Simulation `gorm:"foreignKey:SimulationID" json:"simulation,omitempty"`
+	Session    *LabSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
+}
+
+func (LabDeployment) TableName() string {
+	return "lab_deployments"
+}
+
 // Helper methods
 
 // IsAvailable checks if lab is available
@@ -25,6 +25,28 @@ const (
 	CollabRoleViewer CollaboratorRole = "viewer"
 )
 
+// ProjectPermission represents an action on a project
+type ProjectPermission string
+
+const (
+	ProjectPermView   ProjectPermission = "view"   // read the project, its schema, code and history
+	ProjectPermEdit   ProjectPermission = "edit"   // save schema and code, simulate, restore versions
+	ProjectPermManage ProjectPermission = "manage" // settings, collaborators, completion and deletion
+)
+
+// Can reports whether the role allows an action
+func (r CollaboratorRole) Can(perm ProjectPermission) bool {
+	switch r {
+	case CollabRoleOwner:
+		return true
+	case CollabRoleEditor:
+		return perm == ProjectPermView || perm == ProjectPermEdit
+	case CollabRoleViewer:
+		return perm == ProjectPermView
+	}
+	return false
+}
+
 // Project represents user projects
 type Project struct {
 	ID               string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
@@ -42,7 +64,6 @@ type Project struct {
 	Tags             pq.StringArray `gorm:"type:text[]" json:"tags"`
 	SchemaData       datatypes.JSON `gorm:"type:jsonb" json:"schema_data"`
 	CodeData         datatypes.JSON `gorm:"type:jsonb" json:"code_data"`
-	SimulationData   datatypes.JSON `gorm:"type:jsonb" json:"simulation_data"`
 	CompletedAt      *time.Time     `json:"completed_at"`
 	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
@@ -74,6 +95,11 @@ func (ProjectCollaborator) TableName() string {
 	return "project_collaborators"
 }
 
+// IsPending reports whether the invitation has not been accepted yet
+func (c *ProjectCollaborator) IsPending() bool {
+	return c.AcceptedAt == nil
+}
+
 // ProjectComponent represents components used in a project
 type ProjectComponent struct {
 	ID          string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
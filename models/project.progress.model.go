@@ -141,38 +141,6 @@ func (UserXPTransaction) TableName() string {
 	return "user_xp_transactions"
 }
 
-// SimulationStatus represents simulation result status
-type SimulationStatus string
-
-const (
-	SimulationStatusSuccess SimulationStatus = "success"
-	SimulationStatusFailed  SimulationStatus = "failed"
-	SimulationStatusTimeout SimulationStatus = "timeout"
-	SimulationStatusRunning SimulationStatus = "running"
-)
-
-// ProjectSimulationResult stores simulation results
-type ProjectSimulationResult struct {
-	ID         string           `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
-	ProjectID  string           `gorm:"type:uuid;index;not null" json:"project_id"`
-	UserID     string           `gorm:"type:uuid;index;not null" json:"user_id"`
-	Status     SimulationStatus `gorm:"type:varchar(20);not null" json:"status"`
-	DurationMs int              `gorm:"default:0" json:"duration_ms"`
-	Results    datatypes.JSON   `gorm:"type:jsonb" json:"results"`
-	Errors     datatypes.JSON   `gorm:"type:jsonb" json:"errors"`
-	Warnings   datatypes.JSON   `gorm:"type:jsonb" json:"warnings"`
-	XPEarned   int              `gorm:"default:0" json:"xp_earned"`
-	CreatedAt  time.Time        `gorm:"autoCreateTime" json:"created_at"`
-
-	// Relations
-	Project *Project `gorm:"foreignKey:ProjectID" json:"-"`
-	User    *User    `gorm:"foreignKey:UserID" json:"-"`
-}
-
-func (ProjectSimulationResult) TableName() string {
-	return "project_simulation_results"
-}
-
 // ============================================
 // Helper Functions for Progress Calculation
 // ============================================
@@ -206,13 +174,37 @@ func CalculateTotalProgress(schemaComplete, codeComplete, simulationComplete, ve
 	return int(total)
 }
 
-// GetCodeCompletionPercentage calculates code completion based on character count
-func GetCodeCompletionPercentage(charCount int) int {
-	if charCount >= 100 {
-		return 100
+// Code completion shares: a function that does something, a second one,
+// and code that compiles
+const (
+	CodeShareFirstFunction  = 25
+	CodeShareSecondFunction = 25
+	CodeShareCompiles       = 50
+)
+
+// CodeSignals are what code completion is measured from
+type CodeSignals struct {
+	Functions int   // functions whose body does something
+	Compiles  *bool // nil when the code's language cannot be compiled on the server
+}
+
+// GetCodeCompletionPercentage calculates code completion from the functions
+// the code defines and whether it compiles. A template whose functions are
+// empty earns nothing, even when it compiles. Code that cannot be compiled
+// on the server is measured by its functions alone.
+func GetCodeCompletionPercentage(signals CodeSignals) int {
+	functions := 0
+	if signals.Functions >= 1 {
+		functions += CodeShareFirstFunction
+	}
+	if signals.Functions >= 2 {
+		functions += CodeShareSecondFunction
+	}
+	if signals.Compiles == nil {
+		return functions * 100 / (CodeShareFirstFunction + CodeShareSecondFunction)
 	}
-	if charCount >= 50 {
-		return 50
+	if *signals.Compiles && signals.Functions > 0 {
+		return functions + CodeShareCompiles
 	}
-	return 0
+	return functions
 }
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ============================================
+// Project Version History
+// ============================================
+
+// ProjectVersion is a snapshot of a project's schema and code. Saves update
+// the latest automatic version while they come in quick succession; named
+// versions are checkpoints and are never updated or pruned.
+type ProjectVersion struct {
+	ID              string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	ProjectID       string         `gorm:"type:uuid;index;not null" json:"project_id"`
+	UserID          string         `gorm:"type:uuid;index;not null" json:"user_id"`
+	VersionNumber   int            `gorm:"not null" json:"version_number"`
+	Name            string         `gorm:"size:100" json:"name"` // set on checkpoints
+	Message         string         `gorm:"size:500" json:"message"`
+	SchemaData      datatypes.JSON `gorm:"type:jsonb" json:"schema_data"`
+	CodeData        datatypes.JSON `gorm:"type:jsonb" json:"code_data"`
+	ComponentsCount int            `gorm:"default:0" json:"components_count"`
+	WiresCount      int            `gorm:"default:0" json:"wires_count"`
+	SaveCount       int            `gorm:"default:1" json:"save_count"` // saves coalesced into this version
+	RestoredFromID  *string        `gorm:"type:uuid" json:"restored_from_id"`
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relations
+	Project *Project `gorm:"foreignKey:ProjectID" json:"-"`
+	User    *User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (ProjectVersion) TableName() string {
+	return "project_versions"
+}
+
+// IsCheckpoint reports whether the version was named
+func (v *ProjectVersion) IsCheckpoint() bool {
+	return v.Name != ""
+}
@@ -36,25 +36,27 @@ const (
 
 // Simulation represents a simulation created by user
 type Simulation struct {
-	ID                 string               `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
-	UserID             string               `gorm:"type:uuid;index;not null" json:"user_id"`
-	ProjectID          *string              `gorm:"type:uuid;index" json:"project_id"`
-	Name               string               `gorm:"size:255;not null" json:"name"`
-	Description        string               `gorm:"type:text" json:"description"`
-	Type               SimulationType       `gorm:"type:varchar(100);default:'Basic Electronics'" json:"type"`
-	ThumbnailURL       string               `gorm:"size:500" json:"thumbnail_url"`
-	SchemaData         datatypes.JSON       `gorm:"type:jsonb" json:"schema_data"`
-	SimulationSettings datatypes.JSON       `gorm:"type:jsonb" json:"simulation_settings"`
-	LastResult         datatypes.JSON       `gorm:"type:jsonb" json:"last_result"`
-	ComponentsCount    int                  `gorm:"default:0" json:"components_count"`
-	WiresCount         int                  `gorm:"default:0" json:"wires_count"`
-	RunCount           int                  `gorm:"default:0" json:"run_count"`
-	TotalRuntimeMs     int64                `gorm:"default:0" json:"total_runtime_ms"`
-	Status             SimulationStatusType `gorm:"type:varchar(50);default:'draft'" json:"status"`
-	ErrorMessage       string               `gorm:"type:text" json:"error_message"`
-	LastRunAt          *time.Time           `json:"last_run_at"`
-	CreatedAt          time.Time            `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt          time.Time            `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                  string               `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID              string               `gorm:"type:uuid;index;not null" json:"user_id"`
+	ProjectID           *string              `gorm:"type:uuid;index" json:"project_id"`
+	IsProjectSimulation bool                 `gorm:"default:false" json:"is_project_simulation"` // the one a project's runs use, owned by the project owner
+	Name                string               `gorm:"size:255;not null" json:"name"`
+	Description         string               `gorm:"type:text" json:"description"`
+	Type                SimulationType       `gorm:"type:varchar(100);default:'Basic Electronics'" json:"type"`
+	ThumbnailURL        string               `gorm:"size:500" json:"thumbnail_url"`
+	SchemaData          datatypes.JSON       `gorm:"type:jsonb" json:"schema_data"`
+	SimulationSettings  datatypes.JSON       `gorm:"type:jsonb" json:"simulation_settings"`
+	LastResult          datatypes.JSON       `gorm:"type:jsonb" json:"last_result"`
+	ComponentsCount     int                  `gorm:"default:0" json:"components_count"`
+	WiresCount          int                  `gorm:"default:0" json:"wires_count"`
+	RunCount            int                  `gorm:"default:0" json:"run_count"`
+	TotalRuntimeMs      int64                `gorm:"default:0" json:"total_runtime_ms"`
+	Status              SimulationStatusType `gorm:"type:varchar(50);default:'draft'" json:"status"`
+	ErrorMessage        string               `gorm:"type:text" json:"error_message"`
+	LastRunAt           *time.Time           `json:"last_run_at"`
+	GoldenRunID         *string              `gorm:"type:uuid" json:"golden_run_id"` // run later runs are checked against
+	CreatedAt           time.Time            `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time            `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	User    *User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -66,6 +68,16 @@ func (Simulation) TableName() string {
 	return "simulations"
 }
 
+// Simulation run statuses. Runs are queued, executed by a worker and end
+// completed, in error or stopped.
+const (
+	RunStatusQueued    = "queued"
+	RunStatusRunning   = "running"
+	RunStatusCompleted = "completed"
+	RunStatusError     = "error"
+	RunStatusStopped   = "stopped"
+)
+
 // SimulationRun represents a single simulation run history
 type SimulationRun struct {
 	ID           string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
@@ -78,6 +90,11 @@ type SimulationRun struct {
 	Warnings     datatypes.JSON `gorm:"type:jsonb" json:"warnings"`
 	StartedAt    time.Time      `gorm:"autoCreateTime" json:"started_at"`
 	CompletedAt  *time.Time     `json:"completed_at"`
+	SketchHash   string         `gorm:"size:64" json:"-"` // of the sketches the boards ran
+
+	// Variants of a sweep or Monte Carlo run are children of that run
+	ParentRunID  *string `gorm:"type:uuid;index" json:"parent_run_id,omitempty"`
+	VariantIndex int     `gorm:"default:0" json:"variant_index"`
 
 	// Relations
 	Simulation *Simulation `gorm:"foreignKey:SimulationID" json:"-"`
@@ -88,15 +105,22 @@ func (SimulationRun) TableName() string {
 	return "simulation_runs"
 }
 
-// SimulationStats represents aggregated simulation statistics
+// SimulationStats represents aggregated simulation statistics. Statuses
+// count simulations; runs count the top-level runs of every simulation,
+// those of circuits and of projects alike.
 type SimulationStats struct {
 	TotalSimulations    int            `json:"total_simulations"`
+	ProjectSimulations  int            `json:"project_simulations"`
 	RunningNow          int            `json:"running_now"`
 	Completed           int            `json:"completed"`
 	Paused              int            `json:"paused"`
 	Error               int            `json:"error"`
+	TotalRuns           int            `json:"total_runs"`
+	CompletedRuns       int            `json:"completed_runs"`
+	FailedRuns          int            `json:"failed_runs"`
 	TotalRuntimeHours   float64        `json:"total_runtime_hours"`
-	SuccessRate         float64        `json:"success_rate"`
+	SuccessRate         float64        `json:"success_rate"` // completed runs over finished runs, in percent
 	SimulationsThisWeek int            `json:"simulations_this_week"`
+	RunsThisWeek        int            `json:"runs_this_week"`
 	ByType              map[string]int `json:"by_type"`
 }
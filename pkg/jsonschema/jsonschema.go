@@ -0,0 +1,338 @@
+// Package jsonschema validates JSON documents against the subset of JSON Schema
+// (draft 2020-12) used by the schemas published by this API.
+//
+// Supported keywords: $ref (local "#/$defs/..."), type, enum, const, required,
+// properties, additionalProperties, items, minItems, maxItems, minLength,
+// maxLength, pattern, minimum, maximum.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is a compiled JSON Schema node
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 typeList           `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+
+	pattern *regexp.Regexp
+	root    *Schema
+}
+
+// Error is a single validation failure at a JSON Pointer path (e.g. "/components/2/position/x")
+type Error struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// typeList accepts "type": "string" as well as "type": ["string", "null"]
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = typeList{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// additional accepts "additionalProperties": false as well as a schema
+type additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		a.Allowed = allowed
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// Compile parses a JSON Schema document
+func Compile(data []byte) (*Schema, error) {
+	var root Schema
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+	if err := root.prepare(&root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// MustCompile is like Compile but panics on error, for embedded schemas
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *Schema) prepare(root *Schema) error {
+	if s == nil {
+		return nil
+	}
+	s.root = root
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	if s.Ref != "" {
+		if _, err := s.resolve(); err != nil {
+			return err
+		}
+	}
+
+	children := []*Schema{s.Items}
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	for _, d := range s.Defs {
+		children = append(children, d)
+	}
+	if s.AdditionalProperties != nil {
+		children = append(children, s.AdditionalProperties.Schema)
+	}
+	for _, child := range children {
+		if err := child.prepare(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) resolve() (*Schema, error) {
+	const prefix = "#/$defs/"
+	if !strings.HasPrefix(s.Ref, prefix) {
+		return nil, fmt.Errorf("unsupported $ref %q", s.Ref)
+	}
+	def, ok := s.root.Defs[strings.TrimPrefix(s.Ref, prefix)]
+	if !ok {
+		return nil, fmt.Errorf("unknown $ref %q", s.Ref)
+	}
+	return def, nil
+}
+
+// Validate checks a raw JSON document and returns every failure found
+func (s *Schema) Validate(data []byte) ([]Error, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return s.ValidateValue(doc), nil
+}
+
+// ValidateValue checks an already decoded JSON value
+func (s *Schema) ValidateValue(doc interface{}) []Error {
+	errs := []Error{}
+	s.validate(doc, "", &errs)
+	return errs
+}
+
+func (s *Schema) validate(v interface{}, path string, errs *[]Error) {
+	if s.Ref != "" {
+		def, _ := s.resolve()
+		def.validate(v, path, errs)
+		return
+	}
+
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, Error{Path: pointer(path), Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(v) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(v))
+		return
+	}
+
+	if s.Const != nil && !equal(v, s.Const) {
+		fail("must be %v", s.Const)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if equal(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.Enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		length := len([]rune(val))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			fail("must match pattern %s", s.Pattern)
+		}
+
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(item, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := val[key]; !ok {
+				*errs = append(*errs, Error{Path: pointer(path + "/" + escape(key)), Message: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := path + "/" + escape(key)
+			if prop, ok := s.Properties[key]; ok {
+				prop.validate(val[key], child, errs)
+				continue
+			}
+			if s.AdditionalProperties != nil {
+				if !s.AdditionalProperties.Allowed {
+					*errs = append(*errs, Error{Path: pointer(child), Message: "is not allowed"})
+				} else if s.AdditionalProperties.Schema != nil {
+					s.AdditionalProperties.Schema.validate(val[key], child, errs)
+				}
+			}
+		}
+	}
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	for _, t := range s.Type {
+		switch t {
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "null":
+			if v == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func equal(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// escape encodes a key as a JSON Pointer reference token (RFC 6901)
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
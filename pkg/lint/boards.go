@@ -0,0 +1,158 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Board describes the pins of a hardware platform
+type Board struct {
+	Name       string
+	Pins       int   // GPIO numbers below Pins exist unless listed as missing
+	Missing    []int // numbers the chip does not bring out
+	InputOnly  []int // pins without an output driver
+	Flash      []int // pins wired to the flash chip on most modules
+	PWM        []int // pins analogWrite works on; nil means every output pin
+	Interrupts []int // pins attachInterrupt works on; nil means every pin
+	LEDBuiltin int
+	AnalogBase int // pin number of A0
+	AnalogPins int
+	ADC        []int          // other pins analogRead works on
+	Aliases    map[string]int // board names of pins, e.g. D1
+}
+
+// boards are the platforms whose pins are known
+var boards = map[string]*Board{
+	"arduino_uno": {
+		Name: "Arduino Uno", Pins: 20,
+		PWM: []int{3, 5, 6, 9, 10, 11}, Interrupts: []int{2, 3},
+		LEDBuiltin: 13, AnalogBase: 14, AnalogPins: 6,
+	},
+	"arduino_nano": {
+		Name: "Arduino Nano", Pins: 22,
+		PWM: []int{3, 5, 6, 9, 10, 11}, Interrupts: []int{2, 3},
+		LEDBuiltin: 13, AnalogBase: 14, AnalogPins: 8,
+	},
+	"arduino_mega": {
+		Name: "Arduino Mega", Pins: 70,
+		PWM:        []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 44, 45, 46},
+		Interrupts: []int{2, 3, 18, 19, 20, 21},
+		LEDBuiltin: 13, AnalogBase: 54, AnalogPins: 16,
+	},
+	"esp32": {
+		Name: "ESP32", Pins: 40,
+		Missing:    []int{20, 24, 28, 29, 30, 31},
+		InputOnly:  []int{34, 35, 36, 37, 38, 39},
+		Flash:      []int{6, 7, 8, 9, 10, 11},
+		LEDBuiltin: 2, AnalogBase: 36, AnalogPins: 4,
+		ADC: []int{0, 2, 4, 12, 13, 14, 15, 25, 26, 27, 32, 33, 34, 35},
+	},
+	"esp8266": {
+		Name: "ESP8266", Pins: 18,
+		Flash:      []int{6, 7, 8, 9, 10, 11},
+		LEDBuiltin: 2, AnalogBase: 17, AnalogPins: 1,
+		Aliases: map[string]int{
+			"D0": 16, "D1": 5, "D2": 4, "D3": 0, "D4": 2,
+			"D5": 14, "D6": 12, "D7": 13, "D8": 15,
+		},
+	},
+	"raspberry_pi": {
+		Name: "Raspberry Pi Pico", Pins: 29,
+		LEDBuiltin: 25, AnalogBase: 26, AnalogPins: 3,
+	},
+}
+
+// platformAliases are other names projects give their hardware
+var platformAliases = map[string]string{
+	"uno":               "arduino_uno",
+	"nano":              "arduino_nano",
+	"mega":              "arduino_mega",
+	"arduino_mega_2560": "arduino_mega",
+	"mega2560":          "arduino_mega",
+	"esp32_devkit":      "esp32",
+	"nodemcu":           "esp8266",
+	"wemos_d1_mini":     "esp8266",
+	"pico":              "raspberry_pi",
+	"raspberry_pi_pico": "raspberry_pi",
+}
+
+// PlatformKey returns the canonical name of a platform, e.g. "arduino_uno"
+// for "Arduino Uno"
+func PlatformKey(platform string) string {
+	key := strings.ToLower(strings.TrimSpace(platform))
+	key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+	if alias, ok := platformAliases[key]; ok {
+		return alias
+	}
+	return key
+}
+
+// BoardFor returns the board of a platform, or nil when its pins are not
+// known
+func BoardFor(platform string) *Board {
+	return boards[PlatformKey(platform)]
+}
+
+// Has reports whether the board has a pin
+func (b *Board) Has(pin int) bool {
+	return pin >= 0 && pin < b.Pins && !contains(b.Missing, pin)
+}
+
+// IsInputOnly reports whether a pin cannot drive an output
+func (b *Board) IsInputOnly(pin int) bool {
+	return contains(b.InputOnly, pin)
+}
+
+// IsFlash reports whether a pin is taken by the flash chip
+func (b *Board) IsFlash(pin int) bool {
+	return contains(b.Flash, pin)
+}
+
+// HasPWM reports whether analogWrite works on a pin
+func (b *Board) HasPWM(pin int) bool {
+	return b.PWM == nil || contains(b.PWM, pin)
+}
+
+// HasInterrupt reports whether attachInterrupt works on a pin
+func (b *Board) HasInterrupt(pin int) bool {
+	return b.Interrupts == nil || contains(b.Interrupts, pin)
+}
+
+// IsAnalog reports whether analogRead works on a pin, given either as a
+// pin number or, as the Arduino core allows, as a channel number
+func (b *Board) IsAnalog(pin int) bool {
+	return (pin >= 0 && pin < b.AnalogPins) || (pin >= b.AnalogBase && pin < b.AnalogBase+b.AnalogPins) ||
+		contains(b.ADC, pin)
+}
+
+// Pin resolves a board name of a pin such as LED_BUILTIN, A0 or D1
+func (b *Board) Pin(name string) (int, bool) {
+	if name == "LED_BUILTIN" {
+		return b.LEDBuiltin, true
+	}
+	if pin, ok := b.Aliases[name]; ok {
+		return pin, true
+	}
+	var n int
+	if _, err := fmt.Sscanf(name, "A%d", &n); err == nil && fmt.Sprintf("A%d", n) == name && n < b.AnalogPins {
+		return b.AnalogBase + n, true
+	}
+	return 0, false
+}
+
+// PinName names a pin for messages
+func (b *Board) PinName(pin int) string {
+	if pin >= b.AnalogBase && pin < b.AnalogBase+b.AnalogPins {
+		return fmt.Sprintf("%d (A%d)", pin, pin-b.AnalogBase)
+	}
+	return fmt.Sprint(pin)
+}
+
+func contains(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package lint
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Kinds of C tokens
+const (
+	tokIdent  = 'i'
+	tokNumber = 'n'
+	tokString = 's'
+	tokPunct  = 'p'
+)
+
+// cToken is a token of C-family code; start and end are byte offsets
+type cToken struct {
+	kind       byte
+	text       string
+	start, end int
+}
+
+// cOperators are the two-character operators read as one token
+var cOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "::", "->", "<<", ">>", "++", "--", "+=", "-=", "*=", "/=", "|=", "&="}
+
+// cSource is a tokenized C-family file
+type cSource struct {
+	pos     *positions
+	tokens  []cToken
+	defines map[string]string // object-like macros and their values
+	headers []string          // files named by #include
+}
+
+// tokenizeC reads the tokens of C-family code, skipping comments.
+// Preprocessor lines give no tokens; their includes and #define values
+// are kept.
+func tokenizeC(filePath, src string) *cSource {
+	s := &cSource{pos: newPositions(filePath, src), defines: map[string]string{}}
+	lineStart := true
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			lineStart = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 4
+			}
+			continue
+		case c == '#' && lineStart:
+			j := i
+			for j < len(src) && (src[j] != '\n' || src[j-1] == '\\') {
+				j++
+			}
+			s.directive(src[i:j])
+			i = j
+			continue
+		}
+		lineStart = false
+
+		start := i
+		switch {
+		case isIdentStart(c):
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			s.tokens = append(s.tokens, cToken{tokIdent, src[start:i], start, i})
+		case c >= '0' && c <= '9':
+			for i < len(src) && (isIdentPart(src[i]) || src[i] == '.') {
+				i++
+			}
+			s.tokens = append(s.tokens, cToken{tokNumber, src[start:i], start, i})
+		case c == '"' || c == '\'':
+			i++
+			for i < len(src) && src[i] != c && src[i] != '\n' {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				i++
+			}
+			if i < len(src) && src[i] == c {
+				i++
+			}
+			s.tokens = append(s.tokens, cToken{tokString, src[start:i], start, i})
+		default:
+			i++
+			for _, op := range cOperators {
+				if strings.HasPrefix(src[start:], op) {
+					i = start + len(op)
+					break
+				}
+			}
+			s.tokens = append(s.tokens, cToken{tokPunct, src[start:i], start, i})
+		}
+	}
+	return s
+}
+
+// directive records the headers a file includes and the values of its
+// object-like #defines
+func (s *cSource) directive(line string) {
+	line = strings.ReplaceAll(line, "\\\n", " ")
+	if comment := strings.Index(line, "//"); comment >= 0 {
+		line = line[:comment]
+	}
+	fields := strings.Fields(line[1:])
+	switch {
+	case len(fields) >= 2 && fields[0] == "include":
+		s.headers = append(s.headers, strings.Trim(strings.Join(fields[1:], ""), `<>"`))
+	case len(fields) >= 3 && fields[0] == "define" && !strings.Contains(fields[1], "("):
+		s.defines[fields[1]] = strings.Join(fields[2:], " ")
+	}
+}
+
+// closing returns the index of the token closing the bracket at i, or -1
+func closing(tokens []cToken, i int) int {
+	open := tokens[i].text
+	shut := map[string]string{"(": ")", "{": "}", "[": "]"}[open]
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		if tokens[j].kind != tokPunct {
+			continue
+		}
+		switch tokens[j].text {
+		case open:
+			depth++
+		case shut:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// splitArgs splits the tokens of an argument list at its top-level commas
+func splitArgs(tokens []cToken) [][]cToken {
+	args := [][]cToken{}
+	depth, start := 0, 0
+	for i, t := range tokens {
+		if t.kind != tokPunct {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if len(tokens) > 0 {
+		args = append(args, tokens[start:])
+	}
+	return args
+}
+
+// argText returns the code of an argument, as written
+func argText(arg []cToken) string {
+	parts := make([]string, len(arg))
+	for i, t := range arg {
+		parts[i] = t.text
+	}
+	return strings.Join(parts, "")
+}
+
+// parseInt reads an integer literal such as 13, 0x0D or 13UL
+func parseInt(text string) (int, bool) {
+	text = strings.TrimRight(strings.ToLower(text), "ul")
+	n, err := strconv.ParseInt(text, 0, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,32 @@
+package lint
+
+import "testing"
+
+func TestTokenizeCUnterminatedLiterals(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // text of the last token
+	}{
+		{"string ending in a backslash", `Serial.println("\`, `"\`},
+		{"char ending in a backslash", `char c = '\`, `'\`},
+		{"escaped quote at the end", `s = "a\"`, `"a\"`},
+		{"string cut by a newline", "s = \"ab\nx", "x"},
+		{"terminated string", `s = "a\\"`, `"a\\"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tokenizeC("main.ino", tt.src)
+			if len(s.tokens) == 0 {
+				t.Fatalf("no tokens for %q", tt.src)
+			}
+			last := s.tokens[len(s.tokens)-1]
+			if last.text != tt.want {
+				t.Errorf("last token of %q = %q, want %q", tt.src, last.text, tt.want)
+			}
+			if last.end > len(tt.src) {
+				t.Errorf("last token of %q ends at %d, past the source", tt.src, last.end)
+			}
+		})
+	}
+}
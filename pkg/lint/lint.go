@@ -0,0 +1,182 @@
+// Package lint checks the code of a project before it is compiled or
+// submitted: sketch errors, missing entry points, pins the target board does
+// not have or that are never configured, and blocking calls in interrupt
+// handlers. MicroPython files get a syntax check of their own.
+//
+// Findings are diagnostics with a range an editor can underline. Lines and
+// columns are 1-based; columns count UTF-16 code units, as editors do.
+package lint
+
+import (
+	"fmt"
+	"nexfi-backend/pkg/workspace"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severities of a diagnostic
+const (
+	SeverityError   = "error"   // the code will not build or will not work
+	SeverityWarning = "warning" // the code probably does not do what was meant
+	SeverityInfo    = "info"    // worth knowing, e.g. limits of the simulator
+)
+
+// Rules report diagnostics under these names
+const (
+	RuleSyntax           = "syntax"
+	RuleLanguage         = "language-unsupported"
+	RuleSimulator        = "simulator-unsupported"
+	RuleMissingSetup     = "missing-setup"
+	RuleMissingLoop      = "missing-loop"
+	RulePinNotConfigured = "pin-not-configured"
+	RulePinNotOnBoard    = "pin-not-on-board"
+	RulePinInputOnly     = "pin-input-only"
+	RulePinFlash         = "pin-flash"
+	RulePinNotPWM        = "pin-not-pwm"
+	RulePinNoInterrupt   = "pin-no-interrupt"
+	RuleDelayInISR       = "delay-in-isr"
+	RuleSerialInISR      = "serial-in-isr"
+	RuleSleepInIRQ       = "sleep-in-irq"
+)
+
+// Diagnostic is a finding in a file
+type Diagnostic struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"end_line"`
+	EndColumn int    `json:"end_column"` // exclusive
+	Severity  string `json:"severity"`
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+}
+
+// Options tune a check
+type Options struct {
+	// Platform is the hardware the code is for, e.g. "arduino_uno" or
+	// "esp32". Pins are only checked against a known board.
+	Platform string
+	// Languages are the languages the platform is programmed in; when set,
+	// a main file in another language is reported
+	Languages []string
+}
+
+// Check analyses the code of a workspace. Diagnostics are sorted by file
+// and position.
+func Check(ws *workspace.Workspace, opts Options) []Diagnostic {
+	b := BoardFor(opts.Platform)
+	diagnostics := checkLanguage(ws, opts)
+	diagnostics = append(diagnostics, checkSketch(ws, b)...)
+	for i := range ws.Files {
+		f := &ws.Files[i]
+		if f.Language == "micropython" || f.Language == "python" {
+			diagnostics = append(diagnostics, checkPython(f, b)...)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics
+}
+
+// checkLanguage checks that the platform runs the language of the main file
+func checkLanguage(ws *workspace.Workspace, opts Options) []Diagnostic {
+	main := ws.MainFile()
+	if main == nil || len(opts.Languages) == 0 {
+		return []Diagnostic{}
+	}
+	for _, language := range opts.Languages {
+		if language == main.Language {
+			return []Diagnostic{}
+		}
+	}
+	name := opts.Platform
+	if b := BoardFor(opts.Platform); b != nil {
+		name = b.Name
+	}
+	return []Diagnostic{newPositions(main.Path, main.Content).lineDiagnostic(1, SeverityError, RuleLanguage,
+		fmt.Sprintf("the %s cannot run %s code; it is programmed in %s", name, main.Language, strings.Join(opts.Languages, ", ")))}
+}
+
+// positions converts byte offsets in a file to lines and columns
+type positions struct {
+	path       string
+	src        string
+	lineStarts []int
+}
+
+func newPositions(filePath, src string) *positions {
+	p := &positions{path: filePath, src: src, lineStarts: []int{0}}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+	return p
+}
+
+// at returns the line and column of an offset
+func (p *positions) at(off int) (int, int) {
+	if off > len(p.src) {
+		off = len(p.src)
+	}
+	line := sort.Search(len(p.lineStarts), func(i int) bool { return p.lineStarts[i] > off }) - 1
+	col := 1
+	for _, r := range p.src[p.lineStarts[line]:off] {
+		if r == utf8.RuneError || r < 0x10000 {
+			col++
+		} else {
+			col += 2 // a surrogate pair
+		}
+	}
+	return line + 1, col
+}
+
+// diagnostic builds a diagnostic underlining the bytes from..to
+func (p *positions) diagnostic(from, to int, severity, rule, message string) Diagnostic {
+	if to <= from {
+		to = from + 1
+	}
+	d := Diagnostic{File: p.path, Severity: severity, Rule: rule, Message: message}
+	d.Line, d.Column = p.at(from)
+	d.EndLine, d.EndColumn = p.at(to)
+	return d
+}
+
+// lineDiagnostic builds a diagnostic underlining the code of a whole line,
+// without its indentation
+func (p *positions) lineDiagnostic(line int, severity, rule, message string) Diagnostic {
+	if line < 1 {
+		line = 1
+	}
+	if line > len(p.lineStarts) {
+		line = len(p.lineStarts)
+	}
+	from := p.lineStarts[line-1]
+	to := len(p.src)
+	if line < len(p.lineStarts) {
+		to = p.lineStarts[line] - 1
+	}
+	for from < to && (p.src[from] == ' ' || p.src[from] == '\t') {
+		from++
+	}
+	for to > from && (p.src[to-1] == ' ' || p.src[to-1] == '\t' || p.src[to-1] == '\r') {
+		to--
+	}
+	d := Diagnostic{File: p.path, Severity: severity, Rule: rule, Message: message}
+	d.Line, d.Column = p.at(from)
+	d.EndLine, d.EndColumn = p.at(to)
+	if to == from {
+		d.EndColumn++
+	}
+	return d
+}
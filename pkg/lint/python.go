@@ -0,0 +1,456 @@
+package lint
+
+import (
+	"fmt"
+	"nexfi-backend/pkg/workspace"
+	"strings"
+)
+
+// ============================================
+// MicroPython Rules
+// ============================================
+
+// pyToken is a token of Python code; depth counts the brackets it is in
+type pyToken struct {
+	kind       byte
+	text       string
+	start, end int
+	depth      int
+}
+
+// pyLine is a logical line: a statement, which may span lines in brackets
+type pyLine struct {
+	indent int
+	tokens []pyToken
+}
+
+// pyIndent is a level of indentation, measured with tabs of 8 columns and
+// of 1 column; code is ambiguous when the two disagree
+type pyIndent struct{ col, alt int }
+
+// pyCompound are the statements that introduce a block
+var pyCompound = map[string]bool{
+	"if": true, "elif": true, "else": true, "for": true, "while": true, "def": true,
+	"class": true, "try": true, "except": true, "finally": true, "with": true,
+}
+
+// pyOperators are the operators longer than one character, longest first
+var pyOperators = []string{
+	"**=", "//=", ">>=", "<<=", "...",
+	"==", "!=", "<=", ">=", "->", "**", "//", "<<", ">>", ":=",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "@=",
+}
+
+var pyClosers = map[byte]byte{')': '(', ']': '[', '}': '{'}
+
+// pyScanner reads a Python file into logical lines and stops at the first
+// syntax error, as the interpreter does
+type pyScanner struct {
+	pos          *positions
+	src          string
+	lines        []pyLine
+	line         *pyLine
+	indents      []pyIndent
+	brackets     []pyToken
+	expectIndent bool
+	blockLine    int // line of the statement expecting a block
+	err          *Diagnostic
+}
+
+// scanPython reads the logical lines of a file
+func scanPython(f *workspace.File) *pyScanner {
+	s := &pyScanner{pos: newPositions(f.Path, f.Content), src: f.Content, indents: []pyIndent{{}}}
+	src := s.src
+	atLineStart := true
+	for i := 0; i < len(src) && s.err == nil; {
+		if atLineStart {
+			i, atLineStart = s.startLine(i)
+			continue
+		}
+		c := src[i]
+		start := i
+		switch {
+		case c == '\n':
+			i++
+			if len(s.brackets) == 0 {
+				s.endLine()
+				atLineStart = true
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '\\':
+			i++
+			if i < len(src) && src[i] == '\r' {
+				i++
+			}
+			if i >= len(src) || src[i] != '\n' {
+				s.fail(s.pos.diagnostic(start, i, SeverityError, RuleSyntax, "unexpected character after line continuation character"))
+				break
+			}
+			i++ // the line goes on
+		case c == '"' || c == '\'':
+			i = s.scanString(i, i)
+		case isIdentStart(c):
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') && isStringPrefix(src[start:i]) {
+				i = s.scanString(start, i)
+				break
+			}
+			s.add(pyToken{kind: tokIdent, text: src[start:i], start: start, end: i})
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			for i < len(src) && (isIdentPart(src[i]) || src[i] == '.') {
+				i++
+			}
+			s.add(pyToken{kind: tokNumber, text: src[start:i], start: start, end: i})
+		case c == '(' || c == '[' || c == '{':
+			i++
+			t := pyToken{kind: tokPunct, text: src[start:i], start: start, end: i}
+			s.add(t)
+			s.brackets = append(s.brackets, t)
+		case c == ')' || c == ']' || c == '}':
+			i++
+			if len(s.brackets) == 0 {
+				s.fail(s.pos.diagnostic(start, i, SeverityError, RuleSyntax, fmt.Sprintf("unmatched '%c'", c)))
+				break
+			}
+			open := s.brackets[len(s.brackets)-1]
+			if open.text[0] != pyClosers[c] {
+				s.fail(s.pos.diagnostic(start, i, SeverityError, RuleSyntax,
+					fmt.Sprintf("closing '%c' does not match opening '%s'", c, open.text)))
+				break
+			}
+			s.brackets = s.brackets[:len(s.brackets)-1]
+			s.add(pyToken{kind: tokPunct, text: src[start:i], start: start, end: i})
+		default:
+			i++
+			for _, op := range pyOperators {
+				if strings.HasPrefix(src[start:], op) {
+					i = start + len(op)
+					break
+				}
+			}
+			s.add(pyToken{kind: tokPunct, text: src[start:i], start: start, end: i})
+		}
+	}
+
+	if s.err == nil {
+		if len(s.brackets) > 0 {
+			open := s.brackets[len(s.brackets)-1]
+			s.fail(s.pos.diagnostic(open.start, open.end, SeverityError, RuleSyntax, fmt.Sprintf("'%s' was never closed", open.text)))
+		} else {
+			s.endLine()
+			if s.expectIndent {
+				s.fail(s.pos.lineDiagnostic(s.blockLine, SeverityError, RuleSyntax,
+					fmt.Sprintf("expected an indented block after line %d", s.blockLine)))
+			}
+		}
+	}
+	return s
+}
+
+// startLine reads the indentation of a line and checks it against the
+// enclosing block. Blank and comment lines are skipped; it reports whether
+// the next line is still to be started.
+func (s *pyScanner) startLine(i int) (int, bool) {
+	src := s.src
+	col, alt, j := 0, 0, i
+	for ; j < len(src) && (src[j] == ' ' || src[j] == '\t' || src[j] == '\f'); j++ {
+		if src[j] == '\t' {
+			col = (col/8 + 1) * 8
+		} else {
+			col++
+		}
+		alt++
+	}
+	if j >= len(src) || src[j] == '\n' || src[j] == '\r' || src[j] == '#' {
+		for j < len(src) && src[j] != '\n' {
+			j++
+		}
+		return j + 1, true
+	}
+
+	line, _ := s.pos.at(j)
+	top := s.indents[len(s.indents)-1]
+	switch {
+	case col > top.col:
+		if !s.expectIndent {
+			s.fail(s.pos.lineDiagnostic(line, SeverityError, RuleSyntax, "unexpected indent"))
+		} else if alt <= top.alt {
+			s.fail(s.pos.lineDiagnostic(line, SeverityError, RuleSyntax, "inconsistent use of tabs and spaces in indentation"))
+		}
+		s.indents = append(s.indents, pyIndent{col, alt})
+	case s.expectIndent:
+		s.fail(s.pos.lineDiagnostic(line, SeverityError, RuleSyntax, fmt.Sprintf("expected an indented block after line %d", s.blockLine)))
+	default:
+		for len(s.indents) > 1 && col < s.indents[len(s.indents)-1].col {
+			s.indents = s.indents[:len(s.indents)-1]
+		}
+		top = s.indents[len(s.indents)-1]
+		if col != top.col {
+			s.fail(s.pos.lineDiagnostic(line, SeverityError, RuleSyntax, "unindent does not match any outer indentation level"))
+		} else if alt != top.alt {
+			s.fail(s.pos.lineDiagnostic(line, SeverityError, RuleSyntax, "inconsistent use of tabs and spaces in indentation"))
+		}
+	}
+	s.expectIndent = false
+	s.line = &pyLine{indent: col}
+	return j, false
+}
+
+// scanString reads a string literal whose prefix starts at start and whose
+// quote is at i
+func (s *pyScanner) scanString(start, i int) int {
+	src := s.src
+	quote := src[i : i+1]
+	if strings.HasPrefix(src[i:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	j := i + len(quote)
+	for {
+		switch {
+		case j >= len(src) || (len(quote) == 1 && src[j] == '\n'):
+			message := "unterminated string literal"
+			end := j
+			if len(quote) == 3 {
+				message, end = "unterminated triple-quoted string literal", i+3
+			}
+			s.fail(s.pos.diagnostic(start, end, SeverityError, RuleSyntax, message))
+			return j
+		case src[j] == '\\':
+			j += 2
+		case strings.HasPrefix(src[j:], quote):
+			j += len(quote)
+			s.add(pyToken{kind: tokString, text: src[start:j], start: start, end: j})
+			return j
+		default:
+			j++
+		}
+	}
+}
+
+func (s *pyScanner) add(t pyToken) {
+	t.depth = len(s.brackets)
+	if s.line != nil {
+		s.line.tokens = append(s.line.tokens, t)
+	}
+}
+
+func (s *pyScanner) fail(d Diagnostic) {
+	if s.err == nil {
+		s.err = &d
+	}
+}
+
+// endLine checks a complete statement
+func (s *pyScanner) endLine() {
+	line := s.line
+	s.line = nil
+	if line == nil || len(line.tokens) == 0 || s.err != nil {
+		return
+	}
+	tokens := line.tokens
+	last := tokens[len(tokens)-1]
+	s.expectIndent = last.text == ":"
+	s.blockLine, _ = s.pos.at(last.start)
+
+	first := tokens[0]
+	if first.text == "async" && len(tokens) > 1 {
+		first = tokens[1]
+	}
+	if pyCompound[first.text] {
+		colon := -1
+		for k, t := range tokens {
+			if t.text == ":" && t.depth == 0 {
+				colon = k
+				break
+			}
+		}
+		switch {
+		case first.text == "else" && len(tokens) > 1 && tokens[1].text == "if":
+			s.fail(s.pos.diagnostic(first.start, tokens[1].end, SeverityError, RuleSyntax, "write elif instead of else if"))
+		case colon < 0:
+			s.fail(s.pos.diagnostic(last.start, last.end, SeverityError, RuleSyntax,
+				fmt.Sprintf("expected ':' at the end of the %s statement", first.text)))
+		case first.text == "if" || first.text == "elif" || first.text == "while":
+			for _, t := range tokens[:colon] {
+				if t.text == "=" && t.depth == 0 {
+					s.fail(s.pos.diagnostic(t.start, t.end, SeverityError, RuleSyntax,
+						"= assigns a value and cannot be used in a condition; use == to compare"))
+					break
+				}
+			}
+		}
+	}
+	if first.text == "print" && len(tokens) > 1 && tokens[1].kind != tokPunct {
+		s.fail(s.pos.diagnostic(first.start, last.end, SeverityError, RuleSyntax,
+			"missing parentheses in call to print; write print(...)"))
+	}
+	s.lines = append(s.lines, *line)
+}
+
+func isStringPrefix(prefix string) bool {
+	switch strings.ToLower(prefix) {
+	case "r", "b", "f", "u", "rb", "br", "fr", "rf":
+		return true
+	}
+	return false
+}
+
+// pyClosing returns the index of the token closing the bracket at i, or -1
+func pyClosing(tokens []pyToken, i int) int {
+	for j := i + 1; j < len(tokens); j++ {
+		if tokens[j].depth == tokens[i].depth && tokens[j].kind == tokPunct && strings.ContainsAny(tokens[j].text, ")]}") {
+			return j
+		}
+	}
+	return -1
+}
+
+// checkPython checks the syntax of a MicroPython file, the pins it uses and
+// its interrupt handlers
+func checkPython(f *workspace.File, b *Board) []Diagnostic {
+	s := scanPython(f)
+	diagnostics := []Diagnostic{}
+	if s.err != nil {
+		diagnostics = append(diagnostics, *s.err)
+	}
+
+	// Module constants such as LED_PIN = 2
+	values := map[string]int{}
+	for _, line := range s.lines {
+		t := line.tokens
+		if line.indent == 0 && len(t) == 3 && t[0].kind == tokIdent && t[1].text == "=" {
+			if n, ok := parseInt(t[2].text); ok {
+				values[t[0].text] = n
+			}
+		}
+	}
+
+	handlers := map[string]bool{}
+	for _, line := range s.lines {
+		t := line.tokens
+		for k := 0; k+1 < len(t); k++ {
+			if t[k].kind != tokIdent || t[k+1].text != "(" {
+				continue
+			}
+			end := pyClosing(t, k+1)
+			if end < 0 {
+				continue
+			}
+			args := pyArgs(t[k+2 : end])
+			switch {
+			case t[k].text == "Pin" && b != nil:
+				diagnostics = append(diagnostics, pythonPin(s.pos, b, args, values)...)
+			case t[k].text == "irq" && k > 0 && t[k-1].text == ".":
+				// Pin.irq(handler=None, trigger=...) takes the handler first
+				if len(args) > 0 && len(args[0]) == 1 && args[0][0].kind == tokIdent {
+					handlers[args[0][0].text] = true
+				}
+			}
+			for _, arg := range args {
+				if len(arg) == 3 && (arg[0].text == "handler" || arg[0].text == "callback") && arg[1].text == "=" {
+					handlers[arg[2].text] = true
+				}
+			}
+		}
+	}
+	return append(diagnostics, pythonHandlers(s, handlers)...)
+}
+
+// pyArgs splits the tokens of an argument list at its top-level commas
+func pyArgs(tokens []pyToken) [][]pyToken {
+	args := [][]pyToken{}
+	if len(tokens) == 0 {
+		return args
+	}
+	depth, start := tokens[0].depth, 0
+	for i, t := range tokens {
+		if t.text == "," && t.depth == depth {
+			args = append(args, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(args, tokens[start:])
+}
+
+// pythonPin checks the pin a Pin(...) is created for
+func pythonPin(pos *positions, b *Board, args [][]pyToken, values map[string]int) []Diagnostic {
+	if len(args) == 0 || len(args[0]) != 1 {
+		return nil
+	}
+	arg := args[0][0]
+	pin, ok := parseInt(arg.text)
+	if !ok {
+		if pin, ok = values[arg.text]; !ok {
+			return nil
+		}
+	}
+	output := false
+	for _, other := range args[1:] {
+		for _, t := range other {
+			if t.text == "OUT" || t.text == "OPEN_DRAIN" {
+				output = true
+			}
+		}
+	}
+
+	switch {
+	case !b.Has(pin):
+		return []Diagnostic{pos.diagnostic(arg.start, arg.end, SeverityError, RulePinNotOnBoard, fmt.Sprintf("the %s has no pin %d", b.Name, pin))}
+	case output && b.IsInputOnly(pin):
+		return []Diagnostic{pos.diagnostic(arg.start, arg.end, SeverityError, RulePinInputOnly,
+			fmt.Sprintf("pin %d of the %s is input only and cannot be used as an output", pin, b.Name))}
+	case b.IsFlash(pin):
+		return []Diagnostic{pos.diagnostic(arg.start, arg.end, SeverityWarning, RulePinFlash,
+			fmt.Sprintf("pin %d is wired to the flash memory on most %s modules; using it crashes the board", pin, b.Name))}
+	}
+	return nil
+}
+
+// pythonHandlers checks interrupt handlers for calls that sleep
+func pythonHandlers(s *pyScanner, handlers map[string]bool) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for k, line := range s.lines {
+		t := line.tokens
+		if len(t) < 2 || t[0].text != "def" || !handlers[t[1].text] {
+			continue
+		}
+		name := t[1].text
+		body := []pyToken{}
+		for colon, tok := range t {
+			if tok.text == ":" && tok.depth == 0 {
+				body = append(body, t[colon+1:]...) // def f(p): sleep(1)
+				break
+			}
+		}
+		for _, after := range s.lines[k+1:] {
+			if after.indent <= line.indent {
+				break
+			}
+			body = append(body, after.tokens...)
+		}
+
+		for i := 0; i+1 < len(body); i++ {
+			if body[i].kind != tokIdent || (body[i].text != "sleep" && body[i].text != "sleep_ms") || body[i+1].text != "(" {
+				continue
+			}
+			start := body[i].start
+			if i >= 2 && body[i-1].text == "." {
+				start = body[i-2].start // time.sleep
+			}
+			end := body[i].end
+			if closeParen := pyClosing(body, i+1); closeParen >= 0 {
+				end = body[closeParen].end
+			}
+			diagnostics = append(diagnostics, s.pos.diagnostic(start, end, SeverityError, RuleSleepInIRQ, fmt.Sprintf(
+				"sleeping blocks inside the interrupt handler %s and the board misses other events; set a flag here and act on it in the main loop", name)))
+		}
+	}
+	return diagnostics
+}
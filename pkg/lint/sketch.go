@@ -0,0 +1,435 @@
+package lint
+
+import (
+	"fmt"
+	"nexfi-backend/pkg/sketch"
+	"nexfi-backend/pkg/workspace"
+	"strings"
+)
+
+// ============================================
+// Sketch Rules
+// ============================================
+
+// cFunction is a function defined in a sketch file
+type cFunction struct {
+	name  string
+	src   *cSource
+	at    int  // token of the name
+	open  int  // token opening the body
+	close int  // token closing the body
+	args  bool // the parameter list is not empty
+	isr   bool // marked as an interrupt handler
+}
+
+// cCall is a call of a core function that takes a pin
+type cCall struct {
+	name string
+	src  *cSource
+	at   int // token of the name
+	args [][]cToken
+}
+
+// pinFunctions are the core functions whose first argument is a pin
+var pinFunctions = map[string]bool{
+	"pinMode": true, "digitalWrite": true, "digitalRead": true,
+	"analogWrite": true, "analogRead": true, "tone": true, "noTone": true,
+	"pulseIn": true, "attachInterrupt": true,
+}
+
+// sketchAnalysis is what the files of a sketch define and call
+type sketchAnalysis struct {
+	board     *Board
+	sources   []*cSource
+	functions map[string]*cFunction
+	calls     []cCall
+	values    map[string]string // globals and the values they are declared with
+	libraries []string          // included headers that are not in the workspace
+}
+
+// checkSketch checks the files a board runs when the main file is a sketch
+func checkSketch(ws *workspace.Workspace, b *Board) []Diagnostic {
+	source := ws.Sketch()
+	if source == nil {
+		return nil
+	}
+
+	a := &sketchAnalysis{board: b, functions: map[string]*cFunction{}, values: map[string]string{}}
+	for _, p := range source.Files() {
+		a.read(tokenizeC(p, ws.File(p).Content), ws)
+	}
+
+	diagnostics := []Diagnostic{}
+	diagnostics = append(diagnostics, a.compile(source)...)
+	diagnostics = append(diagnostics, a.entryPoints(ws.File(ws.Main))...)
+	diagnostics = append(diagnostics, a.pins()...)
+	diagnostics = append(diagnostics, a.interruptHandlers()...)
+	return diagnostics
+}
+
+// read collects the functions, pin calls and initialized names of a file
+func (a *sketchAnalysis) read(src *cSource, ws *workspace.Workspace) {
+	a.sources = append(a.sources, src)
+	for _, header := range src.headers {
+		if header != "Arduino.h" && ws.File(header) == nil {
+			a.libraries = append(a.libraries, header)
+		}
+	}
+
+	tokens := src.tokens
+	depth := 0
+	for i, t := range tokens {
+		if t.kind == tokPunct {
+			switch t.text {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			}
+			continue
+		}
+		if t.kind != tokIdent || i+1 >= len(tokens) {
+			continue
+		}
+		next := tokens[i+1].text
+
+		// type name = value; at the top declares a global with a value
+		if next == "=" && depth == 0 && i > 0 && tokens[i-1].kind == tokIdent && i+3 < len(tokens) &&
+			(tokens[i+3].text == ";" || tokens[i+3].text == ",") {
+			a.assign(t.text, tokens[i+2].text)
+		}
+		if next != "(" || cKeywords[t.text] {
+			continue
+		}
+		closeParen := closing(tokens, i+1)
+		if closeParen < 0 {
+			continue
+		}
+		method := i > 0 && (tokens[i-1].text == "." || tokens[i-1].text == "->" || tokens[i-1].text == "::")
+		if pinFunctions[t.text] && !method {
+			a.calls = append(a.calls, cCall{name: t.text, src: src, at: i, args: splitArgs(tokens[i+2 : closeParen])})
+		}
+		if depth == 0 {
+			a.define(src, i, closeParen)
+		}
+	}
+}
+
+// coreNames are declared by the Arduino and ESP cores but not by the
+// simulator
+var coreNames = map[string]bool{
+	"digitalPinToInterrupt": true, "interrupts": true, "noInterrupts": true,
+	"IRAM_ATTR": true, "ICACHE_RAM_ATTR": true, "ISR": true, "sei": true, "cli": true,
+	"PROGMEM": true, "F": true, "yield": true, "shiftIn": true, "shiftOut": true,
+	"ledcSetup": true, "ledcAttachPin": true, "ledcAttach": true, "ledcWrite": true,
+	"touchRead": true, "hallRead": true, "dacWrite": true, "analogReadResolution": true,
+}
+
+// cKeywords are followed by a parenthesis but are not calls
+var cKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "return": true,
+	"sizeof": true, "catch": true, "defined": true,
+}
+
+// define records the function whose parameter list closes at closeParen,
+// when a body follows
+func (a *sketchAnalysis) define(src *cSource, at, closeParen int) {
+	tokens := src.tokens
+	open := closeParen + 1
+	for open < len(tokens) && tokens[open].kind == tokIdent {
+		open++ // const, override
+	}
+	if open >= len(tokens) || tokens[open].text != "{" {
+		return
+	}
+	fn := &cFunction{
+		name: tokens[at].text, src: src, at: at, open: open, close: closing(tokens, open),
+		args: closeParen > at+2 && !(closeParen == at+3 && tokens[at+2].text == "void"),
+	}
+	if fn.close < 0 {
+		fn.close = len(tokens) - 1
+	}
+	// ISR(vector) is the AVR handler macro; IRAM_ATTR marks ESP handlers
+	fn.isr = fn.name == "ISR"
+	for k := at - 1; k >= 0 && k >= at-4 && tokens[k].kind == tokIdent; k-- {
+		if tokens[k].text == "IRAM_ATTR" || tokens[k].text == "ICACHE_RAM_ATTR" {
+			fn.isr = true
+		}
+	}
+	if _, ok := a.functions[fn.name]; !ok || fn.isr {
+		a.functions[fn.name] = fn
+	}
+}
+
+// assign records the value a name is declared with; a name declared with
+// different values is not resolved
+func (a *sketchAnalysis) assign(name, value string) {
+	if old, ok := a.values[name]; ok && old != value {
+		a.values[name] = ""
+		return
+	}
+	a.values[name] = value
+}
+
+// resolve returns the pin number an argument stands for
+func (a *sketchAnalysis) resolve(arg []cToken) (int, bool) {
+	for len(arg) >= 3 && arg[0].text == "(" && arg[len(arg)-1].text == ")" {
+		arg = arg[1 : len(arg)-1]
+	}
+	if len(arg) != 1 {
+		return 0, false
+	}
+	return a.resolveName(arg[0].text, 0)
+}
+
+func (a *sketchAnalysis) resolveName(name string, depth int) (int, bool) {
+	name = strings.Trim(name, "() ")
+	if n, ok := parseInt(name); ok {
+		return n, true
+	}
+	if a.board != nil {
+		if pin, ok := a.board.Pin(name); ok {
+			return pin, true
+		}
+	}
+	if depth > 8 {
+		return 0, false
+	}
+	for _, src := range a.sources {
+		if value, ok := src.defines[name]; ok {
+			return a.resolveName(value, depth+1)
+		}
+	}
+	if value := a.values[name]; value != "" {
+		return a.resolveName(value, depth+1)
+	}
+	return 0, false
+}
+
+// compile reports the first error the sketch compiler finds. Features the
+// simulator lacks are only noted: the board's own toolchain builds them.
+func (a *sketchAnalysis) compile(source *workspace.Source) []Diagnostic {
+	_, err := sketch.Compile(source.Text)
+	if err == nil {
+		return nil
+	}
+	sketchErr, ok := err.(*sketch.Error)
+	if !ok || strings.HasPrefix(sketchErr.Message, "the sketch needs a void") {
+		return nil // setup and loop are checked by entryPoints
+	}
+
+	filePath, line := source.Locate(sketchErr.Line)
+	src := a.source(filePath)
+	message := sketchErr.Message
+	for _, word := range strings.Fields(message) {
+		if coreNames[word] {
+			return []Diagnostic{src.pos.lineDiagnostic(line, SeverityInfo, RuleSimulator,
+				fmt.Sprintf("%s is not available in the simulator, but it builds for the board", word))}
+		}
+	}
+	switch {
+	case strings.Contains(message, "not supported"):
+		return []Diagnostic{src.pos.lineDiagnostic(line, SeverityInfo, RuleSimulator,
+			message+"; the simulator cannot run this, but it may still build for the board")}
+	case len(a.libraries) > 0 && (strings.Contains(message, "is not declared") ||
+		strings.HasPrefix(message, "expected a declaration")):
+		return []Diagnostic{src.pos.lineDiagnostic(line, SeverityWarning, RuleSyntax,
+			fmt.Sprintf("%s; it may come from %s, which is not checked", message, strings.Join(a.libraries, ", ")))}
+	}
+	return []Diagnostic{src.pos.lineDiagnostic(line, SeverityError, RuleSyntax, message)}
+}
+
+// entryPoints checks that the sketch defines setup() and loop(). Code with
+// a main() function is a plain program and needs neither.
+func (a *sketchAnalysis) entryPoints(main *workspace.File) []Diagnostic {
+	if _, ok := a.functions["main"]; ok {
+		return nil
+	}
+	diagnostics := []Diagnostic{}
+	for _, entry := range []struct{ name, rule, runs string }{
+		{"setup", RuleMissingSetup, "once when the board starts"},
+		{"loop", RuleMissingLoop, "over and over after setup()"},
+	} {
+		fn, ok := a.functions[entry.name]
+		switch {
+		case !ok:
+			pos := a.source(main.Path).pos
+			diagnostics = append(diagnostics, pos.lineDiagnostic(1, SeverityError, entry.rule,
+				fmt.Sprintf("the sketch has no %s() function; add void %s() { }, which the board runs %s", entry.name, entry.name, entry.runs)))
+		case fn.args:
+			t := fn.src.tokens[fn.at]
+			diagnostics = append(diagnostics, fn.src.pos.diagnostic(t.start, t.end, SeverityError, entry.rule,
+				fmt.Sprintf("%s() cannot take parameters; the board calls it as void %s()", entry.name, entry.name)))
+		}
+	}
+	return diagnostics
+}
+
+// pins checks the pins the core functions are called with: that they are
+// configured before they are used, and that the board has them
+func (a *sketchAnalysis) pins() []Diagnostic {
+	configured, configuredNames := map[int]bool{}, map[string]bool{}
+	unknownConfigured := false
+	for _, call := range a.calls {
+		if call.name != "pinMode" || len(call.args) == 0 {
+			continue
+		}
+		configuredNames[argText(call.args[0])] = true
+		if pin, ok := a.resolve(call.args[0]); ok {
+			configured[pin] = true
+		} else {
+			unknownConfigured = true // e.g. in a loop over an array of pins
+		}
+	}
+
+	diagnostics := []Diagnostic{}
+	reported := map[string]bool{}
+	for _, call := range a.calls {
+		if len(call.args) == 0 || len(call.args[0]) == 0 {
+			continue
+		}
+		arg := call.args[0]
+		name := argText(arg)
+		pin, resolved := a.resolve(arg)
+		underline := func(severity, rule, message string) {
+			diagnostics = append(diagnostics, call.src.pos.diagnostic(arg[0].start, arg[len(arg)-1].end, severity, rule, message))
+		}
+
+		if call.name == "attachInterrupt" {
+			diagnostics = append(diagnostics, a.interruptPin(call)...)
+			continue
+		}
+
+		// Unconfigured pins. analogWrite and tone set the pin up themselves.
+		missing := a.board != nil && resolved && !a.board.Has(pin)
+		if (call.name == "digitalWrite" || call.name == "digitalRead") && !reported[name] && !missing &&
+			!configuredNames[name] && !(resolved && configured[pin]) && !unknownConfigured {
+			reported[name] = true
+			if call.name == "digitalWrite" {
+				underline(SeverityWarning, RulePinNotConfigured, fmt.Sprintf(
+					"pin %s is written but never configured; add pinMode(%s, OUTPUT) in setup(), or the pin only switches its pull-up and an LED on it glows dimly", name, name))
+			} else {
+				underline(SeverityInfo, RulePinNotConfigured, fmt.Sprintf(
+					"pin %s is read but never configured; it is an input by default, but pinMode(%s, INPUT) or INPUT_PULLUP makes that explicit", name, name))
+			}
+		}
+
+		if a.board == nil || !resolved {
+			continue
+		}
+		b := a.board
+		output := call.name == "digitalWrite" || call.name == "analogWrite" || call.name == "tone" ||
+			(call.name == "pinMode" && len(call.args) > 1 && argText(call.args[1]) == "OUTPUT")
+		switch {
+		case call.name == "analogRead":
+			if !b.IsAnalog(pin) {
+				underline(SeverityError, RulePinNotOnBoard, fmt.Sprintf(
+					"pin %d is not an analog input on the %s; use A0 to A%d", pin, b.Name, b.AnalogPins-1))
+			}
+		case !b.Has(pin):
+			underline(SeverityError, RulePinNotOnBoard, fmt.Sprintf("the %s has no pin %d", b.Name, pin))
+		case output && b.IsInputOnly(pin):
+			underline(SeverityError, RulePinInputOnly, fmt.Sprintf(
+				"pin %d of the %s is input only and cannot be used as an output", pin, b.Name))
+		case b.IsFlash(pin):
+			underline(SeverityWarning, RulePinFlash, fmt.Sprintf(
+				"pin %d is wired to the flash memory on most %s modules; using it crashes the board", pin, b.Name))
+		case call.name == "analogWrite" && !b.HasPWM(pin):
+			underline(SeverityWarning, RulePinNotPWM, fmt.Sprintf(
+				"pin %s has no PWM on the %s, so analogWrite only turns it fully on or off; use pin %s", b.PinName(pin), b.Name, joinInts(b.PWM)))
+		}
+	}
+	return diagnostics
+}
+
+// interruptPin checks the pin of attachInterrupt(digitalPinToInterrupt(pin), ...)
+func (a *sketchAnalysis) interruptPin(call cCall) []Diagnostic {
+	arg := call.args[0]
+	if a.board == nil || len(arg) < 4 || arg[0].text != "digitalPinToInterrupt" {
+		return nil
+	}
+	pin, ok := a.resolve(arg[2 : len(arg)-1])
+	b := a.board
+	switch {
+	case !ok:
+		return nil
+	case !b.Has(pin):
+		return []Diagnostic{call.src.pos.diagnostic(arg[2].start, arg[len(arg)-2].end, SeverityError, RulePinNotOnBoard,
+			fmt.Sprintf("the %s has no pin %d", b.Name, pin))}
+	case !b.HasInterrupt(pin):
+		return []Diagnostic{call.src.pos.diagnostic(arg[2].start, arg[len(arg)-2].end, SeverityError, RulePinNoInterrupt,
+			fmt.Sprintf("pin %d of the %s cannot trigger interrupts; use pin %s", pin, b.Name, joinInts(b.Interrupts)))}
+	}
+	return nil
+}
+
+// interruptHandlers checks the functions attachInterrupt registers and the
+// ones marked as handlers for calls that block or take too long
+func (a *sketchAnalysis) interruptHandlers() []Diagnostic {
+	handlers := map[string]bool{}
+	for name, fn := range a.functions {
+		if fn.isr {
+			handlers[name] = true
+		}
+	}
+	for _, call := range a.calls {
+		if call.name == "attachInterrupt" && len(call.args) > 1 {
+			handlers[strings.TrimPrefix(argText(call.args[1]), "&")] = true
+		}
+	}
+
+	diagnostics := []Diagnostic{}
+	for name := range handlers {
+		fn, ok := a.functions[name]
+		if !ok {
+			continue
+		}
+		tokens := fn.src.tokens
+		serial := false
+		for i := fn.open + 1; i < fn.close; i++ {
+			t := tokens[i]
+			if t.kind != tokIdent || i+1 >= fn.close {
+				continue
+			}
+			switch {
+			case t.text == "delay" && tokens[i+1].text == "(" && tokens[i-1].text != ".":
+				end := t.end
+				if closeParen := closing(tokens, i+1); closeParen >= 0 {
+					end = tokens[closeParen].end
+				}
+				diagnostics = append(diagnostics, fn.src.pos.diagnostic(t.start, end, SeverityError, RuleDelayInISR, fmt.Sprintf(
+					"delay() blocks inside the interrupt handler %s: interrupts are off while it runs, so the delay never ends or the board misses other events; set a volatile flag here and act on it in loop()", name)))
+			case strings.HasPrefix(t.text, "Serial") && tokens[i+1].text == "." && !serial:
+				serial = true
+				end := tokens[i+1].end
+				if tokens[i+2].kind == tokIdent {
+					end = tokens[i+2].end
+				}
+				diagnostics = append(diagnostics, fn.src.pos.diagnostic(t.start, end, SeverityWarning, RuleSerialInISR, fmt.Sprintf(
+					"Serial inside the interrupt handler %s can hang the board once its buffer fills; print from loop() instead", name)))
+			}
+		}
+	}
+	return diagnostics
+}
+
+// source returns the tokenized file at a path
+func (a *sketchAnalysis) source(filePath string) *cSource {
+	for _, src := range a.sources {
+		if src.pos.path == filePath {
+			return src
+		}
+	}
+	return a.sources[0]
+}
+
+func joinInts(list []int) string {
+	parts := make([]string, len(list))
+	for i, n := range list {
+		parts[i] = fmt.Sprint(n)
+	}
+	if len(parts) > 1 {
+		return strings.Join(parts[:len(parts)-1], ", ") + " or " + parts[len(parts)-1]
+	}
+	return strings.Join(parts, "")
+}
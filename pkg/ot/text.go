@@ -0,0 +1,268 @@
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// ============================================
+// Text Operations
+// ============================================
+
+// TextOperation is a change to a text document in the format of ot.js: a
+// list of retains (positive numbers), deletes (negative numbers) and inserts
+// (strings) that together walk the whole document. Lengths count UTF-16
+// code units, as JavaScript strings do.
+type TextOperation struct {
+	ops          []op
+	BaseLength   int // length of the document the operation applies to
+	TargetLength int // length of the document it produces
+}
+
+// maxComponentLength bounds retains and deletes read from JSON
+const maxComponentLength = 1 << 30
+
+// op is one component of an operation; exactly one field is set
+type op struct {
+	retain int
+	delete int
+	insert []uint16
+}
+
+// Text is a document as UTF-16 code units
+type Text []uint16
+
+// NewText encodes a string as a document
+func NewText(s string) Text {
+	return utf16.Encode([]rune(s))
+}
+
+// String decodes the document
+func (t Text) String() string {
+	return string(utf16.Decode(t))
+}
+
+// Retain skips n units
+func (o *TextOperation) Retain(n int) *TextOperation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLength += n
+	o.TargetLength += n
+	if last := o.last(); last != nil && last.retain > 0 {
+		last.retain += n
+	} else {
+		o.ops = append(o.ops, op{retain: n})
+	}
+	return o
+}
+
+// Insert inserts a string at the current position
+func (o *TextOperation) Insert(s string) *TextOperation {
+	return o.insert(NewText(s))
+}
+
+func (o *TextOperation) insert(text []uint16) *TextOperation {
+	if len(text) == 0 {
+		return o
+	}
+	o.TargetLength += len(text)
+	last := o.last()
+	switch {
+	case last != nil && last.insert != nil:
+		last.insert = append(last.insert, text...)
+	case last != nil && last.delete > 0:
+		// Keep inserts before deletes so equal operations look the same
+		if n := len(o.ops); n > 1 && o.ops[n-2].insert != nil {
+			o.ops[n-2].insert = append(o.ops[n-2].insert, text...)
+		} else {
+			o.ops = append(o.ops[:n-1], op{insert: append([]uint16(nil), text...)}, *last)
+		}
+	default:
+		o.ops = append(o.ops, op{insert: append([]uint16(nil), text...)})
+	}
+	return o
+}
+
+// Delete deletes n units
+func (o *TextOperation) Delete(n int) *TextOperation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLength += n
+	if last := o.last(); last != nil && last.delete > 0 {
+		last.delete += n
+	} else {
+		o.ops = append(o.ops, op{delete: n})
+	}
+	return o
+}
+
+func (o *TextOperation) last() *op {
+	if len(o.ops) == 0 {
+		return nil
+	}
+	return &o.ops[len(o.ops)-1]
+}
+
+// IsNoop returns true when the operation changes nothing
+func (o *TextOperation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].retain > 0)
+}
+
+// Apply applies the operation to a document
+func (o *TextOperation) Apply(doc Text) (Text, error) {
+	if len(doc) != o.BaseLength {
+		return nil, fmt.Errorf("operation expects a document of length %d, got %d", o.BaseLength, len(doc))
+	}
+	out := make(Text, 0, o.TargetLength)
+	pos := 0
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			out = append(out, doc[pos:pos+c.retain]...)
+			pos += c.retain
+		case c.delete > 0:
+			pos += c.delete
+		default:
+			out = append(out, c.insert...)
+		}
+	}
+	return out, nil
+}
+
+// TransformIndex moves a position in the document, e.g. a cursor, past the
+// changes of the operation
+func (o *TextOperation) TransformIndex(index int) int {
+	newIndex, pos := index, 0
+	for _, c := range o.ops {
+		if pos > index {
+			break
+		}
+		switch {
+		case c.retain > 0:
+			pos += c.retain
+		case c.delete > 0:
+			newIndex -= min(c.delete, index-pos)
+			pos += c.delete
+		default:
+			newIndex += len(c.insert)
+		}
+	}
+	return newIndex
+}
+
+// Transform takes two operations made concurrently on the same document and
+// returns a' and b' such that applying a then b' gives the same document as
+// b then a'. When both insert at the same position, a's insert comes first.
+func Transform(a, b *TextOperation) (*TextOperation, *TextOperation, error) {
+	if a.BaseLength != b.BaseLength {
+		return nil, nil, errors.New("operations apply to documents of different lengths")
+	}
+
+	aPrime, bPrime := &TextOperation{}, &TextOperation{}
+	as, bs := append([]op(nil), a.ops...), append([]op(nil), b.ops...)
+	i, j := 0, 0
+	for i < len(as) || j < len(bs) {
+		if i < len(as) && as[i].insert != nil {
+			aPrime.insert(as[i].insert)
+			bPrime.Retain(len(as[i].insert))
+			i++
+			continue
+		}
+		if j < len(bs) && bs[j].insert != nil {
+			aPrime.Retain(len(bs[j].insert))
+			bPrime.insert(bs[j].insert)
+			j++
+			continue
+		}
+		if i == len(as) || j == len(bs) {
+			return nil, nil, errors.New("operations do not cover the same document")
+		}
+
+		ac, bc := &as[i], &bs[j]
+		n := min(ac.length(), bc.length())
+		switch {
+		case ac.retain > 0 && bc.retain > 0:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case ac.delete > 0 && bc.delete > 0:
+			// Both deleted the same text
+		case ac.delete > 0:
+			aPrime.Delete(n)
+		default:
+			bPrime.Delete(n)
+		}
+		if ac.consume(n) {
+			i++
+		}
+		if bc.consume(n) {
+			j++
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// length returns how many units of the base document a retain or delete covers
+func (c *op) length() int {
+	return c.retain + c.delete
+}
+
+// consume shortens a retain or delete by n units, reporting when it is used up
+func (c *op) consume(n int) bool {
+	if c.retain > 0 {
+		c.retain -= n
+		return c.retain == 0
+	}
+	c.delete -= n
+	return c.delete == 0
+}
+
+// MarshalJSON encodes the operation as an ot.js array, e.g. [5, "abc", -3]
+func (o *TextOperation) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, len(o.ops))
+	for i, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			out[i] = c.retain
+		case c.delete > 0:
+			out[i] = -c.delete
+		default:
+			out[i] = string(utf16.Decode(c.insert))
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an ot.js array
+func (o *TextOperation) UnmarshalJSON(data []byte) error {
+	var raw []interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.New("operation must be an array")
+	}
+	*o = TextOperation{}
+	for _, v := range raw {
+		switch c := v.(type) {
+		case float64:
+			n := int(c)
+			if float64(n) != c || n == 0 || c > maxComponentLength || c < -maxComponentLength {
+				return fmt.Errorf("invalid operation component %v", c)
+			}
+			if n > 0 {
+				o.Retain(n)
+			} else {
+				o.Delete(-n)
+			}
+		case string:
+			if c == "" {
+				return errors.New("invalid operation component \"\"")
+			}
+			o.Insert(c)
+		default:
+			return fmt.Errorf("invalid operation component %v", v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package ot
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// parseOp reads an operation in the ot.js array format
+func parseOp(t *testing.T, s string) *TextOperation {
+	t.Helper()
+	var o TextOperation
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		t.Fatalf("parse %s: %v", s, err)
+	}
+	return &o
+}
+
+// apply applies an operation to a string
+func apply(t *testing.T, o *TextOperation, doc string) string {
+	t.Helper()
+	out, err := o.Apply(NewText(doc))
+	if err != nil {
+		t.Fatalf("apply %s to %q: %v", mustJSON(o), doc, err)
+	}
+	return out.String()
+}
+
+func mustJSON(o *TextOperation) string {
+	data, _ := json.Marshal(o)
+	return string(data)
+}
+
+func TestTransformConcurrentEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b string
+		want string
+	}{
+		{"insert at the same position puts a first", "abc", `[1, "X", 2]`, `[1, "Y", 2]`, "aXYbc"},
+		{"insert at the start", "abc", `["X", 3]`, `["Y", 3]`, "XYabc"},
+		{"insert at the end", "abc", `[3, "X"]`, `[3, "Y"]`, "abcXY"},
+		{"inserts at different positions", "abcdef", `[1, "X", 5]`, `[4, "Y", 2]`, "aXbcdYef"},
+		{"delete the same range", "abcdef", `[1, -3, 2]`, `[1, -3, 2]`, "aef"},
+		{"overlapping deletes", "abcdef", `[1, -3, 2]`, `[2, -3, 1]`, "af"},
+		{"delete containing the other", "abcdef", `[-6]`, `[2, -2, 2]`, ""},
+		{"insert and delete at the same position", "abcdef", `[2, "X", 4]`, `[2, -2, 2]`, "abXef"},
+		{"insert inside a deleted range", "abcdef", `[3, "X", 3]`, `[1, -4, 1]`, "aXf"},
+		{"delete before an insert", "abcdef", `[-2, 4]`, `[4, "X", 2]`, "cdXef"},
+		{"retain only", "abc", `[3]`, `[1, "X", 2]`, "aXbc"},
+		{"into an empty document", "", `["hello"]`, `["world"]`, "helloworld"},
+		{"surrogate pairs count as two units", "a😀b", `[3, "X", 1]`, `[1, -2, 1]`, "aXb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := parseOp(t, tt.a), parseOp(t, tt.b)
+			aPrime, bPrime, err := Transform(a, b)
+			if err != nil {
+				t.Fatalf("Transform: %v", err)
+			}
+			viaA := apply(t, bPrime, apply(t, a, tt.doc))
+			viaB := apply(t, aPrime, apply(t, b, tt.doc))
+			if viaA != viaB {
+				t.Fatalf("documents diverge: a then b' = %q, b then a' = %q", viaA, viaB)
+			}
+			if viaA != tt.want {
+				t.Errorf("got %q, want %q", viaA, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformRejectsDifferentDocuments(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"different base lengths", `[3, "X"]`, `[4]`},
+		{"delete and retain of different lengths", `[-2]`, `[3]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Transform(parseOp(t, tt.a), parseOp(t, tt.b)); err == nil {
+				t.Error("Transform succeeded, want an error")
+			}
+		})
+	}
+}
+
+// randomOp makes a random operation on a document
+func randomOp(r *rand.Rand, doc Text) *TextOperation {
+	o := &TextOperation{}
+	letters := []string{"a", "b", "ü", "😀", "\n", "xyz"}
+	for pos := 0; pos < len(doc); {
+		n := 1 + r.Intn(len(doc)-pos)
+		switch r.Intn(4) {
+		case 0:
+			o.Insert(letters[r.Intn(len(letters))])
+		case 1:
+			o.Delete(n)
+			pos += n
+		default:
+			o.Retain(n)
+			pos += n
+		}
+	}
+	if r.Intn(3) == 0 {
+		o.Insert(letters[r.Intn(len(letters))])
+	}
+	return o
+}
+
+func TestTransformConverges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		doc := NewText([]string{"", "x", "hello world", "void setup() {}\nvoid loop() {}\n", "a😀b"}[i%5])
+		a, b := randomOp(r, doc), randomOp(r, doc)
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("Transform(%s, %s): %v", mustJSON(a), mustJSON(b), err)
+		}
+
+		afterA, err := a.Apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		afterB, err := b.Apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		viaA, err := bPrime.Apply(afterA)
+		if err != nil {
+			t.Fatalf("b' %s does not apply after a %s: %v", mustJSON(bPrime), mustJSON(a), err)
+		}
+		viaB, err := aPrime.Apply(afterB)
+		if err != nil {
+			t.Fatalf("a' %s does not apply after b %s: %v", mustJSON(aPrime), mustJSON(b), err)
+		}
+		if viaA.String() != viaB.String() {
+			t.Fatalf("%q with a %s and b %s diverges: %q vs %q", doc.String(), mustJSON(a), mustJSON(b), viaA.String(), viaB.String())
+		}
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    string
+		index int
+		want  int
+	}{
+		{"insert before moves right", `["XY", 5]`, 2, 4},
+		{"insert after stays", `[3, "XY", 2]`, 2, 2},
+		{"insert at the index moves right", `[2, "XY", 3]`, 2, 4},
+		{"delete before moves left", `[-2, 3]`, 4, 2},
+		{"delete around clamps to the start", `[1, -3, 1]`, 3, 1},
+		{"delete after stays", `[3, -2]`, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseOp(t, tt.op).TransformIndex(tt.index); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRejectsWrongLength(t *testing.T) {
+	if _, err := parseOp(t, `[2, "X"]`).Apply(NewText("abc")); err == nil {
+		t.Error("Apply succeeded on a document of the wrong length")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`[5, "abc", -3]`, `[5,"abc",-3]`},
+		{`[1, 1, "a", "b", -1, -1]`, `[2,"ab",-2]`},
+		{`[-2, "X"]`, `["X",-2]`}, // inserts come before deletes
+	}
+	for _, tt := range tests {
+		if got := mustJSON(parseOp(t, tt.in)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`{}`, `[0]`, `[""]`, `[1.5]`, `[true]`} {
+		var o TextOperation
+		if err := json.Unmarshal([]byte(bad), &o); err == nil {
+			t.Errorf("%s: decoded, want an error", bad)
+		}
+	}
+}
@@ -27,6 +27,9 @@ const (
 	QueueXPReward          = "lab.xp.reward"
 	QueueNotification      = "lab.notification"
 	QueueHardwareLog       = "lab.hardware.log"
+	QueueSimulationRun     = "simulation.run"
+	// QueueSimulationRunExpired receives the run jobs no worker took within SimulationRunTTL
+	QueueSimulationRunExpired = "simulation.run.expired"
 )
 
 // Exchange names
@@ -37,14 +40,20 @@ const (
 
 // Routing keys
 const (
-	RoutingKeyCompilation   = "compilation"
-	RoutingKeySessionExpire = "session.expire"
-	RoutingKeyQueueExpire   = "queue.expire"
-	RoutingKeyXPReward      = "xp.reward"
-	RoutingKeyNotification  = "notification"
-	RoutingKeyHardwareLog   = "hardware.log"
+	RoutingKeyCompilation          = "compilation"
+	RoutingKeySessionExpire        = "session.expire"
+	RoutingKeyQueueExpire          = "queue.expire"
+	RoutingKeyXPReward             = "xp.reward"
+	RoutingKeyNotification         = "notification"
+	RoutingKeyHardwareLog          = "hardware.log"
+	RoutingKeySimulationRun        = "simulation.run"
+	RoutingKeySimulationRunExpired = "simulation.run.expired"
 )
 
+// SimulationRunTTL is how long a run job waits for a worker before it is
+// dead-lettered to QueueSimulationRunExpired
+const SimulationRunTTL = time.Hour
+
 // Config holds RabbitMQ configuration
 type Config struct {
 	Host     string
@@ -170,28 +179,40 @@ func setupExchanges() error {
 
 // setupQueues creates necessary queues
 func setupQueues() error {
+	defaultArgs := amqp.Table{
+		"x-message-ttl": int32(86400000), // 24 hours TTL
+	}
 	queues := []struct {
 		name       string
 		routingKey string
+		args       amqp.Table // defaultArgs when nil
 	}{
-		{QueueCodeCompilation, RoutingKeyCompilation},
-		{QueueSessionExpiration, RoutingKeySessionExpire},
-		{QueueQueueExpiration, RoutingKeyQueueExpire},
-		{QueueXPReward, RoutingKeyXPReward},
-		{QueueNotification, RoutingKeyNotification},
-		{QueueHardwareLog, RoutingKeyHardwareLog},
+		{QueueCodeCompilation, RoutingKeyCompilation, nil},
+		{QueueSessionExpiration, RoutingKeySessionExpire, nil},
+		{QueueQueueExpiration, RoutingKeyQueueExpire, nil},
+		{QueueXPReward, RoutingKeyXPReward, nil},
+		{QueueNotification, RoutingKeyNotification, nil},
+		{QueueHardwareLog, RoutingKeyHardwareLog, nil},
+		{QueueSimulationRun, RoutingKeySimulationRun, amqp.Table{
+			"x-message-ttl":             int32(SimulationRunTTL.Milliseconds()),
+			"x-dead-letter-exchange":    ExchangeLabDirect,
+			"x-dead-letter-routing-key": RoutingKeySimulationRunExpired,
+		}},
+		{QueueSimulationRunExpired, RoutingKeySimulationRunExpired, nil},
 	}
 
 	for _, q := range queues {
+		args := q.args
+		if args == nil {
+			args = defaultArgs
+		}
 		_, err := channel.QueueDeclare(
 			q.name,
 			true,  // durable
 			false, // delete when unused
 			false, // exclusive
 			false, // no-wait
-			amqp.Table{
-				"x-message-ttl": int32(86400000), // 24 hours TTL
-			},
+			args,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to declare queue %s: %v", q.name, err)
@@ -504,3 +525,22 @@ func PublishHardwareLog(job HardwareLogJob) error {
 	job.CreatedAt = time.Now()
 	return Publish(QueueHardwareLog, RoutingKeyHardwareLog, job)
 }
+
+// ============================================
+// Simulation Job Publishers
+// ============================================
+
+// SimulationRunJob asks a worker to run a queued SimulationRun
+type SimulationRunJob struct {
+	RunID        string          `json:"run_id"`
+	SimulationID string          `json:"simulation_id"`
+	UserID       string          `json:"user_id"`
+	Settings     json.RawMessage `json:"settings,omitempty"` // stored settings merged with the run's override
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// PublishSimulationRun publishes a simulation run job
+func PublishSimulationRun(job SimulationRunJob) error {
+	job.CreatedAt = time.Now()
+	return Publish(QueueSimulationRun, RoutingKeySimulationRun, job)
+}
@@ -206,6 +206,11 @@ func LRange(key string, start, stop int64) ([]string, error) {
 	return RedisClient.LRange(ctx, key, start, stop).Result()
 }
 
+// LTrim menyisakan range element dari list
+func LTrim(key string, start, stop int64) error {
+	return RedisClient.LTrim(ctx, key, start, stop).Err()
+}
+
 // LLen mendapatkan panjang list
 func LLen(key string) (int64, error) {
 	return RedisClient.LLen(ctx, key).Result()
@@ -298,6 +303,20 @@ func DeleteByPattern(pattern string) error {
 	return nil
 }
 
+// ============================================
+// PUB/SUB OPERATIONS
+// ============================================
+
+// Publish mengirim message ke channel
+func Publish(channel string, message interface{}) error {
+	return RedisClient.Publish(ctx, channel, message).Err()
+}
+
+// PSubscribe berlangganan channel yang cocok dengan pattern
+func PSubscribe(patterns ...string) *redis.PubSub {
+	return RedisClient.PSubscribe(ctx, patterns...)
+}
+
 // ============================================
 // UTILITY FUNCTIONS WITH KEY PREFIXING
 // ============================================
@@ -0,0 +1,169 @@
+package schematic
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ============================================
+// Structural Schema Diff
+// ============================================
+
+// FieldChange is a single changed attribute of a component
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// ComponentChange lists what changed on a component present in both schemas
+type ComponentChange struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// WireChange is a wire whose endpoints moved
+type WireChange struct {
+	ID  string `json:"id"`
+	Old Wire   `json:"old"`
+	New Wire   `json:"new"`
+}
+
+// SchemaDiff describes how one schema differs from another
+type SchemaDiff struct {
+	ComponentsAdded   []Component       `json:"components_added"`
+	ComponentsRemoved []Component       `json:"components_removed"`
+	ComponentsChanged []ComponentChange `json:"components_changed"`
+	WiresAdded        []Wire            `json:"wires_added"`
+	WiresRemoved      []Wire            `json:"wires_removed"`
+	WiresRerouted     []WireChange      `json:"wires_rerouted"`
+}
+
+// IsEmpty returns true when both schemas are structurally identical
+func (d *SchemaDiff) IsEmpty() bool {
+	return len(d.ComponentsAdded) == 0 && len(d.ComponentsRemoved) == 0 && len(d.ComponentsChanged) == 0 &&
+		len(d.WiresAdded) == 0 && len(d.WiresRemoved) == 0 && len(d.WiresRerouted) == 0
+}
+
+// Diff compares two schemas. Components are matched by ID; wires are matched
+// by ID first and then by endpoints, since editors may regenerate wire IDs.
+func Diff(from, to *Schema) *SchemaDiff {
+	diff := &SchemaDiff{
+		ComponentsAdded:   []Component{},
+		ComponentsRemoved: []Component{},
+		ComponentsChanged: []ComponentChange{},
+		WiresAdded:        []Wire{},
+		WiresRemoved:      []Wire{},
+		WiresRerouted:     []WireChange{},
+	}
+
+	// Components
+	for _, old := range from.Components {
+		updated := to.FindComponent(old.ID)
+		if updated == nil {
+			diff.ComponentsRemoved = append(diff.ComponentsRemoved, old)
+			continue
+		}
+		if changes := componentChanges(&old, updated); len(changes) > 0 {
+			diff.ComponentsChanged = append(diff.ComponentsChanged, ComponentChange{
+				ID:      updated.ID,
+				Name:    updated.Name,
+				Type:    updated.Type,
+				Changes: changes,
+			})
+		}
+	}
+	for _, comp := range to.Components {
+		if from.FindComponent(comp.ID) == nil {
+			diff.ComponentsAdded = append(diff.ComponentsAdded, comp)
+		}
+	}
+
+	// Wires matched by ID
+	oldWires := map[string]Wire{}
+	for _, w := range from.Wires {
+		oldWires[w.ID] = w
+	}
+	unmatchedNew := []Wire{}
+	for _, w := range to.Wires {
+		old, ok := oldWires[w.ID]
+		if !ok {
+			unmatchedNew = append(unmatchedNew, w)
+			continue
+		}
+		delete(oldWires, w.ID)
+		if wireKey(old) != wireKey(w) {
+			diff.WiresRerouted = append(diff.WiresRerouted, WireChange{ID: w.ID, Old: old, New: w})
+		}
+	}
+
+	// Remaining wires matched by endpoints
+	oldByEndpoints := map[string]Wire{}
+	for _, w := range oldWires {
+		oldByEndpoints[wireKey(w)] = w
+	}
+	for _, w := range unmatchedNew {
+		if _, ok := oldByEndpoints[wireKey(w)]; ok {
+			delete(oldByEndpoints, wireKey(w))
+			continue
+		}
+		diff.WiresAdded = append(diff.WiresAdded, w)
+	}
+	for _, w := range oldByEndpoints {
+		diff.WiresRemoved = append(diff.WiresRemoved, w)
+	}
+	sort.Slice(diff.WiresRemoved, func(i, j int) bool { return diff.WiresRemoved[i].ID < diff.WiresRemoved[j].ID })
+
+	return diff
+}
+
+// wireKey identifies a wire by its endpoints regardless of direction
+func wireKey(w Wire) string {
+	a := w.StartComponentID + ":" + w.StartPinID
+	b := w.EndComponentID + ":" + w.EndPinID
+	if a > b {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
+
+func componentChanges(old, updated *Component) []FieldChange {
+	changes := []FieldChange{}
+	if old.Type != updated.Type {
+		changes = append(changes, FieldChange{Field: "type", Old: old.Type, New: updated.Type})
+	}
+	if old.Name != updated.Name {
+		changes = append(changes, FieldChange{Field: "name", Old: old.Name, New: updated.Name})
+	}
+	if old.Position != updated.Position {
+		changes = append(changes, FieldChange{Field: "position", Old: old.Position, New: updated.Position})
+	}
+	if old.Rotation != updated.Rotation {
+		changes = append(changes, FieldChange{Field: "rotation", Old: old.Rotation, New: updated.Rotation})
+	}
+
+	keys := map[string]bool{}
+	for k := range old.Properties {
+		keys[k] = true
+	}
+	for k := range updated.Properties {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		oldValue, newValue := old.Properties[k], updated.Properties[k]
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, FieldChange{Field: fmt.Sprintf("properties.%s", k), Old: oldValue, New: newValue})
+		}
+	}
+
+	return changes
+}
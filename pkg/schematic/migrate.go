@@ -0,0 +1,120 @@
+package schematic
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// ============================================
+// Schema Format Versions & Migrations
+// ============================================
+
+// CurrentVersion is the schema format written by this API
+const CurrentVersion = 2
+
+// migration upgrades a decoded document from version N to N+1 in place
+type migration func(doc map[string]interface{})
+
+// migrations is the upgrade chain, keyed by source version. To evolve the
+// format, bump CurrentVersion, add the step here and publish a new
+// schemas/circuit.vN.json.
+var migrations = map[int]migration{
+	1: migrateV1ToV2,
+}
+
+// numericProperties are component properties stored as numbers from v2 on
+var numericProperties = []string{"resistance", "capacitance", "inductance", "voltage", "current", "frequency"}
+
+// Version reports the format version of a decoded document; unversioned documents are v1
+func Version(doc map[string]interface{}) int {
+	if v, ok := doc["version"].(float64); ok && v >= 1 {
+		return int(v)
+	}
+	return 1
+}
+
+// Upgrade migrates a stored document to CurrentVersion. It returns the
+// original bytes untouched (and changed=false) when nothing had to change.
+func Upgrade(data []byte) (upgraded []byte, fromVersion int, changed bool, err error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	fromVersion = Version(doc)
+	if fromVersion == CurrentVersion {
+		return data, fromVersion, false, nil
+	}
+	if err := UpgradeDocument(doc); err != nil {
+		return nil, fromVersion, false, err
+	}
+
+	upgraded, err = json.Marshal(doc)
+	return upgraded, fromVersion, true, err
+}
+
+// UpgradeDocument runs the migration chain on a decoded document
+func UpgradeDocument(doc map[string]interface{}) error {
+	version := Version(doc)
+	if version > CurrentVersion {
+		return fmt.Errorf("schema version %d is newer than supported version %d", version, CurrentVersion)
+	}
+	for ; version < CurrentVersion; version++ {
+		step, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from schema version %d", version)
+		}
+		step(doc)
+		doc["version"] = version + 1
+	}
+	return nil
+}
+
+// migrateV1ToV2 makes the implicit v1 conventions explicit:
+//   - components is always present
+//   - properties is always an object
+//   - rotation is normalized to [0, 360)
+//   - electrical values such as "4.7k" or "10uF" become numbers in SI base units
+func migrateV1ToV2(doc map[string]interface{}) {
+	components, _ := doc["components"].([]interface{})
+	if components == nil {
+		components = []interface{}{}
+	}
+	doc["components"] = components
+
+	for _, c := range components {
+		comp, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if r, ok := comp["rotation"].(float64); ok {
+			comp["rotation"] = math.Mod(math.Mod(r, 360)+360, 360)
+		}
+
+		props, ok := comp["properties"].(map[string]interface{})
+		if !ok {
+			props = map[string]interface{}{}
+			comp["properties"] = props
+		}
+		for _, key := range numericProperties {
+			if s, ok := props[key].(string); ok {
+				if v, ok := ParseValue(s); ok {
+					props[key] = v
+				}
+			}
+		}
+	}
+}
+
+func decodeDocument(data []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if len(data) == 0 || string(data) == "null" {
+		return doc, nil
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("schema data is not a JSON object: %w", err)
+	}
+	return doc, nil
+}
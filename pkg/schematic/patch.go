@@ -0,0 +1,249 @@
+package schematic
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ============================================
+// Component-level Schema Patches
+// ============================================
+
+// Patch operations
+const (
+	PatchAddComponent    = "add_component"
+	PatchUpdateComponent = "update_component"
+	PatchRemoveComponent = "remove_component"
+	PatchAddWire         = "add_wire"
+	PatchUpdateWire      = "update_wire"
+	PatchRemoveWire      = "remove_wire"
+)
+
+// PatchOp is a change to one component or wire of a schema document. Adds
+// carry the whole element in Value; updates carry only the fields to change,
+// with null removing a field.
+type PatchOp struct {
+	Op    string                 `json:"op"`
+	ID    string                 `json:"id,omitempty"`
+	Value map[string]interface{} `json:"value,omitempty"`
+}
+
+// PatchRejection explains why an operation of a patch was not applied
+type PatchRejection struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Document is a decoded schema document. Patches edit it in place and keep
+// the fields they do not know about.
+type Document map[string]interface{}
+
+// ParseDocument decodes and upgrades stored schema data for patching
+func ParseDocument(data []byte) (Document, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := UpgradeDocument(doc); err != nil {
+		return nil, err
+	}
+	d := Document(doc)
+	if _, ok := d["components"].([]interface{}); !ok {
+		d["components"] = []interface{}{}
+	}
+	if _, ok := d[d.wiresKey()].([]interface{}); !ok {
+		d[d.wiresKey()] = []interface{}{}
+	}
+	return d, nil
+}
+
+// Components returns the component objects of the document
+func (d Document) Components() []interface{} {
+	components, _ := d["components"].([]interface{})
+	return components
+}
+
+// Wires returns the wire objects of the document
+func (d Document) Wires() []interface{} {
+	wires, _ := d[d.wiresKey()].([]interface{})
+	return wires
+}
+
+// wiresKey is the key the document keeps its wires under; project documents
+// name them "connections"
+func (d Document) wiresKey() string {
+	if _, ok := d["wires"]; !ok {
+		if _, ok := d["connections"]; ok {
+			return "connections"
+		}
+	}
+	return "wires"
+}
+
+// Marshal encodes the document
+func (d Document) Marshal() ([]byte, error) {
+	return json.Marshal(map[string]interface{}(d))
+}
+
+// Clone returns a deep copy of the document
+func (d Document) Clone() Document {
+	data, err := d.Marshal()
+	if err != nil {
+		return Document{}
+	}
+	clone := Document{}
+	json.Unmarshal(data, &clone)
+	return clone
+}
+
+// Patch applies operations in order and returns the document they produce
+// with the operations that took effect. Operations that conflict with the
+// document, such as updating a component another user removed, are skipped
+// and reported; the rest still apply. The result must validate, otherwise
+// the whole patch fails with a *ValidationError and d is left as it was.
+func (d Document) Patch(ops []PatchOp) (Document, []PatchOp, []PatchRejection, error) {
+	next := d.Clone()
+	applied := []PatchOp{}
+	rejected := []PatchRejection{}
+
+	for i, op := range ops {
+		effective, err := next.apply(op)
+		if err != nil {
+			rejected = append(rejected, PatchRejection{Index: i, Op: op.Op, ID: op.ID, Reason: err.Error()})
+			continue
+		}
+		if effective {
+			applied = append(applied, op)
+		}
+	}
+
+	if len(applied) > 0 {
+		data, err := next.Marshal()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := Validate(data); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return next, applied, rejected, nil
+}
+
+// apply applies one operation, reporting whether it changed the document
+func (d Document) apply(op PatchOp) (bool, error) {
+	switch op.Op {
+	case PatchAddComponent, PatchAddWire:
+		id, _ := op.Value["id"].(string)
+		if id == "" {
+			return false, fmt.Errorf("value must have an id")
+		}
+		key := "components"
+		if op.Op == PatchAddWire {
+			key = d.wiresKey()
+			for _, end := range []string{"startComponentId", "endComponentId"} {
+				compID, _ := op.Value[end].(string)
+				if d.find("components", compID) < 0 {
+					return false, fmt.Errorf("unknown component %q", compID)
+				}
+			}
+		}
+		if d.find(key, id) >= 0 {
+			return false, fmt.Errorf("%q already exists", id)
+		}
+		element := map[string]interface{}{}
+		mergeFields(element, op.Value)
+		if props, ok := op.Value["properties"].(map[string]interface{}); ok {
+			element["properties"] = props
+		}
+		d[key] = append(d[key].([]interface{}), element)
+		return true, nil
+
+	case PatchUpdateComponent, PatchUpdateWire:
+		key := "components"
+		if op.Op == PatchUpdateWire {
+			key = d.wiresKey()
+		}
+		i := d.find(key, op.ID)
+		if i < 0 {
+			return false, fmt.Errorf("%q not found", op.ID)
+		}
+		if id, ok := op.Value["id"]; ok && id != op.ID {
+			return false, fmt.Errorf("id cannot change")
+		}
+		element := d[key].([]interface{})[i].(map[string]interface{})
+		mergeFields(element, op.Value)
+		if props, ok := op.Value["properties"].(map[string]interface{}); ok {
+			// Properties merge by key so concurrent edits of different properties both survive
+			existing, _ := element["properties"].(map[string]interface{})
+			if existing == nil {
+				existing = map[string]interface{}{}
+			}
+			mergeFields(existing, props)
+			element["properties"] = existing
+		}
+		return true, nil
+
+	case PatchRemoveComponent:
+		i := d.find("components", op.ID)
+		if i < 0 {
+			return false, nil // already removed
+		}
+		d["components"] = remove(d["components"].([]interface{}), i)
+		// Wires attached to the component go with it
+		wiresKey := d.wiresKey()
+		wires := d[wiresKey].([]interface{})
+		kept := make([]interface{}, 0, len(wires))
+		for _, w := range wires {
+			wire, _ := w.(map[string]interface{})
+			if wire["startComponentId"] != op.ID && wire["endComponentId"] != op.ID {
+				kept = append(kept, w)
+			}
+		}
+		d[wiresKey] = kept
+		return true, nil
+
+	case PatchRemoveWire:
+		key := d.wiresKey()
+		i := d.find(key, op.ID)
+		if i < 0 {
+			return false, nil // already removed
+		}
+		d[key] = remove(d[key].([]interface{}), i)
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// find returns the index of the element with the given ID, or -1
+func (d Document) find(key, id string) int {
+	elements, _ := d[key].([]interface{})
+	for i, e := range elements {
+		if element, ok := e.(map[string]interface{}); ok && element["id"] == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergeFields sets the changed fields on an element; null removes a field.
+// properties is left to the caller.
+func mergeFields(element, changes map[string]interface{}) {
+	for field, value := range changes {
+		if field == "properties" {
+			if _, ok := value.(map[string]interface{}); ok {
+				continue
+			}
+		}
+		if value == nil {
+			delete(element, field)
+		} else {
+			element[field] = value
+		}
+	}
+}
+
+func remove(elements []interface{}, i int) []interface{} {
+	return append(elements[:i:i], elements[i+1:]...)
+}
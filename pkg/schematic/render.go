@@ -0,0 +1,314 @@
+package schematic
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ============================================
+// Schematic Rendering - SVG and PNG previews
+// ============================================
+
+// RenderOptions controls preview output
+type RenderOptions struct {
+	Width   int
+	Height  int
+	Padding float64
+}
+
+// DefaultRenderOptions returns the thumbnail size used for circuit previews
+func DefaultRenderOptions() RenderOptions {
+	return RenderOptions{Width: 640, Height: 400, Padding: 24}
+}
+
+// Component boxes are drawn at a fixed size in canvas units
+const (
+	componentWidth  = 80.0
+	componentHeight = 50.0
+)
+
+var (
+	colorBackground = color.RGBA{R: 0xf8, G: 0xfa, B: 0xfc, A: 0xff}
+	colorGrid       = color.RGBA{R: 0xe2, G: 0xe8, B: 0xf0, A: 0xff}
+	colorWire       = color.RGBA{R: 0x22, G: 0xc5, B: 0x5e, A: 0xff}
+	colorStroke     = color.RGBA{R: 0x33, G: 0x41, B: 0x55, A: 0xff}
+	colorPin        = color.RGBA{R: 0x0f, G: 0x17, B: 0x2a, A: 0xff}
+	colorLabel      = color.RGBA{R: 0x0f, G: 0x17, B: 0x2a, A: 0xff}
+)
+
+// componentColors gives each component family a recognizable fill
+var componentColors = map[string]color.RGBA{
+	"power_source":  {R: 0xef, G: 0x44, B: 0x44, A: 0xff},
+	"battery":       {R: 0xef, G: 0x44, B: 0x44, A: 0xff},
+	"ground":        {R: 0x47, G: 0x55, B: 0x69, A: 0xff},
+	"resistor":      {R: 0xd9, G: 0xb9, B: 0x8c, A: 0xff},
+	"potentiometer": {R: 0xd9, G: 0xb9, B: 0x8c, A: 0xff},
+	"capacitor":     {R: 0x60, G: 0xa5, B: 0xfa, A: 0xff},
+	"inductor":      {R: 0xa7, G: 0x8b, B: 0xfa, A: 0xff},
+	"diode":         {R: 0x94, G: 0xa3, B: 0xb8, A: 0xff},
+	"arduino_uno":   {R: 0x00, G: 0x97, B: 0x9c, A: 0xff},
+	"arduino_mega":  {R: 0x00, G: 0x97, B: 0x9c, A: 0xff},
+	"arduino_nano":  {R: 0x00, G: 0x97, B: 0x9c, A: 0xff},
+	"esp32":         {R: 0x1e, G: 0x29, B: 0x3b, A: 0xff},
+	"dht22":         {R: 0xc0, G: 0x84, B: 0xfc, A: 0xff},
+	"ldr":           {R: 0xc0, G: 0x84, B: 0xfc, A: 0xff},
+	"ultrasonic":    {R: 0xc0, G: 0x84, B: 0xfc, A: 0xff},
+	"dc_motor":      {R: 0xf9, G: 0x73, B: 0x16, A: 0xff},
+	"servo":         {R: 0xf9, G: 0x73, B: 0x16, A: 0xff},
+	"buzzer":        {R: 0xf9, G: 0x73, B: 0x16, A: 0xff},
+	"relay":         {R: 0xf9, G: 0x73, B: 0x16, A: 0xff},
+}
+
+var colorDefaultComponent = color.RGBA{R: 0xcb, G: 0xd5, B: 0xe1, A: 0xff}
+
+// canvas is the drawing surface shared by the SVG and raster backends
+type canvas interface {
+	rect(x, y, w, h float64, fill, stroke color.RGBA)
+	line(x1, y1, x2, y2, width float64, c color.RGBA)
+	circle(cx, cy, r float64, fill color.RGBA)
+	text(x, y float64, s string, c color.RGBA)
+}
+
+// RenderSVG draws the schema as an SVG document
+func RenderSVG(schema *Schema, opts RenderOptions) []byte {
+	svg := &svgCanvas{}
+	fmt.Fprintf(&svg.sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		opts.Width, opts.Height, opts.Width, opts.Height)
+	draw(schema, svg, opts)
+	svg.sb.WriteString(`</svg>`)
+	return []byte(svg.sb.String())
+}
+
+// RenderPNG rasterizes the schema to a PNG image
+func RenderPNG(schema *Schema, opts RenderOptions) ([]byte, error) {
+	raster := &rasterCanvas{img: image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))}
+	draw(schema, raster, opts)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, raster.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// draw lays out the schema to fit the output and paints it onto the canvas
+func draw(schema *Schema, c canvas, opts RenderOptions) {
+	width, height := float64(opts.Width), float64(opts.Height)
+	c.rect(0, 0, width, height, colorBackground, colorBackground)
+	for x := 20.0; x < width; x += 20 {
+		c.line(x, 0, x, height, 1, colorGrid)
+	}
+	for y := 20.0; y < height; y += 20 {
+		c.line(0, y, width, y, 1, colorGrid)
+	}
+
+	if len(schema.Components) == 0 {
+		return
+	}
+
+	// Fit the bounding box of all components into the output
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, comp := range schema.Components {
+		minX = math.Min(minX, comp.Position.X)
+		minY = math.Min(minY, comp.Position.Y)
+		maxX = math.Max(maxX, comp.Position.X+componentWidth)
+		maxY = math.Max(maxY, comp.Position.Y+componentHeight)
+	}
+	scale := math.Min((width-2*opts.Padding)/(maxX-minX), (height-2*opts.Padding)/(maxY-minY))
+	scale = math.Min(scale, 2)
+	offsetX := (width - (maxX-minX)*scale) / 2
+	offsetY := (height - (maxY-minY)*scale) / 2
+	tx := func(x float64) float64 { return offsetX + (x-minX)*scale }
+	ty := func(y float64) float64 { return offsetY + (y-minY)*scale }
+
+	anchors := pinAnchors(schema)
+
+	for _, wire := range schema.Wires {
+		start, okStart := anchors[wire.StartComponentID+":"+wire.StartPinID]
+		end, okEnd := anchors[wire.EndComponentID+":"+wire.EndPinID]
+		if !okStart || !okEnd {
+			continue
+		}
+		// Orthogonal routing: horizontal first, then vertical
+		midX := (start.X + end.X) / 2
+		wireColor := parseHexColor(wire.Color, colorWire)
+		c.line(tx(start.X), ty(start.Y), tx(midX), ty(start.Y), 2, wireColor)
+		c.line(tx(midX), ty(start.Y), tx(midX), ty(end.Y), 2, wireColor)
+		c.line(tx(midX), ty(end.Y), tx(end.X), ty(end.Y), 2, wireColor)
+	}
+
+	for _, comp := range schema.Components {
+		fill, ok := componentColors[comp.Type]
+		if !ok {
+			fill = colorDefaultComponent
+		}
+		if comp.Type == "led" {
+			if hex, ok := comp.Properties["color"].(string); ok {
+				fill = parseHexColor(hex, fill)
+			}
+		}
+		c.rect(tx(comp.Position.X), ty(comp.Position.Y), componentWidth*scale, componentHeight*scale, fill, colorStroke)
+
+		label := comp.Name
+		if label == "" {
+			label = comp.Type
+		}
+		c.text(tx(comp.Position.X+componentWidth/2), ty(comp.Position.Y+componentHeight+12), label, colorLabel)
+	}
+
+	keys := make([]string, 0, len(anchors))
+	for key := range anchors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c.circle(tx(anchors[key].X), ty(anchors[key].Y), math.Max(2, 3*scale), colorPin)
+	}
+}
+
+// pinAnchors places every wired pin on the edge of its component box.
+// Pins alternate left/right and are spread evenly down each side.
+func pinAnchors(schema *Schema) map[string]Position {
+	pinsByComponent := map[string][]string{}
+	seen := map[string]bool{}
+	addPin := func(componentID, pinID string) {
+		key := componentID + ":" + pinID
+		if seen[key] || schema.FindComponent(componentID) == nil {
+			return
+		}
+		seen[key] = true
+		pinsByComponent[componentID] = append(pinsByComponent[componentID], pinID)
+	}
+	for _, wire := range schema.Wires {
+		addPin(wire.StartComponentID, wire.StartPinID)
+		addPin(wire.EndComponentID, wire.EndPinID)
+	}
+
+	anchors := map[string]Position{}
+	for componentID, pins := range pinsByComponent {
+		comp := schema.FindComponent(componentID)
+		perSide := (len(pins) + 1) / 2
+		for i, pin := range pins {
+			x := comp.Position.X
+			if i%2 == 1 {
+				x += componentWidth
+			}
+			slot := float64(i/2 + 1)
+			y := comp.Position.Y + componentHeight*slot/float64(perSide+1)
+			anchors[componentID+":"+pin] = Position{X: x, Y: y}
+		}
+	}
+	return anchors
+}
+
+func parseHexColor(s string, fallback color.RGBA) color.RGBA {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return fallback
+	}
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(s, "%02x%02x%02x", &r, &g, &b); err != nil {
+		return fallback
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 0xff}
+}
+
+// ============================================
+// SVG Backend
+// ============================================
+
+type svgCanvas struct {
+	sb strings.Builder
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (s *svgCanvas) rect(x, y, w, h float64, fill, stroke color.RGBA) {
+	fmt.Fprintf(&s.sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="4" fill="%s" stroke="%s"/>`,
+		x, y, w, h, svgColor(fill), svgColor(stroke))
+}
+
+func (s *svgCanvas) line(x1, y1, x2, y2, width float64, c color.RGBA) {
+	fmt.Fprintf(&s.sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"/>`,
+		x1, y1, x2, y2, svgColor(c), width)
+}
+
+func (s *svgCanvas) circle(cx, cy, r float64, fill color.RGBA) {
+	fmt.Fprintf(&s.sb, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"/>`, cx, cy, r, svgColor(fill))
+}
+
+func (s *svgCanvas) text(x, y float64, str string, c color.RGBA) {
+	fmt.Fprintf(&s.sb, `<text x="%.1f" y="%.1f" font-family="sans-serif" font-size="11" text-anchor="middle" fill="%s">%s</text>`,
+		x, y, svgColor(c), html.EscapeString(str))
+}
+
+// ============================================
+// Raster Backend
+// ============================================
+
+// rasterCanvas paints directly onto an RGBA image. Labels are omitted
+// because the standard library ships no fonts.
+type rasterCanvas struct {
+	img *image.RGBA
+}
+
+func (r *rasterCanvas) rect(x, y, w, h float64, fill, stroke color.RGBA) {
+	x0, y0 := int(math.Round(x)), int(math.Round(y))
+	x1, y1 := int(math.Round(x+w)), int(math.Round(y+h))
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			if px == x0 || px == x1-1 || py == y0 || py == y1-1 {
+				r.set(px, py, stroke)
+			} else {
+				r.set(px, py, fill)
+			}
+		}
+	}
+}
+
+func (r *rasterCanvas) line(x1, y1, x2, y2, width float64, c color.RGBA) {
+	length := math.Hypot(x2-x1, y2-y1)
+	steps := int(math.Ceil(length*2)) + 1
+	half := width / 2
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		x := x1 + (x2-x1)*t
+		y := y1 + (y2-y1)*t
+		if half <= 0.5 {
+			r.set(int(math.Round(x)), int(math.Round(y)), c)
+			continue
+		}
+		r.circle(x, y, half, c)
+	}
+}
+
+func (r *rasterCanvas) circle(cx, cy, radius float64, fill color.RGBA) {
+	x0, x1 := int(math.Floor(cx-radius)), int(math.Ceil(cx+radius))
+	y0, y1 := int(math.Floor(cy-radius)), int(math.Ceil(cy+radius))
+	for py := y0; py <= y1; py++ {
+		for px := x0; px <= x1; px++ {
+			dx, dy := float64(px)-cx, float64(py)-cy
+			if dx*dx+dy*dy <= radius*radius {
+				r.set(px, py, fill)
+			}
+		}
+	}
+}
+
+func (r *rasterCanvas) text(x, y float64, s string, c color.RGBA) {}
+
+func (r *rasterCanvas) set(x, y int, c color.RGBA) {
+	if image.Pt(x, y).In(r.img.Bounds()) {
+		r.img.SetRGBA(x, y, c)
+	}
+}
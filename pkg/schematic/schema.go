@@ -0,0 +1,172 @@
+package schematic
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// ============================================
+// Circuit Schema - Typed view of SchemaData JSON
+// ============================================
+
+// Position is a component's canvas position
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Component is a single part placed on the canvas
+type Component struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Name       string                 `json:"name"`
+	Position   Position               `json:"position"`
+	Rotation   float64                `json:"rotation,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Wire connects two component pins
+type Wire struct {
+	ID               string `json:"id"`
+	StartComponentID string `json:"startComponentId"`
+	StartPinID       string `json:"startPinId"`
+	EndComponentID   string `json:"endComponentId"`
+	EndPinID         string `json:"endPinId"`
+	Color            string `json:"color,omitempty"`
+}
+
+// Schema is the circuit document stored in SchemaData
+type Schema struct {
+	Version    int         `json:"version,omitempty"`
+	Components []Component `json:"components"`
+	Wires      []Wire      `json:"wires"`
+}
+
+// Parse decodes SchemaData into a Schema. Project documents name their
+// wires "connections"; those are read into Wires as well.
+func Parse(data []byte) (*Schema, error) {
+	schema := &Schema{}
+	if len(data) == 0 || string(data) == "null" {
+		return schema, nil
+	}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+	if schema.Wires == nil {
+		var project struct {
+			Connections []Wire `json:"connections"`
+		}
+		if err := json.Unmarshal(data, &project); err == nil {
+			schema.Wires = project.Connections
+		}
+	}
+	return schema, nil
+}
+
+// Marshal encodes the schema back to JSON in the current format version
+func (s *Schema) Marshal() ([]byte, error) {
+	s.Version = CurrentVersion
+	if s.Components == nil {
+		s.Components = []Component{}
+	}
+	if s.Wires == nil {
+		s.Wires = []Wire{}
+	}
+	return json.Marshal(s)
+}
+
+// FindComponent returns the component with the given ID
+func (s *Schema) FindComponent(id string) *Component {
+	for i := range s.Components {
+		if s.Components[i].ID == id {
+			return &s.Components[i]
+		}
+	}
+	return nil
+}
+
+// Float reads a numeric property, accepting numbers and SI-suffixed strings ("4.7k")
+func (c *Component) Float(key string) (float64, bool) {
+	v, ok := c.Properties[key]
+	if !ok {
+		return 0, false
+	}
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case string:
+		return ParseValue(val)
+	}
+	return 0, false
+}
+
+// siSuffixes maps engineering suffixes to their multiplier
+var siSuffixes = map[string]float64{
+	"p":   1e-12,
+	"n":   1e-9,
+	"u":   1e-6,
+	"µ":   1e-6,
+	"m":   1e-3,
+	"k":   1e3,
+	"K":   1e3,
+	"M":   1e6,
+	"meg": 1e6,
+	"G":   1e9,
+}
+
+// ParseValue parses values such as "220", "4.7k", "10uF" or "1M"
+func ParseValue(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+
+	// Strip a trailing unit (Ω, ohm, F, H, V, A)
+	for _, unit := range []string{"ohm", "Ω", "F", "H", "V", "A"} {
+		if strings.HasSuffix(s, unit) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit))
+			break
+		}
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, true
+	}
+
+	for _, suffix := range []string{"meg", "p", "n", "u", "µ", "m", "k", "K", "M", "G"} {
+		if strings.HasSuffix(s, suffix) {
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64); err == nil {
+				return v * siSuffixes[suffix], true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// FormatValue renders a value with an engineering prefix, e.g. FormatValue(4700, "Ω") = "4.7kΩ"
+func FormatValue(v float64, unit string) string {
+	prefixes := []struct {
+		scale  float64
+		prefix string
+	}{
+		{1e9, "G"}, {1e6, "M"}, {1e3, "k"}, {1, ""}, {1e-3, "m"}, {1e-6, "µ"}, {1e-9, "n"}, {1e-12, "p"},
+	}
+
+	abs := v
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs == 0 {
+		return "0" + unit
+	}
+
+	for _, p := range prefixes {
+		if abs >= p.scale {
+			return strconv.FormatFloat(v/p.scale, 'g', 4, 64) + p.prefix + unit
+		}
+	}
+	return strconv.FormatFloat(v/1e-12, 'g', 4, 64) + "p" + unit
+}
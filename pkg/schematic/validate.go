@@ -0,0 +1,131 @@
+package schematic
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"nexfi-backend/pkg/jsonschema"
+	"strings"
+)
+
+// ============================================
+// Schema Validation
+// ============================================
+
+//go:embed schemas/circuit.v2.json
+var circuitSchemaJSON []byte
+
+var circuitSchema = jsonschema.MustCompile(circuitSchemaJSON)
+
+// JSONSchema returns the published JSON Schema of the current format
+func JSONSchema() []byte {
+	return circuitSchemaJSON
+}
+
+// ValidationError lists everything wrong with a schema document
+type ValidationError struct {
+	Errors []jsonschema.Error `json:"errors"`
+}
+
+// Error keeps the message services already map to HTTP 400
+func (e *ValidationError) Error() string {
+	return "invalid schema data"
+}
+
+// Details summarizes the failures, e.g. "/components/2/position/x: expected number, got string"
+func (e *ValidationError) Details() string {
+	parts := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Normalize upgrades an incoming document to the current version and validates it.
+// It is the single entry point for every write of schema data.
+func Normalize(data []byte) ([]byte, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, &ValidationError{Errors: []jsonschema.Error{{Path: "/", Message: "must be a JSON object"}}}
+	}
+
+	if err := UpgradeDocument(doc); err != nil {
+		return nil, &ValidationError{Errors: []jsonschema.Error{{Path: "/version", Message: err.Error()}}}
+	}
+
+	// Round-trip through JSON so the validator sees plain JSON types
+	normalized, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// Validate checks a current-version document against the JSON Schema and
+// the references the JSON Schema cannot express (unique IDs, wire endpoints)
+func Validate(data []byte) error {
+	errs, err := circuitSchema.Validate(data)
+	if err != nil {
+		return &ValidationError{Errors: []jsonschema.Error{{Path: "/", Message: "must be valid JSON"}}}
+	}
+
+	if len(errs) == 0 {
+		schema, err := Parse(data)
+		if err != nil {
+			return &ValidationError{Errors: []jsonschema.Error{{Path: "/", Message: err.Error()}}}
+		}
+		errs = append(errs, referenceErrors(schema, data)...)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func referenceErrors(schema *Schema, data []byte) []jsonschema.Error {
+	errs := []jsonschema.Error{}
+
+	ids := map[string]int{}
+	for i, comp := range schema.Components {
+		if first, dup := ids[comp.ID]; dup {
+			errs = append(errs, jsonschema.Error{
+				Path:    fmt.Sprintf("/components/%d/id", i),
+				Message: fmt.Sprintf("duplicate component id %q (also used by /components/%d)", comp.ID, first),
+			})
+			continue
+		}
+		ids[comp.ID] = i
+	}
+
+	// Parse folds connections into Wires, so report under the key actually used
+	wiresKey := "wires"
+	var raw map[string]json.RawMessage
+	if json.Unmarshal(data, &raw) == nil {
+		if _, hasWires := raw["wires"]; !hasWires {
+			if _, hasConnections := raw["connections"]; hasConnections {
+				wiresKey = "connections"
+			}
+		}
+	}
+
+	for i, w := range schema.Wires {
+		if _, ok := ids[w.StartComponentID]; !ok {
+			errs = append(errs, jsonschema.Error{
+				Path:    fmt.Sprintf("/%s/%d/startComponentId", wiresKey, i),
+				Message: fmt.Sprintf("unknown component %q", w.StartComponentID),
+			})
+		}
+		if _, ok := ids[w.EndComponentID]; !ok {
+			errs = append(errs, jsonschema.Error{
+				Path:    fmt.Sprintf("/%s/%d/endComponentId", wiresKey, i),
+				Message: fmt.Sprintf("unknown component %q", w.EndComponentID),
+			})
+		}
+	}
+
+	return errs
+}
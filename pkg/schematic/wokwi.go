@@ -0,0 +1,356 @@
+package schematic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ============================================
+// Wokwi diagram.json Conversion
+// ============================================
+
+// WokwiPart is a part entry in a Wokwi diagram
+type WokwiPart struct {
+	Type   string                 `json:"type"`
+	ID     string                 `json:"id"`
+	Top    float64                `json:"top"`
+	Left   float64                `json:"left"`
+	Rotate float64                `json:"rotate,omitempty"`
+	Attrs  map[string]interface{} `json:"attrs"`
+}
+
+// WokwiDiagram is the root of a Wokwi diagram.json file
+type WokwiDiagram struct {
+	Version      int                    `json:"version"`
+	Author       string                 `json:"author,omitempty"`
+	Editor       string                 `json:"editor"`
+	Parts        []WokwiPart            `json:"parts"`
+	Connections  [][]interface{}        `json:"connections"`
+	Dependencies map[string]interface{} `json:"dependencies"`
+}
+
+// UnknownPart reports a part that could not be converted
+type UnknownPart struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// ConversionReport lists everything dropped during a conversion
+type ConversionReport struct {
+	UnknownParts       []UnknownPart `json:"unknown_parts"`
+	SkippedConnections []string      `json:"skipped_connections"`
+}
+
+// HasIssues returns true when anything was dropped
+func (r *ConversionReport) HasIssues() bool {
+	return len(r.UnknownParts) > 0 || len(r.SkippedConnections) > 0
+}
+
+// wokwiPartMapping links a Wokwi part type to our simulation model type
+type wokwiPartMapping struct {
+	WokwiType string
+	ModelType string
+	// Pin names: Wokwi pin -> our pin. Unlisted pins pass through unchanged.
+	Pins map[string]string
+}
+
+// arduinoPins normalizes numeric Arduino pins ("13") to our "D13" naming
+func arduinoPins(digital int) map[string]string {
+	pins := map[string]string{}
+	for i := 0; i < digital; i++ {
+		pins[strconv.Itoa(i)] = fmt.Sprintf("D%d", i)
+	}
+	pins["GND.1"] = "GND"
+	return pins
+}
+
+var wokwiPartMappings = []wokwiPartMapping{
+	// Microcontrollers
+	{WokwiType: "wokwi-arduino-uno", ModelType: "arduino_uno", Pins: arduinoPins(14)},
+	{WokwiType: "wokwi-arduino-mega", ModelType: "arduino_mega", Pins: arduinoPins(54)},
+	{WokwiType: "wokwi-arduino-nano", ModelType: "arduino_nano", Pins: arduinoPins(14)},
+	{WokwiType: "wokwi-esp32-devkit-v1", ModelType: "esp32", Pins: map[string]string{"GND.1": "GND"}},
+	{WokwiType: "board-esp32-devkit-c-v4", ModelType: "esp32", Pins: map[string]string{"GND.1": "GND"}},
+
+	// Passive / basic
+	{WokwiType: "wokwi-led", ModelType: "led", Pins: map[string]string{"A": "anode", "C": "cathode"}},
+	{WokwiType: "wokwi-resistor", ModelType: "resistor", Pins: map[string]string{"1": "p1", "2": "p2"}},
+	{WokwiType: "wokwi-potentiometer", ModelType: "potentiometer", Pins: map[string]string{"VCC": "p1", "SIG": "wiper", "GND": "p2"}},
+	{WokwiType: "wokwi-pushbutton", ModelType: "push_button", Pins: map[string]string{"1.l": "p1", "1.r": "p1", "2.l": "p2", "2.r": "p2"}},
+	{WokwiType: "wokwi-slide-switch", ModelType: "switch", Pins: map[string]string{"1": "p1", "2": "common", "3": "p2"}},
+
+	// Sensors
+	{WokwiType: "wokwi-dht22", ModelType: "dht22", Pins: map[string]string{"VCC": "vcc", "SDA": "data", "NC": "nc", "GND": "gnd"}},
+	{WokwiType: "wokwi-hc-sr04", ModelType: "ultrasonic", Pins: map[string]string{"VCC": "vcc", "TRIG": "trig", "ECHO": "echo", "GND": "gnd"}},
+	{WokwiType: "wokwi-photoresistor-sensor", ModelType: "ldr", Pins: map[string]string{"VCC": "vcc", "GND": "gnd", "AO": "ao", "DO": "do"}},
+
+	// Actuators / display
+	{WokwiType: "wokwi-buzzer", ModelType: "buzzer", Pins: map[string]string{"1": "negative", "2": "positive"}},
+	{WokwiType: "wokwi-servo", ModelType: "servo", Pins: map[string]string{"V+": "vcc", "GND": "gnd", "PWM": "signal"}},
+	{WokwiType: "wokwi-relay-module", ModelType: "relay", Pins: map[string]string{"VCC": "vcc", "GND": "gnd", "IN": "in", "NO": "no", "NC": "nc", "COM": "com"}},
+	{WokwiType: "wokwi-lcd1602", ModelType: "lcd_16x2"},
+}
+
+// wokwiColors maps Wokwi LED color names to the hex values our editor uses
+var wokwiColors = map[string]string{
+	"red":    "#ff0000",
+	"green":  "#00ff00",
+	"blue":   "#0000ff",
+	"yellow": "#ffff00",
+	"orange": "#ffa500",
+	"white":  "#ffffff",
+	"purple": "#800080",
+}
+
+func findWokwiMappingByWokwiType(wokwiType string) *wokwiPartMapping {
+	for i := range wokwiPartMappings {
+		if wokwiPartMappings[i].WokwiType == wokwiType {
+			return &wokwiPartMappings[i]
+		}
+	}
+	return nil
+}
+
+func findWokwiMappingByModelType(modelType string) *wokwiPartMapping {
+	for i := range wokwiPartMappings {
+		if wokwiPartMappings[i].ModelType == modelType {
+			return &wokwiPartMappings[i]
+		}
+	}
+	return nil
+}
+
+// WokwiModelTypes returns every model type the converter understands
+func WokwiModelTypes() []string {
+	seen := map[string]bool{}
+	types := []string{}
+	for _, m := range wokwiPartMappings {
+		if !seen[m.ModelType] {
+			seen[m.ModelType] = true
+			types = append(types, m.ModelType)
+		}
+	}
+	return types
+}
+
+// FromWokwi converts a Wokwi diagram.json document into our schema
+func FromWokwi(data []byte) (*Schema, *ConversionReport, error) {
+	var diagram WokwiDiagram
+	if err := json.Unmarshal(data, &diagram); err != nil {
+		return nil, nil, fmt.Errorf("invalid diagram.json: %w", err)
+	}
+	if len(diagram.Parts) == 0 {
+		return nil, nil, fmt.Errorf("invalid diagram.json: no parts")
+	}
+
+	schema := &Schema{Components: []Component{}, Wires: []Wire{}}
+	report := &ConversionReport{UnknownParts: []UnknownPart{}, SkippedConnections: []string{}}
+	mappings := map[string]*wokwiPartMapping{}
+
+	for _, part := range diagram.Parts {
+		mapping := findWokwiMappingByWokwiType(part.Type)
+		if mapping == nil {
+			report.UnknownParts = append(report.UnknownParts, UnknownPart{ID: part.ID, Type: part.Type})
+			continue
+		}
+		mappings[part.ID] = mapping
+
+		schema.Components = append(schema.Components, Component{
+			ID:         part.ID,
+			Type:       mapping.ModelType,
+			Name:       strings.ToUpper(part.ID),
+			Position:   Position{X: part.Left, Y: part.Top},
+			Rotation:   part.Rotate,
+			Properties: wokwiAttrsToProperties(mapping.ModelType, part.Attrs),
+		})
+	}
+
+	for i, conn := range diagram.Connections {
+		if len(conn) < 2 {
+			continue
+		}
+		from, _ := conn[0].(string)
+		to, _ := conn[1].(string)
+		fromPart, fromPin, okFrom := splitWokwiEndpoint(from)
+		toPart, toPin, okTo := splitWokwiEndpoint(to)
+
+		fromMapping, knownFrom := mappings[fromPart]
+		toMapping, knownTo := mappings[toPart]
+		if !okFrom || !okTo || !knownFrom || !knownTo {
+			report.SkippedConnections = append(report.SkippedConnections, fmt.Sprintf("%s -> %s", from, to))
+			continue
+		}
+
+		wire := Wire{
+			ID:               fmt.Sprintf("w%d", i+1),
+			StartComponentID: fromPart,
+			StartPinID:       fromMapping.ourPin(fromPin),
+			EndComponentID:   toPart,
+			EndPinID:         toMapping.ourPin(toPin),
+		}
+		if len(conn) > 2 {
+			wire.Color, _ = conn[2].(string)
+		}
+		schema.Wires = append(schema.Wires, wire)
+	}
+
+	return schema, report, nil
+}
+
+// ToWokwi converts our schema into a Wokwi diagram.json document
+func ToWokwi(schema *Schema, author string) ([]byte, *ConversionReport, error) {
+	diagram := WokwiDiagram{
+		Version:      1,
+		Author:       author,
+		Editor:       "wokwi",
+		Parts:        []WokwiPart{},
+		Connections:  [][]interface{}{},
+		Dependencies: map[string]interface{}{},
+	}
+	report := &ConversionReport{UnknownParts: []UnknownPart{}, SkippedConnections: []string{}}
+	mappings := map[string]*wokwiPartMapping{}
+
+	for _, comp := range schema.Components {
+		mapping := findWokwiMappingByModelType(comp.Type)
+		if mapping == nil {
+			report.UnknownParts = append(report.UnknownParts, UnknownPart{ID: comp.ID, Type: comp.Type})
+			continue
+		}
+		mappings[comp.ID] = mapping
+
+		diagram.Parts = append(diagram.Parts, WokwiPart{
+			Type:   mapping.WokwiType,
+			ID:     comp.ID,
+			Top:    comp.Position.Y,
+			Left:   comp.Position.X,
+			Rotate: comp.Rotation,
+			Attrs:  propertiesToWokwiAttrs(comp.Type, comp.Properties),
+		})
+	}
+
+	for _, wire := range schema.Wires {
+		startMapping, okStart := mappings[wire.StartComponentID]
+		endMapping, okEnd := mappings[wire.EndComponentID]
+		if !okStart || !okEnd {
+			report.SkippedConnections = append(report.SkippedConnections, wire.ID)
+			continue
+		}
+
+		color := wire.Color
+		if color == "" {
+			color = "green"
+		}
+		diagram.Connections = append(diagram.Connections, []interface{}{
+			wire.StartComponentID + ":" + startMapping.wokwiPin(wire.StartPinID),
+			wire.EndComponentID + ":" + endMapping.wokwiPin(wire.EndPinID),
+			color,
+			[]string{},
+		})
+	}
+
+	content, err := json.MarshalIndent(diagram, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, report, nil
+}
+
+// ============================================
+// Helper Functions
+// ============================================
+
+func (m *wokwiPartMapping) ourPin(wokwiPin string) string {
+	// Numbered duplicates such as "GND.1" collapse to the base pin
+	if base, suffix, found := strings.Cut(wokwiPin, "."); found && m.Pins[wokwiPin] == "" {
+		if _, err := strconv.Atoi(suffix); err == nil {
+			wokwiPin = base
+		}
+	}
+	if pin, ok := m.Pins[wokwiPin]; ok {
+		return pin
+	}
+	return wokwiPin
+}
+
+func (m *wokwiPartMapping) wokwiPin(ourPin string) string {
+	// Prefer the shortest Wokwi name so "p1" maps to "1" rather than "1.l"
+	best := ""
+	for wokwiPin, pin := range m.Pins {
+		if pin == ourPin && (best == "" || len(wokwiPin) < len(best) || (len(wokwiPin) == len(best) && wokwiPin < best)) {
+			best = wokwiPin
+		}
+	}
+	if best != "" {
+		return best
+	}
+	return ourPin
+}
+
+func splitWokwiEndpoint(endpoint string) (part, pin string, ok bool) {
+	part, pin, ok = strings.Cut(endpoint, ":")
+	return part, pin, ok && part != "" && pin != ""
+}
+
+func wokwiAttrsToProperties(modelType string, attrs map[string]interface{}) map[string]interface{} {
+	props := map[string]interface{}{}
+	for k, v := range attrs {
+		props[k] = v
+	}
+
+	switch modelType {
+	case "led":
+		if color, ok := attrs["color"].(string); ok {
+			if hex, ok := wokwiColors[color]; ok {
+				props["color"] = hex
+			}
+		}
+	case "resistor", "potentiometer":
+		if value, ok := attrs["value"].(string); ok {
+			if r, ok := ParseValue(value); ok {
+				props["resistance"] = r
+				delete(props, "value")
+			}
+		}
+	case "dht22":
+		for _, key := range []string{"temperature", "humidity"} {
+			if value, ok := attrs[key].(string); ok {
+				if f, err := strconv.ParseFloat(value, 64); err == nil {
+					props[key] = f
+				}
+			}
+		}
+	}
+
+	return props
+}
+
+func propertiesToWokwiAttrs(modelType string, props map[string]interface{}) map[string]interface{} {
+	attrs := map[string]interface{}{}
+
+	switch modelType {
+	case "led":
+		if color, ok := props["color"].(string); ok {
+			attrs["color"] = color
+			for name, hex := range wokwiColors {
+				if strings.EqualFold(hex, color) {
+					attrs["color"] = name
+				}
+			}
+		}
+	case "resistor", "potentiometer":
+		c := Component{Properties: props}
+		if r, ok := c.Float("resistance"); ok {
+			attrs["value"] = strconv.FormatFloat(r, 'f', -1, 64)
+		}
+	case "dht22":
+		for _, key := range []string{"temperature", "humidity"} {
+			if v, ok := props[key].(float64); ok {
+				attrs[key] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	}
+
+	return attrs
+}
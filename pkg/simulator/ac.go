@@ -0,0 +1,560 @@
+package simulator
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// AC Small-Signal Analysis
+// ============================================
+
+// Frequency sweep spacings
+const (
+	SweepLinear = "lin"
+	SweepDecade = "dec"
+	SweepOctave = "oct"
+)
+
+// Shapes of a frequency response
+const (
+	ResponseLowPass  = "low_pass"
+	ResponseHighPass = "high_pass"
+	ResponseBandPass = "band_pass"
+	ResponseBandStop = "band_stop"
+	ResponseFlat     = "flat"
+)
+
+const (
+	// MaxACPoints bounds the frequencies of a single sweep
+	MaxACPoints       = 2000
+	defaultACStart    = 10
+	defaultACStop     = 100e3
+	defaultACPerDec   = 20
+	defaultACLinear   = 100
+	cutoffDB          = 3.0103 // half power
+	minMagnitude      = 1e-15
+	minMagnitudeDB    = -300
+	fullTurnDegrees   = 360.0
+	halfTurnDegrees   = 180.0
+	defaultACSweep    = SweepDecade
+	acSourceAmplitude = 1
+)
+
+// ACOptions configures an AC sweep. Zero values sweep 10 Hz to 100 kHz at
+// 20 points per decade, driven by the first sine source (or the first
+// voltage source) and probed at every probe component, or every net.
+type ACOptions struct {
+	Source string   `json:"source"` // component ID or name
+	Sweep  string   `json:"sweep"`
+	Start  float64  `json:"start"`
+	Stop   float64  `json:"stop"`
+	Points int      `json:"points"` // per decade/octave, or in total for lin
+	Probes []string `json:"probes"`
+}
+
+// BodeTrace is the response at one probe relative to the source. Magnitude
+// is the linear gain, Phase is unwrapped and in degrees.
+type BodeTrace struct {
+	Name          string    `json:"name"`
+	ComponentID   string    `json:"component_id,omitempty"`
+	Pins          []string  `json:"pins,omitempty"`
+	Response      string    `json:"response"`
+	PeakDB        float64   `json:"peak_db"`
+	PeakFrequency float64   `json:"peak_frequency"`
+	Cutoffs       []float64 `json:"cutoffs"` // where the gain crosses 3 dB below the peak
+	Magnitude     []float64 `json:"magnitude"`
+	MagnitudeDB   []float64 `json:"magnitude_db"`
+	Phase         []float64 `json:"phase"`
+}
+
+// ACResult is the frequency response of a circuit
+type ACResult struct {
+	Converged bool        `json:"converged"`
+	Source    string      `json:"source"`
+	Sweep     string      `json:"sweep"`
+	Start     float64     `json:"start"`
+	Stop      float64     `json:"stop"`
+	Points    int         `json:"points"`
+	Frequency []float64   `json:"frequency"`
+	Traces    []BodeTrace `json:"traces"`
+	Errors    []Issue     `json:"errors"`
+	Warnings  []Issue     `json:"warnings"`
+}
+
+// Works returns true when the sweep completed without errors
+func (ac *ACResult) Works() bool {
+	return ac.Converged && len(ac.Errors) == 0
+}
+
+// AnalyzeAC runs an AC sweep of a schema
+func AnalyzeAC(schema *schematic.Schema, opts ACOptions) *ACResult {
+	return Build(schema).AC(opts)
+}
+
+// acReactive is implemented by devices whose admittance depends on frequency
+type acReactive interface {
+	stampAC(s *acSystem, omega float64)
+}
+
+// probePoint is where a trace is measured: V(pos) - V(neg)
+type probePoint struct {
+	trace    BodeTrace
+	pos, neg int
+}
+
+// AC linearizes the circuit around its operating point and sweeps the
+// frequency of a 1 V source, measuring gain and phase at the probes
+func (c *Circuit) AC(opts ACOptions) *ACResult {
+	is := issues{
+		Errors:   append([]Issue{}, c.issues.Errors...),
+		Warnings: append([]Issue{}, c.issues.Warnings...),
+	}
+	opts = acDefaults(opts)
+	ac := &ACResult{
+		Sweep:     opts.Sweep,
+		Start:     opts.Start,
+		Stop:      opts.Stop,
+		Points:    opts.Points,
+		Frequency: []float64{},
+		Traces:    []BodeTrace{},
+	}
+	defer func() {
+		ac.Errors, ac.Warnings = is.Errors, is.Warnings
+	}()
+
+	if len(c.devices) == 0 {
+		is.errorf("", IssueEmptyCircuit, "The circuit has no components to simulate")
+		return ac
+	}
+	source := c.acSource(opts.Source)
+	if source == nil {
+		if opts.Source != "" {
+			is.errorf("", IssueNoACSource, "AC source %q is not a voltage source in this circuit", opts.Source)
+		} else {
+			is.errorf("", IssueNoACSource, "The circuit has no voltage source to drive the AC sweep")
+		}
+		return ac
+	}
+	ac.Source = source.comp.ID
+
+	x, _, err := c.solveOperatingPoint()
+	switch {
+	case errors.Is(err, errSingular):
+		is.errorf("", IssueSingularMatrix, "The circuit has no unique solution; look for voltage sources wired in parallel or in a loop")
+		return ac
+	case err != nil:
+		is.errorf("", IssueNotConverged, "The operating point for the AC sweep did not converge")
+		return ac
+	}
+
+	// The Jacobian at the operating point with the sources zeroed is the
+	// small-signal circuit; reactive devices add their admittance per frequency
+	linear := newSystem(c.nodes, c.branches)
+	ctx := stampContext{x: x}
+	for _, dev := range c.devices {
+		dev.stamp(linear, &ctx)
+	}
+	for node := 1; node <= c.nodes; node++ {
+		linear.stampConductance(node, 0, gmin)
+	}
+
+	points := c.probePoints(opts.Probes, &is)
+	frequencies := sweepFrequencies(opts)
+	phasors := make([][]complex128, len(points))
+	progress := newProgressTracker(c.progress)
+	for k, f := range frequencies {
+		if err := c.ctx.Err(); err != nil {
+			is.errorf("", IssueCancelled, "%s at %s", cancelMessage(err), schematic.FormatValue(f, "Hz"))
+			return ac
+		}
+		omega := 2 * math.Pi * f
+		s := newACSystem(linear)
+		for _, dev := range c.devices {
+			if r, ok := dev.(acReactive); ok {
+				r.stampAC(s, omega)
+			}
+		}
+		source.excite(s, acSourceAmplitude)
+
+		solution, err := s.solve()
+		if err != nil {
+			is.errorf("", IssueSingularMatrix, "The small-signal circuit has no unique solution at %s", schematic.FormatValue(f, "Hz"))
+			return ac
+		}
+		for i, p := range points {
+			phasors[i] = append(phasors[i], phasorAt(solution, p.pos)-phasorAt(solution, p.neg))
+		}
+		if done := float64(k+1) / float64(len(frequencies)); progress.due(done) {
+			progress.send(done, 0, nil, &is)
+		}
+	}
+
+	for _, f := range frequencies {
+		ac.Frequency = append(ac.Frequency, round(f))
+	}
+	for i, p := range points {
+		ac.Traces = append(ac.Traces, bodeTrace(p.trace, frequencies, phasors[i]))
+	}
+	ac.Converged = true
+	return ac
+}
+
+// acDefaults fills in unset sweep options
+func acDefaults(opts ACOptions) ACOptions {
+	if opts.Sweep == "" {
+		opts.Sweep = defaultACSweep
+	}
+	if opts.Start <= 0 {
+		opts.Start = defaultACStart
+	}
+	if opts.Stop <= opts.Start {
+		opts.Stop = math.Max(defaultACStop, opts.Start*1000)
+	}
+	if opts.Points <= 0 {
+		opts.Points = defaultACPerDec
+		if opts.Sweep == SweepLinear {
+			opts.Points = defaultACLinear
+		}
+	}
+	return opts
+}
+
+// sweepFrequencies lists the frequencies of a sweep, both ends included
+func sweepFrequencies(opts ACOptions) []float64 {
+	if opts.Sweep == SweepLinear {
+		if opts.Points == 1 {
+			return []float64{opts.Start}
+		}
+		frequencies := make([]float64, opts.Points)
+		for i := range frequencies {
+			frequencies[i] = opts.Start + float64(i)*(opts.Stop-opts.Start)/float64(opts.Points-1)
+		}
+		return frequencies
+	}
+
+	base := 10.0
+	if opts.Sweep == SweepOctave {
+		base = 2
+	}
+	frequencies := []float64{}
+	for i := 0; ; i++ {
+		f := opts.Start * math.Pow(base, float64(i)/float64(opts.Points))
+		if f >= opts.Stop*(1-1e-9) {
+			break
+		}
+		frequencies = append(frequencies, f)
+	}
+	return append(frequencies, opts.Stop)
+}
+
+// SweepPoints is the number of frequencies a sweep visits
+func SweepPoints(opts ACOptions) int {
+	return len(sweepFrequencies(acDefaults(opts)))
+}
+
+// acSource finds the source that drives the sweep
+func (c *Circuit) acSource(ref string) *voltageSource {
+	var first *voltageSource
+	for _, dev := range c.devices {
+		v, ok := dev.(*voltageSource)
+		if !ok || v.shorted() {
+			continue
+		}
+		if ref != "" {
+			if v.comp.ID == ref || strings.EqualFold(displayName(v.comp), ref) {
+				return v
+			}
+			continue
+		}
+		if v.wave.kind == waveSine {
+			return v
+		}
+		if first == nil {
+			first = v
+		}
+	}
+	return first
+}
+
+// probePoints resolves the probe references of a sweep. A reference is a
+// probe or voltmeter (ID or name), a net name or a pin such as "R1.p2".
+// Without references every probe component is used, or else every net.
+func (c *Circuit) probePoints(refs []string, is *issues) []probePoint {
+	points := []probePoint{}
+	if len(refs) == 0 {
+		for _, dev := range c.devices {
+			if p, ok := c.probeDevice(dev); ok {
+				points = append(points, p)
+			}
+		}
+		if len(points) > 0 {
+			return points
+		}
+		for node, net := range c.netlist.Nets {
+			if node != 0 && len(net.Pins) > 0 {
+				points = append(points, c.netProbe(node))
+			}
+		}
+		return points
+	}
+
+	for _, ref := range refs {
+		if p, ok := c.resolveProbe(ref); ok {
+			points = append(points, p)
+			continue
+		}
+		is.warnf("", IssueUnknownProbe, "Probe %q matches no probe, net or pin and was skipped", ref)
+	}
+	return points
+}
+
+func (c *Circuit) resolveProbe(ref string) (probePoint, bool) {
+	for _, dev := range c.devices {
+		comp := dev.component()
+		if comp.ID == ref || strings.EqualFold(displayName(*comp), ref) {
+			return c.probeDevice(dev)
+		}
+	}
+	for node, net := range c.netlist.Nets {
+		if node == 0 || len(net.Pins) == 0 {
+			continue
+		}
+		if strings.EqualFold(net.Name, ref) {
+			return c.netProbe(node), true
+		}
+		for _, pin := range net.Pins {
+			if strings.EqualFold(pin, ref) {
+				return c.netProbe(node), true
+			}
+		}
+	}
+	return probePoint{}, false
+}
+
+func (c *Circuit) probeDevice(dev device) (probePoint, bool) {
+	comp := dev.component()
+	trace := BodeTrace{Name: "V(" + displayName(*comp) + ")", ComponentID: comp.ID}
+	switch d := dev.(type) {
+	case *probe:
+		if d.node >= 0 {
+			return probePoint{trace: trace, pos: d.node}, true
+		}
+	case *meter:
+		if !d.series {
+			return probePoint{trace: trace, pos: d.pos, neg: d.neg}, true
+		}
+	}
+	return probePoint{}, false
+}
+
+func (c *Circuit) netProbe(node int) probePoint {
+	net := c.netlist.Nets[node]
+	return probePoint{trace: BodeTrace{Name: "V(" + net.Name + ")", Pins: net.Pins}, pos: node}
+}
+
+// excite drives the source with an AC amplitude
+func (v *voltageSource) excite(s *acSystem, amplitude float64) {
+	if v.internal > 0 {
+		s.addZ(s.row(v.pos), complex(amplitude/v.internal, 0))
+		s.addZ(s.row(v.neg), complex(-amplitude/v.internal, 0))
+		return
+	}
+	s.addZ(v.branch, complex(amplitude, 0))
+}
+
+func (c *capacitor) stampAC(s *acSystem, omega float64) {
+	s.stampAdmittance(c.a, c.b, complex(0, omega*c.capacitance))
+}
+
+// stampAC turns the DC short into V(a)-V(b) = jωL·i
+func (l *inductor) stampAC(s *acSystem, omega float64) {
+	s.add(l.branch, l.branch, complex(0, -omega*l.inductance))
+}
+
+// bodeTrace converts the phasors of a probe into gain and phase and
+// classifies the response
+func bodeTrace(trace BodeTrace, frequencies []float64, phasors []complex128) BodeTrace {
+	n := len(phasors)
+	trace.Magnitude = make([]float64, n)
+	trace.MagnitudeDB = make([]float64, n)
+	trace.Phase = make([]float64, n)
+	trace.Cutoffs = []float64{}
+
+	db := make([]float64, n)
+	offset, previous := 0.0, 0.0
+	for i, p := range phasors {
+		magnitude := cmplx.Abs(p)
+		db[i] = minMagnitudeDB
+		if magnitude > minMagnitude {
+			db[i] = 20 * math.Log10(magnitude)
+		}
+
+		// Unwrap the phase so it runs continuously across the sweep
+		phase := cmplx.Phase(p) * halfTurnDegrees / math.Pi
+		if i > 0 {
+			for phase+offset-previous > halfTurnDegrees {
+				offset -= fullTurnDegrees
+			}
+			for phase+offset-previous < -halfTurnDegrees {
+				offset += fullTurnDegrees
+			}
+		}
+		previous = phase + offset
+
+		trace.Magnitude[i] = round(magnitude)
+		trace.MagnitudeDB[i] = round(db[i])
+		trace.Phase[i] = round(previous)
+	}
+	if n == 0 {
+		trace.Response = ResponseFlat
+		return trace
+	}
+
+	peak, valley := 0, 0
+	for i := range db {
+		if db[i] > db[peak] {
+			peak = i
+		}
+		if db[i] < db[valley] {
+			valley = i
+		}
+	}
+	trace.PeakDB, trace.PeakFrequency = round(db[peak]), round(frequencies[peak])
+
+	level := db[peak] - cutoffDB
+	for i := 1; i < n; i++ {
+		if (db[i-1] >= level) != (db[i] >= level) {
+			// Interpolate on a log frequency axis
+			t := (level - db[i-1]) / (db[i] - db[i-1])
+			f := math.Exp(math.Log(frequencies[i-1]) + t*(math.Log(frequencies[i])-math.Log(frequencies[i-1])))
+			trace.Cutoffs = append(trace.Cutoffs, round(f))
+		}
+	}
+
+	first, last := db[0], db[n-1]
+	switch {
+	case len(trace.Cutoffs) == 0:
+		trace.Response = ResponseFlat
+	case first >= level && last < level:
+		trace.Response = ResponseLowPass
+	case first < level && last >= level:
+		trace.Response = ResponseHighPass
+	case first < level && last < level:
+		trace.Response = ResponseBandPass
+	case valley > 0 && valley < n-1:
+		trace.Response = ResponseBandStop
+	default:
+		trace.Response = ResponseFlat
+	}
+	return trace
+}
+
+// ============================================
+// Complex MNA System
+// ============================================
+
+// acSystem is the small-signal MNA system at one frequency, indexed like system
+type acSystem struct {
+	A [][]complex128
+	z []complex128
+}
+
+// newACSystem starts from the real small-signal equations
+func newACSystem(linear *system) *acSystem {
+	n := linear.size()
+	s := &acSystem{A: make([][]complex128, n), z: make([]complex128, n)}
+	for i := range s.A {
+		s.A[i] = make([]complex128, n)
+		for j, v := range linear.A[i] {
+			s.A[i][j] = complex(v, 0)
+		}
+	}
+	return s
+}
+
+func (s *acSystem) row(node int) int {
+	return node - 1
+}
+
+func (s *acSystem) add(r, c int, v complex128) {
+	if r >= 0 && c >= 0 {
+		s.A[r][c] += v
+	}
+}
+
+func (s *acSystem) addZ(r int, v complex128) {
+	if r >= 0 {
+		s.z[r] += v
+	}
+}
+
+// stampAdmittance connects nodes a and b through admittance y
+func (s *acSystem) stampAdmittance(a, b int, y complex128) {
+	ra, rb := s.row(a), s.row(b)
+	s.add(ra, ra, y)
+	s.add(rb, rb, y)
+	s.add(ra, rb, -y)
+	s.add(rb, ra, -y)
+}
+
+// solve uses LU decomposition with partial pivoting, like system.solve
+func (s *acSystem) solve() ([]complex128, error) {
+	n := len(s.z)
+	a := make([][]complex128, n)
+	for i := range a {
+		a[i] = append([]complex128(nil), s.A[i]...)
+	}
+	x := append([]complex128(nil), s.z...)
+
+	for k := 0; k < n; k++ {
+		pivot, best := k, cmplx.Abs(a[k][k])
+		for i := k + 1; i < n; i++ {
+			if v := cmplx.Abs(a[i][k]); v > best {
+				pivot, best = i, v
+			}
+		}
+		if best < 1e-18 {
+			return nil, errSingular
+		}
+		a[k], a[pivot] = a[pivot], a[k]
+		x[k], x[pivot] = x[pivot], x[k]
+
+		for i := k + 1; i < n; i++ {
+			f := a[i][k] / a[k][k]
+			if f == 0 {
+				continue
+			}
+			for j := k; j < n; j++ {
+				a[i][j] -= f * a[k][j]
+			}
+			x[i] -= f * x[k]
+		}
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		sum := x[i]
+		for j := i + 1; j < n; j++ {
+			sum -= a[i][j] * x[j]
+		}
+		x[i] = sum / a[i][i]
+	}
+
+	for _, v := range x {
+		if cmplx.IsNaN(v) || cmplx.IsInf(v) {
+			return nil, errSingular
+		}
+	}
+	return x, nil
+}
+
+func phasorAt(x []complex128, node int) complex128 {
+	if node <= 0 || node > len(x) {
+		return 0
+	}
+	return x[node-1]
+}
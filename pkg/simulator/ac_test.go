@@ -0,0 +1,47 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+)
+
+func TestACLowPassCutoff(t *testing.T) {
+	tests := []struct {
+		name        string
+		resistance  float64
+		capacitance float64
+	}{
+		{"1k 1uF", 1000, 1e-6},
+		{"10k 10nF", 10000, 10e-9},
+		{"4.7k 100nF", 4700, 100e-9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := testSchema(t, []part{
+				{"V1:ac_source", map[string]interface{}{"voltage": 1}},
+				{"R1:resistor", map[string]interface{}{"resistance": tt.resistance}},
+				{"C1:capacitor", map[string]interface{}{"capacitance": tt.capacitance}},
+				{"P1:probe", nil},
+			}, "V1.positive-R1.p1", "R1.p2-C1.p1", "C1.p1-P1.p1", "C1.p2-V1.negative")
+
+			ac := AnalyzeAC(schema, ACOptions{Start: 1, Stop: 1e6, Points: 100, Probes: []string{"P1"}})
+			if !ac.Works() {
+				t.Fatalf("sweep does not work: %v", messages(ac.Errors))
+			}
+			if len(ac.Traces) != 1 {
+				t.Fatalf("got %d traces, want 1", len(ac.Traces))
+			}
+			trace := ac.Traces[0]
+			if trace.Response != ResponseLowPass {
+				t.Errorf("response = %q, want %q", trace.Response, ResponseLowPass)
+			}
+			if len(trace.Cutoffs) != 1 {
+				t.Fatalf("cutoffs = %v, want one", trace.Cutoffs)
+			}
+			// The gain is 3 dB down at f = 1/(2πRC)
+			if want := 1 / (2 * math.Pi * tt.resistance * tt.capacitance); !near(trace.Cutoffs[0], want, 0.01) {
+				t.Errorf("cutoff = %g Hz, want %g Hz", trace.Cutoffs[0], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package simulator
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// ============================================
+// Run Comparison
+// ============================================
+
+const (
+	defaultCompareAbsTol = 1e-3
+	defaultCurrentTol    = 1e-6
+	defaultCompareRelTol = 0.01
+	defaultDeltaPoints   = 200
+	phaseTolerance       = 1.0 // degrees
+)
+
+// Results are the results of a run as stored in its result_data
+type Results struct {
+	Analysis       string           `json:"analysis"`
+	OperatingPoint *OperatingPoint  `json:"operating_point,omitempty"`
+	Transient      *TransientResult `json:"transient,omitempty"`
+	AC             *ACResult        `json:"ac,omitempty"`
+	Digital        *DigitalResult   `json:"digital,omitempty"`
+	Variation      *VariationResult `json:"variation,omitempty"`
+}
+
+// CompareOptions sets when a probe has diverged: when its error exceeds
+// AbsTol, or CurrentTol for currents, plus RelTol times its magnitude.
+// Zero values pick 1 mV, 1 µA and 1%.
+type CompareOptions struct {
+	AbsTol     float64 `json:"abs_tol"`
+	CurrentTol float64 `json:"current_tol"` // A
+	RelTol     float64 `json:"rel_tol"`
+	Points     int     `json:"points"` // samples of the delta waveform
+}
+
+// ValueDelta compares one value of two runs
+type ValueDelta struct {
+	Probe    string  `json:"probe"`
+	Unit     string  `json:"unit"`
+	A        float64 `json:"a"`
+	B        float64 `json:"b"`
+	Delta    float64 `json:"delta"` // b - a
+	Diverged bool    `json:"diverged"`
+}
+
+// SignalDelta compares a signal of two runs over their shared axis, time
+// in seconds or frequency in hertz
+type SignalDelta struct {
+	Probe      string  `json:"probe"`
+	Unit       string  `json:"unit"`
+	MaxError   float64 `json:"max_error"`
+	MaxErrorAt float64 `json:"max_error_at"`
+	RMSError   float64 `json:"rms_error"`
+	Diverged   bool    `json:"diverged"`
+}
+
+// TruthRowDelta is an input vector whose outputs differ between two runs
+type TruthRowDelta struct {
+	Inputs string `json:"inputs"`
+	A      string `json:"a"`
+	B      string `json:"b"`
+}
+
+// Comparison reports how run B differs from run A. MaxError is the error
+// of WorstProbe, the probe furthest beyond its tolerance.
+type Comparison struct {
+	Analysis       string          `json:"analysis"`
+	Diverged       bool            `json:"diverged"`
+	DivergedProbes []string        `json:"diverged_probes"`
+	WorstProbe     string          `json:"worst_probe,omitempty"`
+	MaxError       float64         `json:"max_error"`
+	OperatingPoint []ValueDelta    `json:"operating_point,omitempty"`
+	Waveform       []SignalDelta   `json:"waveform,omitempty"`
+	Deltas         *Waveform       `json:"deltas,omitempty"` // b - a on run A's time axis
+	AC             []SignalDelta   `json:"ac,omitempty"`
+	Digital        []SignalDelta   `json:"digital,omitempty"`
+	TruthTable     []TruthRowDelta `json:"truth_table,omitempty"`
+	Statistics     []ValueDelta    `json:"statistics,omitempty"`
+	OnlyInA        []string        `json:"only_in_a"`
+	OnlyInB        []string        `json:"only_in_b"`
+	Warnings       []Issue         `json:"warnings"`
+
+	opts  CompareOptions
+	worst float64 // error over tolerance of WorstProbe
+}
+
+// Compare aligns the results of two runs and reports their deltas.
+// Analyses only one run has are not compared.
+func Compare(a, b *Results, opts CompareOptions) *Comparison {
+	opts = opts.withDefaults()
+	c := &Comparison{
+		Analysis:       a.Analysis,
+		DivergedProbes: []string{},
+		OnlyInA:        []string{},
+		OnlyInB:        []string{},
+		Warnings:       []Issue{},
+		opts:           opts,
+	}
+	is := issues{Warnings: []Issue{}}
+	if a.Analysis != b.Analysis {
+		is.warnf("", IssueAnalysisMismatch, "Run A is a %s analysis and run B a %s analysis; only the results both have are compared", a.Analysis, b.Analysis)
+	}
+
+	if a.OperatingPoint != nil && b.OperatingPoint != nil {
+		c.compareOperatingPoints(a.OperatingPoint, b.OperatingPoint)
+	}
+	if a.Transient != nil && b.Transient != nil && a.Transient.Waveform != nil && b.Transient.Waveform != nil {
+		c.compareWaveforms(a.Transient.Waveform, b.Transient.Waveform)
+	}
+	if a.AC != nil && b.AC != nil {
+		c.compareAC(a.AC, b.AC)
+	}
+	if a.Digital != nil && b.Digital != nil {
+		c.compareDigital(a.Digital, b.Digital)
+	}
+	if a.Variation != nil && b.Variation != nil {
+		c.compareStatistics(a.Variation, b.Variation)
+	}
+
+	c.Diverged = len(c.DivergedProbes) > 0
+	c.Warnings = is.Warnings
+	return c
+}
+
+// withDefaults fills in the options left at zero
+func (opts CompareOptions) withDefaults() CompareOptions {
+	if opts.AbsTol <= 0 {
+		opts.AbsTol = defaultCompareAbsTol
+	}
+	if opts.CurrentTol <= 0 {
+		opts.CurrentTol = defaultCurrentTol
+	}
+	if opts.RelTol <= 0 {
+		opts.RelTol = defaultCompareRelTol
+	}
+	if opts.Points <= 0 {
+		opts.Points = defaultDeltaPoints
+	}
+	return opts
+}
+
+// tolerance is the error allowed for values of the given unit and magnitude
+func (c *Comparison) tolerance(unit string, magnitude float64) float64 {
+	abs := c.opts.AbsTol
+	if unit == "A" {
+		abs = c.opts.CurrentTol
+	}
+	return abs + c.opts.RelTol*math.Abs(magnitude)
+}
+
+// note records a probe's error against its tolerance
+func (c *Comparison) note(probe string, err, tolerance float64) bool {
+	diverged := err > tolerance
+	if diverged && !slices.Contains(c.DivergedProbes, probe) {
+		c.DivergedProbes = append(c.DivergedProbes, probe)
+	}
+	if ratio := err / tolerance; ratio > c.worst {
+		c.worst, c.WorstProbe, c.MaxError = ratio, probe, round(err)
+	}
+	return diverged
+}
+
+func (c *Comparison) valueDelta(probe, unit string, a, b float64) ValueDelta {
+	delta := b - a
+	diverged := c.note(probe, math.Abs(delta), c.tolerance(unit, math.Max(math.Abs(a), math.Abs(b))))
+	return ValueDelta{Probe: probe, Unit: unit, A: round(a), B: round(b), Delta: round(delta), Diverged: diverged}
+}
+
+// missing notes the names only one side has
+func (c *Comparison) missing(a, b []string) {
+	inA, inB := map[string]bool{}, map[string]bool{}
+	for _, name := range a {
+		inA[name] = true
+	}
+	for _, name := range b {
+		inB[name] = true
+	}
+	for _, name := range a {
+		if !inB[name] {
+			c.OnlyInA = append(c.OnlyInA, name)
+		}
+	}
+	for _, name := range b {
+		if !inA[name] {
+			c.OnlyInB = append(c.OnlyInB, name)
+		}
+	}
+}
+
+// compareOperatingPoints matches nets by name and components by ID
+func (c *Comparison) compareOperatingPoints(a, b *OperatingPoint) {
+	var namesA, namesB []string
+	bNodes := map[string]NodeResult{}
+	for _, node := range b.Nodes {
+		bNodes[node.Name] = node
+		namesB = append(namesB, "V("+node.Name+")")
+	}
+	for _, node := range a.Nodes {
+		namesA = append(namesA, "V("+node.Name+")")
+		if other, ok := bNodes[node.Name]; ok {
+			c.OperatingPoint = append(c.OperatingPoint, c.valueDelta("V("+node.Name+")", "V", node.Voltage, other.Voltage))
+		}
+	}
+
+	bComps := map[string]ComponentResult{}
+	for _, comp := range b.Components {
+		bComps[comp.ID] = comp
+		namesB = append(namesB, "I("+comp.Name+")")
+	}
+	for _, comp := range a.Components {
+		namesA = append(namesA, "I("+comp.Name+")")
+		other, ok := bComps[comp.ID]
+		if !ok {
+			continue
+		}
+		c.OperatingPoint = append(c.OperatingPoint,
+			c.valueDelta("V("+comp.Name+")", "V", comp.Voltage, other.Voltage),
+			c.valueDelta("I("+comp.Name+")", "A", comp.Current, other.Current))
+	}
+	c.missing(namesA, namesB)
+}
+
+// compareWaveforms samples B's signals at A's instants where the runs
+// overlap and measures the error
+func (c *Comparison) compareWaveforms(a, b *Waveform) {
+	var namesA, namesB []string
+	for _, sig := range a.Signals {
+		namesA = append(namesA, sig.Name)
+	}
+	for _, sig := range b.Signals {
+		namesB = append(namesB, sig.Name)
+	}
+	c.missing(namesA, namesB)
+	if len(a.Time) == 0 || len(b.Time) == 0 {
+		return
+	}
+
+	from := math.Max(a.Time[0], b.Time[0])
+	to := math.Min(a.Time[len(a.Time)-1], b.Time[len(b.Time)-1])
+	deltas := &Waveform{Time: []float64{}, Signals: []Signal{}}
+	for _, t := range a.Time {
+		if t >= from && t <= to {
+			deltas.Time = append(deltas.Time, t)
+		}
+	}
+
+	for _, sigA := range a.Signals {
+		sigB := b.Signal(sigA.Name)
+		if sigB == nil {
+			continue
+		}
+		d := Signal{Name: sigA.Name, Unit: sigA.Unit, ComponentID: sigA.ComponentID, Values: []float64{}}
+		sd := SignalDelta{Probe: sigA.Name, Unit: sigA.Unit}
+		sum, peak := 0.0, 0.0
+		for k, t := range a.Time {
+			if t < from || t > to {
+				continue
+			}
+			va, vb := sigA.Values[k], interpolate(b.Time, sigB.Values, t)
+			err := math.Abs(vb - va)
+			if err > sd.MaxError {
+				sd.MaxError, sd.MaxErrorAt = err, t
+			}
+			sum += err * err
+			peak = math.Max(peak, math.Max(math.Abs(va), math.Abs(vb)))
+			d.Values = append(d.Values, vb-va)
+		}
+		if len(d.Values) > 0 {
+			sd.RMSError = round(math.Sqrt(sum / float64(len(d.Values))))
+		}
+		sd.MaxError, sd.MaxErrorAt = round(sd.MaxError), round(sd.MaxErrorAt)
+		sd.Diverged = c.note(sigA.Name, sd.MaxError, c.tolerance(sigA.Unit, peak))
+		c.Waveform = append(c.Waveform, sd)
+		deltas.Signals = append(deltas.Signals, d)
+	}
+	if len(deltas.Signals) > 0 {
+		deltas.finalize()
+		c.Deltas = deltas.Downsample(c.opts.Points)
+	}
+}
+
+// interpolate reads values at t from a non-decreasing axis
+func interpolate(axis, values []float64, t float64) float64 {
+	k := sort.Search(len(axis), func(i int) bool { return axis[i] > t })
+	switch {
+	case k == 0:
+		return values[0]
+	case k == len(axis):
+		return values[len(values)-1]
+	}
+	t0, t1 := axis[k-1], axis[k]
+	if t1 == t0 {
+		return values[k]
+	}
+	return values[k-1] + (values[k]-values[k-1])*(t-t0)/(t1-t0)
+}
+
+// compareAC compares the magnitude and phase of each trace over the
+// frequencies both sweeps cover
+func (c *Comparison) compareAC(a, b *ACResult) {
+	var namesA, namesB []string
+	bTraces := map[string]BodeTrace{}
+	for _, tr := range b.Traces {
+		bTraces[tr.Name] = tr
+		namesB = append(namesB, tr.Name)
+	}
+	for _, trA := range a.Traces {
+		namesA = append(namesA, trA.Name)
+		trB, ok := bTraces[trA.Name]
+		if !ok || len(b.Frequency) == 0 {
+			continue
+		}
+		magnitude := SignalDelta{Probe: "|" + trA.Name + "|", Unit: "V/V"}
+		phase := SignalDelta{Probe: "phase(" + trA.Name + ")", Unit: "°"}
+		peak := 0.0
+		for k, f := range a.Frequency {
+			if f < b.Frequency[0] || f > b.Frequency[len(b.Frequency)-1] {
+				continue
+			}
+			ma, mb := trA.Magnitude[k], interpolate(b.Frequency, trB.Magnitude, f)
+			if err := math.Abs(mb - ma); err > magnitude.MaxError {
+				magnitude.MaxError, magnitude.MaxErrorAt = err, f
+			}
+			pa, pb := trA.Phase[k], interpolate(b.Frequency, trB.Phase, f)
+			if err := math.Abs(pb - pa); err > phase.MaxError {
+				phase.MaxError, phase.MaxErrorAt = err, f
+			}
+			peak = math.Max(peak, math.Max(ma, mb))
+		}
+		magnitude.MaxError, phase.MaxError = round(magnitude.MaxError), round(phase.MaxError)
+		magnitude.Diverged = c.note(magnitude.Probe, magnitude.MaxError, c.tolerance(magnitude.Unit, peak))
+		phase.Diverged = c.note(phase.Probe, phase.MaxError, phaseTolerance)
+		c.AC = append(c.AC, magnitude, phase)
+	}
+	c.missing(namesA, namesB)
+}
+
+// compareDigital compares the truth tables row by row and each timing
+// diagram by its first differing change
+func (c *Comparison) compareDigital(a, b *DigitalResult) {
+	if a.TruthTable != nil && b.TruthTable != nil {
+		bRows := map[string]string{}
+		for _, row := range b.TruthTable.Rows {
+			bRows[row.Inputs] = row.Outputs
+		}
+		for _, row := range a.TruthTable.Rows {
+			if outputs, ok := bRows[row.Inputs]; ok && outputs != row.Outputs {
+				c.TruthTable = append(c.TruthTable, TruthRowDelta{Inputs: row.Inputs, A: row.Outputs, B: outputs})
+			}
+		}
+		if len(c.TruthTable) > 0 {
+			c.note("truth_table", float64(len(c.TruthTable)), 0.5)
+		}
+	}
+
+	var namesA, namesB []string
+	bSignals := map[string]LogicSignal{}
+	for _, sig := range b.Signals {
+		bSignals[sig.Name] = sig
+		namesB = append(namesB, sig.Name)
+	}
+	for _, sigA := range a.Signals {
+		namesA = append(namesA, sigA.Name)
+		sigB, ok := bSignals[sigA.Name]
+		if !ok {
+			continue
+		}
+		sd := SignalDelta{Probe: sigA.Name}
+		if at, differs := firstDifference(sigA.Changes, sigB.Changes); differs {
+			sd.MaxError, sd.MaxErrorAt = 1, Seconds(at)
+		}
+		sd.Diverged = c.note(sigA.Name, sd.MaxError, 0.5)
+		c.Digital = append(c.Digital, sd)
+	}
+	c.missing(namesA, namesB)
+}
+
+// firstDifference returns when two timing diagrams first disagree
+func firstDifference(a, b []LogicChange) (int64, bool) {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return min(a[k].T, b[k].T), true
+		}
+	}
+	switch {
+	case len(a) > len(b):
+		return a[len(b)].T, true
+	case len(b) > len(a):
+		return b[len(a)].T, true
+	}
+	return 0, false
+}
+
+// compareStatistics compares the mean and spread of each probe of two
+// sweeps or Monte Carlo runs
+func (c *Comparison) compareStatistics(a, b *VariationResult) {
+	var namesA, namesB []string
+	bStats := map[string]ProbeStatistics{}
+	for _, s := range b.Statistics {
+		bStats[s.Probe] = s
+		namesB = append(namesB, s.Probe)
+	}
+	for _, sA := range a.Statistics {
+		namesA = append(namesA, sA.Probe)
+		sB, ok := bStats[sA.Probe]
+		if !ok {
+			continue
+		}
+		c.Statistics = append(c.Statistics,
+			c.valueDelta("mean("+sA.Probe+")", sA.Unit, sA.Mean, sB.Mean),
+			c.valueDelta("std_dev("+sA.Probe+")", sA.Unit, sA.StdDev, sB.StdDev))
+	}
+	c.missing(namesA, namesB)
+}
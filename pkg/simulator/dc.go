@@ -0,0 +1,311 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// DC Operating Point Analysis
+// ============================================
+
+const (
+	maxNewtonIterations = 150
+	sourceSteps         = 10
+	relTol              = 1e-3
+	voltageAbsTol       = 1e-6
+	currentAbsTol       = 1e-9
+)
+
+var errNotConverged = errors.New("newton iteration did not converge")
+
+// Circuit is a schema compiled into devices over a numbered netlist
+type Circuit struct {
+	netlist  *Netlist
+	devices  []device
+	nodes    int
+	branches int
+	issues   issues // found while building
+	ctx      context.Context
+	progress ProgressFunc
+}
+
+// Build compiles a schema for simulation. Components the simulator does
+// not know are reported as warnings and left out.
+func Build(schema *schematic.Schema) *Circuit {
+	nl := buildNetlist(schema)
+	c := &Circuit{netlist: nl, ctx: context.Background()}
+
+	for _, comp := range schema.Components {
+		dev, known := newDevice(comp, nl)
+		if !known {
+			c.issues.warnf(comp.ID, IssueUnsupportedComponent, "%s (%s) is not simulated and was ignored", displayName(comp), comp.Type)
+			continue
+		}
+		if dev != nil {
+			c.devices = append(c.devices, dev)
+		}
+		if m, ok := dev.(*mcu); ok && m.sketch != nil && m.sketch.compileErr != nil {
+			c.issues.errorf(comp.ID, IssueSketchError, "The sketch on %s does not compile: %s", displayName(comp), m.sketch.compileErr.Error())
+		}
+	}
+
+	// Devices may add nets for unwired terminals, so number branches last
+	c.nodes = nl.nodeCount()
+	for _, dev := range c.devices {
+		dev.setBranch(c.nodes + c.branches)
+		c.branches += dev.branchCount()
+	}
+	return c
+}
+
+// WithContext makes the time-domain and frequency analyses stop with a
+// "cancelled" error once ctx is done
+func (c *Circuit) WithContext(ctx context.Context) *Circuit {
+	c.ctx = ctx
+	return c
+}
+
+// WithProgress has the transient and AC analyses report their progress
+// while they run
+func (c *Circuit) WithProgress(report ProgressFunc) *Circuit {
+	c.progress = report
+	return c
+}
+
+// cancelMessage explains why an analysis stopped early
+func cancelMessage(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "The simulation exceeded its time limit"
+	}
+	return "The simulation was stopped"
+}
+
+// AnalyzeDC computes the DC operating point of a schema
+func AnalyzeDC(schema *schematic.Schema) *OperatingPoint {
+	return Build(schema).OperatingPoint()
+}
+
+// OperatingPoint solves the circuit with capacitors open and inductors shorted
+func (c *Circuit) OperatingPoint() *OperatingPoint {
+	op := &OperatingPoint{
+		Nodes:      []NodeResult{},
+		Components: []ComponentResult{},
+	}
+	is := issues{
+		Errors:   append([]Issue{}, c.issues.Errors...),
+		Warnings: append([]Issue{}, c.issues.Warnings...),
+	}
+	defer func() {
+		op.Sketches = c.sketches()
+		op.Errors, op.Warnings = is.Errors, is.Warnings
+	}()
+
+	if len(c.devices) == 0 {
+		is.errorf("", IssueEmptyCircuit, "The circuit has no components to simulate")
+		return op
+	}
+	if !c.hasSource() {
+		is.errorf("", IssueNoPowerSource, "The circuit has no power source")
+		return op
+	}
+
+	x, iterations, err := c.solveOperatingPoint()
+	op.Iterations = iterations
+	switch {
+	case errors.Is(err, errSingular):
+		is.errorf("", IssueSingularMatrix, "The circuit has no unique solution; look for voltage sources wired in parallel or in a loop")
+		return op
+	case err != nil:
+		is.errorf("", IssueNotConverged, "The simulation did not converge after %d iterations", iterations)
+		return op
+	}
+	op.Converged = true
+
+	c.collect(op, x, &is)
+	return op
+}
+
+// solveOperatingPoint runs Newton-Raphson, falling back to source stepping
+// when the full-scale solve does not converge
+func (c *Circuit) solveOperatingPoint() ([]float64, int, error) {
+	c.reset()
+	x, iterations, err := c.newton(make([]float64, c.nodes+c.branches), stampContext{scale: 1})
+	if !errors.Is(err, errNotConverged) {
+		return x, iterations, err
+	}
+
+	c.reset()
+	x = make([]float64, c.nodes+c.branches)
+	for step := 1; step <= sourceSteps; step++ {
+		var n int
+		x, n, err = c.newton(x, stampContext{scale: float64(step) / sourceSteps})
+		iterations += n
+		if err != nil {
+			return nil, iterations, err
+		}
+	}
+	return x, iterations, nil
+}
+
+func (c *Circuit) reset() {
+	for _, dev := range c.devices {
+		if r, ok := dev.(resetter); ok {
+			r.reset()
+		}
+	}
+}
+
+func (c *Circuit) hasSource() bool {
+	for _, dev := range c.devices {
+		if dev.isSource() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Circuit) isNonlinear() bool {
+	for _, dev := range c.devices {
+		if dev.nonlinear() {
+			return true
+		}
+	}
+	return false
+}
+
+// newton iterates from x until successive solutions agree. env sets the
+// source scale and, for transient steps, the time step and method.
+func (c *Circuit) newton(x []float64, env stampContext) ([]float64, int, error) {
+	sys := newSystem(c.nodes, c.branches)
+	nonlinear := c.isNonlinear()
+
+	for iteration := 1; iteration <= maxNewtonIterations; iteration++ {
+		ctx := env
+		ctx.x, ctx.limited = x, false
+		sys.clear()
+		for _, dev := range c.devices {
+			dev.stamp(sys, &ctx)
+		}
+		for node := 1; node <= c.nodes; node++ {
+			sys.stampConductance(node, 0, gmin)
+		}
+
+		next, err := sys.solve()
+		if err != nil {
+			return nil, iteration, err
+		}
+		if !nonlinear {
+			return next, iteration, nil
+		}
+
+		done := !ctx.limited && iteration > 1 && c.converged(x, next)
+		x = next
+		if done {
+			return x, iteration, nil
+		}
+	}
+	return x, maxNewtonIterations, errNotConverged
+}
+
+// converged compares two successive Newton iterates
+func (c *Circuit) converged(prev, next []float64) bool {
+	for i := range next {
+		absTol := voltageAbsTol
+		if i >= c.nodes {
+			absTol = currentAbsTol
+		}
+		if math.Abs(next[i]-prev[i]) > relTol*math.Max(math.Abs(next[i]), math.Abs(prev[i]))+absTol {
+			return false
+		}
+	}
+	return true
+}
+
+// collect fills the results from a converged solution and runs the checks
+func (c *Circuit) collect(op *OperatingPoint, x []float64, is *issues) {
+	for node, net := range c.netlist.Nets {
+		if len(net.Pins) == 0 {
+			continue
+		}
+		op.Nodes = append(op.Nodes, NodeResult{Name: net.Name, Voltage: round(voltage(x, node)), Pins: net.Pins})
+	}
+
+	for _, dev := range c.devices {
+		res := dev.report(x, 0)
+		dev.check(&res, is)
+		if dev.isSource() && res.Power < 0 {
+			op.PowerDelivered -= res.Power
+		}
+		op.Components = append(op.Components, roundResult(res))
+	}
+	op.PowerDelivered = round(op.PowerDelivered)
+
+	for _, net := range c.floatingNets() {
+		is.warnf("", IssueFloatingNode, "Net %s (%s) has no DC path to ground", net.Name, strings.Join(net.Pins, ", "))
+	}
+	if len(is.Errors) == 0 && op.PowerDelivered <= minWorkingPower {
+		is.warnf("", IssueNoCurrent, "No current flows through the circuit; check for open switches or missing wires")
+	}
+}
+
+// floatingNets lists nets that no DC path connects to ground
+func (c *Circuit) floatingNets() []Net {
+	adjacent := map[int][]int{}
+	used := map[int]bool{}
+	for _, dev := range c.devices {
+		for _, p := range dev.paths() {
+			adjacent[p[0]] = append(adjacent[p[0]], p[1])
+			adjacent[p[1]] = append(adjacent[p[1]], p[0])
+			used[p[0]], used[p[1]] = true, true
+		}
+	}
+
+	reached := map[int]bool{0: true}
+	queue := []int{0}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacent[node] {
+			if !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	floating := []Net{}
+	for node, net := range c.netlist.Nets {
+		if node != 0 && used[node] && !reached[node] {
+			floating = append(floating, net)
+		}
+	}
+	sort.Slice(floating, func(i, j int) bool { return floating[i].Name < floating[j].Name })
+	return floating
+}
+
+// round trims solver noise from reported values
+func round(v float64) float64 {
+	if math.Abs(v) < 1e-12 {
+		return 0
+	}
+	scale := math.Pow(10, 6-math.Ceil(math.Log10(math.Abs(v))))
+	return math.Round(v*scale) / scale
+}
+
+func roundResult(r ComponentResult) ComponentResult {
+	r.Voltage, r.Current, r.Power = round(r.Voltage), round(r.Current), round(r.Power)
+	if r.Brightness != nil {
+		b := math.Round(*r.Brightness*1000) / 1000
+		r.Brightness = &b
+	}
+	for k, v := range r.Terminals {
+		r.Terminals[k] = round(v)
+	}
+	return r
+}
@@ -0,0 +1,150 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// part is a component of a test schema, referenced as "<id>:<type>"
+type part struct {
+	ref   string
+	props map[string]interface{}
+}
+
+// testSchema builds a schema from parts and wires given as
+// "<id>.<pin>-<id>.<pin>"
+func testSchema(t *testing.T, parts []part, wires ...string) *schematic.Schema {
+	t.Helper()
+	schema := &schematic.Schema{Components: []schematic.Component{}, Wires: []schematic.Wire{}}
+	for _, p := range parts {
+		id, typ, ok := strings.Cut(p.ref, ":")
+		if !ok {
+			t.Fatalf("part %q is not <id>:<type>", p.ref)
+		}
+		schema.Components = append(schema.Components, schematic.Component{ID: id, Type: typ, Name: id, Properties: p.props})
+	}
+	for i, w := range wires {
+		start, end, ok := strings.Cut(w, "-")
+		startID, startPin, ok1 := strings.Cut(start, ".")
+		endID, endPin, ok2 := strings.Cut(end, ".")
+		if !ok || !ok1 || !ok2 {
+			t.Fatalf("wire %q is not <id>.<pin>-<id>.<pin>", w)
+		}
+		schema.Wires = append(schema.Wires, schematic.Wire{
+			ID:               fmt.Sprintf("w%d", i+1),
+			StartComponentID: startID,
+			StartPinID:       startPin,
+			EndComponentID:   endID,
+			EndPinID:         endPin,
+		})
+	}
+	return schema
+}
+
+// componentResult finds the result of a component by name
+func componentResult(t *testing.T, op *OperatingPoint, name string) ComponentResult {
+	t.Helper()
+	for _, c := range op.Components {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no result for %s", name)
+	return ComponentResult{}
+}
+
+// near reports whether got is within a relative tolerance of want
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance*math.Abs(want)
+}
+
+func TestOperatingPointDivider(t *testing.T) {
+	tests := []struct {
+		name   string
+		volts  float64
+		r1, r2 float64
+	}{
+		{"equal halves", 10, 1000, 1000},
+		{"5V to 3.3V", 5, 1000, 2000},
+		{"9V battery", 9, 10000, 4700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := testSchema(t, []part{
+				{"V1:power_supply", map[string]interface{}{"voltage": tt.volts}},
+				{"R1:resistor", map[string]interface{}{"resistance": tt.r1}},
+				{"R2:resistor", map[string]interface{}{"resistance": tt.r2}},
+			}, "V1.positive-R1.p1", "R1.p2-R2.p1", "R2.p2-V1.negative")
+
+			op := AnalyzeDC(schema)
+			if !op.Works() {
+				t.Fatalf("divider does not work: %v", op.ErrorMessages())
+			}
+			current := tt.volts / (tt.r1 + tt.r2)
+			if got, want := componentResult(t, op, "R2").Voltage, current*tt.r2; !near(got, want, 1e-3) {
+				t.Errorf("V(R2) = %g, want %g", got, want)
+			}
+			if got := componentResult(t, op, "R1").Current; !near(got, current, 1e-3) {
+				t.Errorf("I(R1) = %g, want %g", got, current)
+			}
+		})
+	}
+}
+
+func TestOperatingPointLED(t *testing.T) {
+	tests := []struct {
+		name       string
+		color      string
+		volts      float64
+		resistance float64
+		reversed   bool
+		wantState  string
+		wantVf     float64 // 0 when the LED does not conduct
+		wantWorks  bool
+	}{
+		{"red from 5V", "red", 5, 220, false, "on", 2.0, true},
+		{"green from 5V", "green", 5, 330, false, "on", 2.2, true},
+		{"blue from 3.3V", "blue", 3.3, 47, false, "on", 3.2, true},
+		{"wired backwards", "red", 5, 220, true, "off", 0, false},
+		{"no series resistor", "red", 5, 0.001, false, "on", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anode, cathode := "D1.anode", "D1.cathode"
+			if tt.reversed {
+				anode, cathode = cathode, anode
+			}
+			schema := testSchema(t, []part{
+				{"V1:power_supply", map[string]interface{}{"voltage": tt.volts}},
+				{"R1:resistor", map[string]interface{}{"resistance": tt.resistance}},
+				{"D1:led", map[string]interface{}{"color": tt.color}},
+			}, "V1.positive-R1.p1", "R1.p2-"+anode, cathode+"-V1.negative")
+
+			op := AnalyzeDC(schema)
+			if !op.Converged {
+				t.Fatalf("did not converge: %v", op.ErrorMessages())
+			}
+			if op.Works() != tt.wantWorks {
+				t.Errorf("Works() = %v, want %v (errors %v)", op.Works(), tt.wantWorks, op.ErrorMessages())
+			}
+			led := componentResult(t, op, "D1")
+			if led.State != tt.wantState {
+				t.Errorf("state = %q, want %q", led.State, tt.wantState)
+			}
+			if tt.wantVf == 0 {
+				return
+			}
+			if !near(led.Voltage, tt.wantVf, 0.1) {
+				t.Errorf("forward voltage = %g, want about %g", led.Voltage, tt.wantVf)
+			}
+			// The resistor takes the rest of the supply at the LED's current
+			if want := (tt.volts - led.Voltage) / tt.resistance; !near(led.Current, want, 1e-3) {
+				t.Errorf("I(D1) = %g, want %g", led.Current, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1391 @@
+package simulator
+
+import (
+	"math"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Device Models
+// ============================================
+
+const (
+	thermalVoltage      = 0.025852 // kT/q at 27°C
+	gmin                = 1e-12    // keeps every node tied to ground
+	switchOnResistance  = 0.05
+	switchOffResistance = 1e9
+)
+
+// Integration methods for transient analysis
+const (
+	MethodTrapezoidal   = "trapezoidal"
+	MethodBackwardEuler = "backward_euler"
+)
+
+// stampContext carries the solver state devices linearize around
+type stampContext struct {
+	x       []float64 // previous iterate
+	scale   float64   // source stepping factor, 1 for a normal solve
+	limited bool      // set by devices that clamped their step
+	dt      float64   // time step; 0 for DC analysis
+	time    float64   // time at the end of the step
+	method  string
+}
+
+// sourceValue evaluates a source waveform at the time being solved
+func (ctx *stampContext) sourceValue(w *sourceWave) float64 {
+	return w.at(ctx.time) * ctx.scale
+}
+
+func (ctx *stampContext) v(node int) float64 {
+	return voltage(ctx.x, node)
+}
+
+// device is an element that stamps itself into the MNA system
+type device interface {
+	component() *schematic.Component
+	// branchCount is the number of branch current unknowns the device needs
+	branchCount() int
+	// setBranch receives the index of its first branch unknown in x
+	setBranch(index int)
+	stamp(s *system, ctx *stampContext)
+	nonlinear() bool
+	// isSource reports whether the device supplies power to the circuit
+	isSource() bool
+	// paths lists terminal pairs joined by a DC path
+	paths() [][2]int
+	report(x []float64, t float64) ComponentResult
+	check(r *ComponentResult, is *issues)
+}
+
+// resetter is implemented by devices that keep state between iterations
+type resetter interface {
+	reset()
+}
+
+// reactive is implemented by devices with state carried between time steps
+type reactive interface {
+	// begin sets the initial state, from the solution x or from rest
+	begin(x []float64, fromRest bool)
+	// accept stores the state of a converged time step
+	accept(x []float64, ctx *stampContext)
+}
+
+// base implements the defaults shared by all devices
+type base struct {
+	comp   schematic.Component
+	branch int
+}
+
+func (b *base) component() *schematic.Component    { return &b.comp }
+func (b *base) branchCount() int                   { return 0 }
+func (b *base) setBranch(index int)                { b.branch = index }
+func (b *base) nonlinear() bool                    { return false }
+func (b *base) isSource() bool                     { return false }
+func (b *base) paths() [][2]int                    { return nil }
+func (b *base) check(*ComponentResult, *issues)    {}
+func (b *base) stamp(s *system, ctx *stampContext) {}
+
+func (b *base) name() string {
+	return displayName(b.comp)
+}
+
+func (b *base) result(v, i float64) ComponentResult {
+	return ComponentResult{
+		ID:      b.comp.ID,
+		Name:    displayName(b.comp),
+		Type:    b.comp.Type,
+		Voltage: v,
+		Current: i,
+		Power:   v * i,
+	}
+}
+
+// Pin name aliases, tried in order
+var (
+	pin1Pins      = []string{"p1", "1", "a", "pin1", "left", "t1", "in"}
+	pin2Pins      = []string{"p2", "2", "b", "pin2", "right", "t2", "out"}
+	positivePins  = []string{"positive", "pos", "+", "vcc", "v+", "anode", "p1", "1"}
+	negativePins  = []string{"negative", "neg", "-", "gnd", "v-", "cathode", "p2", "2"}
+	anodePins     = []string{"anode", "a", "+", "p1", "1"}
+	cathodePins   = []string{"cathode", "k", "c", "-", "p2", "2"}
+	vccPins       = []string{"vcc", "v+", "vdd", "5v", "+", "power"}
+	gndPins       = []string{"gnd", "v-", "vss", "-", "ground"}
+	wiperPins     = []string{"wiper", "w", "sig", "signal", "out"}
+	commonPins    = []string{"common", "com"}
+	collectorPins = []string{"collector", "c"}
+	basePins      = []string{"base", "b"}
+	emitterPins   = []string{"emitter", "e"}
+	probePins     = []string{"p1", "in", "probe", "signal", "pin", "1"}
+)
+
+// voltageSourceTypes are voltage sources with the waveform they default to
+var voltageSourceTypes = map[string]string{
+	"power_source":       waveDC,
+	"power_supply":       waveDC,
+	"battery":            waveDC,
+	"dc_source":          waveDC,
+	"voltage_source":     waveDC,
+	"pwm_source":         wavePulse,
+	"clock":              waveSquare,
+	"function_generator": waveSine,
+	"signal_generator":   waveSine,
+	"ac_source":          waveSine,
+	"sine_source":        waveSine,
+}
+
+// virtualTypes take part in the netlist but are not simulated
+var virtualTypes = map[string]bool{
+	"ground":    true,
+	"gnd":       true,
+	"junction":  true,
+	"label":     true,
+	"net_label": true,
+}
+
+// newDevice builds the model of a component. known is false for
+// component types the simulator does not understand.
+func newDevice(comp schematic.Component, nl *Netlist) (dev device, known bool) {
+	t := deviceType(&comp)
+	b := base{comp: comp}
+
+	switch {
+	case virtualTypes[t]:
+		return nil, true
+	case voltageSourceTypes[t] != "":
+		return newVoltageSource(b, t, nl), true
+	case isMCU(t):
+		return newMCU(b, t, nl), true
+	case timer555Types[t]:
+		return newTimer555(b, nl), true
+	}
+
+	if spec, ok := moduleSpecs[t]; ok && t != "relay" {
+		// Modules with VCC/GND pins; a bare LDR is a plain photoresistor
+		if _, wired := nl.lookup(comp.ID, vccPins); wired || t != "ldr" {
+			return newModule(b, spec, nl), true
+		}
+	}
+
+	switch t {
+	case "sensor":
+		return newSensor(b, nl), true
+	case "current_source":
+		return &currentSource{
+			base: b,
+			pos:  nl.terminal(comp, positivePins),
+			neg:  nl.terminal(comp, negativePins),
+			amps: floatProp(&comp, 0.01, "current"),
+		}, true
+	case "resistor":
+		return newResistor(b, "resistor", nl, math.Max(floatProp(&comp, 1000, "resistance", "value"), 1e-6)), true
+	case "ldr", "photoresistor":
+		r := floatProp(&comp, 10000, "resistance")
+		if lux, ok := comp.Float("lux"); ok {
+			r = ldrResistance(lux)
+		}
+		return newResistor(b, "ldr", nl, r), true
+	case "dc_motor", "motor":
+		return newResistor(b, "motor", nl, floatProp(&comp, 10, "resistance")), true
+	case "buzzer":
+		return newResistor(b, "buzzer", nl, floatProp(&comp, 200, "resistance")), true
+	case "lamp", "bulb", "light_bulb":
+		return newResistor(b, "lamp", nl, floatProp(&comp, 50, "resistance")), true
+	case "voltmeter":
+		return &meter{base: b, pos: nl.terminal(comp, positivePins), neg: nl.terminal(comp, negativePins)}, true
+	case "ammeter":
+		return &meter{base: b, pos: nl.terminal(comp, positivePins), neg: nl.terminal(comp, negativePins), series: true}, true
+	case "probe":
+		node, ok := nl.lookup(comp.ID, probePins)
+		if !ok {
+			node = -1
+		}
+		return &probe{base: b, node: node}, true
+	case "potentiometer":
+		return newPotentiometer(b, nl), true
+	case "capacitor", "electrolytic_capacitor", "capacitor_electrolytic":
+		return newCapacitor(b, t, nl), true
+	case "inductor":
+		return &inductor{
+			base:       b,
+			a:          nl.terminal(comp, pin1Pins),
+			b:          nl.terminal(comp, pin2Pins),
+			inductance: floatProp(&comp, 1e-3, "inductance", "value"),
+			initial:    floatProp(&comp, 0, "initial_current"),
+		}, true
+	case "led", "diode":
+		return newDiode(b, t, nl), true
+	case "npn", "pnp", "transistor", "transistor_npn", "transistor_pnp", "bjt", "bjt_npn", "bjt_pnp":
+		return newBJT(b, t, nl), true
+	case "switch", "slide_switch", "toggle_switch", "push_button", "pushbutton", "button":
+		return newSwitch(b, t, nl), true
+	case "relay":
+		return newRelay(b, nl), true
+	}
+
+	return nil, false
+}
+
+// ============================================
+// Resistive Loads
+// ============================================
+
+// resistor models resistors and loads that behave like one (motors, buzzers, lamps)
+type resistor struct {
+	base
+	a, b         int
+	resistance   float64
+	powerRating  float64 // W, resistors only
+	ratedVoltage float64 // V, loads only
+	kind         string
+}
+
+func newResistor(b base, kind string, nl *Netlist, resistance float64) *resistor {
+	pinsA, pinsB := pin1Pins, pin2Pins
+	if kind == "buzzer" {
+		pinsA, pinsB = positivePins, negativePins
+	}
+	r := &resistor{
+		base:       b,
+		a:          nl.terminal(b.comp, pinsA),
+		b:          nl.terminal(b.comp, pinsB),
+		resistance: resistance,
+		kind:       kind,
+	}
+	switch kind {
+	case "resistor":
+		r.powerRating = floatProp(&b.comp, 0.25, "power_rating")
+	case "motor", "lamp", "buzzer":
+		r.ratedVoltage = floatProp(&b.comp, 5, "rated_voltage", "voltage")
+	}
+	return r
+}
+
+// ldrResistance approximates a GL5528 photoresistor: 10kΩ at 10 lux
+func ldrResistance(lux float64) float64 {
+	if lux < 0.1 {
+		lux = 0.1
+	}
+	return 10000 * math.Pow(lux/10, -0.7)
+}
+
+func (r *resistor) stamp(s *system, _ *stampContext) {
+	s.stampConductance(r.a, r.b, 1/r.resistance)
+}
+
+func (r *resistor) paths() [][2]int {
+	return [][2]int{{r.a, r.b}}
+}
+
+func (r *resistor) report(x []float64, t float64) ComponentResult {
+	v := voltage(x, r.a) - voltage(x, r.b)
+	res := r.result(v, v/r.resistance)
+
+	switch r.kind {
+	case "motor":
+		res.State = onOff(math.Abs(v) >= 0.3*r.ratedVoltage, "running", "stopped")
+	case "buzzer":
+		// Active buzzers only sound with the right polarity
+		res.State = onOff(v >= 0.4*r.ratedVoltage, "sounding", "silent")
+	case "lamp":
+		brightness := math.Min(math.Pow(v/r.ratedVoltage, 2), 1)
+		res.Brightness = &brightness
+		res.State = onOff(brightness > 0.05, "on", "off")
+	}
+	return res
+}
+
+func (r *resistor) check(res *ComponentResult, is *issues) {
+	switch {
+	case r.powerRating > 0 && res.Power > 2*r.powerRating:
+		is.errorf(r.comp.ID, IssueOverpower, "%s dissipates %s, more than twice its %s rating, and would burn out",
+			r.name(), schematic.FormatValue(res.Power, "W"), schematic.FormatValue(r.powerRating, "W"))
+	case r.powerRating > 0 && res.Power > r.powerRating:
+		is.warnf(r.comp.ID, IssueOverpower, "%s dissipates %s, above its %s rating",
+			r.name(), schematic.FormatValue(res.Power, "W"), schematic.FormatValue(r.powerRating, "W"))
+	case r.ratedVoltage > 0 && math.Abs(res.Voltage) > 1.5*r.ratedVoltage:
+		is.warnf(r.comp.ID, IssueOvervoltage, "%s gets %s but is rated for %s",
+			r.name(), schematic.FormatValue(math.Abs(res.Voltage), "V"), schematic.FormatValue(r.ratedVoltage, "V"))
+	}
+}
+
+// potentiometer is two resistors meeting at the wiper
+type potentiometer struct {
+	base
+	a, w, b    int
+	resistance float64
+	position   float64 // 0 = wiper at p2, 1 = wiper at p1
+}
+
+func newPotentiometer(b base, nl *Netlist) *potentiometer {
+	pos := floatProp(&b.comp, 0.5, "position", "wiper", "value")
+	if pos > 1 {
+		pos /= 100 // percent
+	}
+	return &potentiometer{
+		base:       b,
+		a:          nl.terminal(b.comp, pin1Pins),
+		w:          nl.terminal(b.comp, wiperPins),
+		b:          nl.terminal(b.comp, pin2Pins),
+		resistance: floatProp(&b.comp, 10000, "resistance"),
+		position:   math.Min(math.Max(pos, 0), 1),
+	}
+}
+
+// halves returns the p1-wiper and wiper-p2 resistances
+func (p *potentiometer) halves() (float64, float64) {
+	upper := math.Max(p.resistance*(1-p.position), 1e-3)
+	lower := math.Max(p.resistance*p.position, 1e-3)
+	return upper, lower
+}
+
+func (p *potentiometer) stamp(s *system, _ *stampContext) {
+	upper, lower := p.halves()
+	s.stampConductance(p.a, p.w, 1/upper)
+	s.stampConductance(p.w, p.b, 1/lower)
+}
+
+func (p *potentiometer) paths() [][2]int {
+	return [][2]int{{p.a, p.w}, {p.w, p.b}}
+}
+
+func (p *potentiometer) report(x []float64, t float64) ComponentResult {
+	upper, lower := p.halves()
+	va, vw, vb := voltage(x, p.a), voltage(x, p.w), voltage(x, p.b)
+	res := p.result(va-vb, (va-vw)/upper)
+	res.Power = (va-vw)*(va-vw)/upper + (vw-vb)*(vw-vb)/lower
+	res.Terminals = map[string]float64{"p1": va, "wiper": vw, "p2": vb}
+	return res
+}
+
+// ============================================
+// Reactive Elements
+// ============================================
+
+// capacitor is open in DC and a companion model in transient analysis
+type capacitor struct {
+	base
+	a, b          int
+	capacitance   float64
+	voltageRating float64
+	initial       float64 // voltage at rest
+	polarized     bool
+	vPrev, iPrev  float64 // state of the last accepted step
+	current       float64
+}
+
+func newCapacitor(b base, t string, nl *Netlist) *capacitor {
+	polarized := t != "capacitor" || boolProp(&b.comp, "polarized")
+	c := &capacitor{
+		base:          b,
+		capacitance:   floatProp(&b.comp, 1e-6, "capacitance", "value"),
+		voltageRating: floatProp(&b.comp, 0, "voltage_rating", "rated_voltage"),
+		initial:       floatProp(&b.comp, 0, "initial_voltage"),
+		polarized:     polarized,
+	}
+	if polarized {
+		c.a, c.b = nl.terminal(b.comp, positivePins), nl.terminal(b.comp, negativePins)
+	} else {
+		c.a, c.b = nl.terminal(b.comp, pin1Pins), nl.terminal(b.comp, pin2Pins)
+	}
+	return c
+}
+
+// companion returns the conductance and current of the integration
+// companion model: i = geq·v + ieq
+func (c *capacitor) companion(ctx *stampContext) (geq, ieq float64) {
+	if ctx.method == MethodTrapezoidal {
+		geq = 2 * c.capacitance / ctx.dt
+		return geq, -geq*c.vPrev - c.iPrev
+	}
+	geq = c.capacitance / ctx.dt
+	return geq, -geq * c.vPrev
+}
+
+func (c *capacitor) stamp(s *system, ctx *stampContext) {
+	if ctx.dt == 0 {
+		return
+	}
+	geq, ieq := c.companion(ctx)
+	s.stampConductance(c.a, c.b, geq)
+	s.stampCurrent(c.a, c.b, ieq)
+}
+
+func (c *capacitor) begin(x []float64, fromRest bool) {
+	c.vPrev, c.iPrev, c.current = voltage(x, c.a)-voltage(x, c.b), 0, 0
+	if fromRest {
+		c.vPrev = c.initial
+	}
+}
+
+func (c *capacitor) accept(x []float64, ctx *stampContext) {
+	v := voltage(x, c.a) - voltage(x, c.b)
+	geq, ieq := c.companion(ctx)
+	c.current = geq*v + ieq
+	c.vPrev, c.iPrev = v, c.current
+}
+
+func (c *capacitor) report(x []float64, t float64) ComponentResult {
+	res := c.result(voltage(x, c.a)-voltage(x, c.b), c.current)
+	res.State = "charged"
+	return res
+}
+
+func (c *capacitor) check(res *ComponentResult, is *issues) {
+	if c.polarized && res.Voltage < -0.5 {
+		is.errorf(c.comp.ID, IssueReverseVoltage, "%s is a polarized capacitor wired backwards (%s across it)",
+			c.name(), schematic.FormatValue(res.Voltage, "V"))
+	}
+	if c.voltageRating > 0 && math.Abs(res.Voltage) > c.voltageRating {
+		is.errorf(c.comp.ID, IssueOvervoltage, "%s sees %s, above its %s rating",
+			c.name(), schematic.FormatValue(math.Abs(res.Voltage), "V"), schematic.FormatValue(c.voltageRating, "V"))
+	}
+}
+
+// inductor is a short circuit in DC; its current is a branch unknown
+type inductor struct {
+	base
+	a, b         int
+	inductance   float64
+	initial      float64 // current at rest
+	vPrev, iPrev float64 // state of the last accepted step
+}
+
+func (l *inductor) branchCount() int { return 1 }
+
+// stamp forces V(a)-V(b) = req·i + veq, the integration companion model
+func (l *inductor) stamp(s *system, ctx *stampContext) {
+	if ctx.dt == 0 {
+		s.stampVoltageSource(l.a, l.b, l.branch, 0)
+		return
+	}
+	req := l.inductance / ctx.dt
+	veq := -req * l.iPrev
+	if ctx.method == MethodTrapezoidal {
+		req *= 2
+		veq = -req*l.iPrev - l.vPrev
+	}
+	s.stampVoltageSource(l.a, l.b, l.branch, veq)
+	s.add(l.branch, l.branch, -req)
+}
+
+func (l *inductor) begin(x []float64, fromRest bool) {
+	l.vPrev, l.iPrev = 0, x[l.branch]
+	if fromRest {
+		l.iPrev = l.initial
+	}
+}
+
+func (l *inductor) accept(x []float64, _ *stampContext) {
+	l.vPrev, l.iPrev = voltage(x, l.a)-voltage(x, l.b), x[l.branch]
+}
+
+func (l *inductor) paths() [][2]int {
+	return [][2]int{{l.a, l.b}}
+}
+
+func (l *inductor) report(x []float64, t float64) ComponentResult {
+	return l.result(voltage(x, l.a)-voltage(x, l.b), x[l.branch])
+}
+
+// ============================================
+// Sources
+// ============================================
+
+// voltageSource is a supply or signal source, ideal unless it has an internal resistance
+type voltageSource struct {
+	base
+	pos, neg   int
+	wave       *sourceWave
+	internal   float64
+	maxCurrent float64
+}
+
+func newVoltageSource(b base, t string, nl *Netlist) *voltageSource {
+	volts, maxCurrent := 5.0, 2.0
+	if t == "battery" {
+		volts, maxCurrent = 9.0, 1.0
+	}
+	volts = floatProp(&b.comp, volts, "voltage", "value")
+	return &voltageSource{
+		base:       b,
+		pos:        nl.terminal(b.comp, positivePins),
+		neg:        nl.terminal(b.comp, negativePins),
+		wave:       waveFromProperties(&b.comp, volts, voltageSourceTypes[t]),
+		internal:   floatProp(&b.comp, 0, "internal_resistance"),
+		maxCurrent: floatProp(&b.comp, maxCurrent, "max_current"),
+	}
+}
+
+// shorted is true when both terminals sit on the same net
+func (v *voltageSource) shorted() bool {
+	return v.pos == v.neg
+}
+
+func (v *voltageSource) branchCount() int {
+	if v.internal > 0 || v.shorted() {
+		return 0
+	}
+	return 1
+}
+
+func (v *voltageSource) isSource() bool { return true }
+
+func (v *voltageSource) stamp(s *system, ctx *stampContext) {
+	switch {
+	case v.shorted():
+	case v.internal > 0:
+		g := 1 / v.internal
+		s.stampConductance(v.pos, v.neg, g)
+		s.stampCurrent(v.neg, v.pos, ctx.sourceValue(v.wave)*g)
+	default:
+		s.stampVoltageSource(v.pos, v.neg, v.branch, ctx.sourceValue(v.wave))
+	}
+}
+
+func (v *voltageSource) paths() [][2]int {
+	return [][2]int{{v.pos, v.neg}}
+}
+
+// delivered is the current leaving the positive terminal
+func (v *voltageSource) delivered(x []float64, t float64) float64 {
+	switch {
+	case v.shorted():
+		return 0
+	case v.internal > 0:
+		return (v.wave.at(t) - (voltage(x, v.pos) - voltage(x, v.neg))) / v.internal
+	default:
+		return -x[v.branch]
+	}
+}
+
+func (v *voltageSource) report(x []float64, t float64) ComponentResult {
+	vt := voltage(x, v.pos) - voltage(x, v.neg)
+	i := v.delivered(x, t)
+	res := v.result(vt, i)
+	res.Power = -vt * i
+	res.State = "on"
+	return res
+}
+
+func (v *voltageSource) check(res *ComponentResult, is *issues) {
+	switch {
+	case v.shorted():
+		is.errorf(v.comp.ID, IssueShortCircuit, "%s has its terminals wired directly together (short circuit)", v.name())
+	case res.Current > 10*v.maxCurrent:
+		is.errorf(v.comp.ID, IssueShortCircuit, "%s is short-circuited: it would have to supply %s",
+			v.name(), schematic.FormatValue(res.Current, "A"))
+	case res.Current > v.maxCurrent:
+		is.errorf(v.comp.ID, IssueOvercurrent, "%s supplies %s, more than its %s limit",
+			v.name(), schematic.FormatValue(res.Current, "A"), schematic.FormatValue(v.maxCurrent, "A"))
+	}
+}
+
+// currentSource pushes a fixed current out of its positive terminal
+type currentSource struct {
+	base
+	pos, neg int
+	amps     float64
+}
+
+func (c *currentSource) isSource() bool { return true }
+
+func (c *currentSource) stamp(s *system, ctx *stampContext) {
+	s.stampCurrent(c.neg, c.pos, c.amps*ctx.scale)
+}
+
+func (c *currentSource) report(x []float64, t float64) ComponentResult {
+	v := voltage(x, c.pos) - voltage(x, c.neg)
+	res := c.result(v, c.amps)
+	res.Power = -v * c.amps
+	res.State = "on"
+	return res
+}
+
+func (c *currentSource) check(res *ComponentResult, is *issues) {
+	if math.Abs(res.Voltage) > 100 {
+		is.errorf(c.comp.ID, IssueFloatingNode, "%s has no path for its current to flow", c.name())
+	}
+}
+
+// ============================================
+// Semiconductors
+// ============================================
+
+// pnjlim limits the step of a junction voltage between Newton iterations
+// so the exponential cannot overflow (SPICE's junction limiting)
+func pnjlim(vnew, vold, vt, vcrit float64) (float64, bool) {
+	if vnew > vcrit && math.Abs(vnew-vold) > 2*vt {
+		if vold > 0 {
+			arg := 1 + (vnew-vold)/vt
+			if arg > 0 {
+				return vold + vt*math.Log(arg), true
+			}
+			return vcrit, true
+		}
+		return vt * math.Log(vnew/vt), true
+	}
+	return vnew, false
+}
+
+// junction evaluates a Shockley diode: current and conductance at vd
+func junction(is, nvt, vd float64) (float64, float64) {
+	e := math.Exp(math.Min(vd/nvt, 80))
+	return is * (e - 1), is*e/nvt + gmin
+}
+
+// ledForwardVoltages is the typical forward voltage at 20mA by color
+var ledForwardVoltages = map[string]float64{
+	"red":    2.0,
+	"orange": 2.1,
+	"yellow": 2.1,
+	"green":  2.2,
+	"blue":   3.2,
+	"white":  3.2,
+	"purple": 3.2,
+}
+
+// ledColor names the color of an LED given as a name or a hex value
+func ledColor(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if _, ok := ledForwardVoltages[value]; ok {
+		return value
+	}
+	if !strings.HasPrefix(value, "#") || len(value) != 7 {
+		return "red"
+	}
+	var r, g, b int
+	for i, dst := range []*int{&r, &g, &b} {
+		for _, ch := range value[1+2*i : 3+2*i] {
+			*dst *= 16
+			switch {
+			case ch >= '0' && ch <= '9':
+				*dst += int(ch - '0')
+			case ch >= 'a' && ch <= 'f':
+				*dst += int(ch-'a') + 10
+			}
+		}
+	}
+	switch {
+	case r > 200 && g > 200 && b > 200:
+		return "white"
+	case b > r && b > g:
+		if r > 100 {
+			return "purple"
+		}
+		return "blue"
+	case g > r:
+		return "green"
+	case g > 180:
+		return "yellow"
+	case g > 80:
+		return "orange"
+	}
+	return "red"
+}
+
+// diode models diodes and LEDs with the Shockley equation behind a series
+// resistance, which joins the anode to an internal junction node
+type diode struct {
+	base
+	a, k       int
+	j          int // internal junction node
+	rs         float64
+	is, n      float64
+	vcrit      float64
+	maxCurrent float64
+	led        bool
+	vd         float64 // junction voltage of the last iteration
+}
+
+func newDiode(b base, t string, nl *Netlist) *diode {
+	d := &diode{
+		base: b,
+		a:    nl.terminal(b.comp, anodePins),
+		k:    nl.terminal(b.comp, cathodePins),
+		j:    nl.internalNode(),
+		led:  t == "led",
+	}
+	if d.led {
+		vf := floatProp(&b.comp, ledForwardVoltages[ledColor(stringProp(&b.comp, "color"))], "forward_voltage", "vf")
+		d.n = 2
+		d.rs = floatProp(&b.comp, 10, "series_resistance")
+		d.is = 0.02 / (math.Exp((vf-0.02*d.rs)/(d.n*thermalVoltage)) - 1)
+		if is, ok := b.comp.Float("is"); ok && !hasProp(&b.comp, "forward_voltage", "vf") {
+			// A model's saturation current, unless the part sets its forward voltage
+			d.is, d.n = is, floatProp(&b.comp, d.n, "n")
+		}
+		d.maxCurrent = floatProp(&b.comp, 0.02, "max_current")
+	} else {
+		// 1N4148-like small signal diode unless a forward voltage is given
+		d.n = floatProp(&b.comp, 1.752, "n")
+		d.is = floatProp(&b.comp, 2.52e-9, "is")
+		if vf, ok := b.comp.Float("forward_voltage"); ok {
+			d.is = 0.01 / (math.Exp(vf/(d.n*thermalVoltage)) - 1)
+		}
+		d.maxCurrent = floatProp(&b.comp, 0.3, "max_current")
+		d.rs = floatProp(&b.comp, 0.5, "series_resistance")
+	}
+	d.rs = math.Max(d.rs, 1e-3)
+	nvt := d.n * thermalVoltage
+	d.vcrit = nvt * math.Log(nvt/(math.Sqrt2*d.is))
+	return d
+}
+
+func (d *diode) nonlinear() bool { return true }
+
+func (d *diode) reset() { d.vd = 0 }
+
+func (d *diode) stamp(s *system, ctx *stampContext) {
+	nvt := d.n * thermalVoltage
+	vd, limited := pnjlim(ctx.v(d.j)-ctx.v(d.k), d.vd, nvt, d.vcrit)
+	if limited {
+		ctx.limited = true
+	}
+	d.vd = vd
+
+	s.stampConductance(d.a, d.j, 1/d.rs)
+	id, gd := junction(d.is, nvt, vd)
+	s.stampLinearized([]int{d.j, d.k}, []float64{vd, 0}, []float64{id, -id}, [][]float64{{gd, -gd}, {-gd, gd}})
+}
+
+func (d *diode) paths() [][2]int {
+	return [][2]int{{d.a, d.j}, {d.j, d.k}}
+}
+
+func (d *diode) report(x []float64, t float64) ComponentResult {
+	v := voltage(x, d.a) - voltage(x, d.k)
+	i := (v - (voltage(x, d.j) - voltage(x, d.k))) / d.rs
+	res := d.result(v, i)
+	if d.led {
+		brightness := math.Min(math.Max(i/d.maxCurrent, 0), 1)
+		res.Brightness = &brightness
+		res.State = onOff(i > 1e-4, "on", "off")
+	} else {
+		res.State = onOff(i > 1e-4, "conducting", "blocking")
+	}
+	return res
+}
+
+func (d *diode) check(res *ComponentResult, is *issues) {
+	kind := "diode"
+	if d.led {
+		kind = "LED"
+	}
+	switch {
+	case res.Current > 2*d.maxCurrent:
+		is.errorf(d.comp.ID, IssueOvercurrent, "%s draws %s (max %s) and would burn out; add a series resistor",
+			d.name(), schematic.FormatValue(res.Current, "A"), schematic.FormatValue(d.maxCurrent, "A"))
+	case res.Current > d.maxCurrent:
+		is.warnf(d.comp.ID, IssueOvercurrent, "%s draws %s, above its %s rating",
+			d.name(), schematic.FormatValue(res.Current, "A"), schematic.FormatValue(d.maxCurrent, "A"))
+	case d.led && res.Voltage < -5:
+		is.warnf(d.comp.ID, IssueReverseVoltage, "%s is reverse biased by %s; the %s may be wired backwards",
+			d.name(), schematic.FormatValue(-res.Voltage, "V"), kind)
+	}
+}
+
+// bjt is a bipolar transistor using the Ebers-Moll transport model
+type bjt struct {
+	base
+	c, b, e      int
+	polarity     float64 // +1 NPN, -1 PNP
+	is           float64
+	betaF, betaR float64
+	vcrit        float64
+	maxCurrent   float64
+	vbe, vbc     float64 // junction voltages of the last iteration
+}
+
+func newBJT(b base, t string, nl *Netlist) *bjt {
+	polarity := 1.0
+	if strings.Contains(t, "pnp") || strings.EqualFold(stringProp(&b.comp, "polarity"), "pnp") {
+		polarity = -1
+	}
+	q := &bjt{
+		base:       b,
+		c:          nl.terminal(b.comp, collectorPins),
+		b:          nl.terminal(b.comp, basePins),
+		e:          nl.terminal(b.comp, emitterPins),
+		polarity:   polarity,
+		is:         floatProp(&b.comp, 1e-14, "is"),
+		betaF:      floatProp(&b.comp, 100, "beta", "hfe"),
+		betaR:      floatProp(&b.comp, 1, "br"),
+		maxCurrent: floatProp(&b.comp, 0.6, "max_current"),
+	}
+	q.vcrit = thermalVoltage * math.Log(thermalVoltage/(math.Sqrt2*q.is))
+	return q
+}
+
+func (q *bjt) nonlinear() bool { return true }
+
+func (q *bjt) reset() { q.vbe, q.vbc = 0, 0 }
+
+// currents returns the collector and base currents (into the device, NPN
+// sense) with their derivatives with respect to vbe and vbc
+func (q *bjt) currents(vbe, vbc float64) (ic, ib, dicBE, dicBC, dibBE, dibBC float64) {
+	iF, gF := junction(q.is, thermalVoltage, vbe)
+	iR, gR := junction(q.is, thermalVoltage, vbc)
+	ic = iF - iR - iR/q.betaR
+	ib = iF/q.betaF + iR/q.betaR
+	return ic, ib, gF, -gR - gR/q.betaR, gF / q.betaF, gR / q.betaR
+}
+
+func (q *bjt) stamp(s *system, ctx *stampContext) {
+	p := q.polarity
+	vbe, l1 := pnjlim(p*(ctx.v(q.b)-ctx.v(q.e)), q.vbe, thermalVoltage, q.vcrit)
+	vbc, l2 := pnjlim(p*(ctx.v(q.b)-ctx.v(q.c)), q.vbc, thermalVoltage, q.vcrit)
+	if l1 || l2 {
+		ctx.limited = true
+	}
+	q.vbe, q.vbc = vbe, vbc
+
+	ic, ib, dicBE, dicBC, dibBE, dibBC := q.currents(vbe, vbc)
+
+	// Terminal currents in node voltages (c, b, e); p² = 1 for the derivatives
+	gc := []float64{-dicBC, dicBE + dicBC, -dicBE}
+	gb := []float64{-dibBC, dibBE + dibBC, -dibBE}
+	ge := []float64{-(gc[0] + gb[0]), -(gc[1] + gb[1]), -(gc[2] + gb[2])}
+
+	// Terminal voltages consistent with the limited junction voltages
+	v := []float64{-p * vbc, 0, -p * vbe}
+	s.stampLinearized([]int{q.c, q.b, q.e}, v, []float64{p * ic, p * ib, -p * (ic + ib)}, [][]float64{gc, gb, ge})
+}
+
+func (q *bjt) paths() [][2]int {
+	return [][2]int{{q.b, q.e}, {q.b, q.c}}
+}
+
+func (q *bjt) report(x []float64, t float64) ComponentResult {
+	p := q.polarity
+	vc, vb, ve := voltage(x, q.c), voltage(x, q.b), voltage(x, q.e)
+	ic, ib, _, _, _, _ := q.currents(p*(vb-ve), p*(vb-vc))
+
+	res := q.result(p*(vc-ve), ic)
+	res.Power = ic*p*(vc-ve) + ib*p*(vb-ve)
+	res.Terminals = map[string]float64{"collector": vc, "base": vb, "emitter": ve}
+	switch {
+	case p*(vb-ve) < 0.5:
+		res.State = "cutoff"
+	case p*(vb-vc) > 0.4:
+		res.State = "saturation"
+	default:
+		res.State = "active"
+	}
+	return res
+}
+
+func (q *bjt) check(res *ComponentResult, is *issues) {
+	if math.Abs(res.Current) > q.maxCurrent {
+		is.errorf(q.comp.ID, IssueOvercurrent, "%s carries %s of collector current, above its %s limit",
+			q.name(), schematic.FormatValue(math.Abs(res.Current), "A"), schematic.FormatValue(q.maxCurrent, "A"))
+	}
+}
+
+// ============================================
+// Switches and Relays
+// ============================================
+
+// contact is a pair of switch terminals
+type contact struct {
+	a, b   int
+	closed bool
+}
+
+func (c contact) conductance() float64 {
+	if c.closed {
+		return 1 / switchOnResistance
+	}
+	return 1 / switchOffResistance
+}
+
+// switchDevice is a push button, a two-pin switch or a changeover switch with a common pin
+type switchDevice struct {
+	base
+	contacts []contact
+	on       bool
+}
+
+func newSwitch(b base, t string, nl *Netlist) *switchDevice {
+	on := boolProp(&b.comp, "pressed", "closed", "on", "state", "position", "value")
+	sw := &switchDevice{base: b, on: on}
+
+	if common, ok := nl.lookup(b.comp.ID, commonPins); ok {
+		// Changeover: common connects to p1 when off and p2 when on
+		sw.contacts = []contact{
+			{a: common, b: nl.terminal(b.comp, pin1Pins), closed: !on},
+			{a: common, b: nl.terminal(b.comp, pin2Pins), closed: on},
+		}
+	} else {
+		sw.contacts = []contact{{a: nl.terminal(b.comp, pin1Pins), b: nl.terminal(b.comp, pin2Pins), closed: on}}
+	}
+	return sw
+}
+
+func (sw *switchDevice) stamp(s *system, _ *stampContext) {
+	for _, c := range sw.contacts {
+		s.stampConductance(c.a, c.b, c.conductance())
+	}
+}
+
+func (sw *switchDevice) paths() [][2]int {
+	return closedPaths(sw.contacts)
+}
+
+func (sw *switchDevice) report(x []float64, t float64) ComponentResult {
+	return contactResult(sw.result, sw.contacts, x, sw.on)
+}
+
+func closedPaths(contacts []contact) [][2]int {
+	paths := [][2]int{}
+	for _, c := range contacts {
+		if c.closed {
+			paths = append(paths, [2]int{c.a, c.b})
+		}
+	}
+	return paths
+}
+
+// contactResult reports the voltage across the first contact and the current through the closed one
+func contactResult(result func(v, i float64) ComponentResult, contacts []contact, x []float64, on bool) ComponentResult {
+	first := contacts[0]
+	res := result(voltage(x, first.a)-voltage(x, first.b), 0)
+	res.Power = 0
+	for _, c := range contacts {
+		v := voltage(x, c.a) - voltage(x, c.b)
+		res.Current += v * c.conductance()
+		res.Power += v * v * c.conductance()
+	}
+	res.State = onOff(on, "closed", "open")
+	return res
+}
+
+// relay is a module whose coil moves a changeover contact
+type relay struct {
+	module
+	in        int // -1 when the input pin is not wired
+	contacts  []contact
+	energized bool
+}
+
+func newRelay(b base, nl *Netlist) *relay {
+	r := &relay{module: *newModule(b, moduleSpecs["relay"], nl), in: -1}
+	if in, ok := nl.lookup(b.comp.ID, []string{"in", "signal"}); ok {
+		r.in = in
+	}
+	com := nl.terminal(b.comp, []string{"com", "common"})
+	r.contacts = []contact{
+		{a: com, b: nl.terminal(b.comp, []string{"nc"}), closed: true},
+		{a: com, b: nl.terminal(b.comp, []string{"no"}), closed: false},
+	}
+	return r
+}
+
+func (r *relay) nonlinear() bool { return true }
+
+func (r *relay) reset() { r.setEnergized(false) }
+
+func (r *relay) setEnergized(energized bool) {
+	r.energized = energized
+	r.contacts[0].closed = !energized
+	r.contacts[1].closed = energized
+}
+
+// coilOn decides from the supply and input voltages whether the coil pulls in
+func (r *relay) coilOn(v func(int) float64) bool {
+	supply := v(r.vcc) - v(r.gnd)
+	if supply < r.spec.minVoltage {
+		return false
+	}
+	return r.in < 0 || v(r.in)-v(r.gnd) > 2.0
+}
+
+func (r *relay) stamp(s *system, ctx *stampContext) {
+	r.module.stamp(s, ctx)
+	if on := r.coilOn(ctx.v); on != r.energized {
+		r.setEnergized(on)
+		ctx.limited = true
+	}
+	for _, c := range r.contacts {
+		s.stampConductance(c.a, c.b, c.conductance())
+	}
+}
+
+func (r *relay) paths() [][2]int {
+	return append(r.module.paths(), closedPaths(r.contacts)...)
+}
+
+func (r *relay) report(x []float64, t float64) ComponentResult {
+	res := r.module.report(x, t)
+	res.State = onOff(r.energized, "energized", "released")
+	return res
+}
+
+// ============================================
+// Modules and Boards
+// ============================================
+
+// moduleSpec describes the supply of a breakout module
+type moduleSpec struct {
+	current    float64 // typical supply current at the nominal voltage
+	nominal    float64
+	minVoltage float64
+	maxVoltage float64
+}
+
+var moduleSpecs = map[string]moduleSpec{
+	"dht22":      {current: 0.0015, nominal: 5, minVoltage: 3.3, maxVoltage: 6},
+	"dht11":      {current: 0.0025, nominal: 5, minVoltage: 3.3, maxVoltage: 5.5},
+	"ultrasonic": {current: 0.015, nominal: 5, minVoltage: 4.5, maxVoltage: 5.5},
+	"hc_sr04":    {current: 0.015, nominal: 5, minVoltage: 4.5, maxVoltage: 5.5},
+	"pir":        {current: 0.0001, nominal: 5, minVoltage: 4.5, maxVoltage: 20},
+	"ldr":        {current: 0.003, nominal: 5, minVoltage: 3.3, maxVoltage: 5.5},
+	"servo":      {current: 0.01, nominal: 5, minVoltage: 4.8, maxVoltage: 6.5},
+	"relay":      {current: 0.07, nominal: 5, minVoltage: 4.0, maxVoltage: 6},
+	"lcd":        {current: 0.025, nominal: 5, minVoltage: 4.5, maxVoltage: 5.5},
+	"lcd_16x2":   {current: 0.025, nominal: 5, minVoltage: 4.5, maxVoltage: 5.5},
+	"lcd_i2c":    {current: 0.025, nominal: 5, minVoltage: 4.5, maxVoltage: 5.5},
+	"oled":       {current: 0.02, nominal: 3.3, minVoltage: 3.0, maxVoltage: 5.5},
+}
+
+// module is a breakout board modelled as a resistive load on its supply pins
+type module struct {
+	base
+	vcc, gnd int
+	spec     moduleSpec
+}
+
+func newModule(b base, spec moduleSpec, nl *Netlist) *module {
+	return &module{
+		base: b,
+		vcc:  nl.terminal(b.comp, vccPins),
+		gnd:  nl.terminal(b.comp, gndPins),
+		spec: spec,
+	}
+}
+
+func (m *module) conductance() float64 {
+	return m.spec.current / m.spec.nominal
+}
+
+func (m *module) stamp(s *system, _ *stampContext) {
+	s.stampConductance(m.vcc, m.gnd, m.conductance())
+}
+
+func (m *module) paths() [][2]int {
+	return [][2]int{{m.vcc, m.gnd}}
+}
+
+func (m *module) report(x []float64, t float64) ComponentResult {
+	v := voltage(x, m.vcc) - voltage(x, m.gnd)
+	res := m.result(v, v*m.conductance())
+	res.State = onOff(v >= m.spec.minVoltage && v <= m.spec.maxVoltage, "powered", "unpowered")
+	return res
+}
+
+func (m *module) check(res *ComponentResult, is *issues) {
+	v := res.Voltage
+	switch {
+	case v < -0.5:
+		is.errorf(m.comp.ID, IssueReverseVoltage, "%s has VCC and GND swapped", m.name())
+	case v > m.spec.maxVoltage:
+		is.errorf(m.comp.ID, IssueOvervoltage, "%s gets %s but tolerates at most %s",
+			m.name(), schematic.FormatValue(v, "V"), schematic.FormatValue(m.spec.maxVoltage, "V"))
+	case v < 0.5:
+		is.warnf(m.comp.ID, IssueUnderpowered, "%s is not powered", m.name())
+	case v < m.spec.minVoltage:
+		is.warnf(m.comp.ID, IssueUnderpowered, "%s gets %s but needs at least %s",
+			m.name(), schematic.FormatValue(v, "V"), schematic.FormatValue(m.spec.minVoltage, "V"))
+	}
+}
+
+// mcuRail is a supply output of a board
+type mcuRail struct {
+	volts      float64
+	maxCurrent float64
+}
+
+// mcuSpec describes a development board powered over USB
+type mcuSpec struct {
+	logicLevel    float64
+	pinMaxCurrent float64
+	rails         map[string]mcuRail
+
+	// What a sketch sees of the board
+	intBits    int
+	ledBuiltin int
+	analogBase int // pin number of A0
+	analogPins int
+	adcMax     int
+}
+
+var (
+	avrRails = map[string]mcuRail{
+		"5v":    {volts: 5, maxCurrent: 0.5},
+		"3.3v":  {volts: 3.3, maxCurrent: 0.15},
+		"3v3":   {volts: 3.3, maxCurrent: 0.15},
+		"ioref": {volts: 5, maxCurrent: 0.5},
+	}
+	espRails = map[string]mcuRail{
+		"3v3":  {volts: 3.3, maxCurrent: 0.5},
+		"3.3v": {volts: 3.3, maxCurrent: 0.5},
+		"vin":  {volts: 5, maxCurrent: 0.5},
+		"5v":   {volts: 5, maxCurrent: 0.5},
+	}
+)
+
+var mcuSpecs = map[string]mcuSpec{
+	"arduino_uno": {logicLevel: 5, pinMaxCurrent: 0.04, rails: avrRails,
+		intBits: 16, ledBuiltin: 13, analogBase: 14, analogPins: 6, adcMax: 1023},
+	"arduino_mega": {logicLevel: 5, pinMaxCurrent: 0.04, rails: avrRails,
+		intBits: 16, ledBuiltin: 13, analogBase: 54, analogPins: 16, adcMax: 1023},
+	"arduino_nano": {logicLevel: 5, pinMaxCurrent: 0.04, rails: avrRails,
+		intBits: 16, ledBuiltin: 13, analogBase: 14, analogPins: 8, adcMax: 1023},
+	"esp32": {logicLevel: 3.3, pinMaxCurrent: 0.04, rails: espRails,
+		intBits: 32, ledBuiltin: 2, analogBase: 36, analogPins: 4, adcMax: 4095},
+	"esp8266": {logicLevel: 3.3, pinMaxCurrent: 0.012, rails: espRails,
+		intBits: 32, ledBuiltin: 2, analogBase: 17, analogPins: 1, adcMax: 1023},
+	"raspberry_pi_pico": {logicLevel: 3.3, pinMaxCurrent: 0.012, rails: map[string]mcuRail{
+		"3v3":  {volts: 3.3, maxCurrent: 0.3},
+		"vbus": {volts: 5, maxCurrent: 0.5},
+		"vsys": {volts: 5, maxCurrent: 0.5},
+	}, intBits: 32, ledBuiltin: 25, analogBase: 26, analogPins: 3, adcMax: 1023},
+}
+
+func isMCU(t string) bool {
+	_, ok := mcuSpecs[t]
+	return ok
+}
+
+const (
+	railResistance = 0.1 // regulator output resistance
+	pinResistance  = 25  // GPIO output driver resistance
+)
+
+// mcuOutput is a rail or a GPIO pin driven by the board
+type mcuOutput struct {
+	pin        string
+	node       int
+	wave       *sourceWave
+	maxCurrent float64
+	resistance float64
+	rail       bool
+	off        bool // an input pin of a sketch: high impedance
+}
+
+// mcu is a board powered over USB. Its rails and GPIO outputs are Norton
+// sources against the board ground; other pins are high impedance. With a
+// sketch, its GPIO pins follow the program instead of pin_states.
+type mcu struct {
+	base
+	spec     mcuSpec
+	gnd      int
+	outputs  []mcuOutput
+	currents []float64 // per output, from the last report
+	sketch   *mcuSketch
+}
+
+func newMCU(b base, t string, nl *Netlist) *mcu {
+	spec := mcuSpecs[t]
+	m := &mcu{base: b, spec: spec, gnd: nl.terminal(b.comp, []string{"gnd"})}
+	if source := sketchSource(&b.comp); source != "" {
+		m.loadSketch(source, nl)
+		return m
+	}
+	states := pinStates(&b.comp)
+
+	for pin, node := range nl.wiredPins(b.comp.ID) {
+		if isGroundPin(pin) || pin == "" {
+			continue
+		}
+		if rail, ok := spec.rails[pin]; ok {
+			m.outputs = append(m.outputs, mcuOutput{pin: pin, node: node, wave: dcWave(rail.volts), maxCurrent: rail.maxCurrent, resistance: railResistance, rail: true})
+			continue
+		}
+		if wave, driven := pinDrive(states, pin, spec.logicLevel); driven {
+			m.outputs = append(m.outputs, mcuOutput{pin: pin, node: node, wave: wave, maxCurrent: spec.pinMaxCurrent, resistance: pinResistance})
+		}
+	}
+	return m
+}
+
+// pinStates reads the outputs set by the sketch, e.g. {"D13": "HIGH"} or
+// {"D9": {"pwm": 128, "frequency": 490}}
+func pinStates(comp *schematic.Component) map[string]interface{} {
+	states := map[string]interface{}{}
+	for _, key := range []string{"pin_states", "pinStates"} {
+		if m, ok := comp.Properties[key].(map[string]interface{}); ok {
+			for pin, v := range m {
+				states[strings.ToLower(pin)] = v
+			}
+		}
+	}
+	return states
+}
+
+// defaultPWMFrequency is the analogWrite frequency of most Arduino pins
+const defaultPWMFrequency = 490
+
+// pinDrive returns the output wave of a pin, matching "d13", "13" and "gpio13".
+// driven is false for inputs and pins the sketch does not set.
+func pinDrive(states map[string]interface{}, pin string, logicLevel float64) (wave *sourceWave, driven bool) {
+	bare := strings.TrimPrefix(strings.TrimPrefix(pin, "gpio"), "d")
+	for _, key := range []string{pin, bare, "d" + bare, "gpio" + bare} {
+		v, ok := states[key]
+		if !ok {
+			continue
+		}
+		if pwm, ok := v.(map[string]interface{}); ok {
+			// "pwm" is the analogWrite value (0-255), "duty" a fraction or percentage
+			duty, _ := pwm["pwm"].(float64)
+			duty /= 255
+			if d, ok := pwm["duty"].(float64); ok {
+				duty = normalizeDuty(d)
+			}
+			frequency, ok := pwm["frequency"].(float64)
+			if !ok || frequency <= 0 {
+				frequency = defaultPWMFrequency
+			}
+			return pwmWave(logicLevel, math.Min(math.Max(duty, 0), 1), frequency), true
+		}
+		high, ok := truthy(v)
+		if !ok {
+			return nil, false
+		}
+		if high {
+			return dcWave(logicLevel), true
+		}
+		return dcWave(0), true
+	}
+	return nil, false
+}
+
+func (m *mcu) isSource() bool { return true }
+
+func (m *mcu) stamp(s *system, ctx *stampContext) {
+	for _, out := range m.outputs {
+		if out.off {
+			continue
+		}
+		g := 1 / out.resistance
+		s.stampConductance(out.node, m.gnd, g)
+		s.stampCurrent(m.gnd, out.node, ctx.sourceValue(out.wave)*g)
+	}
+}
+
+func (m *mcu) paths() [][2]int {
+	paths := [][2]int{}
+	for _, out := range m.outputs {
+		if out.off {
+			continue
+		}
+		paths = append(paths, [2]int{out.node, m.gnd})
+	}
+	return paths
+}
+
+// sourced is the current an output pushes out of its pin
+func (m *mcu) sourced(out mcuOutput, x []float64, t float64) float64 {
+	if out.off {
+		return 0
+	}
+	return (out.wave.at(t) - (voltage(x, out.node) - voltage(x, m.gnd))) / out.resistance
+}
+
+func (m *mcu) report(x []float64, t float64) ComponentResult {
+	res := m.result(0, 0)
+	res.Terminals = map[string]float64{}
+	outputs := m.outputs
+	if m.sketch != nil && m.sketch.solved != nil {
+		outputs = m.sketch.solved
+	}
+	m.currents = make([]float64, len(outputs))
+	for k, out := range outputs {
+		v := voltage(x, out.node) - voltage(x, m.gnd)
+		i := m.sourced(out, x, t)
+		m.currents[k] = i
+		res.Terminals[out.pin] = v
+		res.Current += i
+		res.Power -= v * i
+		if out.rail && v > res.Voltage {
+			res.Voltage = v
+		}
+	}
+	res.State = "powered"
+	return res
+}
+
+func (m *mcu) check(_ *ComponentResult, is *issues) {
+	if m.sketch != nil && m.sketch.machine != nil {
+		if err := m.sketch.machine.Err(); err != nil {
+			is.errorf(m.comp.ID, IssueSketchError, "The sketch on %s stopped: %s", m.name(), err.Error())
+		}
+	}
+	for k, out := range m.outputs {
+		i := math.Abs(m.currents[k])
+		switch {
+		case out.rail && i > 10*out.maxCurrent:
+			is.errorf(m.comp.ID, IssueShortCircuit, "%s pin %s is short-circuited", m.name(), strings.ToUpper(out.pin))
+		case i > out.maxCurrent:
+			is.errorf(m.comp.ID, IssueOvercurrent, "%s pin %s carries %s, above its %s limit",
+				m.name(), strings.ToUpper(out.pin), schematic.FormatValue(i, "A"), schematic.FormatValue(out.maxCurrent, "A"))
+		}
+	}
+}
+
+// ============================================
+// Instruments
+// ============================================
+
+// meter is a voltmeter (10MΩ) or an ammeter (0V branch)
+type meter struct {
+	base
+	pos, neg int
+	series   bool
+}
+
+func (m *meter) branchCount() int {
+	if m.series {
+		return 1
+	}
+	return 0
+}
+
+func (m *meter) stamp(s *system, _ *stampContext) {
+	if m.series {
+		s.stampVoltageSource(m.pos, m.neg, m.branch, 0)
+		return
+	}
+	s.stampConductance(m.pos, m.neg, 1e-7)
+}
+
+func (m *meter) paths() [][2]int {
+	return [][2]int{{m.pos, m.neg}}
+}
+
+func (m *meter) report(x []float64, t float64) ComponentResult {
+	v := voltage(x, m.pos) - voltage(x, m.neg)
+	if m.series {
+		return m.result(v, x[m.branch])
+	}
+	return m.result(v, v*1e-7)
+}
+
+// probe reports the voltage of a net against ground
+type probe struct {
+	base
+	node int // -1 when not wired
+}
+
+func (p *probe) report(x []float64, t float64) ComponentResult {
+	return p.result(voltage(x, p.node), 0)
+}
+
+func onOff(on bool, yes, no string) string {
+	if on {
+		return yes
+	}
+	return no
+}
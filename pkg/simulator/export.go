@@ -0,0 +1,363 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================
+// Result Export
+// ============================================
+
+// Column is a column of an exported result
+type Column struct {
+	Name string `json:"name"`
+	Unit string `json:"unit"`
+}
+
+// Table lays a result out as rows of numbers: the axis (time in seconds,
+// frequency in hertz or the variant index) when the result has one, then
+// one column per probe. Unknown values, such as an undriven logic net,
+// are NaN.
+type Table struct {
+	Columns []Column
+	Rows    int
+	row     func(k int, dst []float64)
+}
+
+// Row fills dst, which has a value per column, with row k
+func (t *Table) Row(k int, dst []float64) {
+	t.row(k, dst)
+}
+
+// Table lays out the main result of a run: the variants of a sweep, the
+// waveform of a transient run, the Bode traces of an AC sweep, the timing
+// diagram of a digital run, or else the operating point as a single row.
+// signals selects probes by name; empty keeps them all. ok is false when
+// the run has no result.
+func (r *Results) Table(signals []string) (t *Table, ok bool) {
+	switch {
+	case r.Variation != nil:
+		t = variationTable(r.Variation)
+	case r.Transient != nil && r.Transient.Waveform != nil:
+		t = waveformTable(r.Transient.Waveform.Select(signals))
+		signals = nil
+	case r.AC != nil:
+		t = acTable(r.AC)
+	case r.Digital != nil:
+		t = digitalTable(r.Digital)
+	case r.OperatingPoint != nil:
+		t = operatingPointTable(r.OperatingPoint)
+	default:
+		return nil, false
+	}
+	return t.selectColumns(signals), true
+}
+
+// selectColumns keeps the axis and the probes named in signals
+func (t *Table) selectColumns(signals []string) *Table {
+	if len(signals) == 0 {
+		return t
+	}
+	keep := []int{}
+	for i, col := range t.Columns {
+		if i == 0 && isAxis(col.Name) {
+			keep = append(keep, i)
+			continue
+		}
+		for _, name := range signals {
+			if col.Name == name {
+				keep = append(keep, i)
+				break
+			}
+		}
+	}
+
+	columns := make([]Column, len(keep))
+	for i, k := range keep {
+		columns[i] = t.Columns[k]
+	}
+	all := make([]float64, len(t.Columns))
+	return &Table{Columns: columns, Rows: t.Rows, row: func(k int, dst []float64) {
+		t.row(k, all)
+		for i, c := range keep {
+			dst[i] = all[c]
+		}
+	}}
+}
+
+func isAxis(name string) bool {
+	return name == "time" || name == "frequency" || name == "variant"
+}
+
+func waveformTable(w *Waveform) *Table {
+	t := &Table{Columns: []Column{{Name: "time", Unit: "s"}}, Rows: len(w.Time)}
+	for _, sig := range w.Signals {
+		t.Columns = append(t.Columns, Column{Name: sig.Name, Unit: sig.Unit})
+	}
+	t.row = func(k int, dst []float64) {
+		dst[0] = w.Time[k]
+		for i, sig := range w.Signals {
+			dst[i+1] = sig.Values[k]
+		}
+	}
+	return t
+}
+
+func acTable(ac *ACResult) *Table {
+	t := &Table{Columns: []Column{{Name: "frequency", Unit: "Hz"}}, Rows: len(ac.Frequency)}
+	for _, tr := range ac.Traces {
+		t.Columns = append(t.Columns,
+			Column{Name: "|" + tr.Name + "|", Unit: "V/V"},
+			Column{Name: "dB(" + tr.Name + ")", Unit: "dB"},
+			Column{Name: "phase(" + tr.Name + ")", Unit: "°"})
+	}
+	t.row = func(k int, dst []float64) {
+		dst[0] = ac.Frequency[k]
+		for i, tr := range ac.Traces {
+			dst[3*i+1], dst[3*i+2], dst[3*i+3] = tr.Magnitude[k], tr.MagnitudeDB[k], tr.Phase[k]
+		}
+	}
+	return t
+}
+
+// digitalTable has a row at every instant a signal changes, holding the
+// value of every signal from then on
+func digitalTable(r *DigitalResult) *Table {
+	t := &Table{Columns: []Column{{Name: "time", Unit: "s"}}}
+	times := []int64{}
+	for _, sig := range r.Signals {
+		t.Columns = append(t.Columns, Column{Name: sig.Name})
+		for _, c := range sig.Changes {
+			times = append(times, c.T)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	times = compactTimes(times)
+	t.Rows = len(times)
+
+	t.row = func(k int, dst []float64) {
+		at := times[k]
+		dst[0] = float64(at) * logicSecond
+		for i, sig := range r.Signals {
+			// The last change at or before the row's instant
+			n := sort.Search(len(sig.Changes), func(j int) bool { return sig.Changes[j].T > at })
+			dst[i+1] = math.NaN()
+			if n > 0 {
+				dst[i+1] = logicNumber(sig.Changes[n-1].V)
+			}
+		}
+	}
+	return t
+}
+
+// logicSecond is the length of a logic time unit (LogicTimescale) in seconds
+const logicSecond = 1e-12
+
+func compactTimes(times []int64) []int64 {
+	out := times[:0]
+	for i, t := range times {
+		if i == 0 || t != times[i-1] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// logicNumber reads a logic value, one bit or a binary bus; NaN when a bit
+// is unknown
+func logicNumber(v string) float64 {
+	n, err := strconv.ParseUint(v, 2, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return float64(n)
+}
+
+func operatingPointTable(op *OperatingPoint) *Table {
+	t := &Table{Rows: 1}
+	values := []float64{}
+	for _, node := range op.Nodes {
+		t.Columns = append(t.Columns, Column{Name: "V(" + node.Name + ")", Unit: "V"})
+		values = append(values, node.Voltage)
+	}
+	for _, comp := range op.Components {
+		t.Columns = append(t.Columns,
+			Column{Name: "V(" + comp.Name + ")", Unit: "V"},
+			Column{Name: "I(" + comp.Name + ")", Unit: "A"})
+		values = append(values, comp.Voltage, comp.Current)
+
+		// Sensor readings are named like the lab reports them, "DHT22.temperature"
+		quantities := make([]string, 0, len(comp.Readings))
+		for name := range comp.Readings {
+			quantities = append(quantities, name)
+		}
+		sort.Strings(quantities)
+		for _, name := range quantities {
+			t.Columns = append(t.Columns, Column{Name: comp.Name + "." + name})
+			values = append(values, comp.Readings[name])
+		}
+	}
+	t.row = func(_ int, dst []float64) { copy(dst, values) }
+	return t
+}
+
+// variationTable has a row per variant: its parameters, its measurements
+// and whether it passed
+func variationTable(vr *VariationResult) *Table {
+	t := &Table{Columns: []Column{{Name: "variant"}}, Rows: len(vr.Variants)}
+	for _, name := range vr.Parameters {
+		t.Columns = append(t.Columns, Column{Name: name})
+	}
+	measured := map[string]bool{}
+	probes := []string{}
+	for _, v := range vr.Variants {
+		for name := range v.Measurements {
+			if !measured[name] {
+				measured[name] = true
+				probes = append(probes, name)
+			}
+		}
+	}
+	sort.Strings(probes)
+	for _, name := range probes {
+		t.Columns = append(t.Columns, Column{Name: name, Unit: probeUnit(name)})
+	}
+	t.Columns = append(t.Columns, Column{Name: "passed"})
+
+	t.row = func(k int, dst []float64) {
+		v := vr.Variants[k]
+		dst[0] = float64(v.Index)
+		i := 1
+		for _, name := range vr.Parameters {
+			dst[i] = lookupOrNaN(v.Parameters, name)
+			i++
+		}
+		for _, name := range probes {
+			dst[i] = lookupOrNaN(v.Measurements, name)
+			i++
+		}
+		dst[i] = 0
+		if v.Passed {
+			dst[i] = 1
+		}
+	}
+	return t
+}
+
+func lookupOrNaN(values map[string]float64, name string) float64 {
+	if v, ok := values[name]; ok {
+		return v
+	}
+	return math.NaN()
+}
+
+// probeUnit guesses the unit of a probe from its name, V(...) or I(...)
+func probeUnit(name string) string {
+	switch {
+	case len(name) > 2 && name[:2] == "V(":
+		return "V"
+	case len(name) > 2 && name[:2] == "I(":
+		return "A"
+	}
+	return ""
+}
+
+// formatCell writes a number as CSV and JSON show it; NaN is empty
+func formatCell(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteCSV writes the table with a header row of names and units, e.g.
+// "time (s),V(N2) (V)", one row at a time
+func (t *Table) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+
+	record := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		name := col.Name
+		if col.Unit != "" {
+			name += " (" + col.Unit + ")"
+		}
+		record[i] = CSVText(name)
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	row := make([]float64, len(t.Columns))
+	for k := 0; k < t.Rows; k++ {
+		t.row(k, row)
+		for i, v := range row {
+			record[i] = formatCell(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVText guards text a spreadsheet would read as a formula, e.g.
+// "=HYPERLINK(...)", with a leading apostrophe
+func CSVText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// WriteJSON writes meta, which must encode as a JSON object, extended with
+// the table's "columns" and its "rows" as arrays of numbers (null where a
+// value is unknown), one row at a time
+func (t *Table) WriteJSON(w io.Writer, meta interface{}) error {
+	head, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	columns, _ := json.Marshal(t.Columns)
+
+	b := bufio.NewWriter(w)
+	b.Write(head[:len(head)-1])
+	if len(head) > 2 {
+		b.WriteByte(',')
+	}
+	b.WriteString(`"columns":`)
+	b.Write(columns)
+	b.WriteString(`,"rows":[`)
+
+	row := make([]float64, len(t.Columns))
+	for k := 0; k < t.Rows; k++ {
+		if k > 0 {
+			b.WriteByte(',')
+		}
+		t.row(k, row)
+		b.WriteByte('[')
+		for i, v := range row {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if cell := formatCell(v); cell != "" {
+				b.WriteString(cell)
+			} else {
+				b.WriteString("null")
+			}
+		}
+		if err := b.WriteByte(']'); err != nil {
+			return err
+		}
+	}
+	b.WriteString("]}")
+	return b.Flush()
+}
@@ -0,0 +1,68 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestWriteCSVHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		component string
+		want      []string
+	}{
+		{"plain name", "R1", []string{"V(R1) (V)", "I(R1) (A)"}},
+		{"quote in a name", `R"1`, []string{`V(R"1) (V)`, `I(R"1) (A)`}},
+		{"comma in a name", "R,1", []string{"V(R,1) (V)", "I(R,1) (A)"}},
+		{"formula as a name", "=cmd", []string{"V(=cmd) (V)", "I(=cmd) (A)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Results{OperatingPoint: &OperatingPoint{Components: []ComponentResult{{Name: tt.component, Voltage: 1, Current: -0.5}}}}
+			table, ok := r.Table(nil)
+			if !ok {
+				t.Fatal("no table")
+			}
+			var buf bytes.Buffer
+			if err := table.WriteCSV(&buf); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			records, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatalf("read back %q: %v", buf.String(), err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("got %d records, want 2", len(records))
+			}
+			for i, want := range tt.want {
+				if got := records[0][i]; got != want {
+					t.Errorf("header %d = %q, want %q", i, got, want)
+				}
+			}
+			if records[1][0] != "1" || records[1][1] != "-0.5" {
+				t.Errorf("row = %q, want [1 -0.5]", records[1])
+			}
+		})
+	}
+}
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"V(N1)", "V(N1)"},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"+cmd|' /C calc'!A0", "'+cmd|' /C calc'!A0"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tx", "'\tx"},
+		{"\rx", "'\rx"},
+	}
+	for _, tt := range tests {
+		if got := CSVText(tt.in); got != tt.want {
+			t.Errorf("CSVText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package simulator
+
+import (
+	"math"
+	"sort"
+)
+
+// ============================================
+// Hardware Comparison
+// ============================================
+
+// defaultHardwareRelTol is how far real parts may stray from the model
+// before a reading counts as diverged
+const defaultHardwareRelTol = 0.05
+
+// Prediction is what a run predicts a probe reads on the real circuit.
+// A transient run predicts the range the probe sweeps over and its
+// average; an operating point predicts a single value.
+type Prediction struct {
+	Probe string  `json:"probe"`
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// Reading sums up the samples a sensor of a lab reported
+type Reading struct {
+	Sensor  string  `json:"sensor"`
+	Mean    float64 `json:"mean"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Samples int     `json:"samples"`
+}
+
+// ReadingDelta compares a sensor of the lab with the probe it measures
+type ReadingDelta struct {
+	Sensor       string  `json:"sensor"`
+	Probe        string  `json:"probe"`
+	Unit         string  `json:"unit"`
+	Predicted    float64 `json:"predicted"`
+	PredictedMin float64 `json:"predicted_min"`
+	PredictedMax float64 `json:"predicted_max"`
+	Measured     float64 `json:"measured"`
+	MeasuredMin  float64 `json:"measured_min"`
+	MeasuredMax  float64 `json:"measured_max"`
+	Samples      int     `json:"samples"`
+	Delta        float64 `json:"delta"` // measured - predicted
+	Diverged     bool    `json:"diverged"`
+}
+
+// HardwareComparison reports how the readings of a lab differ from the
+// predictions of a run. Unmatched sensors have no prediction; unmeasured
+// probes were mapped to a sensor that sent no reading.
+type HardwareComparison struct {
+	Diverged       bool           `json:"diverged"`
+	DivergedProbes []string       `json:"diverged_probes"`
+	Readings       []ReadingDelta `json:"readings"`
+	Unmatched      []string       `json:"unmatched"`
+	Unmeasured     []string       `json:"unmeasured"`
+}
+
+// Predictions lists what the run predicts for each probe: the signals of
+// its waveform, and the operating point for the probes the waveform does
+// not record. Other analyses predict nothing a sensor can read.
+func (r *Results) Predictions() []Prediction {
+	predictions := []Prediction{}
+	seen := map[string]bool{}
+	if r.Transient != nil && r.Transient.Waveform != nil {
+		for _, sig := range r.Transient.Waveform.Signals {
+			predictions = append(predictions, Prediction{Probe: sig.Name, Unit: sig.Unit, Value: sig.Average, Min: sig.Min, Max: sig.Max})
+			seen[sig.Name] = true
+		}
+	}
+	if r.OperatingPoint != nil {
+		t := operatingPointTable(r.OperatingPoint)
+		row := make([]float64, len(t.Columns))
+		t.Row(0, row)
+		for i, col := range t.Columns {
+			if !seen[col.Name] {
+				predictions = append(predictions, Prediction{Probe: col.Name, Unit: col.Unit, Value: row[i], Min: row[i], Max: row[i]})
+				seen[col.Name] = true
+			}
+		}
+	}
+	return predictions
+}
+
+// AggregateReadings sums up samples of sensors as a lab reports them,
+// e.g. {"DHT22": {"temperature": 25.5}, "V(N2)": 3.3}. Nested values are
+// named by their path, "DHT22.temperature"; values that are not numbers
+// are left out.
+func AggregateReadings(samples []map[string]interface{}) []Reading {
+	readings := map[string]*Reading{}
+	var add func(prefix string, values map[string]interface{})
+	add = func(prefix string, values map[string]interface{}) {
+		for name, v := range values {
+			sensor := prefix + name
+			switch v := v.(type) {
+			case map[string]interface{}:
+				add(sensor+".", v)
+			case float64:
+				r, ok := readings[sensor]
+				if !ok {
+					r = &Reading{Sensor: sensor, Min: v, Max: v}
+					readings[sensor] = r
+				}
+				r.Mean += v
+				r.Min = math.Min(r.Min, v)
+				r.Max = math.Max(r.Max, v)
+				r.Samples++
+			}
+		}
+	}
+	for _, sample := range samples {
+		add("", sample)
+	}
+
+	out := make([]Reading, 0, len(readings))
+	for _, r := range readings {
+		r.Mean = round(r.Mean / float64(r.Samples))
+		r.Min, r.Max = round(r.Min), round(r.Max)
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Sensor < out[j].Sensor })
+	return out
+}
+
+// CompareReadings compares the readings of a lab with the predictions of
+// a run. probes maps a sensor to the probe it measures; a sensor named
+// like a probe measures that probe. A reading diverges when its mean
+// falls outside the predicted range by more than the tolerance; a zero
+// RelTol picks 5%, as real parts are not ideal.
+func CompareReadings(predictions []Prediction, readings []Reading, probes map[string]string, opts CompareOptions) *HardwareComparison {
+	if opts.RelTol <= 0 {
+		opts.RelTol = defaultHardwareRelTol
+	}
+	c := &Comparison{opts: opts.withDefaults()}
+	hc := &HardwareComparison{DivergedProbes: []string{}, Readings: []ReadingDelta{}, Unmatched: []string{}, Unmeasured: []string{}}
+
+	predicted := map[string]Prediction{}
+	for _, p := range predictions {
+		predicted[p.Probe] = p
+	}
+	measured := map[string]bool{}
+	for _, r := range readings {
+		probe, ok := probes[r.Sensor]
+		if !ok {
+			probe = r.Sensor
+		}
+		p, ok := predicted[probe]
+		if !ok {
+			hc.Unmatched = append(hc.Unmatched, r.Sensor)
+			continue
+		}
+		measured[r.Sensor] = true
+
+		d := ReadingDelta{
+			Sensor: r.Sensor, Probe: probe, Unit: p.Unit,
+			Predicted: p.Value, PredictedMin: p.Min, PredictedMax: p.Max,
+			Measured: r.Mean, MeasuredMin: r.Min, MeasuredMax: r.Max,
+			Samples: r.Samples,
+			Delta:   round(r.Mean - p.Value),
+		}
+		tolerance := c.tolerance(p.Unit, math.Max(math.Abs(p.Min), math.Abs(p.Max)))
+		d.Diverged = r.Mean < p.Min-tolerance || r.Mean > p.Max+tolerance
+		if d.Diverged {
+			hc.Diverged = true
+			hc.DivergedProbes = append(hc.DivergedProbes, probe)
+		}
+		hc.Readings = append(hc.Readings, d)
+	}
+
+	for sensor := range probes {
+		if !measured[sensor] {
+			hc.Unmeasured = append(hc.Unmeasured, sensor)
+		}
+	}
+	sort.Strings(hc.Unmeasured)
+	return hc
+}
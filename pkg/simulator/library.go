@@ -0,0 +1,394 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Model Library
+// ============================================
+
+// DeviceModel is a simulation model of a part: the engine device that
+// simulates it, its SPICE-style parameters, how its pins map to the
+// device's terminals, and the properties it defaults to. Sensors also
+// have a behavioral model.
+type DeviceModel struct {
+	Name        string                 `json:"name"`
+	Device      string                 `json:"device"`
+	Description string                 `json:"description,omitempty"`
+	Params      map[string]float64     `json:"params,omitempty"`   // e.g. {"IS": 2.52e-9, "N": 1.752}
+	Pins        map[string]string      `json:"pins,omitempty"`     // part pin -> device terminal
+	Defaults    map[string]interface{} `json:"defaults,omitempty"` // properties a part does not set
+	Behavior    *Behavior              `json:"behavior,omitempty"`
+}
+
+// Behavior is the behavioral model of a sensor. The quantities it measures
+// are virtual inputs a part sets as properties, e.g. "temperature": 30;
+// the sensor reports them as readings and may drive an output pin with a
+// voltage that follows one of them.
+type Behavior struct {
+	Supply Supply          `json:"supply"`
+	Inputs []BehaviorInput `json:"inputs"`
+	Output *BehaviorOutput `json:"output,omitempty"`
+}
+
+// Supply is what a sensor draws from its VCC and GND pins
+type Supply struct {
+	Current    float64 `json:"current"` // A at the nominal voltage
+	Nominal    float64 `json:"nominal"`
+	MinVoltage float64 `json:"min_voltage"`
+	MaxVoltage float64 `json:"max_voltage"`
+}
+
+// BehaviorInput is a quantity a sensor measures and the range it measures
+type BehaviorInput struct {
+	Name    string  `json:"name"`
+	Unit    string  `json:"unit,omitempty"`
+	Default float64 `json:"default"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// BehaviorOutput drives Pin with Offset + Gain·input volts, clamped to the
+// supply, through Resistance ohms
+type BehaviorOutput struct {
+	Pin        string  `json:"pin"`
+	Input      string  `json:"input"`
+	Gain       float64 `json:"gain"`   // V per unit of the input
+	Offset     float64 `json:"offset"` // V
+	Resistance float64 `json:"resistance,omitempty"`
+}
+
+// defaultOutputResistance is the output resistance of a sensor's analog output
+const defaultOutputResistance = 100
+
+// spiceParams maps the SPICE-style parameters of each device to the part
+// properties its model reads
+var spiceParams = map[string]map[string]string{
+	"resistor":               {"R": "resistance", "PMAX": "power_rating"},
+	"capacitor":              {"C": "capacitance", "VMAX": "voltage_rating", "IC": "initial_voltage"},
+	"electrolytic_capacitor": {"C": "capacitance", "VMAX": "voltage_rating", "IC": "initial_voltage"},
+	"inductor":               {"L": "inductance", "IC": "initial_current"},
+	"potentiometer":          {"R": "resistance"},
+	"diode":                  {"IS": "is", "N": "n", "RS": "series_resistance", "IMAX": "max_current"},
+	"led":                    {"IS": "is", "N": "n", "RS": "series_resistance", "IMAX": "max_current", "VF": "forward_voltage"},
+	"npn":                    {"IS": "is", "BF": "beta", "BR": "br", "IMAX": "max_current"},
+	"pnp":                    {"IS": "is", "BF": "beta", "BR": "br", "IMAX": "max_current"},
+	"switch":                 {},
+	"push_button":            {},
+	"relay":                  {},
+	"ldr":                    {"R": "resistance"},
+	"dc_motor":               {"R": "resistance", "VRATED": "rated_voltage"},
+	"buzzer":                 {"R": "resistance", "VRATED": "rated_voltage"},
+	"lamp":                   {"R": "resistance", "VRATED": "rated_voltage"},
+	"sensor":                 {},
+}
+
+// ModelDevices lists the devices a model can be simulated by
+func ModelDevices() []string {
+	devices := make([]string, 0, len(spiceParams)+len(moduleSpecs))
+	for device := range spiceParams {
+		devices = append(devices, device)
+	}
+	for device := range moduleSpecs {
+		if _, ok := spiceParams[device]; !ok {
+			devices = append(devices, device)
+		}
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// modelDevice reports whether a model can be simulated by a device
+func modelDevice(device string) bool {
+	if _, ok := spiceParams[device]; ok {
+		return true
+	}
+	_, ok := moduleSpecs[device]
+	return ok
+}
+
+var modelNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-]{0,99}$`)
+
+// ModelError lists everything wrong with a model
+type ModelError struct {
+	Errors []string `json:"errors"`
+}
+
+func (e *ModelError) Error() string {
+	return "invalid model"
+}
+
+// Details summarizes the failures
+func (e *ModelError) Details() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+// Validate checks that a model can be simulated. It returns a *ModelError.
+func (m *DeviceModel) Validate() error {
+	errs := []string{}
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if !modelNamePattern.MatchString(m.Name) {
+		fail("name must be 1-100 letters, digits, '_', '.' or '-'")
+	}
+	m.Device = strings.ToLower(strings.TrimSpace(m.Device))
+	if !modelDevice(m.Device) {
+		fail("device %q is not simulated; use one of %s", m.Device, strings.Join(ModelDevices(), ", "))
+	}
+
+	known := spiceParams[m.Device]
+	for name, value := range m.Params {
+		if _, ok := known[strings.ToUpper(name)]; !ok {
+			fail("parameter %s is not a parameter of the %s device", name, m.Device)
+		} else if math.IsNaN(value) || math.IsInf(value, 0) {
+			fail("parameter %s must be a number", name)
+		} else if value <= 0 && strings.ToUpper(name) != "IC" {
+			fail("parameter %s must be positive", name)
+		}
+	}
+
+	for pin, terminal := range m.Pins {
+		if strings.TrimSpace(pin) == "" || strings.TrimSpace(terminal) == "" {
+			fail("pins must map a part pin to a device terminal")
+		}
+	}
+	for key := range m.Defaults {
+		if strings.TrimSpace(key) == "" {
+			fail("defaults must name the property they set")
+		}
+	}
+
+	switch {
+	case m.Device == "sensor" && m.Behavior == nil:
+		fail("a sensor needs a behavior")
+	case m.Device != "sensor" && m.Behavior != nil:
+		fail("only sensors have a behavior")
+	case m.Behavior != nil:
+		errs = append(errs, m.Behavior.validate()...)
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return &ModelError{Errors: errs}
+	}
+	return nil
+}
+
+func (b *Behavior) validate() []string {
+	errs := []string{}
+	s := b.Supply
+	if s.Current < 0 || s.Nominal <= 0 || s.MinVoltage < 0 || s.MinVoltage > s.Nominal || s.Nominal > s.MaxVoltage {
+		errs = append(errs, "supply needs current >= 0 and 0 <= min_voltage <= nominal <= max_voltage")
+	}
+	if len(b.Inputs) == 0 {
+		errs = append(errs, "behavior needs at least one input")
+	}
+	inputs := map[string]bool{}
+	for _, in := range b.Inputs {
+		switch {
+		case strings.TrimSpace(in.Name) == "":
+			errs = append(errs, "inputs must be named")
+		case inputs[in.Name]:
+			errs = append(errs, fmt.Sprintf("input %s is defined twice", in.Name))
+		case in.Min >= in.Max:
+			errs = append(errs, fmt.Sprintf("input %s needs min < max", in.Name))
+		case in.Default < in.Min || in.Default > in.Max:
+			errs = append(errs, fmt.Sprintf("input %s defaults outside its range", in.Name))
+		}
+		inputs[in.Name] = true
+	}
+	if out := b.Output; out != nil {
+		if strings.TrimSpace(out.Pin) == "" {
+			errs = append(errs, "output needs a pin")
+		}
+		if !inputs[out.Input] {
+			errs = append(errs, fmt.Sprintf("output follows input %q, which is not defined", out.Input))
+		}
+		if out.Gain == 0 || out.Resistance < 0 {
+			errs = append(errs, "output needs a gain and a resistance >= 0")
+		}
+	}
+	return errs
+}
+
+// Library holds models by lower-cased name
+type Library map[string]*DeviceModel
+
+// NewLibrary builds a library of models; later models replace earlier ones
+// of the same name
+func NewLibrary(models ...*DeviceModel) Library {
+	lib := Library{}
+	for _, m := range models {
+		lib[strings.ToLower(m.Name)] = m
+	}
+	return lib
+}
+
+// Lookup finds a model by name, ignoring case
+func (lib Library) Lookup(name string) (*DeviceModel, bool) {
+	m, ok := lib[strings.ToLower(strings.TrimSpace(name))]
+	return m, ok
+}
+
+// ApplyModels sets up the parts of a schema that use a model of the
+// library: the model a part names in its "model" property, else the model
+// named like its type. The part is simulated by the model's device, takes
+// the model's parameters and defaults for the properties it does not set,
+// and its wires are moved to the device's terminals. A model the library
+// does not have leaves the part as it is, with a warning.
+func ApplyModels(schema *schematic.Schema, lib Library) []Issue {
+	is := &issues{}
+	pinMaps := map[string]map[string]string{}
+	for i := range schema.Components {
+		comp := &schema.Components[i]
+		name := stringProp(comp, "model")
+		m, ok := lib.Lookup(name)
+		if name == "" {
+			m, ok = lib.Lookup(comp.Type)
+		}
+		if !ok {
+			if name != "" {
+				is.warnf(comp.ID, IssueUnknownModel, "%s uses model %s, which is not in the model library; it is simulated as a %s",
+					displayName(*comp), name, comp.Type)
+			}
+			continue
+		}
+
+		if comp.Properties == nil {
+			comp.Properties = map[string]interface{}{}
+		}
+		for key, value := range m.Defaults {
+			if _, set := comp.Properties[key]; !set {
+				comp.Properties[key] = value
+			}
+		}
+		for param, value := range m.Params {
+			if key, ok := spiceParams[m.Device][strings.ToUpper(param)]; ok {
+				if _, set := comp.Properties[key]; !set {
+					comp.Properties[key] = value
+				}
+			}
+		}
+		if m.Behavior != nil {
+			// Plain JSON, so copies of the schema keep it
+			var behavior map[string]interface{}
+			data, _ := json.Marshal(m.Behavior)
+			json.Unmarshal(data, &behavior)
+			comp.Properties["behavior"] = behavior
+		}
+		comp.Properties["device"] = m.Device
+
+		if len(m.Pins) > 0 {
+			pins := map[string]string{}
+			for pin, terminal := range m.Pins {
+				pins[strings.ToLower(strings.TrimSpace(pin))] = terminal
+			}
+			pinMaps[comp.ID] = pins
+		}
+	}
+
+	for i := range schema.Wires {
+		w := &schema.Wires[i]
+		if terminal, ok := pinMaps[w.StartComponentID][strings.ToLower(strings.TrimSpace(w.StartPinID))]; ok {
+			w.StartPinID = terminal
+		}
+		if terminal, ok := pinMaps[w.EndComponentID][strings.ToLower(strings.TrimSpace(w.EndPinID))]; ok {
+			w.EndPinID = terminal
+		}
+	}
+	return is.Warnings
+}
+
+// deviceType is the device that simulates a part: the device of its model,
+// else its type
+func deviceType(comp *schematic.Component) string {
+	if device := stringProp(comp, "device"); device != "" {
+		return strings.ToLower(device)
+	}
+	return strings.ToLower(comp.Type)
+}
+
+// ============================================
+// Built-in Models
+// ============================================
+
+// BuiltinModels are the models every library starts with
+func BuiltinModels() []*DeviceModel {
+	return []*DeviceModel{
+		{
+			Name: "1N4148", Device: "diode", Description: "Small signal switching diode",
+			Params: map[string]float64{"IS": 2.52e-9, "N": 1.752, "RS": 0.568, "IMAX": 0.3},
+			Pins:   map[string]string{"A": "anode", "K": "cathode", "C": "cathode"},
+		},
+		{
+			Name: "1N4007", Device: "diode", Description: "1 A rectifier diode",
+			Params: map[string]float64{"IS": 7.02767e-9, "N": 1.80803, "RS": 0.0341512, "IMAX": 1},
+			Pins:   map[string]string{"A": "anode", "K": "cathode", "C": "cathode"},
+		},
+		{
+			Name: "2N2222", Device: "npn", Description: "General purpose NPN transistor",
+			Params: map[string]float64{"IS": 1e-14, "BF": 200, "BR": 3, "IMAX": 0.6},
+			Pins:   map[string]string{"C": "collector", "B": "base", "E": "emitter"},
+		},
+		{
+			Name: "BC547", Device: "npn", Description: "General purpose NPN transistor",
+			Params: map[string]float64{"IS": 7.049e-15, "BF": 290, "BR": 7.5, "IMAX": 0.1},
+			Pins:   map[string]string{"C": "collector", "B": "base", "E": "emitter"},
+		},
+		{
+			Name: "2N3906", Device: "pnp", Description: "General purpose PNP transistor",
+			Params: map[string]float64{"IS": 1.41e-15, "BF": 180, "BR": 4, "IMAX": 0.2},
+			Pins:   map[string]string{"C": "collector", "B": "base", "E": "emitter"},
+		},
+		{
+			Name: "DHT22", Device: "sensor", Description: "Digital temperature and humidity sensor (AM2302)",
+			Pins: map[string]string{"VCC": "vcc", "+": "vcc", "GND": "gnd", "-": "gnd", "SDA": "data", "DATA": "data"},
+			Behavior: &Behavior{
+				Supply: Supply{Current: 0.0015, Nominal: 5, MinVoltage: 3.3, MaxVoltage: 6},
+				Inputs: []BehaviorInput{
+					{Name: "temperature", Unit: "°C", Default: 25, Min: -40, Max: 80},
+					{Name: "humidity", Unit: "%", Default: 50, Min: 0, Max: 100},
+				},
+			},
+		},
+		{
+			Name: "DHT11", Device: "sensor", Description: "Digital temperature and humidity sensor",
+			Pins: map[string]string{"VCC": "vcc", "+": "vcc", "GND": "gnd", "-": "gnd", "SDA": "data", "DATA": "data"},
+			Behavior: &Behavior{
+				Supply: Supply{Current: 0.0025, Nominal: 5, MinVoltage: 3.3, MaxVoltage: 5.5},
+				Inputs: []BehaviorInput{
+					{Name: "temperature", Unit: "°C", Default: 25, Min: 0, Max: 50},
+					{Name: "humidity", Unit: "%", Default: 50, Min: 20, Max: 90},
+				},
+			},
+		},
+		{
+			Name: "LM35", Device: "sensor", Description: "Analog temperature sensor, 10 mV/°C",
+			Pins: map[string]string{"+VS": "vcc", "VS": "vcc", "VOUT": "out", "GND": "gnd"},
+			Behavior: &Behavior{
+				Supply: Supply{Current: 0.00006, Nominal: 5, MinVoltage: 4, MaxVoltage: 30},
+				Inputs: []BehaviorInput{{Name: "temperature", Unit: "°C", Default: 25, Min: 2, Max: 150}},
+				Output: &BehaviorOutput{Pin: "out", Input: "temperature", Gain: 0.01},
+			},
+		},
+		{
+			Name: "TMP36", Device: "sensor", Description: "Analog temperature sensor, 750 mV at 25°C",
+			Pins: map[string]string{"+VS": "vcc", "VS": "vcc", "VOUT": "out", "GND": "gnd"},
+			Behavior: &Behavior{
+				Supply: Supply{Current: 0.00005, Nominal: 5, MinVoltage: 2.7, MaxVoltage: 5.5},
+				Inputs: []BehaviorInput{{Name: "temperature", Unit: "°C", Default: 25, Min: -40, Max: 125}},
+				Output: &BehaviorOutput{Pin: "out", Input: "temperature", Gain: 0.01, Offset: 0.5},
+			},
+		},
+	}
+}
@@ -0,0 +1,769 @@
+package simulator
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Event-Driven Logic Simulation
+// ============================================
+
+// Logic is a digital level; X is unknown (floating, contention or uninitialized)
+type Logic byte
+
+const (
+	L0 Logic = iota
+	L1
+	LX
+)
+
+func (l Logic) String() string {
+	switch l {
+	case L0:
+		return "0"
+	case L1:
+		return "1"
+	}
+	return "x"
+}
+
+func logicOf(b bool) Logic {
+	if b {
+		return L1
+	}
+	return L0
+}
+
+func (l Logic) not() Logic {
+	switch l {
+	case L0:
+		return L1
+	case L1:
+		return L0
+	}
+	return LX
+}
+
+const (
+	// LogicTimescale is the unit of every time in a logic result
+	LogicTimescale = "1ps"
+	// MaxLogicEvents bounds the work of a single logic simulation
+	MaxLogicEvents = 1000000
+	// MaxLogicChanges bounds the transitions kept for timing diagrams
+	MaxLogicChanges    = 200000
+	maxDeltaCycles     = 1000
+	maxTruthTableBits  = 10
+	defaultLogicPeriod = 100000  // 100 ns between input vectors
+	defaultLogicStop   = 1000000 // 1 µs
+	clockCyclesShown   = 16
+	maxLogicStopTime   = 1.0 // s
+	picosecond         = 1e-12
+)
+
+// DigitalOptions configures a logic simulation. Inputs are applied as
+// vectors, one every Period; a vector "01:1" also states the outputs
+// expected just before the next vector. Without vectors every input
+// combination is applied, which yields the circuit's truth table.
+type DigitalOptions struct {
+	StopTime int64    `json:"stop_time"` // ps; 0 = vectors × period, or 16 clock cycles
+	Period   int64    `json:"period"`    // ps between vectors
+	Inputs   []string `json:"inputs"`    // input components by ID or name; default all
+	Outputs  []string `json:"outputs"`   // output components by ID or name; default all
+	Vectors  []string `json:"vectors"`
+}
+
+// LogicChange is a signal transition at time T (ps)
+type LogicChange struct {
+	T int64  `json:"t"`
+	V string `json:"v"`
+}
+
+// LogicSignal is the timing diagram of a net or a multi-bit output
+type LogicSignal struct {
+	Name        string        `json:"name"`
+	Kind        string        `json:"kind"` // input, output, display, net
+	ComponentID string        `json:"component_id,omitempty"`
+	Pins        []string      `json:"pins,omitempty"`
+	Width       int           `json:"width"`
+	Changes     []LogicChange `json:"changes"`
+}
+
+// TruthRow is one applied input vector and the outputs it produced
+type TruthRow struct {
+	Time     int64  `json:"time"`
+	Inputs   string `json:"inputs"`
+	Outputs  string `json:"outputs"`
+	Expected string `json:"expected,omitempty"`
+	Pass     *bool  `json:"pass,omitempty"`
+}
+
+// TruthTable collects the rows of a vector run. Verified is set when
+// expected outputs were given.
+type TruthTable struct {
+	Inputs   []string   `json:"inputs"`
+	Outputs  []string   `json:"outputs"`
+	Rows     []TruthRow `json:"rows"`
+	Passed   int        `json:"passed"`
+	Failed   int        `json:"failed"`
+	Verified *bool      `json:"verified,omitempty"`
+}
+
+// DigitalResult is the result of a logic simulation
+type DigitalResult struct {
+	Completed  bool          `json:"completed"`
+	Timescale  string        `json:"timescale"`
+	StopTime   int64         `json:"stop_time"`
+	Period     int64         `json:"period"`
+	Events     int           `json:"events"`
+	Signals    []LogicSignal `json:"signals"`
+	TruthTable *TruthTable   `json:"truth_table,omitempty"`
+	Errors     []Issue       `json:"errors"`
+	Warnings   []Issue       `json:"warnings"`
+}
+
+// Works returns true when the run completed without errors and every
+// expected output matched
+func (r *DigitalResult) Works() bool {
+	if !r.Completed || len(r.Errors) > 0 {
+		return false
+	}
+	return r.TruthTable == nil || r.TruthTable.Verified == nil || *r.TruthTable.Verified
+}
+
+// Seconds converts a logic time to seconds
+func Seconds(t int64) float64 {
+	return float64(t) * picosecond
+}
+
+// Picoseconds converts seconds to a logic time
+func Picoseconds(seconds float64) int64 {
+	return int64(math.Round(seconds / picosecond))
+}
+
+// ============================================
+// Engine
+// ============================================
+
+// logicDriver is an output pin driving a net
+type logicDriver struct {
+	net     int
+	value   Logic
+	pending Logic // last value scheduled
+}
+
+type logicEvent struct {
+	time   int64
+	seq    int
+	driver *logicDriver
+	value  Logic
+	then   func(t int64)
+}
+
+type eventQueue []*logicEvent
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].time != q[j].time {
+		return q[i].time < q[j].time
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*logicEvent)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// logicPart is a digital component
+type logicPart interface {
+	component() *schematic.Component
+	// watches lists the nets whose changes re-evaluate the part
+	watches() []int
+	// evaluate reads the nets and schedules the outputs
+	evaluate(sim *logicSim)
+}
+
+// logicSim is a digital circuit over the shared netlist
+type logicSim struct {
+	netlist  *Netlist
+	parts    []logicPart
+	drivers  [][]*logicDriver // per net
+	fanout   [][]int          // per net: indices into parts
+	values   []Logic          // per net
+	inputs   []*logicInput
+	outputs  []logicObserver
+	clocks   []*logicClock
+	now      int64
+	queue    eventQueue
+	seq      int
+	events   int
+	changes  int
+	signals  []*LogicSignal
+	watchers [][]int // per net: indices into signals
+	issues   issues
+	warned   map[string]bool
+	ctx      context.Context
+	progress *progressTracker
+	stop     int64
+}
+
+// logicObserver is a component whose state is an output of the circuit
+type logicObserver interface {
+	logicPart
+	// read returns the observed value as shown in a truth table
+	read(sim *logicSim) string
+	signal() *LogicSignal
+}
+
+// newDriver adds an output driving net; unwired outputs (net < 0) drive nothing
+func (sim *logicSim) newDriver(net int) *logicDriver {
+	d := &logicDriver{net: net, value: LX, pending: LX}
+	if net >= 0 {
+		sim.drivers[net] = append(sim.drivers[net], d)
+	}
+	return d
+}
+
+func (sim *logicSim) v(net int) Logic {
+	if net < 0 {
+		return LX
+	}
+	return sim.values[net]
+}
+
+// drive schedules an output change after delay (transport delay)
+func (sim *logicSim) drive(d *logicDriver, value Logic, delay int64) {
+	if d.net < 0 || value == d.pending {
+		return
+	}
+	d.pending = value
+	sim.schedule(&logicEvent{time: sim.now + delay, driver: d, value: value})
+}
+
+func (sim *logicSim) schedule(e *logicEvent) {
+	sim.seq++
+	e.seq = sim.seq
+	heap.Push(&sim.queue, e)
+}
+
+// resolve computes a net's level from its drivers
+func (sim *logicSim) resolve(net int) Logic {
+	drivers := sim.drivers[net]
+	if len(drivers) == 0 {
+		return LX
+	}
+	value := drivers[0].value
+	for _, d := range drivers[1:] {
+		if d.value != value {
+			if d.value != LX && value != LX {
+				sim.warnOnce("contention"+fmt.Sprint(net), IssueContention,
+					"Net %s (%s) is driven high and low at once", sim.netlist.Nets[net].Name, strings.Join(sim.netlist.Nets[net].Pins, ", "))
+			}
+			return LX
+		}
+	}
+	return value
+}
+
+func (sim *logicSim) warnOnce(key, code, format string, args ...interface{}) {
+	if sim.warned[key] {
+		return
+	}
+	sim.warned[key] = true
+	sim.issues.warnf("", code, format, args...)
+}
+
+// run processes events until stop. Parts are evaluated once all changes
+// of an instant are applied; zero-delay loops that never settle fail.
+func (sim *logicSim) run(stop int64) error {
+	for sim.queue.Len() > 0 && sim.queue[0].time <= stop {
+		sim.now = sim.queue[0].time
+		for delta := 0; sim.queue.Len() > 0 && sim.queue[0].time == sim.now; delta++ {
+			if delta >= maxDeltaCycles {
+				return fmt.Errorf("the circuit oscillates without delay at %s", schematic.FormatValue(Seconds(sim.now), "s"))
+			}
+			dirty := map[int]bool{}
+			for sim.queue.Len() > 0 && sim.queue[0].time == sim.now {
+				e := heap.Pop(&sim.queue).(*logicEvent)
+				sim.events++
+				if sim.events > MaxLogicEvents {
+					return fmt.Errorf("the simulation exceeded %d events", MaxLogicEvents)
+				}
+				if sim.events%1024 == 0 {
+					if err := sim.ctx.Err(); err != nil {
+						return err
+					}
+				}
+				if e.driver != nil {
+					e.driver.value = e.value
+					if value := sim.resolve(e.driver.net); value != sim.values[e.driver.net] {
+						sim.values[e.driver.net] = value
+						sim.record(e.driver.net)
+						for _, p := range sim.fanout[e.driver.net] {
+							dirty[p] = true
+						}
+					}
+				}
+				if e.then != nil {
+					e.then(sim.now)
+				}
+			}
+			for i, p := range sim.parts {
+				if dirty[i] {
+					p.evaluate(sim)
+				}
+			}
+		}
+		if done := float64(sim.now) / float64(sim.stop); sim.progress.due(done) {
+			sim.progress.send(done, Seconds(sim.now), nil, &sim.issues)
+		}
+	}
+	sim.now = stop
+	return nil
+}
+
+// record notes a net change on the signals that watch it
+func (sim *logicSim) record(net int) {
+	for _, i := range sim.watchers[net] {
+		sig := sim.signals[i]
+		value := sim.values[net].String()
+		if sig.Kind == "display" {
+			continue
+		}
+		sim.appendChange(sig, value)
+	}
+}
+
+func (sim *logicSim) appendChange(sig *LogicSignal, value string) {
+	n := len(sig.Changes)
+	if n > 0 && sig.Changes[n-1].V == value {
+		return
+	}
+	if n > 0 && sig.Changes[n-1].T == sim.now {
+		sig.Changes[n-1].V = value
+		return
+	}
+	if sim.changes >= MaxLogicChanges {
+		sim.warnOnce("changes", IssueTruncated, "Timing diagrams were cut after %d transitions", MaxLogicChanges)
+		return
+	}
+	sim.changes++
+	sig.Changes = append(sig.Changes, LogicChange{T: sim.now, V: value})
+}
+
+// ============================================
+// Building
+// ============================================
+
+// BuildLogic compiles a schema into a digital circuit. Components without
+// a logic model are reported as warnings and left out; resistors pass
+// levels from a driven net to an undriven one, so pull-ups and LED
+// resistors behave.
+func BuildLogic(schema *schematic.Schema) *logicSim {
+	nl := buildNetlist(schema)
+	sim := &logicSim{netlist: nl, warned: map[string]bool{}, ctx: context.Background(), progress: newProgressTracker(nil)}
+
+	var resistors []schematic.Component
+	for _, comp := range schema.Components {
+		t := strings.ToLower(comp.Type)
+		switch {
+		case virtualTypes[t]:
+			continue
+		case t == "resistor":
+			resistors = append(resistors, comp)
+			continue
+		}
+		part, known := newLogicPart(comp, t, sim)
+		if !known {
+			sim.issues.warnf(comp.ID, IssueUnsupportedComponent, "%s (%s) has no logic model and was ignored", displayName(comp), comp.Type)
+			continue
+		}
+		sim.parts = append(sim.parts, part)
+	}
+
+	for _, comp := range resistors {
+		a, okA := nl.lookup(comp.ID, pin1Pins)
+		b, okB := nl.lookup(comp.ID, pin2Pins)
+		if !okA || !okB {
+			continue
+		}
+		sim.ensureNets()
+		switch {
+		case len(sim.drivers[a]) > 0 && len(sim.drivers[b]) == 0:
+			sim.parts = append(sim.parts, newPassThrough(comp, sim, a, b))
+		case len(sim.drivers[b]) > 0 && len(sim.drivers[a]) == 0:
+			sim.parts = append(sim.parts, newPassThrough(comp, sim, b, a))
+		}
+	}
+
+	sim.ensureNets()
+	sim.fanout = make([][]int, len(nl.Nets))
+	for i, p := range sim.parts {
+		for _, net := range p.watches() {
+			if net >= 0 {
+				sim.fanout[net] = append(sim.fanout[net], i)
+			}
+		}
+	}
+	for net := 1; net < len(nl.Nets); net++ {
+		if len(sim.fanout[net]) > 0 && len(sim.drivers[net]) == 0 {
+			sim.issues.warnf("", IssueFloatingNode, "Net %s (%s) is read but nothing drives it; it stays unknown",
+				nl.Nets[net].Name, strings.Join(nl.Nets[net].Pins, ", "))
+		}
+	}
+	return sim
+}
+
+// ensureNets sizes the per-net tables; parts may add nets for unwired pins
+func (sim *logicSim) ensureNets() {
+	for len(sim.drivers) < len(sim.netlist.Nets) {
+		sim.drivers = append(sim.drivers, nil)
+	}
+}
+
+// findInput resolves an input component by ID or name
+func (sim *logicSim) findInput(ref string) *logicInput {
+	for _, in := range sim.inputs {
+		if in.comp.ID == ref || strings.EqualFold(displayName(in.comp), ref) {
+			return in
+		}
+	}
+	return nil
+}
+
+func (sim *logicSim) findOutput(ref string) logicObserver {
+	for _, out := range sim.outputs {
+		comp := out.component()
+		if comp.ID == ref || strings.EqualFold(displayName(*comp), ref) {
+			return out
+		}
+	}
+	return nil
+}
+
+// ============================================
+// Running
+// ============================================
+
+// AnalyzeDigital runs a logic simulation of a schema
+func AnalyzeDigital(schema *schematic.Schema, opts DigitalOptions) *DigitalResult {
+	return BuildLogic(schema).Simulate(opts)
+}
+
+// WithContext makes the simulation stop with a "cancelled" error once ctx
+// is done
+func (sim *logicSim) WithContext(ctx context.Context) *logicSim {
+	sim.ctx = ctx
+	return sim
+}
+
+// WithProgress has the simulation report its progress through the
+// simulated time while it runs
+func (sim *logicSim) WithProgress(report ProgressFunc) *logicSim {
+	sim.progress = newProgressTracker(report)
+	return sim
+}
+
+// fail reports why the event loop stopped
+func (sim *logicSim) fail(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		sim.issues.errorf("", IssueCancelled, "%s at %s", cancelMessage(err), schematic.FormatValue(Seconds(sim.now), "s"))
+		return
+	}
+	sim.issues.errorf("", IssueNotConverged, "%s", err.Error())
+}
+
+// Simulate applies the input vectors and records the timing diagrams
+func (sim *logicSim) Simulate(opts DigitalOptions) *DigitalResult {
+	result := &DigitalResult{Timescale: LogicTimescale, Signals: []LogicSignal{}}
+	defer func() {
+		result.Errors, result.Warnings = sim.issues.Errors, sim.issues.Warnings
+	}()
+
+	if len(sim.parts) == 0 {
+		sim.issues.errorf("", IssueEmptyCircuit, "The circuit has no logic components to simulate")
+		return result
+	}
+
+	inputs, outputs, ok := sim.selectPorts(opts)
+	if !ok {
+		return result
+	}
+
+	// Vectors: given, or every combination of the inputs
+	vectors := opts.Vectors
+	if len(vectors) == 0 && len(inputs) > 0 {
+		if len(inputs) > maxTruthTableBits {
+			sim.issues.errorf("", IssueTooManyInputs, "A full truth table of %d inputs is too large; give vectors instead (at most %d inputs)", len(inputs), maxTruthTableBits)
+			return result
+		}
+		for k := 0; k < 1<<len(inputs); k++ {
+			bits := make([]byte, len(inputs))
+			for i := range inputs {
+				bits[i] = '0' + byte(k>>(len(inputs)-1-i)&1)
+			}
+			vectors = append(vectors, string(bits))
+		}
+	}
+	applied, expected, ok := sim.parseVectors(vectors, len(inputs), len(outputs))
+	if !ok {
+		return result
+	}
+
+	period := opts.Period
+	if period <= 0 {
+		period = defaultLogicPeriod
+	}
+	stop := opts.StopTime
+	if stop <= 0 {
+		stop = int64(len(applied)) * period
+		if stop == 0 {
+			stop = defaultLogicStop
+			if slowest := sim.slowestClock(); slowest > 0 {
+				stop = clockCyclesShown * slowest
+			}
+		}
+	}
+	result.StopTime, result.Period = stop, period
+
+	sim.startRecording(outputs)
+	sim.stop = stop
+	sim.start(stop)
+
+	var table *TruthTable
+	if len(applied) > 0 {
+		table = &TruthTable{Inputs: []string{}, Outputs: []string{}, Rows: []TruthRow{}}
+		for _, in := range inputs {
+			table.Inputs = append(table.Inputs, displayName(in.comp))
+		}
+		for _, out := range outputs {
+			table.Outputs = append(table.Outputs, displayName(*out.component()))
+		}
+	}
+
+	for k, vector := range applied {
+		at := int64(k) * period
+		if at >= stop {
+			break
+		}
+		for i, in := range inputs {
+			in.set(sim, vector[i], at)
+		}
+		sample := at + period - 1
+		if sample > stop {
+			sample = stop
+		}
+		if err := sim.run(sample); err != nil {
+			sim.fail(err)
+			return result
+		}
+
+		row := TruthRow{Time: at, Inputs: logicString(vector)}
+		for _, out := range outputs {
+			row.Outputs += out.read(sim)
+		}
+		if expected != nil {
+			pass := matchOutputs(row.Outputs, expected[k])
+			row.Expected, row.Pass = expected[k], &pass
+			if pass {
+				table.Passed++
+			} else {
+				table.Failed++
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	if err := sim.run(stop); err != nil {
+		sim.fail(err)
+		return result
+	}
+
+	if table != nil && expected != nil {
+		verified := table.Failed == 0 && len(table.Rows) == len(applied)
+		table.Verified = &verified
+		if !verified {
+			sim.issues.warnf("", IssueTruthTableMismatch, "%d of %d rows do not match the expected outputs", len(applied)-table.Passed, len(applied))
+		}
+	}
+	sim.progress.send(1, Seconds(stop), nil, &sim.issues)
+	result.TruthTable = table
+	result.Events = sim.events
+	for _, sig := range sim.signals {
+		result.Signals = append(result.Signals, *sig)
+	}
+	result.Completed = true
+	return result
+}
+
+// selectPorts resolves the inputs and outputs a run applies and samples
+func (sim *logicSim) selectPorts(opts DigitalOptions) ([]*logicInput, []logicObserver, bool) {
+	inputs := sim.inputs
+	if len(opts.Inputs) > 0 {
+		inputs = nil
+		for _, ref := range opts.Inputs {
+			in := sim.findInput(ref)
+			if in == nil {
+				sim.issues.errorf("", IssueUnknownProbe, "Input %q is not a logic input of this circuit", ref)
+				return nil, nil, false
+			}
+			inputs = append(inputs, in)
+		}
+	}
+	outputs := sim.outputs
+	if len(opts.Outputs) > 0 {
+		outputs = nil
+		for _, ref := range opts.Outputs {
+			out := sim.findOutput(ref)
+			if out == nil {
+				sim.issues.errorf("", IssueUnknownProbe, "Output %q is not a logic output of this circuit", ref)
+				return nil, nil, false
+			}
+			outputs = append(outputs, out)
+		}
+	}
+	return inputs, outputs, true
+}
+
+// parseVectors splits "inputs:expected" vectors and checks their widths
+func (sim *logicSim) parseVectors(vectors []string, inputs, outputs int) ([][]Logic, []string, bool) {
+	var applied [][]Logic
+	var expected []string
+	for k, vector := range vectors {
+		in, want, hasExpected := strings.Cut(strings.ReplaceAll(vector, " ", ""), ":")
+		if len(in) != inputs {
+			sim.issues.errorf("", IssueInvalidVector, "Vector %d (%q) sets %d inputs, the circuit has %d", k+1, vector, len(in), inputs)
+			return nil, nil, false
+		}
+		levels := make([]Logic, len(in))
+		for i, c := range in {
+			switch c {
+			case '0':
+				levels[i] = L0
+			case '1':
+				levels[i] = L1
+			default:
+				sim.issues.errorf("", IssueInvalidVector, "Vector %d (%q) may only contain 0 and 1", k+1, vector)
+				return nil, nil, false
+			}
+		}
+		applied = append(applied, levels)
+
+		if hasExpected {
+			if k > 0 && expected == nil {
+				sim.issues.errorf("", IssueInvalidVector, "Vector %d states expected outputs but earlier vectors do not", k+1)
+				return nil, nil, false
+			}
+			if len([]rune(want)) != outputs {
+				sim.issues.errorf("", IssueInvalidVector, "Vector %d expects %d outputs, the run samples %d", k+1, len([]rune(want)), outputs)
+				return nil, nil, false
+			}
+			expected = append(expected, want)
+		} else if expected != nil {
+			sim.issues.errorf("", IssueInvalidVector, "Vector %d is missing its expected outputs", k+1)
+			return nil, nil, false
+		}
+	}
+	return applied, expected, true
+}
+
+// matchOutputs compares sampled outputs with expected ones; "x" and "-"
+// in the expectation accept anything
+func matchOutputs(got, want string) bool {
+	g, w := []rune(got), []rune(want)
+	if len(g) != len(w) {
+		return false
+	}
+	for i := range w {
+		if w[i] != 'x' && w[i] != 'X' && w[i] != '-' && !strings.EqualFold(string(w[i]), string(g[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func logicString(levels []Logic) string {
+	var b strings.Builder
+	for _, l := range levels {
+		b.WriteString(l.String())
+	}
+	return b.String()
+}
+
+// startRecording creates the timing diagram signals: inputs, outputs,
+// then the remaining nets that parts drive
+func (sim *logicSim) startRecording(outputs []logicObserver) {
+	sim.watchers = make([][]int, len(sim.netlist.Nets))
+	covered := map[int]bool{}
+	add := func(sig *LogicSignal, nets ...int) {
+		sim.signals = append(sim.signals, sig)
+		for _, net := range nets {
+			if net >= 0 {
+				sim.watchers[net] = append(sim.watchers[net], len(sim.signals)-1)
+				covered[net] = true
+			}
+		}
+	}
+
+	for _, in := range sim.inputs {
+		add(&LogicSignal{Name: displayName(in.comp), Kind: "input", ComponentID: in.comp.ID, Width: 1, Changes: []LogicChange{}}, in.out.net)
+	}
+	for _, clk := range sim.clocks {
+		add(&LogicSignal{Name: displayName(clk.comp), Kind: "input", ComponentID: clk.comp.ID, Width: 1, Changes: []LogicChange{}}, clk.out.net)
+	}
+	for _, out := range sim.outputs {
+		add(out.signal(), out.watches()...)
+	}
+	for net := 1; net < len(sim.netlist.Nets); net++ {
+		if covered[net] || len(sim.drivers[net]) == 0 || len(sim.netlist.Nets[net].Pins) == 0 {
+			continue
+		}
+		n := sim.netlist.Nets[net]
+		add(&LogicSignal{Name: n.Name, Kind: "net", Pins: n.Pins, Width: 1, Changes: []LogicChange{}}, net)
+	}
+}
+
+// start settles the circuit at time 0: nets begin unknown, constant
+// drivers and clocks start, and every part evaluates once
+func (sim *logicSim) start(stop int64) {
+	sim.values = make([]Logic, len(sim.netlist.Nets))
+	for i := range sim.values {
+		sim.values[i] = LX
+	}
+	sim.queue = eventQueue{}
+	// Ground is always low
+	if len(sim.drivers) > 0 {
+		ground := sim.newDriver(0)
+		sim.drive(ground, L0, 0)
+	}
+	for _, clk := range sim.clocks {
+		clk.startAt(sim, stop)
+	}
+	for _, p := range sim.parts {
+		p.evaluate(sim)
+	}
+	for _, sig := range sim.signals {
+		if len(sig.Changes) == 0 && sig.Kind != "display" {
+			sig.Changes = append(sig.Changes, LogicChange{T: 0, V: LX.String()})
+		}
+	}
+}
+
+func (sim *logicSim) slowestClock() int64 {
+	var slowest int64
+	for _, clk := range sim.clocks {
+		if clk.period > slowest {
+			slowest = clk.period
+		}
+	}
+	return slowest
+}
@@ -0,0 +1,775 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Logic Components
+// ============================================
+
+var (
+	logicOutPins    = []string{"y", "out", "output", "q", "o", "z"}
+	logicInPins     = []string{"in", "a", "input", "d", "signal", "pin", "p1", "1"}
+	logicPowerPins  = []string{"vcc", "gnd", "vdd", "vss", "v+", "v-"}
+	clockPins       = []string{"clk", "clock", "ck", "cp"}
+	setPins         = []string{"set", "pre", "preset", "s"}
+	resetPins       = []string{"reset", "clr", "clear", "rst", "mr", "r"}
+	enablePins      = []string{"en", "enable", "e", "ce", "g"}
+	invertedOutPins = []string{"qn", "q_bar", "qbar", "nq", "q'", "not_q"}
+	segmentNames    = []string{"a", "b", "c", "d", "e", "f", "g"}
+)
+
+// Default propagation delays in picoseconds
+const (
+	gateDelay     = 10000
+	inverterDelay = 5000
+	flipFlopDelay = 15000
+	counterDelay  = 20000
+	muxDelay      = 12000
+	decoderDelay  = 20000
+)
+
+// sevenSegmentGlyphs are the lit segments (a..g) of hex digits
+var sevenSegmentGlyphs = map[rune]string{
+	'0': "1111110", '1': "0110000", '2': "1101101", '3': "1111001",
+	'4': "0110011", '5': "1011011", '6': "1011111", '7': "1110000",
+	'8': "1111111", '9': "1111011", 'A': "1110111", 'b': "0011111",
+	'C': "1001110", 'd': "0111101", 'E': "1001111", 'F': "1000111",
+}
+
+const hexDigits = "0123456789AbCdEF"
+
+// gateKinds maps component types to gate functions
+var gateKinds = map[string]string{
+	"and": "and", "and_gate": "and", "gate_and": "and",
+	"or": "or", "or_gate": "or", "gate_or": "or",
+	"nand": "nand", "nand_gate": "nand", "gate_nand": "nand",
+	"nor": "nor", "nor_gate": "nor", "gate_nor": "nor",
+	"xor": "xor", "xor_gate": "xor", "gate_xor": "xor",
+	"xnor": "xnor", "xnor_gate": "xnor", "gate_xnor": "xnor",
+	"not": "not", "not_gate": "not", "gate_not": "not", "inverter": "not",
+	"buffer": "buffer", "buf": "buffer", "buffer_gate": "buffer",
+}
+
+var flipFlopKinds = map[string]string{
+	"d_flip_flop": "d", "dff": "d", "flip_flop_d": "d", "d_flipflop": "d",
+	"jk_flip_flop": "jk", "jkff": "jk", "flip_flop_jk": "jk", "jk_flipflop": "jk",
+	"t_flip_flop": "t", "tff": "t", "flip_flop_t": "t", "t_flipflop": "t",
+	"sr_latch": "sr", "sr_flip_flop": "sr", "rs_latch": "sr",
+	"d_latch": "dlatch", "gated_d_latch": "dlatch",
+}
+
+var logicInputTypes = map[string]bool{
+	"logic_input": true, "input": true, "input_pin": true, "logic_switch": true,
+	"binary_input": true, "digital_input": true,
+}
+
+var logicOutputTypes = map[string]bool{
+	"logic_output": true, "output": true, "output_pin": true, "logic_probe": true,
+	"probe": true, "digital_output": true, "led": true,
+}
+
+var logicClockTypes = map[string]bool{
+	"clock": true, "clock_source": true, "clock_generator": true, "pwm_source": true,
+}
+
+// newLogicPart builds the logic model of a component. known is false for
+// types without one.
+func newLogicPart(comp schematic.Component, t string, sim *logicSim) (part logicPart, known bool) {
+	b := logicBase{comp: comp}
+	switch {
+	case gateKinds[t] != "":
+		return newGate(b, gateKinds[t], sim), true
+	case flipFlopKinds[t] != "":
+		return newFlipFlop(b, flipFlopKinds[t], sim), true
+	case logicClockTypes[t]:
+		clk := newLogicClock(b, sim)
+		sim.clocks = append(sim.clocks, clk)
+		return clk, true
+	case voltageSourceTypes[t] != "":
+		return newLogicConstant(b, sim), true
+	case logicInputTypes[t]:
+		in := &logicInput{logicBase: b, initial: logicOf(boolProp(&comp, "value", "state", "on", "high"))}
+		in.out = sim.newDriver(sim.pin(comp, logicOutPins))
+		sim.inputs = append(sim.inputs, in)
+		return in, true
+	case logicOutputTypes[t]:
+		pins := logicInPins
+		if t == "led" {
+			pins = anodePins
+		}
+		out := &logicOutput{logicBase: b, in: sim.pin(comp, pins)}
+		sim.outputs = append(sim.outputs, out)
+		return out, true
+	}
+
+	switch t {
+	case "counter", "binary_counter", "decade_counter", "up_counter", "counter_4bit":
+		return newCounter(b, t, sim), true
+	case "mux", "multiplexer", "mux_2to1", "mux_4to1", "mux_8to1":
+		return newMux(b, sim), true
+	case "bcd_to_7seg", "seven_segment_decoder", "7seg_decoder", "bcd_decoder", "hex_decoder":
+		return newSegmentDecoder(b, sim), true
+	case "seven_segment", "seven_segment_display", "7_segment", "7seg", "7segment_display":
+		d := newSegmentDisplay(b, sim)
+		sim.outputs = append(sim.outputs, d)
+		return d, true
+	}
+	return nil, false
+}
+
+// logicBase implements what all logic parts share
+type logicBase struct {
+	comp  schematic.Component
+	delay int64
+}
+
+func (b *logicBase) component() *schematic.Component { return &b.comp }
+
+// delayOf reads a propagation delay in nanoseconds, defaulting to def picoseconds
+func delayOf(comp *schematic.Component, def int64) int64 {
+	ns := floatProp(comp, float64(def)/1000, "delay_ns", "delay", "propagation_delay")
+	return int64(math.Round(math.Max(ns, 0) * 1000))
+}
+
+// pin finds the net of the first wired pin among aliases, or of the only
+// wired pin; -1 when neither exists
+func (sim *logicSim) pin(comp schematic.Component, aliases []string) int {
+	if net, ok := sim.netlist.lookup(comp.ID, aliases); ok {
+		sim.ensureNets()
+		return net
+	}
+	wired := sim.netlist.wiredPins(comp.ID)
+	if len(wired) == 1 {
+		for _, net := range wired {
+			sim.ensureNets()
+			return net
+		}
+	}
+	return -1
+}
+
+// optional finds the net of the first wired pin among aliases, or -1
+func (sim *logicSim) optional(comp schematic.Component, aliases ...string) int {
+	if net, ok := sim.netlist.lookup(comp.ID, aliases); ok {
+		sim.ensureNets()
+		return net
+	}
+	return -1
+}
+
+func isAny(pin string, lists ...[]string) bool {
+	for _, list := range lists {
+		for _, p := range list {
+			if p == pin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ============================================
+// Gates
+// ============================================
+
+type gate struct {
+	logicBase
+	kind string
+	ins  []int
+	out  *logicDriver
+}
+
+func newGate(b logicBase, kind string, sim *logicSim) *gate {
+	def := int64(gateDelay)
+	if kind == "not" || kind == "buffer" {
+		def = inverterDelay
+	}
+	g := &gate{logicBase: b, kind: kind}
+	g.delay = delayOf(&b.comp, def)
+	g.out = sim.newDriver(sim.optional(b.comp, logicOutPins...))
+
+	// Every other wired pin is an input, in pin name order
+	wired := sim.netlist.wiredPins(b.comp.ID)
+	names := []string{}
+	for pin := range wired {
+		if !isAny(pin, logicOutPins, logicPowerPins) {
+			names = append(names, pin)
+		}
+	}
+	sort.Strings(names)
+	for _, pin := range names {
+		g.ins = append(g.ins, wired[pin])
+	}
+	return g
+}
+
+func (g *gate) watches() []int { return g.ins }
+
+func (g *gate) evaluate(sim *logicSim) {
+	if len(g.ins) == 0 {
+		return
+	}
+	var value Logic
+	switch g.kind {
+	case "and", "nand":
+		value = L1
+		for _, net := range g.ins {
+			switch sim.v(net) {
+			case L0:
+				value = L0
+			case LX:
+				if value == L1 {
+					value = LX
+				}
+			}
+		}
+	case "or", "nor":
+		value = L0
+		for _, net := range g.ins {
+			switch sim.v(net) {
+			case L1:
+				value = L1
+			case LX:
+				if value == L0 {
+					value = LX
+				}
+			}
+		}
+	case "xor", "xnor":
+		value = L0
+		for _, net := range g.ins {
+			in := sim.v(net)
+			if in == LX {
+				value = LX
+				break
+			}
+			if in == L1 {
+				value = value.not()
+			}
+		}
+	default: // not, buffer
+		value = sim.v(g.ins[0])
+	}
+
+	switch g.kind {
+	case "nand", "nor", "xnor", "not":
+		value = value.not()
+	}
+	sim.drive(g.out, value, g.delay)
+}
+
+// ============================================
+// Flip-Flops and Latches
+// ============================================
+
+// flipFlop covers edge-triggered D, JK and T flip-flops (rising edge,
+// or falling with "edge": "falling") and level-sensitive SR and D
+// latches. Set and reset are asynchronous and active high.
+type flipFlop struct {
+	logicBase
+	kind                  string
+	d, j, k, t, s, r, clk int
+	set, reset, enable    int
+	q, qn                 *logicDriver
+	state, lastClk        Logic
+	falling               bool
+}
+
+func newFlipFlop(b logicBase, kind string, sim *logicSim) *flipFlop {
+	ff := &flipFlop{
+		logicBase: b,
+		kind:      kind,
+		clk:       sim.optional(b.comp, clockPins...),
+		q:         sim.newDriver(sim.optional(b.comp, "q", "out", "y")),
+		qn:        sim.newDriver(sim.optional(b.comp, invertedOutPins...)),
+		state:     logicOf(boolProp(&b.comp, "initial_state", "initial")),
+		lastClk:   LX,
+		falling:   strings.EqualFold(stringProp(&b.comp, "edge"), "falling"),
+		d:         -1, j: -1, k: -1, t: -1, s: -1, r: -1, set: -1, reset: -1, enable: -1,
+	}
+	ff.delay = delayOf(&b.comp, flipFlopDelay)
+
+	switch kind {
+	case "sr":
+		ff.s, ff.r = sim.optional(b.comp, "s", "set"), sim.optional(b.comp, "r", "reset")
+	default:
+		ff.set, ff.reset = sim.optional(b.comp, setPins...), sim.optional(b.comp, resetPins...)
+		switch kind {
+		case "d":
+			ff.d = sim.optional(b.comp, "d", "data", "in")
+		case "dlatch":
+			ff.d, ff.enable = sim.optional(b.comp, "d", "data", "in"), sim.optional(b.comp, enablePins...)
+		case "jk":
+			ff.j, ff.k = sim.optional(b.comp, "j"), sim.optional(b.comp, "k")
+		case "t":
+			ff.t = sim.optional(b.comp, "t", "toggle")
+		}
+	}
+	return ff
+}
+
+func (ff *flipFlop) watches() []int {
+	return []int{ff.d, ff.j, ff.k, ff.t, ff.s, ff.r, ff.clk, ff.set, ff.reset, ff.enable}
+}
+
+func (ff *flipFlop) evaluate(sim *logicSim) {
+	clk := sim.v(ff.clk)
+	edge := ff.lastClk == L0 && clk == L1
+	if ff.falling {
+		edge = ff.lastClk == L1 && clk == L0
+	}
+	ff.lastClk = clk
+
+	set, reset := ff.set >= 0 && sim.v(ff.set) == L1, ff.reset >= 0 && sim.v(ff.reset) == L1
+	switch {
+	case set && reset:
+		ff.state = LX
+	case reset:
+		ff.state = L0
+	case set:
+		ff.state = L1
+	case ff.kind == "sr":
+		s, r := sim.v(ff.s), sim.v(ff.r)
+		switch {
+		case s == L1 && r == L1:
+			ff.state = LX
+			sim.warnOnce("sr"+ff.comp.ID, IssueInvalidState, "%s has S and R high together; its output is undefined", displayName(ff.comp))
+		case s == L1:
+			ff.state = L1
+		case r == L1:
+			ff.state = L0
+		case s == LX || r == LX:
+			ff.state = LX
+		}
+	case ff.kind == "dlatch":
+		if en := sim.v(ff.enable); en == L1 || ff.enable < 0 {
+			ff.state = sim.v(ff.d)
+		}
+	case edge:
+		ff.state = ff.next(sim)
+	}
+
+	sim.drive(ff.q, ff.state, ff.delay)
+	sim.drive(ff.qn, ff.state.not(), ff.delay)
+}
+
+// next is the state after a clock edge
+func (ff *flipFlop) next(sim *logicSim) Logic {
+	switch ff.kind {
+	case "d":
+		return sim.v(ff.d)
+	case "t":
+		if ff.t < 0 || sim.v(ff.t) == L1 {
+			return ff.state.not()
+		}
+		if sim.v(ff.t) == LX {
+			return LX
+		}
+		return ff.state
+	case "jk":
+		j, k := sim.v(ff.j), sim.v(ff.k)
+		switch {
+		case j == LX || k == LX:
+			return LX
+		case j == L1 && k == L1:
+			return ff.state.not()
+		case j == L1:
+			return L1
+		case k == L1:
+			return L0
+		}
+	}
+	return ff.state
+}
+
+// ============================================
+// Counters, Multiplexers and Decoders
+// ============================================
+
+// counter is a synchronous binary counter with asynchronous reset
+type counter struct {
+	logicBase
+	clk, reset, enable int
+	outs               []*logicDriver
+	carry              *logicDriver
+	modulo             int
+	down               bool
+	count              int
+	lastClk            Logic
+}
+
+func newCounter(b logicBase, t string, sim *logicSim) *counter {
+	bits := int(floatProp(&b.comp, 4, "bits", "width"))
+	bits = int(math.Min(math.Max(float64(bits), 1), 16))
+	modulo := 1 << bits
+	if t == "decade_counter" {
+		modulo = 10
+	}
+	if m := int(floatProp(&b.comp, 0, "modulo", "modulus")); m >= 2 && m <= 1<<bits {
+		modulo = m
+	}
+
+	c := &counter{
+		logicBase: b,
+		clk:       sim.optional(b.comp, clockPins...),
+		reset:     sim.optional(b.comp, resetPins...),
+		enable:    sim.optional(b.comp, enablePins...),
+		modulo:    modulo,
+		down:      strings.EqualFold(stringProp(&b.comp, "direction"), "down"),
+		lastClk:   LX,
+	}
+	c.delay = delayOf(&b.comp, counterDelay)
+	for i := 0; i < bits; i++ {
+		aliases := []string{fmt.Sprintf("q%d", i), fmt.Sprintf("o%d", i)}
+		if i < 4 {
+			aliases = append(aliases, "q"+string(rune('a'+i)))
+		}
+		c.outs = append(c.outs, sim.newDriver(sim.optional(b.comp, aliases...)))
+	}
+	c.carry = sim.newDriver(sim.optional(b.comp, "carry", "co", "tc", "rco", "cout"))
+	return c
+}
+
+func (c *counter) watches() []int { return []int{c.clk, c.reset, c.enable} }
+
+func (c *counter) evaluate(sim *logicSim) {
+	clk := sim.v(c.clk)
+	edge := c.lastClk == L0 && clk == L1
+	c.lastClk = clk
+
+	enabled := c.enable < 0 || sim.v(c.enable) == L1
+	switch {
+	case c.reset >= 0 && sim.v(c.reset) == L1:
+		c.count = 0
+	case edge && enabled && c.down:
+		c.count = (c.count + c.modulo - 1) % c.modulo
+	case edge && enabled:
+		c.count = (c.count + 1) % c.modulo
+	}
+
+	for i, out := range c.outs {
+		sim.drive(out, logicOf(c.count>>i&1 == 1), c.delay)
+	}
+	terminal := c.count == c.modulo-1
+	if c.down {
+		terminal = c.count == 0
+	}
+	sim.drive(c.carry, logicOf(terminal), c.delay)
+}
+
+// mux selects one of 2, 4 or 8 data inputs
+type mux struct {
+	logicBase
+	data []int
+	sel  []int
+	out  *logicDriver
+}
+
+func newMux(b logicBase, sim *logicSim) *mux {
+	size := int(floatProp(&b.comp, 0, "inputs", "size"))
+	if size == 0 {
+		for i := 0; i < 8; i++ {
+			if sim.optional(b.comp, dataAliases(i)...) >= 0 {
+				size = i + 1
+			}
+		}
+	}
+	selectBits := int(math.Ceil(math.Log2(math.Max(float64(size), 2))))
+	selectBits = int(math.Min(float64(selectBits), 3))
+
+	m := &mux{logicBase: b, out: sim.newDriver(sim.optional(b.comp, logicOutPins...))}
+	m.delay = delayOf(&b.comp, muxDelay)
+	for i := 0; i < 1<<selectBits; i++ {
+		m.data = append(m.data, sim.optional(b.comp, dataAliases(i)...))
+	}
+	for i := 0; i < selectBits; i++ {
+		aliases := []string{fmt.Sprintf("s%d", i), fmt.Sprintf("sel%d", i)}
+		if selectBits == 1 {
+			aliases = append(aliases, "s", "sel", "select")
+		}
+		m.sel = append(m.sel, sim.optional(b.comp, aliases...))
+	}
+	return m
+}
+
+func dataAliases(i int) []string {
+	return []string{fmt.Sprintf("d%d", i), fmt.Sprintf("i%d", i), fmt.Sprintf("in%d", i)}
+}
+
+func (m *mux) watches() []int { return append(append([]int{}, m.data...), m.sel...) }
+
+func (m *mux) evaluate(sim *logicSim) {
+	index := 0
+	for i, net := range m.sel {
+		switch sim.v(net) {
+		case LX:
+			// An unknown select still yields a level all inputs agree on
+			value := sim.v(m.data[0])
+			for _, d := range m.data[1:] {
+				if sim.v(d) != value {
+					value = LX
+				}
+			}
+			sim.drive(m.out, value, m.delay)
+			return
+		case L1:
+			index |= 1 << i
+		}
+	}
+	sim.drive(m.out, sim.v(m.data[index]), m.delay)
+}
+
+// segmentDecoder drives a 7-segment display from a 4-bit value (d0 is the
+// least significant bit); 10-15 show as hex digits
+type segmentDecoder struct {
+	logicBase
+	ins       []int
+	segments  []*logicDriver
+	activeLow bool
+}
+
+func newSegmentDecoder(b logicBase, sim *logicSim) *segmentDecoder {
+	d := &segmentDecoder{
+		logicBase: b,
+		activeLow: boolProp(&b.comp, "active_low") || strings.EqualFold(stringProp(&b.comp, "common"), "anode"),
+	}
+	d.delay = delayOf(&b.comp, decoderDelay)
+	for i := 0; i < 4; i++ {
+		d.ins = append(d.ins, sim.optional(b.comp, fmt.Sprintf("d%d", i), fmt.Sprintf("a%d", i), fmt.Sprintf("in%d", i), fmt.Sprintf("b%d", i)))
+	}
+	for _, seg := range segmentNames {
+		d.segments = append(d.segments, sim.newDriver(sim.optional(b.comp, seg, "seg_"+seg)))
+	}
+	return d
+}
+
+func (d *segmentDecoder) watches() []int { return d.ins }
+
+func (d *segmentDecoder) evaluate(sim *logicSim) {
+	value := 0
+	for i, net := range d.ins {
+		switch sim.v(net) {
+		case LX:
+			if net >= 0 {
+				for _, seg := range d.segments {
+					sim.drive(seg, LX, d.delay)
+				}
+				return
+			}
+		case L1:
+			value |= 1 << i
+		}
+	}
+
+	glyph := sevenSegmentGlyphs[rune(hexDigits[value])]
+	for i, seg := range d.segments {
+		lit := glyph[i] == '1'
+		sim.drive(seg, logicOf(lit != d.activeLow), d.delay)
+	}
+}
+
+// ============================================
+// Sources and Observers
+// ============================================
+
+// logicInput is a switch the stimulus vectors set
+type logicInput struct {
+	logicBase
+	out     *logicDriver
+	initial Logic
+}
+
+func (in *logicInput) watches() []int { return nil }
+
+func (in *logicInput) evaluate(sim *logicSim) {
+	sim.drive(in.out, in.initial, 0)
+}
+
+// set changes the input at time at
+func (in *logicInput) set(sim *logicSim, value Logic, at int64) {
+	if in.out.net < 0 {
+		return
+	}
+	in.out.pending = value
+	sim.schedule(&logicEvent{time: at, driver: in.out, value: value})
+}
+
+// logicClock is a free-running square wave starting low
+type logicClock struct {
+	logicBase
+	out          *logicDriver
+	period, high int64
+}
+
+func newLogicClock(b logicBase, sim *logicSim) *logicClock {
+	frequency := floatProp(&b.comp, 1000, "frequency")
+	if frequency <= 0 {
+		frequency = 1000
+	}
+	period := int64(math.Max(math.Round(1/frequency/picosecond), 2))
+	duty := normalizeDuty(floatProp(&b.comp, 0.5, "duty_cycle", "duty"))
+	high := int64(math.Round(float64(period) * duty))
+	high = int64(math.Min(math.Max(float64(high), 1), float64(period-1)))
+	return &logicClock{
+		logicBase: b,
+		out:       sim.newDriver(sim.pin(b.comp, append([]string{"out", "clk", "q", "y", "output"}, positivePins...))),
+		period:    period,
+		high:      high,
+	}
+}
+
+func (clk *logicClock) watches() []int     { return nil }
+func (clk *logicClock) evaluate(*logicSim) {}
+
+// startAt schedules the edges of the clock up to stop, one at a time
+func (clk *logicClock) startAt(sim *logicSim, stop int64) {
+	if clk.out.net < 0 {
+		return
+	}
+	var rise func(t int64)
+	fall := func(t int64) {
+		if next := t + clk.period - clk.high; next <= stop {
+			sim.schedule(&logicEvent{time: next, driver: clk.out, value: L1, then: rise})
+		}
+	}
+	rise = func(t int64) {
+		if next := t + clk.high; next <= stop {
+			sim.schedule(&logicEvent{time: next, driver: clk.out, value: L0, then: fall})
+		}
+	}
+	sim.schedule(&logicEvent{time: 0, driver: clk.out, value: L0, then: fall})
+}
+
+// logicConstant is a power source: its positive terminal is high and its
+// negative terminal low
+type logicConstant struct {
+	logicBase
+	pos, neg *logicDriver
+}
+
+func newLogicConstant(b logicBase, sim *logicSim) *logicConstant {
+	return &logicConstant{
+		logicBase: b,
+		pos:       sim.newDriver(sim.optional(b.comp, positivePins...)),
+		neg:       sim.newDriver(sim.optional(b.comp, negativePins...)),
+	}
+}
+
+func (c *logicConstant) watches() []int { return nil }
+
+func (c *logicConstant) evaluate(sim *logicSim) {
+	sim.drive(c.pos, L1, 0)
+	sim.drive(c.neg, L0, 0)
+}
+
+// passThrough lets a resistor carry a level onto an undriven net
+type passThrough struct {
+	logicBase
+	from int
+	to   *logicDriver
+}
+
+func newPassThrough(comp schematic.Component, sim *logicSim, from, to int) *passThrough {
+	return &passThrough{logicBase: logicBase{comp: comp}, from: from, to: sim.newDriver(to)}
+}
+
+func (p *passThrough) watches() []int { return []int{p.from} }
+
+func (p *passThrough) evaluate(sim *logicSim) {
+	sim.drive(p.to, sim.v(p.from), 0)
+}
+
+// logicOutput observes one net: an LED, probe or output pin
+type logicOutput struct {
+	logicBase
+	in  int
+	sig *LogicSignal
+}
+
+func (o *logicOutput) watches() []int     { return []int{o.in} }
+func (o *logicOutput) evaluate(*logicSim) {}
+
+func (o *logicOutput) read(sim *logicSim) string {
+	return sim.v(o.in).String()
+}
+
+func (o *logicOutput) signal() *LogicSignal {
+	if o.sig == nil {
+		o.sig = &LogicSignal{Name: displayName(o.comp), Kind: "output", ComponentID: o.comp.ID, Width: 1, Changes: []LogicChange{}}
+	}
+	return o.sig
+}
+
+// segmentDisplay shows the digit its segments form; segments light when
+// high, or when low for a common-anode display
+type segmentDisplay struct {
+	logicBase
+	segments    []int
+	commonAnode bool
+	sig         *LogicSignal
+}
+
+func newSegmentDisplay(b logicBase, sim *logicSim) *segmentDisplay {
+	d := &segmentDisplay{
+		logicBase:   b,
+		commonAnode: boolProp(&b.comp, "common_anode") || strings.EqualFold(stringProp(&b.comp, "common"), "anode"),
+	}
+	for _, seg := range segmentNames {
+		d.segments = append(d.segments, sim.optional(b.comp, seg, "seg_"+seg))
+	}
+	return d
+}
+
+func (d *segmentDisplay) watches() []int { return d.segments }
+
+// lit returns the segments a..g as "1" (lit), "0" or "x"
+func (d *segmentDisplay) lit(sim *logicSim) string {
+	var b strings.Builder
+	for _, net := range d.segments {
+		v := sim.v(net)
+		if d.commonAnode {
+			v = v.not()
+		}
+		if net < 0 {
+			v = L0
+		}
+		b.WriteString(v.String())
+	}
+	return b.String()
+}
+
+func (d *segmentDisplay) evaluate(sim *logicSim) {
+	sim.appendChange(d.signal(), d.lit(sim))
+}
+
+// read returns the digit shown: a hex digit, "_" when dark, "?" for other
+// patterns and "x" when a segment is unknown
+func (d *segmentDisplay) read(sim *logicSim) string {
+	segments := d.lit(sim)
+	switch {
+	case strings.Contains(segments, "x"):
+		return "x"
+	case segments == "0000000":
+		return "_"
+	}
+	for _, digit := range hexDigits {
+		if sevenSegmentGlyphs[digit] == segments {
+			return string(digit)
+		}
+	}
+	return "?"
+}
+
+func (d *segmentDisplay) signal() *LogicSignal {
+	if d.sig == nil {
+		d.sig = &LogicSignal{Name: displayName(d.comp), Kind: "display", ComponentID: d.comp.ID, Width: len(segmentNames), Changes: []LogicChange{}}
+	}
+	return d.sig
+}
@@ -0,0 +1,174 @@
+package simulator
+
+import (
+	"errors"
+	"math"
+)
+
+// ============================================
+// Modified Nodal Analysis System
+// ============================================
+
+// errSingular means the circuit equations have no unique solution
+// (e.g. a loop of voltage sources or two sources shorted together)
+var errSingular = errors.New("singular circuit matrix")
+
+// system holds the MNA equations A·x = z. Unknowns are the voltages of
+// nodes 1..nodes (node 0 is ground) followed by branch currents.
+type system struct {
+	nodes    int
+	branches int
+	A        [][]float64
+	z        []float64
+}
+
+func newSystem(nodes, branches int) *system {
+	size := nodes + branches
+	A := make([][]float64, size)
+	for i := range A {
+		A[i] = make([]float64, size)
+	}
+	return &system{nodes: nodes, branches: branches, A: A, z: make([]float64, size)}
+}
+
+func (s *system) size() int {
+	return s.nodes + s.branches
+}
+
+func (s *system) clear() {
+	for i := range s.A {
+		for j := range s.A[i] {
+			s.A[i][j] = 0
+		}
+		s.z[i] = 0
+	}
+}
+
+// row maps a node to its equation index; ground has none
+func (s *system) row(node int) int {
+	return node - 1
+}
+
+func (s *system) add(r, c int, v float64) {
+	if r >= 0 && c >= 0 {
+		s.A[r][c] += v
+	}
+}
+
+func (s *system) addZ(r int, v float64) {
+	if r >= 0 {
+		s.z[r] += v
+	}
+}
+
+// stampConductance connects nodes a and b through conductance g
+func (s *system) stampConductance(a, b int, g float64) {
+	ra, rb := s.row(a), s.row(b)
+	s.add(ra, ra, g)
+	s.add(rb, rb, g)
+	s.add(ra, rb, -g)
+	s.add(rb, ra, -g)
+}
+
+// stampCurrent injects current i flowing from node a through the element to node b
+func (s *system) stampCurrent(a, b int, i float64) {
+	s.addZ(s.row(a), -i)
+	s.addZ(s.row(b), i)
+}
+
+// stampTransconductance adds a current g·(V(p)-V(q)) flowing from node a through the element to node b
+func (s *system) stampTransconductance(a, b, p, q int, g float64) {
+	ra, rb, rp, rq := s.row(a), s.row(b), s.row(p), s.row(q)
+	s.add(ra, rp, g)
+	s.add(ra, rq, -g)
+	s.add(rb, rp, -g)
+	s.add(rb, rq, g)
+}
+
+// stampVoltageSource forces V(a)-V(b) = v using the branch current unknown
+// at index k. The branch current flows from a through the source to b.
+func (s *system) stampVoltageSource(a, b, k int, v float64) {
+	ra, rb, rk := s.row(a), s.row(b), k
+	s.add(ra, rk, 1)
+	s.add(rb, rk, -1)
+	s.add(rk, ra, 1)
+	s.add(rk, rb, -1)
+	s.z[rk] += v
+}
+
+// stampLinearized stamps a nonlinear element linearized around terminal
+// voltages v. currents[t] enters the element at nodes[t] and
+// g[t][j] is the derivative of currents[t] with respect to v[j].
+func (s *system) stampLinearized(nodes []int, v, currents []float64, g [][]float64) {
+	for t, nt := range nodes {
+		rt := s.row(nt)
+		ieq := currents[t]
+		for j, nj := range nodes {
+			s.add(rt, s.row(nj), g[t][j])
+			ieq -= g[t][j] * v[j]
+		}
+		s.addZ(rt, -ieq)
+	}
+}
+
+// solve returns x for the current equations using LU decomposition with partial pivoting
+func (s *system) solve() ([]float64, error) {
+	n := s.size()
+	if n == 0 {
+		return []float64{}, nil
+	}
+
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = append([]float64(nil), s.A[i]...)
+	}
+	x := append([]float64(nil), s.z...)
+
+	for k := 0; k < n; k++ {
+		pivot, best := k, math.Abs(a[k][k])
+		for i := k + 1; i < n; i++ {
+			if v := math.Abs(a[i][k]); v > best {
+				pivot, best = i, v
+			}
+		}
+		if best < 1e-18 {
+			return nil, errSingular
+		}
+		a[k], a[pivot] = a[pivot], a[k]
+		x[k], x[pivot] = x[pivot], x[k]
+
+		for i := k + 1; i < n; i++ {
+			f := a[i][k] / a[k][k]
+			if f == 0 {
+				continue
+			}
+			for j := k; j < n; j++ {
+				a[i][j] -= f * a[k][j]
+			}
+			x[i] -= f * x[k]
+		}
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		sum := x[i]
+		for j := i + 1; j < n; j++ {
+			sum -= a[i][j] * x[j]
+		}
+		x[i] = sum / a[i][i]
+	}
+
+	for _, v := range x {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errSingular
+		}
+	}
+	return x, nil
+}
+
+// voltage reads a node voltage from a solution vector
+func voltage(x []float64, node int) float64 {
+	if node <= 0 || node > len(x) {
+		return 0
+	}
+	return x[node-1]
+}
@@ -0,0 +1,238 @@
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Netlist Extraction
+// ============================================
+
+// groundTypes are components whose pins all tie to the reference node
+var groundTypes = map[string]bool{
+	"ground": true,
+	"gnd":    true,
+}
+
+// junctionTypes are components whose pins are all one node
+var junctionTypes = map[string]bool{
+	"junction": true,
+}
+
+// Net is a set of pins joined by wires
+type Net struct {
+	Name string   `json:"name"`
+	Pins []string `json:"pins"` // "<component name>.<pin>"
+}
+
+// Netlist maps component pins to numbered nodes. Node 0 is ground.
+type Netlist struct {
+	Nets   []Net
+	pinNet map[string]int
+	names  map[string]string // component ID -> display name
+	labels map[string]string // pin key -> pin name as drawn
+}
+
+// unionFind joins pin keys into nets
+type unionFind struct {
+	parent map[string]string
+	order  []string
+}
+
+func (u *unionFind) find(k string) string {
+	if _, ok := u.parent[k]; !ok {
+		u.parent[k] = k
+		u.order = append(u.order, k)
+	}
+	for u.parent[k] != k {
+		u.parent[k] = u.parent[u.parent[k]]
+		k = u.parent[k]
+	}
+	return k
+}
+
+func (u *unionFind) union(a, b string) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u.parent[rb] = ra
+	}
+}
+
+// pinKey identifies a pin; pin names are matched case-insensitively
+func pinKey(componentID, pin string) string {
+	return componentID + "\x00" + strings.ToLower(strings.TrimSpace(pin))
+}
+
+// isGroundPin reports whether a board pin is one of its GND pins ("GND", "GND.2", ...)
+func isGroundPin(pin string) bool {
+	return strings.HasPrefix(strings.ToLower(pin), "gnd")
+}
+
+const groundKey = "\x00ground"
+
+// buildNetlist joins wired pins into nets and picks the reference node
+func buildNetlist(schema *schematic.Schema) *Netlist {
+	uf := &unionFind{parent: map[string]string{}}
+	labels := map[string]string{}
+	names := map[string]string{}
+	types := map[string]string{}
+	for _, comp := range schema.Components {
+		names[comp.ID] = displayName(comp)
+		types[comp.ID] = strings.ToLower(comp.Type)
+	}
+
+	for _, w := range schema.Wires {
+		if _, ok := names[w.StartComponentID]; !ok {
+			continue
+		}
+		if _, ok := names[w.EndComponentID]; !ok {
+			continue
+		}
+		a := pinKey(w.StartComponentID, w.StartPinID)
+		b := pinKey(w.EndComponentID, w.EndPinID)
+		labels[a], labels[b] = w.StartPinID, w.EndPinID
+		uf.union(a, b)
+
+		// Every pin of a ground symbol, and every GND pin of a board, is the same node
+		for _, end := range []struct{ id, pin, key string }{
+			{w.StartComponentID, w.StartPinID, a},
+			{w.EndComponentID, w.EndPinID, b},
+		} {
+			if groundTypes[types[end.id]] {
+				uf.union(groundKey, end.key)
+			} else if junctionTypes[types[end.id]] {
+				uf.union(pinKey(end.id, ""), end.key)
+			} else if isMCU(types[end.id]) && isGroundPin(end.pin) {
+				uf.union(pinKey(end.id, "gnd"), end.key)
+			}
+		}
+	}
+
+	// Pick the reference node: an explicit ground, then a board GND,
+	// then the negative terminal of the first power source.
+	ground := ""
+	if _, ok := uf.parent[groundKey]; ok {
+		ground = uf.find(groundKey)
+	}
+	if ground == "" {
+		for _, comp := range schema.Components {
+			if isMCU(types[comp.ID]) {
+				if _, ok := uf.parent[pinKey(comp.ID, "gnd")]; ok {
+					ground = uf.find(pinKey(comp.ID, "gnd"))
+					break
+				}
+			}
+		}
+	}
+	if ground == "" {
+		for _, comp := range schema.Components {
+			if voltageSourceTypes[types[comp.ID]] == "" {
+				continue
+			}
+			for _, alias := range negativePins {
+				if _, ok := uf.parent[pinKey(comp.ID, alias)]; ok {
+					ground = uf.find(pinKey(comp.ID, alias))
+					break
+				}
+			}
+			if ground != "" {
+				break
+			}
+		}
+	}
+
+	nl := &Netlist{
+		Nets:   []Net{{Name: "0", Pins: []string{}}},
+		pinNet: map[string]int{},
+		names:  names,
+		labels: labels,
+	}
+	roots := map[string]int{}
+	if ground != "" {
+		roots[ground] = 0
+	}
+	for _, k := range uf.order {
+		if k == groundKey {
+			continue
+		}
+		root := uf.find(k)
+		node, ok := roots[root]
+		if !ok {
+			node = len(nl.Nets)
+			roots[root] = node
+			nl.Nets = append(nl.Nets, Net{Name: fmt.Sprintf("N%d", node), Pins: []string{}})
+		}
+		nl.pinNet[k] = node
+		if label, ok := labels[k]; ok {
+			nl.Nets[node].Pins = append(nl.Nets[node].Pins, nl.names[componentOf(k)]+"."+label)
+		}
+	}
+	for i := range nl.Nets {
+		sort.Strings(nl.Nets[i].Pins)
+	}
+
+	return nl
+}
+
+// terminal returns the node of the first wired pin among aliases. An
+// unwired terminal gets a fresh node of its own so it floats.
+func (nl *Netlist) terminal(comp schematic.Component, aliases []string) int {
+	if node, ok := nl.lookup(comp.ID, aliases); ok {
+		return node
+	}
+	pin := aliases[0]
+	node := len(nl.Nets)
+	nl.Nets = append(nl.Nets, Net{Name: fmt.Sprintf("N%d", node), Pins: []string{displayName(comp) + "." + pin}})
+	nl.pinNet[pinKey(comp.ID, pin)] = node
+	return node
+}
+
+// internalNode adds a node inside a device model; it has no pins and is not reported
+func (nl *Netlist) internalNode() int {
+	node := len(nl.Nets)
+	nl.Nets = append(nl.Nets, Net{Name: fmt.Sprintf("N%d", node), Pins: []string{}})
+	return node
+}
+
+// lookup finds the node of the first wired pin among aliases
+func (nl *Netlist) lookup(componentID string, aliases []string) (int, bool) {
+	for _, alias := range aliases {
+		if node, ok := nl.pinNet[pinKey(componentID, alias)]; ok {
+			return node, true
+		}
+	}
+	return 0, false
+}
+
+// wiredPins lists the pins of a component that appear in the netlist
+func (nl *Netlist) wiredPins(componentID string) map[string]int {
+	pins := map[string]int{}
+	prefix := componentID + "\x00"
+	for k, node := range nl.pinNet {
+		if strings.HasPrefix(k, prefix) {
+			pins[strings.TrimPrefix(k, prefix)] = node
+		}
+	}
+	return pins
+}
+
+// nodeCount is the number of non-ground nodes
+func (nl *Netlist) nodeCount() int {
+	return len(nl.Nets) - 1
+}
+
+func displayName(comp schematic.Component) string {
+	if comp.Name != "" {
+		return comp.Name
+	}
+	return comp.ID
+}
+
+// componentOf returns the component ID of a pin key
+func componentOf(key string) string {
+	return strings.SplitN(key, "\x00", 2)[0]
+}
@@ -0,0 +1,92 @@
+package simulator
+
+import "math"
+
+// ============================================
+// Progress
+// ============================================
+
+// Progress reports how far a running analysis has come
+type Progress struct {
+	Percent  float64        `json:"percent"`
+	Time     float64        `json:"time,omitempty"`     // simulated time reached, s
+	Chunk    *WaveformChunk `json:"chunk,omitempty"`    // transient samples since the last report
+	Warnings []Issue        `json:"warnings,omitempty"` // raised since the last report
+}
+
+// WaveformChunk is a piece of a transient waveform, following on from the
+// previous chunk. Long stretches are thinned to maxChunkPoints samples.
+type WaveformChunk struct {
+	Time    []float64     `json:"time"`
+	Signals []ChunkSignal `json:"signals"`
+}
+
+// ChunkSignal holds the values of one signal within a chunk
+type ChunkSignal struct {
+	Name   string    `json:"name"`
+	Unit   string    `json:"unit"`
+	Values []float64 `json:"values"`
+}
+
+// ProgressFunc receives progress reports. It is called on the goroutine
+// running the analysis, which waits for it to return.
+type ProgressFunc func(Progress)
+
+const (
+	progressReports = 50  // reports over a whole analysis
+	maxChunkPoints  = 200 // samples per waveform chunk
+)
+
+// progressTracker sends a report each time another 1/progressReports of
+// an analysis is done
+type progressTracker struct {
+	report   ProgressFunc
+	next     float64 // fraction done at which the next report is due
+	warnings int     // warnings already reported
+	samples  int     // waveform samples already reported
+}
+
+func newProgressTracker(report ProgressFunc) *progressTracker {
+	return &progressTracker{report: report}
+}
+
+// due reports whether a report is due at the fraction done
+func (p *progressTracker) due(done float64) bool {
+	return p.report != nil && done >= p.next
+}
+
+// send reports the fraction done along with the samples and warnings
+// added since the last report
+func (p *progressTracker) send(done, t float64, w *Waveform, is *issues) {
+	if p.report == nil {
+		return
+	}
+	done = math.Min(math.Max(done, 0), 1)
+	pr := Progress{Percent: math.Round(done*1000) / 10, Time: round(t)}
+	if w != nil && len(w.Time) > p.samples {
+		pr.Chunk = w.chunk(p.samples, len(w.Time))
+		p.samples = len(w.Time)
+	}
+	if len(is.Warnings) > p.warnings {
+		pr.Warnings = append([]Issue{}, is.Warnings[p.warnings:]...)
+		p.warnings = len(is.Warnings)
+	}
+	p.next = (math.Floor(done*progressReports) + 1) / progressReports
+	p.report(pr)
+}
+
+// chunk copies the samples from..to-1, thinned to maxChunkPoints
+func (w *Waveform) chunk(from, to int) *WaveformChunk {
+	stride := (to - from + maxChunkPoints - 1) / maxChunkPoints
+	c := &WaveformChunk{Time: []float64{}, Signals: make([]ChunkSignal, len(w.Signals))}
+	for i, sig := range w.Signals {
+		c.Signals[i] = ChunkSignal{Name: sig.Name, Unit: sig.Unit, Values: []float64{}}
+	}
+	for k := from; k < to; k += stride {
+		c.Time = append(c.Time, round(w.Time[k]))
+		for i, sig := range w.Signals {
+			c.Signals[i].Values = append(c.Signals[i].Values, round(sig.Values[k]))
+		}
+	}
+	return c
+}
@@ -0,0 +1,75 @@
+package simulator
+
+import (
+	"strconv"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Component Property Helpers
+// ============================================
+
+// floatProp reads the first numeric property found among keys
+func floatProp(comp *schematic.Component, fallback float64, keys ...string) float64 {
+	for _, key := range keys {
+		if v, ok := comp.Float(key); ok {
+			return v
+		}
+	}
+	return fallback
+}
+
+// stringProp reads the first string property found among keys
+func stringProp(comp *schematic.Component, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := comp.Properties[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// hasProp reports whether a part sets any of keys
+func hasProp(comp *schematic.Component, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := comp.Properties[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// truthy interprets switch-like property values ("on", "HIGH", 1, true)
+func truthy(v interface{}) (bool, bool) {
+	switch val := v.(type) {
+	case bool:
+		return val, true
+	case float64:
+		return val != 0, true
+	case int:
+		return val != 0, true
+	case string:
+		switch strings.ToLower(strings.TrimSpace(val)) {
+		case "on", "true", "high", "closed", "pressed", "1", "p2", "right":
+			return true, true
+		case "off", "false", "low", "open", "released", "0", "p1", "left":
+			return false, true
+		}
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f != 0, true
+		}
+	}
+	return false, false
+}
+
+// boolProp reads the first switch-like property found among keys
+func boolProp(comp *schematic.Component, keys ...string) bool {
+	for _, key := range keys {
+		if v, ok := truthy(comp.Properties[key]); ok {
+			return v
+		}
+	}
+	return false
+}
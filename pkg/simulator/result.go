@@ -0,0 +1,135 @@
+package simulator
+
+import "fmt"
+
+// ============================================
+// Analysis Results
+// ============================================
+
+// Issue codes reported by the analyses
+const (
+	IssueEmptyCircuit         = "empty_circuit"
+	IssueNoPowerSource        = "no_power_source"
+	IssueShortCircuit         = "short_circuit"
+	IssueOvercurrent          = "overcurrent"
+	IssueOverpower            = "overpower"
+	IssueOvervoltage          = "overvoltage"
+	IssueReverseVoltage       = "reverse_voltage"
+	IssueUnderpowered         = "underpowered"
+	IssueFloatingNode         = "floating_node"
+	IssueNoCurrent            = "no_current"
+	IssueUnsupportedComponent = "unsupported_component"
+	IssueNotConverged         = "not_converged"
+	IssueSingularMatrix       = "singular_matrix"
+	IssueStepAdjusted         = "step_adjusted"
+	IssueNoACSource           = "no_ac_source"
+	IssueUnknownProbe         = "unknown_probe"
+	IssueContention           = "contention"
+	IssueInvalidState         = "invalid_state"
+	IssueTruncated            = "truncated"
+	IssueTooManyInputs        = "too_many_inputs"
+	IssueInvalidVector        = "invalid_vector"
+	IssueTruthTableMismatch   = "truth_table_mismatch"
+	IssueCancelled            = "cancelled"
+	IssueInvalidVariation     = "invalid_variation"
+	IssueVariantsFailed       = "variants_failed"
+	IssueAnalysisMismatch     = "analysis_mismatch"
+	IssueRegression           = "regression"
+	IssueSketchError          = "sketch_error"
+	IssueUnknownModel         = "unknown_model"
+	IssueOutOfRange           = "out_of_range"
+	IssueRunFailed            = "run_failed"
+)
+
+// Issue is a problem found while simulating
+type Issue struct {
+	Code        string `json:"code"`
+	ComponentID string `json:"component_id,omitempty"`
+	Message     string `json:"message"`
+}
+
+// issues collects errors (the circuit does not work or gets damaged) and warnings
+type issues struct {
+	Errors   []Issue
+	Warnings []Issue
+}
+
+func (is *issues) errorf(componentID, code, format string, args ...interface{}) {
+	is.Errors = append(is.Errors, Issue{Code: code, ComponentID: componentID, Message: fmt.Sprintf(format, args...)})
+}
+
+func (is *issues) warnf(componentID, code, format string, args ...interface{}) {
+	is.Warnings = append(is.Warnings, Issue{Code: code, ComponentID: componentID, Message: fmt.Sprintf(format, args...)})
+}
+
+// NodeResult is the solved voltage of a net
+type NodeResult struct {
+	Name    string   `json:"name"`
+	Voltage float64  `json:"voltage"`
+	Pins    []string `json:"pins"`
+}
+
+// ComponentResult is the solved state of a component. Voltage is measured
+// across its main terminals, Current flows through it and Power is what it
+// dissipates (negative for sources delivering power).
+type ComponentResult struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Type       string             `json:"type"`
+	Voltage    float64            `json:"voltage"`
+	Current    float64            `json:"current"`
+	Power      float64            `json:"power"`
+	State      string             `json:"state,omitempty"`
+	Brightness *float64           `json:"brightness,omitempty"`
+	Terminals  map[string]float64 `json:"terminals,omitempty"`
+	Readings   map[string]float64 `json:"readings,omitempty"` // what a sensor measures
+}
+
+// OperatingPoint is the result of a DC analysis
+type OperatingPoint struct {
+	Converged      bool              `json:"converged"`
+	Iterations     int               `json:"iterations"`
+	PowerDelivered float64           `json:"power_delivered"`
+	Nodes          []NodeResult      `json:"nodes"`
+	Components     []ComponentResult `json:"components"`
+	Sketches       []SketchResult    `json:"sketches,omitempty"`
+	Errors         []Issue           `json:"errors"`
+	Warnings       []Issue           `json:"warnings"`
+}
+
+// minWorkingPower is the least power a working circuit delivers to its loads
+const minWorkingPower = 1e-6
+
+// Works returns true when the circuit solved, nothing is damaged or shorted,
+// and current actually flows
+func (op *OperatingPoint) Works() bool {
+	return op.Converged && len(op.Errors) == 0 && op.PowerDelivered > minWorkingPower
+}
+
+// ErrorMessages returns the error messages as plain strings
+func (op *OperatingPoint) ErrorMessages() []string {
+	return messages(op.Errors)
+}
+
+// WarningMessages returns the warning messages as plain strings
+func (op *OperatingPoint) WarningMessages() []string {
+	return messages(op.Warnings)
+}
+
+func messages(list []Issue) []string {
+	out := make([]string, 0, len(list))
+	for _, issue := range list {
+		out = append(out, issue.Message)
+	}
+	return out
+}
+
+// Component returns the result of a component by ID
+func (op *OperatingPoint) Component(id string) *ComponentResult {
+	for i := range op.Components {
+		if op.Components[i].ID == id {
+			return &op.Components[i]
+		}
+	}
+	return nil
+}
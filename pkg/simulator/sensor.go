@@ -0,0 +1,100 @@
+package simulator
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// ============================================
+// Behavioral Sensors
+// ============================================
+
+// sensor is a module whose behavioral model measures virtual inputs and
+// may drive an analog output that follows one of them
+type sensor struct {
+	module
+	behavior Behavior
+	values   map[string]float64 // the inputs as set on the part
+	out      int                // output node; -1 without an output
+}
+
+func newSensor(b base, nl *Netlist) *sensor {
+	var behavior Behavior
+	if data, err := json.Marshal(b.comp.Properties["behavior"]); err == nil {
+		json.Unmarshal(data, &behavior)
+	}
+	supply := behavior.Supply
+	if supply.Nominal <= 0 {
+		supply = Supply{Current: 0.001, Nominal: 5, MinVoltage: 3.3, MaxVoltage: 5.5}
+	}
+
+	s := &sensor{
+		module: module{
+			base: b,
+			vcc:  nl.terminal(b.comp, vccPins),
+			gnd:  nl.terminal(b.comp, gndPins),
+			spec: moduleSpec{current: supply.Current, nominal: supply.Nominal, minVoltage: supply.MinVoltage, maxVoltage: supply.MaxVoltage},
+		},
+		behavior: behavior,
+		values:   map[string]float64{},
+		out:      -1,
+	}
+	for _, in := range behavior.Inputs {
+		s.values[in.Name] = floatProp(&b.comp, in.Default, in.Name)
+	}
+	if behavior.Output != nil {
+		s.out = nl.terminal(b.comp, []string{behavior.Output.Pin})
+	}
+	return s
+}
+
+// output returns the voltage the output drives and its conductance
+func (s *sensor) output() (float64, float64) {
+	out := s.behavior.Output
+	v := out.Offset + out.Gain*s.values[out.Input]
+	v = math.Min(math.Max(v, 0), s.spec.nominal)
+	r := out.Resistance
+	if r <= 0 {
+		r = defaultOutputResistance
+	}
+	return v, 1 / r
+}
+
+func (s *sensor) stamp(sys *system, ctx *stampContext) {
+	s.module.stamp(sys, ctx)
+	if s.out < 0 {
+		return
+	}
+	v, g := s.output()
+	sys.stampConductance(s.out, s.gnd, g)
+	sys.stampCurrent(s.gnd, s.out, g*v*ctx.scale)
+}
+
+func (s *sensor) paths() [][2]int {
+	if s.out < 0 {
+		return s.module.paths()
+	}
+	return [][2]int{{s.vcc, s.gnd}, {s.out, s.gnd}}
+}
+
+func (s *sensor) report(x []float64, t float64) ComponentResult {
+	res := s.module.report(x, t)
+	res.Readings = map[string]float64{}
+	for name, v := range s.values {
+		res.Readings[name] = v
+	}
+	if s.out >= 0 {
+		res.Terminals = map[string]float64{s.behavior.Output.Pin: voltage(x, s.out) - voltage(x, s.gnd)}
+	}
+	return res
+}
+
+func (s *sensor) check(res *ComponentResult, is *issues) {
+	s.module.check(res, is)
+	for _, in := range s.behavior.Inputs {
+		if v := s.values[in.Name]; v < in.Min || v > in.Max {
+			is.warnf(s.comp.ID, IssueOutOfRange, "%s measures %s from %g to %g%s; %g%s is out of its range",
+				s.name(), in.Name, in.Min, in.Max, in.Unit, v, in.Unit)
+		}
+	}
+}
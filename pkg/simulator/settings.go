@@ -0,0 +1,312 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Simulation Settings
+// ============================================
+
+// Analyses a simulation can run
+const (
+	AnalysisDC        = "dc"
+	AnalysisTransient = "transient"
+	AnalysisAC        = "ac"
+	AnalysisDigital   = "digital"
+)
+
+// Initial states of a transient analysis
+const (
+	InitialStateRest           = "rest"
+	InitialStateOperatingPoint = "operating_point"
+)
+
+// Settings are the analysis options read from a simulation's settings.
+// Keys the simulator does not use (speed, timeStep, ...) belong to the
+// editor and are ignored.
+type Settings struct {
+	Analysis  string
+	Transient TransientOptions
+	AC        ACOptions
+	Digital   DigitalOptions
+	// Variation is set when the run is a sweep or a Monte Carlo analysis
+	Variation *VariationOptions
+}
+
+// SettingsError reports settings the simulator cannot use
+type SettingsError struct {
+	Message string
+}
+
+func (e *SettingsError) Error() string {
+	return "invalid simulation settings: " + e.Message
+}
+
+type rawSettings struct {
+	Analysis  string `json:"analysis"`
+	Transient *struct {
+		Step         json.RawMessage `json:"step"`
+		StopTime     json.RawMessage `json:"stopTime"`
+		Method       string          `json:"method"`
+		InitialState string          `json:"initialState"`
+	} `json:"transient"`
+	AC *struct {
+		Source string          `json:"source"`
+		Sweep  string          `json:"sweep"`
+		Start  json.RawMessage `json:"start"`
+		Stop   json.RawMessage `json:"stop"`
+		Points int             `json:"points"`
+		Probes []string        `json:"probes"`
+	} `json:"ac"`
+	Digital *struct {
+		StopTime json.RawMessage `json:"stopTime"`
+		Period   json.RawMessage `json:"period"`
+		Inputs   []string        `json:"inputs"`
+		Outputs  []string        `json:"outputs"`
+		Vectors  []string        `json:"vectors"`
+	} `json:"digital"`
+	Sweep *struct {
+		Component string            `json:"component"`
+		Property  string            `json:"property"`
+		Start     json.RawMessage   `json:"start"`
+		Stop      json.RawMessage   `json:"stop"`
+		Points    int               `json:"points"`
+		Scale     string            `json:"scale"`
+		Values    []json.RawMessage `json:"values"`
+	} `json:"sweep"`
+	MonteCarlo *struct {
+		Runs         int                        `json:"runs"`
+		Seed         int64                      `json:"seed"`
+		Distribution string                     `json:"distribution"`
+		Tolerances   map[string]json.RawMessage `json:"tolerances"`
+	} `json:"monteCarlo"`
+	Probes  []string `json:"probes"`
+	Measure string   `json:"measure"`
+}
+
+// ParseSettings reads the analysis options from settings JSON. Times are
+// seconds and frequencies hertz, either as numbers or as strings such as
+// "10us", "5 ms" or "10kHz".
+// An empty analysis is left for the caller to default.
+func ParseSettings(data []byte) (*Settings, error) {
+	settings := &Settings{}
+	if len(data) == 0 || string(data) == "null" {
+		return settings, nil
+	}
+
+	var raw rawSettings
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, &SettingsError{Message: "settings must be a JSON object"}
+	}
+
+	switch raw.Analysis {
+	case "", AnalysisDC, AnalysisTransient, AnalysisAC, AnalysisDigital:
+		settings.Analysis = raw.Analysis
+	default:
+		return nil, &SettingsError{Message: fmt.Sprintf("unknown analysis %q", raw.Analysis)}
+	}
+
+	if t := raw.Transient; t != nil {
+		var err error
+		if settings.Transient.Step, err = parseQuantity("transient.step", t.Step, "s"); err != nil {
+			return nil, err
+		}
+		if settings.Transient.StopTime, err = parseQuantity("transient.stopTime", t.StopTime, "s"); err != nil {
+			return nil, err
+		}
+		if settings.Transient.StopTime > maxStopTime {
+			return nil, &SettingsError{Message: fmt.Sprintf("transient.stopTime must be at most %gs", float64(maxStopTime))}
+		}
+
+		switch t.Method {
+		case "", MethodTrapezoidal, MethodBackwardEuler:
+			settings.Transient.Method = t.Method
+		default:
+			return nil, &SettingsError{Message: fmt.Sprintf("unknown integration method %q", t.Method)}
+		}
+
+		switch t.InitialState {
+		case "", InitialStateRest:
+		case InitialStateOperatingPoint:
+			settings.Transient.FromOperatingPoint = true
+		default:
+			return nil, &SettingsError{Message: fmt.Sprintf("unknown initial state %q", t.InitialState)}
+		}
+	}
+
+	if a := raw.AC; a != nil {
+		opts := ACOptions{Source: a.Source, Sweep: a.Sweep, Points: a.Points, Probes: a.Probes}
+		switch a.Sweep {
+		case "", SweepLinear, SweepDecade, SweepOctave:
+		default:
+			return nil, &SettingsError{Message: fmt.Sprintf("unknown sweep %q, use lin, dec or oct", a.Sweep)}
+		}
+
+		var err error
+		if opts.Start, err = parseQuantity("ac.start", a.Start, "Hz"); err != nil {
+			return nil, err
+		}
+		if opts.Stop, err = parseQuantity("ac.stop", a.Stop, "Hz"); err != nil {
+			return nil, err
+		}
+		if opts.Start > 0 && opts.Stop > 0 && opts.Stop <= opts.Start {
+			return nil, &SettingsError{Message: "ac.stop must be above ac.start"}
+		}
+		if opts.Points < 0 {
+			return nil, &SettingsError{Message: "ac.points must not be negative"}
+		}
+		if n := SweepPoints(opts); n > MaxACPoints {
+			return nil, &SettingsError{Message: fmt.Sprintf("the AC sweep visits %d frequencies, at most %d are allowed", n, MaxACPoints)}
+		}
+		settings.AC = opts
+	}
+
+	if d := raw.Digital; d != nil {
+		stop, err := parseQuantity("digital.stopTime", d.StopTime, "s")
+		if err != nil {
+			return nil, err
+		}
+		period, err := parseQuantity("digital.period", d.Period, "s")
+		if err != nil {
+			return nil, err
+		}
+		if stop > maxLogicStopTime {
+			return nil, &SettingsError{Message: fmt.Sprintf("digital.stopTime must be at most %gs", maxLogicStopTime)}
+		}
+		if period > maxLogicStopTime {
+			return nil, &SettingsError{Message: fmt.Sprintf("digital.period must be at most %gs", maxLogicStopTime)}
+		}
+		settings.Digital = DigitalOptions{
+			StopTime: Picoseconds(stop),
+			Period:   Picoseconds(period),
+			Inputs:   d.Inputs,
+			Outputs:  d.Outputs,
+			Vectors:  d.Vectors,
+		}
+	}
+
+	if raw.Sweep != nil || raw.MonteCarlo != nil {
+		variation, err := parseVariation(&raw)
+		if err != nil {
+			return nil, err
+		}
+		if settings.Analysis == AnalysisAC || settings.Analysis == AnalysisDigital {
+			return nil, &SettingsError{Message: "sweeps and Monte Carlo runs vary dc or transient analyses"}
+		}
+		settings.Variation = variation
+	}
+	return settings, nil
+}
+
+// parseVariation reads the sweep or Monte Carlo block; a run has one
+func parseVariation(raw *rawSettings) (*VariationOptions, error) {
+	if raw.Sweep != nil && raw.MonteCarlo != nil {
+		return nil, &SettingsError{Message: "give either sweep or monteCarlo, not both"}
+	}
+	opts := &VariationOptions{Probes: raw.Probes, Measure: raw.Measure}
+	switch raw.Measure {
+	case "", MeasureFinal, MeasureAverage, MeasureMin, MeasureMax, MeasurePeakToPeak, MeasureRMS:
+	default:
+		return nil, &SettingsError{Message: fmt.Sprintf("unknown measure %q", raw.Measure)}
+	}
+
+	if sw := raw.Sweep; sw != nil {
+		if sw.Component == "" {
+			return nil, &SettingsError{Message: "sweep.component is required"}
+		}
+		sweep := &SweepOptions{Component: sw.Component, Property: sw.Property, Points: sw.Points, Scale: sw.Scale}
+		switch sw.Scale {
+		case "", SweepLinear, ScaleLog:
+		default:
+			return nil, &SettingsError{Message: fmt.Sprintf("unknown sweep scale %q, use lin or log", sw.Scale)}
+		}
+
+		var err error
+		if sweep.Start, err = parseQuantity("sweep.start", sw.Start, ""); err != nil {
+			return nil, err
+		}
+		if sweep.Stop, err = parseQuantity("sweep.stop", sw.Stop, ""); err != nil {
+			return nil, err
+		}
+		for i, v := range sw.Values {
+			value, err := parseQuantity(fmt.Sprintf("sweep.values[%d]", i), v, "")
+			if err != nil {
+				return nil, err
+			}
+			sweep.Values = append(sweep.Values, value)
+		}
+		if len(sweep.Values) == 0 && (len(sw.Start) > 0 || len(sw.Stop) > 0) {
+			if sweep.Stop <= sweep.Start {
+				return nil, &SettingsError{Message: "sweep.stop must be above sweep.start"}
+			}
+			if sweep.Scale == ScaleLog && sweep.Start <= 0 {
+				return nil, &SettingsError{Message: "a log sweep must start above zero"}
+			}
+		}
+		if sw.Points < 0 {
+			return nil, &SettingsError{Message: "sweep.points must not be negative"}
+		}
+		if n := max(sw.Points, len(sweep.Values)); n > MaxVariants {
+			return nil, &SettingsError{Message: fmt.Sprintf("a sweep has at most %d points", MaxVariants)}
+		}
+		opts.Sweep = sweep
+	}
+
+	if mc := raw.MonteCarlo; mc != nil {
+		monteCarlo := &MonteCarloOptions{Runs: mc.Runs, Seed: mc.Seed, Distribution: mc.Distribution, Tolerances: map[string]float64{}}
+		if mc.Runs < 0 || mc.Runs > MaxVariants {
+			return nil, &SettingsError{Message: fmt.Sprintf("monteCarlo.runs must be between 1 and %d", MaxVariants)}
+		}
+		switch mc.Distribution {
+		case "", DistributionGaussian, DistributionUniform:
+		default:
+			return nil, &SettingsError{Message: fmt.Sprintf("unknown distribution %q, use gaussian or uniform", mc.Distribution)}
+		}
+		for key, v := range mc.Tolerances {
+			var tolerance float64
+			ok := json.Unmarshal(v, &tolerance) == nil && tolerance > 0 && tolerance < 1
+			if text := ""; !ok && json.Unmarshal(v, &text) == nil {
+				tolerance, ok = ParseTolerance(text)
+			}
+			if !ok {
+				return nil, &SettingsError{Message: fmt.Sprintf("monteCarlo.tolerances.%s must be a fraction such as 0.05 or a percentage such as \"5%%\"", key)}
+			}
+			monteCarlo.Tolerances[key] = tolerance
+		}
+		opts.MonteCarlo = monteCarlo
+	}
+	return opts, nil
+}
+
+// parseQuantity reads a non-negative value that may carry unit; absent
+// values are zero
+func parseQuantity(key string, raw json.RawMessage, unit string) (float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+
+	var value float64
+	if err := json.Unmarshal(raw, &value); err != nil {
+		var text string
+		if json.Unmarshal(raw, &text) != nil {
+			return 0, &SettingsError{Message: key + " must be a number or a string"}
+		}
+		text = strings.ReplaceAll(text, " ", "")
+		if strings.HasSuffix(strings.ToLower(text), strings.ToLower(unit)) {
+			text = text[:len(text)-len(unit)]
+		}
+		var ok bool
+		if value, ok = schematic.ParseValue(text); !ok {
+			return 0, &SettingsError{Message: fmt.Sprintf("%s: cannot read %q as a value in %s", key, text, unit)}
+		}
+	}
+	if value < 0 {
+		return 0, &SettingsError{Message: key + " must not be negative"}
+	}
+	return value, nil
+}
@@ -0,0 +1,384 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+	"nexfi-backend/pkg/sketch"
+)
+
+// ============================================
+// Sketches on Boards
+// ============================================
+
+const (
+	// defaultSketchStopTime is how long a transient analysis lets a sketch
+	// run when no stop time is given
+	defaultSketchStopTime = 2
+	// sketchMaxSteps stops a sketch that would keep the server busy
+	sketchMaxSteps   = 20000000
+	pullupResistance = 35000 // internal pull-up of INPUT_PULLUP
+	maxPinEvents     = 1000
+)
+
+// SketchResult is what the sketch on a board did: what it printed on
+// Serial and how it set its pins
+type SketchResult struct {
+	ComponentID string              `json:"component_id"`
+	Board       string              `json:"board"`
+	RunTime     float64             `json:"run_time"` // s
+	Serial      []sketch.SerialLine `json:"serial"`
+	Pins        []PinEvent          `json:"pins"`
+	Truncated   bool                `json:"truncated,omitempty"` // more pin events than were kept
+	Error       *sketch.Error       `json:"error,omitempty"`
+}
+
+// PinEvent is a change of a pin made by a sketch. State is HIGH, LOW,
+// INPUT, INPUT_PULLUP, "PWM <0-255>" or "TONE <frequency> Hz".
+type PinEvent struct {
+	Time  float64 `json:"time"` // s
+	Pin   string  `json:"pin"`
+	State string  `json:"state"`
+}
+
+// AttachSketch sets the code of a project as the sketch of the boards
+// that have none, and returns how many boards run it
+func AttachSketch(schema *schematic.Schema, code string) int {
+	boards := 0
+	for i := range schema.Components {
+		comp := &schema.Components[i]
+		if !isMCU(strings.ToLower(comp.Type)) {
+			continue
+		}
+		if sketchSource(comp) == "" {
+			if comp.Properties == nil {
+				comp.Properties = map[string]interface{}{}
+			}
+			comp.Properties["sketch"] = code
+		}
+		boards++
+	}
+	return boards
+}
+
+// Board is a microcontroller board of a schema and the sketch it runs
+type Board struct {
+	ComponentID string
+	Type        string // e.g. arduino_uno
+	Sketch      string
+}
+
+// Boards lists the microcontroller boards of a schema
+func Boards(schema *schematic.Schema) []Board {
+	boards := []Board{}
+	for i := range schema.Components {
+		comp := &schema.Components[i]
+		if t := strings.ToLower(comp.Type); isMCU(t) {
+			boards = append(boards, Board{ComponentID: comp.ID, Type: t, Sketch: sketchSource(comp)})
+		}
+	}
+	return boards
+}
+
+// sketchSource reads the program of a board
+func sketchSource(comp *schematic.Component) string {
+	source := stringProp(comp, "sketch", "code")
+	if strings.TrimSpace(source) == "" {
+		return ""
+	}
+	return source
+}
+
+// mcuSketch runs a sketch on a board. It implements sketch.Board: the
+// sketch's pins are outputs of the board, switched off while they are
+// inputs, and reads see the last solution of the circuit.
+type mcuSketch struct {
+	board      *mcu
+	prog       *sketch.Program
+	compileErr *sketch.Error
+	machine    *sketch.Machine
+	pins       map[int]*sketchPin
+	x          []float64
+	solved     []mcuOutput // the outputs x was solved with; the sketch runs ahead of them
+	events     []PinEvent
+	truncated  bool
+}
+
+// sketchPin is a pin the sketch may use; out is its output in the board's
+// list, or -1 when nothing is wired to it
+type sketchPin struct {
+	name  string
+	out   int
+	mode  int
+	state string
+}
+
+// loadSketch compiles the sketch of a board and runs it to the state a DC
+// analysis sees
+func (m *mcu) loadSketch(source string, nl *Netlist) {
+	s := &mcuSketch{board: m, pins: map[int]*sketchPin{}}
+	m.sketch = s
+
+	for pin, node := range nl.wiredPins(m.comp.ID) {
+		if isGroundPin(pin) || pin == "" {
+			continue
+		}
+		if rail, ok := m.spec.rails[pin]; ok {
+			m.outputs = append(m.outputs, mcuOutput{pin: pin, node: node, wave: dcWave(rail.volts), maxCurrent: rail.maxCurrent, resistance: railResistance, rail: true})
+			continue
+		}
+		number, ok := m.pinNumber(pin)
+		if !ok {
+			continue
+		}
+		m.outputs = append(m.outputs, mcuOutput{pin: pin, node: node, wave: dcWave(0), maxCurrent: m.spec.pinMaxCurrent, resistance: pinResistance, off: true})
+		s.pins[number] = &sketchPin{name: strings.ToUpper(pin), out: len(m.outputs) - 1, state: "INPUT"}
+	}
+
+	prog, err := sketch.Compile(source)
+	if err != nil {
+		s.compileErr = err.(*sketch.Error)
+		return
+	}
+	s.prog = prog
+	s.start(nil)
+	s.machine.Settle()
+}
+
+// pinNumber maps a board pin to the number a sketch uses for it: "D13",
+// "13", "GPIO13", "GP13", "IO13" or "A0"
+func (m *mcu) pinNumber(pin string) (int, bool) {
+	if rest, ok := strings.CutPrefix(pin, "a"); ok {
+		if n, err := strconv.Atoi(rest); err == nil && n < m.spec.analogPins {
+			return m.spec.analogBase + n, true
+		}
+	}
+	for _, prefix := range []string{"gpio", "gp", "io", "d", ""} {
+		if rest, ok := strings.CutPrefix(pin, prefix); ok {
+			if n, err := strconv.Atoi(rest); err == nil && n >= 0 {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// start begins a fresh run with every pin an input
+func (s *mcuSketch) start(x []float64) {
+	if s.machine != nil {
+		s.machine.Close()
+	}
+	for _, pin := range s.pins {
+		pin.mode, pin.state = sketch.ModeInput, "INPUT"
+		if pin.out >= 0 {
+			out := &s.board.outputs[pin.out]
+			out.off, out.wave = true, dcWave(0)
+		}
+	}
+	s.x, s.events, s.truncated = x, nil, false
+	s.machine = sketch.NewMachine(s.prog, s, sketch.Options{
+		IntBits:    s.board.spec.intBits,
+		LEDBuiltin: s.board.spec.ledBuiltin,
+		AnalogBase: s.board.spec.analogBase,
+		AnalogPins: s.board.spec.analogPins,
+		MaxSteps:   sketchMaxSteps,
+	})
+}
+
+func (s *mcuSketch) pin(number int) *sketchPin {
+	p, ok := s.pins[number]
+	if !ok {
+		p = &sketchPin{name: strconv.Itoa(number), out: -1, state: "INPUT"}
+		s.pins[number] = p
+	}
+	return p
+}
+
+// drive sets the output of a pin and records the change
+func (s *mcuSketch) drive(p *sketchPin, mode int, state string, wave *sourceWave, resistance float64) {
+	p.mode = mode
+	if p.out >= 0 {
+		out := &s.board.outputs[p.out]
+		out.off = wave == nil
+		if wave != nil {
+			out.wave, out.resistance = wave, resistance
+		}
+	}
+	if state == p.state {
+		return
+	}
+	p.state = state
+	if len(s.events) >= maxPinEvents {
+		s.truncated = true
+		return
+	}
+	s.events = append(s.events, PinEvent{Time: round(s.machine.Time()), Pin: p.name, State: state})
+}
+
+func (s *mcuSketch) PinMode(number, mode int) {
+	p := s.pin(number)
+	level := s.board.spec.logicLevel
+	switch mode {
+	case sketch.ModeOutput:
+		if p.mode != sketch.ModeOutput {
+			// An output starts low, or high when the pull-up was on
+			high := p.state == "INPUT_PULLUP"
+			s.drive(p, mode, highLow(high), dcWave(level*boolLevel(high)), pinResistance)
+		}
+	case sketch.ModeInputPullup:
+		s.drive(p, mode, "INPUT_PULLUP", dcWave(level), pullupResistance)
+	default:
+		s.drive(p, sketch.ModeInput, "INPUT", nil, 0)
+	}
+}
+
+func (s *mcuSketch) DigitalWrite(number int, high bool) {
+	p := s.pin(number)
+	level := s.board.spec.logicLevel
+	if p.mode != sketch.ModeOutput {
+		// Writing an input switches its pull-up, as on an AVR
+		if high {
+			s.drive(p, sketch.ModeInputPullup, "INPUT_PULLUP", dcWave(level), pullupResistance)
+		} else {
+			s.drive(p, sketch.ModeInput, "INPUT", nil, 0)
+		}
+		return
+	}
+	s.drive(p, sketch.ModeOutput, highLow(high), dcWave(level*boolLevel(high)), pinResistance)
+}
+
+func (s *mcuSketch) AnalogWrite(number, value int) {
+	p := s.pin(number)
+	level := s.board.spec.logicLevel
+	switch value {
+	case 0:
+		s.drive(p, sketch.ModeOutput, "LOW", dcWave(0), pinResistance)
+	case 255:
+		s.drive(p, sketch.ModeOutput, "HIGH", dcWave(level), pinResistance)
+	default:
+		s.drive(p, sketch.ModeOutput, fmt.Sprintf("PWM %d", value), pwmWave(level, float64(value)/255, defaultPWMFrequency), pinResistance)
+	}
+}
+
+func (s *mcuSketch) Tone(number int, frequency float64) {
+	p := s.pin(number)
+	if frequency <= 0 {
+		s.drive(p, sketch.ModeOutput, "LOW", dcWave(0), pinResistance)
+		return
+	}
+	s.drive(p, sketch.ModeOutput, fmt.Sprintf("TONE %g Hz", frequency), pwmWave(s.board.spec.logicLevel, 0.5, frequency), pinResistance)
+}
+
+// pinVoltage is the voltage of a pin in the last solution. Before the
+// circuit is solved, inputs read their pull-up or ground.
+func (s *mcuSketch) pinVoltage(p *sketchPin) float64 {
+	if s.x == nil || p.out < 0 {
+		if p.mode == sketch.ModeInput {
+			return 0
+		}
+		if p.out >= 0 {
+			return s.board.outputs[p.out].wave.at(0)
+		}
+		return boolLevel(p.state == "HIGH" || p.state == "INPUT_PULLUP") * s.board.spec.logicLevel
+	}
+	return voltage(s.x, s.board.outputs[p.out].node) - voltage(s.x, s.board.gnd)
+}
+
+func (s *mcuSketch) DigitalRead(number int) bool {
+	return s.pinVoltage(s.pin(number)) > s.board.spec.logicLevel/2
+}
+
+func (s *mcuSketch) AnalogRead(number int) int {
+	if number >= 0 && number < s.board.spec.analogPins {
+		number += s.board.spec.analogBase // analogRead(0) is A0
+	}
+	ratio := s.pinVoltage(s.pin(number)) / s.board.spec.logicLevel
+	adcMax := float64(s.board.spec.adcMax)
+	return int(math.Min(math.Max(math.Round(ratio*adcMax), 0), adcMax))
+}
+
+func highLow(high bool) string {
+	if high {
+		return "HIGH"
+	}
+	return "LOW"
+}
+
+func boolLevel(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// begin restarts the sketch with the transient analysis
+func (m *mcu) begin(x []float64, _ bool) {
+	if m.sketch != nil && m.sketch.prog != nil {
+		m.sketch.solved = append(m.sketch.solved[:0], m.outputs...)
+		m.sketch.start(x)
+	}
+}
+
+// accept runs the sketch up to the end of the step, seeing its solution;
+// what it writes drives the next step
+func (m *mcu) accept(x []float64, ctx *stampContext) {
+	if m.sketch == nil || m.sketch.machine == nil {
+		return
+	}
+	m.sketch.x = append(m.sketch.x[:0], x...)
+	m.sketch.solved = append(m.sketch.solved[:0], m.outputs...)
+	m.sketch.machine.RunUntil(ctx.time)
+}
+
+// result reports what the sketch has done so far
+func (s *mcuSketch) result() SketchResult {
+	res := SketchResult{
+		ComponentID: s.board.comp.ID,
+		Board:       s.board.name(),
+		Serial:      []sketch.SerialLine{},
+		Pins:        append([]PinEvent{}, s.events...),
+		Truncated:   s.truncated,
+		Error:       s.compileErr,
+	}
+	if s.machine != nil {
+		res.RunTime = round(s.machine.Time())
+		res.Serial = s.machine.Serial()
+		if err := s.machine.Err(); err != nil {
+			res.Error = err
+		}
+	}
+	return res
+}
+
+// sketches reports the sketches of the circuit's boards
+func (c *Circuit) sketches() []SketchResult {
+	var results []SketchResult
+	for _, dev := range c.devices {
+		if m, ok := dev.(*mcu); ok && m.sketch != nil {
+			results = append(results, m.sketch.result())
+		}
+	}
+	return results
+}
+
+// runsSketch reports whether a board of the circuit runs a sketch
+func (c *Circuit) runsSketch() bool {
+	for _, dev := range c.devices {
+		if m, ok := dev.(*mcu); ok && m.sketch != nil && m.sketch.prog != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// stopSketches ends the runs of the sketches
+func (c *Circuit) stopSketches() {
+	for _, dev := range c.devices {
+		if m, ok := dev.(*mcu); ok && m.sketch != nil && m.sketch.machine != nil {
+			m.sketch.machine.Close()
+		}
+	}
+}
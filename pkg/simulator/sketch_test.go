@@ -0,0 +1,72 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSketchBlink(t *testing.T) {
+	tests := []struct {
+		name  string
+		pin   int
+		delay int // ms
+	}{
+		{"built-in LED pin every 500ms", 13, 500},
+		{"pin 8 every 250ms", 8, 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := fmt.Sprintf(`void setup() { pinMode(%[1]d, OUTPUT); }
+void loop() {
+  digitalWrite(%[1]d, HIGH);
+  delay(%[2]d);
+  digitalWrite(%[1]d, LOW);
+  delay(%[2]d);
+}`, tt.pin, tt.delay)
+			pin := fmt.Sprintf("D%d", tt.pin)
+			schema := testSchema(t, []part{
+				{"U1:arduino_uno", map[string]interface{}{"sketch": code}},
+				{"R1:resistor", map[string]interface{}{"resistance": 220}},
+				{"D1:led", map[string]interface{}{"color": "red"}},
+			}, "U1."+pin+"-R1.p1", "R1.p2-D1.anode", "D1.cathode-U1.GND")
+
+			stop := 2.0
+			tr := AnalyzeTransient(schema, TransientOptions{Step: 1e-3, StopTime: stop})
+			if !tr.Works() {
+				t.Fatalf("transient does not work: %v", tr.ErrorMessages())
+			}
+			if len(tr.Sketches) != 1 || tr.Sketches[0].Error != nil {
+				t.Fatalf("sketches = %+v, want one that runs", tr.Sketches)
+			}
+
+			// pinMode drives the pin low, then it toggles every delay
+			half := float64(tt.delay) / 1000
+			events := tr.Sketches[0].Pins
+			if want := 1 + int(stop/half); len(events) != want {
+				t.Fatalf("got %d pin events, want %d: %+v", len(events), want, events)
+			}
+			for k, e := range events[1:] {
+				want := highLow(k%2 == 0)
+				if e.Pin != pin || e.State != want || math.Abs(e.Time-float64(k)*half) > 1e-3 {
+					t.Errorf("event %d = %+v, want %s %s at %gs", k+1, e, pin, want, float64(k)*half)
+				}
+			}
+
+			// The LED follows the pin
+			current := tr.Waveform.Signal("I(D1)")
+			if current == nil {
+				t.Fatal("no LED current recorded")
+			}
+			for i, at := range tr.Waveform.Time {
+				phase := math.Mod(at, 2*half) / half
+				if phase < 0.1 || (phase > 0.9 && phase < 1.1) || phase > 1.9 {
+					continue // near a toggle
+				}
+				if on := current.Values[i] > 1e-3; on != (phase < 1) {
+					t.Fatalf("LED current at %gs = %g, want the LED %s", at, current.Values[i], onOff(phase < 1, "on", "off"))
+				}
+			}
+		})
+	}
+}
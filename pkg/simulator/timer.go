@@ -0,0 +1,171 @@
+package simulator
+
+import (
+	"math"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// 555 Timer
+// ============================================
+
+// timer555Types are the component types of a 555 timer
+var timer555Types = map[string]bool{
+	"timer_555": true,
+	"555_timer": true,
+	"555":       true,
+	"ne555":     true,
+	"lm555":     true,
+}
+
+const (
+	timerDividerResistance = 5000
+	timerOutputResistance  = 10
+	timerHighDrop          = 1.7 // output high sits this far below VCC
+	timerDischargeOn       = 10
+	timerResetThreshold    = 0.7
+	timerMaxOutputCurrent  = 0.2
+	timerMinSupply         = 4.5
+	timerMaxSupply         = 16
+)
+
+// timer555 is a behavioral NE555. An internal 5k-5k-5k divider puts the
+// threshold comparator at CTRL (2/3 VCC) and the trigger comparator at
+// half of it; a flip-flop drives OUT and shorts DIS to ground while low.
+type timer555 struct {
+	base
+	vcc, gnd, trig, thr, out, dis, ctrl int
+	rst                                 int // -1 when not wired (held high)
+	third                               int // internal 1/3 VCC node
+	q                                   bool
+	qStart                              bool // output at the start of the step
+}
+
+func newTimer555(b base, nl *Netlist) *timer555 {
+	t := &timer555{
+		base:  b,
+		vcc:   nl.terminal(b.comp, []string{"vcc", "8", "v+"}),
+		gnd:   nl.terminal(b.comp, []string{"gnd", "1"}),
+		trig:  nl.terminal(b.comp, []string{"trig", "trigger", "tr", "2"}),
+		out:   nl.terminal(b.comp, []string{"out", "output", "q", "3"}),
+		ctrl:  nl.terminal(b.comp, []string{"ctrl", "control", "cv", "5"}),
+		thr:   nl.terminal(b.comp, []string{"thr", "threshold", "th", "6"}),
+		dis:   nl.terminal(b.comp, []string{"dis", "discharge", "7"}),
+		rst:   -1,
+		third: nl.internalNode(),
+	}
+	if reset, ok := nl.lookup(b.comp.ID, []string{"reset", "rst", "r", "4"}); ok {
+		t.rst = reset
+	}
+	return t
+}
+
+func (t *timer555) nonlinear() bool { return true }
+
+func (t *timer555) reset() {
+	t.q, t.qStart = false, false
+}
+
+func (t *timer555) begin(x []float64, fromRest bool) {
+	if fromRest {
+		t.q = false
+	}
+	t.qStart = t.q
+}
+
+// accept clocks the flip-flop on the accepted solution for the next step.
+// Within a step the output holds, so a comparator sitting on its threshold cannot
+// keep Newton flipping between the two states.
+func (t *timer555) accept(x []float64, _ *stampContext) {
+	t.qStart = t.output(func(node int) float64 { return voltage(x, node) })
+}
+
+// output evaluates the comparators and the flip-flop
+func (t *timer555) output(v func(int) float64) bool {
+	ground := v(t.gnd)
+	if t.rst >= 0 && v(t.rst)-ground < timerResetThreshold {
+		return false
+	}
+	control := v(t.ctrl) - ground
+	switch {
+	case v(t.trig)-ground < control/2:
+		return true
+	case v(t.thr)-ground > control:
+		return false
+	}
+	return t.qStart
+}
+
+func (t *timer555) stamp(s *system, ctx *stampContext) {
+	g := 1.0 / timerDividerResistance
+	s.stampConductance(t.vcc, t.ctrl, g)
+	s.stampConductance(t.ctrl, t.third, g)
+	s.stampConductance(t.third, t.gnd, g)
+
+	if ctx.dt > 0 {
+		t.q = t.qStart
+	} else if q := t.output(ctx.v); q != t.q {
+		t.q = q
+		ctx.limited = true
+	}
+
+	gOut := 1.0 / timerOutputResistance
+	if t.q {
+		// OUT follows VCC minus the output stage drop
+		s.stampConductance(t.vcc, t.out, gOut)
+		s.stampCurrent(t.out, t.vcc, timerHighDrop*gOut)
+		s.stampConductance(t.dis, t.gnd, 1/switchOffResistance)
+	} else {
+		s.stampConductance(t.out, t.gnd, gOut)
+		s.stampConductance(t.dis, t.gnd, 1.0/timerDischargeOn)
+	}
+}
+
+func (t *timer555) paths() [][2]int {
+	paths := [][2]int{{t.vcc, t.ctrl}, {t.ctrl, t.third}, {t.third, t.gnd}}
+	if t.q {
+		return append(paths, [2]int{t.vcc, t.out})
+	}
+	return append(paths, [2]int{t.out, t.gnd}, [2]int{t.dis, t.gnd})
+}
+
+func (t *timer555) report(x []float64, _ float64) ComponentResult {
+	ground := voltage(x, t.gnd)
+	vOut := voltage(x, t.out) - ground
+	vcc := voltage(x, t.vcc) - ground
+
+	current := -vOut / timerOutputResistance
+	if t.q {
+		current = (vcc - timerHighDrop - vOut) / timerOutputResistance
+	}
+
+	res := t.result(vOut, current)
+	res.Power = math.Abs(current)*math.Abs(vcc-vOut) + vcc*vcc/(3*timerDividerResistance)
+	res.State = onOff(t.q, "high", "low")
+	res.Terminals = map[string]float64{
+		"vcc":  voltage(x, t.vcc),
+		"out":  voltage(x, t.out),
+		"trig": voltage(x, t.trig),
+		"thr":  voltage(x, t.thr),
+		"ctrl": voltage(x, t.ctrl),
+		"dis":  voltage(x, t.dis),
+	}
+	return res
+}
+
+func (t *timer555) check(res *ComponentResult, is *issues) {
+	supply := res.Terminals["vcc"] - (res.Terminals["out"] - res.Voltage)
+	switch {
+	case supply > timerMaxSupply:
+		is.errorf(t.comp.ID, IssueOvervoltage, "%s gets %s but tolerates at most %s",
+			t.name(), schematic.FormatValue(supply, "V"), schematic.FormatValue(timerMaxSupply, "V"))
+	case supply < timerMinSupply:
+		is.warnf(t.comp.ID, IssueUnderpowered, "%s gets %s but needs at least %s",
+			t.name(), schematic.FormatValue(supply, "V"), schematic.FormatValue(timerMinSupply, "V"))
+	}
+	if math.Abs(res.Current) > timerMaxOutputCurrent {
+		is.errorf(t.comp.ID, IssueOvercurrent, "%s output carries %s, above its %s limit",
+			t.name(), schematic.FormatValue(math.Abs(res.Current), "A"), schematic.FormatValue(timerMaxOutputCurrent, "A"))
+	}
+}
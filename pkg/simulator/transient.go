@@ -0,0 +1,358 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Transient Analysis
+// ============================================
+
+const (
+	// MaxTransientSteps bounds the work of a single transient analysis
+	MaxTransientSteps = 100000
+	// MaxStoredPoints is the resolution waveforms are kept at
+	MaxStoredPoints  = 4000
+	defaultSteps     = 1000
+	stepsPerPeriod   = 50
+	maxStepHalvings  = 8
+	defaultStopTime  = 10e-3
+	minStopTime      = 1e-6
+	maxStopTime      = 100
+	defaultTimeScale = 1000 // Ω used to estimate time constants without resistors
+)
+
+// TransientOptions configures a transient analysis. Zero values pick
+// defaults from the circuit: five time constants or five periods of the
+// slowest source, in about a thousand steps.
+type TransientOptions struct {
+	Step     float64 `json:"step"`
+	StopTime float64 `json:"stop_time"`
+	Method   string  `json:"method"`
+	// FromOperatingPoint starts from the DC solution instead of from rest
+	// (capacitors discharged, inductors without current)
+	FromOperatingPoint bool `json:"from_operating_point"`
+}
+
+// TransientResult is the result of a transient analysis
+type TransientResult struct {
+	Converged bool      `json:"converged"`
+	Method    string    `json:"method"`
+	Step      float64   `json:"step"`
+	StopTime  float64   `json:"stop_time"`
+	Steps     int       `json:"steps"`
+	Waveform  *Waveform `json:"waveform"`
+	// Sketches is what the programs of the boards did during the run
+	Sketches []SketchResult `json:"sketches,omitempty"`
+	Errors   []Issue        `json:"errors"`
+	Warnings []Issue        `json:"warnings"`
+}
+
+// Works returns true when every step converged without errors
+func (tr *TransientResult) Works() bool {
+	return tr.Converged && len(tr.Errors) == 0
+}
+
+// ErrorMessages returns the error messages as plain strings
+func (tr *TransientResult) ErrorMessages() []string {
+	return messages(tr.Errors)
+}
+
+// WarningMessages returns the warning messages as plain strings
+func (tr *TransientResult) WarningMessages() []string {
+	return messages(tr.Warnings)
+}
+
+// AnalyzeTransient runs a transient analysis of a schema
+func AnalyzeTransient(schema *schematic.Schema, opts TransientOptions) *TransientResult {
+	return Build(schema).Transient(opts)
+}
+
+// recorder samples one signal from a solution
+type recorder func(x []float64, t float64, results []ComponentResult) float64
+
+// Transient integrates the circuit over time
+func (c *Circuit) Transient(opts TransientOptions) *TransientResult {
+	is := issues{
+		Errors:   append([]Issue{}, c.issues.Errors...),
+		Warnings: append([]Issue{}, c.issues.Warnings...),
+	}
+	opts = c.transientDefaults(opts, &is)
+	tr := &TransientResult{
+		Method:   opts.Method,
+		Step:     opts.Step,
+		StopTime: opts.StopTime,
+		Waveform: &Waveform{Time: []float64{}, Signals: []Signal{}},
+	}
+	defer func() {
+		tr.Errors, tr.Warnings = is.Errors, is.Warnings
+	}()
+
+	if len(c.devices) == 0 {
+		is.errorf("", IssueEmptyCircuit, "The circuit has no components to simulate")
+		return tr
+	}
+	if !c.hasSource() {
+		is.errorf("", IssueNoPowerSource, "The circuit has no power source")
+		return tr
+	}
+
+	// Initial state
+	x := make([]float64, c.nodes+c.branches)
+	if opts.FromOperatingPoint {
+		var err error
+		if x, _, err = c.solveOperatingPoint(); err != nil {
+			is.errorf("", IssueNotConverged, "The initial operating point could not be solved")
+			return tr
+		}
+	} else {
+		c.reset()
+	}
+	for _, dev := range c.devices {
+		if r, ok := dev.(reactive); ok {
+			r.begin(x, !opts.FromOperatingPoint)
+		}
+	}
+	defer c.stopSketches()
+
+	signals, recorders := c.signals()
+	tr.Waveform.Signals = signals
+	seen := map[string]bool{}
+	record := func(x []float64, t float64) {
+		results := make([]ComponentResult, len(c.devices))
+		for i, dev := range c.devices {
+			results[i] = dev.report(x, t)
+			if t > 0 {
+				c.checkAt(dev, &results[i], t, &is, seen)
+			}
+		}
+		tr.Waveform.Time = append(tr.Waveform.Time, t)
+		for i, rec := range recorders {
+			tr.Waveform.Signals[i].Values = append(tr.Waveform.Signals[i].Values, rec(x, t, results))
+		}
+	}
+	record(x, 0)
+
+	steps := int(math.Round(opts.StopTime / opts.Step))
+	progress := newProgressTracker(c.progress)
+	for n := 1; n <= steps; n++ {
+		if err := c.ctx.Err(); err != nil {
+			is.errorf("", IssueCancelled, "%s at %s", cancelMessage(err), schematic.FormatValue(float64(n-1)*opts.Step, "s"))
+			break
+		}
+		t := float64(n-1) * opts.Step
+		method := opts.Method
+		if n == 1 && !opts.FromOperatingPoint {
+			// The trapezoidal rule rings on the step from rest; start with Euler
+			method = MethodBackwardEuler
+		}
+
+		next, err := c.step(x, t, opts.Step, method, 0)
+		if err != nil {
+			is.errorf("", IssueNotConverged, "The simulation did not converge at %s", schematic.FormatValue(t+opts.Step, "s"))
+			break
+		}
+		x = next
+		tr.Steps = n
+		record(x, t+opts.Step)
+		if done := float64(n) / float64(steps); progress.due(done) {
+			progress.send(done, t+opts.Step, tr.Waveform, &is)
+		}
+	}
+	tr.Converged = tr.Steps == steps
+	if steps > 0 {
+		progress.send(float64(tr.Steps)/float64(steps), float64(tr.Steps)*opts.Step, tr.Waveform, &is)
+	}
+
+	tr.Waveform.finalize()
+	tr.Waveform = tr.Waveform.Downsample(MaxStoredPoints)
+	tr.Sketches = c.sketches()
+	return tr
+}
+
+// step advances the solution by dt, halving the step where Newton fails
+func (c *Circuit) step(x []float64, t, dt float64, method string, depth int) ([]float64, error) {
+	env := stampContext{scale: 1, dt: dt, time: t + dt, method: method}
+	next, _, err := c.newton(x, env)
+	if err == nil {
+		for _, dev := range c.devices {
+			if r, ok := dev.(reactive); ok {
+				r.accept(next, &env)
+			}
+		}
+		return next, nil
+	}
+	if !errors.Is(err, errNotConverged) || depth >= maxStepHalvings {
+		return nil, err
+	}
+
+	mid, err := c.step(x, t, dt/2, method, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return c.step(mid, t+dt/2, dt/2, method, depth+1)
+}
+
+// checkAt runs a device's checks at time t, keeping only the first
+// occurrence of each problem
+func (c *Circuit) checkAt(dev device, res *ComponentResult, t float64, is *issues, seen map[string]bool) {
+	var found issues
+	dev.check(res, &found)
+	at := fmt.Sprintf(" (at %s)", schematic.FormatValue(t, "s"))
+	for _, issue := range found.Errors {
+		if key := "e" + issue.ComponentID + issue.Code; !seen[key] {
+			seen[key] = true
+			issue.Message += at
+			is.Errors = append(is.Errors, issue)
+		}
+	}
+	for _, issue := range found.Warnings {
+		if key := "w" + issue.ComponentID + issue.Code; !seen[key] {
+			seen[key] = true
+			issue.Message += at
+			is.Warnings = append(is.Warnings, issue)
+		}
+	}
+}
+
+// signals lists what a transient analysis records: the voltage of every
+// net and the current through every component
+func (c *Circuit) signals() ([]Signal, []recorder) {
+	signals := []Signal{}
+	recorders := []recorder{}
+
+	for node, net := range c.netlist.Nets {
+		if node == 0 || len(net.Pins) == 0 {
+			continue
+		}
+		node := node
+		signals = append(signals, Signal{Name: "V(" + net.Name + ")", Unit: "V", Pins: net.Pins, Values: []float64{}})
+		recorders = append(recorders, func(x []float64, _ float64, _ []ComponentResult) float64 {
+			return voltage(x, node)
+		})
+	}
+
+	for i, dev := range c.devices {
+		i := i
+		comp := dev.component()
+		name, unit := "I("+displayName(*comp)+")", "A"
+		value := func(_ []float64, _ float64, results []ComponentResult) float64 { return results[i].Current }
+		switch d := dev.(type) {
+		case *probe:
+			if d.node < 0 {
+				continue
+			}
+			name, unit = "V("+displayName(*comp)+")", "V"
+			value = func(_ []float64, _ float64, results []ComponentResult) float64 { return results[i].Voltage }
+		case *meter:
+			if !d.series {
+				name, unit = "V("+displayName(*comp)+")", "V"
+				value = func(_ []float64, _ float64, results []ComponentResult) float64 { return results[i].Voltage }
+			}
+		}
+		signals = append(signals, Signal{Name: name, Unit: unit, ComponentID: comp.ID, Values: []float64{}})
+		recorders = append(recorders, value)
+	}
+
+	return signals, recorders
+}
+
+// transientDefaults fills in unset options and keeps the step fine enough
+// for the fastest source and the run within MaxTransientSteps
+func (c *Circuit) transientDefaults(opts TransientOptions, is *issues) TransientOptions {
+	if opts.Method != MethodBackwardEuler {
+		opts.Method = MethodTrapezoidal
+	}
+
+	shortest, longest := c.sourcePeriods()
+	if opts.StopTime <= 0 {
+		stop := math.Max(5*c.timeConstant(), 5*longest)
+		if c.runsSketch() {
+			stop = math.Max(stop, defaultSketchStopTime)
+		}
+		if stop == 0 {
+			stop = defaultStopTime
+		}
+		opts.StopTime = math.Min(math.Max(stop, minStopTime), maxStopTime)
+	}
+
+	userStep := opts.Step > 0
+	if !userStep {
+		opts.Step = opts.StopTime / defaultSteps
+	}
+	if shortest > 0 && opts.Step > shortest/stepsPerPeriod {
+		if userStep {
+			is.warnf("", IssueStepAdjusted, "The time step was reduced to %s to resolve the fastest source",
+				schematic.FormatValue(shortest/stepsPerPeriod, "s"))
+		}
+		opts.Step = shortest / stepsPerPeriod
+	}
+	if opts.StopTime/opts.Step > MaxTransientSteps {
+		opts.Step = opts.StopTime / MaxTransientSteps
+		is.warnf("", IssueStepAdjusted, "The time step was raised to %s to stay within %d steps",
+			schematic.FormatValue(opts.Step, "s"), MaxTransientSteps)
+	}
+	if opts.Step > opts.StopTime {
+		opts.Step = opts.StopTime
+	}
+	return opts
+}
+
+// sourcePeriods returns the shortest and longest period of the periodic sources
+func (c *Circuit) sourcePeriods() (shortest, longest float64) {
+	consider := func(w *sourceWave) {
+		p := w.period()
+		if p == 0 {
+			return
+		}
+		if shortest == 0 || p < shortest {
+			shortest = p
+		}
+		longest = math.Max(longest, p)
+	}
+	for _, dev := range c.devices {
+		switch d := dev.(type) {
+		case *voltageSource:
+			consider(d.wave)
+		case *mcu:
+			for _, out := range d.outputs {
+				consider(out.wave)
+			}
+			if d.sketch != nil && d.sketch.prog != nil && d.sketch.prog.Uses("analogWrite") {
+				consider(pwmWave(1, 0.5, defaultPWMFrequency))
+			}
+		}
+	}
+	return shortest, longest
+}
+
+// timeConstant roughly estimates the slowest RC or L/R time constant
+func (c *Circuit) timeConstant() float64 {
+	rMin, rMax := math.Inf(1), 0.0
+	for _, dev := range c.devices {
+		switch d := dev.(type) {
+		case *resistor:
+			rMin, rMax = math.Min(rMin, d.resistance), math.Max(rMax, d.resistance)
+		case *potentiometer:
+			rMin, rMax = math.Min(rMin, d.resistance), math.Max(rMax, d.resistance)
+		}
+	}
+	if rMax == 0 {
+		rMin, rMax = defaultTimeScale, defaultTimeScale
+	}
+
+	tau := 0.0
+	for _, dev := range c.devices {
+		switch d := dev.(type) {
+		case *capacitor:
+			tau = math.Max(tau, d.capacitance*rMax)
+		case *inductor:
+			tau = math.Max(tau, d.inductance/rMin)
+		}
+	}
+	return tau
+}
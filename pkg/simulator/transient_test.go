@@ -0,0 +1,53 @@
+package simulator
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestTransientRCStep(t *testing.T) {
+	tests := []struct {
+		name        string
+		volts       float64
+		resistance  float64
+		capacitance float64
+		method      string
+	}{
+		{"1k 1uF trapezoidal", 5, 1000, 1e-6, MethodTrapezoidal},
+		{"1k 1uF backward Euler", 5, 1000, 1e-6, MethodBackwardEuler},
+		{"10k 100nF from 9V", 9, 10000, 100e-9, MethodTrapezoidal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := testSchema(t, []part{
+				{"V1:power_supply", map[string]interface{}{"voltage": tt.volts}},
+				{"R1:resistor", map[string]interface{}{"resistance": tt.resistance}},
+				{"C1:capacitor", map[string]interface{}{"capacitance": tt.capacitance}},
+			}, "V1.positive-R1.p1", "R1.p2-C1.p1", "C1.p2-V1.negative")
+
+			tau := tt.resistance * tt.capacitance
+			tr := AnalyzeTransient(schema, TransientOptions{Step: tau / 200, StopTime: 5 * tau, Method: tt.method})
+			if !tr.Works() {
+				t.Fatalf("transient does not work: %v", tr.ErrorMessages())
+			}
+
+			var charge *Signal
+			for i, sig := range tr.Waveform.Signals {
+				if slices.Contains(sig.Pins, "C1.p1") {
+					charge = &tr.Waveform.Signals[i]
+				}
+			}
+			if charge == nil {
+				t.Fatal("no signal for the capacitor's net")
+			}
+			// From rest the capacitor charges as V·(1 - e^(-t/RC))
+			for i, at := range tr.Waveform.Time {
+				want := tt.volts * (1 - math.Exp(-at/tau))
+				if got := charge.Values[i]; math.Abs(got-want) > 0.01*tt.volts {
+					t.Fatalf("V(C1) at %gs = %g, want %g", at, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,679 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Parameter Sweeps and Monte Carlo Analysis
+// ============================================
+
+// Kinds of variation
+const (
+	VariationSweep      = "sweep"
+	VariationMonteCarlo = "monte_carlo"
+)
+
+// ScaleLog spaces sweep values evenly on a log scale; SweepLinear spaces
+// them evenly
+const ScaleLog = "log"
+
+// Tolerance distributions. A gaussian tolerance is three standard
+// deviations, cut off at the tolerance.
+const (
+	DistributionGaussian = "gaussian"
+	DistributionUniform  = "uniform"
+)
+
+// What a transient variant is measured by at each probe
+const (
+	MeasureFinal      = "final"
+	MeasureAverage    = "average"
+	MeasureMin        = "min"
+	MeasureMax        = "max"
+	MeasurePeakToPeak = "peak_to_peak"
+	MeasureRMS        = "rms"
+)
+
+const (
+	// MaxVariants bounds the variants of a single run
+	MaxVariants           = 200
+	defaultSweepPoints    = 10
+	defaultMonteCarloRuns = 50
+	histogramBins         = 10
+	toleranceSigmas       = 3
+)
+
+// SweepOptions steps one component property through a range of values,
+// or through the listed Values
+type SweepOptions struct {
+	Component string    `json:"component"` // component ID or name
+	Property  string    `json:"property"`  // defaults to the component's value
+	Start     float64   `json:"start"`
+	Stop      float64   `json:"stop"`
+	Points    int       `json:"points"`
+	Scale     string    `json:"scale"` // lin or log
+	Values    []float64 `json:"values,omitempty"`
+}
+
+// MonteCarloOptions draws component values from their tolerances. Keys of
+// Tolerances are a component ("R1", varying its value) or a property
+// ("R1.resistance"); components with a "tolerance" property are varied too.
+type MonteCarloOptions struct {
+	Runs         int                `json:"runs"`
+	Seed         int64              `json:"seed"`
+	Distribution string             `json:"distribution"`
+	Tolerances   map[string]float64 `json:"tolerances"` // relative, 0.05 is 5%
+}
+
+// VariationOptions configures a sweep or a Monte Carlo analysis. Each
+// variant is measured at Probes, signal names such as "V(N2)" or
+// "I(R1)"; a DC variant also has "V(R1)", the voltage across a component.
+type VariationOptions struct {
+	Sweep      *SweepOptions      `json:"sweep,omitempty"`
+	MonteCarlo *MonteCarloOptions `json:"monte_carlo,omitempty"`
+	Probes     []string           `json:"probes"`
+	Measure    string             `json:"measure"`
+	Workers    int                `json:"-"` // variants simulated at once; all CPUs when zero
+}
+
+// Variant is one simulated variant of the circuit
+type Variant struct {
+	Index        int                `json:"index"`
+	Parameters   map[string]float64 `json:"parameters"`
+	Measurements map[string]float64 `json:"measurements"`
+	Passed       bool               `json:"passed"`
+	DurationMs   int                `json:"duration_ms"`
+	Errors       []Issue            `json:"errors,omitempty"`
+
+	// The full results, kept by the caller with the variant
+	OperatingPoint *OperatingPoint  `json:"-"`
+	Transient      *TransientResult `json:"-"`
+	Warnings       []Issue          `json:"-"`
+}
+
+// Histogram counts values in equal bins; Edges has one more entry than Counts
+type Histogram struct {
+	Edges  []float64 `json:"edges"`
+	Counts []int     `json:"counts"`
+}
+
+// ProbeStatistics summarize a probe over the variants that passed
+type ProbeStatistics struct {
+	Probe     string    `json:"probe"`
+	Unit      string    `json:"unit"`
+	Samples   int       `json:"samples"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Mean      float64   `json:"mean"`
+	StdDev    float64   `json:"std_dev"`
+	Histogram Histogram `json:"histogram"`
+}
+
+// VariationResult is the result of a sweep or Monte Carlo analysis
+type VariationResult struct {
+	Kind       string            `json:"kind"`
+	Analysis   string            `json:"analysis"`
+	Measure    string            `json:"measure,omitempty"`
+	Parameters []string          `json:"parameters"`
+	Variants   []*Variant        `json:"variants"`
+	Passed     int               `json:"passed"`
+	Failed     int               `json:"failed"`
+	Statistics []ProbeStatistics `json:"statistics"`
+	Errors     []Issue           `json:"errors"`
+	Warnings   []Issue           `json:"warnings"`
+}
+
+// Works returns true when at least one variant was simulated
+func (vr *VariationResult) Works() bool {
+	return len(vr.Errors) == 0 && vr.Passed > 0
+}
+
+// parameter is a component property a variation changes
+type parameter struct {
+	index     int // into schema.Components
+	property  string
+	nominal   float64
+	tolerance float64
+}
+
+func (p parameter) key(schema *schematic.Schema) string {
+	return displayName(schema.Components[p.index]) + "." + p.property
+}
+
+// valueProperties are the properties holding the value of a component
+// type, with the default the simulator assumes
+var valueProperties = map[string]struct {
+	keys     []string
+	fallback float64
+}{
+	"resistor":               {[]string{"resistance", "value"}, 1000},
+	"capacitor":              {[]string{"capacitance", "value"}, 1e-6},
+	"electrolytic_capacitor": {[]string{"capacitance", "value"}, 1e-6},
+	"capacitor_electrolytic": {[]string{"capacitance", "value"}, 1e-6},
+	"inductor":               {[]string{"inductance", "value"}, 1e-3},
+	"current_source":         {[]string{"current"}, 0.01},
+}
+
+// Vary simulates variants of a schema with the analysis, in parallel, and
+// summarizes the probes over them. Only "dc" and "transient" analyses can
+// be varied.
+func Vary(ctx context.Context, schema *schematic.Schema, analysis string, settings *Settings, report ProgressFunc) *VariationResult {
+	opts := *settings.Variation
+	vr := &VariationResult{
+		Analysis:   analysis,
+		Parameters: []string{},
+		Variants:   []*Variant{},
+		Statistics: []ProbeStatistics{},
+		Errors:     []Issue{},
+		Warnings:   []Issue{},
+	}
+	is := issues{Errors: []Issue{}, Warnings: []Issue{}}
+	defer func() {
+		vr.Errors, vr.Warnings = is.Errors, is.Warnings
+	}()
+
+	if analysis != AnalysisDC && analysis != AnalysisTransient {
+		is.errorf("", IssueInvalidVariation, "Sweeps and Monte Carlo runs vary DC or transient analyses, not %s", analysis)
+		return vr
+	}
+	if analysis == AnalysisTransient {
+		vr.Measure = opts.Measure
+		if vr.Measure == "" {
+			vr.Measure = MeasureFinal
+		}
+	}
+
+	var params []parameter
+	var values [][]float64 // per variant, per parameter
+	if opts.Sweep != nil {
+		vr.Kind = VariationSweep
+		params, values = sweepVariants(schema, opts.Sweep, &is)
+	} else {
+		vr.Kind = VariationMonteCarlo
+		params, values = monteCarloVariants(schema, opts.MonteCarlo, &is)
+	}
+	if len(is.Errors) > 0 {
+		return vr
+	}
+	for _, p := range params {
+		vr.Parameters = append(vr.Parameters, p.key(schema))
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	vr.Variants = make([]*Variant, len(values))
+	progress := newProgressTracker(report)
+	var mu sync.Mutex
+	done := 0
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indexes {
+				v := runVariantSafely(ctx, func() *schematic.Schema { return variantSchema(schema, params, values[k]) }, analysis, settings, vr.Measure)
+				v.Index = k
+				v.Parameters = map[string]float64{}
+				for i, p := range params {
+					v.Parameters[p.key(schema)] = round(values[k][i])
+				}
+				vr.Variants[k] = v
+
+				mu.Lock()
+				done++
+				if f := float64(done) / float64(len(values)); progress.due(f) {
+					progress.send(f, 0, nil, &issues{})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for k := range values {
+		select {
+		case indexes <- k:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		is.errorf("", IssueCancelled, "%s after %d of %d variants", cancelMessage(err), done, len(values))
+		simulated := vr.Variants[:0]
+		for _, v := range vr.Variants {
+			if v != nil {
+				simulated = append(simulated, v)
+			}
+		}
+		vr.Variants = simulated
+	}
+
+	seen := map[string]bool{}
+	for _, v := range vr.Variants {
+		if v.Passed {
+			vr.Passed++
+		} else {
+			vr.Failed++
+		}
+		for _, w := range v.Warnings {
+			if key := w.Code + "/" + w.ComponentID; !seen[key] {
+				seen[key] = true
+				is.Warnings = append(is.Warnings, w)
+			}
+		}
+	}
+	switch {
+	case len(vr.Variants) > 0 && vr.Passed == 0:
+		first := vr.Variants[0].Errors
+		is.errorf("", IssueVariantsFailed, "No variant of the circuit could be simulated: %s", issueMessage(first))
+	case vr.Failed > 0:
+		is.warnf("", IssueVariantsFailed, "%d of %d variants could not be simulated and are left out of the statistics", vr.Failed, len(vr.Variants))
+	}
+
+	vr.Statistics = probeStatistics(vr.Variants, probeUnits(schema, opts.Probes, vr.Variants, &is))
+	return vr
+}
+
+func issueMessage(list []Issue) string {
+	if len(list) == 0 {
+		return "unknown error"
+	}
+	return list[0].Message
+}
+
+// sweepVariants lists the values a sweep steps through
+func sweepVariants(schema *schematic.Schema, opts *SweepOptions, is *issues) ([]parameter, [][]float64) {
+	p, ok := findParameter(schema, opts.Component, opts.Property, is)
+	if !ok {
+		return nil, nil
+	}
+
+	points := opts.Values
+	if len(points) == 0 {
+		n := opts.Points
+		if n <= 0 {
+			n = defaultSweepPoints
+		}
+		start, stop := opts.Start, opts.Stop
+		if start == 0 && stop == 0 {
+			// A decade around the nominal value
+			start, stop = p.nominal/math.Sqrt(10), p.nominal*math.Sqrt(10)
+		}
+		for i := 0; i < n; i++ {
+			f := 0.0
+			if n > 1 {
+				f = float64(i) / float64(n-1)
+			}
+			if opts.Scale == ScaleLog {
+				points = append(points, start*math.Pow(stop/start, f))
+			} else {
+				points = append(points, start+(stop-start)*f)
+			}
+		}
+	}
+
+	values := make([][]float64, len(points))
+	for i, v := range points {
+		values[i] = []float64{v}
+	}
+	return []parameter{p}, values
+}
+
+// monteCarloVariants draws the values of the toleranced parameters
+func monteCarloVariants(schema *schematic.Schema, opts *MonteCarloOptions, is *issues) ([]parameter, [][]float64) {
+	params := []parameter{}
+	listed := map[int]bool{}
+	keys := make([]string, 0, len(opts.Tolerances))
+	for key := range opts.Tolerances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ref, property := key, ""
+		if dot := strings.LastIndex(key, "."); dot > 0 {
+			ref, property = key[:dot], key[dot+1:]
+		}
+		p, ok := findParameter(schema, ref, property, is)
+		if !ok {
+			return nil, nil
+		}
+		p.tolerance = opts.Tolerances[key]
+		params = append(params, p)
+		listed[p.index] = true
+	}
+	for i := range schema.Components {
+		comp := &schema.Components[i]
+		if listed[i] {
+			continue
+		}
+		tolerance, ok := toleranceProp(comp)
+		if !ok {
+			continue
+		}
+		if p, ok := findParameter(schema, comp.ID, "", &issues{}); ok {
+			p.tolerance = tolerance
+			params = append(params, p)
+		}
+	}
+	if len(params) == 0 {
+		is.errorf("", IssueInvalidVariation, "No component has a tolerance to vary; give monteCarlo.tolerances or a tolerance property")
+		return nil, nil
+	}
+
+	runs := opts.Runs
+	if runs <= 0 {
+		runs = defaultMonteCarloRuns
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	values := make([][]float64, runs)
+	for k := range values {
+		values[k] = make([]float64, len(params))
+		for i, p := range params {
+			var deviation float64
+			if opts.Distribution == DistributionUniform {
+				deviation = 2*rng.Float64() - 1
+			} else {
+				deviation = math.Max(-1, math.Min(1, rng.NormFloat64()/toleranceSigmas))
+			}
+			values[k][i] = p.nominal * (1 + deviation*p.tolerance)
+		}
+	}
+	return params, values
+}
+
+// toleranceProp reads a component's tolerance, a fraction or a percentage
+func toleranceProp(comp *schematic.Component) (float64, bool) {
+	v, ok := comp.Properties["tolerance"]
+	if !ok {
+		return 0, false
+	}
+	if s, isString := v.(string); isString {
+		return ParseTolerance(s)
+	}
+	t, ok := comp.Float("tolerance")
+	return t, ok && t > 0 && t < 1
+}
+
+// ParseTolerance reads "5%" or "0.05" as 0.05; tolerances are below 100%
+func ParseTolerance(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	value, ok := schematic.ParseValue(strings.TrimSuffix(s, "%"))
+	if !ok {
+		return 0, false
+	}
+	if percent {
+		value /= 100
+	}
+	return value, value > 0 && value < 1
+}
+
+// findParameter resolves a component property; an empty property is the
+// component's value
+func findParameter(schema *schematic.Schema, ref, property string, is *issues) (parameter, bool) {
+	for i := range schema.Components {
+		comp := &schema.Components[i]
+		if comp.ID != ref && !strings.EqualFold(displayName(*comp), ref) {
+			continue
+		}
+
+		spec, hasValue := valueProperties[strings.ToLower(comp.Type)]
+		if property == "" {
+			if !hasValue {
+				is.errorf(comp.ID, IssueInvalidVariation, "%s has no value to vary; name the property", displayName(*comp))
+				return parameter{}, false
+			}
+			property = spec.keys[0]
+		}
+		if nominal, ok := comp.Float(property); ok {
+			return parameter{index: i, property: property, nominal: nominal}, true
+		}
+		if hasValue && property == spec.keys[0] {
+			return parameter{index: i, property: property, nominal: floatProp(comp, spec.fallback, spec.keys...)}, true
+		}
+		is.errorf(comp.ID, IssueInvalidVariation, "%s has no numeric property %q", displayName(*comp), property)
+		return parameter{}, false
+	}
+	is.errorf("", IssueInvalidVariation, "Component %q is not in the circuit", ref)
+	return parameter{}, false
+}
+
+// variantSchema copies a schema with the parameters set to values
+func variantSchema(schema *schematic.Schema, params []parameter, values []float64) *schematic.Schema {
+	variant := *schema
+	variant.Components = append([]schematic.Component(nil), schema.Components...)
+	for i, p := range params {
+		comp := &variant.Components[p.index]
+		props := make(map[string]interface{}, len(comp.Properties)+1)
+		for k, v := range comp.Properties {
+			props[k] = v
+		}
+		props[p.property] = values[i]
+		comp.Properties = props
+	}
+	return &variant
+}
+
+// runVariant simulates a variant and measures it
+// runVariantSafely builds and simulates a variant, reporting a panic of the
+// simulator as a failed variant rather than taking the process down
+func runVariantSafely(ctx context.Context, build func() *schematic.Schema, analysis string, settings *Settings, measure string) (v *Variant) {
+	defer func() {
+		if r := recover(); r != nil {
+			v = &Variant{Measurements: map[string]float64{}, Errors: []Issue{{
+				Code:    IssueRunFailed,
+				Message: fmt.Sprintf("The simulator failed unexpectedly: %v", r),
+			}}}
+		}
+	}()
+	return runVariant(ctx, build(), analysis, settings, measure)
+}
+
+func runVariant(ctx context.Context, schema *schematic.Schema, analysis string, settings *Settings, measure string) *Variant {
+	started := time.Now()
+	v := &Variant{Measurements: map[string]float64{}}
+	defer func() {
+		v.DurationMs = int(time.Since(started).Milliseconds())
+	}()
+
+	circuit := Build(schema).WithContext(ctx)
+	op := circuit.OperatingPoint()
+	v.OperatingPoint = op
+	v.Errors, v.Warnings = op.Errors, op.Warnings
+	if len(op.Errors) > 0 {
+		return v
+	}
+
+	if analysis == AnalysisTransient {
+		tr := circuit.Transient(settings.Transient)
+		v.Transient = tr
+		v.Errors = append(v.Errors, tr.Errors...)
+		v.Warnings = append(append([]Issue{}, v.Warnings...), tr.Warnings...)
+		if len(v.Errors) > 0 {
+			return v
+		}
+		for _, sig := range tr.Waveform.Signals {
+			v.Measurements[sig.Name] = round(measureSignal(sig, measure))
+		}
+	} else {
+		ground := circuit.netlist.Nets[0].Name
+		for _, node := range op.Nodes {
+			if node.Name != ground {
+				v.Measurements["V("+node.Name+")"] = node.Voltage
+			}
+		}
+		for _, comp := range op.Components {
+			v.Measurements["V("+comp.Name+")"] = comp.Voltage
+			v.Measurements["I("+comp.Name+")"] = comp.Current
+		}
+	}
+	v.Passed = true
+	return v
+}
+
+// measureSignal reduces a transient signal to one value
+func measureSignal(sig Signal, measure string) float64 {
+	if len(sig.Values) == 0 {
+		return 0
+	}
+	switch measure {
+	case MeasureAverage:
+		return sig.Average
+	case MeasureMin:
+		return sig.Min
+	case MeasureMax:
+		return sig.Max
+	case MeasurePeakToPeak:
+		return sig.Max - sig.Min
+	case MeasureRMS:
+		sum := 0.0
+		for _, v := range sig.Values {
+			sum += v * v
+		}
+		return math.Sqrt(sum / float64(len(sig.Values)))
+	}
+	return sig.Values[len(sig.Values)-1]
+}
+
+// probeUnits picks the probes the statistics cover, with their units.
+// Without probes these are the probe and meter components, or else the
+// voltage of every net.
+func probeUnits(schema *schematic.Schema, probes []string, variants []*Variant, is *issues) map[string]string {
+	var measured map[string]float64
+	for _, v := range variants {
+		if v.Passed {
+			measured = v.Measurements
+			break
+		}
+	}
+	units := map[string]string{}
+	if measured == nil {
+		return units
+	}
+	unitOf := func(name string) string {
+		if strings.HasPrefix(name, "I(") {
+			return "A"
+		}
+		return "V"
+	}
+
+	for _, probe := range probes {
+		if _, ok := measured[probe]; ok {
+			units[probe] = unitOf(probe)
+			continue
+		}
+		is.warnf("", IssueUnknownProbe, "Probe %q matches no measured signal and was skipped", probe)
+	}
+	if len(probes) > 0 {
+		return units
+	}
+
+	for _, comp := range schema.Components {
+		name := displayName(comp)
+		switch strings.ToLower(comp.Type) {
+		case "probe", "voltmeter":
+			name = "V(" + name + ")"
+		case "ammeter":
+			name = "I(" + name + ")"
+		default:
+			continue
+		}
+		if _, ok := measured[name]; ok {
+			units[name] = unitOf(name)
+		}
+	}
+	if len(units) > 0 {
+		return units
+	}
+	for name := range measured {
+		if strings.HasPrefix(name, "V(") && !isComponentName(schema, name[2:len(name)-1]) {
+			units[name] = "V"
+		}
+	}
+	return units
+}
+
+func isComponentName(schema *schematic.Schema, name string) bool {
+	for _, comp := range schema.Components {
+		if displayName(comp) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// probeStatistics summarizes each probe over the variants that passed
+func probeStatistics(variants []*Variant, units map[string]string) []ProbeStatistics {
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := []ProbeStatistics{}
+	for _, name := range names {
+		values := []float64{}
+		for _, v := range variants {
+			if value, ok := v.Measurements[name]; ok && v.Passed {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		s := ProbeStatistics{Probe: name, Unit: units[name], Samples: len(values), Min: math.Inf(1), Max: math.Inf(-1)}
+		sum := 0.0
+		for _, value := range values {
+			s.Min, s.Max = math.Min(s.Min, value), math.Max(s.Max, value)
+			sum += value
+		}
+		mean := sum / float64(len(values))
+		variance := 0.0
+		for _, value := range values {
+			variance += (value - mean) * (value - mean)
+		}
+		s.Mean = round(mean)
+		s.StdDev = round(math.Sqrt(variance / float64(len(values))))
+		s.Histogram = histogram(values, s.Min, s.Max)
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// histogram counts values in histogramBins equal bins from min to max
+func histogram(values []float64, min, max float64) Histogram {
+	h := Histogram{Edges: make([]float64, histogramBins+1), Counts: make([]int, histogramBins)}
+	width := (max - min) / histogramBins
+	for i := range h.Edges {
+		h.Edges[i] = round(min + float64(i)*width)
+	}
+	for _, value := range values {
+		bin := 0
+		if width > 0 {
+			bin = int(math.Min(float64(histogramBins-1), math.Floor((value-min)/width)))
+		}
+		h.Counts[bin]++
+	}
+	return h
+}
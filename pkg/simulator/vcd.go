@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// ============================================
+// Value Change Dump
+// ============================================
+
+var vcdUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.\[\]]+`)
+
+// VCD returns the timing diagrams in Value Change Dump format (IEEE 1364),
+// readable by GTKWave and most waveform viewers
+func (r *DigitalResult) VCD() []byte {
+	var b bytes.Buffer
+	r.WriteVCD(&b)
+	return b.Bytes()
+}
+
+// WriteVCD writes the timing diagrams as a Value Change Dump, merging the
+// changes of the signals in time order as it goes
+func (r *DigitalResult) WriteVCD(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "$date\n  %s\n$end\n", time.Now().UTC().Format(time.RFC1123))
+	b.WriteString("$version\n  NexFi logic simulator\n$end\n")
+	fmt.Fprintf(b, "$timescale %s $end\n", LogicTimescale)
+	b.WriteString("$scope module circuit $end\n")
+
+	ids := make([]string, len(r.Signals))
+	for i, sig := range r.Signals {
+		ids[i] = vcdIdentifier(i)
+		name := vcdUnsafe.ReplaceAllString(sig.Name, "_")
+		fmt.Fprintf(b, "$var wire %d %s %s $end\n", sig.Width, ids[i], name)
+	}
+	b.WriteString("$upscope $end\n$enddefinitions $end\n")
+
+	// next[i] is the next change of signal i; the earliest goes first, and
+	// signals changing at the same time keep their order
+	next := make([]int, len(r.Signals))
+	last := int64(-1)
+	for {
+		signal := -1
+		for i, sig := range r.Signals {
+			if next[i] < len(sig.Changes) && (signal < 0 || sig.Changes[next[i]].T < r.Signals[signal].Changes[next[signal]].T) {
+				signal = i
+			}
+		}
+		if signal < 0 {
+			break
+		}
+		c := r.Signals[signal].Changes[next[signal]]
+		next[signal]++
+
+		if c.T != last {
+			if last < 0 && c.T == 0 {
+				b.WriteString("#0\n$dumpvars\n")
+			} else {
+				if last == 0 {
+					b.WriteString("$end\n")
+				}
+				fmt.Fprintf(b, "#%d\n", c.T)
+			}
+			last = c.T
+		}
+		if r.Signals[signal].Width == 1 {
+			fmt.Fprintf(b, "%s%s\n", c.V, ids[signal])
+		} else {
+			fmt.Fprintf(b, "b%s %s\n", c.V, ids[signal])
+		}
+	}
+	if last == 0 {
+		b.WriteString("$end\n")
+	}
+	if r.StopTime > last {
+		fmt.Fprintf(b, "#%d\n", r.StopTime)
+	}
+	return b.Flush()
+}
+
+// vcdIdentifier encodes a signal index with the printable characters VCD
+// uses for identifiers
+func vcdIdentifier(i int) string {
+	const first, count = '!', '~' - '!' + 1
+	id := []byte{}
+	for {
+		id = append(id, byte(first+i%count))
+		i /= count
+		if i == 0 {
+			return string(id)
+		}
+		i--
+	}
+}
@@ -0,0 +1,145 @@
+package simulator
+
+import "math"
+
+// ============================================
+// Waveforms
+// ============================================
+
+// Signal is one recorded quantity over time. Min, Max and Average always
+// describe the full-resolution recording, even after downsampling.
+type Signal struct {
+	Name        string    `json:"name"`
+	Unit        string    `json:"unit"`
+	ComponentID string    `json:"component_id,omitempty"`
+	Pins        []string  `json:"pins,omitempty"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	Average     float64   `json:"average"`
+	Values      []float64 `json:"values"`
+}
+
+// Waveform is a set of signals sampled on a shared time axis
+type Waveform struct {
+	Time    []float64 `json:"time"`
+	Signals []Signal  `json:"signals"`
+}
+
+// Signal returns a signal by name
+func (w *Waveform) Signal(name string) *Signal {
+	for i := range w.Signals {
+		if w.Signals[i].Name == name {
+			return &w.Signals[i]
+		}
+	}
+	return nil
+}
+
+// finalize computes the signal statistics and trims solver noise
+func (w *Waveform) finalize() {
+	for i := range w.Signals {
+		sig := &w.Signals[i]
+		if len(sig.Values) == 0 {
+			continue
+		}
+		sig.Min, sig.Max = math.Inf(1), math.Inf(-1)
+		sum := 0.0
+		for k, v := range sig.Values {
+			v = round(v)
+			sig.Values[k] = v
+			sig.Min = math.Min(sig.Min, v)
+			sig.Max = math.Max(sig.Max, v)
+			sum += v
+		}
+		sig.Average = round(sum / float64(len(sig.Values)))
+	}
+	for k, t := range w.Time {
+		w.Time[k] = round(t)
+	}
+}
+
+// Select keeps only the named signals; no names keeps all
+func (w *Waveform) Select(names []string) *Waveform {
+	if len(names) == 0 {
+		return w
+	}
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	out := &Waveform{Time: w.Time, Signals: []Signal{}}
+	for _, sig := range w.Signals {
+		if wanted[sig.Name] {
+			out.Signals = append(out.Signals, sig)
+		}
+	}
+	return out
+}
+
+// Window keeps the samples with from <= t <= to; to <= 0 means the end
+func (w *Waveform) Window(from, to float64) *Waveform {
+	if from <= 0 && to <= 0 {
+		return w
+	}
+	lo, hi := 0, len(w.Time)
+	for lo < hi && w.Time[lo] < from {
+		lo++
+	}
+	if to > 0 {
+		for hi > lo && w.Time[hi-1] > to {
+			hi--
+		}
+	}
+	return w.slice(lo, hi)
+}
+
+func (w *Waveform) slice(lo, hi int) *Waveform {
+	out := &Waveform{Time: w.Time[lo:hi], Signals: make([]Signal, len(w.Signals))}
+	for i, sig := range w.Signals {
+		sig.Values = sig.Values[lo:hi]
+		out.Signals[i] = sig
+	}
+	return out
+}
+
+// Downsample reduces the waveform to about points samples for plotting.
+// Each bucket keeps its minimum and maximum in time order so spikes and
+// PWM edges survive; the time axis takes the bucket's first and last instant.
+func (w *Waveform) Downsample(points int) *Waveform {
+	n := len(w.Time)
+	if points < 4 || n <= points {
+		return w
+	}
+
+	buckets := points / 2
+	out := &Waveform{Time: make([]float64, 0, 2*buckets), Signals: make([]Signal, len(w.Signals))}
+	for i, sig := range w.Signals {
+		sig.Values = make([]float64, 0, 2*buckets)
+		out.Signals[i] = sig
+	}
+
+	for b := 0; b < buckets; b++ {
+		lo, hi := b*n/buckets, (b+1)*n/buckets
+		if hi <= lo {
+			continue
+		}
+		out.Time = append(out.Time, w.Time[lo], w.Time[hi-1])
+		for i, sig := range w.Signals {
+			minIdx, maxIdx := lo, lo
+			for k := lo; k < hi; k++ {
+				if sig.Values[k] < sig.Values[minIdx] {
+					minIdx = k
+				}
+				if sig.Values[k] > sig.Values[maxIdx] {
+					maxIdx = k
+				}
+			}
+			first, second := sig.Values[minIdx], sig.Values[maxIdx]
+			if maxIdx < minIdx {
+				first, second = second, first
+			}
+			out.Signals[i].Values = append(out.Signals[i].Values, first, second)
+		}
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package simulator
+
+import (
+	"math"
+	"strings"
+
+	"nexfi-backend/pkg/schematic"
+)
+
+// ============================================
+// Source Waveforms
+// ============================================
+
+// Waveform kinds of time-varying sources
+const (
+	waveDC       = "dc"
+	waveSine     = "sine"
+	waveSquare   = "square"
+	wavePulse    = "pulse"
+	waveTriangle = "triangle"
+)
+
+// sourceWave is the value of a source over time. Pulse waves switch
+// between low and high; sine waves swing amplitude around low.
+type sourceWave struct {
+	kind      string
+	low       float64 // DC value, pulse low level or sine offset
+	high      float64 // pulse high level or sine amplitude
+	frequency float64
+	duty      float64
+	phase     float64 // radians
+}
+
+// dcWave is a constant value
+func dcWave(v float64) *sourceWave {
+	return &sourceWave{kind: waveDC, low: v}
+}
+
+// pwmWave switches between 0 and level at a duty cycle
+func pwmWave(level, duty, frequency float64) *sourceWave {
+	return &sourceWave{kind: wavePulse, high: level, duty: duty, frequency: frequency}
+}
+
+// waveFromProperties reads the waveform of a source component. level is
+// its nominal voltage (or current); defaultKind applies when the
+// component sets no "waveform".
+func waveFromProperties(comp *schematic.Component, level float64, defaultKind string) *sourceWave {
+	kind := strings.ToLower(stringProp(comp, "waveform", "wave"))
+	if kind == "" {
+		kind = defaultKind
+	}
+
+	switch kind {
+	case waveSine, "sin", "ac":
+		return &sourceWave{
+			kind:      waveSine,
+			low:       floatProp(comp, 0, "offset", "dc_offset"),
+			high:      floatProp(comp, level, "amplitude"),
+			frequency: floatProp(comp, 1000, "frequency"),
+			phase:     floatProp(comp, 0, "phase") * math.Pi / 180,
+		}
+	case waveSquare, wavePulse, "pwm", "clock":
+		duty := 0.5
+		if kind != waveSquare {
+			duty = normalizeDuty(floatProp(comp, 0.5, "duty_cycle", "duty"))
+		}
+		return &sourceWave{
+			kind:      wavePulse,
+			low:       floatProp(comp, 0, "low", "offset"),
+			high:      floatProp(comp, level, "amplitude", "high"),
+			frequency: floatProp(comp, 1000, "frequency"),
+			duty:      duty,
+		}
+	case waveTriangle:
+		return &sourceWave{
+			kind:      waveTriangle,
+			low:       floatProp(comp, 0, "low", "offset"),
+			high:      floatProp(comp, level, "amplitude", "high"),
+			frequency: floatProp(comp, 1000, "frequency"),
+		}
+	}
+	return dcWave(level)
+}
+
+// normalizeDuty accepts a duty cycle as a fraction, a percentage or an 8-bit PWM value
+func normalizeDuty(d float64) float64 {
+	switch {
+	case d > 100:
+		d /= 255
+	case d > 1:
+		d /= 100
+	}
+	return math.Min(math.Max(d, 0), 1)
+}
+
+// period returns the period of a periodic wave, 0 for DC
+func (w *sourceWave) period() float64 {
+	if w.kind == waveDC || w.frequency <= 0 {
+		return 0
+	}
+	return 1 / w.frequency
+}
+
+// at evaluates the wave at time t
+func (w *sourceWave) at(t float64) float64 {
+	period := w.period()
+	if period == 0 {
+		return w.low
+	}
+	phase := math.Mod(t, period) / period
+
+	switch w.kind {
+	case waveSine:
+		return w.low + w.high*math.Sin(2*math.Pi*w.frequency*t+w.phase)
+	case waveTriangle:
+		if phase < 0.5 {
+			return w.low + (w.high-w.low)*2*phase
+		}
+		return w.high - (w.high-w.low)*2*(phase-0.5)
+	default:
+		if phase < w.duty {
+			return w.high
+		}
+		return w.low
+	}
+}
@@ -0,0 +1,522 @@
+package sketch
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ============================================
+// Arduino Core Functions
+// ============================================
+
+// arity is the number of arguments a function takes
+type arity struct{ min, max int }
+
+// builtins are the functions of the Arduino core the machine provides
+var builtins = map[string]arity{
+	"pinMode": {2, 2}, "digitalWrite": {2, 2}, "digitalRead": {1, 1},
+	"analogRead": {1, 1}, "analogWrite": {2, 2},
+	"tone": {2, 3}, "noTone": {1, 1}, "shiftOut": {4, 4},
+	"delay": {1, 1}, "delayMicroseconds": {1, 1}, "millis": {0, 0}, "micros": {0, 0},
+	"map": {5, 5}, "constrain": {3, 3}, "min": {2, 2}, "max": {2, 2}, "abs": {1, 1},
+	"sq": {1, 1}, "sqrt": {1, 1}, "pow": {2, 2}, "sin": {1, 1}, "cos": {1, 1}, "tan": {1, 1},
+	"floor": {1, 1}, "ceil": {1, 1}, "round": {1, 1}, "fabs": {1, 1}, "fmod": {2, 2},
+	"log": {1, 1}, "log10": {1, 1}, "exp": {1, 1}, "atan2": {2, 2},
+	"random": {1, 2}, "randomSeed": {1, 1},
+	"bitRead": {2, 2}, "bit": {1, 1}, "lowByte": {1, 1}, "highByte": {1, 1},
+	"isDigit": {1, 1}, "isAlpha": {1, 1},
+	"F": {1, 1}, "String": {1, 2},
+}
+
+// serialMethods are the functions of Serial
+var serialMethods = map[string]arity{
+	"begin": {1, 2}, "end": {0, 0}, "print": {1, 2}, "println": {0, 2}, "write": {1, 1},
+	"available": {0, 0}, "read": {0, 0}, "peek": {0, 0}, "flush": {0, 0},
+	"availableForWrite": {0, 0}, "setTimeout": {1, 1},
+}
+
+// stringMethods are the functions of String values
+var stringMethods = map[string]arity{
+	"length": {0, 0}, "toInt": {0, 0}, "toFloat": {0, 0}, "charAt": {1, 1},
+	"substring": {1, 2}, "indexOf": {1, 1}, "equals": {1, 1}, "c_str": {0, 0},
+	"startsWith": {1, 1}, "endsWith": {1, 1},
+}
+
+// unsupportedCalls are core functions the board cannot emulate
+var unsupportedCalls = map[string]string{
+	"attachInterrupt": "interrupts are not supported; poll the pin in loop() instead",
+	"detachInterrupt": "interrupts are not supported",
+	"pulseIn":         "pulseIn is not supported",
+	"analogReference": "analogReference is not supported; readings use the board's supply as reference",
+}
+
+// resolve checks every call of the sketch against its functions and the core
+func (p *Program) resolve() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	for _, decl := range p.globals {
+		for _, v := range decl.vars {
+			p.resolveExpr(v.size)
+			p.resolveExpr(v.init)
+		}
+	}
+	for _, fn := range p.funcs {
+		p.resolveStmt(fn.body)
+	}
+	return nil
+}
+
+func (p *Program) resolveStmt(s stmt) {
+	switch s := s.(type) {
+	case *block:
+		for _, st := range s.stmts {
+			p.resolveStmt(st)
+		}
+	case *varDecl:
+		for _, v := range s.vars {
+			p.resolveExpr(v.size)
+			p.resolveExpr(v.init)
+		}
+	case *exprStmt:
+		p.resolveExpr(s.x)
+	case *ifStmt:
+		p.resolveExpr(s.cond)
+		p.resolveStmt(s.then)
+		p.resolveStmt(s.els)
+	case *whileStmt:
+		p.resolveExpr(s.cond)
+		p.resolveStmt(s.body)
+	case *doStmt:
+		p.resolveStmt(s.body)
+		p.resolveExpr(s.cond)
+	case *forStmt:
+		p.resolveStmt(s.init)
+		p.resolveExpr(s.cond)
+		p.resolveExpr(s.post)
+		p.resolveStmt(s.body)
+	case *switchStmt:
+		p.resolveExpr(s.tag)
+		for _, label := range s.labels {
+			p.resolveExpr(label.value)
+		}
+		for _, st := range s.body {
+			p.resolveStmt(st)
+		}
+	case *returnStmt:
+		p.resolveExpr(s.x)
+	}
+}
+
+func (p *Program) resolveExpr(e expr) {
+	switch e := e.(type) {
+	case *unary:
+		p.resolveExpr(e.x)
+	case *incdec:
+		p.resolveExpr(e.x)
+	case *binary:
+		p.resolveExpr(e.l)
+		p.resolveExpr(e.r)
+	case *assign:
+		p.resolveExpr(e.target)
+		p.resolveExpr(e.v)
+	case *ternary:
+		p.resolveExpr(e.cond)
+		p.resolveExpr(e.a)
+		p.resolveExpr(e.b)
+	case *index:
+		p.resolveExpr(e.arr)
+		p.resolveExpr(e.i)
+	case *conversion:
+		p.resolveExpr(e.x)
+	case *sizeOf:
+		p.resolveExpr(e.x)
+	case *initList:
+		for _, el := range e.elems {
+			p.resolveExpr(el)
+		}
+	case *call:
+		for _, arg := range e.args {
+			p.resolveExpr(arg)
+		}
+		p.resolveCall(e)
+	}
+}
+
+func (p *Program) resolveCall(e *call) {
+	if e.recv != nil {
+		p.resolveExpr(e.recv)
+		if r, ok := e.recv.(*ident); ok && isSerial(r.name) {
+			checkArity(serialMethods, "Serial."+e.name, e.name, len(e.args), e.line)
+			return
+		}
+		checkArity(stringMethods, "String."+e.name, e.name, len(e.args), e.line)
+		return
+	}
+	if fn, ok := p.funcs[e.name]; ok {
+		if len(e.args) != len(fn.params) {
+			panic(errorAt(e.line, "%s takes %d arguments but is given %d", e.name, len(fn.params), len(e.args)))
+		}
+		return
+	}
+	if msg, ok := unsupportedCalls[e.name]; ok {
+		panic(errorAt(e.line, "%s", msg))
+	}
+	checkArity(builtins, e.name, e.name, len(e.args), e.line)
+}
+
+func checkArity(table map[string]arity, display, name string, args, line int) {
+	a, ok := table[name]
+	if !ok {
+		panic(errorAt(line, "%s is not declared", display))
+	}
+	if args < a.min || args > a.max {
+		if a.min == a.max {
+			panic(errorAt(line, "%s takes %d arguments but is given %d", display, a.min, args))
+		}
+		panic(errorAt(line, "%s takes %d to %d arguments but is given %d", display, a.min, a.max, args))
+	}
+}
+
+func isSerial(name string) bool {
+	return name == "Serial" || name == "Serial1" || name == "SerialUSB"
+}
+
+// evalCall calls a function of the sketch or of the core
+func (m *Machine) evalCall(e *call) value {
+	if e.recv != nil {
+		if r, ok := e.recv.(*ident); ok && isSerial(r.name) {
+			return m.serialCall(e)
+		}
+		return m.stringCall(e)
+	}
+
+	args := make([]value, len(e.args))
+	for k, arg := range e.args {
+		args[k] = m.eval(arg)
+	}
+	if fn, ok := m.prog.funcs[e.name]; ok {
+		return m.invoke(fn, args, e.line)
+	}
+	return m.builtin(e.name, args, e.line)
+}
+
+// numbers checks that arguments are numbers
+func numbers(name string, args []value, line int) {
+	for _, arg := range args {
+		if !arg.isNumber() {
+			panic(errorAt(line, "%s needs numbers", name))
+		}
+	}
+}
+
+func (m *Machine) builtin(name string, args []value, line int) value {
+	if name != "String" && name != "F" {
+		numbers(name, args, line)
+	}
+	integer := func(k int) int64 { return args[k].integer() }
+	pin := func() int { return int(integer(0)) }
+
+	switch name {
+	// Digital and analog I/O
+	case "pinMode":
+		m.tick(digitalIOCost)
+		m.board.PinMode(pin(), int(integer(1)))
+	case "digitalWrite":
+		m.tick(digitalIOCost)
+		m.board.DigitalWrite(pin(), args[1].truthy())
+	case "digitalRead":
+		m.tick(digitalIOCost)
+		return boolValue(m.board.DigitalRead(pin()))
+	case "analogRead":
+		m.tick(analogReadCost)
+		return intValue(int64(m.board.AnalogRead(pin())))
+	case "analogWrite":
+		m.tick(analogWriteCost)
+		m.board.AnalogWrite(pin(), int(min(max(integer(1), 0), 255)))
+	case "tone":
+		m.tick(digitalIOCost)
+		m.board.Tone(pin(), args[1].number())
+		for k, tone := range m.tones {
+			if tone.pin == pin() {
+				m.tones = append(m.tones[:k], m.tones[k+1:]...)
+				break
+			}
+		}
+		if len(args) == 3 && integer(2) > 0 {
+			m.tones = append(m.tones, toneEnd{pin: pin(), at: m.clock + integer(2)*1000})
+		}
+	case "noTone":
+		m.tick(digitalIOCost)
+		m.board.Tone(pin(), 0)
+	case "shiftOut":
+		data, clock, value := int(integer(0)), int(integer(1)), integer(3)
+		for b := 0; b < 8; b++ {
+			bitIndex := 7 - b
+			if integer(2) == 0 {
+				bitIndex = b
+			}
+			m.tick(digitalIOCost)
+			m.board.DigitalWrite(data, value>>uint(bitIndex)&1 == 1)
+			m.tick(digitalIOCost)
+			m.board.DigitalWrite(clock, true)
+			m.tick(digitalIOCost)
+			m.board.DigitalWrite(clock, false)
+		}
+
+	// Time
+	case "delay":
+		m.wait(max(integer(0), 0) * 1000)
+	case "delayMicroseconds":
+		m.wait(max(integer(0), 0))
+	case "millis":
+		return intValue(m.clock / 1000)
+	case "micros":
+		return intValue(m.clock)
+
+	// Math
+	case "map":
+		x, inMin, inMax, outMin, outMax := integer(0), integer(1), integer(2), integer(3), integer(4)
+		if inMax == inMin {
+			panic(errorAt(line, "map() needs different fromLow and fromHigh"))
+		}
+		return intValue((x-inMin)*(outMax-outMin)/(inMax-inMin) + outMin)
+	case "constrain":
+		if args[0].number() < args[1].number() {
+			return args[1]
+		}
+		if args[0].number() > args[2].number() {
+			return args[2]
+		}
+		return args[0]
+	case "min":
+		if args[1].number() < args[0].number() {
+			return args[1]
+		}
+		return args[0]
+	case "max":
+		if args[1].number() > args[0].number() {
+			return args[1]
+		}
+		return args[0]
+	case "abs":
+		if args[0].k == kindFloat {
+			return floatValue(math.Abs(args[0].f))
+		}
+		if args[0].i < 0 {
+			return intValue(-args[0].i)
+		}
+		return args[0]
+	case "sq":
+		return m.arith("*", args[0], args[0], line)
+	case "round":
+		return intValue(int64(math.Round(args[0].number())))
+	case "random":
+		lo, hi := int64(0), integer(0)
+		if len(args) == 2 {
+			lo, hi = integer(0), integer(1)
+		}
+		if hi <= lo {
+			return intValue(lo)
+		}
+		return intValue(lo + m.rng.Int63n(hi-lo))
+	case "randomSeed":
+		m.rng.Seed(integer(0))
+	case "bitRead":
+		return intValue(integer(0) >> uint(integer(1)&63) & 1)
+	case "bit":
+		return intValue(1 << uint(integer(0)&63))
+	case "lowByte":
+		return intValue(integer(0) & 0xFF)
+	case "highByte":
+		return intValue(integer(0) >> 8 & 0xFF)
+	case "isDigit":
+		c := integer(0)
+		return boolValue(c >= '0' && c <= '9')
+	case "isAlpha":
+		c := integer(0)
+		return boolValue((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'))
+
+	// Text
+	case "F":
+		return stringValue(args[0].text())
+	case "String":
+		if len(args) == 2 && args[0].k == kindFloat {
+			return stringValue(formatFloat(args[0].f, int(args[1].integer())))
+		}
+		if len(args) == 2 && args[0].k == kindInt {
+			return stringValue(formatBase(args[0].i, int(args[1].integer())))
+		}
+		return stringValue(args[0].text())
+
+	default:
+		if f, ok := mathFuncs[name]; ok {
+			x := make([]float64, len(args))
+			for k, arg := range args {
+				x[k] = arg.number()
+			}
+			return floatValue(f(x))
+		}
+		panic(errorAt(line, "%s is not declared", name))
+	}
+	return value{}
+}
+
+// mathFuncs are the floating point functions of math.h
+var mathFuncs = map[string]func(x []float64) float64{
+	"sqrt":  func(x []float64) float64 { return math.Sqrt(x[0]) },
+	"pow":   func(x []float64) float64 { return math.Pow(x[0], x[1]) },
+	"sin":   func(x []float64) float64 { return math.Sin(x[0]) },
+	"cos":   func(x []float64) float64 { return math.Cos(x[0]) },
+	"tan":   func(x []float64) float64 { return math.Tan(x[0]) },
+	"floor": func(x []float64) float64 { return math.Floor(x[0]) },
+	"ceil":  func(x []float64) float64 { return math.Ceil(x[0]) },
+	"fabs":  func(x []float64) float64 { return math.Abs(x[0]) },
+	"fmod":  func(x []float64) float64 { return math.Mod(x[0], x[1]) },
+	"log":   func(x []float64) float64 { return math.Log(x[0]) },
+	"log10": func(x []float64) float64 { return math.Log10(x[0]) },
+	"exp":   func(x []float64) float64 { return math.Exp(x[0]) },
+	"atan2": func(x []float64) float64 { return math.Atan2(x[0], x[1]) },
+}
+
+// wait is delay(): the clock moves on while the sketch does nothing
+func (m *Machine) wait(us int64) {
+	m.steps++
+	if m.settling {
+		m.pause()
+	}
+	m.advance(m.clock + us)
+}
+
+func (m *Machine) serialCall(e *call) value {
+	args := make([]value, len(e.args))
+	for k, arg := range e.args {
+		args[k] = m.eval(arg)
+	}
+	m.tick(statementCost)
+
+	switch e.name {
+	case "begin":
+		m.serial.baud = args[0].integer()
+	case "print", "println":
+		text := ""
+		if len(args) > 0 {
+			text = formatPrint(args)
+		}
+		if e.name == "println" {
+			text += "\r\n"
+		}
+		m.print(text)
+		return intValue(int64(len(text)))
+	case "write":
+		if args[0].k == kindString {
+			m.print(args[0].s)
+			return intValue(int64(len(args[0].s)))
+		}
+		m.print(string(rune(args[0].integer() & 0xFF)))
+		return intValue(1)
+	case "available", "availableForWrite":
+		// Nothing is ever typed into the simulated serial monitor
+		if e.name == "availableForWrite" {
+			return intValue(63)
+		}
+		return intValue(0)
+	case "read", "peek":
+		return intValue(-1)
+	}
+	return value{}
+}
+
+// formatPrint formats the arguments of Serial.print: a number with a base
+// (DEC, HEX, OCT, BIN) or a float with a number of decimals
+func formatPrint(args []value) string {
+	v := args[0]
+	if len(args) == 1 || !args[1].isNumber() {
+		return v.text()
+	}
+	n := int(args[1].integer())
+	switch v.k {
+	case kindFloat:
+		return formatFloat(v.f, max(n, 0))
+	case kindInt:
+		if n == 2 || n == 8 || n == 10 || n == 16 {
+			return formatBase(v.i, n)
+		}
+	}
+	return v.text()
+}
+
+func (m *Machine) stringCall(e *call) value {
+	recv := m.eval(e.recv)
+	if recv.k != kindString {
+		panic(errorAt(e.line, "%s() can only be called on a String", e.name))
+	}
+	args := make([]value, len(e.args))
+	for k, arg := range e.args {
+		args[k] = m.eval(arg)
+	}
+	m.tick(statementCost)
+	s := recv.s
+
+	switch e.name {
+	case "length":
+		return intValue(int64(len(s)))
+	case "toInt":
+		return intValue(leadingInt(s))
+	case "toFloat":
+		f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return floatValue(f)
+	case "charAt":
+		k := args[0].integer()
+		if k < 0 || k >= int64(len(s)) {
+			return intValue(0)
+		}
+		return intValue(int64(s[k]))
+	case "substring":
+		from := int(min(max(args[0].integer(), 0), int64(len(s))))
+		to := len(s)
+		if len(args) == 2 {
+			to = int(min(max(args[1].integer(), 0), int64(len(s))))
+		}
+		if to < from {
+			from, to = to, from
+		}
+		return stringValue(s[from:to])
+	case "indexOf":
+		needle := args[0].text()
+		if args[0].k == kindInt {
+			needle = string(rune(args[0].i))
+		}
+		return intValue(int64(strings.Index(s, needle)))
+	case "equals":
+		return boolValue(s == args[0].text())
+	case "startsWith":
+		return boolValue(strings.HasPrefix(s, args[0].text()))
+	case "endsWith":
+		return boolValue(strings.HasSuffix(s, args[0].text()))
+	case "c_str":
+		return recv
+	}
+	panic(errorAt(e.line, "String.%s is not supported", e.name))
+}
+
+// leadingInt parses the integer a String starts with, as toInt does
+func leadingInt(s string) int64 {
+	s = strings.TrimSpace(s)
+	end := 0
+	if end < len(s) && (s[end] == '-' || s[end] == '+') {
+		end++
+	}
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	v, _ := strconv.ParseInt(s[:end], 10, 64)
+	return v
+}
@@ -0,0 +1,351 @@
+package sketch
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ============================================
+// Lexer
+// ============================================
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokFloat
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+	i    int64
+	f    float64
+}
+
+// punctuators, longest first
+var punctuators = []string{
+	"<<=", ">>=",
+	"++", "--", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=",
+	"<<", ">>", "<=", ">=", "==", "!=", "&&", "||", "->", "::",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "&", "|", "^", "~",
+	"?", ":", ";", ",", ".", "(", ")", "[", "]", "{", "}",
+}
+
+const maxMacroDepth = 16
+
+// lexer turns a sketch into tokens, dropping comments and applying the
+// object-like macros of #define
+type lexer struct {
+	src    string
+	pos    int
+	line   int
+	macros map[string][]token
+}
+
+// tokenize lexes a whole sketch
+func tokenize(src string) ([]token, error) {
+	lx := &lexer{src: src, line: 1, macros: map[string][]token{}}
+	var raw []token
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == tokEOF {
+			raw = append(raw, tok)
+			break
+		}
+		raw = append(raw, tok)
+	}
+	return lx.expand(raw, 0)
+}
+
+func (lx *lexer) errorf(format string, args ...interface{}) error {
+	return errorAt(lx.line, format, args...)
+}
+
+// next returns the next token, handling directives on the way
+func (lx *lexer) next() (token, error) {
+	atLineStart := lx.pos == 0 || lx.src[lx.pos-1] == '\n'
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\n':
+			lx.line++
+			lx.pos++
+			atLineStart = true
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			lx.pos++
+		case c == '\\' && lx.peek(1) == '\n':
+			lx.pos += 2
+			lx.line++
+		case c == '/' && lx.peek(1) == '/':
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.pos++
+			}
+		case c == '/' && lx.peek(1) == '*':
+			end := strings.Index(lx.src[lx.pos+2:], "*/")
+			if end < 0 {
+				return token{}, lx.errorf("unterminated comment")
+			}
+			lx.line += strings.Count(lx.src[lx.pos:lx.pos+2+end], "\n")
+			lx.pos += end + 4
+		case c == '#' && atLineStart:
+			if err := lx.directive(); err != nil {
+				return token{}, err
+			}
+		default:
+			return lx.token()
+		}
+	}
+	return token{kind: tokEOF, line: lx.line}, nil
+}
+
+func (lx *lexer) peek(offset int) byte {
+	if lx.pos+offset < len(lx.src) {
+		return lx.src[lx.pos+offset]
+	}
+	return 0
+}
+
+// directive handles a preprocessor line. #define is applied, #include and
+// conditionals are skipped: sketches are compiled as one file.
+func (lx *lexer) directive() error {
+	start := lx.pos
+	for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+		if lx.src[lx.pos] == '\\' && lx.peek(1) == '\n' {
+			lx.pos++
+		}
+		lx.pos++
+	}
+	text := lx.src[start+1 : lx.pos]
+	line := lx.line
+	lx.line += strings.Count(text, "\n")
+
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\\\n", " "))
+	fields := strings.Fields(text)
+	if len(fields) == 0 || fields[0] != "define" {
+		return nil
+	}
+	if len(fields) < 2 {
+		return errorAt(line, "#define needs a name")
+	}
+	name := fields[1]
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		return errorAt(line, "macros with parameters such as %s are not supported; use a function", name[:i])
+	}
+
+	rest := strings.TrimSpace(strings.TrimPrefix(text, "define"))
+	body := strings.TrimSpace(rest[len(name):])
+	sub := &lexer{src: body, line: line, macros: map[string][]token{}}
+	var tokens []token
+	for {
+		tok, err := sub.next()
+		if err != nil {
+			return err
+		}
+		if tok.kind == tokEOF {
+			break
+		}
+		tok.line = line
+		tokens = append(tokens, tok)
+	}
+	lx.macros[name] = tokens
+	return nil
+}
+
+// expand replaces macro names by their bodies
+func (lx *lexer) expand(tokens []token, depth int) ([]token, error) {
+	out := make([]token, 0, len(tokens))
+	for _, tok := range tokens {
+		body, ok := lx.macros[tok.text]
+		if tok.kind != tokIdent || !ok {
+			out = append(out, tok)
+			continue
+		}
+		if depth >= maxMacroDepth {
+			return nil, errorAt(tok.line, "macro %s expands into itself", tok.text)
+		}
+		expanded, err := lx.expand(body, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range expanded {
+			e.line = tok.line
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// token lexes an identifier, number, literal or punctuator
+func (lx *lexer) token() (token, error) {
+	c := lx.src[lx.pos]
+	start := lx.pos
+
+	switch {
+	case isIdentStart(c):
+		for lx.pos < len(lx.src) && (isIdentStart(lx.src[lx.pos]) || isDigit(lx.src[lx.pos])) {
+			lx.pos++
+		}
+		text := lx.src[start:lx.pos]
+		if v, ok := binaryConstant(text); ok {
+			// B00101101, the binary constants of the Arduino core
+			return token{kind: tokInt, text: text, line: lx.line, i: v}, nil
+		}
+		return token{kind: tokIdent, text: text, line: lx.line}, nil
+	case isDigit(c) || (c == '.' && isDigit(lx.peek(1))):
+		return lx.number()
+	case c == '"':
+		s, err := lx.quoted('"')
+		return token{kind: tokString, text: s, line: lx.line}, err
+	case c == '\'':
+		s, err := lx.quoted('\'')
+		if err == nil && len(s) != 1 {
+			err = lx.errorf("a character literal holds one character")
+		}
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokInt, text: "'" + s + "'", line: lx.line, i: int64(s[0])}, nil
+	}
+
+	for _, p := range punctuators {
+		if strings.HasPrefix(lx.src[lx.pos:], p) {
+			lx.pos += len(p)
+			return token{kind: tokPunct, text: p, line: lx.line}, nil
+		}
+	}
+	return token{}, lx.errorf("unexpected character %q", c)
+}
+
+// binaryConstant reads the Arduino B0101 constants
+func binaryConstant(text string) (int64, bool) {
+	if len(text) < 2 || len(text) > 9 || text[0] != 'B' {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(text[1:], 2, 64)
+	return v, err == nil
+}
+
+// number lexes an integer or floating point literal with its suffixes
+func (lx *lexer) number() (token, error) {
+	start := lx.pos
+	isFloat := false
+	base := 10
+
+	if lx.src[lx.pos] == '0' && (lx.peek(1) == 'x' || lx.peek(1) == 'X') {
+		base = 16
+		lx.pos += 2
+		for lx.pos < len(lx.src) && strings.IndexByte("0123456789abcdefABCDEF", lx.src[lx.pos]) >= 0 {
+			lx.pos++
+		}
+	} else if lx.src[lx.pos] == '0' && (lx.peek(1) == 'b' || lx.peek(1) == 'B') {
+		base = 2
+		lx.pos += 2
+		for lx.pos < len(lx.src) && (lx.src[lx.pos] == '0' || lx.src[lx.pos] == '1') {
+			lx.pos++
+		}
+	} else {
+		for lx.pos < len(lx.src) {
+			c := lx.src[lx.pos]
+			switch {
+			case isDigit(c):
+			case c == '.':
+				isFloat = true
+			case (c == 'e' || c == 'E') && (isDigit(lx.peek(1)) || ((lx.peek(1) == '-' || lx.peek(1) == '+') && isDigit(lx.peek(2)))):
+				isFloat = true
+				lx.pos++
+			default:
+				goto suffix
+			}
+			lx.pos++
+		}
+	}
+
+suffix:
+	digits := lx.src[start:lx.pos]
+	for lx.pos < len(lx.src) && strings.IndexByte("uUlLfF", lx.src[lx.pos]) >= 0 {
+		if c := lx.src[lx.pos]; (c == 'f' || c == 'F') && base == 10 {
+			isFloat = true
+		}
+		lx.pos++
+	}
+	if lx.pos < len(lx.src) && (isIdentStart(lx.src[lx.pos]) || isDigit(lx.src[lx.pos])) {
+		return token{}, lx.errorf("invalid number %s", lx.src[start:lx.pos+1])
+	}
+
+	if isFloat {
+		f, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return token{}, lx.errorf("invalid number %s", digits)
+		}
+		return token{kind: tokFloat, text: digits, line: lx.line, f: f}, nil
+	}
+
+	text := digits
+	switch {
+	case base == 16 || base == 2:
+		text = digits[2:]
+	case len(digits) > 1 && digits[0] == '0':
+		base = 8
+	}
+	v, err := strconv.ParseUint(text, base, 64)
+	if err != nil {
+		return token{}, lx.errorf("invalid number %s", digits)
+	}
+	return token{kind: tokInt, text: digits, line: lx.line, i: int64(v)}, nil
+}
+
+// quoted lexes a string or character literal, resolving escapes
+func (lx *lexer) quoted(quote byte) (string, error) {
+	lx.pos++
+	var sb strings.Builder
+	for {
+		if lx.pos >= len(lx.src) || lx.src[lx.pos] == '\n' {
+			return "", lx.errorf("unterminated literal")
+		}
+		c := lx.src[lx.pos]
+		lx.pos++
+		if c == quote {
+			return sb.String(), nil
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		if lx.pos >= len(lx.src) {
+			return "", lx.errorf("unterminated literal")
+		}
+		e := lx.src[lx.pos]
+		lx.pos++
+		switch e {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case '0':
+			sb.WriteByte(0)
+		case '\\', '\'', '"':
+			sb.WriteByte(e)
+		default:
+			return "", lx.errorf("unknown escape \\%c", e)
+		}
+	}
+}
@@ -0,0 +1,862 @@
+package sketch
+
+import (
+	"iter"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
+)
+
+// ============================================
+// Machine
+// ============================================
+
+// Time each statement takes, in microseconds. A 16 MHz AVR runs a line of
+// C in about a microsecond; the I/O functions take what they do on an Uno.
+const (
+	statementCost    = 1
+	callCost         = 1
+	digitalIOCost    = 5
+	analogReadCost   = 112
+	analogWriteCost  = 8
+	serialCharCost   = 1
+	maxCallDepth     = 64
+	maxSerialLines   = 500
+	maxSerialLineLen = 1000
+	maxStringLen     = 4096 // an Uno has 2 KB of RAM
+	defaultSeed      = 1
+)
+
+// Machine runs a sketch: global initializers, setup() and then loop()
+// forever, on a clock that starts at zero. It runs as a coroutine of its
+// caller; RunUntil lets it run up to a time and Close ends it.
+type Machine struct {
+	prog  *Program
+	board Board
+	opts  Options
+
+	globals map[string]*variable
+	frames  []*frame
+	ret     value
+
+	clock    int64 // µs
+	target   int64
+	steps    int64
+	line     int
+	settling bool
+
+	serial serialPort
+	tones  []toneEnd
+	rng    *rand.Rand
+
+	yield   func(struct{}) bool
+	next    func() (struct{}, bool)
+	stop    func()
+	started bool
+	done    bool
+	err     *Error
+}
+
+type variable struct {
+	t *ctype
+	v value
+}
+
+type frame struct {
+	fn     *function
+	scopes []map[string]*variable
+}
+
+// toneEnd silences a tone played with a duration
+type toneEnd struct {
+	pin int
+	at  int64
+}
+
+type ctrl int
+
+const (
+	ctrlNone ctrl = iota
+	ctrlBreak
+	ctrlContinue
+	ctrlReturn
+)
+
+// closed unwinds the coroutine of a closed machine
+type closed struct{}
+
+// NewMachine prepares a run of a program on a board
+func NewMachine(prog *Program, board Board, opts Options) *Machine {
+	if opts.IntBits == 0 {
+		opts.IntBits = 16
+	}
+	return &Machine{
+		prog:    prog,
+		board:   board,
+		opts:    opts,
+		globals: map[string]*variable{},
+		rng:     rand.New(rand.NewSource(defaultSeed)),
+	}
+}
+
+// RunUntil runs the sketch until its clock passes t seconds, or it fails
+func (m *Machine) RunUntil(t float64) {
+	m.target = int64(math.Round(t * 1e6))
+	m.resume()
+}
+
+// Settle runs setup() and the first loop() until it returns or waits in
+// delay(), which is the state a DC analysis sees, and ends the run
+func (m *Machine) Settle() {
+	m.settling = true
+	m.target = math.MaxInt64
+	m.resume()
+	m.Close()
+}
+
+// Close ends the run and frees its coroutine
+func (m *Machine) Close() {
+	if m.stop != nil {
+		m.stop()
+	}
+	m.done = true
+}
+
+// Time returns the clock of the sketch in seconds
+func (m *Machine) Time() float64 {
+	return float64(m.clock) / 1e6
+}
+
+// Err returns the error the sketch stopped with, if any
+func (m *Machine) Err() *Error {
+	return m.err
+}
+
+// Serial returns the lines printed on Serial, with a pending partial line
+func (m *Machine) Serial() []SerialLine {
+	lines := append([]SerialLine{}, m.serial.lines...)
+	if m.serial.line.Len() > 0 {
+		lines = append(lines, SerialLine{Time: float64(m.serial.start) / 1e6, Text: m.serial.line.String()})
+	}
+	return lines
+}
+
+func (m *Machine) resume() {
+	if m.done {
+		return
+	}
+	if !m.started {
+		m.started = true
+		m.next, m.stop = iter.Pull(m.coroutine)
+	}
+	if _, ok := m.next(); !ok {
+		m.done = true
+	}
+}
+
+// coroutine runs the sketch, pausing whenever its clock passes the target
+func (m *Machine) coroutine(yield func(struct{}) bool) {
+	m.yield = yield
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case closed:
+			case *Error:
+				m.err = e
+			case runtime.Error:
+				m.err = errorAt(m.line, "the sketch crashed: %v", e)
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	m.frames = []*frame{{}}
+	for _, decl := range m.prog.globals {
+		m.declare(decl, m.globals)
+	}
+	m.frames = nil
+
+	m.invoke(m.prog.funcs["setup"], nil, 0)
+	for {
+		m.invoke(m.prog.funcs["loop"], nil, 0)
+		if m.settling {
+			m.pause()
+		}
+	}
+}
+
+// pause hands control back until the machine is resumed
+func (m *Machine) pause() {
+	if !m.yield(struct{}{}) {
+		panic(closed{})
+	}
+}
+
+// tick accounts for the time of a statement
+func (m *Machine) tick(cost int64) {
+	m.steps++
+	if m.opts.MaxSteps > 0 && m.steps > m.opts.MaxSteps {
+		panic(errorAt(m.line, "the sketch was stopped after %d statements; add a delay() to loop() or simulate a shorter time", m.opts.MaxSteps))
+	}
+	m.advance(m.clock + cost)
+}
+
+// advance moves the clock to t, ending tones on the way and pausing each
+// time it passes the target
+func (m *Machine) advance(t int64) {
+	for {
+		at, k := t, -1
+		for i, tone := range m.tones {
+			if tone.at <= at {
+				at, k = tone.at, i
+			}
+		}
+		if at > m.clock {
+			m.clock = at
+		}
+		for m.clock > m.target {
+			m.pause()
+		}
+		if k < 0 {
+			return
+		}
+		m.board.Tone(m.tones[k].pin, 0)
+		m.tones = append(m.tones[:k], m.tones[k+1:]...)
+	}
+}
+
+// ---------- Variables ----------
+
+func (m *Machine) frame() *frame {
+	return m.frames[len(m.frames)-1]
+}
+
+func (m *Machine) lookup(name string) *variable {
+	if len(m.frames) > 0 {
+		scopes := m.frame().scopes
+		for k := len(scopes) - 1; k >= 0; k-- {
+			if v, ok := scopes[k][name]; ok {
+				return v
+			}
+		}
+	}
+	return m.globals[name]
+}
+
+// declare creates the variables of a declaration in a scope
+func (m *Machine) declare(decl *varDecl, scope map[string]*variable) {
+	for _, dv := range decl.vars {
+		m.line = dv.line
+		if _, ok := scope[dv.name]; ok {
+			panic(errorAt(dv.line, "%s is already declared", dv.name))
+		}
+		scope[dv.name] = m.newVariable(decl.t, dv)
+	}
+}
+
+func (m *Machine) newVariable(t *ctype, dv declVar) *variable {
+	if !dv.array {
+		v := &variable{t: t, v: zeroValue(t)}
+		if dv.init != nil {
+			init := dv.init
+			if list, ok := init.(*initList); ok {
+				if len(list.elems) != 1 {
+					panic(errorAt(dv.line, "%s takes one value", dv.name))
+				}
+				init = list.elems[0]
+			}
+			v.v = m.convert(m.eval(init), t, dv.line)
+		}
+		return v
+	}
+
+	var elems []expr
+	switch init := dv.init.(type) {
+	case nil:
+	case *initList:
+		elems = init.elems
+	case *literal:
+		if init.v.k == kindString && t.kind == kindInt && t.bits == 8 {
+			// char name[] = "text" holds a String
+			return &variable{t: typeString, v: init.v}
+		}
+		panic(errorAt(dv.line, "array %s needs a {...} initializer", dv.name))
+	default:
+		panic(errorAt(dv.line, "array %s needs a {...} initializer", dv.name))
+	}
+
+	size := int64(len(elems))
+	if dv.size != nil {
+		size = m.eval(dv.size).integer()
+	}
+	if size <= 0 || size > 4096 {
+		panic(errorAt(dv.line, "array %s has an invalid size %d", dv.name, size))
+	}
+	if int64(len(elems)) > size {
+		panic(errorAt(dv.line, "array %s has more initializers than elements", dv.name))
+	}
+	arr := &array{t: t, elems: make([]value, size)}
+	for k := range arr.elems {
+		arr.elems[k] = zeroValue(t)
+		if k < len(elems) {
+			arr.elems[k] = m.convert(m.eval(elems[k]), t, dv.line)
+		}
+	}
+	return &variable{t: t, v: value{k: kindArray, arr: arr}}
+}
+
+// convert converts a value to a declared type
+func (m *Machine) convert(v value, t *ctype, line int) value {
+	switch t.kind {
+	case kindVoid:
+		return value{}
+	case kindString:
+		if v.k == kindArray {
+			panic(errorAt(line, "an array cannot be converted to a String"))
+		}
+		return stringValue(v.text())
+	}
+	if !v.isNumber() {
+		panic(errorAt(line, "a %s cannot be converted to %s", kindName(v.k), t.name))
+	}
+	if t.kind == kindFloat {
+		return floatValue(v.number())
+	}
+	return intValue(wrap(v.integer(), t, m.opts.IntBits))
+}
+
+func kindName(k kind) string {
+	switch k {
+	case kindString:
+		return "String"
+	case kindArray:
+		return "array"
+	case kindFloat:
+		return "float"
+	}
+	return "int"
+}
+
+// ---------- Statements ----------
+
+// invoke calls a function of the sketch
+func (m *Machine) invoke(fn *function, args []value, line int) value {
+	if len(m.frames) >= maxCallDepth {
+		panic(errorAt(line, "too many nested calls of %s: the board ran out of stack", fn.name))
+	}
+	m.tick(callCost)
+	scope := map[string]*variable{}
+	for k, prm := range fn.params {
+		if prm.array {
+			if args[k].k != kindArray {
+				panic(errorAt(line, "%s expects an array as %s", fn.name, prm.name))
+			}
+			scope[prm.name] = &variable{t: prm.t, v: args[k]}
+			continue
+		}
+		scope[prm.name] = &variable{t: prm.t, v: m.convert(args[k], prm.t, line)}
+	}
+
+	m.frames = append(m.frames, &frame{fn: fn, scopes: []map[string]*variable{scope}})
+	defer func() { m.frames = m.frames[:len(m.frames)-1] }()
+
+	m.ret = value{}
+	if m.execBlock(fn.body.stmts) == ctrlReturn {
+		ret := m.ret
+		m.ret = value{}
+		if fn.ret.kind == kindVoid {
+			return value{}
+		}
+		return m.convert(ret, fn.ret, line)
+	}
+	return zeroValue(fn.ret)
+}
+
+// execBlock runs statements in a new scope
+func (m *Machine) execBlock(stmts []stmt) ctrl {
+	f := m.frame()
+	f.scopes = append(f.scopes, nil)
+	defer func() { f.scopes = f.scopes[:len(f.scopes)-1] }()
+
+	for _, s := range stmts {
+		if c := m.exec(s); c != ctrlNone {
+			return c
+		}
+	}
+	return ctrlNone
+}
+
+func (m *Machine) exec(s stmt) ctrl {
+	switch s := s.(type) {
+	case *block:
+		return m.execBlock(s.stmts)
+	case *varDecl:
+		f := m.frame()
+		scope := f.scopes[len(f.scopes)-1]
+		if scope == nil {
+			scope = map[string]*variable{}
+			f.scopes[len(f.scopes)-1] = scope
+		}
+		m.tick(statementCost)
+		m.declare(s, scope)
+	case *exprStmt:
+		m.line = s.line
+		m.tick(statementCost)
+		m.eval(s.x)
+	case *ifStmt:
+		m.line = s.line
+		m.tick(statementCost)
+		if m.eval(s.cond).truthy() {
+			return m.exec(s.then)
+		} else if s.els != nil {
+			return m.exec(s.els)
+		}
+	case *whileStmt:
+		for {
+			m.line = s.line
+			m.tick(statementCost)
+			if !m.eval(s.cond).truthy() {
+				return ctrlNone
+			}
+			switch m.exec(s.body) {
+			case ctrlBreak:
+				return ctrlNone
+			case ctrlReturn:
+				return ctrlReturn
+			}
+		}
+	case *doStmt:
+		for {
+			switch m.exec(s.body) {
+			case ctrlBreak:
+				return ctrlNone
+			case ctrlReturn:
+				return ctrlReturn
+			}
+			m.line = s.line
+			m.tick(statementCost)
+			if !m.eval(s.cond).truthy() {
+				return ctrlNone
+			}
+		}
+	case *forStmt:
+		return m.execFor(s)
+	case *switchStmt:
+		return m.execSwitch(s)
+	case *breakStmt:
+		return ctrlBreak
+	case *continueStmt:
+		return ctrlContinue
+	case *returnStmt:
+		m.line = s.line
+		m.tick(statementCost)
+		if s.x != nil {
+			m.ret = m.eval(s.x)
+		}
+		return ctrlReturn
+	}
+	return ctrlNone
+}
+
+func (m *Machine) execFor(s *forStmt) ctrl {
+	f := m.frame()
+	f.scopes = append(f.scopes, map[string]*variable{})
+	defer func() { f.scopes = f.scopes[:len(f.scopes)-1] }()
+
+	m.line = s.line
+	if s.init != nil {
+		m.exec(s.init)
+	}
+	for {
+		m.line = s.line
+		m.tick(statementCost)
+		if s.cond != nil && !m.eval(s.cond).truthy() {
+			return ctrlNone
+		}
+		switch m.exec(s.body) {
+		case ctrlBreak:
+			return ctrlNone
+		case ctrlReturn:
+			return ctrlReturn
+		}
+		if s.post != nil {
+			m.line = s.line
+			m.eval(s.post)
+		}
+	}
+}
+
+func (m *Machine) execSwitch(s *switchStmt) ctrl {
+	m.line = s.line
+	m.tick(statementCost)
+	tag := m.eval(s.tag)
+	start := -1
+	for _, label := range s.labels {
+		if label.value == nil {
+			if start < 0 {
+				start = label.at
+			}
+			continue
+		}
+		if equal(tag, m.eval(label.value)) {
+			start = label.at
+			break
+		}
+	}
+	if start < 0 {
+		return ctrlNone
+	}
+
+	f := m.frame()
+	f.scopes = append(f.scopes, nil)
+	defer func() { f.scopes = f.scopes[:len(f.scopes)-1] }()
+	for _, st := range s.body[start:] {
+		switch c := m.exec(st); c {
+		case ctrlBreak:
+			return ctrlNone
+		case ctrlNone:
+		default:
+			return c
+		}
+	}
+	return ctrlNone
+}
+
+// ---------- Expressions ----------
+
+func (m *Machine) eval(e expr) value {
+	switch e := e.(type) {
+	case *literal:
+		return e.v
+	case *ident:
+		return m.identValue(e)
+	case *unary:
+		return m.evalUnary(e)
+	case *incdec:
+		old := m.eval(e.x)
+		if !old.isNumber() {
+			panic(errorAt(e.line, "%s needs a number", e.op))
+		}
+		delta := intValue(1)
+		op := "+"
+		if e.op == "--" {
+			op = "-"
+		}
+		updated := m.store(e.x, m.arith(op, old, delta, e.line), e.line)
+		if e.prefix {
+			return updated
+		}
+		return old
+	case *binary:
+		return m.evalBinary(e)
+	case *assign:
+		v := m.eval(e.v)
+		if e.op != "=" {
+			v = m.arith(strings.TrimSuffix(e.op, "="), m.eval(e.target), v, e.line)
+		}
+		return m.store(e.target, v, e.line)
+	case *ternary:
+		if m.eval(e.cond).truthy() {
+			return m.eval(e.a)
+		}
+		return m.eval(e.b)
+	case *call:
+		return m.evalCall(e)
+	case *index:
+		target, k := m.element(e)
+		if target.k == kindString {
+			return intValue(int64(target.s[k]))
+		}
+		return target.arr.elems[k]
+	case *conversion:
+		return m.convert(m.eval(e.x), e.t, m.line)
+	case *sizeOf:
+		return intValue(m.sizeOf(e))
+	case *initList:
+		panic(errorAt(e.line, "{...} can only initialize a declaration"))
+	}
+	panic(errorAt(m.line, "unsupported expression"))
+}
+
+// constants of the Arduino core; board pins are added by identValue
+var constants = map[string]value{
+	"HIGH": intValue(1), "LOW": intValue(0),
+	"INPUT": intValue(ModeInput), "OUTPUT": intValue(ModeOutput), "INPUT_PULLUP": intValue(ModeInputPullup),
+	"true": intValue(1), "false": intValue(0), "NULL": intValue(0),
+	"DEC": intValue(10), "HEX": intValue(16), "OCT": intValue(8), "BIN": intValue(2),
+	"LSBFIRST": intValue(0), "MSBFIRST": intValue(1),
+	"PI": floatValue(math.Pi), "HALF_PI": floatValue(math.Pi / 2), "TWO_PI": floatValue(2 * math.Pi),
+	"DEG_TO_RAD": floatValue(math.Pi / 180), "RAD_TO_DEG": floatValue(180 / math.Pi),
+	"Serial": intValue(1),
+}
+
+func (m *Machine) identValue(e *ident) value {
+	if v := m.lookup(e.name); v != nil {
+		return v.v
+	}
+	if c, ok := constants[e.name]; ok {
+		return c
+	}
+	if e.name == "LED_BUILTIN" {
+		return intValue(int64(m.opts.LEDBuiltin))
+	}
+	if len(e.name) == 2 && e.name[0] == 'A' && e.name[1] >= '0' && e.name[1] <= '9' {
+		if k := int(e.name[1] - '0'); k < m.opts.AnalogPins {
+			return intValue(int64(m.opts.AnalogBase + k))
+		}
+		panic(errorAt(e.line, "this board has no pin %s", e.name))
+	}
+	panic(errorAt(e.line, "%s is not declared", e.name))
+}
+
+// element resolves an element of an array, or a character of a String
+func (m *Machine) element(e *index) (value, int) {
+	target := m.eval(e.arr)
+	k := m.eval(e.i).integer()
+	switch target.k {
+	case kindArray:
+		if k < 0 || k >= int64(len(target.arr.elems)) {
+			panic(errorAt(e.line, "index %d is outside an array of %d elements", k, len(target.arr.elems)))
+		}
+		return target, int(k)
+	case kindString:
+		if k < 0 || k >= int64(len(target.s)) {
+			panic(errorAt(e.line, "index %d is outside a String of %d characters", k, len(target.s)))
+		}
+		return target, int(k)
+	}
+	panic(errorAt(e.line, "only arrays and Strings can be indexed"))
+}
+
+// store assigns to a variable or an array element, converting to its type
+func (m *Machine) store(target expr, v value, line int) value {
+	switch t := target.(type) {
+	case *ident:
+		variable := m.lookup(t.name)
+		if variable == nil {
+			if _, ok := constants[t.name]; ok {
+				panic(errorAt(line, "%s is a constant", t.name))
+			}
+			panic(errorAt(line, "%s is not declared", t.name))
+		}
+		if variable.v.k == kindArray {
+			panic(errorAt(line, "array %s cannot be assigned as a whole", t.name))
+		}
+		variable.v = m.convert(v, variable.t, line)
+		return variable.v
+	case *index:
+		target, k := m.element(t)
+		if target.k == kindString {
+			panic(errorAt(line, "characters of a String cannot be assigned"))
+		}
+		target.arr.elems[k] = m.convert(v, target.arr.t, line)
+		return target.arr.elems[k]
+	}
+	panic(errorAt(line, "only a variable or an array element can be assigned"))
+}
+
+func (m *Machine) sizeOf(e *sizeOf) int64 {
+	if e.t != nil {
+		return sizeOfType(e.t, m.opts.IntBits)
+	}
+	switch x := e.x.(type) {
+	case *ident:
+		if v := m.lookup(x.name); v != nil {
+			if v.v.k == kindArray {
+				return int64(len(v.v.arr.elems)) * sizeOfType(v.t, m.opts.IntBits)
+			}
+			if v.t.kind == kindString {
+				return int64(len(v.v.s) + 1)
+			}
+			return sizeOfType(v.t, m.opts.IntBits)
+		}
+	case *index:
+		if target, _ := m.element(x); target.k == kindArray {
+			return sizeOfType(target.arr.t, m.opts.IntBits)
+		}
+		return 1
+	}
+	v := m.eval(e.x)
+	if v.k == kindFloat {
+		return 4
+	}
+	return sizeOfType(typeInt, m.opts.IntBits)
+}
+
+func (m *Machine) evalUnary(e *unary) value {
+	x := m.eval(e.x)
+	switch e.op {
+	case "!":
+		return boolValue(!x.truthy())
+	}
+	if !x.isNumber() {
+		panic(errorAt(e.line, "%s needs a number", e.op))
+	}
+	switch e.op {
+	case "-":
+		if x.k == kindFloat {
+			return floatValue(-x.f)
+		}
+		return intValue(-x.i)
+	case "~":
+		return intValue(^x.integer())
+	}
+	return x
+}
+
+func (m *Machine) evalBinary(e *binary) value {
+	switch e.op {
+	case "&&":
+		return boolValue(m.eval(e.l).truthy() && m.eval(e.r).truthy())
+	case "||":
+		return boolValue(m.eval(e.l).truthy() || m.eval(e.r).truthy())
+	case ",":
+		m.eval(e.l)
+		return m.eval(e.r)
+	}
+	return m.arith(e.op, m.eval(e.l), m.eval(e.r), e.line)
+}
+
+func equal(a, b value) bool {
+	if a.k == kindString || b.k == kindString {
+		return a.text() == b.text()
+	}
+	if a.k == kindFloat || b.k == kindFloat {
+		return a.number() == b.number()
+	}
+	return a.i == b.i
+}
+
+// arith applies a binary operator. A String on either side of + joins text.
+func (m *Machine) arith(op string, a, b value, line int) value {
+	if a.k == kindArray || b.k == kindArray {
+		panic(errorAt(line, "%s cannot be applied to an array", op))
+	}
+	if a.k == kindString || b.k == kindString {
+		switch op {
+		case "+":
+			if len(a.text())+len(b.text()) > maxStringLen {
+				panic(errorAt(line, "a String cannot be longer than %d characters", maxStringLen))
+			}
+			return stringValue(a.text() + b.text())
+		case "==":
+			return boolValue(a.text() == b.text())
+		case "!=":
+			return boolValue(a.text() != b.text())
+		case "<":
+			return boolValue(a.text() < b.text())
+		case ">":
+			return boolValue(a.text() > b.text())
+		case "<=":
+			return boolValue(a.text() <= b.text())
+		case ">=":
+			return boolValue(a.text() >= b.text())
+		}
+		panic(errorAt(line, "%s cannot be applied to a String", op))
+	}
+
+	switch op {
+	case "==":
+		return boolValue(equal(a, b))
+	case "!=":
+		return boolValue(!equal(a, b))
+	case "<":
+		return boolValue(a.number() < b.number())
+	case ">":
+		return boolValue(a.number() > b.number())
+	case "<=":
+		return boolValue(a.number() <= b.number())
+	case ">=":
+		return boolValue(a.number() >= b.number())
+	}
+
+	if a.k == kindFloat || b.k == kindFloat {
+		x, y := a.number(), b.number()
+		switch op {
+		case "+":
+			return floatValue(x + y)
+		case "-":
+			return floatValue(x - y)
+		case "*":
+			return floatValue(x * y)
+		case "/":
+			return floatValue(x / y)
+		case "%":
+			panic(errorAt(line, "%% needs integers; use fmod for floats"))
+		}
+		panic(errorAt(line, "%s needs integers", op))
+	}
+
+	x, y := a.i, b.i
+	switch op {
+	case "+":
+		return intValue(x + y)
+	case "-":
+		return intValue(x - y)
+	case "*":
+		return intValue(x * y)
+	case "/", "%":
+		if y == 0 {
+			panic(errorAt(line, "division by zero"))
+		}
+		if op == "/" {
+			return intValue(x / y)
+		}
+		return intValue(x % y)
+	case "&":
+		return intValue(x & y)
+	case "|":
+		return intValue(x | y)
+	case "^":
+		return intValue(x ^ y)
+	case "<<":
+		if y < 0 || y > 63 {
+			return intValue(0)
+		}
+		return intValue(x << uint(y))
+	case ">>":
+		if y < 0 || y > 63 {
+			return intValue(0)
+		}
+		return intValue(x >> uint(y))
+	}
+	panic(errorAt(line, "unknown operator %s", op))
+}
+
+// ---------- Serial ----------
+
+// serialPort collects what the sketch prints, line by line
+type serialPort struct {
+	baud      int64
+	line      strings.Builder
+	start     int64 // clock when the current line began
+	lines     []SerialLine
+	truncated bool
+}
+
+func (m *Machine) print(s string) {
+	p := &m.serial
+	for k := 0; k < len(s); k++ {
+		c := s[k]
+		switch {
+		case c == '\n':
+			if len(p.lines) < maxSerialLines {
+				p.lines = append(p.lines, SerialLine{Time: float64(p.start) / 1e6, Text: p.line.String()})
+			} else {
+				p.truncated = true
+			}
+			p.line.Reset()
+		case c == '\r':
+		default:
+			if p.line.Len() == 0 {
+				p.start = m.clock
+			}
+			if p.line.Len() < maxSerialLineLen {
+				p.line.WriteByte(c)
+			}
+		}
+	}
+	m.tick(int64(len(s)) * serialCharCost)
+}
@@ -0,0 +1,808 @@
+package sketch
+
+// ============================================
+// Parser
+// ============================================
+
+// kind is the kind of a value
+type kind int
+
+const (
+	kindVoid kind = iota
+	kindInt
+	kindFloat
+	kindString
+)
+
+// ctype is a declared type. Integers wrap to their width; bits 0 is the
+// board's int and bits 1 a bool.
+type ctype struct {
+	name     string
+	kind     kind
+	bits     int
+	unsigned bool
+}
+
+var (
+	typeInt    = &ctype{name: "int", kind: kindInt}
+	typeLong   = &ctype{name: "long", kind: kindInt, bits: 64}
+	typeFloat  = &ctype{name: "float", kind: kindFloat}
+	typeString = &ctype{name: "String", kind: kindString}
+)
+
+// typeWords are the words a type is made of
+var typeWords = map[string]bool{
+	"void": true, "bool": true, "boolean": true, "char": true, "short": true,
+	"int": true, "long": true, "float": true, "double": true, "signed": true,
+	"unsigned": true, "byte": true, "word": true, "String": true, "size_t": true,
+	"int8_t": true, "uint8_t": true, "int16_t": true, "uint16_t": true,
+	"int32_t": true, "uint32_t": true, "int64_t": true, "uint64_t": true,
+}
+
+// qualifiers are accepted and ignored
+var qualifiers = map[string]bool{
+	"const": true, "static": true, "volatile": true, "extern": true,
+	"inline": true, "constexpr": true, "register": true, "PROGMEM": true,
+}
+
+// unsupported are C++ features beyond the sketch subset
+var unsupported = map[string]bool{
+	"struct": true, "class": true, "enum": true, "union": true, "template": true,
+	"namespace": true, "typedef": true, "using": true, "goto": true, "new": true,
+	"delete": true, "auto": true,
+}
+
+// Expressions
+type (
+	expr interface{}
+
+	literal struct{ v value }
+	ident   struct {
+		name string
+		line int
+	}
+	unary struct {
+		op   string
+		x    expr
+		line int
+	}
+	incdec struct {
+		op     string // "++" or "--"
+		prefix bool
+		x      expr
+		line   int
+	}
+	binary struct {
+		op   string
+		l, r expr
+		line int
+	}
+	assign struct {
+		op     string
+		target expr
+		v      expr
+		line   int
+	}
+	ternary struct{ cond, a, b expr }
+	call    struct {
+		recv expr // receiver of a method call, e.g. Serial
+		name string
+		args []expr
+		line int
+	}
+	index struct {
+		arr, i expr
+		line   int
+	}
+	conversion struct {
+		t *ctype
+		x expr
+	}
+	sizeOf struct {
+		t *ctype
+		x expr
+	}
+	initList struct {
+		elems []expr
+		line  int
+	}
+)
+
+// Statements
+type (
+	stmt interface{}
+
+	block   struct{ stmts []stmt }
+	declVar struct {
+		name  string
+		array bool
+		size  expr // nil when sized by the initializer
+		init  expr
+		line  int
+	}
+	varDecl struct {
+		t    *ctype
+		vars []declVar
+	}
+	exprStmt struct {
+		x    expr
+		line int
+	}
+	ifStmt struct {
+		cond      expr
+		then, els stmt
+		line      int
+	}
+	whileStmt struct {
+		cond expr
+		body stmt
+		line int
+	}
+	doStmt struct {
+		body stmt
+		cond expr
+		line int
+	}
+	forStmt struct {
+		init stmt
+		cond expr
+		post expr
+		body stmt
+		line int
+	}
+	switchStmt struct {
+		tag    expr
+		labels []caseLabel
+		body   []stmt
+		line   int
+	}
+	caseLabel struct {
+		value expr // nil for default
+		at    int  // index of the first statement after the label
+	}
+	breakStmt    struct{ line int }
+	continueStmt struct{ line int }
+	returnStmt   struct {
+		x    expr
+		line int
+	}
+)
+
+// param is a parameter of a function
+type param struct {
+	t     *ctype
+	name  string
+	array bool
+}
+
+// function is a function of the sketch
+type function struct {
+	name   string
+	ret    *ctype
+	params []param
+	body   *block
+	line   int
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	prog   *Program
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) is(text string) bool {
+	tok := p.peek()
+	return (tok.kind == tokPunct || tok.kind == tokIdent) && tok.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) token {
+	if !p.is(text) {
+		p.fail("expected %q but found %s", text, describe(p.peek()))
+	}
+	return p.advance()
+}
+
+func (p *parser) expectIdent() token {
+	tok := p.peek()
+	if tok.kind != tokIdent {
+		p.fail("expected a name but found %s", describe(tok))
+	}
+	return p.advance()
+}
+
+// fail aborts the parse with an error at the current token
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(errorAt(p.peek().line, format, args...))
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "the end of the sketch"
+	case tokString:
+		return "a string"
+	}
+	return "\"" + tok.text + "\""
+}
+
+func (p *parser) atType() bool {
+	tok := p.peek()
+	return tok.kind == tokIdent && (typeWords[tok.text] || qualifiers[tok.text])
+}
+
+// parseType reads the words of a type, then a pointer star if any
+func (p *parser) parseType() *ctype {
+	words := map[string]int{}
+	line := p.peek().line
+	for p.atType() {
+		words[p.advance().text]++
+	}
+	t := resolveType(words)
+	if t == nil {
+		panic(errorAt(line, "a type is missing"))
+	}
+	if p.accept("*") {
+		if words["char"] == 0 {
+			p.fail("pointers are not supported")
+		}
+		t = typeString
+	}
+	p.accept("&") // references behave as values here
+	return t
+}
+
+// resolveType turns type words into a type
+func resolveType(words map[string]int) *ctype {
+	unsigned := words["unsigned"] > 0
+	switch {
+	case words["void"] > 0:
+		return &ctype{name: "void", kind: kindVoid}
+	case words["float"] > 0 || words["double"] > 0:
+		return &ctype{name: "float", kind: kindFloat}
+	case words["String"] > 0:
+		return typeString
+	case words["bool"] > 0 || words["boolean"] > 0:
+		return &ctype{name: "bool", kind: kindInt, bits: 1, unsigned: true}
+	case words["char"] > 0:
+		return &ctype{name: "char", kind: kindInt, bits: 8, unsigned: unsigned}
+	case words["byte"] > 0 || words["uint8_t"] > 0:
+		return &ctype{name: "byte", kind: kindInt, bits: 8, unsigned: true}
+	case words["int8_t"] > 0:
+		return &ctype{name: "int8_t", kind: kindInt, bits: 8}
+	case words["short"] > 0 || words["int16_t"] > 0:
+		return &ctype{name: "short", kind: kindInt, bits: 16, unsigned: unsigned}
+	case words["word"] > 0 || words["uint16_t"] > 0:
+		return &ctype{name: "word", kind: kindInt, bits: 16, unsigned: true}
+	case words["long"] >= 2 || words["int64_t"] > 0:
+		return &ctype{name: "long long", kind: kindInt, bits: 64, unsigned: unsigned}
+	case words["uint64_t"] > 0:
+		return &ctype{name: "uint64_t", kind: kindInt, bits: 64, unsigned: true}
+	case words["long"] > 0 || words["int32_t"] > 0:
+		return &ctype{name: "long", kind: kindInt, bits: 32, unsigned: unsigned}
+	case words["uint32_t"] > 0:
+		return &ctype{name: "uint32_t", kind: kindInt, bits: 32, unsigned: true}
+	case words["size_t"] > 0:
+		return &ctype{name: "size_t", kind: kindInt, unsigned: true}
+	case words["int"] > 0 || words["signed"] > 0 || unsigned:
+		return &ctype{name: "int", kind: kindInt, unsigned: unsigned}
+	}
+	return nil
+}
+
+// ---------- Declarations ----------
+
+func (p *parser) parseProgram() {
+	for p.peek().kind != tokEOF {
+		if p.accept(";") {
+			continue
+		}
+		p.checkSupported()
+		if !p.atType() {
+			tok := p.peek()
+			if tok.kind == tokIdent && p.peekAt(1).kind == tokIdent {
+				p.fail("%s is not supported; sketches can use the Arduino core functions only", tok.text)
+			}
+			p.fail("expected a declaration but found %s", describe(tok))
+		}
+
+		t := p.parseType()
+		name := p.expectIdent()
+		if p.is("(") {
+			p.parseFunction(t, name)
+			continue
+		}
+		decl := p.parseDeclarators(t, name)
+		p.prog.globals = append(p.prog.globals, decl)
+		p.expect(";")
+	}
+}
+
+func (p *parser) checkSupported() {
+	if tok := p.peek(); tok.kind == tokIdent && unsupported[tok.text] {
+		p.fail("%s is not supported in simulated sketches", tok.text)
+	}
+}
+
+// parseFunction reads a function definition or prototype
+func (p *parser) parseFunction(ret *ctype, name token) {
+	fn := &function{name: name.text, ret: ret, line: name.line}
+	p.expect("(")
+	if p.is("void") && p.peekAt(1).text == ")" {
+		p.advance()
+	}
+	for !p.is(")") {
+		if len(fn.params) > 0 {
+			p.expect(",")
+		}
+		pt := p.parseType()
+		pname := p.expectIdent()
+		prm := param{t: pt, name: pname.text}
+		if p.accept("[") {
+			for !p.accept("]") {
+				p.advance()
+			}
+			prm.array = true
+		}
+		if p.is("=") {
+			p.fail("default arguments are not supported")
+		}
+		fn.params = append(fn.params, prm)
+	}
+	p.expect(")")
+
+	if p.accept(";") {
+		return // prototype
+	}
+	if _, ok := p.prog.funcs[fn.name]; ok {
+		panic(errorAt(name.line, "function %s is defined twice", fn.name))
+	}
+	fn.body = p.parseBlock()
+	p.prog.funcs[fn.name] = fn
+}
+
+// parseDeclarators reads the variables of a declaration after its first name
+func (p *parser) parseDeclarators(t *ctype, name token) *varDecl {
+	if t.kind == kindVoid {
+		panic(errorAt(name.line, "variable %s cannot be void", name.text))
+	}
+	decl := &varDecl{t: t}
+	for {
+		v := declVar{name: name.text, line: name.line}
+		if p.accept("[") {
+			v.array = true
+			if !p.is("]") {
+				v.size = p.parseExpr()
+			}
+			p.expect("]")
+			if p.is("[") {
+				p.fail("multi-dimensional arrays are not supported")
+			}
+		}
+		if p.accept("=") {
+			if p.is("{") {
+				v.init = p.parseInitList()
+			} else {
+				v.init = p.parseAssign()
+			}
+		} else if p.is("(") {
+			p.fail("constructor syntax is not supported; use = to initialize %s", name.text)
+		}
+		if v.array && v.size == nil && v.init == nil {
+			panic(errorAt(name.line, "array %s needs a size or an initializer", name.text))
+		}
+		decl.vars = append(decl.vars, v)
+		if !p.accept(",") {
+			return decl
+		}
+		for p.accept("*") {
+		}
+		name = p.expectIdent()
+	}
+}
+
+func (p *parser) parseInitList() expr {
+	line := p.expect("{").line
+	list := &initList{line: line}
+	for !p.is("}") {
+		list.elems = append(list.elems, p.parseAssign())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect("}")
+	return list
+}
+
+// ---------- Statements ----------
+
+func (p *parser) parseBlock() *block {
+	p.expect("{")
+	b := &block{}
+	for !p.is("}") {
+		if p.peek().kind == tokEOF {
+			p.fail("missing \"}\"")
+		}
+		b.stmts = append(b.stmts, p.parseStatement())
+	}
+	p.expect("}")
+	return b
+}
+
+func (p *parser) parseStatement() stmt {
+	tok := p.peek()
+	line := tok.line
+	p.checkSupported()
+
+	switch {
+	case p.is("{"):
+		return p.parseBlock()
+	case p.accept(";"):
+		return &block{}
+	case p.atType():
+		t := p.parseType()
+		decl := p.parseDeclarators(t, p.expectIdent())
+		p.expect(";")
+		return decl
+	case p.accept("if"):
+		p.expect("(")
+		s := &ifStmt{cond: p.parseExpr(), line: line}
+		p.expect(")")
+		s.then = p.parseStatement()
+		if p.accept("else") {
+			s.els = p.parseStatement()
+		}
+		return s
+	case p.accept("while"):
+		p.expect("(")
+		s := &whileStmt{cond: p.parseExpr(), line: line}
+		p.expect(")")
+		s.body = p.parseStatement()
+		return s
+	case p.accept("do"):
+		s := &doStmt{body: p.parseStatement(), line: line}
+		p.expect("while")
+		p.expect("(")
+		s.cond = p.parseExpr()
+		p.expect(")")
+		p.expect(";")
+		return s
+	case p.accept("for"):
+		return p.parseFor(line)
+	case p.accept("switch"):
+		return p.parseSwitch(line)
+	case p.accept("break"):
+		p.expect(";")
+		return &breakStmt{line: line}
+	case p.accept("continue"):
+		p.expect(";")
+		return &continueStmt{line: line}
+	case p.accept("return"):
+		s := &returnStmt{line: line}
+		if !p.is(";") {
+			s.x = p.parseExpr()
+		}
+		p.expect(";")
+		return s
+	case tok.kind == tokIdent && p.peekAt(1).kind == tokIdent && !typeWords[tok.text]:
+		p.fail("%s is not supported; sketches can use the Arduino core functions only", tok.text)
+	}
+
+	x := p.parseExpr()
+	p.expect(";")
+	return &exprStmt{x: x, line: line}
+}
+
+func (p *parser) parseFor(line int) stmt {
+	s := &forStmt{line: line}
+	p.expect("(")
+	switch {
+	case p.accept(";"):
+	case p.atType():
+		t := p.parseType()
+		s.init = p.parseDeclarators(t, p.expectIdent())
+		p.expect(";")
+	default:
+		s.init = &exprStmt{x: p.parseExpr(), line: line}
+		p.expect(";")
+	}
+	if !p.is(";") {
+		s.cond = p.parseExpr()
+	}
+	p.expect(";")
+	if !p.is(")") {
+		s.post = p.parseExpr()
+	}
+	p.expect(")")
+	s.body = p.parseStatement()
+	return s
+}
+
+func (p *parser) parseSwitch(line int) stmt {
+	s := &switchStmt{line: line}
+	p.expect("(")
+	s.tag = p.parseExpr()
+	p.expect(")")
+	p.expect("{")
+	for !p.accept("}") {
+		switch {
+		case p.peek().kind == tokEOF:
+			p.fail("missing \"}\"")
+		case p.accept("case"):
+			value := p.parseTernary()
+			p.expect(":")
+			s.labels = append(s.labels, caseLabel{value: value, at: len(s.body)})
+		case p.accept("default"):
+			p.expect(":")
+			s.labels = append(s.labels, caseLabel{at: len(s.body)})
+		default:
+			s.body = append(s.body, p.parseStatement())
+		}
+	}
+	return s
+}
+
+// ---------- Expressions ----------
+
+// parseExpr reads an expression; the comma operator evaluates left to right
+func (p *parser) parseExpr() expr {
+	x := p.parseAssign()
+	for p.is(",") {
+		line := p.advance().line
+		x = &binary{op: ",", l: x, r: p.parseAssign(), line: line}
+	}
+	return x
+}
+
+var assignOps = map[string]bool{
+	"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true,
+	"&=": true, "|=": true, "^=": true, "<<=": true, ">>=": true,
+}
+
+func (p *parser) parseAssign() expr {
+	x := p.parseTernary()
+	if tok := p.peek(); tok.kind == tokPunct && assignOps[tok.text] {
+		p.advance()
+		checkLvalue(x, tok.line)
+		return &assign{op: tok.text, target: x, v: p.parseAssign(), line: tok.line}
+	}
+	return x
+}
+
+func checkLvalue(x expr, line int) {
+	switch x.(type) {
+	case *ident, *index:
+	default:
+		panic(errorAt(line, "only a variable or an array element can be assigned"))
+	}
+}
+
+func (p *parser) parseTernary() expr {
+	cond := p.parseBinary(0)
+	if !p.accept("?") {
+		return cond
+	}
+	a := p.parseAssign()
+	p.expect(":")
+	return &ternary{cond: cond, a: a, b: p.parseAssign()}
+}
+
+// binaryLevels lists the binary operators from the loosest binding
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) expr {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	x := p.parseBinary(level + 1)
+	for {
+		tok := p.peek()
+		if tok.kind != tokPunct || !contains(binaryLevels[level], tok.text) {
+			return x
+		}
+		p.advance()
+		x = &binary{op: tok.text, l: x, r: p.parseBinary(level + 1), line: tok.line}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseUnary() expr {
+	tok := p.peek()
+	if tok.kind == tokPunct {
+		switch tok.text {
+		case "!", "~", "-", "+":
+			p.advance()
+			return &unary{op: tok.text, x: p.parseUnary(), line: tok.line}
+		case "++", "--":
+			p.advance()
+			x := p.parseUnary()
+			checkLvalue(x, tok.line)
+			return &incdec{op: tok.text, prefix: true, x: x, line: tok.line}
+		case "&", "*":
+			p.fail("pointers are not supported")
+		case "(":
+			if p.atCast() {
+				p.advance()
+				t := p.parseType()
+				p.expect(")")
+				return &conversion{t: t, x: p.parseUnary()}
+			}
+		}
+	}
+	if tok.kind == tokIdent && tok.text == "sizeof" {
+		p.advance()
+		p.expect("(")
+		s := &sizeOf{}
+		if p.atType() {
+			s.t = p.parseType()
+		} else {
+			s.x = p.parseExpr()
+		}
+		p.expect(")")
+		return s
+	}
+	return p.parsePostfix()
+}
+
+// atCast reports whether a parenthesis opens a cast such as (unsigned long)
+func (p *parser) atCast() bool {
+	k := 1
+	for tok := p.peekAt(k); tok.kind == tokIdent && (typeWords[tok.text] || qualifiers[tok.text]); tok = p.peekAt(k) {
+		k++
+	}
+	for p.peekAt(k).text == "*" {
+		k++
+	}
+	return k > 1 && p.peekAt(k).text == ")"
+}
+
+func (p *parser) parsePostfix() expr {
+	x := p.parsePrimary()
+	for {
+		tok := p.peek()
+		switch {
+		case p.accept("["):
+			x = &index{arr: x, i: p.parseExpr(), line: tok.line}
+			p.expect("]")
+		case p.accept("."), p.accept("->"):
+			name := p.expectIdent()
+			if !p.is("(") {
+				panic(errorAt(name.line, "fields such as %s are not supported", name.text))
+			}
+			x = &call{recv: x, name: name.text, args: p.parseArgs(), line: name.line}
+		case p.is("++") || p.is("--"):
+			p.advance()
+			checkLvalue(x, tok.line)
+			x = &incdec{op: tok.text, x: x, line: tok.line}
+		default:
+			return x
+		}
+	}
+}
+
+func (p *parser) parseArgs() []expr {
+	p.expect("(")
+	var args []expr
+	for !p.is(")") {
+		if len(args) > 0 {
+			p.expect(",")
+		}
+		args = append(args, p.parseAssign())
+	}
+	p.expect(")")
+	return args
+}
+
+func (p *parser) parsePrimary() expr {
+	tok := p.peek()
+	switch tok.kind {
+	case tokInt:
+		p.advance()
+		return &literal{v: intValue(tok.i)}
+	case tokFloat:
+		p.advance()
+		return &literal{v: floatValue(tok.f)}
+	case tokString:
+		p.advance()
+		s := tok.text
+		for p.peek().kind == tokString {
+			// Adjacent literals are joined
+			s += p.advance().text
+		}
+		return &literal{v: stringValue(s)}
+	case tokIdent:
+		if typeWords[tok.text] && p.peekAt(1).text == "(" {
+			// Functional conversion such as int(x) or String(n)
+			t := p.parseType()
+			args := p.parseArgs()
+			if len(args) == 0 {
+				return &literal{v: zeroValue(t)}
+			}
+			if t == typeString && len(args) > 1 {
+				return &call{name: "String", args: args, line: tok.line}
+			}
+			return &conversion{t: t, x: args[0]}
+		}
+		p.advance()
+		if p.is("::") {
+			p.fail("%s:: is not supported", tok.text)
+		}
+		if p.is("(") {
+			return &call{name: tok.text, args: p.parseArgs(), line: tok.line}
+		}
+		return &ident{name: tok.text, line: tok.line}
+	case tokPunct:
+		if tok.text == "(" {
+			p.advance()
+			x := p.parseExpr()
+			p.expect(")")
+			return x
+		}
+		if tok.text == "{" {
+			return p.parseInitList()
+		}
+	}
+	p.fail("expected an expression but found %s", describe(tok))
+	return nil
+}
+
+// usedNames records the functions a sketch calls, so the simulator knows
+// whether it uses PWM
+func usedNames(tokens []token) map[string]bool {
+	used := map[string]bool{}
+	for k, tok := range tokens {
+		if tok.kind == tokIdent && k+1 < len(tokens) && tokens[k+1].text == "(" {
+			name := tok.text
+			if k >= 2 && tokens[k-1].text == "." {
+				name = tokens[k-2].text + "." + name
+			}
+			used[name] = true
+		}
+	}
+	return used
+}
@@ -0,0 +1,110 @@
+// Package sketch runs Arduino sketches on a virtual microcontroller.
+//
+// A sketch is compiled once and run by a Machine against a Board, the
+// hardware its pins are wired to. The machine keeps its own clock: every
+// statement takes a little time and delay() moves the clock on, so the
+// program can be run in step with a circuit simulation.
+//
+// The supported language is the core of Arduino C++: global and local
+// variables of the integer, float, bool and String types, one-dimensional
+// arrays, functions, if/else, for, while, do/while and switch, #define
+// constants, and the functions of the Arduino core for digital and analog
+// I/O, timing, PWM, tone, Serial and math. Pointers, structs, classes and
+// libraries are not supported and fail to compile with a message saying so.
+package sketch
+
+import "fmt"
+
+// Pin modes, as passed to pinMode
+const (
+	ModeInput       = 0
+	ModeOutput      = 1
+	ModeInputPullup = 2
+)
+
+// Board is the hardware a sketch drives. Pins are numbered as in the
+// sketch; analogWrite values are 0-255.
+type Board interface {
+	PinMode(pin, mode int)
+	DigitalWrite(pin int, high bool)
+	DigitalRead(pin int) bool
+	AnalogRead(pin int) int
+	AnalogWrite(pin, value int)
+	// Tone plays a square wave on a pin; frequency 0 silences it
+	Tone(pin int, frequency float64)
+}
+
+// Options describe the board a sketch is compiled for
+type Options struct {
+	IntBits    int   // width of int: 16 on AVR boards, 32 on the others
+	LEDBuiltin int   // pin of LED_BUILTIN
+	AnalogBase int   // pin number of A0
+	AnalogPins int   // analog inputs A0, A1, ...
+	MaxSteps   int64 // statements before the sketch is stopped; 0 = no limit
+}
+
+// Error is a compile or run time error of a sketch
+type Error struct {
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+func errorAt(line int, format string, args ...interface{}) *Error {
+	return &Error{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// SerialLine is a line the sketch printed on Serial
+type SerialLine struct {
+	Time float64 `json:"time"` // s
+	Text string  `json:"text"`
+}
+
+// Program is a compiled sketch
+type Program struct {
+	globals []*varDecl
+	funcs   map[string]*function
+	used    map[string]bool
+}
+
+// Compile parses a sketch and checks that the functions it calls exist
+func Compile(source string) (prog *Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			prog, err = nil, e
+		}
+	}()
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	prog = &Program{funcs: map[string]*function{}, used: usedNames(tokens)}
+	p := &parser{tokens: tokens, prog: prog}
+	p.parseProgram()
+
+	for _, name := range []string{"setup", "loop"} {
+		if fn, ok := prog.funcs[name]; !ok || len(fn.params) > 0 {
+			return nil, &Error{Message: fmt.Sprintf("the sketch needs a void %s() function", name)}
+		}
+	}
+	if err := prog.resolve(); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// Uses reports whether the sketch calls a function, e.g. "analogWrite"
+func (p *Program) Uses(name string) bool {
+	return p.used[name]
+}
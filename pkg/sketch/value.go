@@ -0,0 +1,160 @@
+package sketch
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ============================================
+// Values
+// ============================================
+
+// kindArray is the kind of an array value; declared types never have it
+const kindArray = kindString + 1
+
+// value is an int, float, String or array. Integers are computed on 64
+// bits and wrap to their declared width when stored.
+type value struct {
+	k   kind
+	i   int64
+	f   float64
+	s   string
+	arr *array
+}
+
+// array is an array variable; arrays are passed to functions by reference
+type array struct {
+	t     *ctype
+	elems []value
+}
+
+func intValue(i int64) value     { return value{k: kindInt, i: i} }
+func floatValue(f float64) value { return value{k: kindFloat, f: f} }
+func stringValue(s string) value { return value{k: kindString, s: s} }
+func boolValue(b bool) value {
+	if b {
+		return intValue(1)
+	}
+	return intValue(0)
+}
+
+func zeroValue(t *ctype) value {
+	switch t.kind {
+	case kindFloat:
+		return floatValue(0)
+	case kindString:
+		return stringValue("")
+	}
+	return intValue(0)
+}
+
+func (v value) isNumber() bool {
+	return v.k == kindInt || v.k == kindFloat
+}
+
+func (v value) number() float64 {
+	if v.k == kindFloat {
+		return v.f
+	}
+	return float64(v.i)
+}
+
+// integer truncates a number toward zero
+func (v value) integer() int64 {
+	if v.k == kindFloat {
+		if math.IsNaN(v.f) || math.IsInf(v.f, 0) {
+			return 0
+		}
+		return int64(v.f)
+	}
+	return v.i
+}
+
+func (v value) truthy() bool {
+	switch v.k {
+	case kindFloat:
+		return v.f != 0
+	case kindString:
+		return true
+	case kindArray:
+		return true
+	}
+	return v.i != 0
+}
+
+// text formats a value as String() and Serial.print do: floats with two
+// decimals
+func (v value) text() string {
+	switch v.k {
+	case kindFloat:
+		return formatFloat(v.f, 2)
+	case kindString:
+		return v.s
+	case kindArray:
+		return "[array]"
+	}
+	return strconv.FormatInt(v.i, 10)
+}
+
+func formatFloat(f float64, decimals int) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 0):
+		return "inf"
+	}
+	return strconv.FormatFloat(f, 'f', decimals, 64)
+}
+
+// formatBase formats an integer as Serial.print(n, HEX) and friends,
+// unsigned like the Arduino core does
+func formatBase(i int64, base int) string {
+	if base == 10 {
+		return strconv.FormatInt(i, 10)
+	}
+	u := uint64(i)
+	if i < 0 && i >= math.MinInt32 {
+		u = uint64(uint32(i))
+	}
+	return strings.ToUpper(strconv.FormatUint(u, base))
+}
+
+// wrap reduces an integer to the width of its type
+func wrap(i int64, t *ctype, intBits int) int64 {
+	bits := t.bits
+	if bits == 0 {
+		bits = intBits
+	}
+	switch {
+	case bits == 1:
+		if i != 0 {
+			return 1
+		}
+		return 0
+	case bits >= 64:
+		return i
+	case t.unsigned:
+		return int64(uint64(i) & (1<<uint(bits) - 1))
+	}
+	shift := uint(64 - bits)
+	return i << shift >> shift
+}
+
+// sizeOfType is the size of a type in bytes on the board
+func sizeOfType(t *ctype, intBits int) int64 {
+	switch t.kind {
+	case kindFloat:
+		return 4
+	case kindString:
+		return 6
+	}
+	bits := t.bits
+	if bits == 0 {
+		bits = intBits
+	}
+	if bits == 1 {
+		return 1
+	}
+	return int64(bits / 8)
+}
@@ -1,14 +1,21 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
 	"log"
+	"mime"
 	"mime/multipart"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -16,6 +23,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	_ "golang.org/x/image/webp"
 )
 
 // Storage type constants
@@ -38,6 +46,9 @@ const (
 	MaxAvatarSize   = 5 * 1024 * 1024  // 5MB
 	MaxImageSize    = 10 * 1024 * 1024 // 10MB
 	MaxDocumentSize = 50 * 1024 * 1024 // 50MB
+
+	// MaxImageDimension bounds the width and height of decoded images
+	MaxImageDimension = 4096
 )
 
 var (
@@ -50,6 +61,15 @@ var (
 		"image/svg+xml": ".svg",
 	}
 
+	// detectedImageTypes maps the formats DetectImageType decodes to their
+	// content type; SVG is left out as it can carry script
+	detectedImageTypes = map[string]string{
+		"png":  "image/png",
+		"jpeg": "image/jpeg",
+		"gif":  "image/gif",
+		"webp": "image/webp",
+	}
+
 	// AllowedDocumentTypes for document uploads
 	AllowedDocumentTypes = map[string]string{
 		"application/pdf":  ".pdf",
@@ -60,11 +80,13 @@ var (
 
 	// Custom errors
 	ErrFileTooLarge    = errors.New("file size exceeds maximum allowed")
+	ErrImageTooLarge   = errors.New("image dimensions exceed maximum allowed")
 	ErrInvalidFileType = errors.New("invalid file type")
 	ErrUploadFailed    = errors.New("failed to upload file")
 	ErrDeleteFailed    = errors.New("failed to delete file")
 	ErrStorageNotInit  = errors.New("storage not initialized")
 	ErrBucketNotFound  = errors.New("bucket not found")
+	ErrFileNotFound    = errors.New("file not found")
 )
 
 // MinioConfig holds MinIO configuration
@@ -293,6 +315,51 @@ func (cs *CloudStorage) uploadToLocal(bucket string, file *multipart.FileHeader,
 	return fmt.Sprintf("%s/%s/%s/%s", cs.localBaseURL, cs.localBaseDir, bucket, filename), nil
 }
 
+// UploadBytes stores generated content under a fixed object name, replacing any previous version
+func (cs *CloudStorage) UploadBytes(bucket, objectName string, data []byte, contentType string) (string, error) {
+	if cs.storageType == StorageTypeMinio {
+		bucketName := cs.getBucketName(bucket)
+		_, err := cs.client.PutObject(cs.ctx, bucketName, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+			ContentType: contentType,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to upload to MinIO: %w", err)
+		}
+		return cs.GetFileURL(bucket, objectName), nil
+	}
+
+	destPath := filepath.Join(cs.localBaseDir, bucket, objectName)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return "", ErrUploadFailed
+	}
+	if err := os.WriteFile(destPath, data, 0644); err != nil {
+		return "", ErrUploadFailed
+	}
+
+	return cs.GetFileURL(bucket, objectName), nil
+}
+
+// DetectImageType decodes the header of image content and returns its
+// content type, whatever name or type it was sent with. Images wider or
+// taller than MaxImageDimension are refused before anything decodes them.
+func DetectImageType(data []byte) (string, error) {
+	if len(data) > MaxImageSize {
+		return "", ErrFileTooLarge
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrInvalidFileType
+	}
+	contentType, ok := detectedImageTypes[format]
+	if !ok {
+		return "", ErrInvalidFileType
+	}
+	if config.Width > MaxImageDimension || config.Height > MaxImageDimension {
+		return "", ErrImageTooLarge
+	}
+	return contentType, nil
+}
+
 // UploadAvatar uploads an avatar image
 func (cs *CloudStorage) UploadAvatar(file *multipart.FileHeader, userID string) (string, error) {
 	// Validate file size
@@ -412,6 +479,70 @@ func (cs *CloudStorage) deleteFromLocal(fileURL string) error {
 	return os.Remove(path)
 }
 
+// ReadFile reads a file of a bucket by its URL and returns its content
+// type. URLs outside the bucket, or whose object key leaves it, are
+// ErrFileNotFound.
+func (cs *CloudStorage) ReadFile(bucket, fileURL string) ([]byte, string, error) {
+	objectName, ok := cs.objectName(bucket, fileURL)
+	if !ok {
+		return nil, "", ErrFileNotFound
+	}
+
+	if cs.storageType == StorageTypeMinio {
+		object, err := cs.client.GetObject(cs.ctx, cs.getBucketName(bucket), objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read from MinIO: %w", err)
+		}
+		defer object.Close()
+		info, err := object.Stat()
+		if err != nil {
+			return nil, "", ErrFileNotFound
+		}
+		data, err := io.ReadAll(object)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read from MinIO: %w", err)
+		}
+		return data, info.ContentType, nil
+	}
+
+	filePath := filepath.Join(cs.localBaseDir, bucket, filepath.FromSlash(objectName))
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, "", ErrFileNotFound
+	}
+	return data, mime.TypeByExtension(filepath.Ext(filePath)), nil
+}
+
+// objectName returns the object key of a URL built by GetFileURL for a
+// bucket. The key must be clean and relative: no "..", no empty or
+// absolute paths, no query or fragment.
+func (cs *CloudStorage) objectName(bucket, fileURL string) (string, bool) {
+	prefix := cs.GetFileURL(bucket, "")
+	if !strings.HasPrefix(fileURL, prefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(fileURL, prefix)
+	if name == "" || strings.ContainsAny(name, "?#\\") || strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	if path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// ownsURL reports whether a URL points into this storage
+func (cs *CloudStorage) ownsURL(fileURL string) bool {
+	if fileURL == "" {
+		return false
+	}
+	if cs.storageType == StorageTypeMinio {
+		return strings.Contains(fileURL, cs.config.Endpoint) ||
+			(cs.config.PublicURL != "" && strings.Contains(fileURL, cs.config.PublicURL))
+	}
+	return strings.Contains(fileURL, cs.localBaseDir)
+}
+
 // DeleteOldFile safely deletes an old file (checks if it's from our storage)
 func (cs *CloudStorage) DeleteOldFile(oldURL string) {
 	if oldURL == "" {
@@ -419,15 +550,8 @@ func (cs *CloudStorage) DeleteOldFile(oldURL string) {
 	}
 
 	// Check if it's from our storage
-	if cs.storageType == StorageTypeMinio {
-		if strings.Contains(oldURL, cs.config.Endpoint) ||
-			(cs.config.PublicURL != "" && strings.Contains(oldURL, cs.config.PublicURL)) {
-			cs.DeleteFile(oldURL)
-		}
-	} else {
-		if strings.Contains(oldURL, cs.localBaseDir) {
-			cs.DeleteFile(oldURL)
-		}
+	if cs.ownsURL(oldURL) {
+		cs.DeleteFile(oldURL)
 	}
 }
 
@@ -491,6 +615,22 @@ func UploadProjectThumbnail(file *multipart.FileHeader, projectID string) (strin
 	return DefaultCloudStorage.UploadProjectThumbnail(file, projectID)
 }
 
+// UploadBytes convenience function
+func UploadBytes(bucket, objectName string, data []byte, contentType string) (string, error) {
+	if DefaultCloudStorage == nil {
+		return "", ErrStorageNotInit
+	}
+	return DefaultCloudStorage.UploadBytes(bucket, objectName, data, contentType)
+}
+
+// ReadFile convenience function
+func ReadFile(bucket, fileURL string) ([]byte, string, error) {
+	if DefaultCloudStorage == nil {
+		return nil, "", ErrStorageNotInit
+	}
+	return DefaultCloudStorage.ReadFile(bucket, fileURL)
+}
+
 // DeleteOldAvatar convenience function
 func DeleteOldAvatar(oldURL string) {
 	if DefaultCloudStorage == nil {
@@ -0,0 +1,224 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================
+// Line Diff
+// ============================================
+
+// Line operations
+const (
+	OpEqual  = " "
+	OpDelete = "-"
+	OpInsert = "+"
+)
+
+// maxTableCells bounds the LCS table; larger changes are reported as one
+// replacement of the changed region
+const maxTableCells = 4_000_000
+
+// Line is a line of a hunk
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Hunk is a run of changes with its surrounding context. Starts are 1-based
+// line numbers, as in a unified diff.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Diff is a line diff of two texts
+type Diff struct {
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Hunks   []Hunk `json:"hunks"`
+}
+
+// IsEmpty returns true when both texts have the same lines
+func (d *Diff) IsEmpty() bool {
+	return d.Added == 0 && d.Removed == 0
+}
+
+// Unified renders the diff in unified diff format
+func (d *Diff) Unified(fromName, toName string) string {
+	if d.IsEmpty() {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range d.Hunks {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		for _, l := range h.Lines {
+			b.WriteString(l.Op)
+			b.WriteString(l.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	if lines == 0 {
+		// An empty range names the line before it
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Lines compares two texts line by line, keeping context unchanged lines
+// around each change
+func Lines(from, to string, context int) *Diff {
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	diff := &Diff{Hunks: []Hunk{}}
+	for _, op := range ops {
+		switch op.Op {
+		case OpInsert:
+			diff.Added++
+		case OpDelete:
+			diff.Removed++
+		}
+	}
+	if diff.IsEmpty() {
+		return diff
+	}
+
+	// Line numbers of each op in both texts
+	oldLine, newLine := make([]int, len(ops)), make([]int, len(ops))
+	o, n := 1, 1
+	for i, op := range ops {
+		oldLine[i], newLine[i] = o, n
+		if op.Op != OpInsert {
+			o++
+		}
+		if op.Op != OpDelete {
+			n++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Op == OpEqual {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		// Extend over changes closer than twice the context
+		end, equal := i, 0
+		for j := i; j < len(ops) && equal <= 2*context; j++ {
+			if ops[j].Op == OpEqual {
+				equal++
+			} else {
+				equal = 0
+				end = j
+			}
+		}
+		end = min(end+context, len(ops)-1)
+
+		h := Hunk{OldStart: oldLine[start], NewStart: newLine[start], Lines: ops[start : end+1]}
+		for _, l := range h.Lines {
+			if l.Op != OpInsert {
+				h.OldLines++
+			}
+			if l.Op != OpDelete {
+				h.NewLines++
+			}
+		}
+		diff.Hunks = append(diff.Hunks, h)
+		i = end + 1
+	}
+	return diff
+}
+
+// splitLines splits a text into lines; a final newline ends the last line
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines aligns two line lists on their longest common subsequence
+func diffLines(a, b []string) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]Line, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		ops = append(ops, Line{OpEqual, l})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, Line{OpEqual, l})
+	}
+	return ops
+}
+
+func diffMiddle(a, b []string) []Line {
+	ops := make([]Line, 0, len(a)+len(b))
+	if len(a)*len(b) > maxTableCells {
+		for _, l := range a {
+			ops = append(ops, Line{OpDelete, l})
+		}
+		for _, l := range b {
+			ops = append(ops, Line{OpInsert, l})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Line{OpEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Line{OpDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, Line{OpInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Line{OpDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Line{OpInsert, b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,283 @@
+package workspace
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Function is a function defined in a file
+type Function struct {
+	Name  string `json:"name"`
+	Line  int    `json:"line"`
+	Empty bool   `json:"empty"` // the body does nothing
+}
+
+// cKeywords look like calls followed by a block but are not functions
+var cKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true,
+	"return": true, "sizeof": true, "else": true, "do": true,
+}
+
+var pythonDef = regexp.MustCompile(`^(\s*)(?:async\s+)?def\s+([A-Za-z_]\w*)\s*\(`)
+
+// Functions finds the functions a file defines. Files are read lexically,
+// so code that does not compile is read too; text files define none.
+func (f *File) Functions() []Function {
+	switch f.Language {
+	case "arduino", "c", "cpp":
+		return cFunctions(f.Content)
+	case "micropython", "python":
+		return pythonFunctions(f.Content)
+	}
+	return []Function{}
+}
+
+// cFunctions finds definitions at the top level of C-family code: a name,
+// a parameter list and a body
+func cFunctions(src string) []Function {
+	code := stripC(src)
+	functions := []Function{}
+	depth, line := 0, 1
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '\n':
+			line++
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == '(' && depth == 0:
+			name := identBefore(code, i)
+			if name == "" || cKeywords[name] {
+				continue
+			}
+			closeParen := matching(code, i, '(', ')')
+			if closeParen < 0 {
+				return functions
+			}
+			open := skipQualifiers(code, closeParen+1)
+			if open >= len(code) || code[open] != '{' {
+				continue
+			}
+			closeBrace := matching(code, open, '{', '}')
+			if closeBrace < 0 {
+				closeBrace = len(code) - 1
+			}
+			body := strings.Trim(code[open+1:closeBrace], " \t\r\n;")
+			functions = append(functions, Function{Name: name, Line: line, Empty: body == ""})
+			line += strings.Count(code[i:closeBrace], "\n")
+			i = closeBrace
+		}
+	}
+	return functions
+}
+
+// stripC blanks out comments, string and character literals and
+// preprocessor lines, keeping line breaks so lines still count
+func stripC(src string) string {
+	out := []byte(src)
+	blank := func(from, to int) {
+		for k := from; k < to && k < len(out); k++ {
+			if out[k] != '\n' {
+				out[k] = ' '
+			}
+		}
+	}
+	lineStart := true
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			blank(i, i+end)
+			i += end
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			blank(i, i+end+4)
+			i += end + 4
+			continue
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			blank(i, j+1)
+			i = j + 1
+			continue
+		case c == '#' && lineStart:
+			// Directives run to the end of the line, or on with a backslash
+			j := i
+			for j < len(src) && (src[j] != '\n' || (j > 0 && src[j-1] == '\\')) {
+				j++
+			}
+			blank(i, j)
+			i = j
+			continue
+		}
+		if c == '\n' {
+			lineStart = true
+		} else if c != ' ' && c != '\t' && c != '\r' {
+			lineStart = false
+		}
+		i++
+	}
+	return string(out)
+}
+
+// identBefore returns the identifier that ends right before position i,
+// skipping white space
+func identBefore(code string, i int) string {
+	end := i
+	for end > 0 && strings.ContainsRune(" \t\r\n", rune(code[end-1])) {
+		end--
+	}
+	start := end
+	for start > 0 && isIdentByte(code[start-1]) {
+		start--
+	}
+	if start == end || (code[start] >= '0' && code[start] <= '9') {
+		return ""
+	}
+	return code[start:end]
+}
+
+// skipQualifiers skips white space and words such as const or override
+// between a parameter list and a body
+func skipQualifiers(code string, i int) int {
+	for i < len(code) {
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(code[i])):
+			i++
+		case isIdentByte(code[i]):
+			for i < len(code) && isIdentByte(code[i]) {
+				i++
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// matching returns the position of the bracket closing the one at i, or -1
+func matching(code string, i int, open, close byte) int {
+	depth := 0
+	for ; i < len(code); i++ {
+		switch code[i] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// pythonFunctions finds def statements and reads their indented bodies
+func pythonFunctions(src string) []Function {
+	lines := strings.Split(src, "\n")
+	functions := []Function{}
+	for i := 0; i < len(lines); i++ {
+		m := pythonDef.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+
+		// The signature ends on the line closing its parameter list
+		end, open := i, strings.Count(lines[i], "(")-strings.Count(lines[i], ")")
+		for open > 0 && end < len(lines)-1 && end < i+20 {
+			end++
+			open += strings.Count(lines[end], "(") - strings.Count(lines[end], ")")
+		}
+		statements := []string{}
+		signature := pythonCode(lines[end])
+		if closeParen := strings.LastIndex(signature, ")"); closeParen >= 0 {
+			if colon := strings.Index(signature[closeParen:], ":"); colon >= 0 {
+				if rest := strings.TrimSpace(signature[closeParen+colon+1:]); rest != "" {
+					statements = append(statements, rest) // def f(): return 1
+				}
+			}
+		}
+		for j := end + 1; j < len(lines); j++ {
+			code := pythonCode(lines[j])
+			if code == "" {
+				continue
+			}
+			if leadingSpace(lines[j]) <= indent {
+				break
+			}
+			statements = append(statements, code)
+		}
+		functions = append(functions, Function{Name: m[2], Line: i + 1, Empty: !doesSomething(statements)})
+	}
+	return functions
+}
+
+// doesSomething reports whether a Python body has a statement other than
+// pass, ... or a docstring
+func doesSomething(statements []string) bool {
+	inDocstring := ""
+	for _, s := range statements {
+		if inDocstring != "" {
+			if strings.Contains(s, inDocstring) {
+				inDocstring = ""
+			}
+			continue
+		}
+		if s == "pass" || s == "..." {
+			continue
+		}
+		if quote := docstringQuote(s); quote != "" {
+			if strings.Count(s, quote) < 2 {
+				inDocstring = quote
+			}
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func docstringQuote(s string) string {
+	for _, quote := range []string{`"""`, `'''`} {
+		if strings.HasPrefix(s, quote) {
+			return quote
+		}
+	}
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `'`) {
+		return s[:1]
+	}
+	return ""
+}
+
+// pythonCode returns a line without its comment and surrounding space
+func pythonCode(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 && !strings.ContainsAny(line[:i], `"'`) {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+func leadingSpace(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
@@ -0,0 +1,95 @@
+package workspace
+
+import (
+	"path"
+	"strings"
+)
+
+// sketchLanguages are the languages joined into a sketch
+var sketchLanguages = map[string]bool{"arduino": true, "c": true, "cpp": true}
+
+// IsSketchLanguage reports whether files in a language are part of a sketch
+func IsSketchLanguage(language string) bool {
+	return sketchLanguages[language]
+}
+
+// Source is the program built from the files of a workspace
+type Source struct {
+	Text  string
+	spans []span
+}
+
+// span is where a file starts in a source
+type span struct {
+	path  string
+	start int // line of the source the file's first line is on
+}
+
+// Sketch joins the files a board runs into one source, the way the Arduino
+// IDE builds a sketch: headers first so their definitions are known, then
+// the main file, then the other files of the sketch languages, each group
+// in path order. It returns nil when the main file is not in a sketch
+// language.
+func (w *Workspace) Sketch() *Source {
+	main := w.MainFile()
+	if main == nil || !IsSketchLanguage(main.Language) {
+		return nil
+	}
+
+	headers, sources := []*File{}, []*File{}
+	for i := range w.Files {
+		f := &w.Files[i]
+		switch {
+		case f == main || !IsSketchLanguage(f.Language):
+		case isHeader(f.Path):
+			headers = append(headers, f)
+		default:
+			sources = append(sources, f)
+		}
+	}
+
+	src := &Source{}
+	var text strings.Builder
+	line := 1
+	for _, f := range append(append(headers, main), sources...) {
+		src.spans = append(src.spans, span{path: f.Path, start: line})
+		text.WriteString(f.Content)
+		if !strings.HasSuffix(f.Content, "\n") {
+			text.WriteByte('\n')
+		}
+		line += strings.Count(f.Content, "\n")
+		if !strings.HasSuffix(f.Content, "\n") {
+			line++
+		}
+	}
+	src.Text = text.String()
+	return src
+}
+
+// Locate maps a line of the source to the file it came from and the line
+// in that file
+func (s *Source) Locate(line int) (string, int) {
+	for i := len(s.spans) - 1; i >= 0; i-- {
+		if line >= s.spans[i].start {
+			return s.spans[i].path, line - s.spans[i].start + 1
+		}
+	}
+	return "", line
+}
+
+// Files returns the paths of the files in the source, in order
+func (s *Source) Files() []string {
+	paths := make([]string, len(s.spans))
+	for i, sp := range s.spans {
+		paths[i] = sp.path
+	}
+	return paths
+}
+
+func isHeader(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".h", ".hpp":
+		return true
+	}
+	return false
+}
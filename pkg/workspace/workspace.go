@@ -0,0 +1,444 @@
+// Package workspace models the code of a project: files in folders, each in
+// a language, and the main file that builds and simulations start from.
+//
+// Version 1 stored a single file as {content, language, filename}; Parse
+// upgrades it to a workspace holding that file as its main file.
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CurrentVersion is the workspace format version written by Marshal
+const CurrentVersion = 2
+
+// Limits of a workspace
+const (
+	MaxFiles      = 100
+	MaxFileSize   = 256 << 10 // bytes of content per file
+	MaxPathLength = 200
+	MaxDepth      = 8 // folders a file can be nested in
+)
+
+// Languages are the languages a file can be in; text is for notes and data
+var Languages = []string{"arduino", "c", "cpp", "micropython", "python", "text"}
+
+// extensionLanguages give the language of a new file from its extension
+var extensionLanguages = map[string]string{
+	".ino": "arduino",
+	".c":   "c",
+	".h":   "cpp",
+	".hpp": "cpp",
+	".cpp": "cpp",
+	".cc":  "cpp",
+	".py":  "micropython",
+}
+
+// Errors returned by workspace operations
+var (
+	ErrInvalidPath     = errors.New("invalid path")
+	ErrInvalidLanguage = errors.New("invalid language")
+	ErrFileNotFound    = errors.New("file not found")
+	ErrFolderNotFound  = errors.New("folder not found")
+	ErrPathExists      = errors.New("path already exists")
+	ErrTooManyFiles    = errors.New("too many files")
+	ErrFileTooLarge    = errors.New("file is too large")
+	ErrMainFile        = errors.New("the main file cannot be removed")
+)
+
+// File is a file of the workspace
+type File struct {
+	Path     string `json:"path"` // e.g. "src/motor.cpp"
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+// Workspace is the code of a project
+type Workspace struct {
+	Version   int      `json:"version"`
+	Main      string   `json:"main"`    // path of the entry file
+	Files     []File   `json:"files"`   // sorted by path
+	Folders   []string `json:"folders"` // every folder, including the parents of files
+	LastSaved string   `json:"last_saved,omitempty"`
+}
+
+// New returns an empty workspace
+func New() *Workspace {
+	return &Workspace{Version: CurrentVersion, Files: []File{}, Folders: []string{}}
+}
+
+// Parse decodes stored code data, upgrading the single-file format.
+// Empty data gives an empty workspace.
+func Parse(data []byte) (*Workspace, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return New(), nil
+	}
+
+	var raw struct {
+		Version   int      `json:"version"`
+		Main      string   `json:"main"`
+		Files     []File   `json:"files"`
+		Folders   []string `json:"folders"`
+		LastSaved string   `json:"last_saved"`
+		// Version 1
+		Content  *string `json:"content"`
+		Language string  `json:"language"`
+		Filename string  `json:"filename"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.New("invalid code data")
+	}
+	if raw.Version > CurrentVersion {
+		return nil, fmt.Errorf("code version %d is newer than supported version %d", raw.Version, CurrentVersion)
+	}
+
+	w := New()
+	w.LastSaved = raw.LastSaved
+	if raw.Files == nil && raw.Content != nil {
+		language := strings.ToLower(raw.Language)
+		if !ValidLanguage(language) {
+			language = "arduino"
+		}
+		filePath, err := CleanPath(raw.Filename)
+		if err != nil {
+			filePath = DefaultPath(language)
+		}
+		w.Files = append(w.Files, File{Path: filePath, Language: language, Content: *raw.Content})
+		w.Main = filePath
+	} else {
+		for _, f := range raw.Files {
+			if f.Path, _ = CleanPath(f.Path); f.Path != "" && w.File(f.Path) == nil {
+				w.Files = append(w.Files, f)
+			}
+		}
+		for _, folder := range raw.Folders {
+			if folder, err := CleanPath(folder); err == nil {
+				w.Folders = append(w.Folders, folder)
+			}
+		}
+		w.Main = raw.Main
+	}
+	w.normalize()
+	return w, nil
+}
+
+// Marshal encodes the workspace in the current format
+func (w *Workspace) Marshal() ([]byte, error) {
+	w.Version = CurrentVersion
+	return json.Marshal(w)
+}
+
+// IsEmpty reports a workspace without code
+func (w *Workspace) IsEmpty() bool {
+	for _, f := range w.Files {
+		if strings.TrimSpace(f.Content) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// File returns the file at a path, or nil
+func (w *Workspace) File(filePath string) *File {
+	for i := range w.Files {
+		if w.Files[i].Path == filePath {
+			return &w.Files[i]
+		}
+	}
+	return nil
+}
+
+// MainFile returns the entry file, or nil when the workspace has no files
+func (w *Workspace) MainFile() *File {
+	return w.File(w.Main)
+}
+
+// Put creates or replaces a file. An empty language keeps the language of
+// an existing file, or is taken from the extension of a new one.
+func (w *Workspace) Put(filePath, language, content string) (*File, error) {
+	filePath, err := CleanPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	language = strings.ToLower(language)
+	if language != "" && !ValidLanguage(language) {
+		return nil, ErrInvalidLanguage
+	}
+	if len(content) > MaxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	if f := w.File(filePath); f != nil {
+		f.Content = content
+		if language != "" {
+			f.Language = language
+		}
+		return f, nil
+	}
+
+	if len(w.Files) >= MaxFiles {
+		return nil, ErrTooManyFiles
+	}
+	if err := w.checkFree(filePath); err != nil {
+		return nil, err
+	}
+	if language == "" {
+		language = LanguageFor(filePath)
+	}
+	w.Files = append(w.Files, File{Path: filePath, Language: language, Content: content})
+	w.normalize()
+	return w.File(filePath), nil
+}
+
+// SetLanguage changes the language of a file
+func (w *Workspace) SetLanguage(filePath, language string) error {
+	language = strings.ToLower(language)
+	if !ValidLanguage(language) {
+		return ErrInvalidLanguage
+	}
+	f := w.find(filePath)
+	if f == nil {
+		return ErrFileNotFound
+	}
+	f.Language = language
+	return nil
+}
+
+// Move renames a file or moves it to another folder. A language that came
+// from the old extension follows the new one.
+func (w *Workspace) Move(from, to string) error {
+	f := w.find(from)
+	if f == nil {
+		return ErrFileNotFound
+	}
+	from = f.Path
+	to, err := CleanPath(to)
+	if err != nil {
+		return err
+	}
+	if to == from {
+		return nil
+	}
+	if err := w.checkFree(to); err != nil {
+		return err
+	}
+
+	if f.Language == LanguageFor(from) {
+		f.Language = LanguageFor(to)
+	}
+	f.Path = to
+	if w.Main == from {
+		w.Main = to
+	}
+	w.normalize()
+	return nil
+}
+
+// Remove deletes a file; the main file cannot be deleted
+func (w *Workspace) Remove(filePath string) error {
+	f := w.find(filePath)
+	if f == nil {
+		return ErrFileNotFound
+	}
+	filePath = f.Path
+	if filePath == w.Main {
+		return ErrMainFile
+	}
+	for i := range w.Files {
+		if w.Files[i].Path == filePath {
+			w.Files = append(w.Files[:i], w.Files[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// AddFolder creates a folder with its parents; creating an existing folder
+// does nothing
+func (w *Workspace) AddFolder(folder string) error {
+	folder, err := CleanPath(folder)
+	if err != nil {
+		return err
+	}
+	if w.hasFolder(folder) {
+		return nil
+	}
+	if err := w.checkFree(folder); err != nil {
+		return err
+	}
+	w.Folders = append(w.Folders, folder)
+	w.normalize()
+	return nil
+}
+
+// RemoveFolder deletes a folder with everything in it and returns how many
+// files were deleted. A folder holding the main file cannot be deleted.
+func (w *Workspace) RemoveFolder(folder string) (int, error) {
+	folder, _ = CleanPath(folder)
+	if !w.hasFolder(folder) {
+		return 0, ErrFolderNotFound
+	}
+	if inFolder(w.Main, folder) {
+		return 0, ErrMainFile
+	}
+
+	files := w.Files[:0]
+	for _, f := range w.Files {
+		if !inFolder(f.Path, folder) {
+			files = append(files, f)
+		}
+	}
+	removed := len(w.Files) - len(files)
+	w.Files = files
+
+	folders := w.Folders[:0]
+	for _, f := range w.Folders {
+		if f != folder && !inFolder(f, folder) {
+			folders = append(folders, f)
+		}
+	}
+	w.Folders = folders
+	return removed, nil
+}
+
+// SetMain makes a file the entry file
+func (w *Workspace) SetMain(filePath string) error {
+	f := w.find(filePath)
+	if f == nil {
+		return ErrFileNotFound
+	}
+	w.Main = f.Path
+	return nil
+}
+
+// find returns the file at a path given by a client, or nil
+func (w *Workspace) find(filePath string) *File {
+	filePath, err := CleanPath(filePath)
+	if err != nil {
+		return nil
+	}
+	return w.File(filePath)
+}
+
+// checkFree checks that a new file or folder can be created at a path:
+// nothing is there yet, no parent is a file and it is not nested too deep
+func (w *Workspace) checkFree(p string) error {
+	if w.File(p) != nil || w.hasFolder(p) {
+		return ErrPathExists
+	}
+	if strings.Count(p, "/") > MaxDepth {
+		return ErrInvalidPath
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if w.File(dir) != nil {
+			return ErrPathExists
+		}
+	}
+	return nil
+}
+
+func (w *Workspace) hasFolder(folder string) bool {
+	for _, f := range w.Folders {
+		if f == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize sorts files and folders, lists the parents of every file as
+// folders, fills in languages and picks a main file when there is none
+func (w *Workspace) normalize() {
+	sort.Slice(w.Files, func(i, j int) bool { return w.Files[i].Path < w.Files[j].Path })
+
+	folders := map[string]bool{}
+	add := func(p string) {
+		for dir := p; dir != "." && dir != ""; dir = path.Dir(dir) {
+			folders[dir] = true
+		}
+	}
+	for _, folder := range w.Folders {
+		add(folder)
+	}
+	for i := range w.Files {
+		add(path.Dir(w.Files[i].Path))
+		if !ValidLanguage(w.Files[i].Language) {
+			w.Files[i].Language = LanguageFor(w.Files[i].Path)
+		}
+	}
+	w.Folders = make([]string, 0, len(folders))
+	for folder := range folders {
+		w.Folders = append(w.Folders, folder)
+	}
+	sort.Strings(w.Folders)
+
+	if w.File(w.Main) == nil {
+		w.Main = ""
+		// Prefer a sketch at the top, as the Arduino IDE does
+		for _, f := range w.Files {
+			if w.Main == "" || (path.Ext(f.Path) == ".ino" && path.Ext(w.Main) != ".ino") {
+				w.Main = f.Path
+			}
+		}
+	}
+}
+
+// CleanPath checks a path given by a client and returns it in canonical
+// form: relative, separated by "/", without "." or ".." elements
+func CleanPath(p string) (string, error) {
+	p = strings.TrimSpace(strings.ReplaceAll(p, "\\", "/"))
+	if p == "" || strings.HasPrefix(p, "/") || len(p) > MaxPathLength {
+		return "", ErrInvalidPath
+	}
+	p = path.Clean(p)
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", ErrInvalidPath
+	}
+	for _, r := range p {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`:*?"<>|`, r) {
+			return "", ErrInvalidPath
+		}
+	}
+	return p, nil
+}
+
+// LanguageFor returns the language of a file from its extension
+func LanguageFor(filePath string) string {
+	if language, ok := extensionLanguages[strings.ToLower(path.Ext(filePath))]; ok {
+		return language
+	}
+	return "text"
+}
+
+// DefaultPath names the main file of a new workspace in a language
+func DefaultPath(language string) string {
+	switch language {
+	case "c":
+		return "main.c"
+	case "cpp":
+		return "main.cpp"
+	case "micropython", "python":
+		return "main.py"
+	}
+	return "main.ino"
+}
+
+// ValidLanguage reports whether a file can be in a language
+func ValidLanguage(language string) bool {
+	for _, l := range Languages {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// inFolder reports whether a path lies inside a folder
+func inFolder(p, folder string) bool {
+	return strings.HasPrefix(p, folder+"/")
+}
@@ -129,6 +129,9 @@ func (w *LabWorker) startSessionExpirationWorker() {
 		// Clear lab current user
 		w.labRepo.ClearCurrentUser(job.LabID)
 
+		// Stop recording readings for a deployment staged on the session
+		w.labRepo.CompleteSessionDeployment(job.SessionID)
+
 		// Notify user
 		rabbitmq.PublishNotification(rabbitmq.NotificationJob{
 			UserID:  job.UserID,
@@ -378,6 +381,31 @@ func (w *LabWorker) startMQTTHandlers() {
 		w.labRepo.UpdateHeartbeat(heartbeat.LabID, isOnline)
 	})
 
+	// Record sensor readings of sessions a simulation was deployed to, to
+	// compare them with the simulation's predictions
+	mqtt.Subscribe("lab/+/sensors", 1, func(topic string, payload []byte) {
+		var msg mqtt.SensorMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return
+		}
+
+		session, err := w.labRepo.FindActiveSessionByLab(msg.LabID)
+		if err != nil {
+			return
+		}
+		if _, err := w.labRepo.FindDeploymentBySession(session.ID); err != nil {
+			return
+		}
+
+		data, _ := json.Marshal(msg.Sensors)
+		w.labRepo.CreateHardwareLog(&models.LabHardwareLog{
+			LabID:     msg.LabID,
+			SessionID: &session.ID,
+			EventType: models.EventTypeSensorRead,
+			EventData: data,
+		})
+	})
+
 	// Handle serial responses
 	mqtt.Subscribe("lab/+/serial/response", 1, func(topic string, payload []byte) {
 		// Forward to WebSocket clients
@@ -0,0 +1,116 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"nexfi-backend/api/services"
+	"nexfi-backend/pkg/rabbitmq"
+	"runtime/debug"
+
+	"gorm.io/gorm"
+)
+
+// SimulationWorker runs queued simulation runs with the backend engine
+type SimulationWorker struct {
+	service *services.SimulationService
+	workers int
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewSimulationWorker creates a new SimulationWorker
+func NewSimulationWorker(db *gorm.DB) *SimulationWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SimulationWorker{
+		service: services.NewSimulationService(db),
+		workers: services.SimulationWorkers(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start starts one consumer per concurrent run, which bounds the CPUs
+// simulations use
+func (w *SimulationWorker) Start() {
+	log.Printf("🏭 Starting %d simulation workers...", w.workers)
+
+	// Runs a previous process was executing when it stopped never finish
+	if err := w.service.ResetStaleRuns(); err != nil {
+		log.Printf("Failed to reset stale simulation runs: %v", err)
+	}
+
+	for i := 0; i < w.workers; i++ {
+		go w.startSimulationRunWorker()
+	}
+	go w.startExpiredRunWorker()
+}
+
+// Stop stops the workers; runs in progress are cancelled
+func (w *SimulationWorker) Stop() {
+	log.Println("🛑 Stopping simulation workers...")
+	w.cancel()
+}
+
+// ============================================
+// Simulation Run Worker
+// ============================================
+
+func (w *SimulationWorker) startSimulationRunWorker() {
+	err := rabbitmq.ConsumeWithContext(w.ctx, rabbitmq.QueueSimulationRun, func(body []byte) error {
+		var job rabbitmq.SimulationRunJob
+		if err := json.Unmarshal(body, &job); err != nil {
+			log.Printf("Failed to parse simulation run job: %v", err)
+			return nil // Don't retry
+		}
+
+		log.Printf("⚡ Processing simulation run: %s (simulation: %s)", job.RunID, job.SimulationID)
+
+		// Failed runs are recorded on the run, not retried
+		if err := w.run(job); err != nil {
+			log.Printf("Simulation run %s failed: %v", job.RunID, err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Failed to start simulation run worker: %v", err)
+	}
+}
+
+// startExpiredRunWorker ends the runs whose job waited out the queue TTL
+func (w *SimulationWorker) startExpiredRunWorker() {
+	err := rabbitmq.ConsumeWithContext(w.ctx, rabbitmq.QueueSimulationRunExpired, func(body []byte) error {
+		var job rabbitmq.SimulationRunJob
+		if err := json.Unmarshal(body, &job); err != nil {
+			log.Printf("Failed to parse expired simulation run job: %v", err)
+			return nil // Don't retry
+		}
+
+		if err := w.service.ExpireRun(job); err != nil {
+			log.Printf("Failed to expire simulation run %s: %v", job.RunID, err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("Failed to start expired simulation run worker: %v", err)
+	}
+}
+
+// run executes a job within the time limit
+func (w *SimulationWorker) run(job rabbitmq.SimulationRunJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+			w.service.FailRun(job, "The simulator failed unexpectedly")
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(w.ctx, services.SimulationTimeLimit())
+	defer cancel()
+
+	_, err = w.service.ExecuteRun(ctx, job)
+	return err
+}